@@ -0,0 +1,45 @@
+// Command nyc2025 deploys and drives Solidity contracts; see the README
+// for its subcommands. It is a thin wrapper around package deployer.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"example.com/flowstate/deployer"
+)
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The first SIGINT/SIGTERM cancels ctx so in-flight waits return and
+	// deferred cleanup runs; a second one falls through to the default
+	// handler and kills the process.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		signal.Stop(sigs)
+		fmt.Fprintf(os.Stderr, "\nreceived %v, shutting down (repeat to force)\n", sig)
+		cancel()
+	}()
+
+	// Main is the single exit point: every failure comes back here as an
+	// error and leaves with the status of its class (see
+	// deployer.ExitCode).
+	err := deployer.Main(ctx, os.Args[1:])
+	if err == nil {
+		return
+	}
+	var reported *deployer.ReportedError
+	if !errors.As(err, &reported) {
+		log.Print(err)
+	}
+	os.Exit(deployer.ExitCode(err))
+}
@@ -4,6 +4,8 @@ pragma solidity ^0.8.20;
 contract HelloWorld {
     string private greeting;
 
+    event GreetingChanged(address indexed by, string greeting);
+
     constructor(string memory _greeting) {
         greeting = _greeting;
     }
@@ -14,5 +16,6 @@ contract HelloWorld {
 
     function setGreeting(string calldata _greeting) external {
         greeting = _greeting;
+        emit GreetingChanged(msg.sender, _greeting);
     }
 }
@@ -0,0 +1,311 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ABIReport is the result of an `abi` subcommand: the canonical
+// signature, its selector or topic, encoded data, decoded values, or an
+// ABI in human-readable form.
+type ABIReport struct {
+	Signature string       `json:"signature,omitempty"`
+	Selector  string       `json:"selector,omitempty"`
+	Topic     *common.Hash `json:"topic,omitempty"`
+	Data      string       `json:"data,omitempty"`
+	Values    []typedValue `json:"values,omitempty"`
+	Fragments []string     `json:"fragments,omitempty"`
+}
+
+// abiCommands are the `abi` subcommands; abiUsages their usage lines,
+// which the subcommands themselves print.
+var (
+	abiCommands = map[string]func(ctx context.Context, args []string) error{
+		"encode":      runABIEncode,
+		"decode":      runABIDecode,
+		"selector":    runABISelector,
+		"event-topic": runABIEventTopic,
+		"to-human":    runABIToHuman,
+	}
+	abiUsages = map[string]string{
+		"encode":      "encode [--packed] [--args <json>] <signature> [args...]",
+		"decode":      "decode <types> <0xhex>",
+		"selector":    "selector <signature>",
+		"event-topic": "event-topic <signature>",
+		"to-human":    "to-human <artifact>",
+	}
+)
+
+func abiUsage() error {
+	var usages []string
+	for _, usage := range abiUsages {
+		usages = append(usages, "abi "+usage)
+	}
+	sort.Strings(usages)
+	return errors.New("usage:\n  " + strings.Join(usages, "\n  "))
+}
+
+// runABI implements `abi <subcommand> [flags] [args...]`: offline ABI
+// encoding utilities.
+func runABI(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return abiUsage()
+	}
+	run, ok := abiCommands[args[0]]
+	if !ok {
+		return abiUsage()
+	}
+	return run(ctx, args[1:])
+}
+
+// abiFlags parses the flags every `abi` subcommand takes and checks it got
+// n positional arguments, or at least -n if n is negative.
+func abiFlags(name string, args []string, n int, extra func(fs *flag.FlagSet)) (*flag.FlagSet, error) {
+	fs := flag.NewFlagSet("abi "+name, flag.ExitOnError)
+	var o options
+	o.register(fs)
+	if extra != nil {
+		extra(fs)
+	}
+	if err := parseFlags(fs, args, &o); err != nil {
+		return nil, err
+	}
+	if (n >= 0 && fs.NArg() != n) || (n < 0 && fs.NArg() < -n) {
+		return nil, errors.New("usage: abi " + abiUsages[name])
+	}
+	return fs, nil
+}
+
+// runABIEncode implements `abi encode <signature> [args...]`: the selector
+// and encoded arguments of a call. A signature without a name, such as
+// "(address,uint256)", encodes the arguments alone, like abi.encode, and
+// --packed encodes them as abi.encodePacked does.
+func runABIEncode(ctx context.Context, args []string) error {
+	var packed *bool
+	var argsJSON *string
+	fs, err := abiFlags("encode", args, -1, func(fs *flag.FlagSet) {
+		packed = fs.Bool("packed", false, "encode as abi.encodePacked: no selector, and values at their natural width")
+		argsJSON = fs.String("args", "", "arguments as a JSON array")
+	})
+	if err != nil {
+		return err
+	}
+	sig := fs.Arg(0)
+	bare := strings.HasPrefix(strings.TrimSpace(sig), "(")
+	if bare {
+		sig = "f" + strings.TrimSpace(sig)
+	}
+	m, err := methodFromSignature(sig)
+	if err != nil {
+		return err
+	}
+	raw, err := rawArgs(fs.Args()[1:], *argsJSON)
+	if err != nil {
+		return err
+	}
+	vals, err := convertArgs(m.Inputs, raw)
+	if err != nil {
+		return fmt.Errorf("%s: %w", m.Sig, err)
+	}
+
+	report := &ABIReport{}
+	ui.report.ABI = report
+	var data []byte
+	switch {
+	case *packed:
+		if data, err = encodePacked(m.Inputs, vals); err != nil {
+			return err
+		}
+	case bare:
+		if data, err = m.Inputs.Pack(vals...); err != nil {
+			return fmt.Errorf("encode: %w", err)
+		}
+	default:
+		args, err := m.Inputs.Pack(vals...)
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", m.Sig, err)
+		}
+		data = append(m.ID, args...)
+		report.Signature, report.Selector = m.Sig, hexutil.Encode(m.ID)
+		ui.Verbosef("%s selector %s\n", m.Sig, hexutil.Encode(m.ID))
+	}
+	report.Data = hexutil.Encode(data)
+	ui.Resultln(report.Data)
+	return nil
+}
+
+// runABIDecode implements `abi decode <types> <0xhex>`: decode return data
+// or an event's data, given its types as a list such as "uint256,bool" or
+// "(uint256,(address,bool)[])"; the outer parentheses are the list, not a
+// tuple. A function signature instead decodes calldata, selector first.
+func runABIDecode(ctx context.Context, args []string) error {
+	fs, err := abiFlags("decode", args, 2, nil)
+	if err != nil {
+		return err
+	}
+	data, err := hexutil.Decode(fs.Arg(1))
+	if err != nil {
+		return fmt.Errorf("invalid data %q: %w", fs.Arg(1), err)
+	}
+	sig := strings.TrimSpace(fs.Arg(0))
+	report := &ABIReport{}
+	ui.report.ABI = report
+	calldata := !strings.HasPrefix(sig, "(") && strings.Contains(sig, "(")
+	if !calldata {
+		if !strings.HasPrefix(sig, "(") {
+			sig = "(" + sig + ")"
+		}
+		sig = "f" + sig
+	}
+	m, err := methodFromSignature(sig)
+	if err != nil {
+		return err
+	}
+	if calldata {
+		if !bytes.HasPrefix(data, m.ID) {
+			return fmt.Errorf("data does not start with the selector of %s, %s", m.Sig, hexutil.Encode(m.ID))
+		}
+		report.Signature, report.Selector = m.Sig, hexutil.Encode(m.ID)
+		ui.Resultf("Function: %s\n", m.Sig)
+		data = data[4:]
+	}
+	vals, err := m.Inputs.Unpack(data)
+	if err != nil {
+		return fmt.Errorf("decode as (%s): %w", signatureOf(m.Inputs), err)
+	}
+	report.Values = printValues(m.Inputs, vals)
+	return nil
+}
+
+// runABISelector implements `abi selector <signature>`.
+func runABISelector(ctx context.Context, args []string) error {
+	fs, err := abiFlags("selector", args, 1, nil)
+	if err != nil {
+		return err
+	}
+	m, err := methodFromSignature(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	ui.report.ABI = &ABIReport{Signature: m.Sig, Selector: hexutil.Encode(m.ID)}
+	ui.Resultln(hexutil.Encode(m.ID))
+	ui.Verbosef("%s\n", m.Sig)
+	return nil
+}
+
+// runABIEventTopic implements `abi event-topic <signature>`: topic 0 of
+// the event's logs. indexed and parameter names may be left in.
+func runABIEventTopic(ctx context.Context, args []string) error {
+	fs, err := abiFlags("event-topic", args, 1, nil)
+	if err != nil {
+		return err
+	}
+	m, err := methodFromSignature(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	topic := crypto.Keccak256Hash([]byte(m.Sig))
+	ui.report.ABI = &ABIReport{Signature: m.Sig, Topic: &topic}
+	ui.Resultln(topic.Hex())
+	ui.Verbosef("%s\n", m.Sig)
+	return nil
+}
+
+// encodePacked encodes vals, converted for inputs, as Solidity's
+// abi.encodePacked: each value at its own width without padding, strings
+// and bytes in place without a length, and array elements padded to 32
+// bytes. Structs and nested arrays have no packed encoding.
+func encodePacked(inputs abi.Arguments, vals []interface{}) ([]byte, error) {
+	var out []byte
+	for i, in := range inputs {
+		b, err := packedValue(in.Type, reflect.ValueOf(vals[i]), false)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d (%s): %w", i, in.Type.String(), err)
+		}
+		out = append(out, b...)
+	}
+	return out, nil
+}
+
+// packedValue encodes v of type t for encodePacked, padded to 32 bytes
+// when it is an array element.
+func packedValue(t abi.Type, v reflect.Value, inArray bool) ([]byte, error) {
+	switch t.T {
+	case abi.StringTy, abi.BytesTy:
+		if inArray {
+			return nil, errors.New("dynamic types in arrays have no packed encoding")
+		}
+		if t.T == abi.StringTy {
+			return []byte(v.String()), nil
+		}
+		return v.Bytes(), nil
+	case abi.SliceTy, abi.ArrayTy:
+		if inArray {
+			return nil, errors.New("nested arrays have no packed encoding")
+		}
+		var out []byte
+		for i := 0; i < v.Len(); i++ {
+			b, err := packedValue(*t.Elem, v.Index(i), true)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, b...)
+		}
+		return out, nil
+	case abi.TupleTy:
+		return nil, errors.New("structs have no packed encoding")
+	case abi.AddressTy:
+		a := v.Interface().(common.Address)
+		if inArray {
+			return common.LeftPadBytes(a[:], 32), nil
+		}
+		return a[:], nil
+	case abi.BoolTy:
+		b := []byte{0}
+		if v.Bool() {
+			b[0] = 1
+		}
+		if inArray {
+			return common.LeftPadBytes(b, 32), nil
+		}
+		return b, nil
+	case abi.FixedBytesTy:
+		b := make([]byte, t.Size)
+		reflect.Copy(reflect.ValueOf(b), v)
+		if inArray {
+			return common.RightPadBytes(b, 32), nil
+		}
+		return b, nil
+	case abi.IntTy, abi.UintTy:
+		var n *big.Int
+		switch x := v.Interface().(type) {
+		case *big.Int:
+			n = new(big.Int).Set(x)
+		default:
+			if t.T == abi.IntTy {
+				n = big.NewInt(v.Int())
+			} else {
+				n = new(big.Int).SetUint64(v.Uint())
+			}
+		}
+		word := math.U256Bytes(n)
+		if inArray {
+			return word, nil
+		}
+		return word[32-t.Size/8:], nil
+	}
+	return nil, fmt.Errorf("type %s has no packed encoding", t.String())
+}
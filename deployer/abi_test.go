@@ -0,0 +1,184 @@
+package deployer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// knownSelectors are published selectors and topics (ERC-20, ERC-721,
+// ERC-1155, Multicall3, Uniswap V3 and the Solidity ABI specification's
+// examples), each written both as a plain signature and as a
+// human-readable fragment.
+var knownSelectors = []struct {
+	canonical string
+	fragment  string
+	selector  string // 4 bytes for functions and errors, 32 for events
+}{
+	{"transfer(address,uint256)", "function transfer(address to, uint256 amount) external returns (bool)", "0xa9059cbb"},
+	{"balanceOf(address)", "function balanceOf(address owner) view returns (uint256)", "0x70a08231"},
+	{"approve(address,uint256)", "function approve(address spender, uint amount) returns (bool)", "0x095ea7b3"},
+	{"safeTransferFrom(address,address,uint256,bytes)", "function safeTransferFrom(address from, address to, uint256 tokenId, bytes data)", "0xb88d4fde"},
+	{"baz(uint32,bool)", "function baz(uint32 x, bool y) public pure returns (bool r)", "0xcdcd77c0"},
+	{"bar(bytes3[2])", "function bar(bytes3[2] memory) public pure", "0xfce353f6"},
+	{"sam(bytes,bool,uint256[])", "function sam(bytes memory, bool, uint[] memory) public pure", "0xa5643bf2"},
+	{"f(uint256,uint32[],bytes10,bytes)", "function f(uint, uint32[], bytes10, bytes)", "0x8be65246"},
+	{"g(uint256[][],string[])", "function g(uint[][] calldata, string[] calldata)", "0x2289b18c"},
+	{"aggregate3((address,bool,bytes)[])", "function aggregate3(tuple(address target, bool allowFailure, bytes callData)[] calls) payable returns (tuple(bool success, bytes returnData)[] returnData)", "0x82ad56cb"},
+	{"exactInputSingle((address,address,uint24,address,uint256,uint256,uint256,uint160))", "function exactInputSingle((address tokenIn, address tokenOut, uint24 fee, address recipient, uint256 deadline, uint256 amountIn, uint256 amountOutMinimum, uint160 sqrtPriceLimitX96) params) external payable returns (uint256 amountOut)", "0x414bf389"},
+	{"Error(string)", "error Error(string message)", "0x08c379a0"},
+	{"Panic(uint256)", "error Panic(uint256 code)", "0x4e487b71"},
+	{"InsufficientBalance(uint256,uint256)", "error InsufficientBalance(uint256 available, uint256 required)", "0xcf479181"},
+	{"Transfer(address,address,uint256)", "event Transfer(address indexed from, address indexed to, uint256 value)", "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"},
+	{"Approval(address,address,uint256)", "event Approval(address indexed owner, address indexed spender, uint256 value)", "0x8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b925"},
+	{"ApprovalForAll(address,address,bool)", "event ApprovalForAll(address indexed owner, address indexed operator, bool approved)", "0x17307eab39ab6107e8899845ad3d59bd9653f200f220920489ca2b5937696c31"},
+	{"TransferSingle(address,address,address,uint256,uint256)", "event TransferSingle(address indexed operator, address indexed from, address indexed to, uint256 id, uint256 value)", "0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62"},
+}
+
+// hashOf is the selector, or the topic when want is 32 bytes long, of sig.
+func hashOf(sig, want string) string {
+	h := crypto.Keccak256([]byte(sig))
+	if len(want) == 2+2*32 {
+		return hexutil.Encode(h)
+	}
+	return hexutil.Encode(h[:4])
+}
+
+func TestMethodFromSignature(t *testing.T) {
+	for _, tt := range knownSelectors {
+		// The plain form, with names and uint aliases it should ignore.
+		spaced := strings.NewReplacer(",", ", ", "uint256", "uint").Replace(tt.canonical)
+		for _, sig := range []string{tt.canonical, spaced, tt.fragment} {
+			m, err := methodFromSignature(sig)
+			if err != nil {
+				t.Errorf("methodFromSignature(%q): %v", sig, err)
+				continue
+			}
+			if m.Sig != tt.canonical {
+				t.Errorf("methodFromSignature(%q).Sig = %s, want %s", sig, m.Sig, tt.canonical)
+			}
+			if got := hashOf(m.Sig, tt.selector); got != tt.selector {
+				t.Errorf("hash of %q = %s, want %s", sig, got, tt.selector)
+			}
+		}
+	}
+}
+
+func TestMethodFromSignatureErrors(t *testing.T) {
+	for _, sig := range []string{
+		"",
+		"transfer",
+		"(address,uint256)",
+		"transfer(address,uint256",
+		"transfer(address,uint256) garbage",
+		"transfer(address,uint256))",
+		"2fast(uint256)",
+		"my func(uint256)",
+		"function (uint256)",
+		"function transfer(address,uint256) returns",
+		"constructor(uint256)",
+		"fallback()",
+		"transfer(addr,uint256)",
+	} {
+		if m, err := methodFromSignature(sig); err == nil {
+			t.Errorf("methodFromSignature(%q) = %s, want an error", sig, m.Sig)
+		}
+	}
+}
+
+func TestABISelectorAndTopic(t *testing.T) {
+	for _, tt := range knownSelectors {
+		run := runABISelector
+		if len(tt.selector) > 10 {
+			run = runABIEventTopic
+		}
+		for _, sig := range []string{tt.canonical, tt.fragment} {
+			out, err := results(t, run, sig)
+			if err != nil {
+				t.Errorf("%q: %v", sig, err)
+			} else if out != tt.selector+"\n" {
+				t.Errorf("%q printed %q, want %s", sig, out, tt.selector)
+			}
+		}
+	}
+}
+
+// word is v as a 32-byte hex word with no 0x.
+func word(v string) string {
+	return strings.Repeat("0", 64-len(v)) + v
+}
+
+// rightWord is hex string v padded on the right to 32 bytes.
+func rightWord(v string) string {
+	return v + strings.Repeat("0", 64-len(v))
+}
+
+// The Solidity ABI specification's examples: baz(69, true),
+// sam("dave", true, [1, 2, 3]) and
+// f(0x123, [0x456, 0x789], "1234567890", "Hello, world!").
+var (
+	bazCalldata = "0xcdcd77c0" + word("45") + word("1")
+	samCalldata = "0xa5643bf2" + word("60") + word("1") + word("a0") + word("4") + rightWord("64617665") +
+		word("3") + word("1") + word("2") + word("3")
+	fCalldata = "0x8be65246" + word("123") + word("80") + rightWord("31323334353637383930") + word("e0") +
+		word("2") + word("456") + word("789") + word("d") + rightWord("48656c6c6f2c20776f726c6421")
+)
+
+// TestABIEncode checks `abi encode` against the examples of the Solidity
+// ABI specification and hand-computed tuple encodings.
+func TestABIEncode(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"static", []string{"baz(uint32,bool)", "69", "true"},
+			bazCalldata},
+		{"fixed array", []string{"--args", `[["0x616263","0x646566"]]`, "bar(bytes3[2])"},
+			"0xfce353f6" + rightWord("616263") + rightWord("646566")},
+		{"dynamic", []string{"sam(bytes,bool,uint256[])", "0x64617665", "true", "[1,2,3]"},
+			samCalldata},
+		{"mixed", []string{"f(uint256,uint32[],bytes10,bytes)", "0x123", "[1110,1929]", "0x31323334353637383930", "0x48656c6c6f2c20776f726c6421"},
+			fCalldata},
+		{"fragment", []string{"function baz(uint32 x, bool y) public pure returns (bool r)", "69", "true"},
+			bazCalldata},
+		{"tuple array", []string{"--args", `[[[1,true],[2,false]]]`, "((uint256,bool)[])"},
+			"0x" + word("20") + word("2") + word("1") + word("1") + word("2") + word("0")},
+		{"dynamic tuple", []string{"--args", `[[7,"0xbeef"]]`, "((uint256,bytes))"},
+			"0x" + word("20") + word("7") + word("40") + word("2") + rightWord("beef")},
+		{"packed", []string{"--packed", "--args", `[-1,"0x42",3,"Hello, world!"]`, "(int16,bytes1,uint16,string)"},
+			"0xffff42000348656c6c6f2c20776f726c6421"},
+		{"packed array", []string{"--packed", "--args", `[[1,2],"0x00000000000000000000000000000000000000aa"]`, "(uint8[],address)"},
+			"0x" + word("1") + word("2") + "00000000000000000000000000000000000000aa"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := results(t, runABIEncode, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != tt.want+"\n" {
+				t.Fatalf("abi encode %q =\n%s\nwant\n%s", tt.args, out, tt.want)
+			}
+		})
+	}
+}
+
+func TestABIDecode(t *testing.T) {
+	for _, tt := range []struct {
+		types, data, want string
+	}{
+		{"uint32,bool", "0x" + word("45") + word("1"), "arg0 (uint32): 69\narg1 (bool): true\n"},
+		{"baz(uint32,bool)", bazCalldata, "Function: baz(uint32,bool)\narg0 (uint32): 69\narg1 (bool): true\n"},
+		{"(bytes,bool,uint256[])", "0x" + word("60") + word("1") + word("a0") + word("4") + rightWord("64617665") + word("3") + word("1") + word("2") + word("3"),
+			"arg0 (bytes): 0x64617665\narg1 (bool): true\narg2 (uint256[]): [1 2 3]\n"},
+	} {
+		out, err := results(t, runABIDecode, tt.types, tt.data)
+		if err != nil {
+			t.Errorf("abi decode %s: %v", tt.types, err)
+		} else if out != tt.want {
+			t.Errorf("abi decode %s =\n%s\nwant\n%s", tt.types, out, tt.want)
+		}
+	}
+}
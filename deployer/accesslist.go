@@ -0,0 +1,168 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// accessListPolicy decides which EIP-2930 access list, if any, goes on
+// each transaction.
+type accessListPolicy struct {
+	auto bool
+	file string
+
+	list        types.AccessList // loaded from file
+	unsupported bool             // the node has no eth_createAccessList
+}
+
+func (p *accessListPolicy) register(fs *flag.FlagSet) {
+	fs.BoolVar(&p.auto, "access-list", false, "generate an EIP-2930 access list with eth_createAccessList and attach it when it lowers the gas estimate")
+	fs.StringVar(&p.file, "access-list-file", "", "attach this access list, a JSON array of {address, storageKeys}, to every transaction")
+}
+
+// load reads --access-list-file.
+func (p *accessListPolicy) load() error {
+	if p.file == "" {
+		return nil
+	}
+	if p.auto {
+		return errors.New("use one of --access-list and --access-list-file")
+	}
+	raw, err := os.ReadFile(p.file)
+	if err != nil {
+		return fmt.Errorf("--access-list-file: %w", err)
+	}
+	if err := json.Unmarshal(raw, &p.list); err != nil {
+		return fmt.Errorf("--access-list-file %s: %w", p.file, err)
+	}
+	if len(p.list) == 0 {
+		return fmt.Errorf("--access-list-file %s: the list is empty", p.file)
+	}
+	return nil
+}
+
+// createAccessList asks the node which addresses and slots msg touches.
+func (c *rpcClient) createAccessList(ctx context.Context, msg ethereum.CallMsg) (types.AccessList, error) {
+	type result struct {
+		AccessList types.AccessList `json:"accessList"`
+		GasUsed    hexutil.Uint64   `json:"gasUsed"`
+		Error      string           `json:"error"`
+	}
+	res, err := read(ctx, c, "eth_createAccessList", func(ctx context.Context, cl *ethclient.Client) (result, error) {
+		var res result
+		err := cl.Client().CallContext(ctx, &res, "eth_createAccessList", toCallArg(msg), "latest")
+		return res, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != "" {
+		return nil, errors.New(res.Error)
+	}
+	return res.AccessList, nil
+}
+
+// accessList picks the list for msg, whose estimate without one is plain:
+// the --access-list-file one, or with --access-list the node's generated
+// list if it lowers the estimate. It returns nil for none, and otherwise
+// the list and msg's estimate with it. Failing to build a list is only
+// warned about; the transaction then goes without.
+func (s *session) accessList(ctx context.Context, msg ethereum.CallMsg, plain uint64) (types.AccessList, uint64) {
+	p := &s.accessLists
+	list := p.list
+	if list == nil {
+		if !p.auto || p.unsupported {
+			return nil, 0
+		}
+		var err error
+		if list, err = s.client.createAccessList(ctx, msg); err != nil {
+			var rpcErr rpc.Error
+			if (errors.As(err, &rpcErr) && rpcErr.ErrorCode() == methodNotFound) || strings.Contains(strings.ToLower(err.Error()), "does not exist") {
+				p.unsupported = true
+				s.ui.Warnf("warning: the node does not support eth_createAccessList; sending without access lists\n")
+			} else {
+				s.ui.Warnf("warning: create access list: %v; sending without one\n", err)
+			}
+			return nil, 0
+		}
+	}
+	msg.AccessList = list
+	gas, err := s.client.EstimateGas(ctx, msg)
+	if err != nil {
+		s.ui.Warnf("warning: estimate gas with the access list: %v; sending without one\n", err)
+		return nil, 0
+	}
+	printAccessList(list)
+	s.ui.Printf("  estimate %d with the list, %d without (%+d)\n", gas, plain, int64(gas)-int64(plain))
+	if p.list == nil && gas >= plain {
+		s.ui.Printf("  not attached: it does not lower the cost\n")
+		return nil, 0
+	}
+	return list, gas
+}
+
+// printAccessList prints list, one account per line.
+func printAccessList(list types.AccessList) {
+	ui.Printf("Access list: %s\n", describeAccessList(list))
+	for _, t := range list {
+		slots := make([]string, len(t.StorageKeys))
+		for i, k := range t.StorageKeys {
+			slots[i] = k.Hex()
+		}
+		if len(slots) == 0 {
+			ui.Printf("  %s\n", t.Address.Hex())
+		} else {
+			ui.Printf("  %s: %s\n", t.Address.Hex(), strings.Join(slots, ", "))
+		}
+	}
+}
+
+// describeAccessList summarizes list for the transaction summary.
+func describeAccessList(list types.AccessList) string {
+	keys := 0
+	for _, t := range list {
+		keys += len(t.StorageKeys)
+	}
+	return fmt.Sprintf("%d addresses, %d storage keys", len(list), keys)
+}
+
+// legacyAccessList moves opts.AccessList into its signer when opts are
+// gas-price priced: bind only builds access lists into EIP-1559
+// transactions, so the legacy one it builds is signed as a type 1
+// (EIP-2930) transaction instead.
+func legacyAccessList(opts *bind.TransactOpts, chainID *big.Int) {
+	if opts.GasPrice == nil || opts.AccessList == nil {
+		return
+	}
+	list, sign := opts.AccessList, opts.Signer
+	opts.AccessList = nil
+	opts.Signer = func(from common.Address, tx *types.Transaction) (*types.Transaction, error) {
+		if tx.Type() == types.LegacyTxType {
+			tx = types.NewTx(&types.AccessListTx{
+				ChainID:    chainID,
+				Nonce:      tx.Nonce(),
+				GasPrice:   tx.GasPrice(),
+				Gas:        tx.Gas(),
+				To:         tx.To(),
+				Value:      tx.Value(),
+				Data:       tx.Data(),
+				AccessList: list,
+			})
+		}
+		return sign(from, tx)
+	}
+}
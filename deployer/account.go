@@ -0,0 +1,309 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/console/prompt"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// accountCommands are the `account` subcommands with their usage lines.
+var accountCommands = map[string]struct {
+	usage string
+	run   func(ctx context.Context, args []string) error
+}{
+	"new":     {"new [--keystore-out <dir>] [--insecure-print-key]", runAccountNew},
+	"address": {"address [flags]", runAccountAddress},
+	"balance": {"balance [flags] [address]", runAccountBalance},
+	"nonce":   {"nonce [flags] [address]", runAccountNonce},
+}
+
+func accountUsage() error {
+	var usages []string
+	for _, cmd := range accountCommands {
+		usages = append(usages, "account "+cmd.usage)
+	}
+	sort.Strings(usages)
+	return errors.New("usage:\n  " + strings.Join(usages, "\n  "))
+}
+
+// runAccount implements `account <subcommand> [flags] [args...]`: key and
+// address utilities.
+func runAccount(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return accountUsage()
+	}
+	cmd, ok := accountCommands[args[0]]
+	if !ok {
+		return accountUsage()
+	}
+	return cmd.run(ctx, args[1:])
+}
+
+// runAccountNew generates a key. It is kept only where asked: sealed in
+// a keystore under --keystore-out, or printed with --insecure-print-key.
+func runAccountNew(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("account new", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	outDir := fs.String("keystore-out", "", "write the key to a new keystore file in `dir`, sealed with KEYSTORE_PASSWORD or a prompted passphrase")
+	printKey := fs.Bool("insecure-print-key", false, "print the private key (it ends up in terminal scrollback and logs)")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: account new [--keystore-out <dir>] [--insecure-print-key]")
+	}
+	if *outDir == "" && !*printKey {
+		return errors.New("account new: pass --keystore-out <dir> or --insecure-print-key, or the key is lost")
+	}
+
+	var pass string
+	if *outDir != "" {
+		var err error
+		if pass, err = newKeystorePassphrase(); err != nil {
+			return err
+		}
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return fmt.Errorf("generate key: %w", err)
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	r := &AccountReport{Address: address}
+	ui.report.Account = r
+	ui.Resultln("Address:", address.Hex())
+
+	if *outDir != "" {
+		ks := keystore.NewKeyStore(*outDir, keystore.StandardScryptN, keystore.StandardScryptP)
+		acct, err := ks.ImportECDSA(key, pass)
+		if err != nil {
+			return fmt.Errorf("write keystore: %w", err)
+		}
+		r.Keystore = acct.URL.Path
+		ui.Resultln("Keystore:", acct.URL.Path)
+		ui.Verbosef("use it with KEYSTORE_PATH=%s\n", acct.URL.Path)
+	}
+	if *printKey {
+		raw := crypto.FromECDSA(key)
+		defer zero(raw)
+		ui.Warnf("warning: printing the private key; anyone who sees it controls %s\n", address.Hex())
+		ui.Resultln("Private key:", hexutil.Encode(raw))
+		r.PrivateKey = hexutil.Encode(raw)
+	}
+	return nil
+}
+
+// newKeystorePassphrase is KEYSTORE_PASSWORD, or a passphrase prompted
+// for twice at the terminal.
+func newKeystorePassphrase() (string, error) {
+	if pass, ok := os.LookupEnv("KEYSTORE_PASSWORD"); ok {
+		return pass, nil
+	}
+	if !isTerminal(os.Stdin) {
+		return "", errors.New("KEYSTORE_PASSWORD is not set and stdin is not a terminal")
+	}
+	pass, err := prompt.Stdin.PromptPassword("New keystore passphrase: ")
+	if err != nil {
+		return "", fmt.Errorf("read passphrase: %w", err)
+	}
+	again, err := prompt.Stdin.PromptPassword("Repeat passphrase: ")
+	if err != nil {
+		return "", fmt.Errorf("read passphrase: %w", err)
+	}
+	if pass != again {
+		return "", errors.New("passphrases do not match")
+	}
+	return pass, nil
+}
+
+// runAccountAddress prints the address of the configured key without
+// connecting to a node.
+func runAccountAddress(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("account address", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: account address [flags]")
+	}
+	signer, err := LoadSigner(o.keys)
+	if err != nil {
+		return err
+	}
+	ui.report.Account = &AccountReport{Address: signer.Address, Source: signer.Source}
+	ui.Resultln(signer.Address.Hex())
+	ui.Verbosef("from %s\n", signer.Source)
+	return nil
+}
+
+// accountTarget connects and resolves the account a balance or nonce is
+// read for: the positional address, else the configured signer's.
+func accountTarget(ctx context.Context, name string, fs *flag.FlagSet, o *options) (*rpcClient, common.Address, error) {
+	var address common.Address
+	switch fs.NArg() {
+	case 0:
+		signer, err := LoadSigner(o.keys)
+		if err != nil {
+			return nil, address, fmt.Errorf("%w (or pass an address)", err)
+		}
+		address = signer.Address
+	case 1:
+		var err error
+		if address, err = parseAddress(fs.Arg(0)); err != nil {
+			return nil, address, err
+		}
+	default:
+		return nil, address, fmt.Errorf("usage: account %s [flags] [address]", name)
+	}
+	client, _, err := connect(ctx, o)
+	if err != nil {
+		return nil, address, err
+	}
+	return client, address, nil
+}
+
+// runAccountBalance implements `account balance [address]`.
+func runAccountBalance(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("account balance", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	blockFlag := fs.String("block", "", "also print the balance at this block number")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	block, err := parseBlock(*blockFlag)
+	if err != nil {
+		return err
+	}
+	client, address, err := accountTarget(ctx, "balance", fs, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("block number: %w", err)
+	}
+	balance, err := client.BalanceAt(ctx, address, nil)
+	if err != nil {
+		return fmt.Errorf("balance of %s: %w", address.Hex(), err)
+	}
+	r := &AccountReport{Address: address, Balance: balance.String(), Block: head}
+	ui.report.Account = r
+	ui.Resultf("%s: %s ETH at latest (block %d)\n", names.label(address), formatEther(balance), head)
+	if block != nil {
+		past, err := client.BalanceAt(ctx, address, block)
+		if err != nil {
+			return fmt.Errorf("balance of %s at block %s: %w", address.Hex(), block, err)
+		}
+		r.BalanceAt = past.String()
+		r.At = block.Uint64()
+		ui.Resultf("%s: %s ETH at block %s\n", address.Hex(), formatEther(past), block)
+	}
+	return nil
+}
+
+// runAccountNonce implements `account nonce [address]`. A pending nonce
+// ahead of the latest one means transactions are waiting in the mempool,
+// which is how stuck transactions show up.
+func runAccountNonce(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("account nonce", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	client, address, err := accountTarget(ctx, "nonce", fs, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	latest, err := client.NonceAt(ctx, address, nil)
+	if err != nil {
+		return fmt.Errorf("nonce of %s: %w", address.Hex(), err)
+	}
+	pending, err := client.PendingNonceAt(ctx, address)
+	if err != nil {
+		return fmt.Errorf("pending nonce of %s: %w", address.Hex(), err)
+	}
+	ui.report.Account = &AccountReport{Address: address, Nonce: &latest, PendingNonce: &pending}
+	ui.Resultf("%s: nonce %d latest, %d pending\n", names.label(address), latest, pending)
+	if pending > latest {
+		ui.Warnf("warning: %d transaction(s) from %s are pending (nonces %d to %d); if they are stuck, replace them with `cancel --nonce %d` or bump them\n",
+			pending-latest, address.Hex(), latest, pending-1, latest)
+	}
+	return nil
+}
+
+// runBalances implements `balances [--block N] <address...>`: the native
+// balances of many addresses. The reads go out together, so they share
+// JSON-RPC batches instead of taking a round trip each.
+func runBalances(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("balances", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	blockFlag := fs.String("block", "", "balances at this block number instead of the latest")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: balances [flags] <address...>")
+	}
+	block, err := parseBlock(*blockFlag)
+	if err != nil {
+		return err
+	}
+	client, _, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	addresses := make([]common.Address, fs.NArg())
+	for i, arg := range fs.Args() {
+		if addresses[i], err = parseAddress(arg); err != nil {
+			return err
+		}
+	}
+	balances := make([]*big.Int, len(addresses))
+	errs := make([]error, len(addresses))
+	var wg sync.WaitGroup
+	for i, address := range addresses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			balances[i], errs[i] = client.BalanceAt(ctx, address, block)
+		}()
+	}
+	wg.Wait()
+
+	var total big.Int
+	for i, address := range addresses {
+		if errs[i] != nil {
+			return fmt.Errorf("balance of %s: %w", address.Hex(), errs[i])
+		}
+		ui.report.Balances = append(ui.report.Balances, BalanceReport{Address: address, Balance: balances[i].String()})
+		ui.Resultf("%s  %s ETH\n", names.label(address), formatEther(balances[i]))
+		total.Add(&total, balances[i])
+	}
+	if len(addresses) > 1 {
+		ui.Resultf("total  %s ETH\n", formatEther(&total))
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// methodNotFound is the JSON-RPC error code for an unknown method.
+const methodNotFound = -32601
+
+// unsupportedMethod is the error anvilCall returns for a method the node
+// does not implement.
+type unsupportedMethod string
+
+func (m unsupportedMethod) Error() string {
+	return fmt.Sprintf("the node does not support %s; anvil commands need Anvil (or a Hardhat-compatible dev node)", string(m))
+}
+
+// anvilCall calls a non-standard RPC method on the pinned endpoint. A
+// node that does not implement it gets a clear error instead of the raw
+// JSON-RPC one.
+func anvilCall(ctx context.Context, c *rpcClient, result interface{}, method string, args ...interface{}) error {
+	e, err := c.pin(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = call(ctx, c, e, method, func(ctx context.Context, cl *ethclient.Client) (struct{}, error) {
+		return struct{}{}, cl.Client().CallContext(ctx, result, method, args...)
+	})
+	if err == nil {
+		return nil
+	}
+	var rpcErr rpc.Error
+	msg := strings.ToLower(err.Error())
+	if (errors.As(err, &rpcErr) && rpcErr.ErrorCode() == methodNotFound) || strings.Contains(msg, "method not found") || strings.Contains(msg, "does not exist") {
+		return unsupportedMethod(method)
+	}
+	return fmt.Errorf("%s: %w", method, err)
+}
+
+// anvilCommands are the `anvil` subcommands. Each gets the connected
+// client and its positional arguments.
+var anvilCommands = map[string]struct {
+	usage string
+	nargs int
+	run   func(ctx context.Context, c *rpcClient, args []string) error
+}{
+	"snapshot": {"snapshot", 0, func(ctx context.Context, c *rpcClient, args []string) error {
+		var id string
+		if err := anvilCall(ctx, c, &id, "evm_snapshot"); err != nil {
+			return err
+		}
+		ui.Resultln("Snapshot:", id)
+		ui.report.Snapshot = id
+		return nil
+	}},
+	"revert": {"revert <id>", 1, func(ctx context.Context, c *rpcClient, args []string) error {
+		var ok bool
+		if err := anvilCall(ctx, c, &ok, "evm_revert", args[0]); err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("no snapshot %s (snapshots are used up by reverting to them)", args[0])
+		}
+		ui.Println("Reverted to snapshot", args[0])
+		return nil
+	}},
+	"set-balance": {"set-balance <address> <amount>", 2, func(ctx context.Context, c *rpcClient, args []string) error {
+		addr, err := parseAddress(args[0])
+		if err != nil {
+			return err
+		}
+		wei, err := parseValue(args[1])
+		if err != nil || wei == nil {
+			return fmt.Errorf("invalid amount %q", args[1])
+		}
+		if err := anvilCall(ctx, c, nil, "anvil_setBalance", addr, (*hexutil.Big)(wei)); err != nil {
+			return err
+		}
+		ui.Printf("Balance of %s set to %s ETH\n", addr.Hex(), formatEther(wei))
+		return nil
+	}},
+	"impersonate": {"impersonate <address>", 1, func(ctx context.Context, c *rpcClient, args []string) error {
+		addr, err := parseAddress(args[0])
+		if err != nil {
+			return err
+		}
+		if err := anvilCall(ctx, c, nil, "anvil_impersonateAccount", addr); err != nil {
+			return err
+		}
+		ui.Printf("Impersonating %s; use `anvil send --from %s ...` to send as it\n", addr.Hex(), addr.Hex())
+		return nil
+	}},
+	"stop-impersonating": {"stop-impersonating <address>", 1, func(ctx context.Context, c *rpcClient, args []string) error {
+		addr, err := parseAddress(args[0])
+		if err != nil {
+			return err
+		}
+		if err := anvilCall(ctx, c, nil, "anvil_stopImpersonatingAccount", addr); err != nil {
+			return err
+		}
+		ui.Printf("Stopped impersonating %s\n", addr.Hex())
+		return nil
+	}},
+	"mine": {"mine [n]", -1, func(ctx context.Context, c *rpcClient, args []string) error {
+		n := uint64(1)
+		if len(args) > 0 {
+			var err error
+			if n, err = strconv.ParseUint(args[0], 10, 64); err != nil || n == 0 {
+				return fmt.Errorf("invalid block count %q", args[0])
+			}
+		}
+		if err := anvilCall(ctx, c, nil, "anvil_mine", hexutil.Uint64(n)); err != nil {
+			return err
+		}
+		head, err := c.BlockNumber(ctx)
+		if err != nil {
+			return fmt.Errorf("block number: %w", err)
+		}
+		ui.Printf("Mined %d blocks; head is now %d\n", n, head)
+		return nil
+	}},
+	"increase-time": {"increase-time <seconds>", 1, func(ctx context.Context, c *rpcClient, args []string) error {
+		secs, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid seconds %q", args[0])
+		}
+		var offset hexutil.Uint64
+		if err := anvilCall(ctx, c, &offset, "evm_increaseTime", hexutil.Uint64(secs)); err != nil {
+			return err
+		}
+		ui.Printf("Time moved forward %ds; it applies from the next block (`anvil mine`)\n", secs)
+		return nil
+	}},
+}
+
+func anvilUsage() error {
+	var usages []string
+	for _, cmd := range anvilCommands {
+		usages = append(usages, "anvil "+cmd.usage)
+	}
+	usages = append(usages, "anvil send --from <address> [flags] <address> <function> [args...]")
+	sort.Strings(usages)
+	return errors.New("usage:\n  " + strings.Join(usages, "\n  "))
+}
+
+// runAnvil implements `anvil <subcommand> [flags] [args...]`: Anvil's
+// cheatcodes for local testing.
+func runAnvil(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return anvilUsage()
+	}
+	if args[0] == "send" {
+		return runAnvilSend(ctx, args[1:])
+	}
+	cmd, ok := anvilCommands[args[0]]
+	if !ok {
+		return anvilUsage()
+	}
+	fs := flag.NewFlagSet("anvil "+args[0], flag.ExitOnError)
+	var o options
+	o.register(fs)
+	if err := parseFlags(fs, args[1:], &o); err != nil {
+		return err
+	}
+	if (cmd.nargs >= 0 && fs.NArg() != cmd.nargs) || (cmd.nargs < 0 && fs.NArg() > 1) {
+		return fmt.Errorf("usage: anvil %s", cmd.usage)
+	}
+	client, _, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return cmd.run(ctx, client, fs.Args())
+}
+
+// runAnvilSend implements `anvil send --from <address> ...`: send a
+// transaction as an impersonated account through eth_sendTransaction, so
+// the node signs it and no key is needed.
+func runAnvilSend(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("anvil send", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	var txo txOptions
+	o.register(fs)
+	ao.register(fs, "")
+	txo.register(fs)
+	fromFlag := fs.String("from", "", "impersonated sender (see `anvil impersonate`)")
+	argsJSON := fs.String("args", "", "function arguments as a JSON array")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 || *fromFlag == "" {
+		return errors.New("usage: anvil send --from <address> [flags] <address> <function> [args...]")
+	}
+	from, err := parseAddress(*fromFlag)
+	if err != nil {
+		return err
+	}
+	to, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	path, contract, err := ao.resolve()
+	if err != nil {
+		return err
+	}
+	c, err := loadABI(path, contract)
+	if err != nil {
+		return err
+	}
+	m, err := resolveMethod(&c.ABI, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	raw, err := rawArgs(fs.Args()[2:], *argsJSON)
+	if err != nil {
+		return err
+	}
+	sendArgs, err := convertArgs(m.Inputs, raw)
+	if err != nil {
+		return fmt.Errorf("%s: %w", m.Sig, err)
+	}
+	if err := checkPayable(m.Sig, m, txo); err != nil {
+		return err
+	}
+	data, err := c.ABI.Pack(m.Name, sendArgs...)
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", m.Sig, err)
+	}
+	value, err := parseValue(txo.value)
+	if err != nil {
+		return fmt.Errorf("--value: %w", err)
+	}
+
+	s, err := newSession(&o)
+	if err != nil {
+		return err
+	}
+	s.bump = bumpPolicy{}
+	if s.client, s.chainID, err = connect(ctx, &o); err != nil {
+		return err
+	}
+	defer s.Close()
+	s.from = from
+
+	req := map[string]interface{}{"from": from, "to": to, "data": hexutil.Bytes(data)}
+	if value != nil {
+		req["value"] = (*hexutil.Big)(value)
+	}
+	if txo.gasLimit > 0 {
+		req["gas"] = hexutil.Uint64(txo.gasLimit)
+	}
+	var hash common.Hash
+	if err := anvilCall(ctx, s.client, &hash, "eth_sendTransaction", req); err != nil {
+		return fmt.Errorf("%s tx: %w", m.Sig, explainError(err, &c.ABI))
+	}
+	ui.Printf("%s tx: %s (from %s, signed by the node)\n", m.RawName, hash.Hex(), from.Hex())
+	ui.link("tx", hash.Hex())
+	if txo.noWait {
+		return nil
+	}
+	tx, _, err := s.client.TransactionByHash(ctx, hash)
+	if err != nil {
+		return fmt.Errorf("get tx %s: %w", hash.Hex(), err)
+	}
+	rcpt, err := s.waitReceipt(ctx, tx, &c.ABI)
+	if err != nil {
+		return err
+	}
+	ui.report.Transactions = append(ui.report.Transactions, *newTxReport(m.Sig, rcpt, printEvents(ui, rcpt, &c.ABI)))
+	return nil
+}
@@ -0,0 +1,293 @@
+package deployer
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// rawArgs combines positional CLI values with an optional JSON array.
+// Positional values stay strings; JSON values keep their decoded shape.
+func rawArgs(positional []string, jsonArray string) ([]interface{}, error) {
+	if strings.TrimSpace(jsonArray) == "" {
+		out := make([]interface{}, len(positional))
+		for i, v := range positional {
+			out[i] = v
+		}
+		return out, nil
+	}
+	if len(positional) > 0 {
+		return nil, fmt.Errorf("pass arguments either positionally or as a JSON array, not both")
+	}
+	var out []interface{}
+	dec := json.NewDecoder(strings.NewReader(jsonArray))
+	dec.UseNumber()
+	if err := dec.Decode(&out); err != nil {
+		return nil, fmt.Errorf("arguments are not a JSON array: %w", err)
+	}
+	return out, nil
+}
+
+// convertArgs turns raw CLI/JSON values into the Go types go-ethereum's
+// packer expects for inputs. Errors name the offending parameter.
+func convertArgs(inputs abi.Arguments, raw []interface{}) ([]interface{}, error) {
+	if len(raw) != len(inputs) {
+		return nil, fmt.Errorf("expected %d arguments (%s), got %d", len(inputs), signatureOf(inputs), len(raw))
+	}
+	out := make([]interface{}, len(inputs))
+	for i, in := range inputs {
+		name := in.Name
+		if name == "" {
+			name = fmt.Sprintf("arg%d", i)
+		}
+		v, err := convertValue(in.Type, raw[i])
+		if err != nil {
+			return nil, fmt.Errorf("argument %q (%s): %w", name, in.Type.String(), err)
+		}
+		out[i] = v.Interface()
+	}
+	return out, nil
+}
+
+// signatureOf renders the comma-separated Solidity types of args.
+func signatureOf(args abi.Arguments) string {
+	types := make([]string, len(args))
+	for i, a := range args {
+		types[i] = a.Type.String()
+	}
+	return strings.Join(types, ",")
+}
+
+func convertValue(t abi.Type, v interface{}) (reflect.Value, error) {
+	switch t.T {
+	case abi.IntTy, abi.UintTy:
+		n, err := toBigInt(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return intValue(t, n)
+
+	case abi.BoolTy:
+		switch b := v.(type) {
+		case bool:
+			return reflect.ValueOf(b), nil
+		case string:
+			switch strings.ToLower(strings.TrimSpace(b)) {
+			case "true", "1":
+				return reflect.ValueOf(true), nil
+			case "false", "0":
+				return reflect.ValueOf(false), nil
+			}
+		}
+		return reflect.Value{}, fmt.Errorf("invalid bool %v", v)
+
+	case abi.StringTy:
+		s, ok := v.(string)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected a string, got %v", v)
+		}
+		return reflect.ValueOf(s), nil
+
+	case abi.AddressTy:
+		s, ok := v.(string)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("invalid address %v", v)
+		}
+		a, err := parseAddress(s)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(a), nil
+
+	case abi.FixedBytesTy:
+		b, err := toBytes(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if len(b) != t.Size {
+			return reflect.Value{}, fmt.Errorf("expected %d bytes, got %d", t.Size, len(b))
+		}
+		arr := reflect.New(t.GetType()).Elem()
+		reflect.Copy(arr, reflect.ValueOf(b))
+		return arr, nil
+
+	case abi.BytesTy:
+		b, err := toBytes(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(b), nil
+
+	case abi.SliceTy, abi.ArrayTy:
+		elems, err := toList(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		var out reflect.Value
+		if t.T == abi.ArrayTy {
+			if len(elems) != t.Size {
+				return reflect.Value{}, fmt.Errorf("expected %d elements, got %d", t.Size, len(elems))
+			}
+			out = reflect.New(t.GetType()).Elem()
+		} else {
+			out = reflect.MakeSlice(t.GetType(), len(elems), len(elems))
+		}
+		for i, e := range elems {
+			ev, err := convertValue(*t.Elem, e)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("[%d]: %w", i, err)
+			}
+			out.Index(i).Set(ev)
+		}
+		return out, nil
+
+	case abi.TupleTy:
+		return tupleValue(t, v)
+	}
+	return reflect.Value{}, fmt.Errorf("unsupported type %s", t.String())
+}
+
+// tupleValue accepts a struct either as a JSON object keyed by component
+// name or as a positional JSON array.
+func tupleValue(t abi.Type, v interface{}) (reflect.Value, error) {
+	if s, ok := v.(string); ok {
+		var decoded interface{}
+		dec := json.NewDecoder(strings.NewReader(s))
+		dec.UseNumber()
+		if err := dec.Decode(&decoded); err != nil {
+			return reflect.Value{}, fmt.Errorf("tuple must be a JSON object or array: %w", err)
+		}
+		v = decoded
+	}
+	fields := make([]interface{}, len(t.TupleElems))
+	switch x := v.(type) {
+	case []interface{}:
+		if len(x) != len(fields) {
+			return reflect.Value{}, fmt.Errorf("expected %d tuple components, got %d", len(fields), len(x))
+		}
+		copy(fields, x)
+	case map[string]interface{}:
+		for i, name := range t.TupleRawNames {
+			f, ok := x[name]
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("missing tuple component %q", name)
+			}
+			fields[i] = f
+		}
+		if len(x) != len(fields) {
+			return reflect.Value{}, fmt.Errorf("expected components %s", strings.Join(t.TupleRawNames, ", "))
+		}
+	default:
+		return reflect.Value{}, fmt.Errorf("tuple must be a JSON object or array, got %v", v)
+	}
+	out := reflect.New(t.TupleType).Elem()
+	for i, elem := range t.TupleElems {
+		fv, err := convertValue(*elem, fields[i])
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf(".%s: %w", t.TupleRawNames[i], err)
+		}
+		out.Field(i).Set(fv)
+	}
+	return out, nil
+}
+
+// toBigInt parses decimal or 0x-prefixed hex integers.
+func toBigInt(v interface{}) (*big.Int, error) {
+	var s string
+	switch x := v.(type) {
+	case string:
+		s = strings.TrimSpace(x)
+	case json.Number:
+		s = x.String()
+	default:
+		return nil, fmt.Errorf("invalid integer %v", v)
+	}
+	n := new(big.Int)
+	var ok bool
+	switch {
+	case strings.HasPrefix(s, "0x"), strings.HasPrefix(s, "0X"):
+		_, ok = n.SetString(s[2:], 16)
+	case strings.HasPrefix(s, "-0x"), strings.HasPrefix(s, "-0X"):
+		_, ok = n.SetString(s[3:], 16)
+		n.Neg(n)
+	default:
+		_, ok = n.SetString(s, 10)
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid integer %q", s)
+	}
+	return n, nil
+}
+
+// intValue range-checks n against t and returns it in the Go type the
+// packer expects (native ints up to 64 bits, *big.Int above).
+func intValue(t abi.Type, n *big.Int) (reflect.Value, error) {
+	if t.T == abi.UintTy {
+		if n.Sign() < 0 || n.BitLen() > t.Size {
+			return reflect.Value{}, fmt.Errorf("%s out of range for uint%d", n, t.Size)
+		}
+	} else {
+		limit := new(big.Int).Lsh(big.NewInt(1), uint(t.Size-1))
+		if n.Cmp(limit) >= 0 || n.Cmp(new(big.Int).Neg(limit)) < 0 {
+			return reflect.Value{}, fmt.Errorf("%s out of range for int%d", n, t.Size)
+		}
+	}
+	typ := t.GetType()
+	switch typ.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return reflect.ValueOf(n.Uint64()).Convert(typ), nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflect.ValueOf(n.Int64()).Convert(typ), nil
+	}
+	return reflect.ValueOf(n), nil
+}
+
+func toBytes(v interface{}) ([]byte, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected 0x-prefixed hex, got %v", v)
+	}
+	if !strings.HasPrefix(s, "0x") && !strings.HasPrefix(s, "0X") {
+		return nil, fmt.Errorf("expected 0x-prefixed hex, got %q", s)
+	}
+	b, err := hex.DecodeString(s[2:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex %q: %w", s, err)
+	}
+	return b, nil
+}
+
+// toList accepts a decoded JSON array or a string holding one.
+func toList(v interface{}) ([]interface{}, error) {
+	switch x := v.(type) {
+	case []interface{}:
+		return x, nil
+	case string:
+		var out []interface{}
+		dec := json.NewDecoder(strings.NewReader(x))
+		dec.UseNumber()
+		if err := dec.Decode(&out); err != nil {
+			return nil, fmt.Errorf("expected a JSON array: %w", err)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("expected an array, got %v", v)
+}
+
+// constructorArgs converts CLI values for c's constructor.
+func constructorArgs(c *Artifact, positional []string, jsonArray string) ([]interface{}, error) {
+	raw, err := rawArgs(positional, jsonArray)
+	if err != nil {
+		return nil, fmt.Errorf("%s constructor: %w", c.Name, err)
+	}
+	args, err := convertArgs(c.ABI.Constructor.Inputs, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s constructor: %w", c.Name, err)
+	}
+	return args, nil
+}
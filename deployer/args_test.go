@@ -0,0 +1,111 @@
+package deployer
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// The config fixture takes a nested struct in its constructor and
+// stores its three words; any call returns them.
+const (
+	configABI = `[
+  {"type":"constructor","inputs":[{"name":"config","type":"tuple","components":[
+    {"name":"admin","type":"tuple","components":[{"name":"owner","type":"address"},{"name":"limit","type":"uint64"}]},
+    {"name":"amount","type":"uint256"}]}]},
+  {"type":"function","name":"config","stateMutability":"view","inputs":[],"outputs":[
+    {"name":"owner","type":"address"},{"name":"limit","type":"uint64"},{"name":"amount","type":"uint256"}]}
+]`
+	configRuntime  = "60005460005260015460205260025460405260606000f3"
+	configCreation = "60606060380360003960005160005560205160015560405160025560178060266000396000f3" + configRuntime
+)
+
+func configArtifact(t *testing.T) *Artifact {
+	t.Helper()
+	a, err := newArtifact("Config", []byte(configABI), codeObject{Object: configCreation}, codeObject{Object: configRuntime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestConvertValue(t *testing.T) {
+	typ := func(s string) abi.Type {
+		t.Helper()
+		ty, err := abi.NewType(s, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ty
+	}
+	config := configArtifact(t).ABI.Constructor.Inputs[0].Type
+	owner := "0x70997970C51812dc3A010C7d01b50e0d17dc79C8"
+
+	for _, tt := range []struct {
+		name string
+		typ  abi.Type
+		in   interface{}
+		want string // the value as fmt prints it, or the error
+	}{
+		{"nested tuple", config, `{"admin":{"owner":"` + owner + `","limit":5},"amount":"0x10"}`, "{{" + owner + " 5} 16}"},
+		{"nested tuple by position", config, `[["` + owner + `","5"],16]`, "{{" + owner + " 5} 16}"},
+		{"tuple missing a component", config, `{"admin":{"owner":"` + owner + `"},"amount":1}`, `.admin: missing tuple component "limit"`},
+		{"tuple with an extra component", config, `{"admin":["` + owner + `",1],"amount":1,"fee":2}`, "expected components admin, amount"},
+		{"tuple component out of range", config, `[["` + owner + `","0x10000000000000000"],1]`, ".admin: .limit: 18446744073709551616 out of range for uint64"},
+		{"array", typ("uint8[3]"), "[1,2,3]", "[1 2 3]"},
+		{"array too short", typ("uint8[3]"), "[1,2]", "expected 3 elements, got 2"},
+		{"array element out of range", typ("uint8[3]"), []interface{}{"1", "256", "3"}, "[1]: 256 out of range for uint8"},
+		{"uint overflow", typ("uint8"), "256", "256 out of range for uint8"},
+		{"uint max", typ("uint256"), "0x" + strings.Repeat("f", 64), new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1)).String()},
+		{"uint256 overflow", typ("uint256"), "0x1" + strings.Repeat("0", 64), "115792089237316195423570985008687907853269984665640564039457584007913129639936 out of range for uint256"},
+		{"negative uint", typ("uint64"), "-1", "-1 out of range for uint64"},
+		{"int min", typ("int8"), "-128", "-128"},
+		{"int overflow", typ("int8"), "128", "128 out of range for int8"},
+		{"int underflow", typ("int8"), "-0x81", "-129 out of range for int8"},
+		{"address", typ("address"), strings.ToLower(owner), owner},
+		{"short address", typ("address"), "0x1234", `invalid address "0x1234"`},
+		{"address not a string", typ("address"), []interface{}{}, "invalid address []"},
+	} {
+		v, err := convertValue(tt.typ, tt.in)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = fmt.Sprint(v.Interface())
+		}
+		if got != tt.want {
+			t.Errorf("%s: %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestDeployTupleConstructor deploys the config fixture with its struct
+// given as JSON on the command line, and reads it back.
+func TestDeployTupleConstructor(t *testing.T) {
+	chain := newSimChain(t)
+	chain.autoCommit(t)
+	c := chain.dial(t, Config{})
+	ctx := t.Context()
+	art := configArtifact(t)
+
+	owner := common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8")
+	args, err := constructorArgs(art, []string{`{"admin":{"owner":"` + owner.Hex() + `","limit":5},"amount":"1000000000000000000"}`}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := c.Deploy(ctx, art, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := c.Call(ctx, art, d.Address, "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 3 || out[0] != owner || out[1] != uint64(5) || out[2].(*big.Int).Cmp(ether(1)) != 0 {
+		t.Fatalf("config() = %v, want [%s 5 1e18]", out, owner.Hex())
+	}
+}
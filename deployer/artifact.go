@@ -0,0 +1,109 @@
+package deployer
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// linkReferences locates library placeholders in code, keyed by source
+// file and then library name.
+type linkReferences map[string]map[string][]byteRange
+
+// byteRange is a region of code, as used by immutableReferences.
+type byteRange struct {
+	Start  int `json:"start"`
+	Length int `json:"length"`
+}
+
+// Artifact is a compiled contract reduced to what deployment needs,
+// whichever compiler output it came from.
+type Artifact struct {
+	Name     string
+	Path     string
+	ABI      abi.ABI
+	RawABI   json.RawMessage
+	Bytecode []byte
+
+	// Libraries are the external libraries Bytecode must be linked
+	// against; their placeholders are zeroed until linked.
+	Libraries []libraryRef
+
+	// DeployedBytecode is the expected runtime code, nil when the artifact
+	// has none. Immutables and library addresses in it are not known
+	// until deployment.
+	DeployedBytecode []byte
+	Immutables       []byteRange
+	RuntimeLinks     []byteRange
+
+	// Metadata is the compiler's metadata JSON (compiler version,
+	// settings, sources), nil when the artifact does not carry it.
+	Metadata json.RawMessage
+
+	// StorageLayout is the compiler's storageLayout output, nil unless
+	// it was requested (Foundry: extra_output = ["storageLayout"]).
+	StorageLayout *storageLayout
+}
+
+// artifactOptions selects an artifact either by path or by contract name
+// under the Foundry out directory.
+type artifactOptions struct {
+	path     string
+	contract string
+	outDir   string
+}
+
+func (o *artifactOptions) register(fs *flag.FlagSet, defaultContract string) {
+	fs.StringVar(&o.path, "artifact", "", "path to a Foundry or Hardhat artifact, or solc standard-json output")
+	fs.StringVar(&o.contract, "contract", defaultContract, "contract name, resolved as <out-dir>/<Name>.sol/<Name>.json, or picked from --artifact")
+	fs.StringVar(&o.outDir, "out-dir", "out", "Foundry output directory")
+}
+
+// resolve returns the artifact path, preferring an explicit path, and
+// the contract to pick from it (needed for solc standard-json output).
+func (o *artifactOptions) resolve() (string, string, error) {
+	if o.path != "" {
+		return o.path, o.contract, nil
+	}
+	if o.contract == "" {
+		return "", "", errors.New("no artifact given: pass a path, --artifact or --contract")
+	}
+	return filepath.Join(o.outDir, o.contract+".sol", o.contract+".json"), o.contract, nil
+}
+
+// loadArtifact is LoadArtifact for deployment: it rejects artifacts
+// without creation code.
+func loadArtifact(path, contract string) (*Artifact, error) {
+	a, err := LoadArtifact(path, contract)
+	if err != nil {
+		return nil, err
+	}
+	if len(a.Bytecode) == 0 {
+		return nil, fmt.Errorf("artifact %s has no creation bytecode; interfaces, abstract contracts and libraries without code cannot be deployed", path)
+	}
+	return a, nil
+}
+
+// loadABI is LoadArtifact for callers that only need the ABI, so
+// interfaces and abstract contracts are accepted.
+func loadABI(path, contract string) (*Artifact, error) {
+	return LoadArtifact(path, contract)
+}
+
+// nearbyArtifacts lists JSON files next to path, or one directory up
+// (the out/<File>.sol/ layout) when the immediate directory is missing.
+func nearbyArtifacts(path string) []string {
+	dir := filepath.Dir(path)
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(matches) == 0 {
+		matches, _ = filepath.Glob(filepath.Join(filepath.Dir(dir), "*", "*.json"))
+	}
+	if len(matches) > 10 {
+		matches = append(matches[:10], "...")
+	}
+	return matches
+}
@@ -0,0 +1,186 @@
+package deployer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// anvilStartTimeout bounds how long a spawned Anvil gets to answer;
+// forking a remote chain can take a while.
+const anvilStartTimeout = 60 * time.Second
+
+// anvilDevKey is the well-known key of Anvil's first dev account, used
+// with --auto-anvil when no key is configured.
+const anvilDevKey = "ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80"
+
+// anvilListening matches the line Anvil prints once it is serving.
+var anvilListening = regexp.MustCompile(`Listening on ([0-9.]+:[0-9]+)`)
+
+// anvilOptions make a command start its own Anvil node instead of
+// connecting to --rpc.
+type anvilOptions struct {
+	auto    bool
+	forkURL string
+	logFile string
+
+	// forkBlock, if set, is the block the fork starts from instead of
+	// the latest, as `replay` needs.
+	forkBlock uint64
+}
+
+func (o *anvilOptions) register(fs *flag.FlagSet) {
+	fs.BoolVar(&o.auto, "auto-anvil", false, "start a throwaway anvil node for this command and stop it on exit (ignores --rpc)")
+	fs.StringVar(&o.forkURL, "fork-url", "", "with --auto-anvil, fork this chain")
+	fs.StringVar(&o.logFile, "anvil-log", "", "with --auto-anvil, write anvil's output to this file (default shown under --verbose)")
+}
+
+// anvilProcess is a running child anvil.
+type anvilProcess struct {
+	cmd  *exec.Cmd
+	url  string
+	done chan struct{} // closed once the process has exited
+	log  io.Closer
+}
+
+// startAnvil spawns anvil on a port it picks itself, reads the port from
+// its output and waits until it answers eth_chainId.
+func startAnvil(ctx context.Context, o anvilOptions) (*anvilProcess, error) {
+	bin, err := exec.LookPath("anvil")
+	if err != nil {
+		return nil, errors.New("--auto-anvil: anvil not found on PATH; install Foundry with `curl -L https://foundry.paradigm.xyz | bash && foundryup`")
+	}
+	args := []string{"--port", "0"}
+	if o.forkURL != "" {
+		args = append(args, "--fork-url", o.forkURL)
+	}
+	if o.forkBlock > 0 {
+		args = append(args, "--fork-block-number", strconv.FormatUint(o.forkBlock, 10))
+	}
+	p := &anvilProcess{cmd: exec.Command(bin, args...), done: make(chan struct{})}
+	out, err := p.cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("anvil: %w", err)
+	}
+	p.cmd.Stderr = p.cmd.Stdout
+	var sink io.Writer
+	if o.logFile != "" {
+		f, err := os.Create(o.logFile)
+		if err != nil {
+			return nil, fmt.Errorf("--anvil-log: %w", err)
+		}
+		sink, p.log = f, f
+	}
+	if err := p.cmd.Start(); err != nil {
+		if p.log != nil {
+			p.log.Close()
+		}
+		return nil, fmt.Errorf("start anvil: %w", err)
+	}
+	ui.Verbosef("Started anvil (pid %d)\n", p.cmd.Process.Pid)
+
+	addr := make(chan string, 1)
+	go func() {
+		defer close(p.done)
+		sc := bufio.NewScanner(out)
+		for sc.Scan() {
+			line := sc.Text()
+			if m := anvilListening.FindStringSubmatch(line); m != nil {
+				select {
+				case addr <- m[1]:
+				default:
+				}
+			}
+			if sink != nil {
+				fmt.Fprintln(sink, line)
+			} else {
+				ui.Verbosef("[anvil] %s\n", line)
+			}
+		}
+		p.cmd.Wait()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, anvilStartTimeout)
+	defer cancel()
+	select {
+	case a := <-addr:
+		p.url = "http://" + a
+	case <-p.done:
+		p.stop()
+		return nil, fmt.Errorf("anvil exited during startup: %v", p.cmd.ProcessState)
+	case <-ctx.Done():
+		p.stop()
+		return nil, fmt.Errorf("anvil did not start listening: %w", ctx.Err())
+	}
+	if err := p.ready(ctx); err != nil {
+		p.stop()
+		return nil, err
+	}
+	ui.Println("Started anvil at", p.url)
+	return p, nil
+}
+
+// ready polls eth_chainId until the node answers.
+func (p *anvilProcess) ready(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		c, err := rpc.DialContext(ctx, p.url)
+		if err == nil {
+			var id string
+			err = c.CallContext(ctx, &id, "eth_chainId")
+			c.Close()
+			if err == nil {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("anvil at %s not answering: %w", p.url, err)
+		case <-p.done:
+			return fmt.Errorf("anvil exited during startup: %v", p.cmd.ProcessState)
+		case <-ticker.C:
+		}
+	}
+}
+
+// stop interrupts anvil, kills it if it has not exited within five
+// seconds and waits for its output to drain.
+func (p *anvilProcess) stop() {
+	p.cmd.Process.Signal(os.Interrupt)
+	select {
+	case <-p.done:
+	case <-time.After(5 * time.Second):
+		p.cmd.Process.Kill()
+		<-p.done
+	}
+	if p.log != nil {
+		p.log.Close()
+	}
+	ui.Verbosef("Stopped anvil\n")
+}
+
+// anvilSigner loads the configured key, falling back to Anvil's first dev
+// account when none is set.
+func anvilSigner(ko KeyOptions) (*Signer, error) {
+	kind, _, _, err := keyMaterial(ko)
+	if err != nil || kind != "" || (ko.Signer != "" && ko.Signer != "local") {
+		return LoadSigner(ko)
+	}
+	key, err := crypto.HexToECDSA(anvilDevKey)
+	if err != nil {
+		return nil, err
+	}
+	return newKeySigner(key, "anvil dev account 0"), nil
+}
@@ -0,0 +1,127 @@
+//go:build integration
+
+package deployer
+
+import (
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// These tests run a real anvil; run them with -tags integration and
+// Foundry installed.
+
+func needAnvil(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("anvil"); err != nil {
+		t.Skip("anvil not on PATH")
+	}
+}
+
+// listening is the address the anvil log at path says it served on.
+func listening(t *testing.T, path string) string {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := anvilListening.FindStringSubmatch(string(raw))
+	if m == nil {
+		t.Fatalf("anvil log has no listening line:\n%s", raw)
+	}
+	return m[1]
+}
+
+// refused fails unless nothing accepts connections at addr.
+func refused(t *testing.T, addr string) {
+	t.Helper()
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Fatalf("%s still accepts connections after anvil stopped", addr)
+	}
+}
+
+// TestAutoAnvil starts anvil, talks to it and stops it.
+func TestAutoAnvil(t *testing.T) {
+	needAnvil(t)
+	log := filepath.Join(t.TempDir(), "anvil.log")
+	p, err := startAnvil(t.Context(), anvilOptions{auto: true, logFile: log})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := strings.TrimPrefix(p.url, "http://")
+	if !strings.HasPrefix(p.url, "http://") || strings.HasSuffix(addr, ":0") {
+		p.stop()
+		t.Fatalf("anvil url = %s, want http on the port anvil picked", p.url)
+	}
+
+	c, err := rpc.DialContext(t.Context(), p.url)
+	if err != nil {
+		p.stop()
+		t.Fatal(err)
+	}
+	var id hexutil.Big
+	err = c.CallContext(t.Context(), &id, "eth_chainId")
+	c.Close()
+	p.stop()
+	if err != nil || id.ToInt().Cmp(big.NewInt(31337)) != 0 {
+		t.Fatalf("eth_chainId = %s (%v), want 31337", id.String(), err)
+	}
+
+	select {
+	case <-p.done:
+	default:
+		t.Fatal("stop returned before anvil's output was drained")
+	}
+	if p.cmd.ProcessState == nil {
+		t.Fatalf("anvil process state after stop = %v", p.cmd.ProcessState)
+	}
+	if got := listening(t, log); got != addr {
+		t.Fatalf("anvil log says it listened on %s, want %s", got, addr)
+	}
+	refused(t, addr)
+}
+
+// TestAutoAnvilDeploy deploys with --auto-anvil and the dev key, and
+// checks anvil is gone once the command returns.
+func TestAutoAnvilDeploy(t *testing.T) {
+	needAnvil(t)
+	artifact, err := filepath.Abs("testdata/artifacts/hardhat.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	isolate(t)
+	dir, log := filepath.Join(t.TempDir(), "deployments"), filepath.Join(t.TempDir(), "anvil.log")
+
+	if err := runDeploy(t.Context(), []string{"--auto-anvil", "--anvil-log", log, "--deployments-dir", dir, "--poll-interval", "100ms", "--yes", artifact, "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	// Anvil's first dev account, whose key is anvilDevKey.
+	dev := common.HexToAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266")
+	m, err := readManifest(manifestPath(dir, big.NewInt(31337), "Greeter"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := m.latest(); d == nil || d.Deployer != dev {
+		t.Fatalf("recorded deployment = %+v, want one by the anvil dev account", d)
+	}
+	refused(t, listening(t, log))
+}
+
+// TestAutoAnvilMissing checks the error names the install command when
+// anvil is not on PATH.
+func TestAutoAnvilMissing(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	_, err := startAnvil(t.Context(), anvilOptions{auto: true})
+	if err == nil || !strings.Contains(err.Error(), "anvil not found on PATH") || !strings.Contains(err.Error(), "foundryup") {
+		t.Fatalf("startAnvil without anvil = %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// invalidRequest is the JSON-RPC error code for a request the endpoint
+// cannot take at all.
+const invalidRequest = -32600
+
+// batchPolicy controls how reads made close together are coalesced into
+// one JSON-RPC batch.
+type batchPolicy struct {
+	window time.Duration
+	max    int
+}
+
+func (p *batchPolicy) register(fs *flag.FlagSet) {
+	fs.DurationVar(&p.window, "rpc-batch-window", 10*time.Millisecond, "send receipt, nonce and balance reads made within this long of each other as one JSON-RPC batch (0 disables)")
+	fs.IntVar(&p.max, "rpc-batch-max", 100, "most calls in one JSON-RPC batch")
+}
+
+// batchCall is one call waiting in a batcher: its caller's context, the
+// element the batch fills in, and closed once it has.
+type batchCall struct {
+	ctx  context.Context
+	elem rpc.BatchElem
+	done chan struct{}
+}
+
+// batcher coalesces the calls made within its window into one
+// BatchCallContext, sent as soon as the window closes or max calls are
+// waiting. Each caller gets its own result and error back. An endpoint
+// that refuses a batch gets the calls one at a time from then on.
+type batcher struct {
+	c      *rpcClient
+	policy batchPolicy
+	pin    bool // send to the pinned endpoint rather than the best one
+
+	mu         sync.Mutex
+	queue      []*batchCall
+	timer      *time.Timer
+	sequential bool
+}
+
+func newBatcher(c *rpcClient, p batchPolicy, pin bool) *batcher {
+	return &batcher{c: c, policy: p, pin: pin}
+}
+
+// do calls method with args into result, in the next batch.
+func (b *batcher) do(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	call := &batchCall{ctx: ctx, elem: rpc.BatchElem{Method: method, Args: args, Result: result}, done: make(chan struct{})}
+	if b.policy.window <= 0 || b.policy.max <= 1 {
+		b.one(ctx, call)
+		return call.elem.Error
+	}
+	b.mu.Lock()
+	b.queue = append(b.queue, call)
+	switch {
+	case len(b.queue) >= b.policy.max:
+		go b.run(b.take())
+	case b.timer == nil:
+		b.timer = time.AfterFunc(b.policy.window, func() {
+			b.mu.Lock()
+			calls := b.take()
+			b.mu.Unlock()
+			b.run(calls)
+		})
+	}
+	b.mu.Unlock()
+	select {
+	case <-call.done:
+		return call.elem.Error
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// take empties the queue. Caller holds b.mu.
+func (b *batcher) take() []*batchCall {
+	calls := b.queue
+	b.queue = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	return calls
+}
+
+// route runs f as a read or a pinned call, with their failover and
+// retries.
+func (b *batcher) route(ctx context.Context, what string, f func(context.Context, *ethclient.Client) error) error {
+	g := func(ctx context.Context, cl *ethclient.Client) (struct{}, error) { return struct{}{}, f(ctx, cl) }
+	var err error
+	if b.pin {
+		_, err = pinned(ctx, b.c, what, g)
+	} else {
+		_, err = read(ctx, b.c, what, g)
+	}
+	return err
+}
+
+// one sends a single call on its own.
+func (b *batcher) one(ctx context.Context, call *batchCall) {
+	call.elem.Error = b.route(ctx, call.elem.Method, func(ctx context.Context, cl *ethclient.Client) error {
+		return cl.Client().CallContext(ctx, call.elem.Result, call.elem.Method, call.elem.Args...)
+	})
+}
+
+// run sends calls as one batch and hands each caller its answer. Calls
+// whose caller has given up are dropped first. Calls whose answer was a
+// transient error, such as a rate limit inside the batch, are retried on
+// their own.
+func (b *batcher) run(queued []*batchCall) {
+	defer func() {
+		for _, call := range queued {
+			close(call.done)
+		}
+	}()
+	calls := live(queued)
+	b.mu.Lock()
+	sequential := b.sequential
+	b.mu.Unlock()
+	if len(calls) <= 1 || sequential {
+		for _, call := range calls {
+			b.one(call.ctx, call)
+		}
+		return
+	}
+	ctx, cancel := batchContext(calls)
+	defer cancel()
+
+	elems := make([]rpc.BatchElem, len(calls))
+	err := b.route(ctx, "batch", func(ctx context.Context, cl *ethclient.Client) error {
+		for i, call := range calls {
+			elems[i] = call.elem
+		}
+		if err := cl.Client().BatchCallContext(ctx, elems); err != nil {
+			return err
+		}
+		return b.c.rpcLog.batchError(elems)
+	})
+	if err == nil {
+		for i := range elems {
+			elems[i].Error = b.c.rpcLog.original(elems[i].Error)
+		}
+	}
+	if err == nil && refusedBatch(elems) {
+		err = errors.New(elems[0].Error.Error())
+	}
+	switch {
+	case err == nil:
+	case transient(err):
+		for _, call := range calls {
+			call.elem.Error = err
+		}
+		return
+	default:
+		b.mu.Lock()
+		if !b.sequential {
+			b.sequential = true
+			b.c.ui.Verbosef("rpc: batch refused (%v); sending calls one at a time\n", err)
+		}
+		b.mu.Unlock()
+		for _, call := range calls {
+			b.one(call.ctx, call)
+		}
+		return
+	}
+	for i, call := range calls {
+		if call.elem.Error = elems[i].Error; transient(call.elem.Error) {
+			b.one(call.ctx, call)
+		}
+	}
+}
+
+// live answers the calls whose caller has given up with its context's
+// error and returns the rest.
+func live(calls []*batchCall) []*batchCall {
+	var out []*batchCall
+	for _, call := range calls {
+		if err := call.ctx.Err(); err != nil {
+			call.elem.Error = err
+			continue
+		}
+		out = append(out, call)
+	}
+	return out
+}
+
+// batchContext is the context a batch of calls is sent on: it carries the
+// first caller's values and is cancelled once every caller has given up.
+func batchContext(calls []*batchCall) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(calls[0].ctx))
+	var waiting atomic.Int64
+	waiting.Store(int64(len(calls)))
+	stops := make([]func() bool, len(calls))
+	for i, call := range calls {
+		stops[i] = context.AfterFunc(call.ctx, func() {
+			if waiting.Add(-1) == 0 {
+				cancel()
+			}
+		})
+	}
+	return ctx, func() {
+		for _, stop := range stops {
+			stop()
+		}
+		cancel()
+	}
+}
+
+// refusedBatch reports whether every call in a batch failed as an invalid
+// request, the way endpoints that do not take batches answer one.
+func refusedBatch(elems []rpc.BatchElem) bool {
+	for _, e := range elems {
+		var rpcErr rpc.Error
+		if !errors.As(e.Error, &rpcErr) || rpcErr.ErrorCode() != invalidRequest {
+			return false
+		}
+	}
+	return true
+}
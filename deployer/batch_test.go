@@ -0,0 +1,151 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// balanceService answers eth_chainId and eth_getBalance, every account
+// holding 1 wei.
+type balanceService struct{}
+
+func (balanceService) ChainId() hexutil.Uint64 { return 1337 }
+
+func (balanceService) GetBalance(common.Address, string) *hexutil.Big {
+	return (*hexutil.Big)(big.NewInt(1))
+}
+
+// balanceNode serves balanceService over HTTP, counting the requests it
+// gets and the eth_getBalance calls in them.
+type balanceNode struct {
+	url                string
+	requests, balances atomic.Int64
+}
+
+func newBalanceNode(tb testing.TB) *balanceNode {
+	tb.Helper()
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("eth", balanceService{}); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(srv.Stop)
+	n := &balanceNode{}
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		n.requests.Add(1)
+		n.balances.Add(int64(bytes.Count(body, []byte(`"eth_getBalance"`))))
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		srv.ServeHTTP(w, r)
+	}))
+	tb.Cleanup(hs.Close)
+	n.url = hs.URL
+	return n
+}
+
+func batchDial(tb testing.TB, url string, p batchPolicy) *rpcClient {
+	tb.Helper()
+	c, err := dial(tb.Context(), cli, []string{url}, retryPolicy{attempts: 1}, 0, p, http.Header{})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(c.Close)
+	return c
+}
+
+// TestBatchDropsCancelled batches three reads, one of whose caller gives
+// up before the window closes: it is not sent, and the other two are.
+func TestBatchDropsCancelled(t *testing.T) {
+	node := newBalanceNode(t)
+	c := batchDial(t, node.url, batchPolicy{window: 100 * time.Millisecond, max: 100})
+	sent := node.requests.Load()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+	errs := make([]error, 3)
+	var wg sync.WaitGroup
+	for i, ctx := range []context.Context{t.Context(), ctx, t.Context()} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = c.BalanceAt(ctx, common.Address{byte(i)}, nil)
+		}()
+	}
+	wg.Wait()
+	if errs[0] != nil || errs[2] != nil {
+		t.Fatalf("live reads = %v, %v", errs[0], errs[2])
+	}
+	if !errors.Is(errs[1], context.DeadlineExceeded) {
+		t.Fatalf("cancelled read = %v, want its deadline", errs[1])
+	}
+	if n := node.requests.Load() - sent; n != 1 {
+		t.Errorf("%d requests, want one batch", n)
+	}
+	if n := node.balances.Load(); n != 2 {
+		t.Errorf("%d balance reads sent, want the 2 still wanted", n)
+	}
+}
+
+// TestBatchContext checks a batch's context outlives all but the last of
+// its callers.
+func TestBatchContext(t *testing.T) {
+	ctx1, cancel1 := context.WithCancel(t.Context())
+	ctx2, cancel2 := context.WithCancel(t.Context())
+	defer cancel2()
+	ctx, stop := batchContext([]*batchCall{{ctx: ctx1}, {ctx: ctx2}})
+	defer stop()
+	cancel1()
+	time.Sleep(10 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatal("batch cancelled while a caller still waits")
+	}
+	cancel2()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("batch still live after every caller gave up")
+	}
+}
+
+// BenchmarkBatchRoundTrip reads 20 balances at once, one request each
+// and coalesced into batches.
+func BenchmarkBatchRoundTrip(b *testing.B) {
+	for _, bench := range []struct {
+		name   string
+		policy batchPolicy
+	}{
+		{"sequential", batchPolicy{}},
+		{"batched", batchPolicy{window: time.Millisecond, max: 100}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			node := newBalanceNode(b)
+			c := batchDial(b, node.url, bench.policy)
+			for b.Loop() {
+				var wg sync.WaitGroup
+				for i := range 20 {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						if _, err := c.BalanceAt(b.Context(), common.Address{byte(i)}, nil); err != nil {
+							b.Error(err)
+						}
+					}()
+				}
+				wg.Wait()
+			}
+			b.ReportMetric(float64(node.requests.Load())/float64(b.N), "requests/op")
+		})
+	}
+}
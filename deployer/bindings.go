@@ -0,0 +1,91 @@
+package deployer
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/abigen"
+)
+
+// bindingsFor renders typed Go bindings for a, with its creation code so
+// the package gets a Deploy function. api is "v1" (bind.BoundContract
+// wrappers, as abigen generates by default) or "v2" (abigen --v2).
+func bindingsFor(a *Artifact, pkg, api string, aliases map[string]string) (string, error) {
+	if len(a.Libraries) > 0 {
+		var names []string
+		for _, lib := range a.Libraries {
+			names = append(names, lib.Name)
+		}
+		return "", fmt.Errorf("%s links libraries (%s); bindings need fully linked bytecode", a.Name, strings.Join(names, ", "))
+	}
+	types, abis, codes := []string{a.Name}, []string{string(a.RawABI)}, []string{hex.EncodeToString(a.Bytecode)}
+	switch api {
+	case "v1":
+		return abigen.Bind(types, abis, codes, nil, pkg, nil, aliases)
+	case "v2":
+		return abigen.BindV2(types, abis, codes, pkg, nil, aliases)
+	}
+	return "", fmt.Errorf("--api: want v1 or v2, got %q", api)
+}
+
+// runBindings implements `bindings [flags] <artifact>...`: write abigen
+// style Go bindings for each artifact, without abigen or extracted ABI
+// files.
+func runBindings(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("bindings", flag.ExitOnError)
+	ui.register(fs)
+	pkg := fs.String("pkg", "bindings", "Go package name of the generated files")
+	out := fs.String("out", ".", "directory for one <contract>.go per artifact, or a .go file for a single artifact")
+	api := fs.String("api", "v1", "bind API to generate for: v1 (bind.BoundContract wrappers) or v2 (abigen --v2)")
+	contract := fs.String("contract", "", "contract to pick from solc standard-json output")
+	aliases := map[string]string{}
+	fs.Func("alias", "rename a generated identifier, e.g. _totalSupply=TotalSupply2; repeatable", func(v string) error {
+		from, to, ok := strings.Cut(v, "=")
+		if !ok || from == "" || to == "" {
+			return fmt.Errorf("want original=alias, got %q", v)
+		}
+		aliases[from] = to
+		return nil
+	})
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("usage: bindings [flags] <artifact>...")
+	}
+	toFile := strings.HasSuffix(*out, ".go")
+	if toFile && fs.NArg() > 1 {
+		return fmt.Errorf("--out %s is a file but %d artifacts were given; pass a directory", *out, fs.NArg())
+	}
+	dir := *out
+	if toFile {
+		dir = filepath.Dir(*out)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("--out: %w", err)
+	}
+
+	for _, path := range fs.Args() {
+		a, err := LoadArtifact(path, *contract)
+		if err != nil {
+			return err
+		}
+		code, err := bindingsFor(a, *pkg, *api, aliases)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		dest := *out
+		if !toFile {
+			dest = filepath.Join(*out, strings.ToLower(a.Name)+".go")
+		}
+		if err := os.WriteFile(dest, []byte(code), 0o644); err != nil {
+			return fmt.Errorf("write bindings: %w", err)
+		}
+		ui.Printf("%s bindings (%s API) written to %s\n", a.Name, *api, dest)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package deployer
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestBindings generates both bind APIs for the greeter and the pointer
+// fixture, one file each, parses them and, unless -short, builds and
+// vets them as a package of their own.
+func TestBindings(t *testing.T) {
+	for _, api := range []string{"v1", "v2"} {
+		t.Run(api, func(t *testing.T) {
+			dir := t.TempDir()
+			pointer := writeArtifact(t, t.TempDir(), "Pointer", pointerABI)
+			args := []string{"--pkg", "greeter", "--out", dir, "--api", api, "--alias", "greet=Hello", "testdata/artifacts/hardhat.json", pointer}
+			if err := runBindings(t.Context(), args); err != nil {
+				t.Fatal(err)
+			}
+
+			fset := token.NewFileSet()
+			pkgs, err := parser.ParseDir(fset, dir, nil, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := pkgs["greeter"]
+			if len(pkgs) != 1 || p == nil || len(p.Files) != 2 {
+				t.Fatalf("parsed packages %v, want greeter with two files", pkgs)
+			}
+			for _, name := range []string{"greeter.go", "pointer.go"} {
+				if _, ok := p.Files[filepath.Join(dir, name)]; !ok {
+					t.Fatalf("no %s generated", name)
+				}
+			}
+			src, err := os.ReadFile(filepath.Join(dir, "greeter.go"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(src), "Hello(") || !strings.Contains(string(src), greeterCreation[:40]) {
+				t.Fatal("greeter bindings lack the aliased greet method or the creation code")
+			}
+
+			if testing.Short() {
+				return
+			}
+			goBuild(t, dir)
+		})
+	}
+}
+
+// goBuild builds and vets the package in dir against this module's
+// requirements, offline.
+func goBuild(t *testing.T, dir string) {
+	t.Helper()
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command")
+	}
+	for _, f := range []string{"go.mod", "go.sum"} {
+		raw, err := os.ReadFile(filepath.Join("..", f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, f), raw, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, verb := range []string{"build", "vet"} {
+		cmd := exec.CommandContext(t.Context(), gobin, verb, ".")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("go %s: %v\n%s", verb, err, out)
+		}
+	}
+}
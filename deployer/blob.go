@@ -0,0 +1,241 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto/kzg4844"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+// blobCapacity is how many bytes of data fit in one blob: 31 per field
+// element, whose top byte stays zero so it is below the BLS modulus.
+const blobCapacity = params.BlobTxFieldElementsPerBlob * (params.BlobTxBytesPerFieldElement - 1)
+
+// blobFeeUpdateFraction is Prague's blob base fee update fraction, used
+// to price blobs from the head's excess blob gas when the node does not
+// serve eth_blobBaseFee.
+var blobFeeUpdateFraction = new(big.Int).SetUint64(params.DefaultPragueBlobConfig.UpdateFraction)
+
+// packBlobs splits data into blobs, 31 bytes per field element, padding
+// the last with zeros.
+func packBlobs(data []byte) []kzg4844.Blob {
+	blobs := make([]kzg4844.Blob, (len(data)+blobCapacity-1)/blobCapacity)
+	for i := range blobs {
+		chunk := data[i*blobCapacity:]
+		if len(chunk) > blobCapacity {
+			chunk = chunk[:blobCapacity]
+		}
+		for fe := 0; len(chunk) > 0; fe++ {
+			n := copy(blobs[i][fe*params.BlobTxBytesPerFieldElement+1:(fe+1)*params.BlobTxBytesPerFieldElement], chunk)
+			chunk = chunk[n:]
+		}
+	}
+	return blobs
+}
+
+// blobSidecar commits to blobs and proves them: one proof per blob, or,
+// for networks past Osaka (EIP-7594), cell proofs.
+func blobSidecar(blobs []kzg4844.Blob, cellProofs bool) (*types.BlobTxSidecar, error) {
+	version := types.BlobSidecarVersion0
+	if cellProofs {
+		version = types.BlobSidecarVersion1
+	}
+	commitments := make([]kzg4844.Commitment, len(blobs))
+	var proofs []kzg4844.Proof
+	for i := range blobs {
+		c, err := kzg4844.BlobToCommitment(&blobs[i])
+		if err != nil {
+			return nil, fmt.Errorf("blob %d: commitment: %w", i, err)
+		}
+		commitments[i] = c
+		if cellProofs {
+			p, err := kzg4844.ComputeCellProofs(&blobs[i])
+			if err != nil {
+				return nil, fmt.Errorf("blob %d: cell proofs: %w", i, err)
+			}
+			proofs = append(proofs, p...)
+			continue
+		}
+		p, err := kzg4844.ComputeBlobProof(&blobs[i], c)
+		if err != nil {
+			return nil, fmt.Errorf("blob %d: proof: %w", i, err)
+		}
+		proofs = append(proofs, p)
+	}
+	return types.NewBlobTxSidecar(version, blobs, commitments, proofs), nil
+}
+
+// blobBaseFee is the blob base fee of the next block. Nodes that do not
+// serve eth_blobBaseFee get it computed from head's excess blob gas.
+func blobBaseFee(ctx context.Context, client *rpcClient, head *types.Header) *big.Int {
+	fee, err := client.BlobBaseFee(ctx)
+	if err == nil {
+		return fee
+	}
+	client.ui.Verbosef("eth_blobBaseFee: %v; pricing blobs from the head's excess blob gas\n", err)
+	excess := new(big.Int).SetUint64(*head.ExcessBlobGas)
+	return fakeExponential(big.NewInt(params.BlobTxMinBlobGasprice), excess, blobFeeUpdateFraction)
+}
+
+// fakeExponential approximates factor * e ** (numerator / denominator),
+// as EIP-4844 specifies.
+func fakeExponential(factor, numerator, denominator *big.Int) *big.Int {
+	output := new(big.Int)
+	accum := new(big.Int).Mul(factor, denominator)
+	for i := int64(1); accum.Sign() > 0; i++ {
+		output.Add(output, accum)
+		accum.Mul(accum, numerator)
+		accum.Div(accum, denominator)
+		accum.Div(accum, big.NewInt(i))
+	}
+	return output.Div(output, denominator)
+}
+
+// runSendBlob implements `send-blob --to <address> --blob-file <path>
+// [--blob-file <path>...]`: post data in an EIP-4844 blob transaction.
+func runSendBlob(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("send-blob", flag.ExitOnError)
+	var o options
+	var txo txOptions
+	var files []string
+	o.register(fs)
+	toFlag := fs.String("to", "", "recipient of the blob transaction (blob transactions cannot create contracts)")
+	fs.Func("blob-file", "file to post as blobs, 126976 bytes per blob; repeat for more files", func(v string) error {
+		files = append(files, v)
+		return nil
+	})
+	maxBlobFee := fs.String("max-blob-fee", "", "max fee per blob gas, e.g. 10gwei (default twice the next block's blob base fee)")
+	legacyProofs := fs.Bool("legacy-blob-proofs", false, "send one KZG proof per blob, as networks before Osaka expect, instead of cell proofs")
+	fs.Uint64Var(&txo.gasLimit, "gas-limit", 0, "exact gas limit (default 21000 to an account, padded estimate otherwise)")
+	fs.Int64Var(&txo.nonce, "nonce", -1, "nonce override (default pending nonce)")
+	fs.BoolVar(&txo.noWait, "no-wait", false, "print the transaction hash and exit without waiting")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || *toFlag == "" || len(files) == 0 {
+		return errors.New("usage: send-blob [flags] --to <address> --blob-file <path> [--blob-file <path>...]")
+	}
+	to, err := parseAddress(*toFlag)
+	if err != nil {
+		return fmt.Errorf("--to: %w", err)
+	}
+	var blobs []kzg4844.Blob
+	size := 0
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("--blob-file: %w", err)
+		}
+		if len(data) == 0 {
+			return fmt.Errorf("--blob-file %s is empty", path)
+		}
+		blobs = append(blobs, packBlobs(data)...)
+		size += len(data)
+	}
+	if len(blobs) > params.BlobTxMaxBlobs {
+		return fmt.Errorf("%d bytes need %d blobs, but a transaction carries at most %d (%d bytes)", size, len(blobs), params.BlobTxMaxBlobs, params.BlobTxMaxBlobs*blobCapacity)
+	}
+	blobFeeCap, err := parseValue(*maxBlobFee)
+	if err != nil {
+		return fmt.Errorf("--max-blob-fee: %w", err)
+	}
+
+	s, err := openSession(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if s.signer.remote != nil {
+		return fmt.Errorf("%s cannot sign blob transactions; use a local key or KMS", s.signer.Source)
+	}
+	head, err := s.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("head block: %w", err)
+	}
+	if head.ExcessBlobGas == nil {
+		return fmt.Errorf("%s does not support blob transactions: its head block has no excess blob gas (EIP-4844 is not active)", chainName(s.chainID))
+	}
+	if blobFeeCap == nil {
+		base := blobBaseFee(ctx, s.client, head)
+		blobFeeCap = new(big.Int).Mul(base, big.NewInt(2))
+		ui.Verbosef("blob base fee %s wei, max blob fee %s wei\n", base, blobFeeCap)
+	}
+
+	sidecar, err := blobSidecar(blobs, !*legacyProofs)
+	if err != nil {
+		return err
+	}
+	hashes := sidecar.BlobHashes()
+	opts, err := s.opts(ctx, txo)
+	if err != nil {
+		return err
+	}
+	if opts.GasPrice != nil {
+		return errors.New("blob transactions need EIP-1559 fees; drop the legacy --max-fee pricing for this chain")
+	}
+	code, err := s.client.CodeAt(ctx, to, nil)
+	if err != nil {
+		return fmt.Errorf("get code at %s: %w", to.Hex(), err)
+	}
+	if len(code) == 0 && opts.GasLimit == 0 {
+		opts.GasLimit = params.TxGas
+	} else if err := s.setGasLimit(ctx, opts, ethereum.CallMsg{To: &to, BlobGasFeeCap: blobFeeCap, BlobHashes: hashes}, nil); err != nil {
+		return fmt.Errorf("send-blob: %w", err)
+	}
+
+	blobGas := uint64(len(blobs)) * params.BlobTxBlobGasPerBlob
+	maxBlobCost := new(big.Int).Mul(new(big.Int).SetUint64(blobGas), blobFeeCap)
+	ui.Printf("Blob gas: %d at up to %s wei (%s ETH), on top of the max cost below\n", blobGas, blobFeeCap, formatEther(maxBlobCost))
+	call := fmt.Sprintf("post %d bytes in %d blobs", size, len(blobs))
+	if len(blobs) == 1 {
+		call = fmt.Sprintf("post %d bytes in a blob", size)
+	}
+	tx, err := s.submit(ctx, opts, txSummary{to: &to, call: call}, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		tx, err := opts.Signer(opts.From, types.NewTx(&types.BlobTx{
+			ChainID:    uint256.MustFromBig(s.chainID),
+			Nonce:      opts.Nonce.Uint64(),
+			GasTipCap:  uint256.MustFromBig(opts.GasTipCap),
+			GasFeeCap:  uint256.MustFromBig(opts.GasFeeCap),
+			Gas:        opts.GasLimit,
+			To:         to,
+			Value:      new(uint256.Int),
+			BlobFeeCap: uint256.MustFromBig(blobFeeCap),
+			BlobHashes: hashes,
+			Sidecar:    sidecar,
+		}))
+		if err != nil {
+			return nil, err
+		}
+		return tx, s.client.SendTransaction(opts.Context, tx)
+	})
+	if err != nil {
+		return fmt.Errorf("send-blob: %w", explainError(err, nil))
+	}
+	ui.Printf("Blob tx: %s (%d blobs to %s)\n", tx.Hash().Hex(), len(blobs), to.Hex())
+	ui.link("tx", tx.Hash().Hex())
+	for i, h := range hashes {
+		ui.Verbosef("  blob %d: versioned hash %s, commitment %x\n", i, h.Hex(), sidecar.Commitments[i][:])
+	}
+	ui.Verbosef("  nonce %d, gas limit %d\n", tx.Nonce(), tx.Gas())
+	if txo.noWait {
+		return nil
+	}
+	rcpt, err := s.waitReceipt(ctx, tx, nil)
+	if err != nil {
+		return err
+	}
+	if rcpt.BlobGasPrice != nil {
+		ui.Printf("  blob gas used %d at %s wei (%s ETH)\n", rcpt.BlobGasUsed, rcpt.BlobGasPrice, formatEther(new(big.Int).Mul(new(big.Int).SetUint64(rcpt.BlobGasUsed), rcpt.BlobGasPrice)))
+	}
+	ui.report.Transactions = append(ui.report.Transactions, *newTxReport("send-blob", rcpt, nil))
+	return nil
+}
@@ -0,0 +1,311 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// fetchBlock reads block number with its transaction hashes, which is
+// all `blocks` shows of them. The hash is the node's, not one computed
+// from the header, so chains with extra header fields still match their
+// explorers.
+func fetchBlock(ctx context.Context, client *rpcClient, number uint64) (*BlockReport, error) {
+	raw, err := read(ctx, client, "eth_getBlockByNumber", func(ctx context.Context, cl *ethclient.Client) (json.RawMessage, error) {
+		var raw json.RawMessage
+		err := cl.Client().CallContext(ctx, &raw, "eth_getBlockByNumber", hexutil.EncodeUint64(number), false)
+		return raw, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get block %d: %w", number, err)
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, fmt.Errorf("get block %d: not found", number)
+	}
+	var h types.Header
+	if err := json.Unmarshal(raw, &h); err != nil {
+		return nil, fmt.Errorf("get block %d: %w", number, err)
+	}
+	var rest struct {
+		Hash         common.Hash   `json:"hash"`
+		Transactions []common.Hash `json:"transactions"`
+	}
+	if err := json.Unmarshal(raw, &rest); err != nil {
+		return nil, fmt.Errorf("get block %d: %w", number, err)
+	}
+	b := &BlockReport{
+		Number:       h.Number.Uint64(),
+		Hash:         rest.Hash,
+		Time:         h.Time,
+		GasUsed:      h.GasUsed,
+		GasLimit:     h.GasLimit,
+		TxCount:      len(rest.Transactions),
+		Transactions: rest.Transactions,
+		baseFee:      h.BaseFee,
+	}
+	if h.GasLimit > 0 {
+		b.Utilization = float64(h.GasUsed) * 100 / float64(h.GasLimit)
+	}
+	if h.BaseFee != nil {
+		b.BaseFee = h.BaseFee.String()
+	}
+	return b, nil
+}
+
+// printBlock shows b on one line, and with full its transaction hashes
+// under it.
+func printBlock(b *BlockReport, full bool) {
+	fee := "-"
+	if b.baseFee != nil {
+		fee = formatUnits(b.baseFee, 9) + " gwei"
+	}
+	when := time.Unix(int64(b.Time), 0).UTC().Format(time.DateTime)
+	ui.Resultf("block %d %s %s gas %d/%d (%.1f%%) base fee %s, %d txs\n", b.Number, b.Hash.Hex(), when, b.GasUsed, b.GasLimit, b.Utilization, fee, b.TxCount)
+	if full {
+		for _, h := range b.Transactions {
+			ui.Resultf("  %s\n", h.Hex())
+		}
+	}
+}
+
+// follower prints each new block once, in order, and keeps the tally
+// for the summary printed when it stops.
+type follower struct {
+	client *rpcClient
+	full   bool
+
+	next    *big.Int // first block not yet printed; nil before the first connect
+	seen    int
+	first   uint64
+	feeSum  *big.Int
+	feeSeen int
+}
+
+// show prints b: a line of text, or with --json one JSON line on stdout
+// as it arrives.
+func (f *follower) show(b *BlockReport) {
+	if f.client.ui.json {
+		if !f.full {
+			b.Transactions = nil
+		}
+		line, err := json.Marshal(b)
+		if err != nil {
+			f.client.ui.Warnf("warning: encode block %d: %v\n", b.Number, err)
+		} else {
+			fmt.Fprintln(f.client.ui.out, string(line))
+		}
+	} else {
+		printBlock(b, f.full)
+	}
+	if f.seen == 0 {
+		f.first = b.Number
+	}
+	f.seen++
+	if b.baseFee != nil {
+		f.feeSum.Add(f.feeSum, b.baseFee)
+		f.feeSeen++
+	}
+}
+
+// catchUp prints every block from f.next up to head, so a reconnect or a
+// slow poll leaves no gap. Blocks a reorg replaces are not shown again.
+func (f *follower) catchUp(ctx context.Context, head uint64) error {
+	for f.next != nil && f.next.Uint64() <= head {
+		b, err := fetchBlock(ctx, f.client, f.next.Uint64())
+		if err != nil {
+			return err
+		}
+		f.show(b)
+		f.next = new(big.Int).SetUint64(b.Number + 1)
+	}
+	return nil
+}
+
+// start begins at the current head the first time, so the latest block
+// is shown straight away, and reports where the stream picks up.
+func (f *follower) start(ctx context.Context) (uint64, error) {
+	head, err := f.client.BlockNumber(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("block number: %w", err)
+	}
+	if f.next == nil {
+		f.next = new(big.Int).SetUint64(head)
+	}
+	return head, nil
+}
+
+// stream subscribes to new heads, catches up on anything since f.next and
+// then prints each block as it is announced, until the subscription fails
+// or ctx is done.
+func (f *follower) stream(ctx context.Context) error {
+	heads := make(chan *types.Header, 16)
+	sub, err := f.client.SubscribeNewHead(ctx, heads)
+	if err != nil {
+		return fmt.Errorf("subscribe: %w", err)
+	}
+	defer sub.Unsubscribe()
+	head, err := f.start(ctx)
+	if err != nil {
+		return err
+	}
+	f.client.ui.Printf("Following from block %s\n", f.next)
+	if err := f.catchUp(ctx, head); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.Err():
+			return fmt.Errorf("subscription: %w", err)
+		case h := <-heads:
+			if err := f.catchUp(ctx, h.Number.Uint64()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// poll stands in for stream on endpoints that cannot push heads: it asks
+// for the block number every interval.
+func (f *follower) poll(ctx context.Context, interval time.Duration) error {
+	head, err := f.start(ctx)
+	if err != nil {
+		return err
+	}
+	f.client.ui.Printf("Following from block %s, polling every %s\n", f.next, interval)
+	for {
+		if err := f.catchUp(ctx, head); err != nil {
+			return err
+		}
+		if err := sleep(ctx, interval); err != nil {
+			return err
+		}
+		if head, err = f.client.BlockNumber(ctx); err != nil {
+			return fmt.Errorf("block number: %w", err)
+		}
+	}
+}
+
+// summary is what f saw, for the report and the closing line.
+func (f *follower) summary() *BlocksSummary {
+	s := &BlocksSummary{Seen: f.seen}
+	if f.seen > 0 {
+		s.First, s.Last = f.first, f.next.Uint64()-1
+	}
+	if f.feeSeen > 0 {
+		s.AverageBaseFee = new(big.Int).Div(f.feeSum, big.NewInt(int64(f.feeSeen))).String()
+	}
+	return s
+}
+
+// runBlocks implements `blocks [--follow] [--full] [--count N]`: print
+// the latest blocks, or with --follow each new one until interrupted.
+func runBlocks(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("blocks", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	follow := fs.Bool("follow", false, "print each new block as it arrives until interrupted")
+	full := fs.Bool("full", false, "also list each block's transaction hashes")
+	count := fs.Uint64("count", 1, "without --follow, how many of the latest blocks to print")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: blocks [flags]")
+	}
+	if *count == 0 {
+		return errors.New("--count must be positive")
+	}
+
+	if !*follow {
+		client, _, err := connect(ctx, &o)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		head, err := client.BlockNumber(ctx)
+		if err != nil {
+			return fmt.Errorf("block number: %w", err)
+		}
+		from := head - min(*count-1, head)
+		for n := from; n <= head; n++ {
+			b, err := fetchBlock(ctx, client, n)
+			if err != nil {
+				return err
+			}
+			printBlock(b, *full)
+			if !*full {
+				b.Transactions = nil
+			}
+			ui.report.Blocks = append(ui.report.Blocks, *b)
+		}
+		return nil
+	}
+
+	push, err := pushEndpoints(&o, "new heads", "eth_blockNumber")
+	if err != nil {
+		return err
+	}
+	client, _, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// As with watch, a dropped connection is redialed and followed again
+	// from the first block not yet printed, with backoff while the node
+	// stays away.
+	f := &follower{client: client, full: *full, feeSum: new(big.Int)}
+	for attempt := 1; ; attempt++ {
+		seen := f.seen
+		if push {
+			err = f.stream(ctx)
+		} else {
+			err = f.poll(ctx, o.pollInterval)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if f.seen != seen {
+			attempt = 1
+		}
+		delay := o.retry.backoff(attempt)
+		resume := "the head"
+		if f.next != nil {
+			resume = "block " + f.next.String()
+		}
+		ui.Warnf("blocks: %v; following again from %s in %s\n", err, resume, delay)
+		if sleep(ctx, delay) != nil {
+			break
+		}
+		if push {
+			if err := client.reconnect(ctx); err != nil {
+				ui.Warnf("blocks: reconnect: %v\n", err)
+			}
+		}
+	}
+
+	s := f.summary()
+	ui.report.BlocksSeen = s
+	fee := "-"
+	if s.AverageBaseFee != "" {
+		avg, _ := new(big.Int).SetString(s.AverageBaseFee, 10)
+		fee = formatUnits(avg, 9) + " gwei"
+	}
+	if s.Seen > 0 {
+		ui.Printf("Stopped after %d blocks (%d-%d), average base fee %s\n", s.Seen, s.First, s.Last, fee)
+	} else {
+		ui.Println("Stopped before any block was seen")
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// broadcastScript is the script name runs are filed under in the
+// broadcast directory, where forge script uses the script's file name.
+const broadcastScript = "go-deploy"
+
+// forgeRun is a run in the format of forge script's
+// broadcast/<script>/<chainid>/run-*.json, so tools reading those files
+// work on this tool's runs too. Timestamp is in milliseconds.
+type forgeRun struct {
+	Transactions []forgeTx                  `json:"transactions"`
+	Receipts     []json.RawMessage          `json:"receipts"`
+	Libraries    []string                   `json:"libraries"`
+	Pending      []common.Hash              `json:"pending"`
+	Returns      map[string]json.RawMessage `json:"returns"`
+	Timestamp    int64                      `json:"timestamp"`
+	Chain        uint64                     `json:"chain"`
+	Commit       *string                    `json:"commit"`
+}
+
+// forgeTx is one transaction of a forgeRun. TransactionType is forge's
+// CREATE, CREATE2 or CALL.
+type forgeTx struct {
+	Hash                common.Hash       `json:"hash"`
+	TransactionType     string            `json:"transactionType"`
+	ContractName        *string           `json:"contractName"`
+	ContractAddress     *string           `json:"contractAddress"`
+	Function            *string           `json:"function"`
+	Arguments           []string          `json:"arguments"`
+	Transaction         forgeTxRequest    `json:"transaction"`
+	AdditionalContracts []json.RawMessage `json:"additionalContracts"`
+	IsFixedGasLimit     bool              `json:"isFixedGasLimit"`
+}
+
+// forgeTxRequest is the transaction as it was signed. Addresses are
+// checksummed, as forge writes them.
+type forgeTxRequest struct {
+	Type                 hexutil.Uint64 `json:"type"`
+	From                 string         `json:"from"`
+	To                   *string        `json:"to"`
+	Gas                  hexutil.Uint64 `json:"gas"`
+	GasPrice             *hexutil.Big   `json:"gasPrice,omitempty"`
+	MaxFeePerGas         *hexutil.Big   `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *hexutil.Big   `json:"maxPriorityFeePerGas,omitempty"`
+	Value                *hexutil.Big   `json:"value"`
+	Input                hexutil.Bytes  `json:"input"`
+	Nonce                hexutil.Uint64 `json:"nonce"`
+	ChainID              *hexutil.Big   `json:"chainId"`
+}
+
+// broadcastLog collects a session's sent transactions, and their
+// receipts once mined, for its broadcast file.
+type broadcastLog struct {
+	dir     string
+	entries []*broadcastEntry
+}
+
+type broadcastEntry struct {
+	sum  txSummary
+	tx   *types.Transaction
+	rcpt *types.Receipt
+}
+
+// noteSent records tx, which sum describes, for the gas report and the
+// broadcast file.
+func (s *session) noteSent(tx *types.Transaction, sum txSummary) {
+	s.gasLog.labels[tx.Nonce()] = gasLabel(sum.call)
+	s.broadcast.entries = append(s.broadcast.entries, &broadcastEntry{sum: sum, tx: tx})
+}
+
+// recordBroadcast attaches rcpt to the sent transaction at tx's nonce.
+// A fee bump mines a replacement, which is read from the node so the
+// file shows what was mined.
+func (s *session) recordBroadcast(ctx context.Context, tx *types.Transaction, rcpt *types.Receipt) {
+	l := s.broadcast
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		e := l.entries[i]
+		if e.rcpt != nil || e.tx.Nonce() != tx.Nonce() {
+			continue
+		}
+		e.rcpt = rcpt
+		if e.tx.Hash() == rcpt.TxHash {
+			return
+		}
+		if tx.Hash() == rcpt.TxHash {
+			e.tx = tx
+		} else if mined, _, err := s.client.TransactionByHash(ctx, rcpt.TxHash); err == nil {
+			e.tx = mined
+		}
+		return
+	}
+}
+
+// writeBroadcast writes the session's transactions to
+// <dir>/go-deploy/<chainid>/run-<timestamp>.json and run-latest.json.
+// Sessions that sent nothing write no file.
+func (s *session) writeBroadcast() {
+	l := s.broadcast
+	if l == nil || l.dir == "" || len(l.entries) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	run := forgeRun{
+		Transactions: []forgeTx{},
+		Receipts:     []json.RawMessage{},
+		Libraries:    []string{},
+		Pending:      []common.Hash{},
+		Returns:      map[string]json.RawMessage{},
+		Timestamp:    time.Now().UnixMilli(),
+		Chain:        s.chainID.Uint64(),
+	}
+	created := map[common.Address]string{}
+	for _, e := range l.entries {
+		t := s.forgeTx(e, created)
+		run.Transactions = append(run.Transactions, t)
+		if e.rcpt == nil {
+			run.Pending = append(run.Pending, t.Hash)
+			continue
+		}
+		raw, err := s.client.rawReceipt(ctx, e.rcpt.TxHash)
+		if err != nil {
+			s.ui.Warnf("warning: broadcast file: receipt %s: %v\n", e.rcpt.TxHash.Hex(), err)
+			if raw, err = json.Marshal(e.rcpt); err != nil {
+				continue
+			}
+		}
+		run.Receipts = append(run.Receipts, raw)
+	}
+	dir := filepath.Join(l.dir, broadcastScript, s.chainID.String())
+	path := filepath.Join(dir, fmt.Sprintf("run-%d.json", run.Timestamp))
+	for _, p := range []string{path, filepath.Join(dir, "run-latest.json")} {
+		if err := writeJSON(p, run); err != nil {
+			s.ui.Warnf("warning: write broadcast file: %v\n", err)
+			return
+		}
+	}
+	s.ui.Printf("Broadcast written to %s\n", path)
+}
+
+// forgeTx describes e as forge would. Calls are named after the contract
+// at their address when this run deployed it; created collects those.
+func (s *session) forgeTx(e *broadcastEntry, created map[common.Address]string) forgeTx {
+	tx := e.tx
+	t := forgeTx{
+		Hash:                tx.Hash(),
+		TransactionType:     "CALL",
+		AdditionalContracts: []json.RawMessage{},
+		Transaction: forgeTxRequest{
+			Type:    hexutil.Uint64(tx.Type()),
+			From:    s.from.Hex(),
+			Gas:     hexutil.Uint64(tx.Gas()),
+			Value:   (*hexutil.Big)(tx.Value()),
+			Input:   tx.Data(),
+			Nonce:   hexutil.Uint64(tx.Nonce()),
+			ChainID: (*hexutil.Big)(s.chainID),
+		},
+	}
+	if to := tx.To(); to != nil {
+		hex := to.Hex()
+		t.Transaction.To = &hex
+	}
+	if tx.Type() == types.LegacyTxType || tx.Type() == types.AccessListTxType {
+		t.Transaction.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	} else {
+		t.Transaction.MaxFeePerGas = (*hexutil.Big)(tx.GasFeeCap())
+		t.Transaction.MaxPriorityFeePerGas = (*hexutil.Big)(tx.GasTipCap())
+	}
+	if len(e.sum.args) > 0 {
+		t.Arguments = e.sum.args
+	}
+	if e.sum.fn != "" {
+		t.Function = &e.sum.fn
+	}
+	var address common.Address
+	switch {
+	case tx.To() == nil:
+		t.TransactionType = "CREATE"
+		address = crypto.CreateAddress(s.from, tx.Nonce())
+	case e.sum.created != nil:
+		t.TransactionType = "CREATE2"
+		address = *e.sum.created
+	default:
+		address = *tx.To()
+		if name, ok := created[address]; ok {
+			t.ContractName = &name
+		}
+	}
+	hex := address.Hex()
+	t.ContractAddress = &hex
+	if t.TransactionType != "CALL" && e.sum.contract != "" {
+		name := e.sum.contract
+		t.ContractName = &name
+		created[address] = name
+	}
+	return t
+}
+
+// rawReceipt is the receipt of hash as the node returns it, with the
+// fields go-ethereum's receipt type drops, such as from and to.
+func (c *rpcClient) rawReceipt(ctx context.Context, hash common.Hash) (json.RawMessage, error) {
+	raw, err := pinned(ctx, c, "eth_getTransactionReceipt", func(ctx context.Context, cl *ethclient.Client) (json.RawMessage, error) {
+		var r json.RawMessage
+		err := cl.Client().CallContext(ctx, &r, "eth_getTransactionReceipt", hash)
+		return r, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, errors.New("not found")
+	}
+	return raw, nil
+}
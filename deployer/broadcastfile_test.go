@@ -0,0 +1,102 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestBroadcastFile deploys the greeter and calls setGreeting, and
+// checks the run-latest.json Close writes has the fields of
+// testdata/broadcast/run-latest.json, a forge script run of a Counter
+// deployment and a setNumber call, with the same JSON types. Receipts
+// come from the node, so theirs need only include forge's fields.
+func TestBroadcastFile(t *testing.T) {
+	var forge, ours map[string]interface{}
+	readJSON(t, "testdata/broadcast/run-latest.json", &forge)
+	chain := newSimChain(t)
+	chain.autoCommit(t)
+	isolate(t)
+	dir := t.TempDir()
+	// Not chain.dial, whose cleanup would close the client again.
+	c, err := Dial(context.Background(), Config{RPC: []string{chain.rpc}, PrivateKey: testKey, BroadcastDir: dir, Output: io.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	art := greeter(t)
+	d, err := c.Deploy(t.Context(), art, "gm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Send(t.Context(), art, d.Address, "setGreeting", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	readJSON(t, filepath.Join(dir, "go-deploy", "1337", "run-latest.json"), &ours)
+	for _, diff := range shapeDiff("", forge, ours) {
+		t.Error(diff)
+	}
+	for i, want := range []string{"CREATE", "CALL"} {
+		tx := ours["transactions"].([]interface{})[i].(map[string]interface{})
+		if tx["transactionType"] != want {
+			t.Errorf("transactions[%d].transactionType = %v, want %s", i, tx["transactionType"], want)
+		}
+	}
+}
+
+func readJSON(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+}
+
+// shapeDiff lists where got, decoded JSON, differs from want in its
+// fields or their types. null matches any type, as forge writes null for
+// absent optional values; arrays are compared element by element as far
+// as both go.
+func shapeDiff(path string, want, got interface{}) []string {
+	if want == nil || got == nil {
+		return nil
+	}
+	if fmt.Sprintf("%T", want) != fmt.Sprintf("%T", got) {
+		return []string{fmt.Sprintf("%s: %T, want %T", path, got, want)}
+	}
+	var diffs []string
+	switch want := want.(type) {
+	case map[string]interface{}:
+		got := got.(map[string]interface{})
+		for k, v := range want {
+			if _, ok := got[k]; !ok {
+				diffs = append(diffs, fmt.Sprintf("%s.%s: missing", path, k))
+				continue
+			}
+			diffs = append(diffs, shapeDiff(path+"."+k, v, got[k])...)
+		}
+		if !strings.HasPrefix(path, ".receipts") {
+			for k := range got {
+				if _, ok := want[k]; !ok {
+					diffs = append(diffs, fmt.Sprintf("%s.%s: not in forge's file", path, k))
+				}
+			}
+		}
+	case []interface{}:
+		got := got.([]interface{})
+		for i := range min(len(want), len(got)) {
+			diffs = append(diffs, shapeDiff(fmt.Sprintf("%s[%d]", path, i), want[i], got[i])...)
+		}
+	}
+	slices.Sort(diffs)
+	return diffs
+}
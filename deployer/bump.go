@@ -0,0 +1,345 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
+)
+
+// minBumpPercent is the fee increase nodes require before they accept a
+// replacement for a pending transaction.
+const minBumpPercent = 10
+
+// bumpPolicy controls replacing transactions that stay pending.
+type bumpPolicy struct {
+	after    time.Duration
+	maxBumps int
+	percent  uint64
+}
+
+func (p *bumpPolicy) register(fs *flag.FlagSet) {
+	fs.DurationVar(&p.after, "bump-after", 0, "resend a still-pending transaction with higher fees after this long (0 disables)")
+	fs.IntVar(&p.maxBumps, "max-bumps", 3, "fee bumps per transaction before waiting as is")
+	fs.Uint64Var(&p.percent, "bump-percent", minBumpPercent, "fee increase per bump, in percent (at least 10)")
+}
+
+func (p bumpPolicy) check() error {
+	if p.percent < minBumpPercent {
+		return fmt.Errorf("--bump-percent %d is below the %d%% replacement minimum", p.percent, minBumpPercent)
+	}
+	return nil
+}
+
+// bumped is v raised by percent, rounded up.
+func bumped(v *big.Int, percent uint64) *big.Int {
+	if v == nil {
+		return nil
+	}
+	out := new(big.Int).Mul(v, new(big.Int).SetUint64(100+percent))
+	out.Add(out, big.NewInt(99))
+	return out.Div(out, big.NewInt(100))
+}
+
+// maxBig returns the larger of a and b; nil counts as absent.
+func maxBig(a, b *big.Int) *big.Int {
+	if a == nil || (b != nil && b.Cmp(a) > 0) {
+		return b
+	}
+	return a
+}
+
+// bumpFees raises the fees on auth by percent over prev's, or to the
+// current market price if that is higher still.
+func (s *session) bumpFees(ctx context.Context, auth *bind.TransactOpts, prev *types.Transaction, percent uint64) error {
+	if err := applyFees(ctx, s.client, auth, s.fees); err != nil {
+		return fmt.Errorf("fees: %w", err)
+	}
+	if auth.GasPrice != nil || prev.Type() == types.LegacyTxType || prev.Type() == types.AccessListTxType {
+		auth.GasPrice = maxBig(auth.GasPrice, bumped(prev.GasPrice(), percent))
+		auth.GasFeeCap, auth.GasTipCap = nil, nil
+		return nil
+	}
+	auth.GasTipCap = maxBig(auth.GasTipCap, bumped(prev.GasTipCap(), percent))
+	auth.GasFeeCap = maxBig(auth.GasFeeCap, bumped(prev.GasFeeCap(), percent))
+	auth.GasFeeCap = maxBig(auth.GasFeeCap, auth.GasTipCap)
+	return nil
+}
+
+// replace re-signs prev at the same nonce with bumped fees and sends it.
+func (s *session) replace(ctx context.Context, prev *types.Transaction) (*types.Transaction, error) {
+	tx, err := s.resign(ctx, prev)
+	if err != nil {
+		return nil, err
+	}
+	sctx, cancel := context.WithTimeout(ctx, txTimeout)
+	defer cancel()
+	if err := s.client.SendTransaction(sctx, tx); err != nil {
+		return nil, err
+	}
+	if s.journal != nil {
+		s.journal.replaced(prev, tx)
+	}
+	return tx, nil
+}
+
+// resign signs a copy of prev, at the same nonce, whose fees are bumped
+// by --bump-percent or raised to the market price, whichever is higher.
+func (s *session) resign(ctx context.Context, prev *types.Transaction) (*types.Transaction, error) {
+	auth := *s.auth
+	percent := s.bump.percent
+	if prev.Type() == types.BlobTxType && percent < 100 {
+		percent = 100 // the blob pool only replaces at double the fees
+	}
+	if err := s.bumpFees(ctx, &auth, prev, percent); err != nil {
+		return nil, err
+	}
+	var inner types.TxData
+	switch {
+	case prev.Type() == types.BlobTxType:
+		inner = &types.BlobTx{
+			ChainID:    uint256.MustFromBig(s.chainID),
+			Nonce:      prev.Nonce(),
+			GasTipCap:  uint256.MustFromBig(auth.GasTipCap),
+			GasFeeCap:  uint256.MustFromBig(auth.GasFeeCap),
+			Gas:        prev.Gas(),
+			To:         *prev.To(),
+			Value:      uint256.MustFromBig(prev.Value()),
+			Data:       prev.Data(),
+			AccessList: prev.AccessList(),
+			BlobFeeCap: uint256.MustFromBig(bumped(prev.BlobGasFeeCap(), percent)),
+			BlobHashes: prev.BlobHashes(),
+			Sidecar:    prev.BlobTxSidecar(),
+		}
+	case auth.GasPrice != nil && prev.Type() == types.AccessListTxType:
+		inner = &types.AccessListTx{
+			ChainID:    s.chainID,
+			Nonce:      prev.Nonce(),
+			GasPrice:   auth.GasPrice,
+			Gas:        prev.Gas(),
+			To:         prev.To(),
+			Value:      prev.Value(),
+			Data:       prev.Data(),
+			AccessList: prev.AccessList(),
+		}
+	case auth.GasPrice != nil:
+		inner = &types.LegacyTx{
+			Nonce:    prev.Nonce(),
+			GasPrice: auth.GasPrice,
+			Gas:      prev.Gas(),
+			To:       prev.To(),
+			Value:    prev.Value(),
+			Data:     prev.Data(),
+		}
+	default:
+		inner = &types.DynamicFeeTx{
+			ChainID:    s.chainID,
+			Nonce:      prev.Nonce(),
+			GasTipCap:  auth.GasTipCap,
+			GasFeeCap:  auth.GasFeeCap,
+			Gas:        prev.Gas(),
+			To:         prev.To(),
+			Value:      prev.Value(),
+			Data:       prev.Data(),
+			AccessList: prev.AccessList(),
+		}
+	}
+	tx, err := auth.Signer(s.from, types.NewTx(inner))
+	if err != nil {
+		return nil, fmt.Errorf("sign replacement: %w", err)
+	}
+	return tx, nil
+}
+
+// stalledHook returns the callback WaitForReceipt uses to replace tx once
+// it has been pending for --bump-after, up to --max-bumps times. A
+// replacement the node rejects is reported and the wait goes on; the
+// pending hashes may still be mined.
+func (s *session) stalledHook(ctx context.Context, tx *types.Transaction) func() (*types.Transaction, error) {
+	if s.bump.after <= 0 || s.bump.maxBumps <= 0 {
+		return nil
+	}
+	last, since, bumps := tx, time.Now(), 0
+	return func() (*types.Transaction, error) {
+		if bumps >= s.bump.maxBumps || time.Since(since) < s.bump.after {
+			return nil, nil
+		}
+		bumps++
+		since = time.Now()
+		next, err := s.replace(ctx, last)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			s.ui.Warnf("  bump %d/%d of tx %s failed: %v\n", bumps, s.bump.maxBumps, last.Hash().Hex(), err)
+			return nil, nil
+		}
+		s.ui.Printf("  tx %s still pending, replaced by %s (bump %d/%d, %s)\n", last.Hash().Hex(), next.Hash().Hex(), bumps, s.bump.maxBumps, describeTxFees(next))
+		s.ui.link("tx", next.Hash().Hex())
+		last = next
+		return next, nil
+	}
+}
+
+// describeTxFees renders the pricing of a signed transaction.
+func describeTxFees(tx *types.Transaction) string {
+	if tx.Type() == types.LegacyTxType || tx.Type() == types.AccessListTxType {
+		return fmt.Sprintf("gasPrice=%s wei", tx.GasPrice())
+	}
+	return fmt.Sprintf("maxFee=%s wei priorityFee=%s wei", tx.GasFeeCap(), tx.GasTipCap())
+}
+
+// runCancel implements `cancel --nonce N`: a zero-value transfer to self
+// at nonce N that replaces whatever is pending there. Its fees are
+// --bump-percent over the pending transaction's, as a fee bump's are, and
+// at least the market's; with nothing found pending they are that much
+// over the market.
+func runCancel(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("cancel", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	nonce := fs.Int64("nonce", -1, "nonce of the pending transaction to cancel")
+	noWait := fs.Bool("no-wait", false, "print the transaction hash and exit without waiting")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if *nonce < 0 {
+		return errors.New("usage: cancel --nonce N [flags]")
+	}
+
+	s, err := openSession(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	auth := *s.auth
+	prev := s.pendingAt(ctx, uint64(*nonce))
+	if prev != nil {
+		ui.Printf("Replacing tx %s (%s)\n", prev.Hash().Hex(), describeTxFees(prev))
+		if err := s.bumpFees(ctx, &auth, prev, s.bump.percent); err != nil {
+			return err
+		}
+	} else {
+		ui.Warnf("warning: no pending transaction found at nonce %d; pricing the cancel %d%% over the market\n", *nonce, s.bump.percent)
+		if err := applyFees(ctx, s.client, &auth, s.fees); err != nil {
+			return fmt.Errorf("fees: %w", err)
+		}
+		auth.GasFeeCap = bumped(auth.GasFeeCap, s.bump.percent)
+		auth.GasTipCap = bumped(auth.GasTipCap, s.bump.percent)
+		auth.GasPrice = bumped(auth.GasPrice, s.bump.percent)
+	}
+	auth.Nonce = big.NewInt(*nonce)
+	auth.GasLimit = params.TxGas
+	ui.Println("Fees:", describeFees(&auth))
+	s.pendingL1Fee = s.estimateL1Fee(ctx, &auth, ethereum.CallMsg{To: &s.from})
+
+	sum := txSummary{to: &s.from, call: fmt.Sprintf("cancel nonce %d (empty transfer to self)", *nonce)}
+	tx, err := s.submit(ctx, &auth, sum, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		tx, err := opts.Signer(s.from, newSelfTransfer(s, opts))
+		if err != nil {
+			return nil, err
+		}
+		return tx, s.client.SendTransaction(opts.Context, tx)
+	})
+	if err != nil {
+		return fmt.Errorf("cancel nonce %d: %w", *nonce, err)
+	}
+	ui.Printf("Cancel tx: %s (nonce %d)\n", tx.Hash().Hex(), tx.Nonce())
+	ui.link("tx", tx.Hash().Hex())
+	if *noWait {
+		return nil
+	}
+	rcpt, err := s.waitMined(ctx, tx)
+	if err != nil {
+		return err
+	}
+	ui.Printf("  status %d, block %s, gas used %d\n", rcpt.Status, rcpt.BlockNumber, rcpt.GasUsed)
+	ui.report.Transactions = append(ui.report.Transactions, *newTxReport("cancel", rcpt, nil))
+	return nil
+}
+
+// pendingAt finds the transaction the signer has pending at nonce: in
+// the pinned node's pool if it answers txpool_contentFrom, else in the
+// journal, which has what this tool sent. It returns nil if neither has
+// one.
+func (s *session) pendingAt(ctx context.Context, nonce uint64) *types.Transaction {
+	tx, err := s.client.poolTx(ctx, s.from, nonce)
+	if err == nil {
+		return tx
+	}
+	s.ui.Verbosef("txpool_contentFrom: %v; looking in the journal\n", err)
+	if s.journal == nil {
+		return nil
+	}
+	f, err := s.journal.read()
+	if err != nil {
+		s.ui.Warnf("warning: %v\n", err)
+		return nil
+	}
+	for i := len(f.Entries) - 1; i >= 0; i-- {
+		e := f.Entries[i]
+		if e.From != s.from || e.Nonce != nonce || e.Status != journalPending {
+			continue
+		}
+		raw, err := hexutil.Decode(e.Raw)
+		if err != nil {
+			continue
+		}
+		tx := new(types.Transaction)
+		if tx.UnmarshalBinary(raw) == nil {
+			return tx
+		}
+	}
+	return nil
+}
+
+// poolTx is the transaction from has pending or queued at nonce in the
+// pinned node's pool, or nil if there is none.
+func (c *rpcClient) poolTx(ctx context.Context, from common.Address, nonce uint64) (*types.Transaction, error) {
+	type content map[string]map[string]*types.Transaction
+	pool, err := pinned(ctx, c, "txpool_contentFrom", func(ctx context.Context, cl *ethclient.Client) (content, error) {
+		var pool content
+		err := cl.Client().CallContext(ctx, &pool, "txpool_contentFrom", from)
+		return pool, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	key := strconv.FormatUint(nonce, 10)
+	for _, sub := range []string{"pending", "queued"} {
+		if tx := pool[sub][key]; tx != nil {
+			return tx, nil
+		}
+	}
+	return nil, nil
+}
+
+// newSelfTransfer builds an unsigned zero-value transfer from the signer
+// to itself with the nonce, gas and fees set on opts.
+func newSelfTransfer(s *session, opts *bind.TransactOpts) *types.Transaction {
+	to := s.from
+	if opts.GasPrice != nil {
+		return types.NewTx(&types.LegacyTx{Nonce: opts.Nonce.Uint64(), GasPrice: opts.GasPrice, Gas: opts.GasLimit, To: &to})
+	}
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   s.chainID,
+		Nonce:     opts.Nonce.Uint64(),
+		GasTipCap: opts.GasTipCap,
+		GasFeeCap: opts.GasFeeCap,
+		Gas:       opts.GasLimit,
+		To:        &to,
+	})
+}
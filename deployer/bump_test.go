@@ -0,0 +1,53 @@
+package deployer
+
+import (
+	"math/big"
+	"testing"
+)
+
+// TestCancelReplacesPending has cancel replace a transfer priced well
+// over the market: its caps must clear the transfer's by 10%, not the
+// market's.
+func TestCancelReplacesPending(t *testing.T) {
+	chain := newSimChain(t)
+	isolate(t)
+	t.Setenv("PRIVATE_KEY", testKey)
+	stuck := sendTransfer(t, chain, 0)
+
+	if _, err := results(t, runCancel, "--rpc", chain.rpc, "--nonce", "0", "--no-wait", "--yes"); err != nil {
+		t.Fatal(err)
+	}
+	chain.Commit()
+	block, err := chain.Client().BlockByNumber(t.Context(), big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(block.Transactions()) != 1 {
+		t.Fatalf("block 1 has %d transactions, want the cancel", len(block.Transactions()))
+	}
+	cancel := block.Transactions()[0]
+	if cancel.Hash() == stuck.Hash() || cancel.Nonce() != 0 || cancel.Value().Sign() != 0 || *cancel.To() != testAddr {
+		t.Fatalf("mined %s (nonce %d, value %s), want a zero-value self-transfer at nonce 0", cancel.Hash().Hex(), cancel.Nonce(), cancel.Value())
+	}
+	if want := bumped(stuck.GasFeeCap(), minBumpPercent); cancel.GasFeeCap().Cmp(want) < 0 {
+		t.Errorf("cancel fee cap %s, want at least %s", cancel.GasFeeCap(), want)
+	}
+	if want := bumped(stuck.GasTipCap(), minBumpPercent); cancel.GasTipCap().Cmp(want) < 0 {
+		t.Errorf("cancel tip cap %s, want at least %s", cancel.GasTipCap(), want)
+	}
+}
+
+// TestCancelNothingPending prices a cancel over the market when no
+// transaction is pending at the nonce.
+func TestCancelNothingPending(t *testing.T) {
+	chain := newSimChain(t)
+	isolate(t)
+	t.Setenv("PRIVATE_KEY", testKey)
+	if _, err := results(t, runCancel, "--rpc", chain.rpc, "--nonce", "0", "--no-wait", "--yes"); err != nil {
+		t.Fatal(err)
+	}
+	chain.Commit()
+	if n, err := chain.Client().NonceAt(t.Context(), testAddr, nil); err != nil || n != 1 {
+		t.Fatalf("nonce after cancel = %d, %v; want 1", n, err)
+	}
+}
@@ -0,0 +1,267 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// bundleTx is a plan step signed for a bundle but not sent.
+type bundleTx struct {
+	st      *planStep
+	kind    string
+	label   string // method signature, or "constructor"
+	c       *Artifact
+	args    []interface{}  // constructor arguments, for the manifest
+	address common.Address // the contract a deploy creates
+	tx      *types.Transaction
+}
+
+// prepare signs st at the next nonce without sending it. Nothing before
+// it in the bundle has run yet, so its gas is estimated against the
+// current state; steps that depend on earlier ones need gas_limit.
+func (r *planRun) prepare(ctx context.Context, st *planStep) (*bundleTx, error) {
+	s := r.s
+	kind, ref, _ := st.kind()
+	if kind == "call" {
+		return nil, errors.New("call steps cannot be bundled; run them without --bundle")
+	}
+	txo, err := st.txOptions()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := r.args(st)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := s.opts(ctx, txo)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Nonce, err = r.s.nextNonce(ctx); err != nil {
+		return nil, err
+	}
+	opts.NoSend = true
+
+	b := &bundleTx{st: st, kind: kind}
+	var msg ethereum.CallMsg
+	var sum txSummary
+	var sign func(*bind.TransactOpts) (*types.Transaction, error)
+	if kind == "deploy" {
+		c, args, err := r.deployTarget(ref, st, raw)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.checkLinked(); err != nil {
+			return nil, fmt.Errorf("%w; deploy its libraries before bundling", err)
+		}
+		if err := checkPayable(c.Name+" constructor", &c.ABI.Constructor, txo); err != nil {
+			return nil, err
+		}
+		code, err := initCode(c, args)
+		if err != nil {
+			return nil, err
+		}
+		b.label, b.c, b.args = "constructor", c, args
+		b.address = crypto.CreateAddress(s.from, opts.Nonce.Uint64())
+		if err := r.checkPredicted(st, b.address); err != nil {
+			return nil, err
+		}
+		msg = ethereum.CallMsg{Data: code}
+		sum = constructorSummary(c, args)
+		sign = func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			_, tx, _, err := bind.DeployContract(opts, c.ABI, c.Bytecode, s.client, args...)
+			return tx, err
+		}
+	} else {
+		c, address, m, args, err := r.callTarget(ref, st, raw)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkPayable(m.Sig, m, txo); err != nil {
+			return nil, err
+		}
+		data, err := c.ABI.Pack(m.Name, args...)
+		if err != nil {
+			return nil, fmt.Errorf("encode %s: %w", m.Sig, err)
+		}
+		b.label, b.c = m.Sig, c
+		bound := bind.NewBoundContract(address, c.ABI, s.client, s.client, s.client)
+		msg = ethereum.CallMsg{To: &address, Data: data}
+		sum = methodSummary(address, m, args)
+		sign = func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return bound.Transact(opts, m.Name, args...)
+		}
+	}
+	if err := s.setGasLimit(ctx, opts, msg, &b.c.ABI); err != nil {
+		if st.GasLimit == 0 {
+			return nil, fmt.Errorf("%w (a step that depends on earlier bundled steps cannot be estimated; set gas_limit)", err)
+		}
+		return nil, err
+	}
+	if err := s.confirmSend(sum, opts); err != nil {
+		return nil, err
+	}
+	if b.tx, err = sign(opts); err != nil {
+		return nil, explainError(err, &b.c.ABI)
+	}
+	s.noteSent(b.tx, sum)
+	r.s.ui.Printf("Signed %s for the bundle: %s (nonce %d)\n", st.Name, b.tx.Hash().Hex(), b.tx.Nonce())
+	return b, nil
+}
+
+// bundle runs steps as one eth_sendBundle: signed at consecutive nonces,
+// submitted for the next block, and again for each block after until it
+// lands or blocks blocks pass. Then it is re-signed with refreshed fees
+// and the wait starts over, up to --max-bumps times. It returns each
+// step's outputs once every transaction is mined.
+func (r *planRun) bundle(ctx context.Context, rl *relay, steps []*planStep, blocks uint64) ([]map[string]string, error) {
+	s := r.s
+	defer s.nonces.Reset(s.from)
+	var txs []*bundleTx
+	for _, st := range steps {
+		r.s.ui.Printf("Bundle step %d/%d %s\n", len(txs)+1, len(steps), st.Name)
+		b, err := r.prepare(ctx, st)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %w", st.Name, err)
+		}
+		if b.kind == "deploy" {
+			r.outputs["deployments."+b.c.Name+".address"] = b.address.Hex()
+			r.outputs["steps."+st.Name+".address"] = b.address.Hex()
+		}
+		txs = append(txs, b)
+	}
+	first := txs[0].tx.Nonce()
+
+	report := &BundleReport{}
+	r.s.ui.report.Bundle = report
+	for refresh := 0; ; refresh++ {
+		signed := make([]*types.Transaction, len(txs))
+		for i, b := range txs {
+			signed[i] = b.tx
+		}
+		landed, err := r.submitBundle(ctx, rl, signed, first, blocks, report)
+		if err != nil {
+			return nil, err
+		}
+		if landed {
+			break
+		}
+		if refresh >= s.bump.maxBumps {
+			return nil, fmt.Errorf("bundle did not land in %d blocks, after %d fee refreshes; nothing was sent to the public mempool", report.Submissions, refresh)
+		}
+		for _, b := range txs {
+			if b.tx, err = s.resign(ctx, b.tx); err != nil {
+				return nil, fmt.Errorf("step %s: %w", b.st.Name, err)
+			}
+		}
+		r.s.ui.Printf("Bundle did not land in %d blocks; re-signed with refreshed fees, %s (refresh %d/%d)\n", blocks, describeTxFees(txs[0].tx), refresh+1, s.bump.maxBumps)
+	}
+
+	var outputs []map[string]string
+	for _, b := range txs {
+		rcpt, err := s.waitMined(ctx, b.tx)
+		if err != nil {
+			return nil, err
+		}
+		if rcpt.Status != 1 {
+			reason := failureReason(ctx, s.client, b.tx, rcpt, &b.c.ABI)
+			return nil, &RevertError{TxHash: b.tx.Hash(), Reason: reason, msg: fmt.Sprintf("step %s: tx %s reverted: %s", b.st.Name, b.tx.Hash().Hex(), reason)}
+		}
+		out := map[string]string{
+			"txHash":  rcpt.TxHash.Hex(),
+			"block":   rcpt.BlockNumber.String(),
+			"gasUsed": strconv.FormatUint(rcpt.GasUsed, 10),
+		}
+		r.s.ui.Printf("%s: tx %s, status %d, gas used %d\n", b.st.Name, rcpt.TxHash.Hex(), rcpt.Status, rcpt.GasUsed)
+		r.s.ui.link("tx", rcpt.TxHash.Hex())
+		if b.kind == "deploy" {
+			if err := s.checkCode(ctx, b.address, rcpt); err != nil {
+				return nil, fmt.Errorf("step %s: %w", b.st.Name, err)
+			}
+			s.reportDeploy(b.c, b.address, rcpt)
+			d, err := recordDeployment(r.dir, s.chainID, b.c, b.args, newDeployment(s.from, b.address, rcpt))
+			if err != nil {
+				return nil, err
+			}
+			r.s.ui.Printf("%s deployed at: %s; recorded v%d in %s\n", b.c.Name, b.address.Hex(), d.Version, manifestPath(r.dir, s.chainID, b.c.Name))
+			r.s.ui.link("address", b.address.Hex())
+			out = map[string]string{"address": b.address.Hex(), "txHash": out["txHash"], "block": out["block"]}
+			for k, v := range out {
+				r.outputs["deployments."+b.c.Name+"."+k] = v
+			}
+		} else {
+			r.s.ui.report.Transactions = append(r.s.ui.report.Transactions, *newTxReport(b.label, rcpt, printEvents(r.s.ui, rcpt, &b.c.ABI)))
+		}
+		outputs = append(outputs, out)
+	}
+	return outputs, nil
+}
+
+// submitBundle sends txs for each of the next blocks blocks in turn and
+// reports whether they landed. Bundles are all or nothing, so the first
+// transaction's receipt decides; first's nonce being used by anything
+// else means the bundle never can.
+func (r *planRun) submitBundle(ctx context.Context, rl *relay, txs []*types.Transaction, first, blocks uint64, report *BundleReport) (bool, error) {
+	s := r.s
+	for i := uint64(0); i < blocks; i++ {
+		head, err := s.client.BlockNumber(ctx)
+		if err != nil {
+			return false, fmt.Errorf("block number: %w", err)
+		}
+		target := head + 1
+		hash, err := rl.sendBundle(ctx, txs, target)
+		if err != nil {
+			return false, err
+		}
+		report.Hash, report.Submissions = hash, report.Submissions+1
+		r.s.ui.Printf("Bundle %s (%d txs) submitted for block %d\n", hash, len(txs), target)
+		if err := r.waitBlock(ctx, target); err != nil {
+			return false, err
+		}
+		rcpt, err := s.client.TransactionReceipt(ctx, txs[0].Hash())
+		if err == nil {
+			report.Landed, report.Block = true, rcpt.BlockNumber.Uint64()
+			r.s.ui.Printf("Bundle landed in block %s\n", rcpt.BlockNumber)
+			return true, nil
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return false, fmt.Errorf("receipt %s: %w", txs[0].Hash().Hex(), err)
+		}
+		nonce, err := s.client.NonceAt(ctx, s.from, nil)
+		if err != nil {
+			return false, fmt.Errorf("nonce: %w", err)
+		}
+		if nonce > first {
+			return false, fmt.Errorf("nonce %d of %s was used outside the bundle, which can no longer land", first, s.from.Hex())
+		}
+		r.s.ui.Verbosef("  bundle not in block %d\n", target)
+	}
+	return false, nil
+}
+
+// waitBlock polls until the node's head reaches block.
+func (r *planRun) waitBlock(ctx context.Context, block uint64) error {
+	for {
+		head, err := r.s.client.BlockNumber(ctx)
+		if err != nil {
+			return fmt.Errorf("block number: %w", err)
+		}
+		if head >= block {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.s.pollInterval):
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// stripMetadata removes the CBOR-encoded compiler metadata solc appends to
+// runtime code. The last two bytes hold the big-endian length of the CBOR
+// blob, which always starts with a map header.
+func stripMetadata(code []byte) []byte {
+	if len(code) < 2 {
+		return code
+	}
+	n := int(code[len(code)-2])<<8 | int(code[len(code)-1])
+	start := len(code) - 2 - n
+	if n == 0 || start < 0 || code[start]&0xe0 != 0xa0 {
+		return code
+	}
+	return code[:start]
+}
+
+// maskRanges returns a copy of code with the given ranges zeroed.
+func maskRanges(code []byte, ranges []byteRange) []byte {
+	out := bytes.Clone(code)
+	for _, r := range ranges {
+		for i := r.Start; i < r.Start+r.Length && i < len(out); i++ {
+			out[i] = 0
+		}
+	}
+	return out
+}
+
+// normalizeRuntime is code as compareRuntime compares it: with c's
+// immutables and library addresses zeroed and the metadata hash removed.
+func normalizeRuntime(code []byte, c *Artifact) []byte {
+	masked := append(append([]byteRange{}, c.Immutables...), c.RuntimeLinks...)
+	return stripMetadata(maskRanges(code, masked))
+}
+
+// compareRuntime compares on-chain code against the artifact's runtime
+// code, ignoring immutables, library addresses and the metadata hash. It
+// returns the first differing offset, or -1 on a match.
+func compareRuntime(onchain []byte, c *Artifact) int {
+	got := normalizeRuntime(onchain, c)
+	want := normalizeRuntime(c.DeployedBytecode, c)
+	n := min(len(got), len(want))
+	for i := 0; i < n; i++ {
+		if got[i] != want[i] {
+			return i
+		}
+	}
+	if len(got) != len(want) {
+		return n
+	}
+	return -1
+}
+
+// codeWindow is the hex of code a few bytes either side of off, with the
+// byte at off in brackets, or [end] when code stops there.
+func codeWindow(code []byte, off int) string {
+	const span = 8
+	from := max(off-span, 0)
+	if off >= len(code) {
+		return hex.EncodeToString(code[min(from, len(code)):]) + "[end]"
+	}
+	to := min(off+span+1, len(code))
+	return hex.EncodeToString(code[from:off]) + "[" + hex.EncodeToString(code[off:off+1]) + "]" + hex.EncodeToString(code[off+1:to])
+}
+
+// checkBytecode compares code, read from address, with c's runtime code.
+// c must have deployedBytecode.
+func checkBytecode(address common.Address, code []byte, c *Artifact) *BytecodeReport {
+	r := &BytecodeReport{Address: address, Artifact: c.Path}
+	if len(code) == 0 {
+		r.Status = "no code"
+		return r
+	}
+	got, want := normalizeRuntime(code, c), normalizeRuntime(c.DeployedBytecode, c)
+	r.OnChainLength, r.ExpectedLength = len(got), len(want)
+	off := compareRuntime(code, c)
+	if off < 0 {
+		r.Status = "match"
+		return r
+	}
+	r.Status = "mismatch"
+	r.Offset = &off
+	r.OnChain, r.Expected = codeWindow(got, off), codeWindow(want, off)
+	return r
+}
+
+// printMismatch shows where r's code differs, through printf.
+func printMismatch(printf func(string, ...interface{}), r *BytecodeReport) {
+	printf("  on-chain (%d bytes): ...%s...\n", r.OnChainLength, r.OnChain)
+	printf("  artifact (%d bytes): ...%s...\n", r.ExpectedLength, r.Expected)
+}
+
+// Exit statuses of verify-bytecode besides 0, a match, and 1, a failure
+// to check at all. 2 is taken by flag errors and 3 to 8 by the failure
+// classes.
+const (
+	exitMismatch = 9
+	exitNoCode   = 10
+)
+
+// runVerifyBytecode implements `verify-bytecode [flags] <address>`:
+// compare the code at address with the artifact's runtime code, ignoring
+// the metadata hash, immutables and library addresses, and exit with a
+// status telling match, mismatch and no code apart.
+func runVerifyBytecode(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("verify-bytecode", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	o.register(fs)
+	ao.register(fs, "")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: verify-bytecode [flags] <address>")
+	}
+	address, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	path, contract, err := ao.resolve()
+	if err != nil {
+		return err
+	}
+	c, err := loadABI(path, contract)
+	if err != nil {
+		return err
+	}
+	if c.DeployedBytecode == nil {
+		return fmt.Errorf("%s has no deployedBytecode to compare with", c.Path)
+	}
+
+	client, _, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	code, err := client.CodeAt(ctx, address, nil)
+	if err != nil {
+		return fmt.Errorf("get code at %s: %w", address.Hex(), err)
+	}
+	r := checkBytecode(address, code, c)
+	ui.report.Bytecode = r
+	switch r.Status {
+	case "no code":
+		return &ExitError{Code: exitNoCode, Err: fmt.Errorf("no code at %s", address.Hex())}
+	case "match":
+		ui.Resultf("Bytecode at %s matches %s\n", address.Hex(), c.Path)
+		return nil
+	}
+	ui.Resultf("Bytecode at %s differs from %s at byte %d:\n", address.Hex(), c.Path, *r.Offset)
+	printMismatch(ui.Resultf, r)
+	// The slots read to spot a proxy are not what the report is about.
+	storage := ui.report.Storage
+	if p, err := readProxy(ctx, client, address, nil); err == nil && p.Implementation != nil {
+		ui.Printf("%s is a proxy (%s); its implementation is %s\n", address.Hex(), p.Kind, p.Implementation.Hex())
+	}
+	ui.report.Storage = storage
+	return &ExitError{Code: exitMismatch, Err: fmt.Errorf("code at %s does not match %s", address.Hex(), c.Path)}
+}
@@ -0,0 +1,285 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// selectorIndex maps 4-byte selectors to an ABI's functions. Overloads
+// share a name but not a selector, so it tells them apart exactly, where
+// go-ethereum's names (transfer, transfer0, ...) depend on ABI order.
+type selectorIndex map[[4]byte]*abi.Method
+
+func newSelectorIndex(contractABI *abi.ABI) selectorIndex {
+	ix := make(selectorIndex, len(contractABI.Methods))
+	for name := range contractABI.Methods {
+		m := contractABI.Methods[name]
+		ix[[4]byte(m.ID)] = &m
+	}
+	return ix
+}
+
+// lookup returns the function data calls, by its first four bytes.
+func (ix selectorIndex) lookup(data []byte) *abi.Method {
+	if len(data) < 4 {
+		return nil
+	}
+	return ix[[4]byte(data[:4])]
+}
+
+// resolveMethod finds a function by bare name or by full signature such as
+// transfer(address,uint256). A signature is matched by the selector it
+// hashes to, so spacing, parameter names and uint/int aliases do not
+// matter. Ambiguous bare names are an error listing every overload.
+func resolveMethod(contractABI *abi.ABI, name string) (*abi.Method, error) {
+	if strings.Contains(name, "(") {
+		want, err := methodFromSignature(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		if m := newSelectorIndex(contractABI).lookup(want.ID); m != nil {
+			return m, nil
+		}
+		var overloads []string
+		for _, m := range contractABI.Methods {
+			if m.RawName == want.RawName {
+				overloads = append(overloads, m.Sig)
+			}
+		}
+		if len(overloads) == 0 {
+			return nil, fmt.Errorf("no function with signature %s", want.Sig)
+		}
+		sort.Strings(overloads)
+		return nil, fmt.Errorf("no function with signature %s; %s has: %s", want.Sig, want.RawName, strings.Join(overloads, ", "))
+	}
+
+	var matches []abi.Method
+	for _, m := range contractABI.Methods {
+		if m.RawName == name {
+			matches = append(matches, m)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return &matches[0], nil
+	case 0:
+		var names []string
+		for _, m := range contractABI.Methods {
+			names = append(names, m.Sig)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("no function named %q; available: %s", name, strings.Join(names, ", "))
+	}
+	sigs := make([]string, len(matches))
+	for i, m := range matches {
+		sigs[i] = m.Sig
+	}
+	sort.Strings(sigs)
+	return nil, fmt.Errorf("%q is overloaded; use one of: %s", name, strings.Join(sigs, ", "))
+}
+
+// parseBlock parses a --block value; empty or "latest" means the head.
+func parseBlock(s string) (*big.Int, error) {
+	if s == "" || s == "latest" {
+		return nil, nil
+	}
+	n, err := toBigInt(s)
+	if err != nil || n.Sign() < 0 {
+		return nil, fmt.Errorf("invalid block %q", s)
+	}
+	return n, nil
+}
+
+// typedValue is a decoded return value with its ABI name and type.
+type typedValue struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// MarshalJSON renders the value with jsonValue.
+func (v typedValue) MarshalJSON() ([]byte, error) {
+	type plain typedValue
+	p := plain(v)
+	p.Value = jsonValue(v.Value)
+	return json.Marshal(p)
+}
+
+// typedValues pairs decoded outputs with their ABI names and types.
+func typedValues(outputs abi.Arguments, vals []interface{}) []typedValue {
+	typed := make([]typedValue, len(vals))
+	for i, v := range vals {
+		typed[i] = typedValue{Name: argName(outputs, i), Type: outputs[i].Type.String(), Value: v}
+	}
+	return typed
+}
+
+// printValues prints a method's decoded outputs, one per line, and returns
+// them for the JSON report.
+func printValues(outputs abi.Arguments, vals []interface{}) []typedValue {
+	typed := typedValues(outputs, vals)
+	for _, t := range typed {
+		ui.Resultf("%s (%s): %s\n", t.Name, t.Type, formatValue(t.Value))
+	}
+	return typed
+}
+
+// callMethod executes a view call of m on address at block (nil = latest).
+func callMethod(ctx context.Context, bound *bind.BoundContract, contractABI *abi.ABI, m *abi.Method, block *big.Int, args []interface{}) ([]interface{}, error) {
+	var out []interface{}
+	opts := &bind.CallOpts{Context: ctx, BlockNumber: block}
+	if err := bound.Call(opts, &out, m.Name, args...); err != nil {
+		return nil, fmt.Errorf("call %s: %w", m.Sig, explainError(err, contractABI))
+	}
+	return out, nil
+}
+
+// callPayable simulates sending value with a call of m from from, which
+// bind.CallOpts cannot express.
+func callPayable(ctx context.Context, caller bind.ContractCaller, address, from common.Address, contractABI *abi.ABI, m *abi.Method, value, block *big.Int, args []interface{}) ([]interface{}, error) {
+	data, err := contractABI.Pack(m.Name, args...)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s: %w", m.Sig, err)
+	}
+	out, err := caller.CallContract(ctx, ethereum.CallMsg{From: from, To: &address, Value: value, Data: data}, block)
+	if err != nil {
+		return nil, fmt.Errorf("call %s: %w", m.Sig, explainError(err, contractABI))
+	}
+	if len(out) == 0 && len(m.Outputs) > 0 {
+		if code, err := caller.CodeAt(ctx, address, block); err == nil && len(code) == 0 {
+			return nil, fmt.Errorf("call %s: %w", m.Sig, bind.ErrNoCode)
+		}
+	}
+	vals, err := contractABI.Unpack(m.Name, out)
+	if err != nil {
+		return nil, fmt.Errorf("call %s: %w", m.Sig, err)
+	}
+	return vals, nil
+}
+
+// runCall implements `call [flags] <address> <function> [args...]` and
+// `call --batch calls.json`.
+func runCall(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("call", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	o.register(fs)
+	ao.register(fs, "")
+	var abo abiOptions
+	abo.register(fs)
+	argsJSON := fs.String("args", "", "function arguments as a JSON array")
+	blockFlag := fs.String("block", "", "block number to query (default latest)")
+	batch := fs.String("batch", "", "JSON file of calls [{address, method, args, contract?}] to run in one Multicall3 request")
+	var txo txOptions
+	fs.StringVar(&txo.value, "value", "", "simulate sending this much ether with the call, e.g. 0.1ether, for a payable function")
+	fs.BoolVar(&txo.forceValue, "force-value", false, "simulate --value even for a function the ABI marks non-payable")
+	fromFlag := fs.String("from", "", "caller for the simulation; with --value it needs the balance, or an --override giving it one (default the zero address)")
+	var overrides stateOverrides
+	fs.Var(&overrides, "override", "run the call with an account's state replaced: addr:balance=...,nonce=...,code=0x...,state[slot]=value (repeatable)")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	value, err := parseValue(txo.value)
+	if err != nil {
+		return fmt.Errorf("--value: %w", err)
+	}
+	if *batch != "" {
+		if fs.NArg() > 0 {
+			return errors.New("usage: call --batch calls.json [flags]")
+		}
+		if value != nil || *fromFlag != "" {
+			return errors.New("--value and --from do not apply to --batch")
+		}
+		if len(overrides) > 0 {
+			return errors.New("--override does not apply to --batch")
+		}
+		calls, err := readBatch(*batch, ao)
+		if err != nil {
+			return err
+		}
+		block, err := parseBlock(*blockFlag)
+		if err != nil {
+			return err
+		}
+		client, _, err := connect(ctx, &o)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		return runBatch(ctx, client, calls, block)
+	}
+	if fs.NArg() < 2 {
+		return errors.New("usage: call [flags] <address> <function> [args...]")
+	}
+	address, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	client, chainID, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	c, err := abo.contractABI(ctx, ao, client, chainID, address)
+	if err != nil {
+		return err
+	}
+	m, err := resolveMethod(&c.ABI, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	raw, err := rawArgs(fs.Args()[2:], *argsJSON)
+	if err != nil {
+		return err
+	}
+	callArgs, err := convertArgs(m.Inputs, raw)
+	if err != nil {
+		return fmt.Errorf("%s: %w", m.Sig, err)
+	}
+	if err := checkPayable(m.Sig, m, txo); err != nil {
+		return err
+	}
+	block, err := parseBlock(*blockFlag)
+	if err != nil {
+		return err
+	}
+
+	var caller bind.ContractCaller = client
+	if len(overrides) > 0 {
+		overrides.print()
+		caller = overrideCaller{client, overrides}
+	}
+	var from common.Address
+	if *fromFlag != "" {
+		if from, err = parseAddress(*fromFlag); err != nil {
+			return fmt.Errorf("--from: %w", err)
+		}
+	}
+	var vals []interface{}
+	if value != nil || *fromFlag != "" {
+		if value != nil {
+			ui.Printf("Simulating with %s ETH from %s\n", formatEther(value), from.Hex())
+		}
+		vals, err = callPayable(ctx, caller, address, from, &c.ABI, m, value, block, callArgs)
+	} else {
+		bound := bind.NewBoundContract(address, c.ABI, caller, client, client)
+		vals, err = callMethod(ctx, bound, &c.ABI, m, block, callArgs)
+	}
+	if err != nil {
+		return err
+	}
+	ui.report.Calls = append(ui.report.Calls, CallReport{Method: m.Sig, Results: printValues(m.Outputs, vals)})
+	return nil
+}
@@ -0,0 +1,137 @@
+package deployer
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// overloadedABI has the ERC-721 and ERC-1155 safeTransferFrom overloads,
+// which go-ethereum names safeTransferFrom, safeTransferFrom0 and
+// safeTransferFrom1 in ABI order.
+const overloadedABI = `[
+	{"type":"function","name":"safeTransferFrom","stateMutability":"nonpayable","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"id","type":"uint256"},{"name":"amount","type":"uint256"},{"name":"data","type":"bytes"}],"outputs":[]},
+	{"type":"function","name":"safeTransferFrom","stateMutability":"nonpayable","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"tokenId","type":"uint256"}],"outputs":[]},
+	{"type":"function","name":"safeTransferFrom","stateMutability":"nonpayable","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"tokenId","type":"uint256"},{"name":"data","type":"bytes"}],"outputs":[]},
+	{"type":"function","name":"ownerOf","stateMutability":"view","inputs":[{"name":"tokenId","type":"uint256"}],"outputs":[{"name":"","type":"address"}]}
+]`
+
+func overloaded(t *testing.T) abi.ABI {
+	t.Helper()
+	a, err := abi.JSON(strings.NewReader(overloadedABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestResolveMethodOverloads(t *testing.T) {
+	a := overloaded(t)
+	for _, tt := range []struct{ name, sig, selector string }{
+		{"safeTransferFrom(address,address,uint256)", "safeTransferFrom(address,address,uint256)", "0x42842e0e"},
+		{"safeTransferFrom(address,address,uint256,bytes)", "safeTransferFrom(address,address,uint256,bytes)", "0xb88d4fde"},
+		{"safeTransferFrom(address,address,uint256,uint256,bytes)", "safeTransferFrom(address,address,uint256,uint256,bytes)", "0xf242432a"},
+		{"safeTransferFrom(address from, address to, uint tokenId)", "safeTransferFrom(address,address,uint256)", "0x42842e0e"},
+		{" safeTransferFrom( address , address , uint256 , bytes ) ", "safeTransferFrom(address,address,uint256,bytes)", "0xb88d4fde"},
+		{"function safeTransferFrom(address,address,uint256,uint256,bytes) external", "safeTransferFrom(address,address,uint256,uint256,bytes)", "0xf242432a"},
+		{"ownerOf", "ownerOf(uint256)", "0x6352211e"},
+	} {
+		m, err := resolveMethod(&a, tt.name)
+		if err != nil {
+			t.Errorf("resolveMethod(%q): %v", tt.name, err)
+			continue
+		}
+		if m.Sig != tt.sig || hexutil.Encode(m.ID) != tt.selector {
+			t.Errorf("resolveMethod(%q) = %s %x, want %s %s", tt.name, m.Sig, m.ID, tt.sig, tt.selector)
+		}
+	}
+
+	for _, tt := range []struct{ name, want string }{
+		{"safeTransferFrom", `"safeTransferFrom" is overloaded; use one of: safeTransferFrom(address,address,uint256), safeTransferFrom(address,address,uint256,bytes), safeTransferFrom(address,address,uint256,uint256,bytes)`},
+		{"safeTransferFrom(address,uint256)", "no function with signature safeTransferFrom(address,uint256); safeTransferFrom has: safeTransferFrom(address,address,uint256), safeTransferFrom(address,address,uint256,bytes), safeTransferFrom(address,address,uint256,uint256,bytes)"},
+		{"transfer(address,uint256)", "no function with signature transfer(address,uint256)"},
+		{"transfer", `no function named "transfer"; available: ownerOf(uint256), safeTransferFrom(address,address,uint256), `},
+	} {
+		if _, err := resolveMethod(&a, tt.name); err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("resolveMethod(%q) = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// TestDecodeOverloads decodes calldata for each overload through the
+// selector index resolveMethod uses.
+func TestDecodeOverloads(t *testing.T) {
+	a := overloaded(t)
+	art := &Artifact{Name: "Token", ABI: a}
+	to := common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8")
+	for _, tt := range []struct {
+		sig  string
+		args []interface{}
+	}{
+		{"safeTransferFrom(address,address,uint256)", []interface{}{testAddr, to, big.NewInt(7)}},
+		{"safeTransferFrom(address,address,uint256,bytes)", []interface{}{testAddr, to, big.NewInt(7), []byte{1, 2}}},
+		{"safeTransferFrom(address,address,uint256,uint256,bytes)", []interface{}{testAddr, to, big.NewInt(7), big.NewInt(3), []byte{}}},
+	} {
+		m, err := resolveMethod(&a, tt.sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		input, err := m.Inputs.Pack(tt.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := append(append([]byte(nil), m.ID...), input...)
+		d := decodeLocal([]*Artifact{art}, data)
+		if d == nil || d.method.Sig != tt.sig || d.contract != "Token" || len(d.args) != len(tt.args) {
+			t.Errorf("decode %s calldata = %+v", tt.sig, d)
+		}
+	}
+}
+
+// The owned fixture keeps its deployer in slot 0 and reverts with "not
+// owner" for any other caller; for the owner, any call succeeds.
+const (
+	ownedABI      = `[{"type":"function","name":"setGreeting","stateMutability":"nonpayable","inputs":[{"name":"greeting","type":"string"}],"outputs":[]}]`
+	ownedRuntime  = "3360005414605f577f08c379a000000000000000000000000000000000000000000000000000000000600052602060045260096024527f6e6f74206f776e6572000000000000000000000000000000000000000000000060445260646000fd5b00"
+	ownedCreation = "33600055606180600f6000396000f3" + ownedRuntime
+)
+
+// TestCallOverrideOwner simulates an onlyOwner setGreeting from another
+// account, which succeeds once the owner slot is overridden to it.
+func TestCallOverrideOwner(t *testing.T) {
+	chain := newSimChain(t)
+	chain.autoCommit(t)
+	c := chain.dial(t, Config{})
+	art, err := newArtifact("Owned", []byte(ownedABI), codeObject{Object: ownedCreation}, codeObject{Object: ownedRuntime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := c.Deploy(t.Context(), art)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := "0x70997970C51812dc3A010C7d01b50e0d17dc79C8"
+	args := []string{"--rpc", chain.rpc, "--sig", "function setGreeting(string)", "--from", other}
+	call := []string{d.Address.Hex(), "setGreeting", "gm"}
+
+	if _, err := results(t, runCall, append(args, call...)...); err == nil || !strings.Contains(err.Error(), "not owner") {
+		t.Fatalf("setGreeting from a stranger = %v, want not owner", err)
+	}
+	// With the owner slot overridden, and the caller's balance as well:
+	// overrides of two accounts go in one call.
+	overridden := append(args, "--override", d.Address.Hex()+":state[0]="+other, "--override", other+":balance=1ether")
+	if _, err := results(t, runCall, append(overridden, call...)...); err != nil {
+		t.Fatalf("setGreeting with the owner overridden: %v", err)
+	}
+	// Without --from the call comes from the zero address.
+	if _, err := results(t, runCall, append([]string{"--rpc", chain.rpc, "--sig", "function setGreeting(string)", "--override", d.Address.Hex() + ":state[0]=0"}, call...)...); err != nil {
+		t.Fatalf("setGreeting from the zero address as owner: %v", err)
+	}
+	if owner, err := chain.Client().StorageAt(t.Context(), d.Address, common.Hash{}, nil); err != nil || common.BytesToAddress(owner) != testAddr {
+		t.Fatalf("owner slot = %x, %v after the simulation; want it untouched", owner, err)
+	}
+}
@@ -0,0 +1,338 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// localChainID is the chain ID Anvil and Hardhat run on by default;
+// transactions there are signed without asking.
+const localChainID = 31337
+
+// chainInfo is what the registry knows about a chain: its name for
+// people, the alias --chain selects it by, its native currency, public
+// RPC endpoints, and the block explorer links point to and its
+// Etherscan-style API, if it has them. production marks the mainnets
+// where a mistake costs real money; ens is the ENS registry, on chains
+// that have one, and safeService the Safe Transaction Service --via-safe
+// proposes to. blockTime, when known, tunes receipt polling; opStack
+// chains charge an L1 data fee (see estimateL1Fee).
+type chainInfo struct {
+	name        string
+	alias       string
+	symbol      string
+	decimals    uint8
+	rpcs        []string
+	explorer    string
+	explorerAPI string
+	eip1559     bool
+	opStack     bool
+	blockTime   time.Duration
+	production  bool
+	ens         common.Address
+	safeService string
+}
+
+// chains is the chain registry, by chain ID. The config file's [chains]
+// tables add to it (see addChains). The presets with public RPCs are the
+// chains --chain is mostly used for; the rest are named for output.
+var chains = map[uint64]chainInfo{
+	1: {
+		name: "Ethereum mainnet", alias: "mainnet", symbol: "ETH", decimals: 18,
+		rpcs:     []string{"https://ethereum-rpc.publicnode.com", "https://eth.llamarpc.com"},
+		explorer: "https://etherscan.io", explorerAPI: "https://api.etherscan.io/api",
+		eip1559: true, blockTime: 12 * time.Second, production: true, ens: ensRegistry,
+		safeService: "https://safe-transaction-mainnet.safe.global",
+	},
+	11155111: {
+		name: "Sepolia", alias: "sepolia", symbol: "ETH", decimals: 18,
+		rpcs:     []string{"https://ethereum-sepolia-rpc.publicnode.com", "https://rpc.sepolia.org"},
+		explorer: "https://sepolia.etherscan.io", explorerAPI: "https://api-sepolia.etherscan.io/api",
+		eip1559: true, blockTime: 12 * time.Second, ens: ensRegistry,
+		safeService: "https://safe-transaction-sepolia.safe.global",
+	},
+	17000: {
+		name: "Holesky", alias: "holesky", symbol: "ETH", decimals: 18,
+		rpcs:     []string{"https://ethereum-holesky-rpc.publicnode.com", "https://holesky.drpc.org"},
+		explorer: "https://holesky.etherscan.io", explorerAPI: "https://api-holesky.etherscan.io/api",
+		eip1559: true, blockTime: 12 * time.Second, ens: ensRegistry,
+	},
+	8453: {
+		name: "Base", alias: "base", symbol: "ETH", decimals: 18,
+		rpcs:     []string{"https://mainnet.base.org", "https://base-rpc.publicnode.com"},
+		explorer: "https://basescan.org", explorerAPI: "https://api.basescan.org/api",
+		eip1559: true, opStack: true, blockTime: 2 * time.Second, production: true,
+		safeService: "https://safe-transaction-base.safe.global",
+	},
+	84532: {
+		name: "Base Sepolia", alias: "base-sepolia", symbol: "ETH", decimals: 18,
+		rpcs:     []string{"https://sepolia.base.org", "https://base-sepolia-rpc.publicnode.com"},
+		explorer: "https://sepolia.basescan.org", explorerAPI: "https://api-sepolia.basescan.org/api",
+		eip1559: true, opStack: true, blockTime: 2 * time.Second,
+		safeService: "https://safe-transaction-base-sepolia.safe.global",
+	},
+	42161: {
+		name: "Arbitrum One", alias: "arbitrum", symbol: "ETH", decimals: 18,
+		rpcs:     []string{"https://arb1.arbitrum.io/rpc", "https://arbitrum-one-rpc.publicnode.com"},
+		explorer: "https://arbiscan.io", explorerAPI: "https://api.arbiscan.io/api",
+		eip1559: true, blockTime: 250 * time.Millisecond, production: true,
+		safeService: "https://safe-transaction-arbitrum.safe.global",
+	},
+	10: {
+		name: "OP Mainnet", alias: "optimism", symbol: "ETH", decimals: 18,
+		rpcs:     []string{"https://mainnet.optimism.io", "https://optimism-rpc.publicnode.com"},
+		explorer: "https://optimistic.etherscan.io", explorerAPI: "https://api-optimistic.etherscan.io/api",
+		eip1559: true, opStack: true, blockTime: 2 * time.Second, production: true,
+		safeService: "https://safe-transaction-optimism.safe.global",
+	},
+	137: {
+		name: "Polygon", alias: "polygon", symbol: "POL", decimals: 18,
+		rpcs:     []string{"https://polygon-rpc.com", "https://polygon-bor-rpc.publicnode.com"},
+		explorer: "https://polygonscan.com", explorerAPI: "https://api.polygonscan.com/api",
+		eip1559: true, blockTime: 2 * time.Second, production: true,
+		safeService: "https://safe-transaction-polygon.safe.global",
+	},
+
+	56:     {name: "BNB Smart Chain", alias: "bsc", symbol: "BNB", decimals: 18, explorer: "https://bscscan.com", eip1559: true, production: true, safeService: "https://safe-transaction-bsc.safe.global"},
+	100:    {name: "Gnosis", alias: "gnosis", symbol: "xDAI", decimals: 18, explorer: "https://gnosis.blockscout.com", eip1559: true, production: true, safeService: "https://safe-transaction-gnosis-chain.safe.global"},
+	324:    {name: "zkSync Era", alias: "zksync", symbol: "ETH", decimals: 18, explorer: "https://explorer.zksync.io", eip1559: true, production: true, safeService: "https://safe-transaction-zksync.safe.global"},
+	43114:  {name: "Avalanche C-Chain", alias: "avalanche", symbol: "AVAX", decimals: 18, explorer: "https://snowtrace.io", eip1559: true, production: true, safeService: "https://safe-transaction-avalanche.safe.global"},
+	59144:  {name: "Linea", alias: "linea", symbol: "ETH", decimals: 18, explorer: "https://lineascan.build", eip1559: true, production: true, safeService: "https://safe-transaction-linea.safe.global"},
+	534352: {name: "Scroll", alias: "scroll", symbol: "ETH", decimals: 18, explorer: "https://scrollscan.com", eip1559: true, production: true, safeService: "https://safe-transaction-scroll.safe.global"},
+
+	localChainID: {name: "local dev chain", alias: "anvil", symbol: "ETH", decimals: 18, rpcs: []string{defaultRPC}, eip1559: true},
+	11155420:     {name: "OP Sepolia", alias: "op-sepolia", symbol: "ETH", decimals: 18, explorer: "https://sepolia-optimism.etherscan.io", explorerAPI: "https://api-sepolia-optimistic.etherscan.io/api", eip1559: true, opStack: true},
+	421614:       {name: "Arbitrum Sepolia", alias: "arbitrum-sepolia", symbol: "ETH", decimals: 18, explorer: "https://sepolia.arbiscan.io", explorerAPI: "https://api-sepolia.arbiscan.io/api", eip1559: true},
+	80002:        {name: "Polygon Amoy", alias: "polygon-amoy", symbol: "POL", decimals: 18, explorer: "https://amoy.polygonscan.com", eip1559: true},
+	10200:        {name: "Gnosis Chiado", alias: "chiado", symbol: "xDAI", decimals: 18, explorer: "https://gnosis-chiado.blockscout.com", eip1559: true},
+}
+
+// lookupChain finds a chain by alias, name or decimal ID.
+func lookupChain(key string) (uint64, chainInfo, error) {
+	if id, err := strconv.ParseUint(key, 10, 64); err == nil {
+		return id, chains[id], nil
+	}
+	for id, info := range chains {
+		if strings.EqualFold(info.alias, key) || strings.EqualFold(info.name, key) {
+			return id, info, nil
+		}
+	}
+	var aliases []string
+	for _, info := range chains {
+		if info.alias != "" {
+			aliases = append(aliases, info.alias)
+		}
+	}
+	sort.Strings(aliases)
+	return 0, chainInfo{}, fmt.Errorf("unknown chain %q; known: %s (or add it under [chains.<id>] in the config)", key, strings.Join(aliases, ", "))
+}
+
+// pollIntervalFor is how often to poll for receipts on a chain with
+// blocks every blockTime: twice per block, between 100ms and the default.
+func pollIntervalFor(blockTime time.Duration) time.Duration {
+	return min(max(blockTime/2, 100*time.Millisecond), defaultPollInterval)
+}
+
+// chainConfig is a [chains.<id>] table of the config file, a custom
+// chain or changes to a preset. Empty fields keep the built-in values.
+type chainConfig struct {
+	Name        string   `toml:"name"`
+	Alias       string   `toml:"alias"`
+	Symbol      string   `toml:"symbol"`
+	Decimals    uint8    `toml:"decimals"`
+	RPCURLs     []string `toml:"rpc_urls"`
+	Explorer    string   `toml:"explorer"`
+	ExplorerAPI string   `toml:"explorer_api"`
+	EIP1559     *bool    `toml:"eip1559"`
+	OPStack     *bool    `toml:"op_stack"`
+	BlockTime   string   `toml:"block_time"`
+	ENS         string   `toml:"ens"`
+	SafeService string   `toml:"safe_service"`
+}
+
+// addChains merges the config file's chains into the registry. New chains
+// are taken to have EIP-1559 unless they say otherwise; whether a chain
+// counts as production cannot be changed from the config.
+func addChains(path string, tables map[string]chainConfig) error {
+	for key, t := range tables {
+		id, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			return fmt.Errorf("config %s: chains.%s: want a decimal chain ID", path, key)
+		}
+		info, ok := chains[id]
+		if !ok {
+			info.eip1559 = true
+		}
+		info, err = t.merge(info)
+		if err != nil {
+			return fmt.Errorf("config %s: chains.%s: %w", path, key, err)
+		}
+		for other, o := range chains {
+			if other != id && info.alias != "" && strings.EqualFold(o.alias, info.alias) {
+				return fmt.Errorf("config %s: chains.%s: alias %q is already chain %d", path, key, info.alias, other)
+			}
+		}
+		chains[id] = info
+	}
+	return nil
+}
+
+// merge applies t over info.
+func (t chainConfig) merge(info chainInfo) (chainInfo, error) {
+	if t.Name != "" {
+		info.name = t.Name
+	}
+	if t.Alias != "" {
+		if _, err := strconv.ParseUint(t.Alias, 10, 64); err == nil {
+			return info, fmt.Errorf("alias: %q would read as a chain ID", t.Alias)
+		}
+		info.alias = t.Alias
+	}
+	if t.Symbol != "" {
+		info.symbol = t.Symbol
+	}
+	if t.Decimals != 0 {
+		info.decimals = t.Decimals
+	}
+	if len(t.RPCURLs) > 0 {
+		info.rpcs = t.RPCURLs
+	}
+	for _, base := range []string{t.Explorer, t.ExplorerAPI, t.SafeService} {
+		if err := checkExplorer(base); err != nil {
+			return info, err
+		}
+	}
+	if t.Explorer != "" {
+		info.explorer = t.Explorer
+	}
+	if t.ExplorerAPI != "" {
+		info.explorerAPI = t.ExplorerAPI
+	}
+	if t.SafeService != "" {
+		info.safeService = t.SafeService
+	}
+	if t.EIP1559 != nil {
+		info.eip1559 = *t.EIP1559
+	}
+	if t.OPStack != nil {
+		info.opStack = *t.OPStack
+	}
+	if t.BlockTime != "" {
+		d, err := time.ParseDuration(t.BlockTime)
+		if err != nil || d <= 0 {
+			return info, fmt.Errorf("block_time: want a duration such as 2s, got %q", t.BlockTime)
+		}
+		info.blockTime = d
+	}
+	if t.ENS != "" {
+		if !common.IsHexAddress(t.ENS) {
+			return info, fmt.Errorf("ens: invalid registry address %q", t.ENS)
+		}
+		info.ens = common.HexToAddress(t.ENS)
+	}
+	return info, nil
+}
+
+// explorerPlaceholder matches the placeholders of an explorer URL
+// template: {chain}, the chain ID, and {kind} ("tx" or "address") and {id},
+// what a link points to.
+var explorerPlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// checkExplorer checks an explorer base URL or template from the flags or
+// config.
+func checkExplorer(base string) error {
+	if base != "" && !strings.HasPrefix(base, "http://") && !strings.HasPrefix(base, "https://") {
+		return fmt.Errorf("explorer %q is not an http(s) URL", base)
+	}
+	for _, p := range explorerPlaceholder.FindAllString(base, -1) {
+		if p != "{chain}" && p != "{kind}" && p != "{id}" {
+			return fmt.Errorf("explorer %q: unknown placeholder %s (want {chain}, {kind} or {id})", base, p)
+		}
+	}
+	return nil
+}
+
+// chainName names chain id for people.
+func chainName(id *big.Int) string {
+	if info, ok := chains[id.Uint64()]; ok && info.name != "" {
+		return info.name
+	}
+	return "chain " + id.String()
+}
+
+// describeChain is id followed by its name, when the registry has one.
+func describeChain(id *big.Int) string {
+	if info, ok := chains[id.Uint64()]; ok && info.name != "" {
+		return fmt.Sprintf("%s (%s)", id, info.name)
+	}
+	return id.String()
+}
+
+// explorerURL is the link to kind ("tx" or "address") id on the explorer
+// at base, or "" without an explorer. base is a template when it has
+// {kind} or {id} in it, and otherwise an Etherscan-style site whose links
+// are base/tx/<hash> and base/address/<address>; setChain has filled in
+// its {chain}.
+func explorerURL(base, kind, id string) string {
+	if base == "" {
+		return ""
+	}
+	if strings.Contains(base, "{kind}") || strings.Contains(base, "{id}") {
+		return strings.NewReplacer("{kind}", kind, "{id}", id).Replace(base)
+	}
+	return strings.TrimRight(base, "/") + "/" + kind + "/" + id
+}
+
+// runChains implements `chains list [flags]`: the presets and the config
+// file's chains, which --chain selects by alias or ID.
+func runChains(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "list" {
+		return errors.New("usage: chains list [flags]")
+	}
+	fs := flag.NewFlagSet("chains list", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	if err := parseFlags(fs, args[1:], &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: chains list [flags]")
+	}
+	ids := make([]uint64, 0, len(chains))
+	for id := range chains {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		c := chains[id]
+		ui.report.Chains = append(ui.report.Chains, ChainReport{
+			ID: id, Alias: c.alias, Name: c.name, Symbol: c.symbol, Decimals: c.decimals,
+			RPCs: c.rpcs, Explorer: c.explorer, ExplorerAPI: c.explorerAPI,
+			EIP1559: c.eip1559, OPStack: c.opStack, BlockTime: c.blockTime.Milliseconds(), Production: c.production,
+			SafeService: c.safeService,
+		})
+		fees := "legacy"
+		if c.eip1559 {
+			fees = "1559"
+		}
+		block := "-"
+		if c.blockTime > 0 {
+			block = c.blockTime.String()
+		}
+		ui.Resultf("%-9d %-17s %-19s %-5s %-6s %-6s %s\n", id, c.alias, c.name, c.symbol, fees, block, c.explorer)
+		if len(c.rpcs) > 0 {
+			ui.Verbosef("%-9s rpc: %s\n", "", strings.Join(redactURLs(c.rpcs), ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package deployer
+
+import (
+	"io"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestExplorerURL(t *testing.T) {
+	// A config file's chain with a template of its own.
+	if err := addChains("nyc2025.toml", map[string]chainConfig{"999998": {Name: "Devnet", Explorer: "https://scan.devnet.example/#/{kind}/{id}"}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { delete(chains, 999998) })
+	const hash = "0x5c504ed432cb51138bcf09aa5e8a410dd4a1e204ef84bfed1be16dfba1b22060"
+	const addr = "0x5FbDB2315678afecb367f032d93F642f64180aa3"
+
+	for _, tt := range []struct {
+		name     string
+		chain    uint64
+		explorer string // --explorer-url
+		kind, id string
+		want     string
+	}{
+		{"etherscan tx", 11155111, "", "tx", hash, "https://sepolia.etherscan.io/tx/" + hash},
+		{"etherscan address", 42161, "", "address", addr, "https://arbiscan.io/address/" + addr},
+		{"blockscout", 100, "", "tx", hash, "https://gnosis.blockscout.com/tx/" + hash},
+		{"local chain", localChainID, "", "tx", hash, ""},
+		{"unknown chain", 999999, "", "address", addr, ""},
+		{"config template", 999998, "", "address", addr, "https://scan.devnet.example/#/address/" + addr},
+		{"flag over the registry", 1, "https://explorer.example.org/", "tx", hash, "https://explorer.example.org/tx/" + hash},
+		{"flag on an unknown chain", 999999, "https://explorer.example.org", "address", addr, "https://explorer.example.org/address/" + addr},
+		{"{kind} and {id}", 1, "https://explorer.example.org/{kind}s/{id}?view=full", "tx", hash, "https://explorer.example.org/txs/" + hash + "?view=full"},
+		{"{id} alone", 1, "https://explorer.example.org/lookup/{id}", "address", addr, "https://explorer.example.org/lookup/" + addr},
+		{"{chain}", 999999, "https://scan.example.org/{chain}/{kind}/{id}", "tx", hash, "https://scan.example.org/999999/tx/" + hash},
+		{"{chain} in the host", 999999, "https://{chain}.scan.example.org", "address", addr, "https://999999.scan.example.org/address/" + addr},
+	} {
+		if err := checkExplorer(tt.explorer); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		l := newLogger(io.Discard, io.Discard)
+		l.setChain(new(big.Int).SetUint64(tt.chain), tt.explorer)
+		if got := l.explorerURL(tt.kind, tt.id); got != tt.want {
+			t.Errorf("%s: %s link = %q, want %q", tt.name, tt.kind, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct{ explorer, want string }{
+		{"explorer.example.org", "is not an http(s) URL"},
+		{"https://explorer.example.org/{kind}/{hash}", "unknown placeholder {hash} (want {chain}, {kind} or {id})"},
+		{"https://explorer.example.org/{}", "unknown placeholder {}"},
+	} {
+		if err := checkExplorer(tt.explorer); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("checkExplorer(%q) = %v, want %q", tt.explorer, err, tt.want)
+		}
+	}
+	if err := addChains("nyc2025.toml", map[string]chainConfig{"999997": {Explorer: "https://scan.example.org/{tx}"}}); err == nil || !strings.Contains(err.Error(), "chains.999997: explorer") {
+		t.Errorf("config chain with an unknown placeholder: %v", err)
+	}
+}
@@ -0,0 +1,444 @@
+package deployer
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// headRefresh is how long endpoint block heights are trusted before every
+// endpoint is polled again.
+const headRefresh = 5 * time.Second
+
+// errNoEndpoint is returned when no endpoint is connected to send to.
+var errNoEndpoint = errors.New("rpc: no endpoint is connected")
+
+// endpoint is one RPC URL and what is known about it. name is the URL
+// as logs and errors show it, without the path or credentials that
+// often carry an API key.
+type endpoint struct {
+	url     string
+	name    string
+	client  *ethclient.Client // nil until a dial succeeds
+	stop    func()            // closes client
+	healthy bool
+	head    uint64
+}
+
+// rpcClient is the node connection every command uses. It retries
+// idempotent reads on transient errors and, given several endpoints, sends
+// each read to the healthy one with the highest block, failing over to the
+// rest. Nonces, sends and receipts are pinned to one endpoint so a
+// transaction is never looked for on a node that has not seen it. Methods
+// not overridden here go to the pinned endpoint via the embedded client.
+type rpcClient struct {
+	*ethclient.Client
+	env
+	policy  retryPolicy
+	timeout time.Duration
+	chainID *big.Int
+	headers http.Header // sent to every endpoint, redialed ones included
+
+	mu        sync.Mutex
+	endpoints []*endpoint
+	pinned    *endpoint
+	refreshed time.Time
+
+	// cleanup runs once the connections are closed, e.g. to stop an
+	// --auto-anvil node.
+	cleanup func()
+
+	// relay, with --private-tx, takes signed transactions instead of the
+	// node; everything else is still read from the endpoints.
+	relay *relay
+
+	// fork, in `plan simulate`, has an Anvil fork send transactions as
+	// the impersonated deployer instead of taking signed ones.
+	fork *forkSender
+
+	// reads and pins batch the calls made close together, to the best
+	// endpoint and to the pinned one.
+	reads, pins *batcher
+}
+
+func (c *rpcClient) Close() {
+	for _, e := range c.endpoints {
+		if e.client != nil {
+			e.stop()
+		}
+	}
+	if c.cleanup != nil {
+		c.cleanup()
+		c.cleanup = nil
+	}
+}
+
+// setHealth records and logs a health transition.
+func (c *rpcClient) setHealth(e *endpoint, ok bool, err error) {
+	if e.healthy == ok {
+		return
+	}
+	e.healthy = ok
+	if ok {
+		c.ui.Warnf("rpc %s: healthy again (block %d)\n", e.name, e.head)
+	} else {
+		c.ui.Warnf("rpc %s: unhealthy: %v\n", e.name, err)
+	}
+}
+
+// markDown flags e after a transient failure. A lone endpoint is never
+// marked: there is nothing to fail over to.
+func (c *rpcClient) markDown(e *endpoint, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.endpoints) > 1 {
+		c.setHealth(e, false, err)
+	}
+}
+
+// call runs f, the JSON-RPC method what, against e, bounded by the
+// per-request timeout. Running out of time while ctx is still live is
+// reported as errStalled.
+func call[T any](ctx context.Context, c *rpcClient, e *endpoint, what string, f func(context.Context, *ethclient.Client) (T, error)) (T, error) {
+	start := time.Now()
+	if c.timeout <= 0 {
+		v, err := f(ctx, e.client)
+		err = redactErr(c.rpcLog.original(err), e.url)
+		c.metrics.observeRPC(what, e.url, time.Since(start), err)
+		return v, err
+	}
+	tctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	v, err := f(tctx, e.client)
+	err = c.rpcLog.original(err)
+	if err != nil && ctx.Err() == nil && tctx.Err() != nil {
+		err = fmt.Errorf("%s: %w after %s", e.name, errStalled, c.timeout)
+	}
+	err = redactErr(err, e.url)
+	c.metrics.observeRPC(what, e.url, time.Since(start), err)
+	return v, err
+}
+
+func (c *rpcClient) probeChainID(ctx context.Context, e *endpoint) (*big.Int, error) {
+	return call(ctx, c, e, "eth_chainId", func(ctx context.Context, cl *ethclient.Client) (*big.Int, error) { return cl.ChainID(ctx) })
+}
+
+// probe fetches e's block height, redialing it and re-checking its chain
+// ID first if it was down.
+func (c *rpcClient) probe(ctx context.Context, e *endpoint) (uint64, error) {
+	if e.client == nil {
+		client, stop, err := dialNode(ctx, c.rpcLog, e.url, c.headers)
+		if err != nil {
+			return 0, fmt.Errorf("dial: %w", redactErr(err, e.url))
+		}
+		e.client, e.stop = client, stop
+	}
+	if !e.healthy {
+		id, err := c.probeChainID(ctx, e)
+		if err != nil {
+			return 0, err
+		}
+		if id.Cmp(c.chainID) != 0 {
+			return 0, fmt.Errorf("reports chain id %s, want %s", id, c.chainID)
+		}
+	}
+	return call(ctx, c, e, "eth_blockNumber", func(ctx context.Context, cl *ethclient.Client) (uint64, error) { return cl.BlockNumber(ctx) })
+}
+
+// reconnect redials the pinned endpoint after its connection dropped,
+// such as a WebSocket the provider closed, and checks it is still on the
+// same chain before anything is sent through it again.
+func (c *rpcClient) reconnect(ctx context.Context) error {
+	e, err := c.pin(ctx)
+	if err != nil {
+		return err
+	}
+	client, stop, err := dialNode(ctx, c.rpcLog, e.url, c.headers)
+	if err != nil {
+		err = redactErr(err, e.url)
+		c.markDown(e, err)
+		return fmt.Errorf("redial %s: %w", e.name, err)
+	}
+	c.mu.Lock()
+	old := e.stop
+	e.client, e.stop = client, stop
+	if c.pinned == e {
+		c.Client = client
+	}
+	c.mu.Unlock()
+	if old != nil {
+		old()
+	}
+	id, err := c.probeChainID(ctx, e)
+	if err != nil {
+		c.markDown(e, err)
+		return fmt.Errorf("%s: chain id: %w", e.name, err)
+	}
+	if id.Cmp(c.chainID) != 0 {
+		c.markDown(e, fmt.Errorf("reports chain id %s, want %s", id, c.chainID))
+		return classify(ErrChainMismatch, fmt.Errorf("%s now reports chain id %s, want %s", e.name, id, c.chainID))
+	}
+	c.mu.Lock()
+	c.setHealth(e, true, nil)
+	c.mu.Unlock()
+	return nil
+}
+
+// refresh probes every endpoint concurrently. Caller holds c.mu.
+func (c *rpcClient) refresh(ctx context.Context) {
+	type result struct {
+		head uint64
+		err  error
+	}
+	res := make([]result, len(c.endpoints))
+	var wg sync.WaitGroup
+	for i, e := range c.endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res[i].head, res[i].err = c.probe(ctx, e)
+		}()
+	}
+	wg.Wait()
+	for i, e := range c.endpoints {
+		if res[i].err != nil {
+			c.setHealth(e, false, res[i].err)
+			continue
+		}
+		e.head = res[i].head
+		c.setHealth(e, true, nil)
+	}
+	c.refreshed = time.Now()
+}
+
+// candidates lists the endpoints to try for a read: healthy ones, highest
+// block first (ties keep the order given on the command line), or every
+// dialed endpoint if none is healthy.
+func (c *rpcClient) candidates(ctx context.Context) []*endpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.endpoints) == 1 {
+		return c.endpoints
+	}
+	if time.Since(c.refreshed) > headRefresh {
+		c.refresh(ctx)
+	}
+	var healthy, dialed []*endpoint
+	for _, e := range c.endpoints {
+		if e.client == nil {
+			continue
+		}
+		dialed = append(dialed, e)
+		if e.healthy {
+			healthy = append(healthy, e)
+		}
+	}
+	if len(healthy) == 0 {
+		return dialed
+	}
+	slices.SortStableFunc(healthy, func(a, b *endpoint) int { return cmp.Compare(b.head, a.head) })
+	return healthy
+}
+
+// pin returns the endpoint transactions go to. It is chosen on first use
+// and only moves when it goes unhealthy while another endpoint is fine.
+func (c *rpcClient) pin(ctx context.Context) (*endpoint, error) {
+	candidates := c.candidates(ctx)
+	if len(candidates) == 0 {
+		return nil, errNoEndpoint
+	}
+	best := candidates[0]
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pinned == nil || (!c.pinned.healthy && best.healthy) {
+		if c.pinned != nil && c.pinned != best {
+			c.ui.Warnf("rpc: moving transactions from %s to %s\n", c.pinned.name, best.name)
+		}
+		c.pinned = best
+		c.Client = best.client
+	}
+	return c.pinned, nil
+}
+
+// read runs f on the best endpoint, falling over to the next on a
+// transient failure, and retries the whole round with backoff.
+func read[T any](ctx context.Context, c *rpcClient, what string, f func(context.Context, *ethclient.Client) (T, error)) (T, error) {
+	return retry(ctx, c.ui, c.policy, what, func() (T, error) {
+		var v T
+		err := errNoEndpoint
+		for _, e := range c.candidates(ctx) {
+			if v, err = call(ctx, c, e, what, f); err == nil || !transient(err) {
+				return v, err
+			}
+			c.markDown(e, err)
+		}
+		return v, err
+	})
+}
+
+// pinned runs f on the pinned endpoint, retrying with backoff; the pin
+// moves between attempts if the endpoint has gone unhealthy.
+func pinned[T any](ctx context.Context, c *rpcClient, what string, f func(context.Context, *ethclient.Client) (T, error)) (T, error) {
+	return retry(ctx, c.ui, c.policy, what, func() (T, error) {
+		e, err := c.pin(ctx)
+		if err != nil {
+			var v T
+			return v, err
+		}
+		v, err := call(ctx, c, e, what, f)
+		if transient(err) {
+			c.markDown(e, err)
+		}
+		return v, err
+	})
+}
+
+func (c *rpcClient) ChainID(ctx context.Context) (*big.Int, error) {
+	return read(ctx, c, "eth_chainId", func(ctx context.Context, cl *ethclient.Client) (*big.Int, error) { return cl.ChainID(ctx) })
+}
+
+func (c *rpcClient) BlockNumber(ctx context.Context) (uint64, error) {
+	return read(ctx, c, "eth_blockNumber", func(ctx context.Context, cl *ethclient.Client) (uint64, error) { return cl.BlockNumber(ctx) })
+}
+
+func (c *rpcClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return read(ctx, c, "eth_getBlockByNumber", func(ctx context.Context, cl *ethclient.Client) (*types.Header, error) {
+		return cl.HeaderByNumber(ctx, number)
+	})
+}
+
+func (c *rpcClient) BalanceAt(ctx context.Context, account common.Address, block *big.Int) (*big.Int, error) {
+	var balance hexutil.Big
+	if err := c.reads.do(ctx, &balance, "eth_getBalance", account, blockArg(block)); err != nil {
+		return nil, err
+	}
+	return (*big.Int)(&balance), nil
+}
+
+func (c *rpcClient) CodeAt(ctx context.Context, account common.Address, block *big.Int) ([]byte, error) {
+	return read(ctx, c, "eth_getCode", func(ctx context.Context, cl *ethclient.Client) ([]byte, error) {
+		return cl.CodeAt(ctx, account, block)
+	})
+}
+
+func (c *rpcClient) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	return read(ctx, c, "eth_getCode", func(ctx context.Context, cl *ethclient.Client) ([]byte, error) {
+		return cl.PendingCodeAt(ctx, account)
+	})
+}
+
+func (c *rpcClient) NonceAt(ctx context.Context, account common.Address, block *big.Int) (uint64, error) {
+	return read(ctx, c, "eth_getTransactionCount", func(ctx context.Context, cl *ethclient.Client) (uint64, error) {
+		return cl.NonceAt(ctx, account, block)
+	})
+}
+
+func (c *rpcClient) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return read(ctx, c, "eth_gasPrice", func(ctx context.Context, cl *ethclient.Client) (*big.Int, error) { return cl.SuggestGasPrice(ctx) })
+}
+
+func (c *rpcClient) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return read(ctx, c, "eth_maxPriorityFeePerGas", func(ctx context.Context, cl *ethclient.Client) (*big.Int, error) {
+		return cl.SuggestGasTipCap(ctx)
+	})
+}
+
+func (c *rpcClient) BlobBaseFee(ctx context.Context) (*big.Int, error) {
+	return read(ctx, c, "eth_blobBaseFee", func(ctx context.Context, cl *ethclient.Client) (*big.Int, error) { return cl.BlobBaseFee(ctx) })
+}
+
+func (c *rpcClient) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error) {
+	return read(ctx, c, "eth_estimateGas", func(ctx context.Context, cl *ethclient.Client) (uint64, error) { return cl.EstimateGas(ctx, msg) })
+}
+
+func (c *rpcClient) CallContract(ctx context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	return read(ctx, c, "eth_call", func(ctx context.Context, cl *ethclient.Client) ([]byte, error) {
+		return cl.CallContract(ctx, msg, block)
+	})
+}
+
+func (c *rpcClient) PendingCallContract(ctx context.Context, msg ethereum.CallMsg) ([]byte, error) {
+	return read(ctx, c, "eth_call", func(ctx context.Context, cl *ethclient.Client) ([]byte, error) {
+		return cl.PendingCallContract(ctx, msg)
+	})
+}
+
+func (c *rpcClient) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	var nonce hexutil.Uint64
+	err := c.pins.do(ctx, &nonce, "eth_getTransactionCount", account, "pending")
+	return uint64(nonce), err
+}
+
+func (c *rpcClient) TransactionReceipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	var r *types.Receipt
+	if err := c.pins.do(ctx, &r, "eth_getTransactionReceipt", c.fork.resolve(hash)); err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, ethereum.NotFound
+	}
+	return r, nil
+}
+
+func (c *rpcClient) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	type result struct {
+		tx      *types.Transaction
+		pending bool
+	}
+	r, err := pinned(ctx, c, "eth_getTransactionByHash", func(ctx context.Context, cl *ethclient.Client) (result, error) {
+		tx, pending, err := cl.TransactionByHash(ctx, c.fork.resolve(hash))
+		return result{tx, pending}, err
+	})
+	return r.tx, r.pending, err
+}
+
+// SendTransaction is sent once, to the pinned endpoint. A failed send may
+// still have reached the node, so instead of resending, the error is
+// dropped if the node already knows the transaction by hash. With
+// --private-tx it goes to the relay instead, and in `plan simulate` the
+// fork sends it unsigned.
+func (c *rpcClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if c.fork != nil {
+		return c.fork.send(ctx, c, tx)
+	}
+	if c.relay != nil {
+		head, err := c.BlockNumber(ctx)
+		if err != nil {
+			return fmt.Errorf("block number: %w", err)
+		}
+		return c.relay.sendPrivate(ctx, tx, head)
+	}
+	e, err := c.pin(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = call(ctx, c, e, "eth_sendRawTransaction", func(ctx context.Context, cl *ethclient.Client) (struct{}, error) {
+		return struct{}{}, cl.SendTransaction(ctx, tx)
+	})
+	if err == nil {
+		return nil
+	}
+	if strings.Contains(strings.ToLower(err.Error()), "already known") {
+		return nil
+	}
+	if transient(err) {
+		if _, _, lookupErr := c.TransactionByHash(ctx, tx.Hash()); lookupErr == nil {
+			c.ui.Warnf("send %s: %v, but the node already has it\n", tx.Hash().Hex(), err)
+			return nil
+		}
+	}
+	return err
+}
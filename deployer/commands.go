@@ -0,0 +1,385 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// commands are the subcommands; anything else runs the HelloWorld demo.
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"abi":                runABI,
+	"account":            runAccount,
+	"anvil":              runAnvil,
+	"balances":           runBalances,
+	"bindings":           runBindings,
+	"blocks":             runBlocks,
+	"broadcast":          runBroadcast,
+	"call":               runCall,
+	"cancel":             runCancel,
+	"chains":             runChains,
+	"config":             runConfig,
+	"decode":             runDecode,
+	"deploy":             runDeploy,
+	"erc1155":            runERC1155,
+	"erc20":              runERC20,
+	"erc721":             runERC721,
+	"fund":               runFund,
+	"import-broadcast":   runImportBroadcast,
+	"interfaces":         runInterfaces,
+	"journal":            runJournal,
+	"keeper":             runKeeper,
+	"list":               runList,
+	"logs":               runLogs,
+	"mine-salt":          runMineSalt,
+	"owner":              runOwner,
+	"plan":               runPlanCommand,
+	"predict-address":    runPredictAddress,
+	"proxy":              runProxy,
+	"read-var":           runReadVar,
+	"receipt":            runReceipt,
+	"replay":             runReplay,
+	"run":                runPlan,
+	"send":               runSend,
+	"send-blob":          runSendBlob,
+	"sign-message":       runSignMessage,
+	"sign-typed-data":    runSignTypedData,
+	"storage":            runStorage,
+	"storage-layout":     runStorageLayout,
+	"trace":              runTrace,
+	"transfer":           runTransfer,
+	"transfer-ownership": runTransferOwnership,
+	"unlock":             runUnlock,
+	"upgrade":            runUpgrade,
+	"verify":             runVerify,
+	"verify-bytecode":    runVerifyBytecode,
+	"verify-message":     runVerifyMessage,
+	"verify-typed-data":  runVerifyTypedData,
+	"watch":              runWatch,
+}
+
+// Main runs the subcommand named by args[0], or the HelloWorld demo when
+// args[0] is not one, with the rest of args as its flags and arguments.
+// Results go to stdout and progress to stderr. With --output json the
+// report is printed, and with --log-format json the error is logged; Main
+// then returns a ReportedError wrapping the command's error, so the
+// caller does not print it again.
+func Main(ctx context.Context, args []string) error {
+	run := runDemo
+	ui.report.Command = "demo"
+	if len(args) > 0 {
+		if cmd, ok := commands[args[0]]; ok {
+			ui.report.Command = args[0]
+			run, args = cmd, args[1:]
+		}
+	}
+	ui.with("op", ui.report.Command)
+	err := run(ctx, args)
+	names.close()
+	rpcLog.close()
+	notify.send(ctx, err)
+	if ui.finish(err) && err != nil || ui.logError(err) {
+		return &ReportedError{Err: err}
+	}
+	return err
+}
+
+// ReportedError is returned by Main for a failure that is already part of
+// the printed JSON report or was logged as a JSON record.
+type ReportedError struct {
+	Err error
+}
+
+func (e *ReportedError) Error() string { return e.Err.Error() }
+
+func (e *ReportedError) Unwrap() error { return e.Err }
+
+// ExitError is a failure with its own exit status, so scripts can tell
+// outcomes apart, such as verify-bytecode's mismatch and missing code.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string { return e.Err.Error() }
+
+func (e *ExitError) Unwrap() error { return e.Err }
+
+// runDeploy implements `deploy [flags] [artifact-path] [constructor-args...]`.
+// When --artifact or --contract is given, every positional value is a
+// constructor argument.
+func runDeploy(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("deploy", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	var dopts deployOptions
+	var vo verifyOptions
+	var oo offlineOptions
+	var po proxyOptions
+	o.register(fs)
+	ao.register(fs, "")
+	dopts.register(fs)
+	vo.register(fs)
+	oo.register(fs)
+	po.register(fs)
+	ctorJSON := fs.String("constructor-args", "", "constructor arguments as a JSON array")
+	verify := fs.Bool("verify", false, "verify the source on the chain's Etherscan-compatible explorer after deploying")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	positional := fs.Args()
+	if ao.path == "" && ao.contract == "" && len(positional) > 0 {
+		ao.path, positional = positional[0], positional[1:]
+	}
+
+	path, contract, err := ao.resolve()
+	if err != nil {
+		return err
+	}
+	c, err := loadArtifact(path, contract)
+	if err != nil {
+		return err
+	}
+	ctorArgs, err := constructorArgs(c, positional, *ctorJSON)
+	if err != nil {
+		return err
+	}
+	var initData []byte
+	if po.kind != "" {
+		switch {
+		case oo.enabled:
+			return errors.New("--proxy cannot be combined with offline signing")
+		case dopts.create2:
+			return errors.New("--proxy cannot be combined with --create2")
+		}
+		if initData, err = po.initData(c, ctorArgs); err != nil {
+			return err
+		}
+	}
+	if oo.enabled {
+		return offlineDeploy(&o, oo, c, dopts, ctorArgs)
+	}
+
+	s, err := openSession(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	libs, err := parseLibraries(dopts.link.libraries)
+	if err != nil {
+		return err
+	}
+	if err := linkLibraries(c, libs, o.deployments, s.chainID); err != nil {
+		return err
+	}
+
+	if dopts.dryRun {
+		if po.kind != "" {
+			ui.Warnf("Warning: --dry-run simulates the implementation only, not the proxy\n")
+		}
+		return s.dryRunDeploy(ctx, c, dopts, ctorArgs)
+	}
+
+	lock, err := lockDeployment(ctx, o.deployments, s.chainID, c, dopts.lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+	ctx = lock.ctx
+	if addr, ok, err := s.existingDeployment(ctx, o.deployments, c, dopts); err != nil {
+		return err
+	} else if ok {
+		ui.Resultln(addr.Hex())
+		return nil
+	}
+
+	_, d, _, err := s.deployContract(ctx, c, dopts, ctorArgs)
+	if err != nil {
+		err = lock.lost(err)
+		if d != nil {
+			// Deployed, but not at the predicted address: record where.
+			if _, rerr := recordDeployment(o.deployments, s.chainID, c, ctorArgs, *d); rerr != nil {
+				return fmt.Errorf("%w; recording it: %v", err, rerr)
+			}
+			ui.Printf("Recorded %s at %s in %s\n", c.Name, d.Address.Hex(), manifestPath(o.deployments, s.chainID, c.Name))
+		}
+		return err
+	}
+	if d == nil {
+		return nil
+	}
+	if po.kind != "" {
+		if err := s.deployProxy(ctx, c, po, txOptions{nonce: -1, fees: dopts.tx.fees}, initData, d); err != nil {
+			return lock.lost(err)
+		}
+	}
+	if d, err = recordDeployment(o.deployments, s.chainID, c, ctorArgs, *d); err != nil {
+		return err
+	}
+	lock.release()
+	ui.Printf("Recorded %s v%d in %s\n", c.Name, d.Version, manifestPath(o.deployments, s.chainID, c.Name))
+	ui.Resultln(d.Address.Hex())
+	if *verify {
+		return verifyContract(ctx, c, d.codeAddress(), common.FromHex(d.ConstructorData), s.chainID, vo)
+	}
+	return nil
+}
+
+// runList implements `list`: print the deployments recorded for the
+// connected chain.
+func runList(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+
+	client, chainID, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	manifests, err := listManifests(o.deployments, chainID)
+	if err != nil {
+		return err
+	}
+	ui.report.Deployments = manifests
+	if len(manifests) == 0 {
+		ui.Printf("No deployments recorded for chain %s\n", chainID)
+		return nil
+	}
+	for _, m := range manifests {
+		for _, d := range m.Deployments {
+			ui.Resultf("%-20s v%-3d %s  block %-8d tx %s  %s\n",
+				m.Contract, d.Version, d.Address.Hex(), d.BlockNumber, d.TxHash.Hex(), d.Timestamp.Format(time.RFC3339))
+			if d.Proxy != nil {
+				ui.Resultf("%-25s %s proxy, implementation %s\n", "", d.Proxy.Kind, d.Proxy.Implementation.Hex())
+			}
+		}
+	}
+	return nil
+}
+
+// runDemo is the original HelloWorld walkthrough: deploy, greet,
+// setGreeting, greet again.
+func runDemo(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	var dopts deployOptions
+	o.register(fs)
+	ao.register(fs, "HelloWorld")
+	dopts.register(fs)
+	ctorJSON := fs.String("constructor-args", "", "constructor arguments as a JSON array")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	positional := fs.Args()
+	if len(positional) == 0 && *ctorJSON == "" {
+		positional = []string{"Hello from Go+Anvil!"}
+	}
+
+	// 1-4) Connect, load key, check chain, build transact opts
+	s, err := openSession(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	// 5) Read Foundry artifact for ABI & bytecode
+	path, contract, err := ao.resolve()
+	if err != nil {
+		return err
+	}
+	c, err := loadArtifact(path, contract)
+	if err != nil {
+		return err
+	}
+	ctorArgs, err := constructorArgs(c, positional, *ctorJSON)
+	if err != nil {
+		return err
+	}
+	libs, err := parseLibraries(dopts.link.libraries)
+	if err != nil {
+		return err
+	}
+	if err := linkLibraries(c, libs, o.deployments, s.chainID); err != nil {
+		return err
+	}
+
+	if dopts.dryRun {
+		return s.dryRunDeploy(ctx, c, dopts, ctorArgs)
+	}
+
+	// 6-7) Deploy the contract with constructor arg and wait until mined,
+	// unless a live deployment is already recorded
+	lock, err := lockDeployment(ctx, o.deployments, s.chainID, c, dopts.lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+	address, reused, err := s.existingDeployment(lock.ctx, o.deployments, c, dopts)
+	if err != nil {
+		return err
+	}
+	if !reused {
+		var d *Deployment
+		address, d, _, err = s.deployContract(lock.ctx, c, dopts, ctorArgs)
+		err = lock.lost(err)
+		if d != nil {
+			if _, rerr := recordDeployment(o.deployments, s.chainID, c, ctorArgs, *d); rerr != nil {
+				return rerr
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	lock.release()
+
+	// 8) Call greet()
+	bound := bind.NewBoundContract(address, c.ABI, s.client, s.client, s.client)
+	var out []interface{}
+	if err := bound.Call(&bind.CallOpts{Context: ctx}, &out, "greet"); err != nil {
+		return fmt.Errorf("call greet: %w", explainError(err, &c.ABI))
+	}
+	ui.Resultln("greet():", out[0])
+	ui.report.Calls = append(ui.report.Calls, CallReport{Method: "greet()", Results: typedValues(c.ABI.Methods["greet"].Outputs, out)})
+
+	// 9) Update greeting via transaction
+	setGreeting, err := resolveMethod(&c.ABI, "setGreeting")
+	if err != nil {
+		return err
+	}
+	tx2, err := s.transact(ctx, bound, &c.ABI, setGreeting, []interface{}{"Updated from Go!"}, txOptions{nonce: -1})
+	if err != nil {
+		return err
+	}
+	rcpt2, err := s.waitReceipt(ctx, tx2, &c.ABI)
+	if err != nil {
+		return err
+	}
+	ui.report.Transactions = append(ui.report.Transactions, *newTxReport(setGreeting.Sig, rcpt2, printEvents(ui, rcpt2, &c.ABI)))
+
+	// 10) Call greet() again
+	out = nil
+	if err := bound.Call(&bind.CallOpts{Context: ctx}, &out, "greet"); err != nil {
+		return fmt.Errorf("call greet 2: %w", explainError(err, &c.ABI))
+	}
+	ui.Resultln("greet() after update:", out[0])
+	ui.report.Calls = append(ui.report.Calls, CallReport{Method: "greet()", Results: typedValues(c.ABI.Methods["greet"].Outputs, out)})
+
+	// 11) Print sender for reference
+	bal, _ := s.client.BalanceAt(ctx, s.from, nil)
+	ui.Printf("Deployer: %s  Balance: %s wei\n", names.label(s.from), bal.String())
+	return nil
+}
@@ -0,0 +1,327 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/naoina/toml"
+)
+
+// defaultConfigPath is read, if it exists, when --config is not given.
+const defaultConfigPath = "nyc2025.toml"
+
+// config is the layout of nyc2025.toml. Chains add to or change the
+// chain registry, keyed by decimal chain ID.
+type config struct {
+	Profiles map[string]profile     `toml:"profiles"`
+	Chains   map[string]chainConfig `toml:"chains"`
+}
+
+// profile is one named environment, e.g. [profiles.sepolia]. Empty fields
+// leave the flag defaults alone.
+type profile struct {
+	Chain            string            `toml:"chain"`
+	RPCURL           string            `toml:"rpc_url"`
+	ChainID          uint64            `toml:"chain_id"`
+	Keystore         string            `toml:"keystore"`
+	Mnemonic         string            `toml:"mnemonic"`
+	PrivateKey       string            `toml:"private_key"`
+	Signer           string            `toml:"signer"`
+	SignerURL        string            `toml:"signer_url"`
+	SignerFrom       string            `toml:"signer_from"`
+	KMSKeyID         string            `toml:"kms_key_id"`
+	KeyFile          string            `toml:"key_file"`
+	RequireSecureKey bool              `toml:"require_secure_key"`
+	DerivationPath   string            `toml:"derivation_path"`
+	AccountIndex     *int              `toml:"account_index"`
+	OutDir           string            `toml:"out_dir"`
+	DeploymentsDir   string            `toml:"deployments_dir"`
+	Confirmations    uint64            `toml:"confirmations"`
+	MaxFee           string            `toml:"max_fee"`
+	PriorityFee      string            `toml:"priority_fee"`
+	RPCHeaders       map[string]string `toml:"rpc_headers"`
+}
+
+// loadProfile reads the config file at path (or nyc2025.toml), adds its
+// chains to the registry and returns profile name. No name means no
+// profile; a missing default file is not an error unless a profile was
+// asked for.
+func loadProfile(path, name string) (*profile, error) {
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigPath
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit && name == "" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	var cfg config
+	if err := toml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	if err := addChains(path, cfg.Chains); err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, nil
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		var names []string
+		for n := range cfg.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("config %s: no profile %q; available: %s", path, name, strings.Join(names, ", "))
+	}
+	return &p, nil
+}
+
+// parseFlags parses args, then fills every flag the user did not set from
+// the selected profile and --chain. Precedence is flags > env > profile >
+// chain presets > defaults: RPC_URL/RPC_URLS and the key variables beat
+// the profile's values.
+func parseFlags(fs *flag.FlagSet, args []string, o *options) error {
+	fs.Parse(args)
+	p, err := loadProfile(o.config, o.profile)
+	if err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	o.pollSet = set["poll-interval"]
+	if p != nil {
+		if err := applyProfile(fs, set, o, p); err != nil {
+			return err
+		}
+	}
+	return selectChain(o)
+}
+
+// parseInterspersed parses args with flags allowed before, between and
+// after the positionals, which it returns in order. Everything after a
+// "--" is positional.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var pos []string
+	for {
+		fs.Parse(args)
+		rest := fs.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			return append(pos, rest...)
+		}
+		if len(rest) == 0 {
+			return pos
+		}
+		pos, args = append(pos, rest[0]), rest[1:]
+	}
+}
+
+// applyProfile sets the flags not in set from p.
+func applyProfile(fs *flag.FlagSet, set map[string]bool, o *options, p *profile) error {
+	apply := func(name, value string) error {
+		if value == "" || set[name] || fs.Lookup(name) == nil {
+			return nil
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("profile %s: %s: %w", o.profile, name, err)
+		}
+		return nil
+	}
+	flagBool := func(v bool) string {
+		if !v {
+			return ""
+		}
+		return "true"
+	}
+	uint := func(v uint64) string {
+		if v == 0 {
+			return ""
+		}
+		return strconv.FormatUint(v, 10)
+	}
+
+	rpcURL := p.RPCURL
+	if len(splitURLs(os.Getenv("RPC_URL"))) > 0 || len(splitURLs(os.Getenv("RPC_URLS"))) > 0 {
+		rpcURL = ""
+	}
+	keyFile := p.KeyFile
+	for _, v := range []string{"KEYSTORE_PATH", "MNEMONIC", "PRIVATE_KEY"} {
+		if strings.TrimSpace(os.Getenv(v)) != "" {
+			keyFile = ""
+		}
+	}
+	accountIndex := ""
+	if p.AccountIndex != nil {
+		accountIndex = strconv.Itoa(*p.AccountIndex)
+	}
+	for _, f := range []struct{ name, value string }{
+		{"chain", p.Chain},
+		{"rpc", rpcURL},
+		{"expect-chain-id", uint(p.ChainID)},
+		{"signer", p.Signer},
+		{"signer-url", p.SignerURL},
+		{"signer-from", p.SignerFrom},
+		{"kms-key-id", p.KMSKeyID},
+		{"key-file", keyFile},
+		{"require-secure-key", flagBool(p.RequireSecureKey)},
+		{"derivation-path", p.DerivationPath},
+		{"account-index", accountIndex},
+		{"out-dir", p.OutDir},
+		{"deployments-dir", p.DeploymentsDir},
+		{"confirmations", uint(p.Confirmations)},
+		{"max-fee", p.MaxFee},
+		{"priority-fee", p.PriorityFee},
+	} {
+		if err := apply(f.name, f.value); err != nil {
+			return err
+		}
+	}
+	o.keys.Keystore, o.keys.Mnemonic, o.keys.PrivateKey = p.Keystore, p.Mnemonic, p.PrivateKey
+	o.profileHeaders = p.RPCHeaders
+	return nil
+}
+
+// selectChain applies --chain: the chain's ID becomes --expect-chain-id,
+// so a node on another network aborts the run before anything is signed,
+// and its public RPCs are used when no endpoint was given.
+func selectChain(o *options) error {
+	if o.chain == "" {
+		return nil
+	}
+	id, info, err := lookupChain(o.chain)
+	if err != nil {
+		return fmt.Errorf("--chain: %w", err)
+	}
+	if o.expectChainID != 0 && o.expectChainID != id {
+		return fmt.Errorf("--chain %s is chain %d, but --expect-chain-id is %d", o.chain, id, o.expectChainID)
+	}
+	o.expectChainID = id
+	if len(o.rpc) > 0 || len(splitURLs(os.Getenv("RPC_URL"))) > 0 || len(splitURLs(os.Getenv("RPC_URLS"))) > 0 {
+		return nil
+	}
+	if len(info.rpcs) == 0 {
+		return fmt.Errorf("--chain %s: no public RPC known for chain %d; pass --rpc or set rpc_urls under [chains.%d]", o.chain, id, id)
+	}
+	o.rpc = append(urlList(nil), info.rpcs...)
+	return nil
+}
+
+// effectiveConfig is what `config show` prints: the settings a command
+// would run with. Key material is never included.
+type effectiveConfig struct {
+	Config         string   `json:"config,omitempty"`
+	Profile        string   `json:"profile,omitempty"`
+	RPC            []string `json:"rpc"`
+	RPCHeaders     []string `json:"rpcHeaders,omitempty"`
+	ExpectChainID  uint64   `json:"expectChainId,omitempty"`
+	KeySource      string   `json:"keySource"`
+	DerivationPath string   `json:"derivationPath"`
+	AccountIndex   int      `json:"accountIndex"`
+	OutDir         string   `json:"outDir"`
+	DeploymentsDir string   `json:"deploymentsDir"`
+	Confirmations  uint64   `json:"confirmations"`
+	MaxFee         string   `json:"maxFee,omitempty"`
+	PriorityFee    string   `json:"priorityFee,omitempty"`
+}
+
+// describeKeySource names the key source without revealing it: keystore
+// paths are shown, mnemonics and private keys are redacted.
+func describeKeySource(ko KeyOptions) (string, error) {
+	switch ko.Signer {
+	case "remote":
+		return "remote signer " + ko.SignerURL, nil
+	case "kms":
+		return "AWS KMS " + ko.KMSKeyID, nil
+	}
+	kind, value, origin, err := keyMaterial(ko)
+	if err != nil {
+		return "", err
+	}
+	switch kind {
+	case "":
+		return "none", nil
+	case "KEYSTORE_PATH":
+		return fmt.Sprintf("keystore %s (%s)", value, origin), nil
+	case "KEY_FILE":
+		return "key file " + value, nil
+	case "KEY_STDIN":
+		return "stdin", nil
+	}
+	return fmt.Sprintf("%s <redacted> (%s)", kind, origin), nil
+}
+
+// runConfig implements `config show [flags]`.
+func runConfig(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "show" {
+		return errors.New("usage: config show [flags]")
+	}
+	fs := flag.NewFlagSet("config show", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	o.register(fs)
+	ao.register(fs, "")
+	if err := parseFlags(fs, args[1:], &o); err != nil {
+		return err
+	}
+
+	urls, err := resolveRPC(o.rpc)
+	if err != nil {
+		return err
+	}
+	keySource, err := describeKeySource(o.keys)
+	if err != nil {
+		return err
+	}
+	cfg := effectiveConfig{
+		Profile:        o.profile,
+		RPC:            urls,
+		ExpectChainID:  o.expectChainID,
+		KeySource:      keySource,
+		DerivationPath: o.keys.DerivationPath,
+		AccountIndex:   o.keys.AccountIndex,
+		OutDir:         ao.outDir,
+		DeploymentsDir: o.deployments,
+		Confirmations:  o.confirmations,
+		MaxFee:         o.maxFee,
+		PriorityFee:    o.priorityFee,
+	}
+	for name, values := range o.headers() {
+		for _, v := range values {
+			cfg.RPCHeaders = append(cfg.RPCHeaders, name+": "+redactHeader(name, v))
+		}
+	}
+	sort.Strings(cfg.RPCHeaders)
+	if o.profile != "" {
+		cfg.Config = o.config
+		if cfg.Config == "" {
+			cfg.Config = defaultConfigPath
+		}
+	}
+	ui.report.Config = &cfg
+
+	ui.Resultf("config          %s\n", cfg.Config)
+	ui.Resultf("profile         %s\n", cfg.Profile)
+	ui.Resultf("rpc             %s\n", strings.Join(cfg.RPC, ", "))
+	if len(cfg.RPCHeaders) > 0 {
+		ui.Resultf("rpc-headers     %s\n", strings.Join(cfg.RPCHeaders, ", "))
+	}
+	ui.Resultf("expect-chain-id %d\n", cfg.ExpectChainID)
+	ui.Resultf("key             %s\n", cfg.KeySource)
+	ui.Resultf("derivation-path %s\n", cfg.DerivationPath)
+	ui.Resultf("account-index   %d\n", cfg.AccountIndex)
+	ui.Resultf("out-dir         %s\n", cfg.OutDir)
+	ui.Resultf("deployments-dir %s\n", cfg.DeploymentsDir)
+	ui.Resultf("confirmations   %d\n", cfg.Confirmations)
+	ui.Resultf("max-fee         %s\n", cfg.MaxFee)
+	ui.Resultf("priority-fee    %s\n", cfg.PriorityFee)
+	return nil
+}
@@ -0,0 +1,241 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// defaultPollInterval matches the cadence bind.WaitMined polls at.
+const defaultPollInterval = time.Second
+
+// defaultProgressEvery is how often a wait reports that it is still going.
+const defaultProgressEvery = 15 * time.Second
+
+// errWaitTimeout is wrapped by WaitForReceipt when WaitOptions.Timeout
+// expires.
+var errWaitTimeout = errors.New("timed out")
+
+// receiptBackend is the part of ethclient WaitForReceipt needs.
+type receiptBackend interface {
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+	TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error)
+	BlockNumber(ctx context.Context) (uint64, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// WaitOptions tune WaitForReceipt. The zero value polls every second,
+// forever, for the first inclusion.
+type WaitOptions struct {
+	// Interval is the polling cadence.
+	Interval time.Duration
+	// Timeout bounds the whole wait; 0 waits until ctx is done.
+	Timeout time.Duration
+	// Confirmations is the depth that counts as final; <= 1 returns on
+	// first inclusion.
+	Confirmations uint64
+	// Progress, if set, is called every ProgressEvery while no receipt
+	// has appeared, with the time waited and the blocks built since.
+	Progress      func(elapsed time.Duration, blocks uint64)
+	ProgressEvery time.Duration
+
+	// stalled, if set, is called on each poll while nothing is included
+	// and may return a replacement at the same nonce; from then on a
+	// receipt for any of the hashes ends the wait.
+	stalled func() (*types.Transaction, error)
+	// reorged, if set, is called when a reorg drops the included
+	// transaction with its hash, and may send it again.
+	reorged func(dropped common.Hash) error
+	// env is where progress, warnings and reorgs are reported; unset,
+	// the commands' cli.
+	env env
+}
+
+// WaitForReceipt polls for hash's receipt until it is included and
+// Confirmations-1 further blocks are built on top of it. On each poll the
+// receipt is fetched again; if it vanished or moved to another block (a
+// reorg) the count restarts from the new inclusion. Once deep enough, the
+// receipt's block hash is pinned against the canonical block at its
+// height, so a receipt the node still serves from an orphaned block does
+// not count. A receipt that is not
+// there yet is not an error; any other RPC failure is. When the timeout
+// expires the error says whether the transaction is still pending or has
+// left the node's pool.
+func WaitForReceipt(ctx context.Context, client receiptBackend, hash common.Hash, opts WaitOptions) (*types.Receipt, error) {
+	n, interval := opts.Confirmations, opts.Interval
+	if n == 0 {
+		n = 1
+	}
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	e := opts.env
+	if e.ui == nil {
+		e = cli
+	}
+	parent := ctx
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	startBlock, err := client.BlockNumber(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("block number: %w", err)
+	}
+	lastProgress := start
+
+	hashes := []common.Hash{hash}
+	var included *types.Receipt
+	var orphaned common.Hash // block of a receipt the pin found off the chain
+	reported := uint64(0)
+	for {
+		rcpt, err := firstReceipt(ctx, client, hashes)
+		switch {
+		case errors.Is(err, ethereum.NotFound):
+			if included != nil {
+				e.ui.Warnf("warning: reorg: tx %s dropped from block %s (%s), waiting again\n", included.TxHash.Hex(), included.BlockNumber, included.BlockHash.Hex())
+				e.metrics.reorg()
+				dropped := included.TxHash
+				included, reported = nil, 0
+				if opts.reorged != nil {
+					if err := opts.reorged(dropped); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if opts.stalled != nil {
+				next, err := opts.stalled()
+				if err != nil {
+					return nil, err
+				}
+				if next != nil {
+					hashes = append(hashes, next.Hash())
+				}
+			}
+			if opts.Progress != nil && opts.ProgressEvery > 0 && time.Since(lastProgress) >= opts.ProgressEvery {
+				lastProgress = time.Now()
+				if head, err := client.BlockNumber(ctx); err == nil && head >= startBlock {
+					opts.Progress(time.Since(start).Round(time.Second), head-startBlock)
+				}
+			}
+		case err != nil:
+			if stopped(ctx) {
+				return nil, waitStopped(parent, client, hashes[len(hashes)-1], opts.Timeout)
+			}
+			return nil, fmt.Errorf("receipt: %w", err)
+		default:
+			if included != nil && (rcpt.TxHash != included.TxHash || rcpt.BlockHash != included.BlockHash) {
+				e.ui.Warnf("warning: reorg: tx %s moved from block %s (%s) to %s (%s), recounting\n", rcpt.TxHash.Hex(), included.BlockNumber, included.BlockHash.Hex(), rcpt.BlockNumber, rcpt.BlockHash.Hex())
+				e.metrics.reorg()
+				reported = 0
+			}
+			included = rcpt
+			if n == 1 {
+				return rcpt, nil
+			}
+			head, err := client.BlockNumber(ctx)
+			if err != nil {
+				if stopped(ctx) {
+					return nil, waitStopped(parent, client, rcpt.TxHash, opts.Timeout)
+				}
+				return nil, fmt.Errorf("block number: %w", err)
+			}
+			got := uint64(0)
+			if mined := rcpt.BlockNumber.Uint64(); head >= mined {
+				got = head - mined + 1
+			}
+			if got > n {
+				got = n
+			}
+			if got != reported {
+				e.ui.Printf("  %d/%d confirmations\n", got, n)
+				reported = got
+			}
+			if got >= n {
+				canonical, err := client.HeaderByNumber(ctx, rcpt.BlockNumber)
+				if err != nil {
+					if stopped(ctx) {
+						return nil, waitStopped(parent, client, rcpt.TxHash, opts.Timeout)
+					}
+					return nil, fmt.Errorf("block %s: %w", rcpt.BlockNumber, err)
+				}
+				if canonical.Hash() == rcpt.BlockHash {
+					return rcpt, nil
+				}
+				if rcpt.BlockHash != orphaned {
+					e.ui.Warnf("warning: reorg: tx %s's receipt is from block %s, no longer the canonical block %s at height %s; waiting for the node to catch up\n", rcpt.TxHash.Hex(), rcpt.BlockHash.Hex(), canonical.Hash().Hex(), rcpt.BlockNumber)
+					e.metrics.reorg()
+					orphaned = rcpt.BlockHash
+				}
+				reported = 0
+			}
+		}
+		// Polls fall on multiples of the interval, so concurrent waits
+		// poll together and their receipts share a batch.
+		next := time.NewTimer(time.Until(time.Now().Truncate(interval).Add(interval)))
+		select {
+		case <-ctx.Done():
+			next.Stop()
+			return nil, waitStopped(parent, client, hashes[len(hashes)-1], opts.Timeout)
+		case <-next.C:
+		}
+	}
+}
+
+// stopped reports whether ctx is done or past its deadline. A transport
+// that takes its own deadline from ctx, such as IPC, can fail a request
+// with an i/o timeout a moment before ctx itself expires.
+func stopped(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	deadline, ok := ctx.Deadline()
+	return ok && !time.Now().Before(deadline)
+}
+
+// waitStopped explains why a wait ended early. A canceled parent returns
+// its error as is; an expired timeout asks the node what became of hash.
+func waitStopped(parent context.Context, client receiptBackend, hash common.Hash, timeout time.Duration) error {
+	if parent.Err() != nil {
+		return parent.Err()
+	}
+	qctx, cancel := context.WithTimeout(parent, 10*time.Second)
+	defer cancel()
+	_, pending, err := client.TransactionByHash(qctx, hash)
+	switch {
+	case errors.Is(err, ethereum.NotFound):
+		return fmt.Errorf("%w after %s: tx %s is no longer known to the node (dropped or replaced)", errWaitTimeout, timeout, hash.Hex())
+	case err != nil:
+		return fmt.Errorf("%w after %s waiting for tx %s (status unknown: %w)", errWaitTimeout, timeout, hash.Hex(), err)
+	case pending:
+		return fmt.Errorf("%w after %s: tx %s is still pending", errWaitTimeout, timeout, hash.Hex())
+	}
+	return fmt.Errorf("%w after %s: tx %s is mined but its receipt is not available yet", errWaitTimeout, timeout, hash.Hex())
+}
+
+// firstReceipt returns the receipt of whichever of hashes is included, or
+// ethereum.NotFound if none is. At most one can be, since they share a
+// nonce.
+func firstReceipt(ctx context.Context, client receiptBackend, hashes []common.Hash) (*types.Receipt, error) {
+	for _, h := range hashes {
+		rcpt, err := client.TransactionReceipt(ctx, h)
+		if err != nil && strings.Contains(err.Error(), "transaction indexing is in progress") {
+			// Geth has not indexed its recent blocks yet, so it cannot
+			// tell; the receipt may well be in one of them.
+			err = ethereum.NotFound
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return rcpt, err
+		}
+	}
+	return nil, ethereum.NotFound
+}
@@ -0,0 +1,296 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// syncBuffer is a bytes.Buffer a wait can print to while the test reads
+// it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// await fails the test unless s shows up within a few seconds.
+func (b *syncBuffer) await(t *testing.T, s string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(b.String(), s) {
+		if time.Now().After(deadline) {
+			t.Fatalf("no %q in output:\n%s", s, b.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// progress collects the progress and warnings the code under test prints
+// until the test ends.
+func progress(t *testing.T) *syncBuffer {
+	t.Helper()
+	var buf syncBuffer
+	errw, warnw := ui.errw, ui.warnw
+	ui.errw, ui.warnw = &buf, &buf
+	ui.setFormat(false)
+	t.Cleanup(func() {
+		ui.errw, ui.warnw = errw, warnw
+		ui.setFormat(false)
+	})
+	return &buf
+}
+
+type waitResult struct {
+	rcpt *types.Receipt
+	err  error
+}
+
+// waitAsync runs WaitForReceipt for hash on the chain, polling every
+// 5ms, and delivers its result.
+func waitAsync(t *testing.T, chain *simChain, hash common.Hash, opts WaitOptions) <-chan waitResult {
+	opts.Interval = 5 * time.Millisecond
+	done := make(chan waitResult, 1)
+	go func() {
+		rcpt, err := WaitForReceipt(t.Context(), chain.Client(), hash, opts)
+		done <- waitResult{rcpt, err}
+	}()
+	return done
+}
+
+// running fails the test if the wait has returned.
+func running(t *testing.T, done <-chan waitResult) {
+	t.Helper()
+	select {
+	case r := <-done:
+		t.Fatalf("wait returned early: %v, %v", r.rcpt, r.err)
+	case <-time.After(30 * time.Millisecond):
+	}
+}
+
+// finished returns the wait's result, failing the test if it does not
+// come soon.
+func finished(t *testing.T, done <-chan waitResult) waitResult {
+	t.Helper()
+	select {
+	case r := <-done:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait did not return")
+	}
+	return waitResult{}
+}
+
+func TestWaitForReceiptConfirmations(t *testing.T) {
+	out := progress(t)
+	chain := newSimChain(t)
+	tx := sendTransfer(t, chain, 0)
+	done := waitAsync(t, chain, tx.Hash(), WaitOptions{Confirmations: 3})
+
+	running(t, done)
+	block := chain.Commit()
+	out.await(t, "1/3 confirmations")
+	running(t, done)
+	chain.Commit()
+	out.await(t, "2/3 confirmations")
+	running(t, done)
+	chain.Commit()
+	r := finished(t, done)
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if r.rcpt.TxHash != tx.Hash() || r.rcpt.BlockHash != block {
+		t.Fatalf("receipt of %s in %s, want %s in %s", r.rcpt.TxHash.Hex(), r.rcpt.BlockHash.Hex(), tx.Hash().Hex(), block.Hex())
+	}
+	if n := strings.Count(out.String(), "confirmations\n"); n != 3 {
+		t.Fatalf("reported confirmations %d times, want once per block:\n%s", n, out)
+	}
+
+	// Already deep enough: one poll.
+	start := time.Now()
+	rcpt, err := WaitForReceipt(t.Context(), chain.Client(), tx.Hash(), WaitOptions{Confirmations: 2, Interval: time.Hour})
+	if err != nil || rcpt.BlockHash != block || time.Since(start) > time.Second {
+		t.Fatalf("wait for a buried tx = %v, %v after %s", rcpt, err, time.Since(start))
+	}
+}
+
+// TestWaitForReceiptReorgMoved forks the chain below the block holding
+// the transaction; the fork includes it again, in a block of its own.
+func TestWaitForReceiptReorgMoved(t *testing.T) {
+	out := progress(t)
+	chain := newSimChain(t)
+	genesis, err := chain.Client().HeaderByNumber(t.Context(), common.Big0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := sendTransfer(t, chain, 0)
+	done := waitAsync(t, chain, tx.Hash(), WaitOptions{Confirmations: 3})
+	orphan := chain.Commit()
+	out.await(t, "1/3 confirmations")
+
+	if err := chain.Fork(genesis.Hash()); err != nil {
+		t.Fatal(err)
+	}
+	block := chain.Commit()
+	chain.Commit() // the fork is now the longer chain
+	running(t, done)
+	chain.Commit()
+	r := finished(t, done)
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if r.rcpt.BlockHash != block || block == orphan {
+		t.Fatalf("receipt in %s, want the fork's block %s, not %s", r.rcpt.BlockHash.Hex(), block.Hex(), orphan.Hex())
+	}
+	if !strings.Contains(out.String(), "warning: reorg: tx "+tx.Hash().Hex()) {
+		t.Fatalf("no reorg warning in:\n%s", out)
+	}
+}
+
+// TestWaitForReceiptReorgDropped forks below the transaction's block and
+// drops it from the pool, so the fork leaves it out. The wait hands the
+// dropped hash to its reorged hook, which a send would resend; here the
+// test does.
+func TestWaitForReceiptReorgDropped(t *testing.T) {
+	out := progress(t)
+	chain := newSimChain(t)
+	genesis, err := chain.Client().HeaderByNumber(t.Context(), common.Big0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := sendTransfer(t, chain, 0)
+	dropped := make(chan common.Hash, 1)
+	done := waitAsync(t, chain, tx.Hash(), WaitOptions{Confirmations: 2, reorged: func(h common.Hash) error {
+		dropped <- h
+		return nil
+	}})
+	chain.Commit()
+	out.await(t, "1/2 confirmations")
+
+	if err := chain.Fork(genesis.Hash()); err != nil {
+		t.Fatal(err)
+	}
+	chain.Rollback()
+	// The fork becomes canonical once it is as long, or longer.
+	var h common.Hash
+	for h == (common.Hash{}) {
+		chain.Commit()
+		select {
+		case h = <-dropped:
+		case <-time.After(100 * time.Millisecond):
+			if n, _ := chain.Client().BlockNumber(t.Context()); n > 3 {
+				t.Fatalf("reorged hook not called at height %d; output:\n%s", n, out)
+			}
+		}
+	}
+	if h != tx.Hash() {
+		t.Fatalf("reorged hook got %s, want %s", h.Hex(), tx.Hash().Hex())
+	}
+	out.await(t, "dropped from block 1")
+	running(t, done)
+
+	if err := chain.Client().SendTransaction(t.Context(), tx); err != nil {
+		t.Fatal(err)
+	}
+	block := chain.Commit()
+	running(t, done)
+	chain.Commit()
+	r := finished(t, done)
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if r.rcpt.BlockHash != block {
+		t.Fatalf("receipt in block %s (%s), want the resend's block %s", r.rcpt.BlockNumber, r.rcpt.BlockHash.Hex(), block.Hex())
+	}
+}
+
+func TestWaitForReceiptTimeout(t *testing.T) {
+	chain := newSimChain(t)
+	tx := sendTransfer(t, chain, 0)
+
+	var calls int
+	var blocks uint64
+	opts := WaitOptions{
+		Interval: 5 * time.Millisecond, Timeout: 100 * time.Millisecond, ProgressEvery: 10 * time.Millisecond,
+		Progress: func(_ time.Duration, b uint64) { calls++; blocks = b },
+	}
+	_, err := WaitForReceipt(t.Context(), chain.Client(), tx.Hash(), opts)
+	if !errors.Is(err, errWaitTimeout) || !strings.Contains(err.Error(), "tx "+tx.Hash().Hex()+" is still pending") {
+		t.Fatalf("wait for an unmined tx = %v, want a timeout saying it is pending", err)
+	}
+	if calls == 0 || blocks != 0 {
+		t.Fatalf("progress called %d times with %d blocks, want some calls and no blocks", calls, blocks)
+	}
+
+	chain.Commit()
+	unknown := common.HexToHash("0x01")
+	_, err = WaitForReceipt(t.Context(), chain.Client(), unknown, WaitOptions{Interval: 5 * time.Millisecond, Timeout: 30 * time.Millisecond})
+	if !errors.Is(err, errWaitTimeout) || !strings.Contains(err.Error(), "no longer known to the node") {
+		t.Fatalf("wait for an unknown tx = %v, want a timeout saying it is gone", err)
+	}
+
+	// Cancelling the caller's context is not a timeout.
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, err := WaitForReceipt(ctx, chain.Client(), tx.Hash(), WaitOptions{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("wait with a cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+// TestWaitForReceiptCancel cancels a wait while it is polling for a
+// receipt: it must return context.Canceled within one poll interval.
+func TestWaitForReceiptCancel(t *testing.T) {
+	chain := newSimChain(t)
+	tx := sendTransfer(t, chain, 0)
+
+	const interval = 200 * time.Millisecond
+	polled := make(chan struct{}, 1)
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	done := make(chan waitResult, 1)
+	go func() {
+		rcpt, err := WaitForReceipt(ctx, chain.Client(), tx.Hash(), WaitOptions{
+			Interval: interval, ProgressEvery: time.Nanosecond,
+			Progress: func(time.Duration, uint64) {
+				select {
+				case polled <- struct{}{}:
+				default:
+				}
+			},
+		})
+		done <- waitResult{rcpt, err}
+	}()
+
+	select {
+	case <-polled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait never polled")
+	}
+	cancel()
+	cancelled := time.Now()
+	r := finished(t, done)
+	if !errors.Is(r.err, context.Canceled) {
+		t.Fatalf("wait cancelled mid-poll = %v, %v, want context.Canceled", r.rcpt, r.err)
+	}
+	if took := time.Since(cancelled); took > interval {
+		t.Fatalf("wait returned %s after cancel, want within one poll interval (%s)", took, interval)
+	}
+}
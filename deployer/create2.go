@@ -0,0 +1,121 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// deterministicDeployer is the canonical CREATE2 deployment proxy, present
+// on Anvil and most public chains. Its calldata is salt ++ init code.
+var deterministicDeployer = common.HexToAddress("0x4e59b44847b379578588920cA78FbF26c0B4956C")
+
+// parseSalt reads a hex salt of at most 32 bytes, left-padding shorter
+// values. An empty string is the zero salt.
+func parseSalt(s string) ([32]byte, error) {
+	var salt [32]byte
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "0x"), "0X")
+	if len(s)%2 == 1 {
+		s = "0" + s
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return salt, fmt.Errorf("salt: invalid hex: %w", err)
+	}
+	if len(b) > 32 {
+		return salt, fmt.Errorf("salt: %d bytes, want at most 32", len(b))
+	}
+	copy(salt[32-len(b):], b)
+	return salt, nil
+}
+
+// initCode is the creation bytecode followed by the ABI-encoded
+// constructor arguments.
+func initCode(c *Artifact, args []interface{}) ([]byte, error) {
+	packed, err := c.ABI.Pack("", args...)
+	if err != nil {
+		return nil, fmt.Errorf("encode constructor args: %w", err)
+	}
+	return append(bytes.Clone(c.Bytecode), packed...), nil
+}
+
+// create2Address predicts where the deterministic deployer puts initCode.
+func create2Address(salt [32]byte, initCode []byte) common.Address {
+	return crypto.CreateAddress2(deterministicDeployer, salt, crypto.Keccak256(initCode))
+}
+
+// deployCreate2 deploys c through the deterministic deployer. If code
+// already exists at the predicted address it returns that address with a
+// nil receipt and sends nothing.
+func (s *session) deployCreate2(ctx context.Context, c *Artifact, salt [32]byte, txo txOptions, args ...interface{}) (common.Address, *types.Receipt, error) {
+	code, err := initCode(c, args)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	address := create2Address(salt, code)
+	s.ui.Printf("CREATE2 predicted address: %s (salt 0x%x)\n", address.Hex(), salt)
+
+	existing, err := s.client.CodeAt(ctx, address, nil)
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("get code at %s: %w", address.Hex(), err)
+	}
+	if len(existing) > 0 {
+		s.ui.Printf("%s already deployed at %s\n", c.Name, address.Hex())
+		return address, nil, nil
+	}
+	proxyCode, err := s.client.CodeAt(ctx, deterministicDeployer, nil)
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("get code at %s: %w", deterministicDeployer.Hex(), err)
+	}
+	if len(proxyCode) == 0 {
+		return common.Address{}, nil, fmt.Errorf("deterministic deployer %s is not deployed on chain %s", deterministicDeployer.Hex(), s.chainID)
+	}
+
+	auth, err := s.opts(ctx, txo)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	s.ui.Println("Fees:", describeFees(auth))
+	printInitCode(s.ui, c, code)
+	to := deterministicDeployer
+	if err := s.preflight(ctx, auth, ethereum.CallMsg{To: &to, Data: append(salt[:], code...)}, &c.ABI, code, c.DeployedBytecode, nil); err != nil {
+		return common.Address{}, nil, fmt.Errorf("create2 deploy %s: %w", c.Name, err)
+	}
+
+	proxy := bind.NewBoundContract(deterministicDeployer, abi.ABI{}, s.client, s.client, s.client)
+	sum := constructorSummary(c, args)
+	sum.to, sum.call, sum.created = &to, "CREATE2 "+sum.call, &address
+	tx, err := s.submit(ctx, auth, sum, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return proxy.RawTransact(opts, append(salt[:], code...))
+	})
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("create2 deploy %s: %w", c.Name, explainError(err, &c.ABI))
+	}
+	s.ui.Printf("Deploy tx: %s (type %d)\n", tx.Hash().Hex(), tx.Type())
+	s.ui.link("tx", tx.Hash().Hex())
+	s.ui.Verbosef("  nonce %d, gas limit %d\n", tx.Nonce(), tx.Gas())
+
+	rcpt, err := s.waitMined(ctx, tx)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	if rcpt.Status != 1 {
+		reason := failureReason(ctx, s.client, tx, rcpt, &c.ABI)
+		return common.Address{}, rcpt, &RevertError{TxHash: tx.Hash(), Reason: reason, msg: fmt.Sprintf("deployment failed: status %d: %s", rcpt.Status, reason)}
+	}
+	if err := s.checkCode(ctx, address, rcpt); err != nil {
+		return common.Address{}, rcpt, fmt.Errorf("create2 deploy %s: %w", c.Name, err)
+	}
+	s.ui.Printf("%s deployed at: %s\n", c.Name, address.Hex())
+	s.ui.link("address", address.Hex())
+	return address, rcpt, nil
+}
@@ -0,0 +1,62 @@
+package deployer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TestCreate2Address checks the examples of EIP-1014, with the deployer
+// they use in place of the deterministic deployment proxy.
+func TestCreate2Address(t *testing.T) {
+	proxy := deterministicDeployer
+	t.Cleanup(func() { deterministicDeployer = proxy })
+
+	for _, tt := range []struct {
+		deployer, salt, initCode, want string
+	}{
+		{"0x0000000000000000000000000000000000000000", "0x0000000000000000000000000000000000000000000000000000000000000000", "0x00", "0x4D1A2e2bB4F88F0250f26Ffff098B0b30B26BF38"},
+		{"0xdeadbeef00000000000000000000000000000000", "0x0000000000000000000000000000000000000000000000000000000000000000", "0x00", "0xB928f69Bb1D91Cd65274e3c79d8986362984fDA3"},
+		{"0xdeadbeef00000000000000000000000000000000", "0x000000000000000000000000feed000000000000000000000000000000000000", "0x00", "0xD04116cDd17beBE565EB2422F2497E06cC1C9833"},
+		{"0x0000000000000000000000000000000000000000", "0x0000000000000000000000000000000000000000000000000000000000000000", "0xdeadbeef", "0x70f2b2914A2a4b783FaEFb75f459A580616Fcb5e"},
+		{"0x00000000000000000000000000000000deadbeef", "0x00000000000000000000000000000000000000000000000000000000cafebabe", "0xdeadbeef", "0x60f3f640a8508fC6a86d45DF051962668E1e8AC7"},
+		{"0x00000000000000000000000000000000deadbeef", "0x00000000000000000000000000000000000000000000000000000000cafebabe", "0x" + strings.Repeat("deadbeef", 11), "0x1d8bfDC5D46DC4f61D6b6115972536eBE6A8854C"},
+		{"0x0000000000000000000000000000000000000000", "0x0000000000000000000000000000000000000000000000000000000000000000", "0x", "0xE33C0C7F7df4809055C3ebA6c09CFe4BaF1BD9e0"},
+	} {
+		deterministicDeployer = common.HexToAddress(tt.deployer)
+		salt, err := parseSalt(tt.salt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := create2Address(salt, common.FromHex(tt.initCode)); got.Hex() != tt.want {
+			t.Errorf("deployer %s, salt %s, init code %.12s: %s, want %s", tt.deployer, tt.salt, tt.initCode, got.Hex(), tt.want)
+		}
+	}
+}
+
+func TestParseSalt(t *testing.T) {
+	cafebabe := "0x00000000000000000000000000000000000000000000000000000000cafebabe"
+	for _, tt := range []struct {
+		in, want string // want the salt in hex, or the error
+	}{
+		{"", "0x" + strings.Repeat("0", 64)},
+		{"cafebabe", cafebabe},
+		{" 0XCAFEBABE\n", cafebabe},
+		{"0xafebabe", "0x000000000000000000000000000000000000000000000000000000000afebabe"},
+		{cafebabe, cafebabe},
+		{"0x" + strings.Repeat("ff", 33), "salt: 33 bytes, want at most 32"},
+		{"0xfeedme", "salt: invalid hex: encoding/hex: invalid byte: U+006D 'm'"},
+	} {
+		salt, err := parseSalt(tt.in)
+		got := common.Bytes2Hex(salt[:])
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = "0x" + got
+		}
+		if got != tt.want {
+			t.Errorf("parseSalt(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
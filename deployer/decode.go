@@ -0,0 +1,424 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	defaultSignatureDB = "https://api.openchain.xyz/signature-database/v1"
+	defaultFourByteDB  = "https://www.4byte.directory/api/v1"
+)
+
+// decodeOptions are the flags of `decode` and `trace` for selectors no
+// local ABI knows.
+type decodeOptions struct {
+	online      bool
+	signatureDB string
+	fourByteDB  string
+	cache       string
+	seed        string
+}
+
+func (o *decodeOptions) register(fs *flag.FlagSet) {
+	fs.BoolVar(&o.online, "online", false, "look up selectors no local ABI knows in the openchain signature database, then 4byte.directory")
+	fs.StringVar(&o.signatureDB, "signature-db", defaultSignatureDB, "openchain-compatible signature database URL")
+	fs.StringVar(&o.fourByteDB, "fourbyte-db", defaultFourByteDB, "4byte.directory-compatible API URL tried when the signature database finds nothing (empty disables)")
+	fs.StringVar(&o.cache, "selector-cache", defaultSelectorCache(), "file caching the signatures of looked-up selectors (empty disables)")
+	fs.StringVar(&o.seed, "signatures", "", "JSON `file` of signatures to add to the selector cache, for use offline")
+}
+
+// decoded is calldata matched against an ABI.
+type decoded struct {
+	contract string // artifact the match came from; empty for --online
+	method   *abi.Method
+	ctor     bool
+	args     []interface{}
+
+	// candidates are every signature the selector database has for the
+	// selector, when the match came from it.
+	candidates []string
+}
+
+// scanArtifacts loads every artifact under dir that parses, skipping
+// Foundry build-info and Hardhat debug files.
+func scanArtifacts(dir string) []*Artifact {
+	var arts []*Artifact
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == "build-info" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".json") || strings.HasSuffix(path, ".dbg.json") {
+			return nil
+		}
+		if a, err := LoadArtifact(path, ""); err == nil {
+			arts = append(arts, a)
+		}
+		return nil
+	})
+	return arts
+}
+
+// hasCodePrefix reports whether data starts with a's creation code, with
+// library placeholders matching any address.
+func hasCodePrefix(a *Artifact, data []byte) bool {
+	if len(a.Bytecode) == 0 || len(data) < len(a.Bytecode) {
+		return false
+	}
+	code := bytes.Clone(data[:len(a.Bytecode)])
+	for _, lib := range a.Libraries {
+		for _, r := range lib.Offsets {
+			if r.Start+r.Length <= len(code) {
+				copy(code[r.Start:r.Start+r.Length], a.Bytecode[r.Start:r.Start+r.Length])
+			}
+		}
+	}
+	return bytes.Equal(code, a.Bytecode)
+}
+
+// decodeLocal matches data against arts: as creation code followed by
+// constructor arguments, or by its selector. Matches that fail to decode
+// are skipped, so a colliding selector does not hide the right one.
+func decodeLocal(arts []*Artifact, data []byte) *decoded {
+	for _, a := range arts {
+		if !hasCodePrefix(a, data) {
+			continue
+		}
+		ctor := a.ABI.Constructor
+		args, err := ctor.Inputs.Unpack(data[len(a.Bytecode):])
+		if err == nil {
+			return &decoded{contract: a.Name, method: &ctor, ctor: true, args: args}
+		}
+	}
+	if len(data) < 4 {
+		return nil
+	}
+	for _, a := range arts {
+		m := newSelectorIndex(&a.ABI).lookup(data)
+		if m == nil {
+			continue
+		}
+		if args, err := m.Inputs.Unpack(data[4:]); err == nil {
+			return &decoded{contract: a.Name, method: m, args: args}
+		}
+	}
+	return nil
+}
+
+// methodFromSignature builds a method from a text signature such as
+// "swap((address,uint256)[],bytes)", or from a human-readable fragment
+// such as "function balanceOf(address owner) view returns (uint256)" or
+// "event Transfer(address indexed from, address indexed to, uint256)".
+// Parameter names are ignored and uint and int mean uint256 and int256,
+// as in Solidity.
+func methodFromSignature(sig string) (*abi.Method, error) {
+	sig = strings.TrimSpace(sig)
+	open := strings.IndexByte(sig, '(')
+	if open <= 0 {
+		return nil, fmt.Errorf("bad signature %q", sig)
+	}
+	name := strings.TrimSpace(sig[:open])
+	if !isIdentifier(name) || slices.Contains(fragmentKinds, name) || closingParen(sig, open) != len(sig)-1 {
+		// A keyword before the name, or modifiers and returns after
+		// the parameters: only a full fragment has those.
+		return fragmentMethod(sig)
+	}
+	params, err := signatureTypes(sig[open+1 : len(sig)-1])
+	if err != nil {
+		return nil, fmt.Errorf("bad signature %q: %w", sig, err)
+	}
+	var inputs abi.Arguments
+	for i, p := range params {
+		t, err := abi.NewType(p.Type, "", p.Components)
+		if err != nil {
+			return nil, fmt.Errorf("bad signature %q: %w", sig, err)
+		}
+		inputs = append(inputs, abi.Argument{Name: fmt.Sprintf("arg%d", i), Type: t})
+	}
+	m := abi.NewMethod(name, name, abi.Function, "", false, false, inputs, nil)
+	return &m, nil
+}
+
+// closingParen is the index of the parenthesis closing the one at open
+// in s, or -1.
+func closingParen(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// fragmentMethod is methodFromSignature for a human-readable function,
+// event or error fragment, whose selector or topic comes from its name
+// and input types alone.
+func fragmentMethod(sig string) (*abi.Method, error) {
+	p, err := newFragmentParser(sig)
+	if err != nil {
+		return nil, fmt.Errorf("bad signature %q: %w", sig, err)
+	}
+	e, err := p.entry()
+	if err != nil {
+		return nil, fmt.Errorf("bad signature %q: %w", sig, err)
+	}
+	switch e.Type {
+	case "function", "event", "error":
+	default:
+		return nil, fmt.Errorf("bad signature %q: a %s has no selector", sig, e.Type)
+	}
+	args := func(params []abiParam) (abi.Arguments, error) {
+		var out abi.Arguments
+		for i, param := range params {
+			m := param.marshaling()
+			t, err := abi.NewType(m.Type, "", m.Components)
+			if err != nil {
+				return nil, fmt.Errorf("bad signature %q: %w", sig, err)
+			}
+			out = append(out, abi.Argument{Name: fmt.Sprintf("arg%d", i), Type: t, Indexed: param.Indexed})
+		}
+		return out, nil
+	}
+	inputs, err := args(e.Inputs)
+	if err != nil {
+		return nil, err
+	}
+	outputs, err := args(e.Outputs)
+	if err != nil {
+		return nil, err
+	}
+	m := abi.NewMethod(e.Name, e.Name, abi.Function, e.StateMutability, false, e.StateMutability == "payable", inputs, outputs)
+	return &m, nil
+}
+
+// canonicalType is a signature parameter as the ABI spells it: without
+// its name, and with uint and int widened to 256 bits.
+func canonicalType(param string) string {
+	typ, _, _ := strings.Cut(strings.TrimSpace(param), " ")
+	for _, alias := range []string{"uint", "int"} {
+		if rest, ok := strings.CutPrefix(typ, alias); ok && (rest == "" || rest[0] == '[') {
+			return alias + "256" + rest
+		}
+	}
+	return typ
+}
+
+// signatureTypes splits a comma-separated type list, turning
+// parenthesized tuples into tuple types with components.
+func signatureTypes(list string) ([]abi.ArgumentMarshaling, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var out []abi.ArgumentMarshaling
+	depth, start := 0, 0
+	for i := 0; i <= len(list); i++ {
+		if i < len(list) {
+			switch list[i] {
+			case '(':
+				depth++
+				continue
+			case ')':
+				depth--
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		if depth != 0 {
+			return nil, errors.New("unbalanced parentheses")
+		}
+		typ := strings.TrimSpace(list[start:i])
+		arg := abi.ArgumentMarshaling{Name: fmt.Sprintf("f%d", len(out)), Type: canonicalType(typ)}
+		if strings.HasPrefix(typ, "(") {
+			end := strings.LastIndexByte(typ, ')')
+			comps, err := signatureTypes(typ[1:end])
+			if err != nil {
+				return nil, err
+			}
+			arg.Type, arg.Components = "tuple"+canonicalType(typ[end+1:]), comps
+		}
+		out = append(out, arg)
+		start = i + 1
+	}
+	return out, nil
+}
+
+// decodeInput decodes data with the local artifacts, then the selector
+// database, and prints the result. to is the transaction's recipient, if
+// known, and creation is set when data is creation code; calls to the
+// CREATE2 deployer are decoded as the creation they carry.
+func decodeInput(ctx context.Context, arts []*Artifact, sigs *selectorDB, to *common.Address, creation bool, data []byte, report *DecodedReport) error {
+	if len(data) == 0 {
+		ui.Resultln("Input: none (plain transfer)")
+		return nil
+	}
+	if to != nil && *to == deterministicDeployer && len(data) > 32 {
+		ui.Resultf("CREATE2 salt: %s\n", hexutil.Encode(data[:32]))
+		data, creation = data[32:], true
+	}
+	d := decodeLocal(arts, data)
+	if creation && (d == nil || !d.ctor) {
+		return fmt.Errorf("the creation code matches none of the %d artifacts searched (different source or compiler settings?)", len(arts))
+	}
+	if d == nil && len(data) >= 4 {
+		var err error
+		if d, err = sigs.decode(ctx, data); err != nil {
+			return err
+		}
+	}
+	if d == nil {
+		if len(data) < 4 {
+			return fmt.Errorf("input %s is shorter than a selector and matches no creation code", hexutil.Encode(data))
+		}
+		hint := ""
+		if !sigs.o.online {
+			hint = "; try --online"
+		}
+		return fmt.Errorf("no known function has selector %s (%d artifacts searched)%s", hexutil.Encode(data[:4]), len(arts), hint)
+	}
+
+	from := "from " + d.contract
+	if d.contract == "" {
+		from = "signature database, parameter names unknown"
+	}
+	if d.ctor {
+		ui.Resultf("Constructor of %s\n", d.contract)
+		report.Function = "constructor"
+	} else {
+		ui.Resultf("Function: %s (%s)\n", d.method.Sig, from)
+		report.Function = d.method.Sig
+		report.Selector = hexutil.Encode(data[:4])
+		if len(d.candidates) > 1 {
+			ui.Resultf("  %d signatures share selector %s: %s\n", len(d.candidates), report.Selector, strings.Join(d.candidates, ", "))
+			report.Candidates = d.candidates
+		}
+	}
+	report.Contract = d.contract
+	report.Args = printValues(d.method.Inputs, d.args)
+	return nil
+}
+
+// runDecode implements `decode calldata <0xhex>` and `decode tx <hash>`.
+func runDecode(ctx context.Context, args []string) error {
+	usage := errors.New("usage: decode calldata [flags] <0xhex> | decode tx [flags] <hash>")
+	if len(args) == 0 || (args[0] != "calldata" && args[0] != "tx") {
+		return usage
+	}
+	mode := args[0]
+	fs := flag.NewFlagSet("decode "+mode, flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	var do decodeOptions
+	o.register(fs)
+	ao.register(fs, "")
+	do.register(fs)
+	var fragments fragmentList
+	fs.Var(&fragments, "sig", "decode with this human-readable ABI `fragment` instead of the artifacts (repeatable)")
+	if err := parseFlags(fs, args[1:], &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usage
+	}
+
+	var arts []*Artifact
+	if len(fragments) > 0 {
+		a, err := fragmentArtifact("fragments", fragments)
+		if err != nil {
+			return err
+		}
+		arts = []*Artifact{a}
+	} else if ao.path != "" || ao.contract != "" {
+		path, contract, err := ao.resolve()
+		if err != nil {
+			return err
+		}
+		a, err := loadABI(path, contract)
+		if err != nil {
+			return err
+		}
+		arts = []*Artifact{a}
+	} else {
+		arts = scanArtifacts(ao.outDir)
+		ui.Verbosef("Loaded %d artifacts from %s\n", len(arts), ao.outDir)
+	}
+	sigs, err := do.open()
+	if err != nil {
+		return err
+	}
+	defer sigs.save()
+	report := &DecodedReport{}
+	ui.report.Decoded = report
+
+	if mode == "calldata" {
+		data, err := hexutil.Decode(fs.Arg(0))
+		if err != nil {
+			return fmt.Errorf("invalid calldata %q: %w", fs.Arg(0), err)
+		}
+		return decodeInput(ctx, arts, sigs, nil, false, data, report)
+	}
+
+	raw, err := hexutil.Decode(fs.Arg(0))
+	if err != nil || len(raw) != common.HashLength {
+		return fmt.Errorf("invalid transaction hash %q", fs.Arg(0))
+	}
+	client, _, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	hash := common.BytesToHash(raw)
+	tx, pending, err := client.TransactionByHash(ctx, hash)
+	if err != nil {
+		return fmt.Errorf("get transaction %s: %w", hash.Hex(), err)
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return fmt.Errorf("recover sender: %w", err)
+	}
+	nonce := tx.Nonce()
+	report.Hash, report.From, report.To, report.Value, report.Nonce = &hash, &from, tx.To(), tx.Value().String(), &nonce
+
+	to := "CONTRACT CREATION"
+	if tx.To() != nil {
+		to = tx.To().Hex()
+	}
+	state := "mined"
+	if pending {
+		state = "pending"
+	}
+	ui.Resultf("Tx:    %s (%s)\n", hash.Hex(), state)
+	ui.Resultf("From:  %s\n", from.Hex())
+	ui.Resultf("To:    %s\n", to)
+	ui.Resultf("Value: %s ETH\n", formatEther(tx.Value()))
+	ui.Resultf("Nonce: %d\n", nonce)
+	return decodeInput(ctx, arts, sigs, tx.To(), tx.To() == nil, tx.Data(), report)
+}
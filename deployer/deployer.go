@@ -0,0 +1,165 @@
+// Package deployer deploys Solidity contracts from Foundry, Hardhat or
+// solc artifacts and calls them over JSON-RPC. It is the library behind
+// cmd/nyc2025: Dial a Client, LoadArtifact, then Deploy, Call and Send.
+// Progress is printed as the CLI prints it; Config.Output redirects it.
+package deployer
+
+import (
+	"context"
+	"flag"
+	"io"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Config configures Dial. Zero fields take the CLI's defaults.
+type Config struct {
+	// RPC lists the endpoints to fail over between; default RPC_URLS,
+	// RPC_URL or http://127.0.0.1:8545.
+	RPC []string
+	// ChainID, if set, makes Dial fail unless the node reports it.
+	ChainID uint64
+
+	// PrivateKey, Mnemonic and Keystore are key sources used when
+	// PRIVATE_KEY, MNEMONIC and KEYSTORE_PATH are all unset.
+	PrivateKey string
+	Mnemonic   string
+	Keystore   string
+
+	// MaxFee and PriorityFee override the fee policy, e.g. "30gwei".
+	MaxFee      string
+	PriorityFee string
+	// Confirmations is the depth WaitConfirmed waits for; default 1.
+	Confirmations uint64
+	// BroadcastDir, if set, is where Close writes the transactions sent
+	// in forge script's broadcast format, as the CLI's --broadcast-dir.
+	BroadcastDir string
+	// JournalDir, if set, is where each transaction is journaled before
+	// it is sent, as the CLI's --journal-dir. Unset, nothing is written.
+	JournalDir string
+	// Output, if set, gets the progress and results the Client would
+	// print to stderr and stdout; io.Discard silences them. Warnings
+	// still go to stderr.
+	Output io.Writer
+}
+
+// Client is a node connection with a signer and fee policy. It is not
+// safe for concurrent use.
+type Client struct {
+	s *session
+}
+
+// Dial connects to the node, checks its chain ID and loads the signing
+// key. There are no prompts: transactions are signed without showing a
+// summary, and mainnet deployments with a key from the environment are
+// allowed. Each Client prints and records metrics on its own.
+func Dial(ctx context.Context, cfg Config) (*Client, error) {
+	o := options{env: newEnv(os.Stdout, os.Stderr)}
+	if cfg.Output != nil {
+		o.ui.out, o.ui.errw = cfg.Output, cfg.Output
+		o.ui.setFormat(false)
+	}
+	fs := flag.NewFlagSet("deployer", flag.ContinueOnError)
+	o.register(fs)
+	o.rpc = cfg.RPC
+	o.expectChainID = cfg.ChainID
+	o.keys.PrivateKey, o.keys.Mnemonic, o.keys.Keystore = cfg.PrivateKey, cfg.Mnemonic, cfg.Keystore
+	o.maxFee, o.priorityFee = cfg.MaxFee, cfg.PriorityFee
+	o.broadcastDir, o.journalDir = cfg.BroadcastDir, cfg.JournalDir
+	if cfg.Confirmations > 0 {
+		o.confirmations = cfg.Confirmations
+	}
+	o.yes, o.preflight.confirmed = true, true
+	s, err := openSession(ctx, &o)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{s: s}, nil
+}
+
+// Describe and Collect make a Client a prometheus.Collector of its own
+// metrics, named as the CLI's --metrics-addr serves them: transactions
+// sent and mined, gas, reorgs, RPC latency and errors. Registering it
+// starts the recording.
+func (c *Client) Describe(ch chan<- *prometheus.Desc) {
+	c.s.metrics.enable()
+	c.s.metrics.Describe(ch)
+}
+
+func (c *Client) Collect(ch chan<- prometheus.Metric) {
+	c.s.metrics.Collect(ch)
+}
+
+// Close closes the node connection.
+func (c *Client) Close() {
+	c.s.Close()
+}
+
+// ChainID is the connected chain's ID.
+func (c *Client) ChainID() *big.Int {
+	return c.s.chainID
+}
+
+// From is the address transactions are sent from.
+func (c *Client) From() common.Address {
+	return c.s.from
+}
+
+// Deploy deploys art with the constructor arguments args, which must
+// already have the Go types the ABI expects, and waits until the creation
+// is confirmed. Libraries must already be linked. The record is not
+// written to a manifest. If another transaction took the nonce and the
+// contract landed away from its predicted address, the record says where
+// it is and the error is ErrNonceConflict.
+func (c *Client) Deploy(ctx context.Context, art *Artifact, args ...interface{}) (*Deployment, error) {
+	_, d, _, err := c.s.deployContract(ctx, art, deployOptions{tx: txOptions{nonce: -1}}, args)
+	if d == nil {
+		return nil, err
+	}
+	d.Artifact = art.Path
+	return d, err
+}
+
+// Call runs the view or pure method of art's ABI on the contract at
+// address against the latest block and returns its outputs.
+func (c *Client) Call(ctx context.Context, art *Artifact, address common.Address, method string, args ...interface{}) ([]interface{}, error) {
+	m, err := resolveMethod(&art.ABI, method)
+	if err != nil {
+		return nil, err
+	}
+	bound := bind.NewBoundContract(address, art.ABI, c.s.client, c.s.client, c.s.client)
+	return callMethod(ctx, bound, &art.ABI, m, nil, args)
+}
+
+// Send sends a transaction calling method on the contract at address and
+// waits until it is confirmed. A revert is returned as an error carrying
+// the decoded reason, together with the receipt.
+func (c *Client) Send(ctx context.Context, art *Artifact, address common.Address, method string, args ...interface{}) (*types.Receipt, error) {
+	tx, err := c.SendAsync(ctx, art, address, method, args...)
+	if err != nil {
+		return nil, err
+	}
+	return c.s.waitReceipt(ctx, tx, &art.ABI)
+}
+
+// SendAsync is Send without the wait; see WaitConfirmed.
+func (c *Client) SendAsync(ctx context.Context, art *Artifact, address common.Address, method string, args ...interface{}) (*types.Transaction, error) {
+	m, err := resolveMethod(&art.ABI, method)
+	if err != nil {
+		return nil, err
+	}
+	bound := bind.NewBoundContract(address, art.ABI, c.s.client, c.s.client, c.s.client)
+	return c.s.transact(ctx, bound, &art.ABI, m, args, txOptions{nonce: -1})
+}
+
+// WaitConfirmed waits until tx is buried under Config.Confirmations
+// blocks, following reorgs, and returns its receipt. It does not check
+// the receipt's status.
+func (c *Client) WaitConfirmed(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+	return c.s.waitMined(ctx, tx)
+}
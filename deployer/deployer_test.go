@@ -0,0 +1,355 @@
+package deployer
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestDeployAndGreet(t *testing.T) {
+	chain := newSimChain(t)
+	chain.autoCommit(t)
+	c := chain.dial(t, Config{})
+	ctx := t.Context()
+	art := greeter(t)
+
+	d, err := c.Deploy(ctx, art, "Hello from Go!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := chain.Client().CodeAt(ctx, d.Address, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := common.Bytes2Hex(code); got != greeterRuntime {
+		t.Fatalf("runtime code at %s = %s, want the fixture's", d.Address.Hex(), got)
+	}
+	out, err := c.Call(ctx, art, d.Address, "greet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != "Hello from Go!" {
+		t.Fatalf("greet() = %v, want [Hello from Go!]", out)
+	}
+}
+
+func TestDeployConstructorRevert(t *testing.T) {
+	chain := newSimChain(t)
+	chain.autoCommit(t)
+	c := chain.dial(t, Config{})
+	ctx := t.Context()
+	art := greeter(t)
+
+	// The gas estimate runs the constructor first, so nothing is sent.
+	_, err := c.Deploy(ctx, art, "")
+	if !errors.Is(err, ErrReverted) || !strings.Contains(err.Error(), greeterReason) {
+		t.Fatalf("Deploy(\"\") = %v, want a revert with %q", err, greeterReason)
+	}
+	if n, _ := chain.Client().NonceAt(ctx, testAddr, nil); n != 0 {
+		t.Fatalf("nonce after a failed estimate = %d, want 0", n)
+	}
+
+	// With the gas limit pinned the creation is mined and reverts.
+	_, _, _, err = c.s.deployContract(ctx, art, deployOptions{tx: txOptions{nonce: -1, gasLimit: 300_000}}, []interface{}{""})
+	var revert *RevertError
+	if !errors.As(err, &revert) {
+		t.Fatalf("mined constructor revert = %v, want a *RevertError", err)
+	}
+	if revert.TxHash == (common.Hash{}) || !strings.Contains(revert.Reason, greeterReason) {
+		t.Fatalf("revert = {tx %s, reason %q}, want the mined tx and %q", revert.TxHash.Hex(), revert.Reason, greeterReason)
+	}
+	rcpt, err := chain.Client().TransactionReceipt(ctx, revert.TxHash)
+	if err != nil || rcpt.Status != types.ReceiptStatusFailed {
+		t.Fatalf("receipt of %s = %v, %v; want a failed one", revert.TxHash.Hex(), rcpt, err)
+	}
+}
+
+// TestDeployNonceConflict sends a transfer from the deployer's key behind
+// the Client's back, at the nonce its next deploy has reserved: the deploy
+// fails with ErrNonceConflict before anything lands at the predicted
+// address, and the next one resyncs and lands where it predicts.
+func TestDeployNonceConflict(t *testing.T) {
+	chain := newSimChain(t)
+	chain.autoCommit(t)
+	c := chain.dial(t, Config{})
+	ctx := t.Context()
+
+	if _, err := c.Deploy(ctx, greeter(t), "one"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bind.WaitMined(ctx, chain.Client(), sendTransfer(t, chain, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := c.Deploy(ctx, greeter(t), "two")
+	if !errors.Is(err, ErrNonceConflict) || d != nil {
+		t.Fatalf("deploy at a taken nonce = %+v, %v; want ErrNonceConflict", d, err)
+	}
+	if code, err := chain.Client().CodeAt(ctx, crypto.CreateAddress(testAddr, 1), nil); err != nil || len(code) != 0 {
+		t.Fatalf("code at the predicted address of the failed deploy: %x (%v)", code, err)
+	}
+
+	d, err = c.Deploy(ctx, greeter(t), "three")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, _, err := chain.Client().TransactionByHash(ctx, d.TxHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := crypto.CreateAddress(testAddr, 2); tx.Nonce() != 2 || d.Address != want {
+		t.Fatalf("deploy after the conflict sent at nonce %d to %s, want nonce 2 and %s", tx.Nonce(), d.Address.Hex(), want.Hex())
+	}
+}
+
+func TestSendAndCall(t *testing.T) {
+	chain := newSimChain(t)
+	chain.autoCommit(t)
+	c := chain.dial(t, Config{})
+	ctx := t.Context()
+	art := greeter(t)
+
+	d, err := c.Deploy(ctx, art, "gm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rcpt, err := c.Send(ctx, art, d.Address, "setGreeting", "gn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rcpt.Status != types.ReceiptStatusSuccessful || len(rcpt.Logs) != 1 {
+		t.Fatalf("setGreeting receipt: status %d, %d logs; want success and GreetingChanged", rcpt.Status, len(rcpt.Logs))
+	}
+	if by := rcpt.Logs[0].Topics[1]; common.BytesToAddress(by[:]) != c.From() {
+		t.Fatalf("GreetingChanged by %s, want %s", common.BytesToAddress(by[:]).Hex(), c.From().Hex())
+	}
+	out, err := c.Call(ctx, art, d.Address, "greet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != "gn" {
+		t.Fatalf("greet() after setGreeting = %v, want [gn]", out)
+	}
+
+	if _, err := c.Call(ctx, art, d.Address, "greeet"); err == nil {
+		t.Fatal("Call of a method not in the ABI succeeded")
+	}
+	if _, err := c.Send(ctx, art, d.Address, "setGreeting"); err == nil {
+		t.Fatal("Send with a missing argument succeeded")
+	}
+}
+
+// TestSendMinedRevert pins the gas limit past the estimate, as --gas-limit
+// does, so the revert comes back in a receipt rather than an estimate.
+func TestSendMinedRevert(t *testing.T) {
+	chain := newSimChain(t)
+	chain.autoCommit(t)
+	c := chain.dial(t, Config{})
+	ctx := t.Context()
+	art := greeter(t)
+
+	d, err := c.Deploy(ctx, art, "gm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := resolveMethod(&art.ABI, "setGreeting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bound := bind.NewBoundContract(d.Address, art.ABI, c.s.client, c.s.client, c.s.client)
+	tx, err := c.s.transact(ctx, bound, &art.ABI, m, []interface{}{""}, txOptions{nonce: -1, gasLimit: 100_000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rcpt, err := c.s.waitReceipt(ctx, tx, &art.ABI)
+	var revert *RevertError
+	if !errors.As(err, &revert) || !errors.Is(err, ErrReverted) {
+		t.Fatalf("mined setGreeting(\"\") = %v, want a *RevertError", err)
+	}
+	if revert.TxHash != tx.Hash() || !strings.Contains(revert.Reason, greeterReason) {
+		t.Fatalf("revert = {tx %s, reason %q}, want %s and %q", revert.TxHash.Hex(), revert.Reason, tx.Hash().Hex(), greeterReason)
+	}
+	if rcpt == nil || rcpt.Status != types.ReceiptStatusFailed {
+		t.Fatalf("receipt with the revert = %v, want the failed one", rcpt)
+	}
+	if out, err := c.Call(ctx, art, d.Address, "greet"); err != nil || out[0] != "gm" {
+		t.Fatalf("greet() after the revert = %v, %v; want [gm]", out, err)
+	}
+}
+
+// TestJournalOptIn checks a library Client writes nothing to the working
+// directory unless Config.JournalDir asks for the journal.
+func TestJournalOptIn(t *testing.T) {
+	for _, journaled := range []bool{false, true} {
+		chain := newSimChain(t)
+		chain.autoCommit(t)
+		dir := filepath.Join(t.TempDir(), "journal")
+		cfg := Config{}
+		if journaled {
+			cfg.JournalDir = dir
+		}
+		c := chain.dial(t, cfg)
+		if _, err := c.Deploy(t.Context(), greeter(t), "gm"); err != nil {
+			t.Fatal(err)
+		}
+		c.Close()
+
+		if files, err := os.ReadDir("."); err != nil || len(files) != 0 {
+			t.Errorf("journaled %v: working directory holds %v (%v), want nothing", journaled, files, err)
+		}
+		_, err := os.Stat(filepath.Join(dir, "1337", "journal.json"))
+		if journaled && err != nil {
+			t.Errorf("no journal with JournalDir set: %v", err)
+		}
+		if !journaled && !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("journal written without JournalDir: %v", err)
+		}
+	}
+}
+
+func TestSendGasEstimateFails(t *testing.T) {
+	chain := newSimChain(t)
+	chain.autoCommit(t)
+	c := chain.dial(t, Config{})
+	ctx := t.Context()
+	art := greeter(t)
+
+	d, err := c.Deploy(ctx, art, "gm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.SendAsync(ctx, art, d.Address, "setGreeting", strings.Repeat("x", 33))
+	if err == nil || !strings.Contains(err.Error(), "estimate gas") || !strings.Contains(err.Error(), greeterReason) {
+		t.Fatalf("setGreeting(33 bytes) = %v, want a failed estimate with %q", err, greeterReason)
+	}
+	if !errors.Is(err, ErrReverted) {
+		t.Fatalf("failed estimate %v is not classed as a revert", err)
+	}
+	if n, _ := chain.Client().PendingNonceAt(ctx, testAddr); n != 1 {
+		t.Fatalf("pending nonce = %d, want 1: only the deployment was sent", n)
+	}
+}
+
+func TestWaitConfirmedAcrossCommits(t *testing.T) {
+	chain := newSimChain(t)
+	c := chain.dial(t, Config{Confirmations: 3})
+	ctx := t.Context()
+
+	tx := sendTransfer(t, chain, 0)
+	type result struct {
+		rcpt *types.Receipt
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		rcpt, err := c.WaitConfirmed(ctx, tx)
+		done <- result{rcpt, err}
+	}()
+	pending := func(commits int) {
+		t.Helper()
+		select {
+		case r := <-done:
+			t.Fatalf("WaitConfirmed returned after %d commits (%v, %v), want 3", commits, r.rcpt, r.err)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	pending(0)
+	chain.Commit() // mines tx: 1 confirmation
+	pending(1)
+	chain.Commit()
+	pending(2)
+	chain.Commit()
+	select {
+	case r := <-done:
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		if r.rcpt.TxHash != tx.Hash() || r.rcpt.BlockNumber.Uint64() != 1 {
+			t.Fatalf("receipt = tx %s in block %d, want %s in block 1", r.rcpt.TxHash.Hex(), r.rcpt.BlockNumber, tx.Hash().Hex())
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("WaitConfirmed did not return after 3 commits")
+	}
+}
+
+// TestClientOutput checks that each Client prints to its own
+// Config.Output and nothing reaches the commands' stdout or stderr.
+func TestClientOutput(t *testing.T) {
+	chain := newSimChain(t)
+	chain.autoCommit(t)
+	var cmds bytes.Buffer
+	out, errw, warnw := ui.out, ui.errw, ui.warnw
+	ui.out, ui.errw, ui.warnw = &cmds, &cmds, &cmds
+	ui.setFormat(false)
+	t.Cleanup(func() {
+		ui.out, ui.errw, ui.warnw = out, errw, warnw
+		ui.setFormat(false)
+	})
+
+	var first, second bytes.Buffer
+	a := chain.dial(t, Config{Output: &first})
+	b := chain.dial(t, Config{Output: &second})
+	art := greeter(t)
+	d, err := a.Deploy(t.Context(), art, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Send(t.Context(), art, d.Address, "setGreeting", "again"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(first.String(), "Greeter deployed at") || !strings.Contains(first.String(), "setGreeting tx:") {
+		t.Fatalf("first Client printed %q, want its deploy and send", first.String())
+	}
+	if strings.Contains(second.String(), "deployed at") {
+		t.Fatalf("second Client printed the first's deploy: %q", second.String())
+	}
+	if _, err := b.Deploy(t.Context(), greeter(t), "second"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(second.String(), "Greeter deployed at") {
+		t.Fatalf("second Client printed %q, want its deploy", second.String())
+	}
+	if cmds.Len() > 0 {
+		t.Fatalf("Clients printed to the commands' output: %q", cmds.String())
+	}
+	if a.s.metrics == b.s.metrics || a.s.metrics == cli.metrics {
+		t.Fatal("Clients share a metrics registry")
+	}
+}
+
+// TestDeployStdout checks a deploy prints only the address to stdout, as
+// `addr=$(nyc2025 deploy ...)` expects, and its progress to stderr; so
+// does a rerun that finds the deployment.
+func TestDeployStdout(t *testing.T) {
+	stderr := progress(t)
+	r := newDeployRun(t)
+	for range 2 {
+		if err := r.run(t); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := readManifest(manifestPath(r.dir, big.NewInt(1337), "Greeter"))
+	if err != nil || len(m.Deployments) != 1 {
+		t.Fatalf("manifest = %+v, %v; want one deployment", m, err)
+	}
+	addr := m.Deployments[0].Address.Hex()
+	if got, want := r.out.String(), addr+"\n"+addr+"\n"; got != want {
+		t.Fatalf("stdout = %q, want only the address, once per run", got)
+	}
+	for _, line := range []string{"Greeter deployed at: " + addr, "Recorded Greeter v1 in ", "Skipping deployment: Greeter already at " + addr} {
+		if !strings.Contains(stderr.String(), line) {
+			t.Errorf("stderr lacks %q:\n%s", line, stderr)
+		}
+	}
+}
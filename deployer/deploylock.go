@@ -0,0 +1,193 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// deployLockHeartbeat is how often a holder touches its lock; a
+// variable so tests can shorten it.
+var deployLockHeartbeat = 10 * time.Second
+
+// deployLockStale is the heartbeat age past which a lock is taken to be
+// left by a run that died, wherever it ran.
+const deployLockStale = time.Minute
+
+// errLockLost is the cause a deploy is canceled with when another run
+// took its lock.
+var errLockLost = errors.New("deployment lock lost")
+
+// lockHolder is the content of a deployment lock file.
+type lockHolder struct {
+	lockOwner
+	Contract string      `json:"contract"`
+	CodeHash common.Hash `json:"codeHash"`
+}
+
+// deployLock is an advisory lock on deploying one contract's bytecode to
+// one chain, held from the check for an existing deployment until the
+// manifest is written, so two runs cannot both deploy it. It is a file
+// next to the manifests that the holder keeps fresh with a heartbeat.
+type deployLock struct {
+	path   string
+	holder lockHolder
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	// ctx is the context lockDeployment was given, canceled with
+	// errLockLost if the lock is taken away while held: the deploy must
+	// run under it.
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+}
+
+// deployLockPath is where the lock on deploying c to chainID lives.
+func deployLockPath(dir string, chainID *big.Int, c *Artifact) string {
+	hash := crypto.Keccak256Hash(c.Bytecode)
+	return filepath.Join(dir, chainID.String(), fmt.Sprintf("%s.%x.lock", c.Name, hash[:4]))
+}
+
+// lockDeployment takes the lock on deploying c to chainID, waiting up to
+// timeout for another run to release it. A stale lock is taken over with
+// a warning.
+func lockDeployment(ctx context.Context, dir string, chainID *big.Int, c *Artifact, timeout time.Duration) (*deployLock, error) {
+	l := &deployLock{
+		path:   deployLockPath(dir, chainID, c),
+		holder: lockHolder{lockOwner: newLockOwner(), Contract: c.Name, CodeHash: crypto.Keccak256Hash(c.Bytecode)},
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return nil, fmt.Errorf("deployment lock: %w", err)
+	}
+	deadline := time.Now().Add(timeout)
+	waiting := false
+	err := acquireLock(l.path, "deployment lock", l.holder, deployLockStale, ui.Warnf, func(other *lockOwner) error {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s is being deployed to chain %s by %s; wait for it with --lock-timeout, or run `unlock %s` if that run crashed",
+				c.Name, chainID, other, c.Name)
+		}
+		if !waiting {
+			ui.Printf("Waiting for the deployment lock on %s, held by %s\n", c.Name, other)
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for the deployment lock on %s: %w", c.Name, ctx.Err())
+		case <-time.After(250 * time.Millisecond):
+			return nil
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	ui.Verbosef("Locked %s\n", l.path)
+	l.ctx, l.cancel = context.WithCancelCause(ctx)
+	go l.beat()
+	return l, nil
+}
+
+// beat touches the lock file until release. If the lock was taken away
+// (by `unlock`, or a run that judged it stale), it cancels l.ctx.
+func (l *deployLock) beat() {
+	defer close(l.done)
+	t := time.NewTicker(deployLockHeartbeat)
+	defer t.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-t.C:
+		}
+		now := time.Now()
+		os.Chtimes(l.path, now, now)
+		if !l.held() {
+			l.cancel(fmt.Errorf("%w: %s was removed or taken over by another run", errLockLost, l.path))
+			return
+		}
+	}
+}
+
+// held reports whether the lock file is still this lock's.
+func (l *deployLock) held() bool {
+	return holdsLock(l.path, l.holder.Token)
+}
+
+// lost returns err, prefixed with the loss of the lock if that is what
+// canceled the deploy.
+func (l *deployLock) lost(err error) error {
+	if cause := context.Cause(l.ctx); err != nil && errors.Is(cause, errLockLost) {
+		return fmt.Errorf("%w; %v", cause, err)
+	}
+	return err
+}
+
+// release stops the heartbeat and removes the lock file if it is still
+// this lock's. Calls after the first do nothing.
+func (l *deployLock) release() {
+	l.once.Do(func() {
+		close(l.stop)
+		<-l.done
+		releaseLock(l.path, l.holder.Token)
+	})
+}
+
+// runUnlock implements `unlock [flags] <contract>`: remove the deployment
+// locks on contract for the connected chain, left by a run that crashed.
+func runUnlock(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("unlock", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	force := fs.Bool("force", false, "remove the lock even if its process still runs on this host")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: unlock [flags] <contract>")
+	}
+	name := fs.Arg(0)
+
+	client, chainID, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	client.Close()
+
+	paths, err := filepath.Glob(filepath.Join(o.deployments, chainID.String(), name+".*.lock"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		ui.Printf("No deployment lock on %s for chain %s\n", name, chainID)
+		return nil
+	}
+	host, _ := os.Hostname()
+	for _, p := range paths {
+		h, err := readLockOwner(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if h.Host == host && processAlive(h.PID) && h.PID != os.Getpid() && !*force {
+			return fmt.Errorf("%s is held by %s, which is still running; pass --force to remove it anyway", p, h)
+		}
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("unlock: %w", err)
+		}
+		ui.Printf("Removed %s, held by %s\n", p, h)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestDeploymentLockRace runs two deploys of the same contract at once,
+// as two processes the way racing CI jobs are: one deploys, the other
+// waits for the lock and then finds the first's deployment.
+func TestDeploymentLockRace(t *testing.T) {
+	r := newDeployRun(t)
+	args := strings.Join(r.args("--lock-timeout", "30s"), "\n")
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	outs := make([][]byte, 2)
+	for i := range errs {
+		cmd := exec.CommandContext(t.Context(), os.Args[0], "-test.run=^TestDeployProcess$")
+		cmd.Env = append(os.Environ(), "NYC2025_DEPLOY_ARGS="+args)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outs[i], errs[i] = cmd.CombinedOutput()
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("deploy %d: %v\n%s", i, err, outs[i])
+		}
+	}
+	if n := r.sent(t); n != 1 {
+		t.Fatalf("two racing deploys sent %d transactions, want 1", n)
+	}
+	m, err := readManifest(manifestPath(r.dir, big.NewInt(1337), "Greeter"))
+	if err != nil || len(m.Deployments) != 1 {
+		t.Fatalf("manifest = %+v, %v; want one deployment", m, err)
+	}
+	if locks, _ := filepath.Glob(filepath.Join(r.dir, "1337", "*.lock")); len(locks) != 0 {
+		t.Fatalf("locks left behind: %v", locks)
+	}
+}
+
+// TestDeployProcess is the deploy TestDeploymentLockRace runs in a
+// process of its own.
+func TestDeployProcess(t *testing.T) {
+	args := os.Getenv("NYC2025_DEPLOY_ARGS")
+	if args == "" {
+		t.Skip("run by TestDeploymentLockRace")
+	}
+	if err := runDeploy(context.Background(), strings.Split(args, "\n")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDeploymentLockHeld checks that a deploy fails, or waits with
+// --lock-timeout, while another run holds the lock.
+func TestDeploymentLockHeld(t *testing.T) {
+	out := progress(t)
+	r := newDeployRun(t)
+	c, err := LoadArtifact(r.artifact, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	held, err := lockDeployment(t.Context(), r.dir, big.NewInt(1337), c, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.run(t); err == nil || !strings.Contains(err.Error(), "Greeter is being deployed to chain 1337 by process ") {
+		t.Fatalf("deploy while locked = %v, want it refused", err)
+	}
+	if n := r.sent(t); n != 0 {
+		t.Fatalf("deploy while locked sent %d transactions", n)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- r.run(t, "--lock-timeout", "30s") }()
+	out.await(t, "Waiting for the deployment lock on Greeter")
+	select {
+	case err := <-done:
+		t.Fatalf("deploy with --lock-timeout returned while locked: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if n := r.sent(t); n != 0 {
+		t.Fatalf("waiting deploy sent %d transactions", n)
+	}
+	held.release()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("deploy did not go ahead once the lock was released")
+	}
+	if n := r.sent(t); n != 1 {
+		t.Fatalf("deploy after the release sent %d transactions, want 1", n)
+	}
+}
+
+// writeLock writes a deployment lock at path held by owner, its
+// heartbeat at beat.
+func writeLock(t *testing.T, path string, owner lockOwner, beat time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := json.Marshal(lockHolder{lockOwner: owner})
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, beat, beat); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDeploymentLockStale checks that locks left by a dead process, or
+// whose heartbeat stopped, are taken over.
+func TestDeploymentLockStale(t *testing.T) {
+	warned := warnings(t)
+	dir := t.TempDir()
+	c := greeter(t)
+	path := deployLockPath(dir, big.NewInt(1337), c)
+	host, _ := os.Hostname()
+	now := time.Now()
+	for _, tt := range []struct {
+		owner lockOwner
+		beat  time.Time
+		why   string
+	}{
+		// PIDs stop well short of 2^30 on Linux and macOS.
+		{lockOwner{PID: 1 << 30, Host: host, Token: "dead"}, now, "process 1073741824 is not running"},
+		{lockOwner{PID: os.Getppid(), Host: "ci-runner-7", Token: "quiet"}, now.Add(-2 * deployLockStale), "no heartbeat for 2m0s"},
+	} {
+		warned.Reset()
+		writeLock(t, path, tt.owner, tt.beat)
+		l, err := lockDeployment(t.Context(), dir, big.NewInt(1337), c, 0)
+		if err != nil {
+			t.Fatalf("lock over %+v: %v", tt.owner, err)
+		}
+		if !l.held() || !strings.Contains(warned.String(), "removed stale deployment lock "+path+": "+tt.why) {
+			t.Fatalf("held %v, warnings %q; want the stale lock replaced because %s", l.held(), warned, tt.why)
+		}
+		l.release()
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("lock file after release: %v", err)
+		}
+	}
+
+	// A live holder elsewhere with a fresh heartbeat is not stale.
+	writeLock(t, path, lockOwner{PID: 1, Host: "ci-runner-7", Token: "live"}, now)
+	if _, err := lockDeployment(t.Context(), dir, big.NewInt(1337), c, 0); err == nil || !strings.Contains(err.Error(), "by process 1 on ci-runner-7") {
+		t.Fatalf("lock over a live holder = %v, want refused", err)
+	}
+}
+
+// TestDeploymentLockTakeover races runs over one stale lock: exactly one
+// takes it over, and the others find it held.
+func TestDeploymentLockTakeover(t *testing.T) {
+	warnings(t)
+	dir := t.TempDir()
+	c := greeter(t)
+	path := deployLockPath(dir, big.NewInt(1337), c)
+	for range 20 {
+		writeLock(t, path, lockOwner{PID: 1, Host: "ci-runner-7", Token: "stale"}, time.Now().Add(-2*deployLockStale))
+		locks := make(chan *deployLock, 8)
+		var wg sync.WaitGroup
+		for range cap(locks) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if l, err := lockDeployment(t.Context(), dir, big.NewInt(1337), c, 0); err == nil {
+					locks <- l
+				}
+			}()
+		}
+		wg.Wait()
+		close(locks)
+		var held []*deployLock
+		for l := range locks {
+			held = append(held, l)
+		}
+		if len(held) != 1 || !held[0].held() {
+			t.Fatalf("%d runs took over the stale lock, want 1", len(held))
+		}
+		held[0].release()
+		if leftovers, _ := filepath.Glob(path + "*"); len(leftovers) != 0 {
+			t.Fatalf("files left after the release: %v", leftovers)
+		}
+	}
+}
+
+// TestDeploymentLockLost checks a run whose lock another run took cancels
+// its deploy, and leaves the other's lock alone on release.
+func TestDeploymentLockLost(t *testing.T) {
+	beat := deployLockHeartbeat
+	deployLockHeartbeat = 10 * time.Millisecond
+	t.Cleanup(func() { deployLockHeartbeat = beat })
+	dir := t.TempDir()
+	c := greeter(t)
+	l, err := lockDeployment(t.Context(), dir, big.NewInt(1337), c, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if took, err := claimLock(l.path, func(*lockOwner) bool { return true }); !took || err != nil {
+		t.Fatalf("claim = %v, %v", took, err)
+	}
+	writeLock(t, l.path, lockOwner{PID: 1, Host: "ci-runner-7", Token: "other"}, time.Now())
+
+	select {
+	case <-l.ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("deploy context not canceled after the lock was taken")
+	}
+	if err := l.lost(context.Cause(l.ctx)); !errors.Is(err, errLockLost) {
+		t.Fatalf("cause = %v, want errLockLost", err)
+	}
+	l.release()
+	if !holdsLock(l.path, "other") {
+		t.Fatal("release removed the other run's lock")
+	}
+}
@@ -0,0 +1,166 @@
+package deployer
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// deployOptions control how a contract gets deployed, or whether an
+// existing deployment is reused.
+type deployOptions struct {
+	at             string
+	alwaysDeploy   bool
+	verifyBytecode bool
+	create2        bool
+	salt           string
+	dryRun         bool
+	lockTimeout    time.Duration
+	link           linkOptions
+
+	// tx carries per-transaction overrides; plans set them per step.
+	tx txOptions
+}
+
+func (o *deployOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.at, "at", "", "use the contract already deployed at this address")
+	fs.BoolVar(&o.alwaysDeploy, "always-deploy", false, "deploy even if the manifest records a live deployment")
+	fs.BoolVar(&o.verifyBytecode, "verify-bytecode", false, "warn when reused on-chain code differs from the artifact")
+	fs.BoolVar(&o.create2, "create2", false, "deploy through the deterministic deployment proxy")
+	fs.StringVar(&o.salt, "salt", "", "bytes32 CREATE2 salt (hex)")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "simulate the deployment and print its cost without sending")
+	fs.DurationVar(&o.lockTimeout, "lock-timeout", 0, "wait this long for another run deploying the same contract to finish (default fail at once)")
+	fs.StringVar(&o.tx.value, "value", "", "ether to send to a payable constructor, e.g. 0.1ether")
+	fs.BoolVar(&o.tx.forceValue, "force-value", false, "send --value even though the ABI marks the constructor non-payable")
+	fs.Uint64Var(&o.tx.gasLimit, "gas-limit", 0, "exact gas limit for the deployment (default padded estimate)")
+	fs.Int64Var(&o.tx.nonce, "nonce", -1, "nonce override for the deployment, e.g. to replace a stuck transaction")
+	o.link.register(fs)
+}
+
+// existingDeployment decides whether to skip deploying c. It returns the
+// address to reuse and true, or false when a fresh deployment is needed.
+// The decision and its reason are printed either way.
+func (s *session) existingDeployment(ctx context.Context, dir string, c *Artifact, dopts deployOptions) (common.Address, bool, error) {
+	if dopts.alwaysDeploy && dopts.at == "" {
+		s.ui.Println("Deploying: --always-deploy set")
+		return common.Address{}, false, nil
+	}
+
+	var (
+		addr     common.Address
+		codeAddr common.Address // the implementation, behind a proxy
+		source   string
+	)
+	if dopts.at != "" {
+		a, err := parseAddress(dopts.at)
+		if err != nil {
+			return common.Address{}, false, fmt.Errorf("--at: %w", err)
+		}
+		addr, source = a, "--at"
+		codeAddr = addr
+	} else {
+		path := manifestPath(dir, s.chainID, c.Name)
+		m, err := readManifest(path)
+		if err != nil {
+			return common.Address{}, false, err
+		}
+		d := m.latest()
+		if d == nil {
+			s.ui.Printf("Deploying: no %s deployment recorded for chain %s\n", c.Name, s.chainID)
+			return common.Address{}, false, nil
+		}
+		addr, codeAddr, source = d.Address, d.codeAddress(), fmt.Sprintf("%s v%d", path, d.Version)
+	}
+
+	code, err := s.client.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return common.Address{}, false, fmt.Errorf("get code at %s: %w", addr.Hex(), err)
+	}
+	if len(code) == 0 {
+		if dopts.at != "" {
+			return common.Address{}, false, fmt.Errorf("--at %s: no code at that address", addr.Hex())
+		}
+		s.ui.Printf("Deploying: %s from %s has no code on chain %s (node reset?)\n", addr.Hex(), source, s.chainID)
+		return common.Address{}, false, nil
+	}
+
+	s.ui.Printf("Skipping deployment: %s already at %s (%s)\n", c.Name, addr.Hex(), source)
+	s.ui.report.Contract = &ContractReport{Name: c.Name, Address: addr, Reused: true}
+	if dopts.verifyBytecode && codeAddr != addr {
+		if code, err = s.client.CodeAt(ctx, codeAddr, nil); err != nil {
+			return common.Address{}, false, fmt.Errorf("get code at %s: %w", codeAddr.Hex(), err)
+		}
+	}
+	if dopts.verifyBytecode && c.DeployedBytecode == nil {
+		s.ui.Warnf("Warning: artifact has no deployedBytecode; cannot verify\n")
+	} else if dopts.verifyBytecode {
+		r := checkBytecode(codeAddr, code, c)
+		s.ui.report.Bytecode = r
+		switch r.Status {
+		case "match":
+			s.ui.Println("Bytecode matches artifact")
+		case "no code":
+			s.ui.Warnf("Warning: no code at %s to verify\n", codeAddr.Hex())
+		default:
+			s.ui.Warnf("Warning: on-chain code at %s differs from %s at byte %d\n", codeAddr.Hex(), c.Path, *r.Offset)
+			printMismatch(s.ui.Warnf, r)
+		}
+	}
+	return addr, true, nil
+}
+
+// deployContract deploys c with plain CREATE or, with --create2, through
+// the deterministic deployer, and prints the constructor's events. The
+// returned record is nil when a CREATE2 deployment already existed and
+// nothing was sent. A CREATE that landed away from its predicted address
+// returns its record with the ErrNonceConflict error, so the contract can
+// still be recorded where it is.
+func (s *session) deployContract(ctx context.Context, c *Artifact, dopts deployOptions, args []interface{}) (common.Address, *Deployment, *types.Receipt, error) {
+	if err := c.checkLinked(); err != nil {
+		return common.Address{}, nil, nil, err
+	}
+	if err := checkPayable(c.Name+" constructor", &c.ABI.Constructor, dopts.tx); err != nil {
+		return common.Address{}, nil, nil, err
+	}
+	if !dopts.create2 {
+		if dopts.salt != "" {
+			return common.Address{}, nil, nil, fmt.Errorf("--salt requires --create2")
+		}
+		address, rcpt, err := s.deploy(ctx, c, dopts.tx, args...)
+		if address == (common.Address{}) {
+			return common.Address{}, nil, rcpt, err
+		}
+		s.reportDeploy(c, address, rcpt)
+		d := newDeployment(s.from, address, rcpt)
+		return address, &d, rcpt, err
+	}
+
+	salt, err := parseSalt(dopts.salt)
+	if err != nil {
+		return common.Address{}, nil, nil, err
+	}
+	address, rcpt, err := s.deployCreate2(ctx, c, salt, dopts.tx, args...)
+	if err != nil {
+		return address, nil, rcpt, err
+	}
+	if rcpt == nil {
+		s.ui.report.Contract = &ContractReport{Name: c.Name, Address: address, Reused: true}
+		return address, nil, nil, nil
+	}
+	s.reportDeploy(c, address, rcpt)
+	d := newDeployment(s.from, address, rcpt)
+	h := common.Hash(salt)
+	d.Salt = &h
+	return address, &d, rcpt, nil
+}
+
+// reportDeploy prints the events of a fresh deployment and records it in
+// the JSON report.
+func (s *session) reportDeploy(c *Artifact, address common.Address, rcpt *types.Receipt) {
+	events := printEvents(s.ui, rcpt, &c.ABI)
+	s.ui.report.Contract = &ContractReport{Name: c.Name, Address: address, Deploy: newTxReport("constructor", rcpt, events)}
+}
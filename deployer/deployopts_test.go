@@ -0,0 +1,78 @@
+package deployer
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// testdata/artifacts/payable.json has a payable constructor that stores
+// msg.value, which paid() returns.
+
+// TestDeployValue deploys the payable fixture with --value, then the same
+// code with its constructor marked nonpayable: refused before anything
+// is sent, and deployed anyway with --force-value.
+func TestDeployValue(t *testing.T) {
+	payable, err := filepath.Abs("testdata/artifacts/payable.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(payable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newDeployRun(t)
+	nonpayable := filepath.Join(t.TempDir(), "Nonpayable.json")
+	if err := os.WriteFile(nonpayable, []byte(strings.Replace(string(raw), `"payable"`, `"nonpayable"`, 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	deploy := func(artifact string, flags ...string) error {
+		args := append([]string{"--rpc", r.chain.rpc, "--deployments-dir", r.dir, "--poll-interval", "10ms", "--yes"}, flags...)
+		return runDeploy(t.Context(), append(args, artifact))
+	}
+	// paid is what the deployment of name recorded holds, and its balance.
+	paid := func(name string) (*big.Int, *big.Int) {
+		t.Helper()
+		m, err := readManifest(manifestPath(r.dir, big.NewInt(1337), name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := m.latest().Address
+		word, err := r.chain.Client().StorageAt(t.Context(), a, common.Hash{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		balance, err := r.chain.Client().BalanceAt(t.Context(), a, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return new(big.Int).SetBytes(word), balance
+	}
+
+	if err := deploy(payable, "--value", "1.5ether"); err != nil {
+		t.Fatal(err)
+	}
+	want := new(big.Int).Div(ether(3), big.NewInt(2))
+	if value, balance := paid("payable"); value.Cmp(want) != 0 || balance.Cmp(want) != 0 {
+		t.Fatalf("payable constructor saw msg.value %s and holds %s, want %s", value, balance, want)
+	}
+
+	err = deploy(nonpayable, "--value", "1ether")
+	if err == nil || !strings.Contains(err.Error(), "--value 1ether: Nonpayable constructor is not payable in the ABI") {
+		t.Fatalf("--value to a nonpayable constructor = %v, want it refused", err)
+	}
+	if n := r.sent(t); n != 1 {
+		t.Fatalf("refused deploy sent a transaction: %d sent in all, want 1", n)
+	}
+
+	if err := deploy(nonpayable, "--value", "1ether", "--force-value"); err != nil {
+		t.Fatal(err)
+	}
+	if value, balance := paid("Nonpayable"); value.Cmp(ether(1)) != 0 || balance.Cmp(ether(1)) != 0 {
+		t.Fatalf("forced constructor saw msg.value %s and holds %s, want 1 ether", value, balance)
+	}
+}
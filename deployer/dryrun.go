@@ -0,0 +1,189 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Contract size limits from EIP-170 (runtime code) and EIP-3860 (init code).
+const (
+	maxCodeSize     = 24576
+	maxInitCodeSize = 2 * maxCodeSize
+)
+
+// maxGasPrice is the most a unit of gas can cost under opts.
+func maxGasPrice(opts *bind.TransactOpts) *big.Int {
+	if opts.GasPrice != nil {
+		return opts.GasPrice
+	}
+	return opts.GasFeeCap
+}
+
+// simulate runs msg through eth_call and eth_estimateGas without signing
+// anything, returning the call's output and the gas estimate. Both run
+// with the state in ov replaced, if any.
+func (s *session) simulate(ctx context.Context, msg ethereum.CallMsg, contractABI *abi.ABI, ov stateOverrides) ([]byte, uint64, error) {
+	msg.From = s.from
+	if len(ov) > 0 {
+		ret, err := s.client.CallContractWithOverrides(ctx, msg, nil, ov)
+		if err != nil {
+			return nil, 0, fmt.Errorf("simulation reverted: %w", explainError(err, contractABI))
+		}
+		gas, err := s.client.EstimateGasWithOverrides(ctx, msg, ov)
+		if err != nil {
+			return nil, 0, fmt.Errorf("estimate gas: %w", explainError(err, contractABI))
+		}
+		return ret, gas, nil
+	}
+	ret, err := s.client.CallContract(ctx, msg, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("simulation reverted: %w", explainError(err, contractABI))
+	}
+	gas, err := s.client.EstimateGas(ctx, msg)
+	if err != nil {
+		return nil, 0, fmt.Errorf("estimate gas: %w", explainError(err, contractABI))
+	}
+	return ret, gas, nil
+}
+
+// printCost prints the summary a real send of msg would confirm, with the
+// gas limit it would use for the estimate gas and the access list it
+// would attach, and returns the JSON report entry for them.
+func (s *session) printCost(ctx context.Context, sum txSummary, opts *bind.TransactOpts, msg ethereum.CallMsg, gas uint64) (*DryRunReport, error) {
+	o := *opts
+	msg.From = s.from
+	if list, g := s.accessList(ctx, msg, gas); list != nil {
+		o.AccessList, gas = list, g
+	}
+	if o.GasLimit == 0 {
+		o.GasLimit = s.gas.pad(gas)
+	}
+	if o.Nonce == nil {
+		n, err := s.nonces.Peek(ctx, s.from)
+		if err != nil {
+			return nil, err
+		}
+		o.Nonce = new(big.Int).SetUint64(n)
+	}
+	s.ui.Printf("  estimated gas: %d\n", gas)
+	intrinsic := msgIntrinsicGas(msg, o.AccessList)
+	printIntrinsic(s.ui, intrinsic, gas)
+	s.pendingL1Fee = s.estimateL1Fee(ctx, &o, msg)
+	cost := s.printSummary(sum, &o)
+	r := &DryRunReport{EstimatedGas: gas, Intrinsic: &intrinsic, MaxCost: cost.String(), AccessList: o.AccessList}
+	if gas >= intrinsic.Total {
+		r.ExecutionGas = gas - intrinsic.Total
+	}
+	if s.pendingL1Fee != nil {
+		r.L1Fee = s.pendingL1Fee.String()
+		s.pendingL1Fee = nil
+	}
+	if price := s.ethUSD(ctx); price != nil {
+		r.MaxCostUSD = formatUSD(cost, price)
+		s.ui.Printf("  max cost:  ~$%s at $%s per ETH\n", r.MaxCostUSD, price.FloatString(2))
+	}
+	return r, nil
+}
+
+// dryRunDeploy simulates deploying c (plain CREATE, or through the
+// deterministic deployer with --create2) and checks the size limits.
+func (s *session) dryRunDeploy(ctx context.Context, c *Artifact, dopts deployOptions, args []interface{}) error {
+	if err := c.checkLinked(); err != nil {
+		return err
+	}
+	if err := checkPayable(c.Name+" constructor", &c.ABI.Constructor, dopts.tx); err != nil {
+		return err
+	}
+	opts, err := s.opts(ctx, dopts.tx)
+	if err != nil {
+		return err
+	}
+	code, err := initCode(c, args)
+	if err != nil {
+		return err
+	}
+	s.ui.Printf("Dry run: deploy %s (nothing will be signed or sent)\n", c.Name)
+	dopts.tx.overrides.print()
+
+	msg := ethereum.CallMsg{Value: opts.Value, Data: code}
+	runtime, gas, err := s.simulate(ctx, msg, &c.ABI, dopts.tx.overrides)
+	if err != nil {
+		return err
+	}
+	var address string
+	sum := constructorSummary(c, args)
+	if dopts.create2 {
+		salt, err := parseSalt(dopts.salt)
+		if err != nil {
+			return err
+		}
+		address = create2Address(salt, code).Hex()
+		s.ui.Printf("  CREATE2 address: %s\n", address)
+		to := deterministicDeployer
+		sum.to, sum.call = &to, "CREATE2 "+sum.call
+		msg = ethereum.CallMsg{To: &to, Value: opts.Value, Data: append(salt[:], code...)}
+		if _, gas, err = s.simulate(ctx, msg, &c.ABI, dopts.tx.overrides); err != nil {
+			return err
+		}
+	}
+	printInitCode(s.ui, c, code)
+	s.ui.Printf("  runtime code:  %d bytes (limit %d)\n", len(runtime), maxCodeSize)
+	if s.ui.report.DryRun, err = s.printCost(ctx, sum, opts, msg, gas); err != nil {
+		return err
+	}
+	s.ui.report.DryRun.Address = address
+	s.ui.report.DryRun.BytecodeSize, s.ui.report.DryRun.ConstructorArgsSize = len(c.Bytecode), len(code)-len(c.Bytecode)
+
+	var problems []string
+	if len(code) > maxInitCodeSize {
+		problems = append(problems, fmt.Sprintf("init code is %d bytes, over the EIP-3860 limit of %d", len(code), maxInitCodeSize))
+	}
+	if len(runtime) > maxCodeSize {
+		problems = append(problems, fmt.Sprintf("runtime code is %d bytes, over the EIP-170 limit of %d", len(runtime), maxCodeSize))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("dry run failed: %v", problems)
+	}
+	return nil
+}
+
+// dryRunSend simulates calling m on to and prints the would-be return data.
+func (s *session) dryRunSend(ctx context.Context, to common.Address, contractABI *abi.ABI, m *abi.Method, args []interface{}, txo txOptions) error {
+	if err := checkPayable(m.Sig, m, txo); err != nil {
+		return err
+	}
+	opts, err := s.opts(ctx, txo)
+	if err != nil {
+		return err
+	}
+	data, err := contractABI.Pack(m.Name, args...)
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", m.Sig, err)
+	}
+	s.ui.Printf("Dry run: %s on %s (nothing will be signed or sent)\n", m.Sig, to.Hex())
+	txo.overrides.print()
+	msg := ethereum.CallMsg{To: &to, Value: opts.Value, Data: data}
+	ret, gas, err := s.simulate(ctx, msg, contractABI, txo.overrides)
+	if err != nil {
+		return err
+	}
+	var results []typedValue
+	if vals, err := m.Outputs.Unpack(ret); err == nil && len(vals) > 0 {
+		s.ui.Resultf("  returns: %s\n", formatArgs(m.Outputs, vals))
+		results = typedValues(m.Outputs, vals)
+	} else if len(ret) > 0 {
+		s.ui.Resultf("  return data: %s\n", formatValue(ret))
+	}
+	sum := methodSummary(to, m, args)
+	if s.ui.report.DryRun, err = s.printCost(ctx, sum, opts, msg, gas); err != nil {
+		return err
+	}
+	s.ui.report.DryRun.Results = results
+	return nil
+}
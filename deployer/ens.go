@@ -0,0 +1,277 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ensRegistry is the ENS registry's address on every chain that has one.
+var ensRegistry = common.HexToAddress("0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e")
+
+// ensABI is the part of the ENS registry and public resolver used to
+// resolve names and reverse records.
+const ensABI = `[
+{"type":"function","name":"resolver","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"address"}]},
+{"type":"function","name":"addr","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"address"}]},
+{"type":"function","name":"name","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"string"}]}
+]`
+
+var parsedENS = func() abi.ABI {
+	a, err := abi.JSON(strings.NewReader(ensABI))
+	if err != nil {
+		panic(err)
+	}
+	return a
+}()
+
+// namehash is the EIP-137 node of name. Labels are lowercased; full
+// UTS-46 normalization is not done, so non-ASCII names are rejected by
+// normalizeName first.
+func namehash(name string) common.Hash {
+	var node common.Hash
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		node = crypto.Keccak256Hash(node[:], crypto.Keccak256([]byte(labels[i])))
+	}
+	return node
+}
+
+// normalizeName lowercases an ENS name and checks it has no empty labels
+// and only ASCII characters.
+func normalizeName(name string) (string, error) {
+	for _, r := range name {
+		if r > 0x7f {
+			return "", fmt.Errorf("ENS name %q: only ASCII names are supported", name)
+		}
+		if r <= ' ' || r == '/' || r == '\\' {
+			return "", fmt.Errorf("ENS name %q: invalid character %q", name, r)
+		}
+	}
+	name = strings.ToLower(name)
+	for _, label := range strings.Split(name, ".") {
+		if label == "" {
+			return "", fmt.Errorf("ENS name %q has an empty label", name)
+		}
+	}
+	return name, nil
+}
+
+// isENSName reports whether s, which is not a hex address, is meant as an
+// ENS name: something dotted like vitalik.eth.
+func isENSName(s string) bool {
+	return strings.Contains(s, ".") && !strings.HasPrefix(s, ".") && !strings.HasSuffix(s, ".")
+}
+
+// nameResolver resolves ENS names given for addresses and, with
+// --resolve-names, labels addresses in output with their reverse
+// records. Lookups are cached for the run.
+type nameResolver struct {
+	ui   *logger
+	o    *options
+	show bool // --resolve-names
+
+	client  *rpcClient
+	chainID *big.Int
+	own     bool // client was dialed for a lookup before connect
+
+	forward map[string]common.Address
+	reverse map[common.Address]string
+}
+
+// names is the commands' resolver; options.register and connect
+// configure it.
+var names = cli.names
+
+func (r *nameResolver) register(fs *flag.FlagSet, o *options) {
+	r.o = o
+	fs.BoolVar(&r.show, "resolve-names", false, "show addresses in output with their ENS names, when a verified reverse record exists")
+}
+
+// use makes r resolve through the client connect dialed.
+func (r *nameResolver) use(client *rpcClient, chainID *big.Int) {
+	if r.own && r.client != nil {
+		r.client.Close()
+	}
+	r.client, r.chainID, r.own = client, chainID, false
+}
+
+// close closes a client dialed only for lookups.
+func (r *nameResolver) close() {
+	if r.own && r.client != nil {
+		r.client.Close()
+		r.client, r.own = nil, false
+	}
+}
+
+// registry dials the node if no command has yet, for a name given before
+// connecting, and returns the chain's ENS registry.
+func (r *nameResolver) registry(ctx context.Context) (common.Address, error) {
+	if r.client == nil {
+		if r.o == nil || r.o.anvil.auto {
+			return common.Address{}, errors.New("no node to resolve ENS names on; use a 0x address")
+		}
+		urls, err := resolveRPC(r.o.rpc)
+		if err != nil {
+			return common.Address{}, err
+		}
+		client, err := dial(ctx, r.o.env, urls, r.o.retry, r.o.rpcTimeout, r.o.batch, r.o.headers())
+		if err != nil {
+			return common.Address{}, err
+		}
+		chainID, err := client.ChainID(ctx)
+		if err != nil {
+			client.Close()
+			return common.Address{}, fmt.Errorf("chain id: %w", err)
+		}
+		r.client, r.chainID, r.own = client, chainID, true
+	}
+	registry := chains[r.chainID.Uint64()].ens
+	if registry == (common.Address{}) {
+		return registry, fmt.Errorf("%s has no ENS registry; use a 0x address, or set ens in [chains.%s] of the config", chainName(r.chainID), r.chainID)
+	}
+	return registry, nil
+}
+
+// call calls an ensABI method on to for node.
+func (r *nameResolver) call(ctx context.Context, to common.Address, method string, node common.Hash) (interface{}, error) {
+	data, err := parsedENS.Pack(method, node)
+	if err != nil {
+		return nil, err
+	}
+	out, err := r.client.CallContract(ctx, ethereum.CallMsg{To: &to, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no contract at %s", to.Hex())
+	}
+	vals, err := parsedENS.Unpack(method, out)
+	if err != nil {
+		return nil, err
+	}
+	return vals[0], nil
+}
+
+// resolver is the resolver the registry names for node, or the zero
+// address when there is none.
+func (r *nameResolver) resolver(ctx context.Context, node common.Hash) (common.Address, error) {
+	registry, err := r.registry(ctx)
+	if err != nil {
+		return common.Address{}, err
+	}
+	v, err := r.call(ctx, registry, "resolver", node)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("ENS registry: %w", err)
+	}
+	return v.(common.Address), nil
+}
+
+// resolve returns the address name resolves to.
+func (r *nameResolver) resolve(ctx context.Context, name string) (common.Address, error) {
+	name, err := normalizeName(name)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if a, ok := r.forward[name]; ok {
+		return a, nil
+	}
+	node := namehash(name)
+	resolver, err := r.resolver(ctx, node)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("resolve %s: %w", name, err)
+	}
+	if resolver == (common.Address{}) {
+		return common.Address{}, fmt.Errorf("ENS name %s is not registered on %s, or has no resolver", name, chainName(r.chainID))
+	}
+	v, err := r.call(ctx, resolver, "addr", node)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("resolve %s: resolver %s: %w", name, resolver.Hex(), err)
+	}
+	a := v.(common.Address)
+	if a == (common.Address{}) {
+		return a, fmt.Errorf("ENS name %s does not resolve to an address", name)
+	}
+	if r.forward == nil {
+		r.forward = map[string]common.Address{}
+	}
+	r.forward[name] = a
+	return a, nil
+}
+
+// lookup returns the primary name of a, or "" when it has none or the
+// name does not resolve back to a.
+func (r *nameResolver) lookup(ctx context.Context, a common.Address) string {
+	if name, ok := r.reverse[a]; ok {
+		return name
+	}
+	if r.reverse == nil {
+		r.reverse = map[common.Address]string{}
+	}
+	r.reverse[a] = ""
+	node := namehash(strings.ToLower(a.Hex()[2:]) + ".addr.reverse")
+	resolver, err := r.resolver(ctx, node)
+	if err != nil || resolver == (common.Address{}) {
+		return ""
+	}
+	v, err := r.call(ctx, resolver, "name", node)
+	if err != nil {
+		return ""
+	}
+	name := v.(string)
+	if name == "" {
+		return ""
+	}
+	// Anyone can claim any name in their reverse record; only a name
+	// that resolves back to a is shown.
+	if forward, err := r.resolve(ctx, name); err != nil || forward != a {
+		r.ui.Verbosef("ignoring reverse record %s for %s: it does not resolve back\n", name, a.Hex())
+		return ""
+	}
+	r.reverse[a] = name
+	return name
+}
+
+// label is a for output: followed by its ENS name with --resolve-names
+// on a chain with ENS.
+func (r *nameResolver) label(a common.Address) string {
+	if !r.show || r.client == nil || chains[r.chainID.Uint64()].ens == (common.Address{}) {
+		return a.Hex()
+	}
+	if name := r.lookup(context.Background(), a); name != "" {
+		return fmt.Sprintf("%s (%s)", a.Hex(), name)
+	}
+	return a.Hex()
+}
+
+// parseAddress parses an address argument: hex, or an ENS name resolved
+// on the connected chain. The first time a name resolves, the address is
+// printed.
+func parseAddress(s string) (common.Address, error) {
+	if common.IsHexAddress(s) {
+		return common.HexToAddress(s), nil
+	}
+	if !isENSName(s) {
+		return common.Address{}, fmt.Errorf("invalid address %q", s)
+	}
+	_, cached := names.forward[strings.ToLower(s)]
+	a, err := names.resolve(context.Background(), s)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if !cached {
+		ui.Printf("%s resolves to %s\n", s, a.Hex())
+	}
+	return a, nil
+}
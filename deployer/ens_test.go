@@ -0,0 +1,176 @@
+package deployer
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestNamehash(t *testing.T) {
+	for _, tt := range []struct{ name, want string }{
+		// EIP-137
+		{"", "0x0000000000000000000000000000000000000000000000000000000000000000"},
+		{"eth", "0x93cdeb708b7545dc668eb9280176169d1c33cfd8ed6f04690a0bcc88a93fc4ae"},
+		{"foo.eth", "0xde9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f"},
+		// EIP-181
+		{"addr.reverse", "0x91d1777781884d03a6757a803996e38de2a42967fb37eeaca72729271025a9e2"},
+	} {
+		if got := namehash(tt.name).Hex(); got != tt.want {
+			t.Errorf("namehash(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	if got, err := normalizeName("Vitalik.ETH"); err != nil || got != "vitalik.eth" {
+		t.Errorf("normalizeName(Vitalik.ETH) = %q, %v", got, err)
+	}
+	for _, tt := range []struct{ name, want string }{
+		{"foo..eth", "empty label"},
+		{"fóo.eth", "only ASCII names are supported"},
+		{"foo bar.eth", "invalid character ' '"},
+		{"foo/bar.eth", "invalid character '/'"},
+	} {
+		if _, err := normalizeName(tt.name); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("normalizeName(%q) = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	for s, want := range map[string]bool{"vitalik.eth": true, "a.b.c": true, "eth": false, ".eth": false, "eth.": false} {
+		if isENSName(s) != want {
+			t.Errorf("isENSName(%q) = %v, want %v", s, !want, want)
+		}
+	}
+}
+
+// ensRecords answers every call with the three storage words at
+// keccak256(selector . node), so one contract serves as registry and
+// resolver: word 0 is an address, or all three an ABI-encoded string of
+// up to 32 bytes.
+//
+//	mstore(0, shr(224, calldataload(0)))
+//	mstore(32, calldataload(4))
+//	k := keccak256(0, 64)
+//	mstore(0, sload(k)) mstore(32, sload(k+1)) mstore(64, sload(k+2))
+//	return(0, 96)
+const ensRecords = "60003560e01c6000526004356020526040600020805460005280600101546020526002015460405260606000f3"
+
+// ensChain is a chain with a mini ENS at ensRegistry: the registry and
+// resolver use the same code, and the chain's entry names the registry
+// until the test ends.
+type ensChain struct {
+	*simChain
+	resolver common.Address
+	registry types.Account
+	records  types.Account
+}
+
+func newENS() *ensChain {
+	code := common.FromHex(ensRecords)
+	return &ensChain{
+		resolver: common.HexToAddress("0x000000000000000000000000000000000000e501"),
+		registry: types.Account{Code: code, Storage: map[common.Hash]common.Hash{}},
+		records:  types.Account{Code: code, Storage: map[common.Hash]common.Hash{}},
+	}
+}
+
+func (e *ensChain) set(account types.Account, method, name string, words ...common.Hash) {
+	key := crypto.Keccak256Hash(common.LeftPadBytes(parsedENS.Methods[method].ID, 32), namehash(name).Bytes())
+	for i, w := range words {
+		slot := new(big.Int).Add(key.Big(), big.NewInt(int64(i)))
+		account.Storage[common.BigToHash(slot)] = w
+	}
+}
+
+// addr points name at a.
+func (e *ensChain) addr(name string, a common.Address) {
+	e.set(e.registry, "resolver", name, common.BytesToHash(e.resolver.Bytes()))
+	e.set(e.records, "addr", name, common.BytesToHash(a.Bytes()))
+}
+
+// reverse sets a's reverse record to name.
+func (e *ensChain) reverse(a common.Address, name string) {
+	node := strings.ToLower(a.Hex()[2:]) + ".addr.reverse"
+	e.set(e.registry, "resolver", node, common.BytesToHash(e.resolver.Bytes()))
+	var data common.Hash
+	copy(data[:], name)
+	e.set(e.records, "name", node, common.BigToHash(big.NewInt(32)), common.BigToHash(big.NewInt(int64(len(name)))), data)
+}
+
+func (e *ensChain) start(t *testing.T) *nameResolver {
+	t.Helper()
+	e.simChain = newSimChainAlloc(t, types.GenesisAlloc{ensRegistry: e.registry, e.resolver: e.records})
+	info := chains[1337]
+	t.Cleanup(func() { chains[1337] = info })
+	withENS := info
+	withENS.ens = ensRegistry
+	chains[1337] = withENS
+
+	c, err := testDial(t, e.rpc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &nameResolver{ui: ui, show: true}
+	r.use(c, big.NewInt(1337))
+	return r
+}
+
+func TestResolveENS(t *testing.T) {
+	alice := common.HexToAddress("0x00000000000000000000000000000000000a11ce")
+	mallory := common.HexToAddress("0x000000000000000000000000000000000bad0bad")
+	e := newENS()
+	e.addr("alice.eth", alice)
+	e.addr("empty.eth", common.Address{})
+	e.reverse(alice, "alice.eth")
+	e.reverse(mallory, "alice.eth") // claims a name that is not theirs
+	r := e.start(t)
+	ctx := t.Context()
+
+	for _, name := range []string{"alice.eth", "Alice.ETH"} {
+		if a, err := r.resolve(ctx, name); err != nil || a != alice {
+			t.Errorf("resolve(%s) = %s, %v; want %s", name, a.Hex(), err, alice.Hex())
+		}
+	}
+	if r.forward["alice.eth"] != alice || len(r.forward) != 1 {
+		t.Errorf("forward cache = %v, want alice.eth alone", r.forward)
+	}
+	if _, err := r.resolve(ctx, "bob.eth"); err == nil || !strings.Contains(err.Error(), "ENS name bob.eth is not registered on") {
+		t.Errorf("resolve(bob.eth) = %v, want not registered", err)
+	}
+	if _, err := r.resolve(ctx, "empty.eth"); err == nil || !strings.Contains(err.Error(), "does not resolve to an address") {
+		t.Errorf("resolve(empty.eth) = %v, want no address", err)
+	}
+
+	if got := r.label(alice); got != alice.Hex()+" (alice.eth)" {
+		t.Errorf("label(alice) = %q, want the verified reverse record", got)
+	}
+	if got := r.label(mallory); got != mallory.Hex() {
+		t.Errorf("label(mallory) = %q, want no name: alice.eth does not resolve back", got)
+	}
+	if got := r.label(testAddr); got != testAddr.Hex() {
+		t.Errorf("label(testAddr) = %q, want no name", got)
+	}
+	if _, cached := r.reverse[mallory]; !cached {
+		t.Errorf("reverse lookup of %s not cached", mallory.Hex())
+	}
+	r.show = false
+	if got := r.label(alice); got != alice.Hex() {
+		t.Errorf("label(alice) without --resolve-names = %q", got)
+	}
+}
+
+func TestResolveENSNoRegistry(t *testing.T) {
+	chain := newSimChain(t)
+	c, err := testDial(t, chain.rpc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &nameResolver{ui: ui}
+	r.use(c, big.NewInt(1337))
+	if _, err := r.resolve(t.Context(), "alice.eth"); err == nil || !strings.Contains(err.Error(), "has no ENS registry; use a 0x address") {
+		t.Fatalf("resolve on a chain without ENS = %v", err)
+	}
+}
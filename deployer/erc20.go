@@ -0,0 +1,361 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// erc20ABI is the part of ERC-20 the erc20 commands use, plus EIP-2612
+// permit and, overloaded as permit0, DAI's older permit.
+const erc20ABI = `[
+{"type":"function","name":"name","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+{"type":"function","name":"symbol","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+{"type":"function","name":"decimals","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint8"}]},
+{"type":"function","name":"totalSupply","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+{"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+{"type":"function","name":"allowance","stateMutability":"view","inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+{"type":"function","name":"transfer","stateMutability":"nonpayable","inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]},
+{"type":"function","name":"approve","stateMutability":"nonpayable","inputs":[{"name":"spender","type":"address"},{"name":"value","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]},
+{"type":"function","name":"version","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+{"type":"function","name":"nonces","stateMutability":"view","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+{"type":"function","name":"DOMAIN_SEPARATOR","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"bytes32"}]},
+{"type":"function","name":"permit","stateMutability":"nonpayable","inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"},{"name":"value","type":"uint256"},{"name":"deadline","type":"uint256"},{"name":"v","type":"uint8"},{"name":"r","type":"bytes32"},{"name":"s","type":"bytes32"}],"outputs":[]},
+{"type":"function","name":"permit","stateMutability":"nonpayable","inputs":[{"name":"holder","type":"address"},{"name":"spender","type":"address"},{"name":"nonce","type":"uint256"},{"name":"expiry","type":"uint256"},{"name":"allowed","type":"bool"},{"name":"v","type":"uint8"},{"name":"r","type":"bytes32"},{"name":"s","type":"bytes32"}],"outputs":[]},
+{"type":"event","name":"Transfer","anonymous":false,"inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]},
+{"type":"event","name":"Approval","anonymous":false,"inputs":[{"name":"owner","type":"address","indexed":true},{"name":"spender","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]}
+]`
+
+// erc20Bytes32ABI is name, symbol and version as older tokens such as
+// MKR declare them.
+const erc20Bytes32ABI = `[
+{"type":"function","name":"name","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"bytes32"}]},
+{"type":"function","name":"symbol","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"bytes32"}]},
+{"type":"function","name":"version","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"bytes32"}]}
+]`
+
+var parsedERC20, parsedERC20Bytes32 = func() (abi.ABI, abi.ABI) {
+	a, err := abi.JSON(strings.NewReader(erc20ABI))
+	if err != nil {
+		panic(err)
+	}
+	b, err := abi.JSON(strings.NewReader(erc20Bytes32ABI))
+	if err != nil {
+		panic(err)
+	}
+	return a, b
+}()
+
+// erc20Token is a token contract and its metadata.
+type erc20Token struct {
+	address  common.Address
+	client   *rpcClient
+	bound    *bind.BoundContract
+	name     string
+	symbol   string
+	decimals uint8
+}
+
+// loadToken reads the metadata of the token at address. decimals is
+// required; a missing name or symbol is left empty.
+func loadToken(ctx context.Context, client *rpcClient, address common.Address) (*erc20Token, error) {
+	code, err := client.CodeAt(ctx, address, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get code at %s: %w", address.Hex(), err)
+	}
+	if len(code) == 0 {
+		return nil, fmt.Errorf("no contract at %s", address.Hex())
+	}
+	t := &erc20Token{
+		address: address,
+		client:  client,
+		bound:   bind.NewBoundContract(address, parsedERC20, client, client, client),
+	}
+	out, err := t.call(ctx, "decimals")
+	if err != nil {
+		return nil, fmt.Errorf("%s does not look like an ERC-20 token: %w", address.Hex(), err)
+	}
+	t.decimals = out[0].(uint8)
+	t.name = t.text(ctx, "name")
+	t.symbol = t.text(ctx, "symbol")
+	return t, nil
+}
+
+// call runs one of the token's view methods.
+func (t *erc20Token) call(ctx context.Context, method string, args ...interface{}) ([]interface{}, error) {
+	m := parsedERC20.Methods[method]
+	return callMethod(ctx, t.bound, &parsedERC20, &m, nil, args)
+}
+
+// amount reads one of the token's uint256 view methods.
+func (t *erc20Token) amount(ctx context.Context, method string, args ...interface{}) (*big.Int, error) {
+	out, err := t.call(ctx, method, args...)
+	if err != nil {
+		return nil, err
+	}
+	return out[0].(*big.Int), nil
+}
+
+// text reads name, symbol or version, declared either as string or as
+// bytes32.
+func (t *erc20Token) text(ctx context.Context, method string) string {
+	if out, err := t.call(ctx, method); err == nil {
+		return out[0].(string)
+	}
+	m := parsedERC20Bytes32.Methods[method]
+	bound := bind.NewBoundContract(t.address, parsedERC20Bytes32, t.client, t.client, t.client)
+	out, err := callMethod(ctx, bound, &parsedERC20Bytes32, &m, nil, nil)
+	if err != nil {
+		return ""
+	}
+	b := out[0].([32]byte)
+	return string(bytes.TrimRight(b[:], "\x00"))
+}
+
+// format renders v in whole tokens with the symbol.
+func (t *erc20Token) format(v *big.Int) string {
+	if t.symbol == "" {
+		return formatUnits(v, t.decimals)
+	}
+	return formatUnits(v, t.decimals) + " " + t.symbol
+}
+
+// parseAmount converts a human amount such as "1.5" into the token's
+// smallest unit. Amounts finer than decimals allows are rejected.
+func (t *erc20Token) parseAmount(s string) (*big.Int, error) {
+	r, ok := scaleDecimal(strings.TrimSpace(s), int64(t.decimals))
+	if !ok {
+		return nil, fmt.Errorf("invalid token amount %q", s)
+	}
+	if !r.IsInt() {
+		return nil, fmt.Errorf("amount %q has more than the token's %d decimals", s, t.decimals)
+	}
+	return new(big.Int).Set(r.Num()), nil
+}
+
+func (t *erc20Token) report() *TokenReport {
+	return &TokenReport{Address: t.address, Name: t.name, Symbol: t.symbol, Decimals: t.decimals}
+}
+
+// erc20SendEvents is the event each method sent by erc20 must emit.
+var erc20SendEvents = map[string]string{
+	"transfer": "Transfer",
+	"approve":  "Approval",
+	"permit":   "Approval",
+	"permit0":  "Approval",
+}
+
+// send sends a transfer, approve or permit through the generic send
+// path. The call is simulated first because some tokens return false on
+// failure instead of reverting, which would otherwise be mined as a
+// success.
+func (t *erc20Token) send(ctx context.Context, s *session, txo txOptions, method string, args ...interface{}) error {
+	m := parsedERC20.Methods[method]
+	if txo.dryRun {
+		return s.dryRunSend(ctx, t.address, &parsedERC20, &m, args, txo)
+	}
+	data, err := parsedERC20.Pack(m.Name, args...)
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", m.Sig, err)
+	}
+	ret, err := s.client.CallContract(ctx, ethereum.CallMsg{From: s.from, To: &t.address, Data: data}, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", m.Sig, explainError(err, &parsedERC20))
+	}
+	// Tokens such as USDT return nothing at all, which is fine.
+	if len(ret) > 0 && new(big.Int).SetBytes(ret).Sign() == 0 {
+		return fmt.Errorf("%s returned false: %s refused it without reverting", m.Sig, t.address.Hex())
+	}
+
+	tx, err := s.transact(ctx, t.bound, &parsedERC20, &m, args, txo)
+	if err != nil {
+		return err
+	}
+	if txo.noWait {
+		return nil
+	}
+	rcpt, err := s.waitReceipt(ctx, tx, &parsedERC20)
+	if err != nil {
+		return err
+	}
+	t.client.ui.report.Transactions = append(t.client.ui.report.Transactions, *newTxReport(m.Sig, rcpt, printEvents(t.client.ui, rcpt, &parsedERC20)))
+	event := parsedERC20.Events[erc20SendEvents[method]]
+	found := false
+	for _, l := range rcpt.Logs {
+		if from, to, value, ok := tokenEvent(l, t.address, event.ID); ok {
+			found = true
+			t.client.ui.Printf("  %s %s: %s -> %s\n", event.Name, t.format(value), from.Hex(), to.Hex())
+		}
+	}
+	if !found {
+		if method == "transfer" {
+			return fmt.Errorf("tx %s emitted no Transfer event; the token probably returned false", tx.Hash().Hex())
+		}
+		t.client.ui.Warnf("warning: tx %s emitted no %s event\n", tx.Hash().Hex(), event.Name)
+	}
+	return nil
+}
+
+// tokenEvent decodes a Transfer or Approval log (selected by id) emitted
+// by token. ERC-721 Transfers, with the value indexed, are not matched.
+func tokenEvent(l *types.Log, token common.Address, id common.Hash) (from, to common.Address, value *big.Int, ok bool) {
+	if l.Address != token || len(l.Topics) != 3 || l.Topics[0] != id || len(l.Data) != 32 {
+		return common.Address{}, common.Address{}, nil, false
+	}
+	return common.BytesToAddress(l.Topics[1].Bytes()), common.BytesToAddress(l.Topics[2].Bytes()), new(big.Int).SetBytes(l.Data), true
+}
+
+// erc20Commands are the `erc20` subcommands. Each gets the token, the
+// session for those that sign (nil otherwise), the transaction flags and
+// the positional arguments after the token address.
+var erc20Commands = map[string]struct {
+	usage string
+	nargs int
+	signs bool
+	run   func(ctx context.Context, t *erc20Token, s *session, txo txOptions, args []string) error
+}{
+	"info": {"info <token>", 0, false, func(ctx context.Context, t *erc20Token, s *session, txo txOptions, args []string) error {
+		supply, err := t.amount(ctx, "totalSupply")
+		if err != nil {
+			return err
+		}
+		ui.Resultf("Token:        %s\n", t.address.Hex())
+		ui.Resultf("Name:         %s\n", t.name)
+		ui.Resultf("Symbol:       %s\n", t.symbol)
+		ui.Resultf("Decimals:     %d\n", t.decimals)
+		ui.Resultf("Total supply: %s (%s)\n", t.format(supply), supply)
+		ui.report.Token = t.report()
+		ui.report.Token.TotalSupply = supply.String()
+		return nil
+	}},
+	"balance": {"balance <token> <holder>", 1, false, func(ctx context.Context, t *erc20Token, s *session, txo txOptions, args []string) error {
+		holder, err := parseAddress(args[0])
+		if err != nil {
+			return err
+		}
+		balance, err := t.amount(ctx, "balanceOf", holder)
+		if err != nil {
+			return err
+		}
+		ui.Resultf("Balance of %s: %s (%s)\n", holder.Hex(), t.format(balance), balance)
+		ui.report.Token = t.report()
+		ui.report.Token.Balance = balance.String()
+		return nil
+	}},
+	"allowance": {"allowance <token> <owner> <spender>", 2, false, func(ctx context.Context, t *erc20Token, s *session, txo txOptions, args []string) error {
+		owner, err := parseAddress(args[0])
+		if err != nil {
+			return err
+		}
+		spender, err := parseAddress(args[1])
+		if err != nil {
+			return err
+		}
+		allowance, err := t.amount(ctx, "allowance", owner, spender)
+		if err != nil {
+			return err
+		}
+		ui.Resultf("Allowance of %s for %s: %s (%s)\n", spender.Hex(), owner.Hex(), t.format(allowance), allowance)
+		ui.report.Token = t.report()
+		ui.report.Token.Allowance = allowance.String()
+		return nil
+	}},
+	"transfer": {"transfer [flags] <token> <to> <amount>", 2, true, func(ctx context.Context, t *erc20Token, s *session, txo txOptions, args []string) error {
+		to, err := parseAddress(args[0])
+		if err != nil {
+			return err
+		}
+		amount, err := t.parseAmount(args[1])
+		if err != nil {
+			return err
+		}
+		ui.Printf("Transferring %s to %s\n", t.format(amount), to.Hex())
+		return t.send(ctx, s, txo, "transfer", to, amount)
+	}},
+	"approve": {"approve [flags] <token> <spender> <amount>", 2, true, func(ctx context.Context, t *erc20Token, s *session, txo txOptions, args []string) error {
+		spender, err := parseAddress(args[0])
+		if err != nil {
+			return err
+		}
+		amount, err := t.parseAmount(args[1])
+		if err != nil {
+			return err
+		}
+		ui.Printf("Approving %s to spend %s\n", spender.Hex(), t.format(amount))
+		return t.send(ctx, s, txo, "approve", spender, amount)
+	}},
+}
+
+func erc20Usage() error {
+	var usages []string
+	for _, cmd := range erc20Commands {
+		usages = append(usages, "erc20 "+cmd.usage)
+	}
+	usages = append(usages, "erc20 permit [--deadline 1h] [--style eip2612|dai] [--execute] <token> <spender> <amount|max>")
+	sort.Strings(usages)
+	return errors.New("usage:\n  " + strings.Join(usages, "\n  "))
+}
+
+// runERC20 implements `erc20 <subcommand> [flags] <token> [args...]`:
+// token reads and transfers without an artifact. Amounts are in whole
+// tokens, converted with the token's decimals.
+func runERC20(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return erc20Usage()
+	}
+	if args[0] == "permit" {
+		return runERC20Permit(ctx, args[1:])
+	}
+	cmd, ok := erc20Commands[args[0]]
+	if !ok {
+		return erc20Usage()
+	}
+	fs := flag.NewFlagSet("erc20 "+args[0], flag.ExitOnError)
+	var o options
+	var txo txOptions
+	o.register(fs)
+	if cmd.signs {
+		txo.register(fs)
+	}
+	if err := parseFlags(fs, args[1:], &o); err != nil {
+		return err
+	}
+	if fs.NArg() != cmd.nargs+1 {
+		return fmt.Errorf("usage: erc20 %s", cmd.usage)
+	}
+	address, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var s *session
+	var client *rpcClient
+	if cmd.signs {
+		if s, err = openSession(ctx, &o); err != nil {
+			return err
+		}
+		defer s.Close()
+		client = s.client
+	} else {
+		if client, _, err = connect(ctx, &o); err != nil {
+			return err
+		}
+		defer client.Close()
+	}
+	t, err := loadToken(ctx, client, address)
+	if err != nil {
+		return err
+	}
+	return cmd.run(ctx, t, s, txo, fs.Args()[1:])
+}
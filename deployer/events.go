@@ -0,0 +1,111 @@
+package deployer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// eventArg is one decoded event parameter.
+type eventArg struct {
+	Name    string      `json:"name"`
+	Type    string      `json:"type"`
+	Indexed bool        `json:"indexed"`
+	Value   interface{} `json:"value"`
+}
+
+// decodedEvent is a receipt log matched against an ABI. Logs that match no
+// event keep only their raw topics and data.
+type decodedEvent struct {
+	Address   common.Address `json:"address"`
+	LogIndex  uint           `json:"logIndex"`
+	Name      string         `json:"name,omitempty"`
+	Signature string         `json:"signature,omitempty"`
+	Args      []eventArg     `json:"args,omitempty"`
+	Topics    []common.Hash  `json:"topics,omitempty"`
+	Data      string         `json:"data,omitempty"`
+}
+
+// decodeLog matches l's first topic against the events in contractABI.
+func decodeLog(l *types.Log, contractABI *abi.ABI) decodedEvent {
+	ev := decodedEvent{Address: l.Address, LogIndex: l.Index}
+	raw := func() decodedEvent {
+		ev.Name, ev.Signature, ev.Args = "", "", nil
+		ev.Topics = l.Topics
+		ev.Data = formatValue(l.Data)
+		return ev
+	}
+	if contractABI == nil || len(l.Topics) == 0 {
+		return raw()
+	}
+	e, err := contractABI.EventByID(l.Topics[0])
+	if err != nil {
+		return raw()
+	}
+	ev.Name, ev.Signature = e.Name, e.Sig
+
+	nonIndexed, err := e.Inputs.NonIndexed().Unpack(l.Data)
+	if err != nil {
+		return raw()
+	}
+	topics := l.Topics[1:]
+	for i, in := range e.Inputs {
+		arg := eventArg{Name: argName(e.Inputs, i), Type: in.Type.String(), Indexed: in.Indexed}
+		if in.Indexed {
+			if len(topics) == 0 {
+				return raw()
+			}
+			m := map[string]interface{}{}
+			if err := abi.ParseTopicsIntoMap(m, abi.Arguments{in}, topics[:1]); err != nil {
+				return raw()
+			}
+			arg.Value, topics = m[in.Name], topics[1:]
+		} else {
+			if len(nonIndexed) == 0 {
+				return raw()
+			}
+			arg.Value, nonIndexed = nonIndexed[0], nonIndexed[1:]
+		}
+		ev.Args = append(ev.Args, arg)
+	}
+	return ev
+}
+
+// String renders EventName(param=value, ...) or the raw log.
+func (e decodedEvent) String() string {
+	if e.Name == "" {
+		topics := make([]string, len(e.Topics))
+		for i, t := range e.Topics {
+			topics[i] = t.Hex()
+		}
+		return fmt.Sprintf("log from %s topics=[%s] data=%s", e.Address.Hex(), strings.Join(topics, ", "), e.Data)
+	}
+	parts := make([]string, len(e.Args))
+	for i, a := range e.Args {
+		parts[i] = fmt.Sprintf("%s=%s", a.Name, formatValue(a.Value))
+	}
+	return fmt.Sprintf("%s(%s)", e.Name, strings.Join(parts, ", "))
+}
+
+// MarshalJSON renders argument values with jsonValue.
+func (a eventArg) MarshalJSON() ([]byte, error) {
+	type plain eventArg
+	p := plain(a)
+	p.Value = jsonValue(a.Value)
+	return json.Marshal(p)
+}
+
+// printEvents prints the decoded logs of rcpt to l, one per line, and
+// returns them for the JSON report.
+func printEvents(l *logger, rcpt *types.Receipt, contractABI *abi.ABI) []decodedEvent {
+	events := make([]decodedEvent, len(rcpt.Logs))
+	for i, lg := range rcpt.Logs {
+		events[i] = decodeLog(lg, contractABI)
+		l.Println("  event", events[i])
+	}
+	return events
+}
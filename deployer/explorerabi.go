@@ -0,0 +1,208 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// explorerABIAttempts is how many times a rate-limited getabi request is
+// made; the wait doubles from a second after each.
+const explorerABIAttempts = 5
+
+// abiOptions let call, send and logs work on contracts without an
+// artifact: an ABI file, human-readable fragments, or the verified ABI
+// from the chain's explorer.
+type abiOptions struct {
+	file         string
+	sigs         fragmentList
+	fromExplorer bool
+	apiURL       string
+}
+
+func (o *abiOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.file, "abi", "", "`file` with the contract's ABI (a bare ABI array, any artifact, or human-readable fragments), instead of --contract")
+	fs.Var(&o.sigs, "sig", "human-readable ABI `fragment`, e.g. \"function greet() view returns (string)\", instead of --contract (repeatable)")
+	fs.BoolVar(&o.fromExplorer, "abi-from-explorer", false, "fetch the contract's verified ABI from the chain's Etherscan-compatible explorer, following EIP-1967 proxies to the implementation")
+	fs.StringVar(&o.apiURL, "etherscan-url", "", "with --abi-from-explorer, Etherscan-compatible API URL (default by chain ID)")
+}
+
+// contractABI loads the ABI of the contract at address: from --abi or
+// --sig, from the explorer, or from the artifact ao names. The explorer needs client
+// to follow proxies.
+func (o abiOptions) contractABI(ctx context.Context, ao artifactOptions, client *rpcClient, chainID *big.Int, address common.Address) (*Artifact, error) {
+	sources := 0
+	for _, set := range []bool{o.file != "", len(o.sigs) > 0, o.fromExplorer} {
+		if set {
+			sources++
+		}
+	}
+	switch {
+	case sources > 1:
+		return nil, errors.New("pass only one of --abi, --sig and --abi-from-explorer")
+	case o.file != "":
+		return loadABI(o.file, "")
+	case len(o.sigs) > 0:
+		return fragmentArtifact("fragments", o.sigs)
+	case o.fromExplorer:
+		if client == nil {
+			return nil, errors.New("--abi-from-explorer needs a node to read the proxy slots from")
+		}
+		return explorerContract(ctx, o, client, chainID, address)
+	}
+	path, contract, err := ao.resolve()
+	if err != nil {
+		return nil, err
+	}
+	return loadABI(path, contract)
+}
+
+// explorerContract is the verified ABI of address and, if it is an
+// EIP-1967 proxy, of its implementation, merged: the implementation's
+// functions, events and errors, and the proxy's own that it lacks.
+func explorerContract(ctx context.Context, o abiOptions, client *rpcClient, chainID *big.Int, address common.Address) (*Artifact, error) {
+	api, err := (&verifyOptions{apiURL: o.apiURL}).apiFor(chainID)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := explorerABI(ctx, api, chainID, address)
+	if err != nil {
+		return nil, err
+	}
+	p, err := readProxy(ctx, client, address, nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.Implementation != nil {
+		client.ui.Printf("%s is a proxy (%s); fetching the ABI of its implementation %s\n", address.Hex(), p.Kind, p.Implementation.Hex())
+		impl, err := explorerABI(ctx, api, chainID, *p.Implementation)
+		if err != nil {
+			return nil, fmt.Errorf("implementation of %s: %w", address.Hex(), err)
+		}
+		if raw, err = mergeABIs(impl, raw); err != nil {
+			return nil, err
+		}
+	}
+	a, err := newArtifact(address.Hex(), raw, codeObject{}, codeObject{})
+	if err != nil {
+		return nil, fmt.Errorf("explorer ABI of %s: %w", address.Hex(), err)
+	}
+	a.Path = api
+	return a, nil
+}
+
+// explorerABICache is where the verified ABI of address on chainID is
+// kept: ~/.cache/nyc2025/abis/<chainid>/<address>.json. Verified code
+// cannot change, so it never expires.
+func explorerABICache(chainID *big.Int, address common.Address) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "nyc2025", "abis", chainID.String(), strings.ToLower(address.Hex())+".json")
+}
+
+// explorerABI is the verified ABI of address, from the cache or the
+// explorer's getabi endpoint. Rate limiting is retried with backoff.
+func explorerABI(ctx context.Context, api string, chainID *big.Int, address common.Address) (json.RawMessage, error) {
+	cache := explorerABICache(chainID, address)
+	if raw, err := os.ReadFile(cache); cache != "" && err == nil && json.Valid(raw) {
+		ui.Verbosef("ABI of %s from %s\n", address.Hex(), cache)
+		return raw, nil
+	}
+	apiKey := os.Getenv("ETHERSCAN_API_KEY")
+	if apiKey == "" {
+		ui.Verbosef("ETHERSCAN_API_KEY is not set; explorers that need a key will refuse\n")
+	}
+	e := &etherscan{api: api, apiKey: apiKey, http: &http.Client{Timeout: 30 * time.Second}}
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		r, err := e.do(ctx, url.Values{"module": {"contract"}, "action": {"getabi"}, "address": {address.Hex()}}, nil)
+		limited := (err != nil && strings.Contains(err.Error(), "429")) ||
+			(err == nil && r.Status != "1" && strings.Contains(strings.ToLower(r.Result+r.Message), "rate limit"))
+		if limited && attempt < explorerABIAttempts {
+			ui.Verbosef("explorer rate limit; retrying in %s\n", backoff)
+			if err := sleep(ctx, backoff); err != nil {
+				return nil, err
+			}
+			backoff *= 2
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("getabi %s: %w", address.Hex(), err)
+		}
+		if r.Status != "1" {
+			if strings.Contains(strings.ToLower(r.Result), "not verified") {
+				return nil, fmt.Errorf("%s is not verified on %s; pass its ABI with --abi <file> instead", address.Hex(), api)
+			}
+			return nil, fmt.Errorf("getabi %s: %s: %s", address.Hex(), r.Message, r.Result)
+		}
+		raw := json.RawMessage(r.Result)
+		if !json.Valid(raw) {
+			return nil, fmt.Errorf("getabi %s: not a JSON ABI: %.80s", address.Hex(), r.Result)
+		}
+		if cache != "" {
+			if err := writeJSON(cache, raw); err != nil {
+				ui.Warnf("warning: cache ABI: %v\n", err)
+			}
+		}
+		return raw, nil
+	}
+}
+
+// mergeABIs is primary with the entries of secondary it does not have,
+// compared by signature, so a function both declare is not overloaded.
+func mergeABIs(primary, secondary json.RawMessage) (json.RawMessage, error) {
+	var a, b []json.RawMessage
+	if err := json.Unmarshal(primary, &a); err != nil {
+		return nil, fmt.Errorf("parse abi: %w", err)
+	}
+	if err := json.Unmarshal(secondary, &b); err != nil {
+		return nil, fmt.Errorf("parse abi: %w", err)
+	}
+	have := map[string]bool{}
+	for _, e := range a {
+		have[abiEntryKey(e)] = true
+	}
+	for _, e := range b {
+		if k := abiEntryKey(e); !have[k] {
+			have[k] = true
+			a = append(a, e)
+		}
+	}
+	return json.Marshal(a)
+}
+
+// abiEntryKey identifies one ABI entry: its kind and signature.
+func abiEntryKey(entry json.RawMessage) string {
+	parsed, err := abi.JSON(strings.NewReader("[" + string(entry) + "]"))
+	if err != nil {
+		return string(entry)
+	}
+	for _, m := range parsed.Methods {
+		return "function " + m.Sig
+	}
+	for _, e := range parsed.Events {
+		return "event " + e.Sig
+	}
+	for _, e := range parsed.Errors {
+		return "error " + e.Sig
+	}
+	var head struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(entry, &head)
+	return head.Type
+}
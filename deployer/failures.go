@@ -0,0 +1,138 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Failure classes scripts can tell apart. An error the package returns
+// matches at most one of them with errors.Is, and the CLI exits with the
+// class's status (see ExitCode); anything else is unexpected.
+var (
+	ErrReverted          = errors.New("reverted")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrNonceConflict     = errors.New("nonce conflict")
+	ErrRPCUnavailable    = errors.New("rpc unavailable")
+	ErrChainMismatch     = errors.New("chain id mismatch")
+	ErrUserAborted       = errors.New("aborted by the user")
+)
+
+// failureClasses maps each class to its code in the JSON report and its
+// exit status. 2 is taken by flag errors.
+var failureClasses = []struct {
+	class error
+	code  string
+	exit  int
+}{
+	{ErrReverted, "reverted", 3},
+	{ErrInsufficientFunds, "insufficient_funds", 4},
+	{ErrNonceConflict, "nonce_conflict", 5},
+	{ErrRPCUnavailable, "rpc_unavailable", 6},
+	{ErrChainMismatch, "chain_mismatch", 7},
+	{ErrUserAborted, "user_aborted", 8},
+}
+
+// RevertError is a mined transaction that reverted, or a call or gas
+// estimate the node rejected with revert data. It matches ErrReverted.
+type RevertError struct {
+	TxHash common.Hash // zero when nothing was mined
+	Reason string      // the decoded revert, such as Error("...") [0x08c379a0]
+
+	msg string
+	err error // the node's answer to a call
+}
+
+func (e *RevertError) Error() string { return e.msg }
+
+func (e *RevertError) Unwrap() error { return e.err }
+
+func (e *RevertError) Is(target error) bool { return target == ErrReverted }
+
+// classError puts err in a failure class without changing its message.
+type classError struct {
+	class error
+	err   error
+}
+
+func (e *classError) Error() string { return e.err.Error() }
+
+func (e *classError) Unwrap() error { return e.err }
+
+func (e *classError) Is(target error) bool { return target == e.class }
+
+// classify puts err in class unless it already has one; nil stays nil.
+func classify(class, err error) error {
+	if err == nil || failureClass(err) != nil {
+		return err
+	}
+	return &classError{class: class, err: err}
+}
+
+// failureClass returns the class err matches, or nil. A canceled context
+// is the user stopping the run with Ctrl-C.
+func failureClass(err error) error {
+	for _, c := range failureClasses {
+		if errors.Is(err, c.class) {
+			return c.class
+		}
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrUserAborted
+	}
+	return nil
+}
+
+// classifyNodeError classifies the node's rejection of a transaction, or
+// of the estimate for one, by its message; clients word them alike.
+func classifyNodeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "insufficient funds"):
+		return classify(ErrInsufficientFunds, err)
+	case strings.Contains(msg, "nonce too low"), strings.Contains(msg, "nonce too high"),
+		strings.Contains(msg, "replacement transaction underpriced"), strings.Contains(msg, "replacement fee too low"):
+		return classify(ErrNonceConflict, err)
+	case transient(err):
+		return classify(ErrRPCUnavailable, err)
+	}
+	return err
+}
+
+// errorCode is the code of err's class in the JSON report: "error" when
+// it has none.
+func errorCode(err error) string {
+	class := failureClass(err)
+	for _, c := range failureClasses {
+		if c.class == class {
+			return c.code
+		}
+	}
+	return "error"
+}
+
+// ExitCode is the exit status for err: 0 for nil, an ExitError's own
+// code, 3 to 8 for the failure classes (a revert, insufficient funds, a
+// nonce conflict, an unreachable node, the wrong chain, a declined
+// prompt or Ctrl-C), and 1 for anything else.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exit *ExitError
+	if errors.As(err, &exit) {
+		return exit.Code
+	}
+	class := failureClass(err)
+	for _, c := range failureClasses {
+		if c.class == class {
+			return c.exit
+		}
+	}
+	return 1
+}
@@ -0,0 +1,116 @@
+package deployer
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestExitCode forces each failure class through a deploy or send on
+// the simulated chain, or against a node that is down, and checks the
+// exit status and report code it ends in, wrapped as callers wrap it.
+func TestExitCode(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		run  func(t *testing.T) error
+		exit int
+		code string
+	}{
+		{"reverting constructor", func(t *testing.T) error {
+			r := newDeployRun(t)
+			args := r.args()
+			args[len(args)-1] = "" // the greeter reverts on an empty greeting
+			return runDeploy(t.Context(), args)
+		}, 3, "reverted"},
+		{"unfunded key", func(t *testing.T) error {
+			r := newDeployRun(t)
+			t.Setenv("PRIVATE_KEY", relayerKey)
+			return r.run(t)
+		}, 4, "insufficient_funds"},
+		{"nonce conflict", func(t *testing.T) error {
+			r := newDeployRun(t)
+			if err := r.run(t); err != nil {
+				t.Fatal(err)
+			}
+			m, err := readManifest(manifestPath(r.dir, big.NewInt(1337), "Greeter"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return runSend(t.Context(), []string{"--rpc", r.chain.rpc, "--poll-interval", "10ms", "--yes", "--nonce", "0",
+				"--artifact", r.artifact, m.latest().Address.Hex(), "setGreeting", "again"})
+		}, 5, "nonce_conflict"},
+		{"dead rpc", func(t *testing.T) error {
+			r := newDeployRun(t)
+			args := r.args("--retry-delay", "1ms")
+			args[1] = downURL
+			return runDeploy(t.Context(), args)
+		}, 6, "rpc_unavailable"},
+		{"wrong chain id", func(t *testing.T) error {
+			return newDeployRun(t).run(t, "--expect-chain-id", "1")
+		}, 7, "chain_mismatch"},
+		{"declined prompt", func(t *testing.T) error {
+			chain := newSimChain(t)
+			chain.autoCommit(t)
+			c := chain.dial(t, Config{})
+			c.s.yes, c.s.stdin = false, strings.NewReader("n\n")
+			_, err := c.Deploy(t.Context(), greeter(t), "hello")
+			return err
+		}, 8, "user_aborted"},
+		{"verify-bytecode mismatch", func(t *testing.T) error {
+			r := newDeployRun(t)
+			if err := r.run(t); err != nil {
+				t.Fatal(err)
+			}
+			m, err := readManifest(manifestPath(r.dir, big.NewInt(1337), "Greeter"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			other := writeArtifact(t, t.TempDir(), "Pointer", pointerABI)
+			return runVerifyBytecode(t.Context(), []string{"--rpc", r.chain.rpc, "--artifact", other, m.latest().Address.Hex()})
+		}, exitMismatch, "error"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run(t)
+			if err == nil {
+				t.Fatal("succeeded")
+			}
+			// Wrapping, and Main's ReportedError, keep the class.
+			for _, err := range []error{err, fmt.Errorf("step Token: %w", err), &ReportedError{Err: err}} {
+				if got := ExitCode(err); got != tt.exit {
+					t.Errorf("ExitCode(%v) = %d, want %d", err, got, tt.exit)
+				}
+				if got := errorCode(err); got != tt.code {
+					t.Errorf("errorCode(%v) = %q, want %q", err, got, tt.code)
+				}
+			}
+		})
+	}
+	if got := ExitCode(nil); got != 0 {
+		t.Errorf("ExitCode(nil) = %d, want 0", got)
+	}
+}
+
+// TestMainReportedError checks that Main wraps a failure it has already
+// printed in the JSON report, with the same exit status.
+func TestMainReportedError(t *testing.T) {
+	isolate(t)
+	t.Cleanup(func() { ui.json = false; ui.report = Report{} })
+	missing := filepath.Join(t.TempDir(), "missing.toml")
+
+	err := Main(t.Context(), []string{"balances", "--config", missing, "--profile", "prod", "--output", "json", testAddr.Hex()})
+	var reported *ReportedError
+	if !errors.As(err, &reported) {
+		t.Fatalf("Main with --output json = %v, want a ReportedError", err)
+	}
+	if ExitCode(err) != 1 || ui.report.Error == nil || ui.report.Error.Code != "error" {
+		t.Fatalf("exit %d, report error %+v; want 1 and code error", ExitCode(err), ui.report.Error)
+	}
+
+	ui.json = false
+	if err := Main(t.Context(), []string{"balances", "--config", missing, "--profile", "prod", testAddr.Hex()}); err == nil || errors.As(err, &reported) {
+		t.Fatalf("Main without --output json = %v, want the plain error", err)
+	}
+}
@@ -0,0 +1,210 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// feeOverrides holds the optional --max-fee / --priority-fee values in wei.
+// History is set with --fee-strategy feehistory.
+type feeOverrides struct {
+	MaxFee      *big.Int
+	PriorityFee *big.Int
+	History     *feeHistoryOracle
+}
+
+// feeHistoryOptions are the flags of the feehistory fee strategy.
+type feeHistoryOptions struct {
+	strategy   string
+	blocks     uint64
+	percentile float64
+	lookahead  uint64
+}
+
+func (o *feeHistoryOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.strategy, "fee-strategy", "rpc", "how fees are priced: rpc (the node's eth_maxPriorityFeePerGas and 2x the base fee) or feehistory")
+	fs.Uint64Var(&o.blocks, "fee-blocks", 20, "with --fee-strategy feehistory, recent blocks to take tips from")
+	fs.Float64Var(&o.percentile, "fee-percentile", 50, "with --fee-strategy feehistory, the percentile of each block's tips to pay")
+	fs.Uint64Var(&o.lookahead, "fee-lookahead", 3, "with --fee-strategy feehistory, blocks of maximum (12.5%) base fee growth the fee cap covers")
+}
+
+// oracle checks the flags and returns the feehistory oracle, or nil for
+// the rpc strategy.
+func (o feeHistoryOptions) oracle() (*feeHistoryOracle, error) {
+	switch o.strategy {
+	case "rpc":
+		return nil, nil
+	case "feehistory":
+	default:
+		return nil, fmt.Errorf("--fee-strategy: want rpc or feehistory, got %q", o.strategy)
+	}
+	if o.blocks == 0 || o.blocks > 1024 {
+		return nil, errors.New("--fee-blocks must be between 1 and 1024")
+	}
+	if o.percentile < 0 || o.percentile > 100 {
+		return nil, errors.New("--fee-percentile must be between 0 and 100")
+	}
+	return &feeHistoryOracle{feeHistoryOptions: o}, nil
+}
+
+// feeHistoryOracle prices transactions from eth_feeHistory. basis
+// describes the last fees it derived, for the transaction summary.
+type feeHistoryOracle struct {
+	feeHistoryOptions
+	basis  string
+	failed bool
+}
+
+func (c *rpcClient) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error) {
+	return read(ctx, c, "eth_feeHistory", func(ctx context.Context, cl *ethclient.Client) (*ethereum.FeeHistory, error) {
+		return cl.FeeHistory(ctx, blockCount, lastBlock, rewardPercentiles)
+	})
+}
+
+// projectBaseFee is the highest base fee blocks blocks after one with
+// base fee can have: 12.5% more each block, rounded up.
+func projectBaseFee(base *big.Int, blocks uint64) *big.Int {
+	fee := new(big.Int).Set(base)
+	for range blocks {
+		growth := new(big.Int).Add(fee, big.NewInt(7))
+		fee.Add(fee, growth.Div(growth, big.NewInt(8)))
+	}
+	return fee
+}
+
+// medianTip is the median of the blocks' rewards at the requested
+// percentile, leaving out empty blocks, which report no tips. It is nil
+// when every block was empty.
+func medianTip(h *ethereum.FeeHistory) *big.Int {
+	var tips []*big.Int
+	for i, r := range h.Reward {
+		if len(r) == 0 || (i < len(h.GasUsedRatio) && h.GasUsedRatio[i] == 0) {
+			continue
+		}
+		tips = append(tips, r[0])
+	}
+	if len(tips) == 0 {
+		return nil
+	}
+	slices.SortFunc(tips, func(a, b *big.Int) int { return a.Cmp(b) })
+	return tips[len(tips)/2]
+}
+
+// feeEstimate is what a fee history says about the next block: its base
+// fee, the highest that can be lookahead blocks later, and the tip to
+// pay, nil when the blocks had no tips to go by.
+type feeEstimate struct {
+	base      *big.Int
+	projected *big.Int
+	tip       *big.Int
+	blocks    int
+}
+
+// estimate derives the fee estimate from h.
+func (o *feeHistoryOracle) estimate(h *ethereum.FeeHistory) (*feeEstimate, error) {
+	if len(h.BaseFee) == 0 {
+		return nil, errors.New("no base fees in fee history")
+	}
+	next := h.BaseFee[len(h.BaseFee)-1]
+	return &feeEstimate{
+		base:      next,
+		projected: projectBaseFee(next, o.lookahead),
+		tip:       medianTip(h),
+		blocks:    len(h.Reward),
+	}, nil
+}
+
+// suggest reads the fee history and estimates from it. It returns nil,
+// after warning once, when the node has none; the caller then falls back
+// to the suggestion RPCs.
+func (o *feeHistoryOracle) suggest(ctx context.Context, client *rpcClient) *feeEstimate {
+	if o.failed {
+		return nil
+	}
+	h, err := client.FeeHistory(ctx, o.blocks, nil, []float64{o.percentile})
+	var e *feeEstimate
+	if err == nil {
+		e, err = o.estimate(h)
+	}
+	if err != nil {
+		o.failed = true
+		client.ui.Warnf("warning: fee history: %v; pricing with the suggestion RPCs instead\n", err)
+		return nil
+	}
+	if e.tip == nil {
+		client.ui.Verbosef("No tips in the last %d blocks; taking the tip from eth_maxPriorityFeePerGas\n", e.blocks)
+	}
+	return e
+}
+
+// applyFees sets either EIP-1559 or legacy pricing on auth, depending on
+// whether the head block carries a base fee. Dynamic fees default to
+// base fee * 2 + tip, or with fo.History to what the fee history
+// suggests; the overrides replace the computed values.
+func applyFees(ctx context.Context, client *rpcClient, auth *bind.TransactOpts, fo feeOverrides) error {
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("head header: %w", err)
+	}
+
+	if head.BaseFee == nil {
+		// Pre-London chain (or an L2 without 1559): legacy gas price.
+		gp := fo.MaxFee
+		if gp == nil {
+			if gp, err = client.SuggestGasPrice(ctx); err != nil {
+				return fmt.Errorf("gas price: %w", err)
+			}
+		}
+		auth.GasPrice, auth.GasFeeCap, auth.GasTipCap = gp, nil, nil
+		return nil
+	}
+
+	var est *feeEstimate
+	if fo.History != nil {
+		fo.History.basis = ""
+		if fo.MaxFee == nil || fo.PriorityFee == nil {
+			est = fo.History.suggest(ctx, client)
+		}
+	}
+	tip, tipFrom := fo.PriorityFee, "--priority-fee"
+	if tip == nil && est != nil && est.tip != nil {
+		tip, tipFrom = est.tip, fmt.Sprintf("p%g of %d blocks", fo.History.percentile, est.blocks)
+	}
+	if tip == nil {
+		if tip, err = client.SuggestGasTipCap(ctx); err != nil {
+			return fmt.Errorf("gas tip cap: %w", err)
+		}
+		tipFrom = "eth_maxPriorityFeePerGas"
+	}
+	feeCap := fo.MaxFee
+	switch {
+	case feeCap != nil:
+	case est != nil:
+		feeCap = new(big.Int).Add(est.projected, tip)
+		fo.History.basis = fmt.Sprintf("base fee %s wei, at most %s wei in %d blocks; tip %s wei (%s)", est.base, est.projected, fo.History.lookahead, tip, tipFrom)
+	default:
+		feeCap = new(big.Int).Mul(head.BaseFee, big.NewInt(2))
+		feeCap.Add(feeCap, tip)
+	}
+	if feeCap.Cmp(tip) < 0 {
+		return fmt.Errorf("max fee %s is below priority fee %s", feeCap, tip)
+	}
+	auth.GasPrice, auth.GasFeeCap, auth.GasTipCap = nil, feeCap, tip
+	return nil
+}
+
+// describeFees renders the pricing currently set on auth.
+func describeFees(auth *bind.TransactOpts) string {
+	if auth.GasPrice != nil {
+		return fmt.Sprintf("legacy gasPrice=%s wei", auth.GasPrice)
+	}
+	return fmt.Sprintf("eip1559 maxFee=%s wei priorityFee=%s wei", auth.GasFeeCap, auth.GasTipCap)
+}
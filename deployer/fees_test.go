@@ -0,0 +1,314 @@
+package deployer
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func gwei(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e9))
+}
+
+// feeNode is a node whose head block has baseFee (nil before London),
+// suggesting gasPrice and tip. history, if set, answers eth_feeHistory,
+// and percentiles records what was asked for.
+type feeNode struct {
+	baseFee, gasPrice, tip *big.Int
+	history                map[string]interface{}
+	percentiles            []float64
+}
+
+func (f *feeNode) dial(t *testing.T) (*fakeNode, *rpcClient) {
+	t.Helper()
+	node := newFakeNode(t, map[string]func([]json.RawMessage) (interface{}, error){
+		"eth_getBlockByNumber": func([]json.RawMessage) (interface{}, error) {
+			return &types.Header{Number: big.NewInt(100), Difficulty: new(big.Int), BaseFee: f.baseFee}, nil
+		},
+		"eth_gasPrice":             func([]json.RawMessage) (interface{}, error) { return (*hexutil.Big)(f.gasPrice), nil },
+		"eth_maxPriorityFeePerGas": func([]json.RawMessage) (interface{}, error) { return (*hexutil.Big)(f.tip), nil },
+		"eth_feeHistory": func(params []json.RawMessage) (interface{}, error) {
+			if f.history == nil {
+				return nil, errors.New("the method eth_feeHistory does not exist")
+			}
+			if len(params) == 3 {
+				json.Unmarshal(params[2], &f.percentiles)
+			}
+			return f.history, nil
+		},
+	})
+	c, err := testDial(t, node.url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node, c
+}
+
+// history is an eth_feeHistory answer for blocks with the given tips at
+// the requested percentile and gas used ratios, and the base fee of the
+// block after them last.
+func history(tips []int64, used []float64, nextBase *big.Int) map[string]interface{} {
+	var reward [][]*hexutil.Big
+	var bases []*hexutil.Big
+	for _, tip := range tips {
+		reward = append(reward, []*hexutil.Big{(*hexutil.Big)(gwei(tip))})
+		bases = append(bases, (*hexutil.Big)(nextBase))
+	}
+	return map[string]interface{}{
+		"oldestBlock":   hexutil.Uint64(100 - len(tips)),
+		"reward":        reward,
+		"baseFeePerGas": append(bases, (*hexutil.Big)(nextBase)),
+		"gasUsedRatio":  used,
+	}
+}
+
+func TestApplyFeesLegacy(t *testing.T) {
+	f := &feeNode{gasPrice: gwei(7), tip: gwei(1)}
+	node, c := f.dial(t)
+
+	var auth bind.TransactOpts
+	if err := applyFees(t.Context(), c, &auth, feeOverrides{}); err != nil {
+		t.Fatal(err)
+	}
+	if auth.GasPrice.Cmp(gwei(7)) != 0 || auth.GasFeeCap != nil || auth.GasTipCap != nil {
+		t.Fatalf("pre-London fees: %s, want legacy gasPrice=7 gwei", describeFees(&auth))
+	}
+	// --max-fee is the gas price; --priority-fee has nothing to apply to.
+	if err := applyFees(t.Context(), c, &auth, feeOverrides{MaxFee: gwei(9), PriorityFee: gwei(2)}); err != nil {
+		t.Fatal(err)
+	}
+	if auth.GasPrice.Cmp(gwei(9)) != 0 {
+		t.Fatalf("pre-London fees with --max-fee: %s, want gasPrice=9 gwei", describeFees(&auth))
+	}
+	if n := node.count("eth_maxPriorityFeePerGas"); n != 0 {
+		t.Fatalf("eth_maxPriorityFeePerGas called %d times on a legacy chain", n)
+	}
+}
+
+func TestApplyFeesDynamic(t *testing.T) {
+	f := &feeNode{baseFee: gwei(10), gasPrice: gwei(12), tip: gwei(2)}
+	node, c := f.dial(t)
+
+	// A legacy price set before is cleared.
+	auth := bind.TransactOpts{GasPrice: gwei(100)}
+	if err := applyFees(t.Context(), c, &auth, feeOverrides{}); err != nil {
+		t.Fatal(err)
+	}
+	if auth.GasPrice != nil || auth.GasFeeCap.Cmp(gwei(22)) != 0 || auth.GasTipCap.Cmp(gwei(2)) != 0 {
+		t.Fatalf("London fees: %s, want maxFee=2*10+2 gwei priorityFee=2 gwei", describeFees(&auth))
+	}
+	if n := node.count("eth_gasPrice"); n != 0 {
+		t.Fatalf("eth_gasPrice called %d times on a London chain", n)
+	}
+
+	if err := applyFees(t.Context(), c, &auth, feeOverrides{PriorityFee: gwei(3)}); err != nil {
+		t.Fatal(err)
+	}
+	if auth.GasFeeCap.Cmp(gwei(23)) != 0 || auth.GasTipCap.Cmp(gwei(3)) != 0 {
+		t.Fatalf("fees with --priority-fee 3gwei: %s, want maxFee=23 gwei", describeFees(&auth))
+	}
+}
+
+// TestApplyFeesTxType signs a transfer with the fees applied: a type-2
+// transaction capped at 2*base fee + tip once the head has a base fee,
+// and a legacy one before.
+func TestApplyFeesTxType(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		baseFee, tip *big.Int
+	}{
+		{"pre-London", nil, gwei(1)},
+		{"London", gwei(10), gwei(2)},
+		{"odd base fee", big.NewInt(1_000_000_007), big.NewInt(3)},
+		{"zero base fee", new(big.Int), gwei(1)},
+	} {
+		f := &feeNode{baseFee: tt.baseFee, gasPrice: gwei(7), tip: tt.tip}
+		_, c := f.dial(t)
+		key, err := crypto.HexToECDSA(testKey[2:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		auth, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337))
+		if err != nil {
+			t.Fatal(err)
+		}
+		auth.Nonce, auth.GasLimit, auth.NoSend = new(big.Int), 21000, true
+		if err := applyFees(t.Context(), c, auth, feeOverrides{}); err != nil {
+			t.Fatal(err)
+		}
+		tx, err := bind.NewBoundContract(testAddr, abi.ABI{}, c, c, c).RawTransact(auth, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if tt.baseFee == nil {
+			if tx.Type() != types.LegacyTxType || tx.GasPrice().Cmp(gwei(7)) != 0 {
+				t.Errorf("%s: type %d at %s wei, want legacy at 7 gwei", tt.name, tx.Type(), tx.GasPrice())
+			}
+			continue
+		}
+		wantCap := new(big.Int).Add(new(big.Int).Mul(tt.baseFee, big.NewInt(2)), tt.tip)
+		if tx.Type() != types.DynamicFeeTxType {
+			t.Errorf("%s: type %d, want %d", tt.name, tx.Type(), types.DynamicFeeTxType)
+		}
+		if tx.GasFeeCap().Cmp(wantCap) != 0 || tx.GasTipCap().Cmp(tt.tip) != 0 {
+			t.Errorf("%s: maxFee %s priorityFee %s, want %s and %s", tt.name, tx.GasFeeCap(), tx.GasTipCap(), wantCap, tt.tip)
+		}
+	}
+}
+
+func TestApplyFeesMaxFeeCap(t *testing.T) {
+	f := &feeNode{baseFee: gwei(50), tip: gwei(2), history: history([]int64{1, 2, 3}, []float64{0.5, 0.5, 0.5}, gwei(50))}
+	_, c := f.dial(t)
+	oracle, err := feeHistoryOptions{strategy: "feehistory", blocks: 3, percentile: 50, lookahead: 3}.oracle()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cap holds even when the base fee asks for more.
+	for _, fo := range []feeOverrides{
+		{MaxFee: gwei(30)},
+		{MaxFee: gwei(30), History: oracle},
+	} {
+		var auth bind.TransactOpts
+		if err := applyFees(t.Context(), c, &auth, fo); err != nil {
+			t.Fatal(err)
+		}
+		if auth.GasFeeCap.Cmp(gwei(30)) != 0 || auth.GasTipCap.Cmp(gwei(30)) > 0 {
+			t.Errorf("fees with --max-fee 30gwei (history %v): %s, want maxFee=30 gwei", fo.History != nil, describeFees(&auth))
+		}
+	}
+
+	var auth bind.TransactOpts
+	err = applyFees(t.Context(), c, &auth, feeOverrides{MaxFee: gwei(1), PriorityFee: gwei(2)})
+	if err == nil || !strings.Contains(err.Error(), "max fee 1000000000 is below priority fee 2000000000") {
+		t.Fatalf("--max-fee below --priority-fee: %v", err)
+	}
+}
+
+func TestApplyFeesHistory(t *testing.T) {
+	// Tips of 1..5 gwei with an empty block paying 100 gwei, which is
+	// left out; the median of the rest is 3 gwei.
+	f := &feeNode{
+		baseFee: gwei(40), tip: gwei(9),
+		history: history([]int64{5, 100, 1, 4, 3, 2}, []float64{0.9, 0, 0.4, 0.5, 0.2, 0.7}, gwei(1)),
+	}
+	_, c := f.dial(t)
+	oracle, err := feeHistoryOptions{strategy: "feehistory", blocks: 6, percentile: 25, lookahead: 3}.oracle()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var auth bind.TransactOpts
+	if err := applyFees(t.Context(), c, &auth, feeOverrides{History: oracle}); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.percentiles) != 1 || f.percentiles[0] != 25 {
+		t.Fatalf("eth_feeHistory asked for percentiles %v, want [25]", f.percentiles)
+	}
+	// 1 gwei grown by 12.5% three times, rounding up, plus the tip.
+	projected := big.NewInt(1_423_828_125)
+	if auth.GasTipCap.Cmp(gwei(3)) != 0 || auth.GasFeeCap.Cmp(new(big.Int).Add(projected, gwei(3))) != 0 {
+		t.Fatalf("feehistory fees: %s, want priorityFee=3 gwei maxFee=%s+3 gwei", describeFees(&auth), projected)
+	}
+	if want := "base fee 1000000000 wei, at most 1423828125 wei in 3 blocks; tip 3000000000 wei (p25 of 6 blocks)"; oracle.basis != want {
+		t.Fatalf("basis %q, want %q", oracle.basis, want)
+	}
+
+	// With every block empty the tip comes from the node.
+	f.history = history([]int64{5, 6}, []float64{0, 0}, gwei(1))
+	if err := applyFees(t.Context(), c, &auth, feeOverrides{History: oracle}); err != nil {
+		t.Fatal(err)
+	}
+	if auth.GasTipCap.Cmp(gwei(9)) != 0 || !strings.HasSuffix(oracle.basis, "(eth_maxPriorityFeePerGas)") {
+		t.Fatalf("feehistory fees with empty blocks: %s (%s), want the node's 9 gwei tip", describeFees(&auth), oracle.basis)
+	}
+}
+
+func TestApplyFeesHistoryUnsupported(t *testing.T) {
+	warned := warnings(t)
+	f := &feeNode{baseFee: gwei(10), tip: gwei(2)}
+	node, c := f.dial(t)
+	oracle, err := feeHistoryOptions{strategy: "feehistory", blocks: 20, percentile: 50, lookahead: 3}.oracle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		var auth bind.TransactOpts
+		if err := applyFees(t.Context(), c, &auth, feeOverrides{History: oracle}); err != nil {
+			t.Fatal(err)
+		}
+		if auth.GasFeeCap.Cmp(gwei(22)) != 0 || auth.GasTipCap.Cmp(gwei(2)) != 0 {
+			t.Fatalf("fees without fee history: %s, want the rpc strategy's", describeFees(&auth))
+		}
+	}
+	if n := node.count("eth_feeHistory"); n != 1 {
+		t.Fatalf("eth_feeHistory called %d times, want once", n)
+	}
+	if n := strings.Count(warned.String(), "pricing with the suggestion RPCs instead"); n != 1 {
+		t.Fatalf("warned %d times, want once: %q", n, warned.String())
+	}
+}
+
+func TestFeeHistoryMath(t *testing.T) {
+	for _, tt := range []struct {
+		base   int64
+		blocks uint64
+		want   int64
+	}{
+		{100, 0, 100},
+		{100, 1, 113}, // 12.5 rounded up
+		{8, 1, 9},
+		{1, 1, 2},
+		{0, 5, 0},
+		{1_000_000_000, 3, 1_423_828_125},
+	} {
+		if got := projectBaseFee(big.NewInt(tt.base), tt.blocks); got.Int64() != tt.want {
+			t.Errorf("projectBaseFee(%d, %d) = %s, want %d", tt.base, tt.blocks, got, tt.want)
+		}
+	}
+
+	tips := func(tips ...int64) *ethereum.FeeHistory {
+		h := &ethereum.FeeHistory{}
+		for _, tip := range tips {
+			h.Reward = append(h.Reward, []*big.Int{big.NewInt(tip)})
+			h.GasUsedRatio = append(h.GasUsedRatio, 0.5)
+		}
+		return h
+	}
+	if got := medianTip(tips(3, 1, 2)); got.Int64() != 2 {
+		t.Errorf("median of 3 1 2 = %s, want 2", got)
+	}
+	if got := medianTip(tips(4, 1, 3, 2)); got.Int64() != 3 {
+		t.Errorf("median of 4 1 3 2 = %s, want the upper middle 3", got)
+	}
+	if got := medianTip(&ethereum.FeeHistory{Reward: [][]*big.Int{{}, {}}}); got != nil {
+		t.Errorf("median of no tips = %s, want nil", got)
+	}
+
+	for _, tt := range []struct {
+		o    feeHistoryOptions
+		want string
+	}{
+		{feeHistoryOptions{strategy: "oracle"}, `--fee-strategy: want rpc or feehistory, got "oracle"`},
+		{feeHistoryOptions{strategy: "feehistory", blocks: 0, percentile: 50}, "--fee-blocks must be between 1 and 1024"},
+		{feeHistoryOptions{strategy: "feehistory", blocks: 1025, percentile: 50}, "--fee-blocks must be between 1 and 1024"},
+		{feeHistoryOptions{strategy: "feehistory", blocks: 20, percentile: 101}, "--fee-percentile must be between 0 and 100"},
+	} {
+		if _, err := tt.o.oracle(); err == nil || err.Error() != tt.want {
+			t.Errorf("%+v: %v, want %q", tt.o, err, tt.want)
+		}
+	}
+	if o, err := (feeHistoryOptions{strategy: "rpc"}).oracle(); o != nil || err != nil {
+		t.Errorf("rpc strategy = %v, %v; want no oracle", o, err)
+	}
+}
@@ -0,0 +1,97 @@
+package deployer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// argName returns the declared name of args[i], or argN when unnamed.
+func argName(args abi.Arguments, i int) string {
+	if i < len(args) && args[i].Name != "" {
+		return args[i].Name
+	}
+	return fmt.Sprintf("arg%d", i)
+}
+
+// formatArgs renders name=value pairs for decoded values.
+func formatArgs(args abi.Arguments, vals []interface{}) string {
+	parts := make([]string, len(vals))
+	for i, v := range vals {
+		parts[i] = fmt.Sprintf("%s=%v", argName(args, i), formatValue(v))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatValue prints byte slices and arrays as hex rather than numbers,
+// and addresses with their ENS names under --resolve-names.
+func formatValue(v interface{}) string {
+	switch x := v.(type) {
+	case common.Address:
+		return names.label(x)
+	case []byte:
+		return "0x" + hex.EncodeToString(x)
+	case fmt.Stringer:
+		return x.String()
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Array && rv.Type().Elem().Kind() == reflect.Uint8 {
+		b := make([]byte, rv.Len())
+		reflect.Copy(reflect.ValueOf(b), rv)
+		return "0x" + hex.EncodeToString(b)
+	}
+	return fmt.Sprint(v)
+}
+
+// jsonValue converts a decoded ABI value into something encoding/json
+// renders faithfully: integers as decimal strings, bytes as hex, tuples
+// as objects.
+func jsonValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case *big.Int:
+		return x.String()
+	case common.Address:
+		return x.Hex()
+	case common.Hash:
+		return x.Hex()
+	case []byte:
+		return "0x" + hex.EncodeToString(x)
+	case string, bool:
+		return x
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprint(v)
+	case reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return formatValue(v)
+		}
+		fallthrough
+	case reflect.Slice:
+		out := make([]interface{}, rv.Len())
+		for i := range out {
+			out[i] = jsonValue(rv.Index(i).Interface())
+		}
+		return out
+	case reflect.Struct:
+		out := make(map[string]interface{}, rv.NumField())
+		for i := 0; i < rv.NumField(); i++ {
+			f := rv.Type().Field(i)
+			name := f.Name
+			if tag := f.Tag.Get("json"); tag != "" {
+				name = tag // abi tuples carry the Solidity component name here
+			}
+			out[name] = jsonValue(rv.Field(i).Interface())
+		}
+		return out
+	}
+	return v
+}
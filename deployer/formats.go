@@ -0,0 +1,248 @@
+package deployer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// foundryArtifact is the subset of a Foundry (forge) artifact we read.
+type foundryArtifact struct {
+	ABI              json.RawMessage `json:"abi"`
+	Bytecode         codeObject      `json:"bytecode"`
+	DeployedBytecode codeObject      `json:"deployedBytecode"`
+	Metadata         json.RawMessage `json:"metadata"`
+	RawMetadata      string          `json:"rawMetadata"`
+	StorageLayout    *storageLayout  `json:"storageLayout"`
+}
+
+// codeObject is code as Foundry and solc's evm output nest it.
+type codeObject struct {
+	Object              string                 `json:"object"`
+	LinkReferences      linkReferences         `json:"linkReferences"`
+	ImmutableReferences map[string][]byteRange `json:"immutableReferences"`
+}
+
+// hardhatArtifact is a Hardhat artifact (_format hh-sol-artifact-1), which
+// keeps code as plain hex strings.
+type hardhatArtifact struct {
+	ContractName           string          `json:"contractName"`
+	SourceName             string          `json:"sourceName"`
+	ABI                    json.RawMessage `json:"abi"`
+	Bytecode               string          `json:"bytecode"`
+	DeployedBytecode       string          `json:"deployedBytecode"`
+	LinkReferences         linkReferences  `json:"linkReferences"`
+	DeployedLinkReferences linkReferences  `json:"deployedLinkReferences"`
+}
+
+// solcOutput is solc --standard-json output: contracts keyed by source
+// file, then contract name.
+type solcOutput struct {
+	Contracts map[string]map[string]struct {
+		ABI           json.RawMessage `json:"abi"`
+		Metadata      string          `json:"metadata"`
+		StorageLayout *storageLayout  `json:"storageLayout"`
+		EVM           struct {
+			Bytecode         codeObject `json:"bytecode"`
+			DeployedBytecode codeObject `json:"deployedBytecode"`
+		} `json:"evm"`
+	} `json:"contracts"`
+}
+
+// LoadArtifact reads compiler output in any supported format (Foundry,
+// Hardhat or solc standard-json), a bare ABI array, or human-readable
+// fragments (a JSON array of strings, or one per line), and normalizes it.
+// contract selects a contract from standard-json output, as Name or
+// source:Name; the single-contract formats ignore it.
+func LoadArtifact(path, contract string) (*Artifact, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		msg := fmt.Sprintf("artifact %s not found", path)
+		if near := nearbyArtifacts(path); len(near) > 0 {
+			msg += "; nearby artifacts:\n  " + strings.Join(near, "\n  ")
+		}
+		return nil, errors.New(msg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read artifact: %w", err)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) > 0 && trimmed[0] != '[' && trimmed[0] != '{' {
+		// Not JSON: human-readable fragments, one per line.
+		trimmed, err = parseFragments(strings.Split(string(trimmed), "\n"))
+		if err != nil {
+			return nil, fmt.Errorf("abi %s: %w", path, err)
+		}
+	}
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		// A JSON array of strings is an ethers-style human-readable ABI.
+		var fragments []string
+		if json.Unmarshal(trimmed, &fragments) == nil && len(fragments) > 0 {
+			if trimmed, err = parseFragments(fragments); err != nil {
+				return nil, fmt.Errorf("abi %s: %w", path, err)
+			}
+		}
+		a, err := newArtifact(name, trimmed, codeObject{}, codeObject{})
+		if err != nil {
+			return nil, fmt.Errorf("abi %s: %w", path, err)
+		}
+		a.Path = path
+		return a, nil
+	}
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &top); err != nil {
+		return nil, fmt.Errorf("unmarshal artifact %s: %w", path, err)
+	}
+	var a *Artifact
+	switch {
+	case top["contracts"] != nil:
+		a, err = fromSolc(raw, contract)
+	case top["_format"] != nil || isJSONString(top["bytecode"]):
+		a, err = fromHardhat(raw, name)
+	case top["abi"] != nil && (top["bytecode"] == nil || isJSONObject(top["bytecode"])):
+		a, err = fromFoundry(raw, name)
+	default:
+		keys := make([]string, 0, len(top))
+		for k := range top {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("artifact %s: unrecognized format (top-level keys: %s); want Foundry, Hardhat or solc standard-json output", path, strings.Join(keys, ", "))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("artifact %s: %w", path, err)
+	}
+	a.Path = path
+	return a, nil
+}
+
+func isJSONString(raw json.RawMessage) bool {
+	return len(raw) > 0 && raw[0] == '"'
+}
+
+func isJSONObject(raw json.RawMessage) bool {
+	return len(raw) > 0 && raw[0] == '{'
+}
+
+func fromFoundry(raw []byte, name string) (*Artifact, error) {
+	var art foundryArtifact
+	if err := json.Unmarshal(raw, &art); err != nil {
+		return nil, err
+	}
+	a, err := newArtifact(name, art.ABI, art.Bytecode, art.DeployedBytecode)
+	if err != nil {
+		return nil, err
+	}
+	a.StorageLayout = art.StorageLayout
+	// rawMetadata is the exact JSON the compiler hashed; metadata is the
+	// same parsed into an object (a string in older Foundry versions).
+	switch {
+	case art.RawMetadata != "":
+		a.Metadata = json.RawMessage(art.RawMetadata)
+	case isJSONObject(art.Metadata):
+		a.Metadata = art.Metadata
+	case isJSONString(art.Metadata):
+		var m string
+		if json.Unmarshal(art.Metadata, &m) == nil && m != "" {
+			a.Metadata = json.RawMessage(m)
+		}
+	}
+	return a, nil
+}
+
+func fromHardhat(raw []byte, name string) (*Artifact, error) {
+	var art hardhatArtifact
+	if err := json.Unmarshal(raw, &art); err != nil {
+		return nil, err
+	}
+	if art.ContractName != "" {
+		name = art.ContractName
+	}
+	return newArtifact(name, art.ABI,
+		codeObject{Object: art.Bytecode, LinkReferences: art.LinkReferences},
+		codeObject{Object: art.DeployedBytecode, LinkReferences: art.DeployedLinkReferences})
+}
+
+// fromSolc picks contract out of standard-json output. Without a name the
+// output must hold exactly one contract.
+func fromSolc(raw []byte, contract string) (*Artifact, error) {
+	var out solcOutput
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, err
+	}
+	wantSource, wantName, qualified := strings.Cut(contract, ":")
+	if !qualified {
+		wantSource, wantName = "", contract
+	}
+	var all, matches []string
+	for source, byName := range out.Contracts {
+		for name := range byName {
+			all = append(all, source+":"+name)
+			if (wantName == "" || name == wantName) && (wantSource == "" || source == wantSource) {
+				matches = append(matches, source+":"+name)
+			}
+		}
+	}
+	sort.Strings(all)
+	sort.Strings(matches)
+	switch {
+	case len(matches) == 0 && contract == "":
+		return nil, errors.New("standard-json output has no contracts")
+	case len(matches) == 0:
+		return nil, fmt.Errorf("no contract %q in standard-json output; available: %s", contract, strings.Join(all, ", "))
+	case len(matches) > 1:
+		return nil, fmt.Errorf("standard-json output has several matching contracts; pick one with --contract: %s", strings.Join(matches, ", "))
+	}
+	source, name, _ := strings.Cut(matches[0], ":")
+	c := out.Contracts[source][name]
+	a, err := newArtifact(name, c.ABI, c.EVM.Bytecode, c.EVM.DeployedBytecode)
+	if err != nil {
+		return nil, err
+	}
+	if c.Metadata != "" {
+		a.Metadata = json.RawMessage(c.Metadata)
+	}
+	a.StorageLayout = c.StorageLayout
+	return a, nil
+}
+
+// newArtifact decodes the normalized pieces of any format.
+func newArtifact(name string, abiJSON json.RawMessage, creation, runtime codeObject) (*Artifact, error) {
+	if len(abiJSON) == 0 {
+		return nil, errors.New("no abi")
+	}
+	parsedABI, err := abi.JSON(strings.NewReader(string(abiJSON)))
+	if err != nil {
+		return nil, fmt.Errorf("parse abi: %w", err)
+	}
+	bytecode, err := decodeCode(creation.Object, creation.LinkReferences)
+	if err != nil {
+		return nil, fmt.Errorf("decode bytecode: %w", err)
+	}
+	a := &Artifact{
+		Name:      name,
+		ABI:       parsedABI,
+		RawABI:    abiJSON,
+		Bytecode:  bytecode,
+		Libraries: creation.LinkReferences.libraries(),
+	}
+	if code, err := decodeCode(runtime.Object, runtime.LinkReferences); err == nil && len(code) > 0 {
+		a.DeployedBytecode = code
+	}
+	for _, refs := range runtime.ImmutableReferences {
+		a.Immutables = append(a.Immutables, refs...)
+	}
+	for _, lib := range runtime.LinkReferences.libraries() {
+		a.RuntimeLinks = append(a.RuntimeLinks, lib.Offsets...)
+	}
+	return a, nil
+}
@@ -0,0 +1,98 @@
+package deployer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestLoadArtifact(t *testing.T) {
+	creation, runtime := common.FromHex(greeterCreation), common.FromHex(greeterRuntime)
+	for _, tt := range []struct {
+		format, path, contract string
+		name                   string
+		metadata               bool
+	}{
+		{"foundry", "testdata/artifacts/foundry.json", "", "foundry", true},
+		{"hardhat", "testdata/artifacts/hardhat.json", "", "Greeter", false},
+		{"solc", "testdata/artifacts/solc.json", "Greeter", "Greeter", true},
+		{"solc qualified", "testdata/artifacts/solc.json", "contracts/Greeter.sol:Greeter", "Greeter", true},
+	} {
+		t.Run(tt.format, func(t *testing.T) {
+			a, err := LoadArtifact(tt.path, tt.contract)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a.Name != tt.name || a.Path != tt.path {
+				t.Errorf("name, path = %q, %q; want %q, %q", a.Name, a.Path, tt.name, tt.path)
+			}
+			if !bytes.Equal(a.Bytecode, creation) {
+				t.Errorf("bytecode = %x, want the fixture's creation code", a.Bytecode)
+			}
+			if !bytes.Equal(a.DeployedBytecode, runtime) {
+				t.Errorf("deployed bytecode = %x, want the fixture's runtime code", a.DeployedBytecode)
+			}
+			if _, ok := a.ABI.Methods["setGreeting"]; !ok || len(a.ABI.Constructor.Inputs) != 1 {
+				t.Errorf("abi = %v, want greeter's", a.ABI.Methods)
+			}
+			if _, ok := a.ABI.Events["GreetingChanged"]; !ok {
+				t.Error("abi lost the GreetingChanged event")
+			}
+			if (a.Metadata != nil) != tt.metadata {
+				t.Errorf("metadata = %s, want some: %v", a.Metadata, tt.metadata)
+			}
+		})
+	}
+}
+
+func TestLoadArtifactHumanReadable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Greeter.abi")
+	fragments := "function greet() view returns (string)\nfunction setGreeting(string greeting)\nevent GreetingChanged(address indexed by, string greeting)\n"
+	if err := os.WriteFile(path, []byte(fragments), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := LoadArtifact(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := greeter(t)
+	for name, m := range want.ABI.Methods {
+		if got := a.ABI.Methods[name]; got.Sig != m.Sig || !bytes.Equal(got.ID, m.ID) {
+			t.Errorf("%s = %s (%x), want %s (%x)", name, got.Sig, got.ID, m.Sig, m.ID)
+		}
+	}
+	if a.ABI.Events["GreetingChanged"].ID != want.ABI.Events["GreetingChanged"].ID {
+		t.Error("GreetingChanged topic differs from the JSON ABI's")
+	}
+	if len(a.Bytecode) != 0 {
+		t.Errorf("bytecode = %x, want none", a.Bytecode)
+	}
+}
+
+func TestLoadArtifactErrors(t *testing.T) {
+	dir := t.TempDir()
+	unknown := filepath.Join(dir, "unknown.json")
+	if err := os.WriteFile(unknown, []byte(`{"contractName": "X", "code": "0x00"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name, path, contract, want string
+	}{
+		{"malformed bytecode", "testdata/artifacts/malformed.json", "", "decode bytecode"},
+		{"unrecognized format", unknown, "", "unrecognized format (top-level keys: code, contractName)"},
+		{"missing file", filepath.Join(dir, "out", "Nope.json"), "", "not found"},
+		{"solc without a name", "testdata/artifacts/solc.json", "", "several matching contracts"},
+		{"solc unknown name", "testdata/artifacts/solc.json", "Nope", `no contract "Nope"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadArtifact(tt.path, tt.contract)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("LoadArtifact(%s) = %v, want an error containing %q", tt.path, err, tt.want)
+			}
+		})
+	}
+}
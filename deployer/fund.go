@@ -0,0 +1,384 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// loadRecipients reads --accounts: a JSON array of addresses, or of
+// objects with an "address" field such as `account new --json` prints.
+func loadRecipients(path string) ([]common.Address, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read accounts: %w", err)
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, fmt.Errorf("parse accounts %s: want a JSON array: %w", path, err)
+	}
+	var out []common.Address
+	for i, e := range entries {
+		var s string
+		if json.Unmarshal(e, &s) != nil {
+			var obj struct {
+				Address string `json:"address"`
+			}
+			if err := json.Unmarshal(e, &obj); err != nil || obj.Address == "" {
+				return nil, fmt.Errorf("accounts %s entry %d: want an address or an object with one", path, i+1)
+			}
+			s = obj.Address
+		}
+		a, err := parseAddress(s)
+		if err != nil {
+			return nil, fmt.Errorf("accounts %s entry %d: %w", path, i+1, err)
+		}
+		out = append(out, a)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("accounts %s lists no addresses", path)
+	}
+	return out, nil
+}
+
+// deriveRecipients derives the first count accounts of mnemonic on the
+// standard path.
+func deriveRecipients(mnemonic string, count int) ([]common.Address, error) {
+	out := make([]common.Address, count)
+	for i := range out {
+		path, err := derivationPath("", i)
+		if err != nil {
+			return nil, err
+		}
+		key, err := deriveKey(mnemonic, "", path)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = crypto.PubkeyToAddress(key.PublicKey)
+	}
+	return out, nil
+}
+
+// fundTransfer is one recipient's funding in flight.
+type fundTransfer struct {
+	r  *FundingReport
+	tx *types.Transaction
+}
+
+// sendFunding sends one transfer per recipient without waiting, so their
+// nonces follow each other and all are in flight at once, then waits for
+// them together. A recipient whose transfer fails to send or to land is
+// marked in its report; the others carry on.
+func (s *session) sendFunding(ctx context.Context, reports []FundingReport, call string, contractABI *abi.ABI, send func(r *FundingReport) (*types.Transaction, error)) {
+	var pending []fundTransfer
+	for i := range reports {
+		r := &reports[i]
+		tx, err := send(r)
+		if err != nil {
+			r.Error = err.Error()
+			s.ui.Warnf("%s: %v\n", r.Address.Hex(), err)
+			continue
+		}
+		h := tx.Hash()
+		r.TxHash = &h
+		s.ui.Printf("  %s: tx %s\n", r.Address.Hex(), h.Hex())
+		pending = append(pending, fundTransfer{r, tx})
+	}
+	if len(pending) == 0 {
+		return
+	}
+	s.ui.Printf("Waiting for %d transfers\n", len(pending))
+
+	// Each wait holds mu except while it polls, as `run --parallel`
+	// steps do, so the session's bookkeeping is never shared.
+	var mu sync.Mutex
+	s.sendLock = &mu
+	defer func() { s.sendLock = nil }()
+	var wg sync.WaitGroup
+	for _, p := range pending {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mu.Lock()
+			defer mu.Unlock()
+			rcpt, err := s.waitReceipt(ctx, p.tx, contractABI)
+			if err != nil {
+				p.r.Error = err.Error()
+				s.ui.Warnf("%s: %v\n", p.r.Address.Hex(), err)
+				return
+			}
+			s.ui.report.Transactions = append(s.ui.report.Transactions, *newTxReport(call, rcpt, printEvents(s.ui, rcpt, contractABI)))
+		}()
+	}
+	wg.Wait()
+}
+
+// runFund implements `fund --amount <amount> (--accounts <file> | --count
+// <n> --mnemonic <phrase>) [--token <address>]`: seed test accounts with
+// ether, through anvil_setBalance where the node has it, or with an
+// ERC-20 token.
+func runFund(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("fund", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	accountsFile := fs.String("accounts", "", "JSON `file` listing the addresses to fund")
+	count := fs.Int("count", 0, "fund the first `n` accounts of --mnemonic instead")
+	mnemonic := fs.String("mnemonic", "", "with --count, the BIP-39 `phrase` to derive the accounts from (m/44'/60'/0'/0/i)")
+	amountFlag := fs.String("amount", "", "what each account gets, e.g. 10ether, or whole tokens with --token")
+	tokenFlag := fs.String("token", "", "send this ERC-20 token `address` instead of ether")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	usage := errors.New("usage: fund --amount <amount> (--accounts <file> | --count <n> --mnemonic <phrase>) [--token <address>]")
+	if fs.NArg() != 0 || *amountFlag == "" || (*accountsFile == "") == (*count == 0) {
+		return usage
+	}
+	var recipients []common.Address
+	var err error
+	if *accountsFile != "" {
+		recipients, err = loadRecipients(*accountsFile)
+	} else if *mnemonic == "" || *count < 0 {
+		return usage
+	} else {
+		recipients, err = deriveRecipients(*mnemonic, *count)
+	}
+	if err != nil {
+		return err
+	}
+	reports := make([]FundingReport, len(recipients))
+	for i, a := range recipients {
+		reports[i].Address = a
+	}
+
+	var failed int
+	if *tokenFlag != "" {
+		failed, err = fundToken(ctx, &o, *tokenFlag, *amountFlag, reports)
+	} else {
+		failed, err = fundEther(ctx, &o, *amountFlag, reports)
+	}
+	if err != nil {
+		return err
+	}
+	ui.report.Funding = reports
+	printFunding(reports)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d accounts not funded", failed, len(reports))
+	}
+	return nil
+}
+
+// fundEther sets each balance to its current one plus amount with
+// anvil_setBalance, or, on a node without it, transfers amount from the
+// loaded key.
+func fundEther(ctx context.Context, o *options, amountFlag string, reports []FundingReport) (int, error) {
+	amount, err := parseValue(amountFlag)
+	if err != nil || amount == nil || amount.Sign() <= 0 {
+		return 0, fmt.Errorf("--amount: invalid amount %q", amountFlag)
+	}
+	client, _, err := connect(ctx, o)
+	if err != nil {
+		return 0, err
+	}
+	before := make([]*big.Int, len(reports))
+	for i := range reports {
+		if before[i], err = client.BalanceAt(ctx, reports[i].Address, nil); err != nil {
+			client.Close()
+			return 0, fmt.Errorf("balance of %s: %w", reports[i].Address.Hex(), err)
+		}
+		reports[i].Before = before[i].String()
+	}
+
+	err = anvilCall(ctx, client, nil, "anvil_setBalance", reports[0].Address, (*hexutil.Big)(new(big.Int).Add(before[0], amount)))
+	var um unsupportedMethod
+	if errors.As(err, &um) {
+		client.Close()
+		return fundEtherTransfers(ctx, o, amount, reports)
+	}
+	defer client.Close()
+	ui.Printf("Funding %d accounts with %s ETH each via anvil_setBalance\n", len(reports), formatEther(amount))
+	for i := range reports {
+		r := &reports[i]
+		r.Via = "anvil_setBalance"
+		if i > 0 {
+			err = anvilCall(ctx, client, nil, "anvil_setBalance", r.Address, (*hexutil.Big)(new(big.Int).Add(before[i], amount)))
+		}
+		if err != nil {
+			r.Error = err.Error()
+			ui.Warnf("%s: %v\n", r.Address.Hex(), err)
+		}
+	}
+	return finishFunding(reports, func(a common.Address) (*big.Int, error) {
+		return client.BalanceAt(ctx, a, nil)
+	}), nil
+}
+
+// fundEtherTransfers sends amount to each recipient from the loaded key.
+func fundEtherTransfers(ctx context.Context, o *options, amount *big.Int, reports []FundingReport) (int, error) {
+	s, err := openSession(ctx, o)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+	total := new(big.Int).Mul(amount, big.NewInt(int64(len(reports))))
+	ui.Printf("The node has no anvil_setBalance; transferring %s ETH to each of %d accounts (%s ETH in all)\n", formatEther(amount), len(reports), formatEther(total))
+	txo := txOptions{value: amount.String(), nonce: -1}
+	s.sendFunding(ctx, reports, "transfer", nil, func(r *FundingReport) (*types.Transaction, error) {
+		r.Via = "transfer"
+		to := r.Address
+		opts, err := s.opts(ctx, txo)
+		if err != nil {
+			return nil, err
+		}
+		code, err := s.client.CodeAt(ctx, to, nil)
+		if err != nil {
+			return nil, fmt.Errorf("get code at %s: %w", to.Hex(), err)
+		}
+		if len(code) == 0 {
+			opts.GasLimit = params.TxGas
+			s.pendingL1Fee = s.estimateL1Fee(ctx, opts, ethereum.CallMsg{To: &to})
+		} else if err := s.setGasLimit(ctx, opts, ethereum.CallMsg{To: &to}, nil); err != nil {
+			return nil, err
+		}
+		bound := bind.NewBoundContract(to, abi.ABI{}, s.client, s.client, s.client)
+		tx, err := s.submit(ctx, opts, txSummary{to: &to, call: fmt.Sprintf("transfer %s ETH", formatEther(amount))}, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return bound.RawTransact(opts, nil)
+		})
+		return tx, explainError(err, nil)
+	})
+	return finishFunding(reports, func(a common.Address) (*big.Int, error) {
+		return s.client.BalanceAt(ctx, a, nil)
+	}), nil
+}
+
+// fundToken sends amount of the token at tokenFlag to each recipient.
+func fundToken(ctx context.Context, o *options, tokenFlag, amountFlag string, reports []FundingReport) (int, error) {
+	address, err := parseAddress(tokenFlag)
+	if err != nil {
+		return 0, fmt.Errorf("--token: %w", err)
+	}
+	s, err := openSession(ctx, o)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+	t, err := loadToken(ctx, s.client, address)
+	if err != nil {
+		return 0, err
+	}
+	ui.report.Token = t.report()
+	amount, err := t.parseAmount(amountFlag)
+	if err != nil {
+		return 0, fmt.Errorf("--amount: %w", err)
+	}
+	for i := range reports {
+		bal, err := t.amount(ctx, "balanceOf", reports[i].Address)
+		if err != nil {
+			return 0, err
+		}
+		reports[i].Before = bal.String()
+	}
+	held, err := t.amount(ctx, "balanceOf", s.from)
+	if err != nil {
+		return 0, err
+	}
+	total := new(big.Int).Mul(amount, big.NewInt(int64(len(reports))))
+	ui.Printf("Transferring %s to each of %d accounts (%s in all, %s held)\n", t.format(amount), len(reports), t.format(total), t.format(held))
+	if held.Cmp(total) < 0 {
+		ui.Warnf("warning: %s holds %s, not enough for every account\n", s.from.Hex(), t.format(held))
+	}
+
+	m := parsedERC20.Methods["transfer"]
+	s.sendFunding(ctx, reports, m.Sig, &parsedERC20, func(r *FundingReport) (*types.Transaction, error) {
+		r.Via = "transfer"
+		args := []interface{}{r.Address, amount}
+		data, err := parsedERC20.Pack(m.Name, args...)
+		if err != nil {
+			return nil, fmt.Errorf("encode %s: %w", m.Sig, err)
+		}
+		// As in `erc20 transfer`, tokens that return false instead of
+		// reverting are caught before sending. The simulation runs on
+		// the confirmed state, so it cannot see the transfers still in
+		// flight.
+		ret, err := s.client.CallContract(ctx, ethereum.CallMsg{From: s.from, To: &address, Data: data}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", m.Sig, explainError(err, &parsedERC20))
+		}
+		if len(ret) > 0 && new(big.Int).SetBytes(ret).Sign() == 0 {
+			return nil, fmt.Errorf("%s returned false: %s refused it without reverting", m.Sig, address.Hex())
+		}
+		return s.transact(ctx, t.bound, &parsedERC20, &m, args, txOptions{nonce: -1})
+	})
+	return finishFunding(reports, func(a common.Address) (*big.Int, error) {
+		return t.amount(ctx, "balanceOf", a)
+	}), nil
+}
+
+// finishFunding reads every balance after funding and returns how many
+// accounts failed.
+func finishFunding(reports []FundingReport, balance func(common.Address) (*big.Int, error)) int {
+	failed := 0
+	for i := range reports {
+		r := &reports[i]
+		if bal, err := balance(r.Address); err == nil {
+			r.After = bal.String()
+		} else if r.Error == "" {
+			r.Error = fmt.Sprintf("balance after: %v", err)
+		}
+		if r.Error != "" {
+			failed++
+		}
+	}
+	return failed
+}
+
+// printFunding prints one row per account: its balance before and after,
+// and how it was funded or why it was not.
+func printFunding(reports []FundingReport) {
+	format := formatEther
+	if t := ui.report.Token; t != nil {
+		format = func(v *big.Int) string { return formatUnits(v, t.Decimals) }
+	}
+	amount := func(s string) string {
+		v, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return "?"
+		}
+		return format(v)
+	}
+	rows := [][]string{{"account", "before", "after", "result"}}
+	for _, r := range reports {
+		result := "funded via " + r.Via
+		if r.Error != "" {
+			result = "failed: " + r.Error
+		}
+		rows = append(rows, []string{r.Address.Hex(), amount(r.Before), amount(r.After), result})
+	}
+	width := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row[:len(row)-1] {
+			width[i] = max(width[i], len(cell))
+		}
+	}
+	for _, row := range rows {
+		line := ""
+		for i, cell := range row {
+			line += fmt.Sprintf("  %-*s", width[i], cell)
+		}
+		ui.Println(strings.TrimRight(line, " "))
+	}
+}
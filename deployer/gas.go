@@ -0,0 +1,78 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+)
+
+// gasPolicy pads gas estimates and caps the resulting limit.
+type gasPolicy struct {
+	multiplier float64
+	max        uint64
+}
+
+func (p *gasPolicy) register(fs *flag.FlagSet) {
+	fs.Float64Var(&p.multiplier, "gas-multiplier", 1.2, "safety margin applied to gas estimates")
+	fs.Uint64Var(&p.max, "max-gas", 0, "abort before signing if a transaction's gas limit exceeds this (0 disables)")
+}
+
+func (p gasPolicy) check() error {
+	if p.multiplier < 1 {
+		return errors.New("--gas-multiplier must be at least 1")
+	}
+	return nil
+}
+
+// pad applies the multiplier to an estimate, rounding up.
+func (p gasPolicy) pad(estimate uint64) uint64 {
+	return uint64(math.Ceil(float64(estimate) * p.multiplier))
+}
+
+// setGasLimit fills opts.GasLimit from a padded estimate of msg unless it
+// was pinned with --gas-limit, prints the limit and its worst-case cost,
+// and enforces --max-gas, with the intrinsic part of the gas broken out.
+// opts must already carry its fees and value. An access list chosen by
+// accessList is set on opts too.
+func (s *session) setGasLimit(ctx context.Context, opts *bind.TransactOpts, msg ethereum.CallMsg, contractABI *abi.ABI) error {
+	limit := opts.GasLimit
+	msg.From, msg.Value = s.from, opts.Value
+	if limit == 0 {
+		estimate, err := s.client.EstimateGas(ctx, msg)
+		if err != nil {
+			return fmt.Errorf("estimate gas: %w", explainError(err, contractABI))
+		}
+		if list, gas := s.accessList(ctx, msg, estimate); list != nil {
+			opts.AccessList, estimate = list, gas
+		}
+		limit = s.gas.pad(estimate)
+		s.ui.Printf("Gas: estimate %d, limit %d (x%g)\n", estimate, limit, s.gas.multiplier)
+		printIntrinsic(s.ui, msgIntrinsicGas(msg, opts.AccessList), estimate)
+	} else {
+		if list := s.accessLists.list; list != nil {
+			printAccessList(list)
+			opts.AccessList = list
+		}
+		s.ui.Printf("Gas: limit %d (--gas-limit)\n", limit)
+		printIntrinsic(s.ui, msgIntrinsicGas(msg, opts.AccessList), 0)
+	}
+	if price := maxGasPrice(opts); price != nil {
+		cost := new(big.Int).Mul(new(big.Int).SetUint64(limit), price)
+		s.ui.Printf("  max cost: %s ETH\n", formatEther(cost))
+	}
+	if s.gas.max > 0 && limit > s.gas.max {
+		return fmt.Errorf("gas limit %d exceeds --max-gas %d", limit, s.gas.max)
+	}
+	opts.GasLimit = limit
+	if s.pendingL1Fee = s.estimateL1Fee(ctx, opts, msg); s.pendingL1Fee != nil {
+		s.ui.Printf("  L1 data fee: %s ETH\n", formatEther(s.pendingL1Fee))
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// GasReport is what the transactions a run mined cost, in the order they
+// were mined. TotalValue is the ether they sent and TotalL1Fee the OP
+// Stack L1 data fees they paid, neither of which is part of TotalFee;
+// BalanceDelta is the sender's balance change over the run, so it
+// includes all three. The USD figures are set when an ETH price is known
+// (see ethUSD).
+type GasReport struct {
+	Transactions  []GasEntry `json:"transactions"`
+	TotalGas      uint64     `json:"totalGas"`
+	TotalFee      string     `json:"totalFee"`
+	TotalValue    string     `json:"totalValue,omitempty"`
+	TotalL1Fee    string     `json:"totalL1Fee,omitempty"`
+	TotalFeeUSD   string     `json:"totalFeeUsd,omitempty"`
+	EthPriceUSD   string     `json:"ethPriceUsd,omitempty"`
+	BalanceBefore string     `json:"balanceBefore,omitempty"`
+	BalanceAfter  string     `json:"balanceAfter,omitempty"`
+	BalanceDelta  string     `json:"balanceDelta,omitempty"`
+}
+
+// GasEntry is one mined transaction. Fee is GasUsed times
+// EffectiveGasPrice; the part above BaseFee went to the block's producer
+// as a tip. BaseFee is absent on pre-London chains, Value when the
+// transaction sent no ether, L1Fee off the OP Stack.
+type GasEntry struct {
+	Label             string `json:"label"`
+	Hash              string `json:"hash"`
+	Block             uint64 `json:"block"`
+	Reverted          bool   `json:"reverted,omitempty"`
+	GasUsed           uint64 `json:"gasUsed"`
+	EffectiveGasPrice string `json:"effectiveGasPrice"`
+	BaseFee           string `json:"baseFee,omitempty"`
+	Fee               string `json:"fee"`
+	CumulativeFee     string `json:"cumulativeFee"`
+	Value             string `json:"value,omitempty"`
+	L1Fee             string `json:"l1Fee,omitempty"`
+	FeeUSD            string `json:"feeUsd,omitempty"`
+}
+
+// gasLog collects a session's mined transactions for its gas report.
+// Labels are kept by nonce so a fee-bumped replacement is still reported
+// under the name of the transaction it replaced.
+type gasLog struct {
+	out     string
+	labels  map[uint64]string
+	entries []GasEntry
+	gas     uint64
+	total   *big.Int
+	value   *big.Int
+	l1Fee   *big.Int
+	before  *big.Int
+}
+
+func newGasLog(out string) *gasLog {
+	return &gasLog{out: out, labels: make(map[uint64]string), total: new(big.Int), value: new(big.Int), l1Fee: new(big.Int)}
+}
+
+// gasLabel shortens a confirmation summary's call to a table label:
+// "Box constructor(1)" becomes "deploy Box" and "set(2)" becomes "set".
+func gasLabel(call string) string {
+	if i := strings.Index(call, " constructor("); i >= 0 {
+		name, create2 := strings.CutPrefix(call[:i], "CREATE2 ")
+		if create2 {
+			return "deploy " + name + " via CREATE2"
+		}
+		return "deploy " + name
+	}
+	if i := strings.IndexByte(call, '('); i > 0 && !strings.Contains(call[:i], " ") {
+		return call[:i]
+	}
+	return call
+}
+
+// noteBalance reads the sender's balance before the session's first send.
+func (s *session) noteBalance(ctx context.Context) {
+	if s.gasLog.before != nil {
+		return
+	}
+	if bal, err := s.client.BalanceAt(ctx, s.from, nil); err == nil {
+		s.gasLog.before = bal
+	}
+}
+
+// recordGas adds the mined rcpt of tx, or of its replacement, to the log.
+func (s *session) recordGas(ctx context.Context, tx *types.Transaction, rcpt *types.Receipt) {
+	l := s.gasLog
+	label, ok := l.labels[tx.Nonce()]
+	if !ok {
+		label = "tx"
+	}
+	price := rcpt.EffectiveGasPrice
+	if price == nil {
+		price = tx.GasPrice()
+	}
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(rcpt.GasUsed), price)
+	l.gas += rcpt.GasUsed
+	l.total.Add(l.total, fee)
+	e := GasEntry{
+		Label:             label,
+		Hash:              rcpt.TxHash.Hex(),
+		Reverted:          rcpt.Status != types.ReceiptStatusSuccessful,
+		GasUsed:           rcpt.GasUsed,
+		EffectiveGasPrice: price.String(),
+		Fee:               fee.String(),
+		CumulativeFee:     l.total.String(),
+	}
+	if v := tx.Value(); v.Sign() > 0 {
+		e.Value = v.String()
+		l.value.Add(l.value, v)
+	}
+	if s.opStack {
+		if fee, err := s.client.receiptL1Fee(ctx, rcpt.TxHash); err == nil {
+			e.L1Fee = fee.String()
+			l.l1Fee.Add(l.l1Fee, fee)
+		} else {
+			s.ui.Verbosef("L1 data fee of %s: %v\n", rcpt.TxHash.Hex(), err)
+		}
+	}
+	if rcpt.BlockNumber != nil {
+		e.Block = rcpt.BlockNumber.Uint64()
+		if head, err := s.client.HeaderByNumber(ctx, rcpt.BlockNumber); err == nil && head.BaseFee != nil {
+			e.BaseFee = head.BaseFee.String()
+		}
+	}
+	l.entries = append(l.entries, e)
+}
+
+// gasReport builds the report of everything mined so far, reading the
+// sender's balance now for the delta.
+func (s *session) gasReport(ctx context.Context) *GasReport {
+	l := s.gasLog
+	r := &GasReport{Transactions: l.entries, TotalGas: l.gas, TotalFee: l.total.String()}
+	if l.value.Sign() > 0 {
+		r.TotalValue = l.value.String()
+	}
+	if l.l1Fee.Sign() > 0 {
+		r.TotalL1Fee = l.l1Fee.String()
+	}
+	if price := s.ethUSD(ctx); price != nil {
+		r.EthPriceUSD, r.TotalFeeUSD = price.FloatString(2), formatUSD(l.total, price)
+		for i := range r.Transactions {
+			fee, _ := new(big.Int).SetString(r.Transactions[i].Fee, 10)
+			r.Transactions[i].FeeUSD = formatUSD(fee, price)
+		}
+	}
+	if l.before == nil {
+		return r
+	}
+	after, err := s.client.BalanceAt(ctx, s.from, nil)
+	if err != nil {
+		return r
+	}
+	r.BalanceBefore, r.BalanceAfter = l.before.String(), after.String()
+	r.BalanceDelta = new(big.Int).Sub(after, l.before).String()
+	return r
+}
+
+// finishGasReport prints the session's gas report, puts it in the JSON
+// report and writes it to --gas-report-out. Runs that mined nothing have
+// no report.
+func (s *session) finishGasReport() {
+	if s.gasLog == nil || len(s.gasLog.entries) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	r := s.gasReport(ctx)
+	s.ui.report.Gas = r
+	printGasReport(r)
+	if s.gasLog.out != "" {
+		if err := writeJSON(s.gasLog.out, r); err != nil {
+			s.ui.Warnf("warning: write gas report: %v\n", err)
+		} else {
+			s.ui.Printf("Gas report written to %s\n", s.gasLog.out)
+		}
+	}
+}
+
+// printGasReport prints r as a table, gas prices in gwei and fees in ETH
+// and, with a price, USD.
+func printGasReport(r *GasReport) {
+	gwei := func(wei string) string {
+		v, ok := new(big.Int).SetString(wei, 10)
+		if !ok {
+			return "-"
+		}
+		return formatUnits(v, 9)
+	}
+	eth := func(wei string) string {
+		v, ok := new(big.Int).SetString(wei, 10)
+		if !ok {
+			return "-"
+		}
+		return formatEther(v)
+	}
+	usd, value, l1 := r.EthPriceUSD != "", r.TotalValue != "", r.TotalL1Fee != ""
+	rows := [][]string{{"transaction", "gas used", "price (gwei)", "base (gwei)", "fee (ETH)", "total (ETH)"}}
+	if usd {
+		rows[0] = append(rows[0], "fee (USD)")
+	}
+	if l1 {
+		rows[0] = append(rows[0], "L1 fee (ETH)")
+	}
+	if value {
+		rows[0] = append(rows[0], "value (ETH)")
+	}
+	for _, e := range r.Transactions {
+		label := e.Label
+		if e.Reverted {
+			label += " (reverted)"
+		}
+		row := []string{label, fmt.Sprint(e.GasUsed), gwei(e.EffectiveGasPrice), gwei(e.BaseFee), eth(e.Fee), eth(e.CumulativeFee)}
+		if usd {
+			row = append(row, "$"+e.FeeUSD)
+		}
+		if l1 {
+			row = append(row, eth(e.L1Fee))
+		}
+		if value {
+			row = append(row, eth(e.Value))
+		}
+		rows = append(rows, row)
+	}
+	total := []string{"total", fmt.Sprint(r.TotalGas), "", "", eth(r.TotalFee), ""}
+	if usd {
+		total = append(total, "$"+r.TotalFeeUSD)
+	}
+	if l1 {
+		total = append(total, eth(r.TotalL1Fee))
+	}
+	if value {
+		total = append(total, eth(r.TotalValue))
+	}
+	rows = append(rows, total)
+	width := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			width[i] = max(width[i], len(cell))
+		}
+	}
+	ui.Println("Gas report:")
+	for _, row := range rows {
+		line := fmt.Sprintf("  %-*s", width[0], row[0])
+		for i, cell := range row[1:] {
+			line += fmt.Sprintf("  %*s", width[i+1], cell)
+		}
+		ui.Println(strings.TrimRight(line, " "))
+	}
+	if r.BalanceDelta != "" {
+		ui.Printf("  balance: %s -> %s ETH (%s)\n", eth(r.BalanceBefore), eth(r.BalanceAfter), signedEther(r.BalanceDelta))
+	}
+	if usd {
+		ui.Printf("  at $%s per ETH\n", r.EthPriceUSD)
+	}
+}
+
+// signedEther formats a wei delta in ETH with an explicit sign.
+func signedEther(wei string) string {
+	v, _ := new(big.Int).SetString(wei, 10)
+	if v.Sign() < 0 {
+		return "-" + formatEther(new(big.Int).Neg(v))
+	}
+	return "+" + formatEther(v)
+}
@@ -0,0 +1,81 @@
+package deployer
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// defaultDerivationPath is the first account of the standard Ethereum
+// BIP-44 tree, which is also what Anvil prints at startup.
+const defaultDerivationPath = "m/44'/60'/0'/0/0"
+
+// deriveKey derives the private key at path from a BIP-39 mnemonic using
+// BIP-32 child key derivation. The mnemonic checksum is not validated.
+func deriveKey(mnemonic, passphrase string, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 {
+		return nil, fmt.Errorf("mnemonic has %d words, expected at least 12", len(words))
+	}
+	seed, err := pbkdf2.Key(sha512.New, strings.Join(words, " "), []byte("mnemonic"+passphrase), 2048, 64)
+	if err != nil {
+		return nil, fmt.Errorf("mnemonic seed: %w", err)
+	}
+
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	key, chainCode := sum[:32], sum[32:]
+
+	n := crypto.S256().Params().N
+	for _, index := range path {
+		var data []byte
+		if index >= 0x80000000 {
+			data = append([]byte{0}, key...)
+		} else {
+			priv, err := crypto.ToECDSA(key)
+			if err != nil {
+				return nil, err
+			}
+			data = crypto.CompressPubkey(&priv.PublicKey)
+		}
+		data = binary.BigEndian.AppendUint32(data, index)
+
+		mac := hmac.New(sha512.New, chainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+
+		il := new(big.Int).SetBytes(sum[:32])
+		if il.Cmp(n) >= 0 {
+			return nil, fmt.Errorf("invalid child key at index %d", index)
+		}
+		child := il.Add(il, new(big.Int).SetBytes(key))
+		child.Mod(child, n)
+		if child.Sign() == 0 {
+			return nil, fmt.Errorf("invalid child key at index %d", index)
+		}
+		key, chainCode = child.FillBytes(make([]byte, 32)), sum[32:]
+	}
+	return crypto.ToECDSA(key)
+}
+
+// derivationPath returns path, or the default path with its last
+// component replaced by index when index is non-negative.
+func derivationPath(path string, index int) (accounts.DerivationPath, error) {
+	if index >= 0 {
+		path = fmt.Sprintf("m/44'/60'/0'/0/%d", index)
+	}
+	dp, err := accounts.ParseDerivationPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("derivation path %q: %w", path, err)
+	}
+	return dp, nil
+}
@@ -0,0 +1,102 @@
+package deployer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// anvilMnemonic is the mnemonic Anvil and Hardhat derive their dev
+// accounts from.
+const anvilMnemonic = "test test test test test test test test test test test junk"
+
+// anvilAccounts are the accounts Anvil's banner lists for anvilMnemonic,
+// by index.
+var anvilAccounts = map[int]struct{ address, key string }{
+	0: {"0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266", testKey},
+	1: {"0x70997970C51812dc3A010C7d01b50e0d17dc79C8", "0x59c6995e998f97a5a0044966f0945389dc9e86dae88c7a8412f4603b6b78690d"},
+	2: {"0x3C44CdDdB6a900fa2b585dd299e03d12FA4293BC", "0x5de4111afa1a4b94908f83103eb1f1706367c2e68ca870fc3fb9a804cdab365a"},
+	3: {"0x90F79bf6EB2c4f870365E785982E1f101E93b906", "0x7c852118294e51e653712a81e05800f419141751be58f605c371e15141b007a6"},
+	9: {"0xa0Ee7A142d267C1f36714E4a8F75612F20a79720", "0x2a871d0798f97d79848a013d4936a73bf4cc922c825d33c1cf7073dff6d409c6"},
+}
+
+func TestDeriveKey(t *testing.T) {
+	for index, want := range anvilAccounts {
+		path, err := derivationPath(defaultDerivationPath, index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := deriveKey(anvilMnemonic, "", path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if got := crypto.PubkeyToAddress(key.PublicKey); got != common.HexToAddress(want.address) {
+			t.Errorf("%s: address %s, want %s", path, got.Hex(), want.address)
+		}
+		if got := "0x" + common.Bytes2Hex(crypto.FromECDSA(key)); got != want.key {
+			t.Errorf("%s: key %s, want %s", path, got, want.key)
+		}
+	}
+
+	// The mnemonic is normalised to single spaces before stretching.
+	path, _ := derivationPath(defaultDerivationPath, -1)
+	key, err := deriveKey("  "+strings.ReplaceAll(anvilMnemonic, " ", "\n\t")+"\n", "", path)
+	if err != nil || crypto.PubkeyToAddress(key.PublicKey) != testAddr {
+		t.Errorf("mnemonic with odd whitespace: %v, want %s", err, testAddr.Hex())
+	}
+	// A BIP-39 passphrase gives a different wallet.
+	key, err = deriveKey(anvilMnemonic, "TREZOR", path)
+	if err != nil || crypto.PubkeyToAddress(key.PublicKey) == testAddr {
+		t.Errorf("passphrase ignored: %v", err)
+	}
+	if _, err := deriveKey("test test test junk", "", path); err == nil || !strings.Contains(err.Error(), "4 words") {
+		t.Errorf("short mnemonic: %v", err)
+	}
+}
+
+func TestDerivationPath(t *testing.T) {
+	for _, tt := range []struct {
+		path  string
+		index int
+		want  string
+	}{
+		{defaultDerivationPath, -1, "m/44'/60'/0'/0/0"},
+		{defaultDerivationPath, 3, "m/44'/60'/0'/0/3"},
+		{"m/44'/60'/1'/0/7", -1, "m/44'/60'/1'/0/7"},
+		{"m/44'/60'/1'/0/7", 2, "m/44'/60'/0'/0/2"},
+	} {
+		dp, err := derivationPath(tt.path, tt.index)
+		if err != nil || dp.String() != tt.want {
+			t.Errorf("derivationPath(%q, %d) = %v, %v; want %s", tt.path, tt.index, dp, err, tt.want)
+		}
+	}
+	if _, err := derivationPath("m/44'/sixty", -1); err == nil || !strings.Contains(err.Error(), `derivation path "m/44'/sixty"`) {
+		t.Errorf("bad path: %v", err)
+	}
+}
+
+func TestMnemonicSigner(t *testing.T) {
+	isolate(t)
+	t.Setenv("MNEMONIC", anvilMnemonic)
+	for _, tt := range []struct {
+		opts KeyOptions
+		want string
+	}{
+		{KeyOptions{DerivationPath: defaultDerivationPath, AccountIndex: -1}, anvilAccounts[0].address},
+		{KeyOptions{DerivationPath: defaultDerivationPath, AccountIndex: 3}, anvilAccounts[3].address},
+		{KeyOptions{DerivationPath: "m/44'/60'/0'/0/9", AccountIndex: -1}, anvilAccounts[9].address},
+	} {
+		s, err := LoadSigner(tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Address != common.HexToAddress(tt.want) {
+			t.Errorf("%+v: signer %s, want %s", tt.opts, s.Address.Hex(), tt.want)
+		}
+		if !strings.HasPrefix(s.Source, "MNEMONIC m/44'/60'/0'/0/") || !s.RawEnv {
+			t.Errorf("%+v: source %q, raw env %v; want MNEMONIC and its path from the environment", tt.opts, s.Source, s.RawEnv)
+		}
+	}
+}
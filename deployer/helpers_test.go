@@ -0,0 +1,377 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/node"
+)
+
+// testKey is the first of the Anvil and Hardhat dev accounts, funded on
+// every simulated chain.
+const testKey = "0xac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80"
+
+var testAddr = common.HexToAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266")
+
+// Greeter is the fixture contract, HelloWorld cut down to what hand-written
+// bytecode can do: the greeting is kept in one storage word, so it must
+// be 1 to 32 bytes long, and anything else reverts, in the constructor
+// as in setGreeting, with Error(greeterReason).
+//
+//	constructor(string greeting)
+//	function greet() view returns (string)
+//	function setGreeting(string greeting)
+//	event GreetingChanged(address indexed by, string greeting)
+const (
+	greeterABI = `[
+		{"type":"constructor","stateMutability":"nonpayable","inputs":[{"name":"greeting","type":"string"}]},
+		{"type":"function","name":"greet","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+		{"type":"function","name":"setGreeting","stateMutability":"nonpayable","inputs":[{"name":"greeting","type":"string"}],"outputs":[]},
+		{"type":"event","name":"GreetingChanged","anonymous":false,"inputs":[{"name":"by","type":"address","indexed":true},{"name":"greeting","type":"string","indexed":false}]}
+	]`
+	greeterRuntime  = "60003560e01c8063cfae321714610020578063a41368621461003757600080fd5b602060005260005460205260015460405260606000f35b60043560040180358015816020101761008e57600055602001356001556020600052600054602052600154604052337fea07f7ca8b8b2cfaab1214b6e1459ad859cf1ff2d60a948a1f9c4644970c895060606000a2005b6308c379a060e01b6000526020600452601b6024527f6772656574696e67206d75737420626520312d3332206279746573000000000060445260646000fd"
+	greeterCreation = "61013b380361013b6000396020518015816020101761002f576000556040516001556100cd8061006e6000396000f35b6308c379a060e01b6000526020600452601b6024527f6772656574696e67206d75737420626520312d3332206279746573000000000060445260646000fd" + greeterRuntime
+	greeterReason   = "greeting must be 1-32 bytes"
+)
+
+func TestMain(m *testing.M) {
+	ui.out, ui.errw, ui.warnw = io.Discard, io.Discard, io.Discard
+	ui.setFormat(false)
+	os.Exit(m.Run())
+}
+
+// greeter returns a fresh copy of the fixture artifact.
+func greeter(t *testing.T) *Artifact {
+	t.Helper()
+	a, err := newArtifact("Greeter", []byte(greeterABI), codeObject{Object: greeterCreation}, codeObject{Object: greeterRuntime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// simChain is a simulated chain served over an IPC socket, so the code
+// under test dials it the way it dials a real node.
+type simChain struct {
+	*simulated.Backend
+	rpc string
+}
+
+// newSimChain starts a chain (ID 1337) with testAddr and any extra
+// accounts funded with 100 ether each. Blocks are only sealed by Commit,
+// or by autoCommit.
+func newSimChain(t *testing.T, funded ...common.Address) *simChain {
+	t.Helper()
+	alloc := types.GenesisAlloc{}
+	for _, a := range funded {
+		alloc[a] = types.Account{Balance: ether(100)}
+	}
+	return newSimChainAlloc(t, alloc)
+}
+
+// newSimChainAlloc starts a chain with the genesis accounts in alloc,
+// and testAddr funded as newSimChain funds it.
+func newSimChainAlloc(t *testing.T, alloc types.GenesisAlloc) *simChain {
+	t.Helper()
+	ipc := filepath.Join(t.TempDir(), "sim.ipc")
+	if _, ok := alloc[testAddr]; !ok {
+		alloc[testAddr] = types.Account{Balance: ether(100)}
+	}
+	b := simulated.NewBackend(alloc, func(n *node.Config, _ *ethconfig.Config) { n.IPCPath = ipc })
+	t.Cleanup(func() { b.Close() })
+	return &simChain{Backend: b, rpc: ipc}
+}
+
+// autoCommit seals a block every few milliseconds until the test ends,
+// the way a dev node mines.
+func (c *simChain) autoCommit(t *testing.T) {
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(5 * time.Millisecond):
+				c.Commit()
+			}
+		}
+	}()
+	t.Cleanup(func() { close(stop); <-done })
+}
+
+// isolate clears the environment's key and endpoint settings and moves
+// to an empty working directory, with no profile or journal, until the
+// test ends.
+func isolate(t *testing.T) {
+	t.Helper()
+	for _, k := range []string{"PRIVATE_KEY", "MNEMONIC", "KEYSTORE_PATH", "RPC_URL", "RPC_URLS", "RPC_BEARER_TOKEN"} {
+		t.Setenv(k, "")
+	}
+	t.Chdir(t.TempDir())
+}
+
+// dial connects a Client to the chain as testKey unless cfg names
+// another key, isolated from the environment, polling for receipts
+// every 10ms.
+func (c *simChain) dial(t *testing.T, cfg Config) *Client {
+	t.Helper()
+	isolate(t)
+	cfg.RPC = []string{c.rpc}
+	if cfg.PrivateKey == "" && cfg.Mnemonic == "" && cfg.Keystore == "" {
+		cfg.PrivateKey = testKey
+	}
+	if cfg.Output == nil {
+		cfg.Output = io.Discard
+	}
+	client, err := Dial(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	client.s.pollInterval = 10 * time.Millisecond
+	t.Cleanup(client.Close)
+	return client
+}
+
+// results runs a command's entry point with args and returns what it
+// printed to stdout.
+func results(t *testing.T, run func(context.Context, []string) error, args ...string) (string, error) {
+	t.Helper()
+	var buf bytes.Buffer
+	out := ui.out
+	ui.out = &buf
+	defer func() { ui.out = out }()
+	err := run(t.Context(), args)
+	return buf.String(), err
+}
+
+func ether(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1e18))
+}
+
+// signTransfer signs a transfer of 1 wei from testKey to itself at
+// nonce, paying up to 100 gwei per gas.
+func signTransfer(nonce uint64) (*types.Transaction, error) {
+	key, err := crypto.HexToECDSA(testKey[2:])
+	if err != nil {
+		return nil, err
+	}
+	return types.SignNewTx(key, types.LatestSignerForChainID(big.NewInt(1337)), &types.DynamicFeeTx{
+		ChainID: big.NewInt(1337), Nonce: nonce, To: &testAddr, Value: big.NewInt(1), Gas: 21000,
+		GasTipCap: big.NewInt(1e9), GasFeeCap: big.NewInt(100e9),
+	})
+}
+
+// sendTransfer sends signTransfer(nonce) straight to the node.
+func sendTransfer(t *testing.T, chain *simChain, nonce uint64) *types.Transaction {
+	t.Helper()
+	tx, err := signTransfer(nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.Client().SendTransaction(t.Context(), tx); err != nil {
+		t.Fatalf("send nonce %d: %v", nonce, err)
+	}
+	return tx
+}
+
+// deployRun is a `deploy` of the greeter to the chain as testKey,
+// recording into dir, its results printed to out.
+type deployRun struct {
+	chain    *simChain
+	artifact string
+	dir      string
+	out      *syncBuffer
+}
+
+func newDeployRun(t *testing.T) *deployRun {
+	t.Helper()
+	artifact, err := filepath.Abs("testdata/artifacts/hardhat.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := newSimChain(t)
+	chain.autoCommit(t)
+	isolate(t)
+	t.Setenv("PRIVATE_KEY", testKey)
+	var out syncBuffer
+	stdout := ui.out
+	ui.out = &out
+	t.Cleanup(func() { ui.out = stdout })
+	return &deployRun{chain: chain, artifact: artifact, dir: filepath.Join(t.TempDir(), "deployments"), out: &out}
+}
+
+// args are the deploy's arguments, with flags added.
+func (r *deployRun) args(flags ...string) []string {
+	args := append([]string{"--rpc", r.chain.rpc, "--deployments-dir", r.dir, "--poll-interval", "10ms", "--yes"}, flags...)
+	return append(args, r.artifact, "hello")
+}
+
+func (r *deployRun) run(t *testing.T, flags ...string) error {
+	return runDeploy(t.Context(), r.args(flags...))
+}
+
+// sent is how many transactions the deployer has sent.
+func (r *deployRun) sent(t *testing.T) uint64 {
+	t.Helper()
+	n, err := r.chain.Client().NonceAt(t.Context(), testAddr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// fakeNode is a JSON-RPC endpoint that answers each method with its
+// handler; eth_chainId defaults to 1337. Handler errors become JSON-RPC
+// errors. After failNext, requests get an HTTP error status instead. A
+// node from replayNodes answers from a capture instead of handlers.
+type fakeNode struct {
+	url      string
+	mu       sync.Mutex
+	handlers map[string]func(params []json.RawMessage) (interface{}, error)
+	calls    map[string]int
+	fail     int
+	status   int
+	replay   map[string][]rpcExchange
+}
+
+func newFakeNode(t *testing.T, handlers map[string]func(params []json.RawMessage) (interface{}, error)) *fakeNode {
+	t.Helper()
+	n := &fakeNode{handlers: handlers, calls: map[string]int{}}
+	if _, ok := n.handlers["eth_chainId"]; !ok {
+		n.handlers["eth_chainId"] = func([]json.RawMessage) (interface{}, error) { return hexutil.Uint64(1337), nil }
+	}
+	srv := httptest.NewServer(http.HandlerFunc(n.serve))
+	t.Cleanup(srv.Close)
+	n.url = srv.URL
+	return n
+}
+
+func (n *fakeNode) serve(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     json.RawMessage   `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n.mu.Lock()
+	n.calls[req.Method]++
+	failing := n.fail > 0
+	if failing {
+		n.fail--
+	}
+	handler := n.handlers[req.Method]
+	x, replayed := n.next(req.Method)
+	n.mu.Unlock()
+	if failing {
+		http.Error(w, http.StatusText(n.status), n.status)
+		return
+	}
+	if replayed {
+		n.answer(w, req.ID, x)
+		return
+	}
+
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	if handler == nil {
+		resp["error"] = map[string]interface{}{"code": -32601, "message": "the method " + req.Method + " does not exist"}
+	} else if result, err := handler(req.Params); err != nil {
+		resp["error"] = map[string]interface{}{"code": -32000, "message": err.Error()}
+	} else {
+		resp["result"] = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// replayNodes serves the --rpc-capture file at path, one fakeNode per
+// endpoint in it, in the order the endpoints first appear.
+func replayNodes(t *testing.T, path string) []*fakeNode {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nodes []*fakeNode
+	byEndpoint := map[string]*fakeNode{}
+	for _, line := range bytes.Split(bytes.TrimSpace(raw), []byte("\n")) {
+		var x rpcExchange
+		if err := json.Unmarshal(line, &x); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		n := byEndpoint[x.Endpoint]
+		if n == nil {
+			n = newFakeNode(t, map[string]func([]json.RawMessage) (interface{}, error){})
+			n.replay = map[string][]rpcExchange{}
+			byEndpoint[x.Endpoint] = n
+			nodes = append(nodes, n)
+		}
+		n.replay[x.Method] = append(n.replay[x.Method], x)
+	}
+	return nodes
+}
+
+// next takes the captured exchange to answer method with, repeating the
+// last one once they run out. Caller holds n.mu.
+func (n *fakeNode) next(method string) (rpcExchange, bool) {
+	xs := n.replay[method]
+	if len(xs) == 0 {
+		return rpcExchange{}, false
+	}
+	if len(xs) > 1 {
+		n.replay[method] = xs[1:]
+	}
+	return xs[0], true
+}
+
+// answer replays x as the answer to the request with id: its HTTP error
+// status, a dropped connection for a transport error, or its response.
+func (n *fakeNode) answer(w http.ResponseWriter, id json.RawMessage, x rpcExchange) {
+	switch {
+	case x.Status != 0:
+		http.Error(w, http.StatusText(x.Status), x.Status)
+	case x.Error != "" || x.Response == nil:
+		if conn, _, err := http.NewResponseController(w).Hijack(); err == nil {
+			conn.Close()
+		}
+	default:
+		var resp map[string]json.RawMessage
+		json.Unmarshal(x.Response, &resp)
+		resp["id"] = id
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// failNext answers the next count requests with the HTTP status.
+func (n *fakeNode) failNext(count, status int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.fail, n.status = count, status
+}
+
+// count is how many requests for method the node has had.
+func (n *fakeNode) count(method string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.calls[method]
+}
@@ -0,0 +1,561 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+// fragmentList is the repeatable --sig flag. Unlike urlList it is not
+// split on commas, which fragments are full of.
+type fragmentList []string
+
+func (l *fragmentList) String() string { return strings.Join(*l, "; ") }
+
+func (l *fragmentList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// abiEntry and abiParam are one JSON ABI entry and parameter, as the
+// compilers write them. A function returning nothing keeps its empty
+// outputs: go-ethereum cannot unpack the result of one without them.
+type abiEntry struct {
+	Type            string     `json:"type"`
+	Name            string     `json:"name,omitempty"`
+	Inputs          []abiParam `json:"inputs"`
+	Outputs         []abiParam `json:"outputs,omitzero"`
+	StateMutability string     `json:"stateMutability,omitempty"`
+	Anonymous       bool       `json:"anonymous,omitempty"`
+}
+
+type abiParam struct {
+	Name       string     `json:"name"`
+	Type       string     `json:"type"`
+	Components []abiParam `json:"components,omitempty"`
+	Indexed    bool       `json:"indexed,omitempty"`
+}
+
+func (p abiParam) marshaling() abi.ArgumentMarshaling {
+	m := abi.ArgumentMarshaling{Name: p.Name, Type: p.Type, Indexed: p.Indexed}
+	for _, c := range p.Components {
+		m.Components = append(m.Components, c.marshaling())
+	}
+	return m
+}
+
+// humanToken is a word or punctuation mark of a fragment, at byte pos.
+type humanToken struct {
+	text string
+	pos  int
+}
+
+// fragmentParser parses one ethers-style human-readable fragment, such as
+// "function balanceOf(address owner) view returns (uint256)".
+type fragmentParser struct {
+	src  string
+	toks []humanToken
+	i    int
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func newFragmentParser(src string) (*fragmentParser, error) {
+	p := &fragmentParser{src: src}
+	for i := 0; i < len(src); {
+		switch c := src[i]; {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case strings.IndexByte("(),[]", c) >= 0:
+			p.toks = append(p.toks, humanToken{src[i : i+1], i})
+			i++
+		case isWordByte(c):
+			start := i
+			for i < len(src) && isWordByte(src[i]) {
+				i++
+			}
+			p.toks = append(p.toks, humanToken{src[start:i], start})
+		default:
+			return nil, fmt.Errorf("unexpected %q at column %d", c, i+1)
+		}
+	}
+	return p, nil
+}
+
+func (p *fragmentParser) peek() humanToken {
+	if p.i < len(p.toks) {
+		return p.toks[p.i]
+	}
+	return humanToken{"", len(p.src)}
+}
+
+func (p *fragmentParser) next() humanToken {
+	t := p.peek()
+	if p.i < len(p.toks) {
+		p.i++
+	}
+	return t
+}
+
+// errorf reports a problem at t, quoting the token so a long fragment
+// points at what is wrong.
+func (p *fragmentParser) errorf(t humanToken, format string, args ...interface{}) error {
+	near := "end of fragment"
+	if t.text != "" {
+		near = fmt.Sprintf("%q", t.text)
+	}
+	return fmt.Errorf("%s at column %d (%s)", fmt.Sprintf(format, args...), t.pos+1, near)
+}
+
+func (p *fragmentParser) expect(text string) error {
+	if t := p.next(); t.text != text {
+		return p.errorf(t, "expected %q", text)
+	}
+	return nil
+}
+
+// isIdentifier reports whether s is a name: word bytes, not starting
+// with a digit.
+func isIdentifier(s string) bool {
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isWordByte(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *fragmentParser) name() (string, error) {
+	t := p.next()
+	if !isIdentifier(t.text) {
+		return "", p.errorf(t, "expected a name")
+	}
+	return t.text, nil
+}
+
+// params parses a parenthesized parameter list; indexed is accepted only
+// for event parameters.
+func (p *fragmentParser) params(event bool) ([]abiParam, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	out := []abiParam{}
+	if p.peek().text == ")" {
+		p.next()
+		return out, nil
+	}
+	for {
+		param, err := p.param(event)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, param)
+		switch t := p.next(); t.text {
+		case ",":
+		case ")":
+			return out, nil
+		default:
+			return nil, p.errorf(t, "expected \",\" or \")\"")
+		}
+	}
+}
+
+// param parses a type, its modifiers and an optional name.
+func (p *fragmentParser) param(event bool) (abiParam, error) {
+	start := p.peek()
+	var param abiParam
+	if t := p.peek(); t.text == "(" || t.text == "tuple" {
+		if t.text == "tuple" {
+			p.next()
+		}
+		comps, err := p.params(false)
+		if err != nil {
+			return param, err
+		}
+		param.Type, param.Components = "tuple", comps
+	} else {
+		t := p.next()
+		if !isIdentifier(t.text) {
+			return param, p.errorf(t, "expected a type")
+		}
+		param.Type = canonicalType(t.text)
+		if !validElementary(param.Type) {
+			return param, p.errorf(t, "bad type %s", t.text)
+		}
+	}
+	for p.peek().text == "[" {
+		p.next()
+		param.Type += "["
+		if t := p.peek(); t.text != "]" {
+			p.next()
+			if t.text == "" || t.text[0] < '0' || t.text[0] > '9' {
+				return param, p.errorf(t, "expected an array length")
+			}
+			param.Type += t.text
+		}
+		if err := p.expect("]"); err != nil {
+			return param, err
+		}
+		param.Type += "]"
+	}
+	if _, err := abi.NewType(param.Type, "", param.marshaling().Components); err != nil {
+		return param, p.errorf(start, "bad type %s: %v", param.Type, err)
+	}
+	seen := map[string]bool{}
+	for {
+		t := p.peek()
+		if seen[t.text] {
+			return param, p.errorf(t, "%s given twice", t.text)
+		}
+		seen[t.text] = true
+		switch t.text {
+		case "indexed":
+			if !event {
+				return param, p.errorf(t, "indexed is only allowed on event parameters")
+			}
+			param.Indexed = true
+		case "memory", "calldata", "storage":
+		case "payable":
+			if param.Type != "address" {
+				return param, p.errorf(t, "payable is only allowed on address")
+			}
+		default:
+			if isIdentifier(t.text) {
+				p.next()
+				param.Name = t.text
+			}
+			return param, nil
+		}
+		p.next()
+	}
+}
+
+// validElementary rejects sized types go-ethereum would accept but
+// Solidity has not got, such as uint257 or bytes33.
+func validElementary(typ string) bool {
+	for _, prefix := range []string{"uint", "int", "bytes"} {
+		rest, ok := strings.CutPrefix(typ, prefix)
+		if !ok || rest == "" {
+			continue
+		}
+		n, err := strconv.Atoi(rest)
+		if err != nil {
+			// Not a sized type; abi.NewType has the last word.
+			return true
+		}
+		if prefix == "bytes" {
+			return n >= 1 && n <= 32
+		}
+		return n >= 8 && n <= 256 && n%8 == 0
+	}
+	return true
+}
+
+// mutability parses modifiers after a parameter list into the entry's
+// state mutability, stopping at anything else.
+func (p *fragmentParser) mutability(e *abiEntry, allowed ...string) {
+	for {
+		t := p.peek()
+		switch {
+		case t.text == "external" || t.text == "public":
+		case slices.Contains(allowed, t.text):
+			e.StateMutability = t.text
+		default:
+			return
+		}
+		p.next()
+	}
+}
+
+// fragmentKinds are the keywords a fragment can start with.
+var fragmentKinds = []string{"function", "constructor", "event", "error", "fallback", "receive"}
+
+// entry parses the whole fragment.
+func (p *fragmentParser) entry() (abiEntry, error) {
+	var e abiEntry
+	var err error
+	t := p.peek()
+	switch {
+	case slices.Contains(fragmentKinds, t.text):
+		p.next()
+		e.Type = t.text
+	case isIdentifier(t.text) && p.i+1 < len(p.toks) && p.toks[p.i+1].text == "(":
+		// ethers also takes a function without its keyword.
+		e.Type = "function"
+	default:
+		return e, p.errorf(t, "expected function, event, error, constructor, fallback or receive")
+	}
+	switch e.Type {
+	case "function", "constructor":
+		if e.Type == "function" {
+			if e.Name, err = p.name(); err != nil {
+				return e, err
+			}
+		}
+		if e.Inputs, err = p.params(false); err != nil {
+			return e, err
+		}
+		e.StateMutability = "nonpayable"
+		if e.Type == "constructor" {
+			p.mutability(&e, "payable", "nonpayable")
+			break
+		}
+		p.mutability(&e, "view", "pure", "payable", "nonpayable")
+		e.Outputs = []abiParam{}
+		if p.peek().text == "returns" {
+			p.next()
+			if e.Outputs, err = p.params(false); err != nil {
+				return e, err
+			}
+		}
+	case "event", "error":
+		if e.Name, err = p.name(); err != nil {
+			return e, err
+		}
+		if e.Inputs, err = p.params(e.Type == "event"); err != nil {
+			return e, err
+		}
+		if e.Type == "event" && p.peek().text == "anonymous" {
+			p.next()
+			e.Anonymous = true
+		}
+	case "fallback", "receive":
+		if err := p.expect("("); err != nil {
+			return e, err
+		}
+		if err := p.expect(")"); err != nil {
+			return e, err
+		}
+		e.StateMutability = "nonpayable"
+		p.mutability(&e, "payable", "nonpayable")
+		if e.Type == "receive" && e.StateMutability != "payable" {
+			return e, errors.New("receive must be payable")
+		}
+	}
+	if t := p.peek(); t.text != "" {
+		return e, p.errorf(t, "expected the end of the fragment")
+	}
+	return e, nil
+}
+
+// parseFragments turns human-readable fragments into a JSON ABI. Blank
+// entries and // or # comments are skipped.
+func parseFragments(fragments []string) (json.RawMessage, error) {
+	entries := []abiEntry{}
+	for i, f := range fragments {
+		f, _, _ = strings.Cut(f, "//")
+		f, _, _ = strings.Cut(f, "#")
+		if f = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(f), ";")); f == "" {
+			continue
+		}
+		p, err := newFragmentParser(f)
+		if err == nil {
+			var e abiEntry
+			if e, err = p.entry(); err == nil {
+				entries = append(entries, e)
+				continue
+			}
+		}
+		return nil, fmt.Errorf("fragment %d %q: %w", i+1, f, err)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("no fragments")
+	}
+	return json.Marshal(entries)
+}
+
+// fragmentArtifact is an Artifact with only the ABI the fragments declare.
+func fragmentArtifact(name string, fragments []string) (*Artifact, error) {
+	raw, err := parseFragments(fragments)
+	if err != nil {
+		return nil, err
+	}
+	return newArtifact(name, raw, codeObject{}, codeObject{})
+}
+
+// humanType spells t with its tuple components' names.
+func humanType(t abi.Type) string {
+	switch t.T {
+	case abi.TupleTy:
+		parts := make([]string, len(t.TupleElems))
+		for i, elem := range t.TupleElems {
+			parts[i] = humanType(*elem)
+			if name := t.TupleRawNames[i]; name != "" {
+				parts[i] += " " + name
+			}
+		}
+		return "tuple(" + strings.Join(parts, ", ") + ")"
+	case abi.SliceTy:
+		return humanType(*t.Elem) + "[]"
+	case abi.ArrayTy:
+		return fmt.Sprintf("%s[%d]", humanType(*t.Elem), t.Size)
+	}
+	return t.String()
+}
+
+func humanParams(args abi.Arguments) string {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = humanType(a.Type)
+		if a.Indexed {
+			parts[i] += " indexed"
+		}
+		if a.Name != "" {
+			parts[i] += " " + a.Name
+		}
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+// unnamed undoes go-ethereum naming the unnamed parameters of events and
+// errors arg0, arg1, ...
+func unnamed(args abi.Arguments) abi.Arguments {
+	args = slices.Clone(args)
+	for i := range args {
+		if args[i].Name == fmt.Sprintf("arg%d", i) {
+			args[i].Name = ""
+		}
+	}
+	return args
+}
+
+func humanMethod(kind string, m abi.Method) string {
+	s := kind + humanParams(m.Inputs)
+	if kind == "fallback" || kind == "receive" {
+		s += " external"
+	}
+	mutability := m.StateMutability
+	if mutability == "" {
+		// ABIs from before Solidity 0.4.16 have constant and payable.
+		switch {
+		case m.Constant:
+			mutability = "view"
+		case m.Payable:
+			mutability = "payable"
+		}
+	}
+	if mutability != "" && mutability != "nonpayable" {
+		s += " " + mutability
+	}
+	if kind != "constructor" && len(m.Outputs) > 0 {
+		s += " returns " + humanParams(m.Outputs)
+	}
+	return s
+}
+
+// humanFragments is a in human-readable form: the constructor, then
+// functions, events and errors by name, then fallback and receive.
+func humanFragments(a *abi.ABI) []string {
+	var out []string
+	if len(a.Constructor.Inputs) > 0 || a.Constructor.StateMutability == "payable" {
+		out = append(out, humanMethod("constructor", a.Constructor))
+	}
+	for _, name := range sortedKeys(a.Methods) {
+		m := a.Methods[name]
+		out = append(out, humanMethod("function "+m.RawName, m))
+	}
+	for _, name := range sortedKeys(a.Events) {
+		e := a.Events[name]
+		s := "event " + e.RawName + humanParams(unnamed(e.Inputs))
+		if e.Anonymous {
+			s += " anonymous"
+		}
+		out = append(out, s)
+	}
+	for _, name := range sortedKeys(a.Errors) {
+		e := a.Errors[name]
+		out = append(out, "error "+name+humanParams(unnamed(e.Inputs)))
+	}
+	if a.HasFallback() {
+		out = append(out, humanMethod("fallback", a.Fallback))
+	}
+	if a.HasReceive() {
+		out = append(out, humanMethod("receive", a.Receive))
+	}
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sameABI reports the first entry of want that got lacks: a function,
+// event or error with the same selector or topic, or the same
+// constructor, fallback and receive.
+func sameABI(want, got *abi.ABI) error {
+	ids := map[string]bool{}
+	for _, m := range got.Methods {
+		ids[string(m.ID)] = true
+	}
+	for _, e := range got.Events {
+		ids[e.ID.Hex()+fmt.Sprint(e.Anonymous)] = true
+	}
+	for _, e := range got.Errors {
+		ids[e.ID.Hex()] = true
+	}
+	for _, m := range want.Methods {
+		if !ids[string(m.ID)] {
+			return fmt.Errorf("function %s does not round-trip", m.Sig)
+		}
+	}
+	for _, e := range want.Events {
+		if !ids[e.ID.Hex()+fmt.Sprint(e.Anonymous)] {
+			return fmt.Errorf("event %s does not round-trip", e.Sig)
+		}
+	}
+	for _, e := range want.Errors {
+		if !ids[e.ID.Hex()] {
+			return fmt.Errorf("error %s does not round-trip", e.Sig)
+		}
+	}
+	if want.Constructor.Sig != got.Constructor.Sig || want.HasFallback() != got.HasFallback() || want.HasReceive() != got.HasReceive() {
+		return errors.New("constructor, fallback or receive does not round-trip")
+	}
+	return nil
+}
+
+// runABIToHuman implements `abi to-human <artifact>`: the artifact's ABI
+// as human-readable fragments, one per line. The fragments are parsed
+// back and checked to give every selector and topic the JSON does.
+func runABIToHuman(ctx context.Context, args []string) error {
+	fs, err := abiFlags("to-human", args, 1, nil)
+	if err != nil {
+		return err
+	}
+	a, err := loadABI(fs.Arg(0), "")
+	if err != nil {
+		return err
+	}
+	fragments := humanFragments(&a.ABI)
+	if len(fragments) > 0 {
+		back, err := fragmentArtifact(a.Name, fragments)
+		if err == nil {
+			err = sameABI(&a.ABI, &back.ABI)
+		}
+		if err != nil {
+			return fmt.Errorf("convert %s: %w", fs.Arg(0), err)
+		}
+	}
+	ui.report.ABI = &ABIReport{Fragments: fragments}
+	for _, f := range fragments {
+		ui.Resultln(f)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package deployer
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// fragmentABI parses fragments into a go-ethereum ABI.
+func fragmentABI(t *testing.T, fragments ...string) abi.ABI {
+	t.Helper()
+	raw, err := parseFragments(fragments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := abi.JSON(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("parsed ABI %s: %v", raw, err)
+	}
+	return a
+}
+
+// TestParseFragmentsKnownSelectors parses the fragments methodFromSignature
+// is tested with and checks the ABI gives the same selectors and topics.
+func TestParseFragmentsKnownSelectors(t *testing.T) {
+	for _, tt := range knownSelectors {
+		a := fragmentABI(t, tt.fragment)
+		var sig, got string
+		switch {
+		case len(a.Methods) == 1:
+			for _, m := range a.Methods {
+				sig, got = m.Sig, hexutil.Encode(m.ID)
+			}
+		case len(a.Events) == 1:
+			for _, e := range a.Events {
+				sig, got = e.Sig, e.ID.Hex()
+			}
+		case len(a.Errors) == 1:
+			for _, e := range a.Errors {
+				sig, got = e.Sig, hexutil.Encode(e.ID[:4])
+			}
+		default:
+			t.Fatalf("%q parsed to %d entries, want 1", tt.fragment, len(a.Methods)+len(a.Events)+len(a.Errors))
+		}
+		if sig != tt.canonical || got != tt.selector {
+			t.Errorf("%q = %s %s, want %s %s", tt.fragment, sig, got, tt.canonical, tt.selector)
+		}
+	}
+}
+
+// TestParseFragmentsEncoding packs the Solidity ABI specification's
+// examples with an ABI parsed from fragments.
+func TestParseFragmentsEncoding(t *testing.T) {
+	a := fragmentABI(t,
+		"function baz(uint32 x, bool y) public pure returns (bool r)",
+		"function sam(bytes memory, bool, uint[] memory) public pure",
+		"function f(uint, uint32[], bytes10, bytes)",
+	)
+	var b10 [10]byte
+	copy(b10[:], "1234567890")
+	for _, tt := range []struct {
+		method string
+		args   []interface{}
+		want   string
+	}{
+		{"baz", []interface{}{uint32(69), true}, bazCalldata},
+		{"sam", []interface{}{[]byte("dave"), true, []*big.Int{big.NewInt(1), big.NewInt(2), big.NewInt(3)}}, samCalldata},
+		{"f", []interface{}{big.NewInt(0x123), []uint32{0x456, 0x789}, b10, []byte("Hello, world!")}, fCalldata},
+	} {
+		data, err := a.Pack(tt.method, tt.args...)
+		if err != nil {
+			t.Errorf("pack %s: %v", tt.method, err)
+		} else if got := hexutil.Encode(data); got != tt.want {
+			t.Errorf("pack %s =\n%s\nwant\n%s", tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestParseFragmentsEntries(t *testing.T) {
+	raw, err := parseFragments([]string{
+		"// ERC-20, cut down",
+		"constructor(string name_, uint8 decimals_) payable",
+		"",
+		"function transfer(address to, uint256 amount) external returns (bool); # no view",
+		"function version() pure returns (string)",
+		"transferFrom(address payable from, address to, uint value)",
+		"event Transfer(address indexed from, address indexed to, uint256 value)",
+		"event Log(bytes32) anonymous",
+		"error Unauthorized(address caller)",
+		"function swap(tuple(address token, uint128 amount)[2] legs) payable",
+		"fallback() external",
+		"receive() external payable",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []abiEntry
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		s := e.Type + " " + e.Name + " " + e.StateMutability
+		for _, p := range e.Inputs {
+			s += " " + p.Type + ":" + p.Name
+			if p.Indexed {
+				s += ":indexed"
+			}
+			for _, c := range p.Components {
+				s += " " + c.Type + ":" + c.Name
+			}
+		}
+		if e.Anonymous {
+			s += " anonymous"
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		"constructor  payable string:name_ uint8:decimals_",
+		"function transfer nonpayable address:to uint256:amount",
+		"function version pure",
+		"function transferFrom nonpayable address:from address:to uint256:value",
+		"event Transfer  address:from:indexed address:to:indexed uint256:value",
+		"event Log  bytes32: anonymous",
+		"error Unauthorized  address:caller",
+		"function swap payable tuple[2]:legs address:token uint128:amount",
+		"fallback  nonpayable",
+		"receive  payable",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("entries:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestParseFragmentsErrors(t *testing.T) {
+	for _, tt := range []struct {
+		fragment, want string
+	}{
+		{"function", "expected a name at column 9 (end of fragment)"},
+		{"function (uint)", `expected a name at column 10 ("(")`},
+		{"function f(uint", `expected "," or ")" at column 16 (end of fragment)`},
+		{"function f(addr)", `bad type addr: unsupported arg type: addr at column 12 ("addr")`},
+		{"function f(uint7)", "bad type uint7"},
+		{"function f(bytes33)", "bad type bytes33"},
+		{"function f(uint[x])", `expected an array length at column 17 ("x")`},
+		{"function f(uint indexed)", "indexed is only allowed on event parameters at column 17"},
+		{"event E(address indexed indexed a)", `indexed given twice at column 25 ("indexed")`},
+		{"function f(uint payable)", "payable is only allowed on address"},
+		{"function f() view returns", `expected "(" at column 26 (end of fragment)`},
+		{"function f() garbage", `expected the end of the fragment at column 14 ("garbage")`},
+		{"struct S { uint a; }", "unexpected '{' at column 10"},
+		{"modifier onlyOwner()", "expected function, event, error, constructor, fallback or receive at column 1"},
+		{"receive()", "receive must be payable"},
+	} {
+		_, err := parseFragments([]string{tt.fragment})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseFragments(%q) = %v, want %q", tt.fragment, err, tt.want)
+		}
+	}
+	if _, err := parseFragments([]string{"# nothing", ""}); err == nil || err.Error() != "no fragments" {
+		t.Errorf("parseFragments of comments = %v, want no fragments", err)
+	}
+}
+
+// TestHumanFragmentsRoundTrip turns JSON ABIs into fragments and back.
+func TestHumanFragmentsRoundTrip(t *testing.T) {
+	for name, js := range map[string]string{
+		"greeter": greeterABI,
+		"mixed": `[
+			{"type":"constructor","stateMutability":"payable","inputs":[{"name":"owner","type":"address"}]},
+			{"type":"function","name":"aggregate3","stateMutability":"payable",
+				"inputs":[{"name":"calls","type":"tuple[]","components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}]}],
+				"outputs":[{"name":"returnData","type":"tuple[]","components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}]}]},
+			{"type":"function","name":"balanceOf","constant":true,"inputs":[{"name":"","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+			{"type":"event","name":"Deposit","anonymous":true,"inputs":[{"name":"","type":"address","indexed":true},{"name":"","type":"uint256","indexed":false}]},
+			{"type":"error","name":"Unauthorized","inputs":[{"name":"caller","type":"address"}]},
+			{"type":"receive","stateMutability":"payable"}
+		]`,
+	} {
+		want, err := abi.JSON(strings.NewReader(js))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fragments := humanFragments(&want)
+		got := fragmentABI(t, fragments...)
+		if err := sameABI(&want, &got); err != nil {
+			t.Errorf("%s: %v; fragments:\n%s", name, err, strings.Join(fragments, "\n"))
+		}
+		if name == "mixed" {
+			wantFragments := []string{
+				"constructor(address owner) payable",
+				"function aggregate3(tuple(address target, bool allowFailure, bytes callData)[] calls) payable returns (tuple(bool success, bytes returnData)[] returnData)",
+				"function balanceOf(address) view returns (uint256)",
+				"event Deposit(address indexed, uint256) anonymous",
+				"error Unauthorized(address caller)",
+				"receive() external payable",
+			}
+			if strings.Join(fragments, "\n") != strings.Join(wantFragments, "\n") {
+				t.Errorf("fragments:\n%s\nwant:\n%s", strings.Join(fragments, "\n"), strings.Join(wantFragments, "\n"))
+			}
+		}
+	}
+}
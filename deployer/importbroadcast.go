@@ -0,0 +1,370 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ImportReport is what import-broadcast did, per deployment found.
+type ImportReport struct {
+	Imported  []ImportedDeployment `json:"imported"`
+	Skipped   []ImportedDeployment `json:"skipped,omitempty"`
+	Conflicts []ImportConflict     `json:"conflicts,omitempty"`
+}
+
+// ImportedDeployment is one deployment of a broadcast file. Version is
+// its version in the manifest once imported; Reason says why it was not.
+type ImportedDeployment struct {
+	Contract string         `json:"contract"`
+	Address  common.Address `json:"address"`
+	TxHash   common.Hash    `json:"txHash"`
+	File     string         `json:"file"`
+	Version  int            `json:"version,omitempty"`
+	Reason   string         `json:"reason,omitempty"`
+}
+
+// ImportConflict is a contract whose current manifest deployment is not
+// the one the broadcast files last deployed. Resolution is empty until
+// --prefer picks a side.
+type ImportConflict struct {
+	Contract   string         `json:"contract"`
+	Manifest   common.Address `json:"manifest"`
+	Broadcast  common.Address `json:"broadcast"`
+	Newer      string         `json:"newer"`
+	Resolution string         `json:"resolution,omitempty"`
+}
+
+// broadcastFile is the part of a forge broadcast file import reads. Older
+// forge versions wrote the calldata as data rather than input, and the
+// timestamp in seconds rather than milliseconds.
+type broadcastFile struct {
+	Transactions []struct {
+		Hash            common.Hash     `json:"hash"`
+		TransactionType string          `json:"transactionType"`
+		ContractName    *string         `json:"contractName"`
+		ContractAddress *common.Address `json:"contractAddress"`
+		Arguments       []string        `json:"arguments"`
+		Transaction     struct {
+			From  common.Address `json:"from"`
+			Input hexutil.Bytes  `json:"input"`
+			Data  hexutil.Bytes  `json:"data"`
+		} `json:"transaction"`
+	} `json:"transactions"`
+	Receipts []struct {
+		TransactionHash common.Hash `json:"transactionHash"`
+		BlockNumber     string      `json:"blockNumber"`
+		Status          string      `json:"status"`
+	} `json:"receipts"`
+	Timestamp uint64 `json:"timestamp"`
+	Chain     uint64 `json:"chain"`
+}
+
+// importCandidate is a contract creation found in a broadcast file.
+type importCandidate struct {
+	name     string
+	file     string
+	d        Deployment
+	initCode []byte
+	args     []string
+}
+
+// runImportBroadcast implements `import-broadcast [flags] <path|glob>...`:
+// record the contracts forge script deployed in the manifests, so deploy's
+// skip logic, verify and upgrade know about them.
+func runImportBroadcast(ctx context.Context, args []string) error {
+	fset := flag.NewFlagSet("import-broadcast", flag.ExitOnError)
+	var o options
+	o.register(fset)
+	outDir := fset.String("out-dir", "out", "Foundry output directory, for the artifacts constructor arguments are decoded with")
+	prefer := fset.String("prefer", "", "on a conflict, keep the manifest's current deployment (manifest) or make the broadcast's current (broadcast)")
+	if err := parseFlags(fset, args, &o); err != nil {
+		return err
+	}
+	if fset.NArg() == 0 {
+		return errors.New("usage: import-broadcast [flags] <path|glob>...")
+	}
+	if *prefer != "" && *prefer != "manifest" && *prefer != "broadcast" {
+		return fmt.Errorf("--prefer: want manifest or broadcast, got %q", *prefer)
+	}
+	files, err := broadcastFiles(fset.Args())
+	if err != nil {
+		return err
+	}
+
+	client, chainID, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	report := &ImportReport{Imported: []ImportedDeployment{}}
+	ui.report.Import = report
+	skip := func(c *importCandidate, reason string) {
+		ui.Printf("Skipping %s at %s (%s): %s\n", c.name, c.d.Address.Hex(), c.file, reason)
+		report.Skipped = append(report.Skipped, ImportedDeployment{Contract: c.name, Address: c.d.Address, TxHash: c.d.TxHash, File: c.file, Reason: reason})
+	}
+
+	seen := map[common.Hash]bool{}
+	byName := map[string][]*importCandidate{}
+	var names []string
+	for _, path := range files {
+		found, err := readBroadcast(path, chainID.Uint64())
+		if err != nil {
+			return err
+		}
+		for _, c := range found {
+			if seen[c.d.TxHash] {
+				continue
+			}
+			seen[c.d.TxHash] = true
+			if c.name == "" {
+				skip(c, "forge recorded no contract name")
+				continue
+			}
+			code, err := client.CodeAt(ctx, c.d.Address, nil)
+			if err != nil {
+				return fmt.Errorf("get code at %s: %w", c.d.Address.Hex(), err)
+			}
+			if len(code) == 0 {
+				skip(c, "no code there on chain "+chainID.String())
+				continue
+			}
+			if _, ok := byName[c.name]; !ok {
+				names = append(names, c.name)
+			}
+			byName[c.name] = append(byName[c.name], c)
+		}
+	}
+	if len(byName) == 0 {
+		ui.Printf("No deployments on chain %s found in %d broadcast files\n", chainID, len(files))
+		return nil
+	}
+
+	slices.Sort(names)
+	for _, name := range names {
+		found := byName[name]
+		slices.SortStableFunc(found, func(a, b *importCandidate) int { return a.d.Timestamp.Compare(b.d.Timestamp) })
+		path := manifestPath(o.deployments, chainID, name)
+		m, err := readManifest(path)
+		if err != nil {
+			return err
+		}
+		// Import what the broadcasts deployed after the last deployment
+		// the manifest already has.
+		fresh := found
+		for i, c := range found {
+			if m.records(c.d.Address) {
+				fresh = found[i+1:]
+			}
+		}
+		if len(fresh) == 0 {
+			ui.Printf("%s: %s already recorded in %s\n", name, found[len(found)-1].d.Address.Hex(), path)
+			continue
+		}
+		last := fresh[len(fresh)-1]
+		if cur := m.latest(); cur != nil {
+			conflict := ImportConflict{Contract: name, Manifest: cur.Address, Broadcast: last.d.Address, Newer: "broadcast"}
+			if cur.Timestamp.After(last.d.Timestamp) {
+				conflict.Newer = "manifest"
+			}
+			conflict.Resolution = *prefer
+			report.Conflicts = append(report.Conflicts, conflict)
+			ui.Printf("Conflict: %s is %s in %s but %s in %s (the %s is newer)\n", name, cur.Address.Hex(), path, last.d.Address.Hex(), last.file, conflict.Newer)
+			if *prefer != "broadcast" {
+				for _, c := range fresh {
+					reason := "conflicts with the manifest; pass --prefer"
+					if *prefer == "manifest" {
+						reason = "--prefer manifest"
+					}
+					skip(c, reason)
+				}
+				continue
+			}
+		}
+		for _, c := range fresh {
+			d := c.record(m, *outDir)
+			ui.Printf("Imported %s v%d at %s from %s\n", name, d.Version, d.Address.Hex(), c.file)
+			report.Imported = append(report.Imported, ImportedDeployment{Contract: name, Address: d.Address, TxHash: d.TxHash, File: c.file, Version: d.Version})
+		}
+		m.ChainID, m.Contract = chainID.Uint64(), name
+		if err := writeManifest(path, m); err != nil {
+			return err
+		}
+	}
+	if *prefer == "" && len(report.Conflicts) > 0 {
+		return fmt.Errorf("%d contracts conflict with their manifests and were not imported; pass --prefer manifest or --prefer broadcast", len(report.Conflicts))
+	}
+	return nil
+}
+
+// broadcastFiles expands args, files, globs or directories searched for
+// run-*.json, into the broadcast files to read, once each. A directory's
+// run-latest.json is skipped as a copy of one of its runs.
+func broadcastFiles(args []string) ([]string, error) {
+	var files []string
+	add := func(p string) {
+		if !slices.Contains(files, p) {
+			files = append(files, p)
+		}
+	}
+	for _, arg := range args {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s: no such file", arg)
+		}
+		for _, p := range matches {
+			info, err := os.Stat(p)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				add(p)
+				continue
+			}
+			err = filepath.WalkDir(p, func(path string, e fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				name := e.Name()
+				if !e.IsDir() && strings.HasPrefix(name, "run-") && strings.HasSuffix(name, ".json") && name != "run-latest.json" {
+					add(path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// readBroadcast returns the mined contract creations of the broadcast
+// file at path that were sent on chainID.
+func readBroadcast(path string, chainID uint64) ([]*importCandidate, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f broadcastFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("parse broadcast file %s: %w", path, err)
+	}
+	if f.Chain != chainID {
+		ui.Verbosef("%s: chain %d, not %d; skipped\n", path, f.Chain, chainID)
+		return nil, nil
+	}
+	ts := f.Timestamp
+	if ts > 1e12 {
+		ts /= 1000
+	}
+	when := time.Unix(int64(ts), 0).UTC()
+	blocks := map[common.Hash]uint64{}
+	for _, r := range f.Receipts {
+		if r.Status != "" && r.Status != "0x1" {
+			continue
+		}
+		if n, err := strconv.ParseUint(strings.TrimPrefix(r.BlockNumber, "0x"), 16, 64); err == nil {
+			blocks[r.TransactionHash] = n
+		}
+	}
+	var out []*importCandidate
+	for _, tx := range f.Transactions {
+		if tx.TransactionType != "CREATE" && tx.TransactionType != "CREATE2" {
+			continue
+		}
+		block, mined := blocks[tx.Hash]
+		if !mined || tx.ContractAddress == nil {
+			continue
+		}
+		input := tx.Transaction.Input
+		if len(input) == 0 {
+			input = tx.Transaction.Data
+		}
+		c := &importCandidate{file: path, args: tx.Arguments, initCode: input, d: Deployment{
+			Address:     *tx.ContractAddress,
+			Deployer:    tx.Transaction.From,
+			TxHash:      tx.Hash,
+			BlockNumber: block,
+			Timestamp:   when,
+		}}
+		if tx.ContractName != nil {
+			c.name = *tx.ContractName
+		}
+		if tx.TransactionType == "CREATE2" && len(input) >= 32 {
+			salt := common.BytesToHash(input[:32])
+			c.d.Salt, c.initCode = &salt, input[32:]
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// records reports whether m has a deployment at address.
+func (m *manifest) records(address common.Address) bool {
+	for _, d := range m.Deployments {
+		if d.Address == address || d.codeAddress() == address {
+			return true
+		}
+	}
+	return false
+}
+
+// record appends c to m as its next version. The constructor arguments
+// are decoded with the contract's artifact under outDir when its creation
+// code starts the init code; without one they are the strings forge
+// recorded, and the constructor data is unknown.
+func (c *importCandidate) record(m *manifest, outDir string) *Deployment {
+	d := c.d
+	d.Version = len(m.Deployments) + 1
+	d.Explorer = ui.explorerURL("address", d.Address.Hex())
+	d.ConstructorArgs = make([]interface{}, len(c.args))
+	for i, a := range c.args {
+		d.ConstructorArgs[i] = a
+	}
+	d.ConstructorData = "0x"
+	d.BytecodeHash = crypto.Keccak256Hash(c.initCode)
+
+	artifact := filepath.Join(outDir, c.name+".sol", c.name+".json")
+	a, err := LoadArtifact(artifact, c.name)
+	switch {
+	case err != nil:
+		ui.Warnf("warning: %s: %v; constructor data of %s not recorded\n", c.name, err, d.Address.Hex())
+	case !bytes.HasPrefix(c.initCode, a.Bytecode):
+		ui.Warnf("warning: %s: %s no longer matches the code deployed at %s; constructor data not recorded\n", c.name, artifact, d.Address.Hex())
+	default:
+		ctor := c.initCode[len(a.Bytecode):]
+		vals, err := a.ABI.Constructor.Inputs.Unpack(ctor)
+		if err != nil {
+			ui.Warnf("warning: %s: decode constructor arguments of %s: %v\n", c.name, d.Address.Hex(), err)
+			break
+		}
+		d.ConstructorArgs = make([]interface{}, len(vals))
+		for i, v := range vals {
+			d.ConstructorArgs[i] = jsonValue(v)
+		}
+		d.ConstructorData = formatValue(ctor)
+		d.BytecodeHash = crypto.Keccak256Hash(a.Bytecode)
+		d.Artifact = a.Path
+	}
+	m.Deployments = append(m.Deployments, d)
+	return m.latest()
+}
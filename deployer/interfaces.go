@@ -0,0 +1,238 @@
+package deployer
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// interfaceGas is the gas each supportsInterface call gets, as ERC-165
+// asks callers to allow.
+const interfaceGas = 30000
+
+// knownInterfaces are the ERC-165 interface IDs `interfaces` asks about.
+var knownInterfaces = []struct {
+	name string
+	id   [4]byte
+}{
+	{"ERC-165", [4]byte{0x01, 0xff, 0xc9, 0xa7}},
+	{"ERC-721", [4]byte{0x80, 0xac, 0x58, 0xcd}},
+	{"ERC-721 Metadata", [4]byte{0x5b, 0x5e, 0x13, 0x9f}},
+	{"ERC-721 Enumerable", [4]byte{0x78, 0x0e, 0x9d, 0x63}},
+	{"ERC-1155", [4]byte{0xd9, 0xb6, 0x7a, 0x26}},
+	{"ERC-1155 Metadata URI", [4]byte{0x0e, 0x89, 0x34, 0x1c}},
+	{"ERC-2981 royalties", [4]byte{0x2a, 0x55, 0x20, 0x5a}},
+	{"ERC-4906 metadata updates", [4]byte{0x49, 0x06, 0x49, 0x06}},
+	{"ERC-1363 payable token", [4]byte{0xb0, 0x20, 0x2a, 0x11}},
+	{"AccessControl", [4]byte{0x79, 0x65, 0xdb, 0x0b}},
+	{"AccessControlEnumerable", [4]byte{0x5a, 0x05, 0x18, 0x0f}},
+}
+
+var supportsInterfaceSelector = crypto.Keccak256([]byte("supportsInterface(bytes4)"))[:4]
+
+// probe makes a gas-capped eth_call to address. A call the node ran and
+// that failed, by a revert or by running out of gas, is not an error:
+// ok is false. Transport errors are returned.
+func probe(ctx context.Context, client *rpcClient, address common.Address, data []byte) (ret []byte, ok bool, err error) {
+	ret, err = client.CallContract(ctx, ethereum.CallMsg{To: &address, Gas: interfaceGas, Data: data}, nil)
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return nil, false, nil
+	}
+	return ret, err == nil, err
+}
+
+// supportsInterface asks address whether it claims id. Only a single
+// word holding exactly 1 is a yes.
+func supportsInterface(ctx context.Context, client *rpcClient, address common.Address, id [4]byte) (bool, error) {
+	ret, ok, err := probe(ctx, client, address, append(append([]byte{}, supportsInterfaceSelector...), common.RightPadBytes(id[:], 32)...))
+	if err != nil {
+		return false, fmt.Errorf("supportsInterface(0x%x) on %s: %w", id, address.Hex(), err)
+	}
+	return ok && len(ret) == 32 && common.BytesToHash(ret) == common.BigToHash(common.Big1), nil
+}
+
+// answersWord reports whether each of sigs, called with all-zero
+// arguments, returns one word: the heuristic for standards without
+// ERC-165.
+func answersWord(ctx context.Context, client *rpcClient, address common.Address, sigs ...string) (bool, error) {
+	for _, sig := range sigs {
+		data := crypto.Keccak256([]byte(sig))[:4]
+		if !strings.HasSuffix(sig, "()") {
+			data = append(data, make([]byte, 32*(strings.Count(sig, ",")+1))...)
+		}
+		ret, ok, err := probe(ctx, client, address, data)
+		if err != nil {
+			return false, fmt.Errorf("%s on %s: %w", sig, address.Hex(), err)
+		}
+		if !ok || len(ret) != 32 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// parseInterfaceID parses a --id value: 0x and four bytes.
+func parseInterfaceID(s string) ([4]byte, error) {
+	var id [4]byte
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(b) != 4 || !strings.HasPrefix(s, "0x") {
+		return id, fmt.Errorf("interface ID %q: want 0x and 8 hex digits", s)
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+// detectInterfaces checks address for ERC-165 and, when it implements
+// it, asks about each known interface and extra. ERC-20, ERC-4626 and
+// UUPS predate or skip ERC-165, so they are recognised by the calls
+// they answer.
+func detectInterfaces(ctx context.Context, client *rpcClient, address common.Address, extra [][4]byte) (*InterfacesReport, error) {
+	r := &InterfacesReport{Address: address}
+	if answersAnything(ctx, client, address) {
+		r.CatchAll = true
+		return r, nil
+	}
+
+	// ERC-165 detection: claim 0x01ffc9a7 and deny 0xffffffff.
+	yes, err := supportsInterface(ctx, client, address, knownInterfaces[0].id)
+	if err != nil {
+		return nil, err
+	}
+	if yes {
+		no, err := supportsInterface(ctx, client, address, [4]byte{0xff, 0xff, 0xff, 0xff})
+		if err != nil {
+			return nil, err
+		}
+		r.ERC165 = !no
+	}
+	if r.ERC165 {
+		r.Interfaces = append(r.Interfaces, InterfaceReport{Name: knownInterfaces[0].name, ID: fmt.Sprintf("0x%x", knownInterfaces[0].id), Supported: true, Via: "supportsInterface"})
+		for _, k := range knownInterfaces[1:] {
+			ok, err := supportsInterface(ctx, client, address, k.id)
+			if err != nil {
+				return nil, err
+			}
+			r.Interfaces = append(r.Interfaces, InterfaceReport{Name: k.name, ID: fmt.Sprintf("0x%x", k.id), Supported: ok, Via: "supportsInterface"})
+		}
+		for _, id := range extra {
+			ok, err := supportsInterface(ctx, client, address, id)
+			if err != nil {
+				return nil, err
+			}
+			r.Interfaces = append(r.Interfaces, InterfaceReport{Name: "custom", ID: fmt.Sprintf("0x%x", id), Supported: ok, Via: "supportsInterface"})
+		}
+	}
+
+	erc20, err := answersWord(ctx, client, address, "totalSupply()", "balanceOf(address)", "allowance(address,address)")
+	if err != nil {
+		return nil, err
+	}
+	r.Interfaces = append(r.Interfaces, InterfaceReport{Name: "ERC-20", Supported: erc20, Via: "totalSupply, balanceOf, allowance"})
+	erc4626 := false
+	if erc20 {
+		if erc4626, err = answersWord(ctx, client, address, "asset()", "totalAssets()", "convertToShares(uint256)"); err != nil {
+			return nil, err
+		}
+	}
+	r.Interfaces = append(r.Interfaces, InterfaceReport{Name: "ERC-4626 vault", Supported: erc4626, Via: "asset, totalAssets, convertToShares"})
+	ret, ok, err := probe(ctx, client, address, proxiableUUIDSelector)
+	if err != nil {
+		return nil, fmt.Errorf("proxiableUUID() on %s: %w", address.Hex(), err)
+	}
+	uups := ok && common.BytesToHash(ret) == implementationSlot && len(ret) == 32
+	r.Interfaces = append(r.Interfaces, InterfaceReport{Name: "UUPS (ERC-1822)", Supported: uups, Via: "proxiableUUID"})
+	return r, nil
+}
+
+// runInterfaces implements `interfaces [--id 0x...] <address>`: which
+// standard interfaces a contract claims or looks like it implements.
+func runInterfaces(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("interfaces", flag.ExitOnError)
+	var o options
+	var extra [][4]byte
+	o.register(fs)
+	fs.Func("id", "also ask supportsInterface about this interface `ID` (0x and 8 hex digits; repeatable)", func(v string) error {
+		id, err := parseInterfaceID(v)
+		if err != nil {
+			return err
+		}
+		extra = append(extra, id)
+		return nil
+	})
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: interfaces [flags] <address>")
+	}
+	address, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	client, _, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	code, err := client.CodeAt(ctx, address, nil)
+	if err != nil {
+		return fmt.Errorf("get code at %s: %w", address.Hex(), err)
+	}
+	if len(code) == 0 {
+		return fmt.Errorf("no contract at %s", address.Hex())
+	}
+	r, err := detectInterfaces(ctx, client, address, extra)
+	if err != nil {
+		return err
+	}
+	ui.report.Interfaces = r
+
+	if r.CatchAll {
+		ui.Resultf("%s answers calls it does not define, so it cannot be asked what it implements\n", address.Hex())
+		return nil
+	}
+	if r.ERC165 {
+		ui.Resultf("%s implements ERC-165\n", address.Hex())
+	} else {
+		ui.Resultf("%s does not implement ERC-165, so it cannot be asked about interfaces\n", address.Hex())
+		if len(extra) > 0 {
+			ui.Warnf("warning: --id not checked without ERC-165\n")
+		}
+	}
+	rows := [][]string{{"interface", "id", "supported", "checked by"}}
+	for _, i := range r.Interfaces {
+		yes := "no"
+		if i.Supported {
+			yes = "yes"
+		}
+		id := i.ID
+		if id == "" {
+			id = "-"
+		}
+		rows = append(rows, []string{i.Name, id, yes, i.Via})
+	}
+	width := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			width[i] = max(width[i], len(cell))
+		}
+	}
+	for _, row := range rows {
+		line := ""
+		for i, cell := range row {
+			line += fmt.Sprintf("  %-*s", width[i], cell)
+		}
+		ui.Resultln(strings.TrimRight(line, " "))
+	}
+	return nil
+}
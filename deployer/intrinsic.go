@@ -0,0 +1,109 @@
+package deployer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// IntrinsicGas is the gas a transaction is charged before any code runs,
+// split by what it pays for, with post-Istanbul (EIP-2028) calldata
+// pricing and the Shanghai (EIP-3860) init code charge.
+type IntrinsicGas struct {
+	Base          uint64 `json:"base"`                    // 21000 for every transaction
+	Create        uint64 `json:"create,omitempty"`        // 32000 more for a contract creation
+	ZeroBytes     uint64 `json:"zeroBytes"`               // calldata bytes that are zero, 4 gas each
+	NonZeroBytes  uint64 `json:"nonZeroBytes"`            // the rest, 16 gas each
+	Calldata      uint64 `json:"calldata"`                // the two together
+	InitCodeWords uint64 `json:"initCodeWords,omitempty"` // 32-byte words of a creation's init code
+	InitCode      uint64 `json:"initCode,omitempty"`      // 2 gas per word
+	AccessList    uint64 `json:"accessList,omitempty"`    // 2400 per address, 1900 per storage key
+	Authorization uint64 `json:"authorization,omitempty"` // 25000 per EIP-7702 authorization
+	Total         uint64 `json:"total"`
+}
+
+// IntrinsicGasBreakdown splits the intrinsic gas of tx. The node charges
+// it on top of whatever execution costs, so an estimate minus Total is
+// what the code itself uses.
+func IntrinsicGasBreakdown(tx *types.Transaction) IntrinsicGas {
+	g := IntrinsicGas{Base: params.TxGas}
+	data := tx.Data()
+	for _, b := range data {
+		if b == 0 {
+			g.ZeroBytes++
+		} else {
+			g.NonZeroBytes++
+		}
+	}
+	g.Calldata = g.ZeroBytes*params.TxDataZeroGas + g.NonZeroBytes*params.TxDataNonZeroGasEIP2028
+	if tx.To() == nil {
+		g.Create = params.TxGasContractCreation - params.TxGas
+		g.InitCodeWords = toWordSize(uint64(len(data)))
+		g.InitCode = g.InitCodeWords * params.InitCodeWordGas
+	}
+	for _, t := range tx.AccessList() {
+		g.AccessList += params.TxAccessListAddressGas + uint64(len(t.StorageKeys))*params.TxAccessListStorageKeyGas
+	}
+	g.Authorization = uint64(len(tx.SetCodeAuthorizations())) * params.CallNewAccountGas
+	g.Total = g.Base + g.Create + g.Calldata + g.InitCode + g.AccessList + g.Authorization
+	return g
+}
+
+// toWordSize is the number of 32-byte words n bytes take.
+func toWordSize(n uint64) uint64 {
+	return (n + 31) / 32
+}
+
+// msgIntrinsicGas is the intrinsic gas of msg sent with list attached.
+func msgIntrinsicGas(msg ethereum.CallMsg, list types.AccessList) IntrinsicGas {
+	return IntrinsicGasBreakdown(types.NewTx(&types.DynamicFeeTx{To: msg.To, Data: msg.Data, AccessList: list}))
+}
+
+// printIntrinsic prints g term by term to l and, when estimate is known
+// (not 0), the part of it left for execution.
+func printIntrinsic(l *logger, g IntrinsicGas, estimate uint64) {
+	terms := []string{fmt.Sprintf("%d base", g.Base)}
+	if g.Create > 0 {
+		terms = append(terms, fmt.Sprintf("%d create", g.Create))
+	}
+	terms = append(terms, fmt.Sprintf("%d calldata (%d zero bytes x%d, %d non-zero x%d)",
+		g.Calldata, g.ZeroBytes, params.TxDataZeroGas, g.NonZeroBytes, params.TxDataNonZeroGasEIP2028))
+	if g.InitCode > 0 {
+		terms = append(terms, fmt.Sprintf("%d init code (%d words x%d)", g.InitCode, g.InitCodeWords, params.InitCodeWordGas))
+	}
+	if g.AccessList > 0 {
+		terms = append(terms, fmt.Sprintf("%d access list", g.AccessList))
+	}
+	if g.Authorization > 0 {
+		terms = append(terms, fmt.Sprintf("%d authorizations", g.Authorization))
+	}
+	l.Printf("  intrinsic gas: %d = %s\n", g.Total, strings.Join(terms, " + "))
+	if estimate >= g.Total {
+		l.Printf("  execution gas: %d (estimate minus intrinsic)\n", estimate-g.Total)
+	}
+}
+
+// initCodeWarnShare is the share of the EIP-3860 limit past which init
+// code is flagged as close to it.
+const initCodeWarnShare = 0.9
+
+// printInitCode prints how code, c's creation bytecode followed by the
+// encoded constructor arguments, splits, and warns when it comes close
+// to the init code limit (going over it fails the pre-flight checks). It
+// prints to l.
+func printInitCode(l *logger, c *Artifact, code []byte) {
+	args := len(code) - len(c.Bytecode)
+	l.Printf("  init code:     %d bytes: %d bytecode + %d constructor args (limit %d)\n", len(code), len(c.Bytecode), args, maxInitCodeSize)
+	if len(code) > maxInitCodeSize || float64(len(code)) < initCodeWarnShare*maxInitCodeSize {
+		return
+	}
+	why := ""
+	if args > 0 {
+		why = fmt.Sprintf("; the constructor arguments take %d of them", args)
+	}
+	l.Warnf("warning: init code of %s is %d bytes, %.0f%% of the EIP-3860 limit of %d%s\n",
+		c.Name, len(code), 100*float64(len(code))/maxInitCodeSize, maxInitCodeSize, why)
+}
@@ -0,0 +1,78 @@
+package deployer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestIntrinsicGasBreakdown(t *testing.T) {
+	to := common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8")
+	call := func(data []byte, list types.AccessList) *types.Transaction {
+		return types.NewTx(&types.DynamicFeeTx{To: &to, Data: data, AccessList: list})
+	}
+	create := func(data []byte) *types.Transaction {
+		return types.NewTx(&types.DynamicFeeTx{Data: data})
+	}
+	half := append(bytes.Repeat([]byte{0}, 32), bytes.Repeat([]byte{0xff}, 32)...)
+
+	for _, tt := range []struct {
+		name string
+		tx   *types.Transaction
+		want IntrinsicGas
+	}{
+		{"transfer", call(nil, nil), IntrinsicGas{Base: 21000, Total: 21000}},
+		// transfer(address,uint256)'s selector and 4 zero bytes: 4x16 + 4x4
+		{"calldata", call([]byte{0xa9, 0x05, 0x9c, 0xbb, 0, 0, 0, 0}, nil),
+			IntrinsicGas{Base: 21000, ZeroBytes: 4, NonZeroBytes: 4, Calldata: 80, Total: 21080}},
+		{"all zero", call(make([]byte, 100), nil),
+			IntrinsicGas{Base: 21000, ZeroBytes: 100, Calldata: 400, Total: 21400}},
+		// 2400 for the address, 1900 per key
+		{"access list", call(nil, types.AccessList{{Address: to, StorageKeys: []common.Hash{{1}, {2}}}}),
+			IntrinsicGas{Base: 21000, AccessList: 6200, Total: 27200}},
+		{"empty create", create(nil), IntrinsicGas{Base: 21000, Create: 32000, Total: 53000}},
+		// 33 bytes are two words: 33x16 calldata + 2x2 init code
+		{"create 33 bytes", create(bytes.Repeat([]byte{0x60}, 33)),
+			IntrinsicGas{Base: 21000, Create: 32000, NonZeroBytes: 33, Calldata: 528, InitCodeWords: 2, InitCode: 4, Total: 53532}},
+		{"create 32 zero, 32 not", create(half),
+			IntrinsicGas{Base: 21000, Create: 32000, ZeroBytes: 32, NonZeroBytes: 32, Calldata: 640, InitCodeWords: 2, InitCode: 4, Total: 53644}},
+		// The EIP-3860 limit: 49152 bytes are 1536 words
+		{"create at the limit", create(bytes.Repeat([]byte{1}, maxInitCodeSize)),
+			IntrinsicGas{Base: 21000, Create: 32000, NonZeroBytes: 49152, Calldata: 786432, InitCodeWords: 1536, InitCode: 3072, Total: 842504}},
+		{"authorizations", types.NewTx(&types.SetCodeTx{To: to, AuthList: make([]types.SetCodeAuthorization, 2)}),
+			IntrinsicGas{Base: 21000, Authorization: 50000, Total: 71000}},
+	} {
+		if got := IntrinsicGasBreakdown(tt.tx); got != tt.want {
+			t.Errorf("%s: intrinsic gas = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+}
+
+func TestPrintInitCode(t *testing.T) {
+	warned := warnings(t)
+	c := &Artifact{Name: "Big", Bytecode: make([]byte, 40_000)}
+	for _, tt := range []struct {
+		args int
+		want string
+	}{
+		{4_000, ""},
+		{5_000, "warning: init code of Big is 45000 bytes, 92% of the EIP-3860 limit of 49152; the constructor arguments take 5000 of them\n"},
+		// Over the limit is the pre-flight checks' error, not a warning.
+		{10_000, ""},
+	} {
+		warned.Reset()
+		printInitCode(ui, c, make([]byte, len(c.Bytecode)+tt.args))
+		if warned.String() != tt.want {
+			t.Errorf("%d bytes of args: warned %q, want %q", tt.args, warned, tt.want)
+		}
+	}
+	warned.Reset()
+	printInitCode(ui, &Artifact{Name: "Huge", Bytecode: make([]byte, 46_000)}, make([]byte, 46_000))
+	if w := warned.String(); !strings.Contains(w, "init code of Huge is 46000 bytes, 94%") || strings.Contains(w, "constructor arguments") {
+		t.Errorf("bytecode alone near the limit: warned %q", w)
+	}
+}
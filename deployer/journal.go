@@ -0,0 +1,584 @@
+package deployer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// journalLockWait is how long a journal update waits for another
+	// run's; updates hold the lock for milliseconds.
+	journalLockWait = 5 * time.Second
+	// journalStaleLock is the age past which a lock is taken to be left
+	// by a run that died while holding it.
+	journalStaleLock = 30 * time.Second
+	// journalKeep is how many finished entries the journal keeps.
+	journalKeep = 200
+)
+
+// Journal entry states: written before the send, then mined once
+// confirmed and complete when the run's bookkeeping is done; or failed,
+// when the node rejected the send, or abandoned.
+const (
+	journalPending   = "pending"
+	journalMined     = "mined"
+	journalComplete  = "complete"
+	journalFailed    = "failed"
+	journalAbandoned = "abandoned"
+)
+
+// journalEntry is one signed transaction, written before it is sent.
+// TxHash and Raw are the latest signed version; Replaced lists the
+// fee-bumped versions it replaced. For a deployment, Contract, Artifact
+// and Deployments let `journal resume` record it if the run died first.
+type journalEntry struct {
+	TxHash      common.Hash     `json:"txHash"`
+	Replaced    []common.Hash   `json:"replaced,omitempty"`
+	Raw         string          `json:"raw"`
+	Operation   string          `json:"operation"`
+	From        common.Address  `json:"from"`
+	Nonce       uint64          `json:"nonce"`
+	To          *common.Address `json:"to,omitempty"`
+	Predicted   *common.Address `json:"predicted,omitempty"`
+	Contract    string          `json:"contract,omitempty"`
+	Artifact    string          `json:"artifact,omitempty"`
+	Deployments string          `json:"deployments,omitempty"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	MinedTx     *common.Hash    `json:"minedTx,omitempty"`
+	Block       uint64          `json:"block,omitempty"`
+	PID         int             `json:"pid"`
+	Sent        time.Time       `json:"sent"`
+	Updated     time.Time       `json:"updated"`
+}
+
+func (e *journalEntry) done() bool {
+	return e.Status != journalPending && e.Status != journalMined
+}
+
+func (e *journalEntry) hashes() []common.Hash {
+	return append([]common.Hash{e.TxHash}, e.Replaced...)
+}
+
+// journalFile is <journal-dir>/<chainid>/journal.json.
+type journalFile struct {
+	ChainID uint64         `json:"chainId"`
+	Entries []journalEntry `json:"entries"`
+}
+
+// journal is the write-ahead log of a session's transactions, so a run
+// that dies between a send and its manifest write leaves a trail. Runs
+// share it through a lock file taken for each update.
+type journal struct {
+	ui       *logger
+	path     string
+	lock     string
+	chainID  *big.Int
+	dir      string        // deployments directory
+	confirms []common.Hash // entries this session saw mined
+}
+
+// openJournal returns the journal of chainID under dir, warning through
+// l, or nil if dir is empty.
+func openJournal(l *logger, dir string, chainID *big.Int, deployments string) *journal {
+	if dir == "" {
+		return nil
+	}
+	base := filepath.Join(dir, chainID.String())
+	return &journal{ui: l, path: filepath.Join(base, "journal.json"), lock: filepath.Join(base, "journal.lock"), chainID: chainID, dir: deployments}
+}
+
+// update applies fn to the journal under the lock and writes it back.
+func (j *journal) update(fn func(f *journalFile) error) error {
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o755); err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	owner, err := j.acquire()
+	if err != nil {
+		return err
+	}
+	defer releaseLock(j.lock, owner.Token)
+	f, err := j.read()
+	if err != nil {
+		return err
+	}
+	if err := fn(f); err != nil {
+		return err
+	}
+	f.prune()
+	if err := writeJSON(j.path, f); err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+	return nil
+}
+
+func (j *journal) read() (*journalFile, error) {
+	f := &journalFile{ChainID: j.chainID.Uint64()}
+	raw, err := os.ReadFile(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	if err := json.Unmarshal(raw, f); err != nil {
+		return nil, fmt.Errorf("parse journal %s: %w", j.path, err)
+	}
+	return f, nil
+}
+
+// prune drops the oldest finished entries beyond journalKeep.
+func (f *journalFile) prune() {
+	finished := 0
+	for i := len(f.Entries) - 1; i >= 0; i-- {
+		if !f.Entries[i].done() {
+			continue
+		}
+		if finished++; finished > journalKeep {
+			f.Entries = append(f.Entries[:i], f.Entries[i+1:]...)
+		}
+	}
+}
+
+// acquire creates the lock file, waiting for another run's to go away,
+// and returns its owner. A lock whose process is gone, or older than
+// journalStaleLock, is taken over with a warning.
+func (j *journal) acquire() (lockOwner, error) {
+	owner := newLockOwner()
+	deadline := time.Now().Add(journalLockWait)
+	err := acquireLock(j.lock, "journal lock", owner, journalStaleLock, j.ui.Warnf, func(*lockOwner) error {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("journal %s is locked by another run; delete %s if none is running", j.path, j.lock)
+		}
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	return owner, err
+}
+
+// begin journals tx, signed but not yet sent, as sum describes it.
+func (j *journal) begin(tx *types.Transaction, from common.Address, sum txSummary) error {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	e := journalEntry{
+		TxHash: tx.Hash(), Raw: hexutil.Encode(raw), Operation: sum.call,
+		From: from, Nonce: tx.Nonce(), To: tx.To(),
+		Status: journalPending, PID: os.Getpid(), Sent: now, Updated: now,
+	}
+	if sum.contract != "" {
+		e.Contract, e.Artifact, e.Deployments = sum.contract, sum.artifact, j.dir
+		e.Predicted = sum.created
+		if tx.To() == nil {
+			a := crypto.CreateAddress(from, tx.Nonce())
+			e.Predicted = &a
+		}
+	}
+	return j.update(func(f *journalFile) error {
+		f.Entries = append(f.Entries, e)
+		return nil
+	})
+}
+
+// set applies fn to the entry journaling hash.
+func (j *journal) set(hash common.Hash, fn func(e *journalEntry)) {
+	err := j.update(func(f *journalFile) error {
+		for i := range f.Entries {
+			e := &f.Entries[i]
+			for _, h := range e.hashes() {
+				if h == hash {
+					fn(e)
+					e.Updated = time.Now().UTC().Truncate(time.Second)
+					return nil
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		j.ui.Warnf("warning: %v\n", err)
+	}
+}
+
+// failed marks tx as never sent.
+func (j *journal) failed(tx *types.Transaction, err error) {
+	j.set(tx.Hash(), func(e *journalEntry) { e.Status, e.Error = journalFailed, err.Error() })
+}
+
+// replaced notes that next, a fee bump, replaced prev.
+func (j *journal) replaced(prev, next *types.Transaction) {
+	raw, err := next.MarshalBinary()
+	if err != nil {
+		return
+	}
+	j.set(prev.Hash(), func(e *journalEntry) {
+		e.Replaced = append(e.Replaced, e.TxHash)
+		e.TxHash, e.Raw = next.Hash(), hexutil.Encode(raw)
+	})
+}
+
+// mined marks the entry of the transaction rcpt confirms.
+func (j *journal) mined(sent *types.Transaction, rcpt *types.Receipt) {
+	j.set(sent.Hash(), func(e *journalEntry) {
+		e.Status, e.MinedTx, e.Block = journalMined, &rcpt.TxHash, rcpt.BlockNumber.Uint64()
+	})
+	j.confirms = append(j.confirms, sent.Hash())
+}
+
+// finish marks what this session saw mined complete: the command got
+// past it, manifests included.
+func (j *journal) finish() {
+	if j == nil || len(j.confirms) == 0 {
+		return
+	}
+	mine := map[common.Hash]bool{}
+	for _, h := range j.confirms {
+		mine[h] = true
+	}
+	err := j.update(func(f *journalFile) error {
+		for i := range f.Entries {
+			e := &f.Entries[i]
+			for _, h := range e.hashes() {
+				if mine[h] && e.Status == journalMined {
+					e.Status, e.Updated = journalComplete, time.Now().UTC().Truncate(time.Second)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		j.ui.Warnf("warning: %v\n", err)
+	}
+}
+
+// incomplete lists the entries left pending or mined by runs that are no
+// longer running.
+func (j *journal) incomplete() ([]journalEntry, error) {
+	f, err := j.read()
+	if err != nil {
+		return nil, err
+	}
+	var out []journalEntry
+	for _, e := range f.Entries {
+		if !e.done() && e.PID != os.Getpid() && !processAlive(e.PID) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// warnIncomplete points at `journal resume` when earlier runs left
+// transactions unaccounted for.
+func (j *journal) warnIncomplete() {
+	if j == nil {
+		return
+	}
+	entries, err := j.incomplete()
+	if err != nil {
+		j.ui.Warnf("warning: %v\n", err)
+		return
+	}
+	if len(entries) > 0 {
+		j.ui.Warnf("warning: %d transactions from earlier runs were sent but never finished (see %s); run `journal resume` to record or rebroadcast them\n", len(entries), j.path)
+	}
+}
+
+// JournalReport is what `journal list` or `journal resume` found.
+type JournalReport struct {
+	Path    string              `json:"path"`
+	Entries []JournalEntryState `json:"entries"`
+}
+
+// JournalEntryState is one journaled transaction and, after resume, what
+// became of it.
+type JournalEntryState struct {
+	TxHash    common.Hash     `json:"txHash"`
+	Operation string          `json:"operation"`
+	Nonce     uint64          `json:"nonce"`
+	Predicted *common.Address `json:"predicted,omitempty"`
+	Status    string          `json:"status"`
+	Outcome   string          `json:"outcome,omitempty"`
+}
+
+// journalCommands are the `journal` subcommands with their usage lines.
+var journalCommands = map[string]struct {
+	usage string
+	run   func(ctx context.Context, args []string) error
+}{
+	"list":   {"list [--all] [flags]", runJournalList},
+	"resume": {"resume [--rebroadcast | --abandon] [flags]", runJournalResume},
+}
+
+func journalUsage() error {
+	var usages []string
+	for _, cmd := range journalCommands {
+		usages = append(usages, "journal "+cmd.usage)
+	}
+	sort.Strings(usages)
+	return errors.New("usage:\n  " + strings.Join(usages, "\n  "))
+}
+
+// runJournal implements `journal <subcommand> [flags]`: the write-ahead
+// log of sent transactions.
+func runJournal(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return journalUsage()
+	}
+	cmd, ok := journalCommands[args[0]]
+	if !ok {
+		return journalUsage()
+	}
+	return cmd.run(ctx, args[1:])
+}
+
+// runJournalList implements `journal list`: the unfinished entries, or
+// with --all every entry kept.
+func runJournalList(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("journal list", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	all := fs.Bool("all", false, "list finished entries too")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: journal list [--all] [flags]")
+	}
+	if o.journalDir == "" {
+		return errors.New("--journal-dir is empty, so there is no journal")
+	}
+	client, chainID, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	client.Close()
+	j := openJournal(o.ui, o.journalDir, chainID, o.deployments)
+	f, err := j.read()
+	if err != nil {
+		return err
+	}
+	report := &JournalReport{Path: j.path, Entries: []JournalEntryState{}}
+	ui.report.Journal = report
+	for _, e := range f.Entries {
+		if e.done() && !*all {
+			continue
+		}
+		report.Entries = append(report.Entries, JournalEntryState{TxHash: e.TxHash, Operation: e.Operation, Nonce: e.Nonce, Predicted: e.Predicted, Status: e.Status})
+		ui.Resultf("%-9s nonce %-5d %s %s\n", e.Status, e.Nonce, e.TxHash.Hex(), e.Operation)
+		if e.Predicted != nil {
+			ui.Resultf("          at %s\n", e.Predicted.Hex())
+		}
+	}
+	if len(report.Entries) == 0 {
+		ui.Printf("Nothing unfinished in %s\n", j.path)
+	}
+	return nil
+}
+
+// runJournalResume implements `journal resume`: settle what earlier runs
+// left unfinished.
+func runJournalResume(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("journal resume", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	rebroadcast := fs.Bool("rebroadcast", false, "send transactions the node no longer knows again, without asking")
+	abandon := fs.Bool("abandon", false, "give up on transactions the node no longer knows, without asking")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: journal resume [--rebroadcast | --abandon] [flags]")
+	}
+	if *rebroadcast && *abandon {
+		return errors.New("pass --rebroadcast or --abandon, not both")
+	}
+	if o.journalDir == "" {
+		return errors.New("--journal-dir is empty, so there is no journal")
+	}
+	client, chainID, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	action := ""
+	switch {
+	case *rebroadcast:
+		action = "rebroadcast"
+	case *abandon:
+		action = "abandon"
+	}
+	j := openJournal(o.ui, o.journalDir, chainID, o.deployments)
+	return j.recover(ctx, client, &o, action)
+}
+
+// recover settles each incomplete entry. One that landed is recorded in
+// its manifest if it was a deployment the run never recorded. One whose
+// nonce another transaction used is abandoned. One the node still has
+// pending is left alone. One the node lost is sent again or abandoned, as
+// action says, or as the user answers; without a terminal it is left.
+func (j *journal) recover(ctx context.Context, client *rpcClient, o *options, action string) error {
+	entries, err := j.incomplete()
+	if err != nil {
+		return err
+	}
+	report := &JournalReport{Path: j.path, Entries: []JournalEntryState{}}
+	client.ui.report.Journal = report
+	if len(entries) == 0 {
+		client.ui.Printf("Nothing unfinished in %s\n", j.path)
+		return nil
+	}
+	client.ui.Printf("%d unfinished transactions in %s\n", len(entries), j.path)
+	for _, e := range entries {
+		client.ui.Printf("%s nonce %d %s\n", e.TxHash.Hex(), e.Nonce, e.Operation)
+		status, outcome, err := j.settle(ctx, client, o, e, action)
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.TxHash.Hex(), err)
+		}
+		client.ui.Printf("  %s\n", outcome)
+		report.Entries = append(report.Entries, JournalEntryState{TxHash: e.TxHash, Operation: e.Operation, Nonce: e.Nonce, Predicted: e.Predicted, Status: status, Outcome: outcome})
+		if status != e.Status {
+			j.set(e.TxHash, func(x *journalEntry) { x.Status = status })
+		}
+	}
+	return nil
+}
+
+// settle decides what became of e and returns its new status and what to
+// say about it.
+func (j *journal) settle(ctx context.Context, client *rpcClient, o *options, e journalEntry, action string) (string, string, error) {
+	rcpt, err := firstReceipt(ctx, client, e.hashes())
+	switch {
+	case err == nil:
+		return j.landed(ctx, client, e, rcpt)
+	case !errors.Is(err, ethereum.NotFound):
+		return "", "", fmt.Errorf("receipt: %w", err)
+	}
+	mined, err := client.NonceAt(ctx, e.From, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("nonce: %w", err)
+	}
+	if mined > e.Nonce {
+		return journalAbandoned, fmt.Sprintf("abandoned: nonce %d of %s was used by another transaction", e.Nonce, e.From.Hex()), nil
+	}
+	if _, pending, err := client.TransactionByHash(ctx, e.TxHash); err == nil && pending {
+		return e.Status, "still pending in the node's pool; left as is", nil
+	}
+
+	if action == "" {
+		if !isTerminal(os.Stdin) {
+			return e.Status, "not known to the node; pass --rebroadcast or --abandon", nil
+		}
+		client.ui.Printf("  not known to the node. Send it again? [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a == "y" || a == "yes" {
+			action = "rebroadcast"
+		} else {
+			action = "abandon"
+		}
+	}
+	if action == "abandon" {
+		return journalAbandoned, "abandoned; nonce " + strconv.FormatUint(e.Nonce, 10) + " is free again", nil
+	}
+	raw, err := hexutil.Decode(e.Raw)
+	if err != nil {
+		return "", "", fmt.Errorf("journaled transaction: %w", err)
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return "", "", fmt.Errorf("journaled transaction: %w", err)
+	}
+	if err := client.SendTransaction(ctx, tx); err != nil {
+		return "", "", fmt.Errorf("rebroadcast: %w", err)
+	}
+	client.ui.Printf("  sent again; waiting for it\n")
+	client.ui.link("tx", tx.Hash().Hex())
+	rcpt, err = WaitForReceipt(ctx, client, tx.Hash(), WaitOptions{Interval: o.pollInterval, Timeout: o.waitTimeout, Confirmations: o.confirmations})
+	if err != nil {
+		return "", "", err
+	}
+	return j.landed(ctx, client, e, rcpt)
+}
+
+// landed finishes the bookkeeping of e, included as rcpt: a deployment
+// not in its manifest yet is recorded there, with its constructor
+// arguments decoded from the init code when the artifact still matches.
+func (j *journal) landed(ctx context.Context, client *rpcClient, e journalEntry, rcpt *types.Receipt) (string, string, error) {
+	where := fmt.Sprintf("landed in block %s", rcpt.BlockNumber)
+	if rcpt.Status != 1 {
+		return journalComplete, where + " and reverted", nil
+	}
+	if e.Contract == "" || e.Predicted == nil {
+		return journalComplete, where, nil
+	}
+	address := *e.Predicted
+	// The latest state, since a node that is not an archive node may no
+	// longer have the state at a receipt from before the crash.
+	if code, err := client.CodeAt(ctx, address, nil); err != nil {
+		return "", "", fmt.Errorf("code at %s: %w", address.Hex(), err)
+	} else if len(code) == 0 {
+		return journalComplete, fmt.Sprintf("%s, but there is no code at %s", where, address.Hex()), nil
+	}
+	dir := e.Deployments
+	if dir == "" {
+		dir = j.dir
+	}
+	m, err := readManifest(manifestPath(dir, j.chainID, e.Contract))
+	if err != nil {
+		return "", "", err
+	}
+	if m.records(address) {
+		return journalComplete, fmt.Sprintf("%s; %s at %s is already recorded", where, e.Contract, address.Hex()), nil
+	}
+	if e.Artifact == "" {
+		return journalComplete, fmt.Sprintf("%s; %s is at %s, but without an artifact it is not recorded", where, e.Contract, address.Hex()), nil
+	}
+	c, err := loadArtifact(e.Artifact, e.Contract)
+	if err != nil {
+		return "", "", err
+	}
+	if err := linkLibraries(c, nil, dir, j.chainID); err != nil {
+		return "", "", err
+	}
+	tx, _, err := client.TransactionByHash(ctx, rcpt.TxHash)
+	if err != nil {
+		return "", "", fmt.Errorf("transaction: %w", err)
+	}
+	code := tx.Data()
+	d := newDeployment(e.From, address, rcpt)
+	if tx.To() != nil && len(code) >= 32 {
+		salt := common.BytesToHash(code[:32])
+		d.Salt, code = &salt, code[32:]
+	}
+	if !bytes.HasPrefix(code, c.Bytecode) {
+		return journalComplete, fmt.Sprintf("%s; %s is at %s, but its init code no longer matches %s, so it is not recorded", where, e.Contract, address.Hex(), e.Artifact), nil
+	}
+	args, err := c.ABI.Constructor.Inputs.Unpack(code[len(c.Bytecode):])
+	if err != nil {
+		return "", "", fmt.Errorf("decode constructor args: %w", err)
+	}
+	rec, err := recordDeployment(dir, j.chainID, c, args, d)
+	if err != nil {
+		return "", "", err
+	}
+	return journalComplete, fmt.Sprintf("%s; recorded %s v%d at %s in %s", where, e.Contract, rec.Version, address.Hex(), manifestPath(dir, j.chainID, e.Contract)), nil
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package deployer
+
+// canCheckProcess says processAlive cannot tell here: lock files then go
+// stale by age alone.
+const canCheckProcess = false
+
+// processAlive cannot tell here, so journal entries of other processes
+// are treated as left by runs that died; `journal resume` is still run by
+// hand.
+func processAlive(pid int) bool {
+	return false
+}
@@ -0,0 +1,65 @@
+package deployer
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestJournalLock checks a journal update waits for a live lock, even one
+// whose PID is not running here when it was taken on another host, and
+// takes over one left by a dead process here or gone quiet.
+func TestJournalLock(t *testing.T) {
+	warned := warnings(t)
+	j := openJournal(ui, t.TempDir(), big.NewInt(1337), "")
+	if err := os.MkdirAll(filepath.Dir(j.lock), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	update := func() chan error {
+		done := make(chan error, 1)
+		go func() { done <- j.update(func(*journalFile) error { return nil }) }()
+		return done
+	}
+	host, _ := os.Hostname()
+
+	// PIDs stop well short of 2^30 on Linux and macOS.
+	writeLock(t, j.lock, lockOwner{PID: 1 << 30, Host: "ci-runner-7", Token: "elsewhere"}, time.Now())
+	done := update()
+	select {
+	case err := <-done:
+		t.Fatalf("update returned while another host held the lock: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	os.Remove(j.lock)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	type staleLock struct {
+		owner lockOwner
+		beat  time.Time
+		why   string
+	}
+	stale := []staleLock{
+		{lockOwner{PID: 1, Host: "ci-runner-7", Token: "quiet"}, time.Now().Add(-2 * journalStaleLock), "no heartbeat for 1m0s"},
+	}
+	if canCheckProcess {
+		stale = append(stale, staleLock{lockOwner{PID: 1 << 30, Host: host, Token: "dead"}, time.Now(), "process 1073741824 is not running"})
+	}
+	for _, tt := range stale {
+		warned.Reset()
+		writeLock(t, j.lock, tt.owner, tt.beat)
+		if err := <-update(); err != nil {
+			t.Fatalf("update over %+v: %v", tt.owner, err)
+		}
+		if !strings.Contains(warned.String(), "removed stale journal lock "+j.lock+": "+tt.why) {
+			t.Fatalf("warnings %q, want the lock taken over because %s", warned, tt.why)
+		}
+		if leftovers, _ := filepath.Glob(j.lock + "*"); len(leftovers) != 0 {
+			t.Fatalf("files left after the update: %v", leftovers)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package deployer
+
+import "syscall"
+
+// canCheckProcess says processAlive can tell whether a process runs.
+const canCheckProcess = true
+
+// processAlive reports whether pid is a running process.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,314 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// KeeperReport counts what a keeper did. Runs are scheduled ticks;
+// each either was skipped because the --when condition was false, or
+// sent a transaction that succeeded or failed. A run whose condition or
+// send failed before anything was mined also counts as failed.
+type KeeperReport struct {
+	Runs                uint64       `json:"runs"`
+	Skipped             uint64       `json:"skipped"`
+	Executions          uint64       `json:"executions"`
+	Succeeded           uint64       `json:"succeeded"`
+	Failed              uint64       `json:"failed"`
+	ConsecutiveFailures int          `json:"consecutiveFailures"`
+	GasUsed             uint64       `json:"gasUsed"`
+	LastRun             string       `json:"lastRun,omitempty"`
+	LastTx              *common.Hash `json:"lastTx,omitempty"`
+	LastError           string       `json:"lastError,omitempty"`
+}
+
+// keeper calls a function on a contract every interval.
+type keeper struct {
+	s        *session
+	abi      *abi.ABI
+	bound    *bind.BoundContract
+	address  common.Address
+	m        *abi.Method
+	args     []interface{}
+	when     *abi.Method // nil without --when
+	txo      txOptions
+	interval time.Duration
+	maxFails int
+
+	mu      sync.Mutex
+	metrics KeeperReport
+}
+
+// runKeeper implements `keeper [flags] <address> <function> [args...]`:
+// send the call every --interval until stopped, e.g. to poke a contract
+// that needs regular upkeep.
+func runKeeper(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("keeper", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	txo := txOptions{nonce: -1}
+	o.register(fs)
+	ao.register(fs, "")
+	fs.StringVar(&txo.value, "value", "", "ether to send with each call, e.g. 0.01ether")
+	fs.BoolVar(&txo.forceValue, "force-value", false, "send --value even to a function the ABI marks non-payable")
+	fs.Uint64Var(&txo.gasLimit, "gas-limit", 0, "exact gas limit (default padded estimate, per call)")
+	argsJSON := fs.String("args", "", "function arguments as a JSON array")
+	interval := fs.Duration("interval", 5*time.Minute, "time to sleep between runs")
+	when := fs.String("when", "", "view function of the same contract, taking no arguments and returning bool; a run only sends when it returns true")
+	maxFails := fs.Int("max-consecutive-failures", 5, "stop after this many runs in a row fail (0 never stops)")
+	var mo metricsOptions
+	mo.register(fs)
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		return errors.New("usage: keeper [flags] <address> <function> [args...]")
+	}
+	if *interval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+	address, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	path, contract, err := ao.resolve()
+	if err != nil {
+		return err
+	}
+	c, err := loadABI(path, contract)
+	if err != nil {
+		return err
+	}
+	m, err := resolveMethod(&c.ABI, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if m.IsConstant() {
+		return fmt.Errorf("%s is a view function; a keeper sends transactions", m.Sig)
+	}
+	if err := checkPayable(m.Sig, m, txo); err != nil {
+		return err
+	}
+	raw, err := rawArgs(fs.Args()[2:], *argsJSON)
+	if err != nil {
+		return err
+	}
+	callArgs, err := convertArgs(m.Inputs, raw)
+	if err != nil {
+		return fmt.Errorf("%s: %w", m.Sig, err)
+	}
+	var cond *abi.Method
+	if *when != "" {
+		if cond, err = resolveMethod(&c.ABI, *when); err != nil {
+			return fmt.Errorf("--when: %w", err)
+		}
+		if len(cond.Inputs) != 0 || len(cond.Outputs) != 1 || cond.Outputs[0].Type.T != abi.BoolTy {
+			return fmt.Errorf("--when: %s must take no arguments and return a single bool", cond.Sig)
+		}
+	}
+
+	s, err := openSession(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if !s.yes && s.chainID.Uint64() != localChainID {
+		return errors.New("keeper signs every run unattended; pass --yes to allow it")
+	}
+	k := &keeper{
+		s: s, abi: &c.ABI, address: address, m: m, args: callArgs, when: cond, txo: txo,
+		bound:    bind.NewBoundContract(address, c.ABI, s.client, s.client, s.client),
+		interval: *interval, maxFails: *maxFails,
+	}
+	k.registerMetrics()
+	stop, err := mo.serve(s.client)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	return k.run(ctx)
+}
+
+// run executes the call now and then every k.interval until ctx is done
+// or the circuit breaker trips. metricsSignal prints the counters at any
+// time; they are printed again, and reported, on the way out.
+func (k *keeper) run(ctx context.Context) error {
+	if metricsSignal != nil {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, metricsSignal)
+		defer signal.Stop(sigs)
+		go func() {
+			for range sigs {
+				k.printMetrics()
+			}
+		}()
+	}
+	defer func() {
+		r := k.snapshot()
+		k.s.ui.report.Keeper = &r
+		k.printMetrics()
+	}()
+
+	k.s.ui.Printf("Keeper: %s on %s every %s\n", k.m.Sig, k.s.names.label(k.address), k.interval)
+	for {
+		err := k.execute(ctx)
+		if ctx.Err() != nil {
+			if err != nil {
+				k.s.ui.Warnf("warning: last run: %v\n", err)
+			}
+			k.s.ui.Println("Keeper stopped")
+			return nil
+		}
+		if fails := k.record(err); k.maxFails > 0 && fails >= k.maxFails {
+			return fmt.Errorf("keeper: %d runs in a row failed, the last with: %w", fails, err)
+		}
+		select {
+		case <-ctx.Done():
+			k.s.ui.Println("Keeper stopped")
+			return nil
+		case <-time.After(k.interval):
+		}
+	}
+}
+
+// execute is one run: check the condition, send the call and wait for it
+// to be mined. Once sent, the transaction is waited for even if ctx is
+// cancelled, so a shutdown never abandons it.
+func (k *keeper) execute(ctx context.Context) error {
+	s := k.s
+	k.mu.Lock()
+	k.metrics.Runs++
+	k.metrics.LastRun = time.Now().UTC().Format(time.RFC3339)
+	run := k.metrics.Runs
+	k.mu.Unlock()
+	k.s.ui.Printf("Run %d at %s\n", run, time.Now().Format(time.TimeOnly))
+
+	if k.when != nil {
+		ok, err := k.condition(ctx)
+		if err != nil {
+			return fmt.Errorf("--when %s: %w", k.when.Sig, err)
+		}
+		if !ok {
+			k.s.ui.Printf("  %s is false; not sending\n", k.when.Sig)
+			k.mu.Lock()
+			k.metrics.Skipped++
+			k.mu.Unlock()
+			return nil
+		}
+	}
+
+	tx, err := s.transact(ctx, k.bound, k.abi, k.m, k.args, k.txo)
+	if err != nil {
+		s.nonces.Reset(s.from)
+		return err
+	}
+	k.mu.Lock()
+	k.metrics.Executions++
+	hash := tx.Hash()
+	k.metrics.LastTx = &hash
+	k.mu.Unlock()
+
+	stop := context.AfterFunc(ctx, func() {
+		k.s.ui.Printf("  waiting for %s before stopping\n", tx.Hash().Hex())
+	})
+	defer stop()
+	rcpt, err := s.waitReceipt(context.WithoutCancel(ctx), tx, k.abi)
+	if rcpt != nil {
+		k.mu.Lock()
+		k.metrics.GasUsed += rcpt.GasUsed
+		if err == nil {
+			k.metrics.Succeeded++
+		}
+		k.mu.Unlock()
+		k.s.ui.report.Transactions = append(k.s.ui.report.Transactions, *newTxReport(k.m.Sig, rcpt, printEvents(k.s.ui, rcpt, k.abi)))
+	}
+	if err != nil {
+		s.nonces.Reset(s.from)
+	}
+	return err
+}
+
+// condition calls the --when function.
+func (k *keeper) condition(ctx context.Context) (bool, error) {
+	data, err := k.abi.Pack(k.when.Name)
+	if err != nil {
+		return false, err
+	}
+	ret, err := k.s.client.CallContract(ctx, ethereum.CallMsg{From: k.s.from, To: &k.address, Data: data}, nil)
+	if err != nil {
+		return false, explainError(err, k.abi)
+	}
+	out, err := k.abi.Unpack(k.when.Name, ret)
+	if err != nil {
+		return false, fmt.Errorf("decode: %w", err)
+	}
+	return out[0].(bool), nil
+}
+
+// record counts a run's failure, or ends a streak of them, and returns
+// how many runs in a row have failed.
+func (k *keeper) record(err error) int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err == nil {
+		k.metrics.ConsecutiveFailures = 0
+		return 0
+	}
+	k.metrics.Failed++
+	k.metrics.ConsecutiveFailures++
+	k.metrics.LastError = err.Error()
+	k.s.ui.Warnf("warning: run %d failed (%d in a row): %v\n", k.metrics.Runs, k.metrics.ConsecutiveFailures, err)
+	return k.metrics.ConsecutiveFailures
+}
+
+func (k *keeper) snapshot() KeeperReport {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.metrics
+}
+
+func (k *keeper) printMetrics() {
+	r := k.snapshot()
+	k.s.ui.Printf("Keeper metrics: %d runs, %d skipped, %d sent, %d succeeded, %d failed (%d in a row), gas used %d\n",
+		r.Runs, r.Skipped, r.Executions, r.Succeeded, r.Failed, r.ConsecutiveFailures, r.GasUsed)
+	if r.LastError != "" {
+		k.s.ui.Printf("  last error: %s\n", r.LastError)
+	}
+}
+
+// registerMetrics adds the keeper's counters to the session's metrics,
+// for --metrics-addr.
+func (k *keeper) registerMetrics() {
+	for _, c := range []struct {
+		name, help string
+		gauge      bool
+		value      func(KeeperReport) uint64
+	}{
+		{"runs_total", "Scheduled keeper runs.", false, func(m KeeperReport) uint64 { return m.Runs }},
+		{"skipped_total", "Runs skipped because the --when condition was false.", false, func(m KeeperReport) uint64 { return m.Skipped }},
+		{"executions_total", "Transactions sent.", false, func(m KeeperReport) uint64 { return m.Executions }},
+		{"succeeded_total", "Transactions mined successfully.", false, func(m KeeperReport) uint64 { return m.Succeeded }},
+		{"failures_total", "Failed runs.", false, func(m KeeperReport) uint64 { return m.Failed }},
+		{"consecutive_failures", "Runs in a row that failed.", true, func(m KeeperReport) uint64 { return uint64(m.ConsecutiveFailures) }},
+		{"gas_used_total", "Gas used by mined transactions.", false, func(m KeeperReport) uint64 { return m.GasUsed }},
+	} {
+		value := func() float64 { return float64(c.value(k.snapshot())) }
+		if c.gauge {
+			k.s.metrics.register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Namespace: "nyc2025", Name: "keeper_" + c.name, Help: c.help}, value))
+		} else {
+			k.s.metrics.register(prometheus.NewCounterFunc(prometheus.CounterOpts{Namespace: "nyc2025", Name: "keeper_" + c.name, Help: c.help}, value))
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package deployer
+
+import "os"
+
+// metricsSignal is unset where there is no SIGUSR1; use --metrics-addr.
+var metricsSignal os.Signal
@@ -0,0 +1,11 @@
+//go:build unix
+
+package deployer
+
+import (
+	"os"
+	"syscall"
+)
+
+// metricsSignal makes a running keeper print its metrics.
+var metricsSignal os.Signal = syscall.SIGUSR1
@@ -0,0 +1,154 @@
+package deployer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/ethereum/go-ethereum/console/prompt"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// maxAgeWorkFactor caps the scrypt work factor (log2 N) of an age file;
+// age itself writes 18 by default.
+const maxAgeWorkFactor = 22
+
+// ageHeader starts every binary age file.
+const ageHeader = "age-encryption.org/v1"
+
+// maxKeyFileSize caps what a sealed key file decrypts to: a key, padded
+// with whitespace at most.
+const maxKeyFileSize = 1 << 20
+
+// zero overwrites key material once it is parsed. Go may have copied it
+// elsewhere already, but the buffers this package owns are cleared.
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// parseHexKey parses a hex private key, with or without 0x and
+// surrounding whitespace, zeroing raw and the decoded bytes.
+func parseHexKey(raw []byte) (*ecdsa.PrivateKey, error) {
+	defer zero(raw)
+	text := bytes.TrimSpace(raw)
+	text = bytes.TrimPrefix(bytes.TrimPrefix(text, []byte("0x")), []byte("0X"))
+	buf := make([]byte, hex.DecodedLen(len(text)))
+	defer zero(buf)
+	if _, err := hex.Decode(buf, text); err != nil {
+		return nil, errors.New("not a hex private key")
+	}
+	return crypto.ToECDSA(buf)
+}
+
+// readKeyStdin reads a hex private key from stdin, as piped from a
+// secrets manager.
+func readKeyStdin() (*Signer, error) {
+	if isTerminal(os.Stdin) {
+		return nil, errors.New("--key-stdin: stdin is a terminal; pipe the key in")
+	}
+	raw, err := io.ReadAll(io.LimitReader(os.Stdin, 4096))
+	if err != nil {
+		return nil, fmt.Errorf("--key-stdin: %w", err)
+	}
+	key, err := parseHexKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("--key-stdin: %w", err)
+	}
+	return newKeySigner(key, "stdin"), nil
+}
+
+// loadKeyFile reads --key-file: a hex private key, or one sealed with
+// `age -p` (binary or armored), decrypted with a passphrase read at the
+// terminal.
+func loadKeyFile(path string) (*Signer, error) {
+	return openKeyFile(path, askPassphrase)
+}
+
+// askPassphrase prompts at the terminal for the passphrase of path.
+func askPassphrase(path string) ([]byte, error) {
+	if !isTerminal(os.Stdin) {
+		return nil, fmt.Errorf("key file %s is encrypted and stdin is not a terminal to ask for its passphrase", path)
+	}
+	pass, err := prompt.Stdin.PromptPassword(fmt.Sprintf("Passphrase for %s: ", path))
+	if err != nil {
+		return nil, fmt.Errorf("read passphrase: %w", err)
+	}
+	return []byte(pass), nil
+}
+
+// openKeyFile is loadKeyFile with the passphrase of a sealed file from
+// passphrase.
+func openKeyFile(path string, passphrase func(path string) ([]byte, error)) (*Signer, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("--key-file: %w", err)
+	}
+	defer zero(raw)
+	var sealed io.Reader
+	switch text := bytes.TrimSpace(raw); {
+	case bytes.HasPrefix(text, []byte(armor.Header)):
+		sealed = armor.NewReader(bytes.NewReader(text))
+	case bytes.HasPrefix(raw, []byte(ageHeader+"\n")):
+		sealed = bytes.NewReader(raw)
+	default:
+		key, err := parseHexKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("key file %s: %w", path, err)
+		}
+		return newKeySigner(key, "key file "+path), nil
+	}
+
+	pass, err := passphrase(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(pass)
+	plain, err := ageDecrypt(sealed, pass)
+	if err != nil {
+		return nil, fmt.Errorf("key file %s: %w", path, err)
+	}
+	key, err := parseHexKey(plain)
+	if err != nil {
+		return nil, fmt.Errorf("key file %s: decrypted, but %w", path, err)
+	}
+	return newKeySigner(key, "sealed key file "+path), nil
+}
+
+// ageDecrypt opens an age file encrypted to a passphrase, as written by
+// `age -p`, refusing work factors over maxAgeWorkFactor.
+func ageDecrypt(file io.Reader, passphrase []byte) ([]byte, error) {
+	id, err := age.NewScryptIdentity(string(passphrase))
+	if err != nil {
+		return nil, err
+	}
+	id.SetMaxWorkFactor(maxAgeWorkFactor)
+	r, err := age.Decrypt(file, id)
+	var noMatch *age.NoIdentityMatchError
+	switch {
+	case errors.As(err, &noMatch) && !slices.Contains(noMatch.StanzaTypes, "scrypt"):
+		return nil, errors.New("not sealed with a passphrase (want `age -p`)")
+	case errors.As(err, &noMatch):
+		return nil, errors.New("wrong passphrase")
+	case err != nil:
+		return nil, err
+	}
+	plain, err := io.ReadAll(io.LimitReader(r, maxKeyFileSize+1))
+	if err != nil {
+		zero(plain)
+		return nil, fmt.Errorf("payload does not decrypt; the file is corrupted: %w", err)
+	}
+	if len(plain) > maxKeyFileSize {
+		zero(plain)
+		return nil, errors.New("payload too large for a key")
+	}
+	return plain, nil
+}
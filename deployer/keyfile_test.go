@@ -0,0 +1,258 @@
+package deployer
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// The files in testdata/keys seal testKey with `age -p`-style scrypt
+// recipients (work factor 10, to keep the tests fast) under
+// keyPassphrase: key.age is binary, key.age.asc armored, and large.age
+// pads the key with newlines to over 4 KiB, past one bufio buffer.
+// key.hex is the key in the clear.
+const keyPassphrase = "correct horse battery staple"
+
+func passphrase(pass string) func(string) ([]byte, error) {
+	return func(string) ([]byte, error) { return []byte(pass), nil }
+}
+
+func TestOpenKeyFile(t *testing.T) {
+	for _, name := range []string{"key.age", "key.age.asc", "large.age", "key.hex"} {
+		path := filepath.Join("testdata", "keys", name)
+		s, err := openKeyFile(path, passphrase(keyPassphrase))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if s.Address != testAddr {
+			t.Errorf("%s: address %s, want %s", name, s.Address.Hex(), testAddr.Hex())
+		}
+		want := "sealed key file " + path
+		if name == "key.hex" {
+			want = "key file " + path
+		}
+		if s.Source != want {
+			t.Errorf("%s: source %q, want %q", name, s.Source, want)
+		}
+	}
+	if fi, err := os.Stat(filepath.Join("testdata", "keys", "large.age")); err != nil || fi.Size() <= 4096 {
+		t.Fatalf("large.age is %v bytes (%v), want over 4 KiB", fi.Size(), err)
+	}
+}
+
+func TestOpenKeyFileErrors(t *testing.T) {
+	read := func(name string) []byte {
+		b, err := os.ReadFile(filepath.Join("testdata", "keys", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	sealed := read("key.age")
+	// The first header line is 22 bytes; byte 40 is in the salt.
+	corrupt := append([]byte(nil), sealed...)
+	corrupt[40] ^= 1
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+	x25519, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		name string
+		file []byte
+		pass string
+		want string
+	}{
+		{"wrong passphrase", sealed, "hunter2", "wrong passphrase"},
+		{"truncated header", sealed[:60], keyPassphrase, "failed to read header"},
+		{"corrupt salt", corrupt, keyPassphrase, "wrong passphrase"},
+		{"tampered payload", tampered, keyPassphrase, "payload does not decrypt"},
+		{"not a key", []byte("not hex\n"), keyPassphrase, "not a hex private key"},
+		{"X25519 recipient", seal(t, x25519.Recipient(), []byte(testKey), false), keyPassphrase, "not sealed with a passphrase"},
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "-"))
+		if err := os.WriteFile(path, tt.file, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := openKeyFile(path, passphrase(tt.pass))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	// A sealed file with stdin redirected has no way to ask.
+	withStdin(t, "")
+	_, err = loadKeyFile(filepath.Join("testdata", "keys", "key.age"))
+	if err == nil || !strings.Contains(err.Error(), "stdin is not a terminal") {
+		t.Errorf("sealed key with no terminal: %v", err)
+	}
+}
+
+// seal encrypts plain to r the way age does, armored or not.
+func seal(t *testing.T, r age.Recipient, plain []byte, armored bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var out io.WriteCloser = nopCloser{&buf}
+	if armored {
+		out = armor.NewWriter(&buf)
+	}
+	w, err := age.Encrypt(out, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// TestOpenKeyFileChunks opens sealed files whose payload spans several of
+// age's 64 KiB chunks: the key padded with whitespace, binary and
+// armored, and one padded past what a key file may hold.
+func TestOpenKeyFileChunks(t *testing.T) {
+	r, err := age.NewScryptRecipient(keyPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetWorkFactor(10)
+	padded := append([]byte(testKey+"\n"), bytes.Repeat([]byte("\n"), 200<<10)...)
+	dir := t.TempDir()
+	for _, armored := range []bool{false, true} {
+		path := filepath.Join(dir, "padded.age")
+		if err := os.WriteFile(path, seal(t, r, padded, armored), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		s, err := openKeyFile(path, passphrase(keyPassphrase))
+		if err != nil || s.Address != testAddr {
+			t.Fatalf("armored %v: %v, want %s", armored, err, testAddr.Hex())
+		}
+	}
+
+	path := filepath.Join(dir, "huge.age")
+	huge := append([]byte(testKey), bytes.Repeat([]byte(" "), maxKeyFileSize)...)
+	if err := os.WriteFile(path, seal(t, r, huge, false), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openKeyFile(path, passphrase(keyPassphrase)); err == nil || !strings.Contains(err.Error(), "payload too large for a key") {
+		t.Fatalf("key padded past %d bytes: %v", maxKeyFileSize, err)
+	}
+}
+
+// withStdin points os.Stdin at a file holding content until the test
+// ends.
+func withStdin(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stdin")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = f
+	t.Cleanup(func() { os.Stdin = stdin; f.Close() })
+}
+
+func TestKeyStdin(t *testing.T) {
+	withStdin(t, "  "+testKey[2:]+"\n")
+	s, err := LoadSigner(KeyOptions{Signer: "local", KeyStdin: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Address != testAddr || s.Source != "stdin" {
+		t.Fatalf("signer %s from %q, want %s from stdin", s.Address.Hex(), s.Source, testAddr.Hex())
+	}
+
+	withStdin(t, "0xnot-a-key")
+	if _, err := LoadSigner(KeyOptions{KeyStdin: true}); err == nil || !strings.Contains(err.Error(), "--key-stdin: not a hex private key") {
+		t.Fatalf("garbage on stdin: %v", err)
+	}
+	if _, err := LoadSigner(KeyOptions{KeyStdin: true, KeyFile: "key"}); err == nil {
+		t.Fatal("--key-stdin with --key-file was accepted")
+	}
+}
+
+// TestKeystore loads a keystore sealed with light scrypt parameters
+// through the profile's keystore path.
+func TestKeystore(t *testing.T) {
+	for _, k := range []string{"PRIVATE_KEY", "MNEMONIC", "KEYSTORE_PATH"} {
+		t.Setenv(k, "")
+	}
+	key, err := crypto.HexToECDSA(testKey[2:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := keystore.EncryptKey(&keystore.Key{Address: testAddr, PrivateKey: key}, "s3cret", keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "UTC--test")
+	if err := os.WriteFile(path, sealed, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("KEYSTORE_PASSWORD", "s3cret")
+	s, err := LoadSigner(KeyOptions{Keystore: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Address != testAddr || s.Source != "keystore "+path {
+		t.Fatalf("signer %s from %q, want %s from the keystore", s.Address.Hex(), s.Source, testAddr.Hex())
+	}
+
+	t.Setenv("KEYSTORE_PASSWORD", "hunter2")
+	if _, err := LoadSigner(KeyOptions{Keystore: path}); err == nil || err.Error() != "keystore "+path+": wrong passphrase" {
+		t.Fatalf("wrong passphrase: %v", err)
+	}
+}
+
+func TestRequireSecureKey(t *testing.T) {
+	for _, k := range []string{"PRIVATE_KEY", "MNEMONIC", "KEYSTORE_PATH"} {
+		t.Setenv(k, "")
+	}
+	mnemonic := "test test test test test test test test test test test junk"
+	hexFile := filepath.Join("testdata", "keys", "key.hex")
+
+	t.Setenv("PRIVATE_KEY", testKey)
+	if _, err := LoadSigner(KeyOptions{RequireSecureKey: true}); err == nil || !strings.Contains(err.Error(), "refusing PRIVATE_KEY from the environment") {
+		t.Errorf("PRIVATE_KEY with --require-secure-key: %v", err)
+	}
+	if s, err := LoadSigner(KeyOptions{}); err != nil || s.Address != testAddr || !s.RawEnv {
+		t.Errorf("PRIVATE_KEY without --require-secure-key: %v", err)
+	}
+	if s, err := LoadSigner(KeyOptions{RequireSecureKey: true, KeyFile: hexFile}); err != nil || s.Address != testAddr {
+		t.Errorf("--key-file with --require-secure-key and PRIVATE_KEY set: %v", err)
+	}
+
+	t.Setenv("PRIVATE_KEY", "")
+	if _, err := LoadSigner(KeyOptions{RequireSecureKey: true, Mnemonic: mnemonic}); err == nil || !strings.Contains(err.Error(), "refusing MNEMONIC from the profile") {
+		t.Errorf("profile mnemonic with --require-secure-key: %v", err)
+	}
+	if _, err := LoadSigner(KeyOptions{RequireSecureKey: true, PrivateKey: testKey}); err == nil || !strings.Contains(err.Error(), "refusing PRIVATE_KEY from the profile") {
+		t.Errorf("profile private_key with --require-secure-key: %v", err)
+	}
+}
@@ -0,0 +1,418 @@
+package deployer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// kmsClient is the part of the AWS KMS API signing needs. GetPublicKey
+// returns the DER SubjectPublicKeyInfo, Sign the DER ECDSA signature of
+// a digest.
+type kmsClient interface {
+	GetPublicKey(ctx context.Context, keyID string) ([]byte, error)
+	Sign(ctx context.Context, keyID string, digest []byte) ([]byte, error)
+}
+
+// kmsSigner signs with a secp256k1 (ECC_SECG_P256K1) key held in KMS.
+type kmsSigner struct {
+	client kmsClient
+	keyID  string
+	pub    []byte // uncompressed public key, 65 bytes
+}
+
+// secp256k1HalfN is half the curve order: signatures with a larger s are
+// malleable and rejected by Ethereum.
+var secp256k1HalfN = new(big.Int).Rsh(crypto.S256().Params().N, 1)
+
+// dialKMS loads the public key of KMS key keyID and derives its address.
+func dialKMS(keyID string) (*Signer, error) {
+	if keyID == "" {
+		return nil, errors.New("--signer kms needs --kms-key-id")
+	}
+	client, err := newAWSKMS(keyID)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newKMSSigner(client, keyID)
+	if err != nil {
+		return nil, err
+	}
+	s.Source += ", credentials from " + client.creds.source
+	return s, nil
+}
+
+func newKMSSigner(client kmsClient, keyID string) (*Signer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	der, err := client.GetPublicKey(ctx, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("kms key %s: get public key: %w", keyID, err)
+	}
+	pub, err := parseKMSPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("kms key %s: %w", keyID, err)
+	}
+	k := &kmsSigner{client: client, keyID: keyID, pub: pub}
+	address := common.BytesToAddress(crypto.Keccak256(pub[1:])[12:])
+	return &Signer{Address: address, Source: "AWS KMS " + keyID, kms: k}, nil
+}
+
+// oidSecp256k1 is the named curve of ECC_SECG_P256K1 keys.
+var oidSecp256k1 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+
+// parseKMSPublicKey extracts the uncompressed point from the DER
+// SubjectPublicKeyInfo KMS returns. crypto/x509 does not know secp256k1,
+// hence the hand parsing.
+func parseKMSPublicKey(der []byte) ([]byte, error) {
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("parse public key: %w", err)
+	}
+	var curve asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &curve); err != nil || !curve.Equal(oidSecp256k1) {
+		return nil, errors.New("not a secp256k1 key; create it with key spec ECC_SECG_P256K1")
+	}
+	pub := info.PublicKey.Bytes
+	if _, err := crypto.UnmarshalPubkey(pub); err != nil {
+		return nil, fmt.Errorf("parse public key: %w", err)
+	}
+	return pub, nil
+}
+
+// signDigest signs a 32-byte digest in KMS, returning the 65-byte
+// [R || S || V] signature with s in the lower half of the curve order
+// and V, 0 or 1, found by recovering the key.
+func (k *kmsSigner) signDigest(digest []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	der, err := k.client.Sign(ctx, k.keyID, digest)
+	if err != nil {
+		return nil, fmt.Errorf("kms key %s: sign: %w", k.keyID, err)
+	}
+	var rs struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &rs); err != nil {
+		return nil, fmt.Errorf("kms key %s: parse signature: %w", k.keyID, err)
+	}
+	if rs.S.Cmp(secp256k1HalfN) > 0 {
+		rs.S.Sub(crypto.S256().Params().N, rs.S)
+	}
+	sig := make([]byte, 65)
+	rs.R.FillBytes(sig[:32])
+	rs.S.FillBytes(sig[32:64])
+	for v := byte(0); v < 2; v++ {
+		sig[64] = v
+		if pub, err := crypto.Ecrecover(digest, sig); err == nil && bytes.Equal(pub, k.pub) {
+			return sig, nil
+		}
+	}
+	return nil, fmt.Errorf("kms key %s: signature does not recover to the key's public key", k.keyID)
+}
+
+// transactOpts are transact opts for from that sign with the KMS key,
+// hashing each transaction for its type on chainID.
+func (k *kmsSigner) transactOpts(from common.Address, chainID *big.Int) *bind.TransactOpts {
+	signer := types.LatestSignerForChainID(chainID)
+	return &bind.TransactOpts{
+		From: from,
+		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if address != from {
+				return nil, bind.ErrNotAuthorized
+			}
+			sig, err := k.signDigest(signer.Hash(tx).Bytes())
+			if err != nil {
+				return nil, err
+			}
+			return tx.WithSignature(signer, sig)
+		},
+		Context: context.Background(),
+	}
+}
+
+// awsCredentials are the access keys KMS requests are signed with.
+type awsCredentials struct {
+	accessKey, secretKey, sessionToken string
+	source                             string
+}
+
+// awsKMS calls KMS's JSON API over HTTPS with SigV4-signed requests.
+type awsKMS struct {
+	region   string
+	endpoint string
+	creds    awsCredentials
+	http     *http.Client
+}
+
+// newAWSKMS finds the region the way the AWS SDKs do, from the key ARN,
+// AWS_REGION, AWS_DEFAULT_REGION or the shared config file, and static
+// keys from the environment or the shared credentials file of
+// AWS_PROFILE. The rest of the SDKs' credential chain (web identity, ECS
+// task roles, SSO, assumed roles, credential_process and instance
+// roles) is not implemented; see awsCredentialsFor. AWS_ENDPOINT_URL_KMS
+// or AWS_ENDPOINT_URL replaces the regional endpoint.
+func newAWSKMS(keyID string) (*awsKMS, error) {
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	region := ""
+	if parts := strings.Split(keyID, ":"); len(parts) >= 6 && parts[0] == "arn" && parts[2] == "kms" {
+		region = parts[3]
+	}
+	for _, v := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region == "" {
+			region = os.Getenv(v)
+		}
+	}
+	if region == "" {
+		section := "profile " + profile
+		if profile == "default" {
+			section = "default"
+		}
+		region = awsSharedFile("AWS_CONFIG_FILE", "config", section)["region"]
+	}
+	if region == "" {
+		return nil, errors.New("kms: no AWS region; use a key ARN or set AWS_REGION")
+	}
+	creds, err := awsCredentialsFor(profile)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := "https://kms." + region + ".amazonaws.com"
+	for _, v := range []string{"AWS_ENDPOINT_URL", "AWS_ENDPOINT_URL_KMS"} {
+		if e := os.Getenv(v); e != "" {
+			endpoint = strings.TrimRight(e, "/")
+		}
+	}
+	return &awsKMS{region: region, endpoint: endpoint, creds: creds, http: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+// awsExportHint is how to turn credentials the chain here cannot fetch
+// into ones it can.
+const awsExportHint = `export them first, e.g. eval "$(aws configure export-credentials --format env)"`
+
+// awsCredentialsFor reads AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or
+// else profile's keys in the shared credentials file. Where the SDKs
+// would fetch temporary credentials instead, it fails naming the source
+// rather than signing with stale static keys or none.
+func awsCredentialsFor(profile string) (awsCredentials, error) {
+	if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+		return awsCredentials{accessKey: id, secretKey: secret, sessionToken: os.Getenv("AWS_SESSION_TOKEN"), source: "environment"}, nil
+	}
+	if src := awsUnsupportedSource(profile); src != "" {
+		return awsCredentials{}, fmt.Errorf("kms: AWS credentials from %s are not supported; %s", src, awsExportHint)
+	}
+	keys := awsSharedFile("AWS_SHARED_CREDENTIALS_FILE", "credentials", profile)
+	if keys["aws_access_key_id"] != "" && keys["aws_secret_access_key"] != "" {
+		return awsCredentials{
+			accessKey:    keys["aws_access_key_id"],
+			secretKey:    keys["aws_secret_access_key"],
+			sessionToken: keys["aws_session_token"],
+			source:       "profile " + profile,
+		}, nil
+	}
+	return awsCredentials{}, fmt.Errorf("kms: no AWS credentials: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or add profile %s to ~/.aws/credentials (instance roles from IMDS are not supported; %s)", profile, awsExportHint)
+}
+
+// awsUnsupportedSource names the credential source the SDKs would use
+// for profile ahead of its static keys and that is not implemented here,
+// or returns "".
+func awsUnsupportedSource(profile string) string {
+	switch {
+	case os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") != "":
+		return "web identity (AWS_WEB_IDENTITY_TOKEN_FILE)"
+	case os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "" || os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "":
+		return "the ECS container endpoint (AWS_CONTAINER_CREDENTIALS_*)"
+	}
+	section := "profile " + profile
+	if profile == "default" {
+		section = "default"
+	}
+	config := awsSharedFile("AWS_CONFIG_FILE", "config", section)
+	for _, k := range []struct{ key, source string }{
+		{"sso_session", "SSO"},
+		{"sso_start_url", "SSO"},
+		{"web_identity_token_file", "web identity"},
+		{"role_arn", "an assumed role"},
+		{"credential_process", "credential_process"},
+	} {
+		if config[k.key] != "" {
+			return fmt.Sprintf("%s (%s in profile %s)", k.source, k.key, profile)
+		}
+	}
+	return ""
+}
+
+// awsSharedFile reads section of an INI file under ~/.aws, or the path in
+// env. A missing file reads as empty.
+func awsSharedFile(env, name, section string) map[string]string {
+	path := os.Getenv(env)
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		path = filepath.Join(home, ".aws", name)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	values := map[string]string{}
+	current := ""
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			current = strings.TrimSpace(line[1 : len(line)-1])
+		case current == section:
+			if k, v, ok := strings.Cut(line, "="); ok {
+				values[strings.TrimSpace(k)] = strings.TrimSpace(v)
+			}
+		}
+	}
+	return values
+}
+
+func (c *awsKMS) GetPublicKey(ctx context.Context, keyID string) ([]byte, error) {
+	var out struct {
+		PublicKey []byte
+		KeySpec   string
+	}
+	if err := c.call(ctx, "GetPublicKey", map[string]interface{}{"KeyId": keyID}, &out); err != nil {
+		return nil, err
+	}
+	if out.KeySpec != "" && out.KeySpec != "ECC_SECG_P256K1" {
+		return nil, fmt.Errorf("key spec is %s, not ECC_SECG_P256K1", out.KeySpec)
+	}
+	return out.PublicKey, nil
+}
+
+func (c *awsKMS) Sign(ctx context.Context, keyID string, digest []byte) ([]byte, error) {
+	var out struct{ Signature []byte }
+	in := map[string]interface{}{
+		"KeyId":            keyID,
+		"Message":          digest,
+		"MessageType":      "DIGEST",
+		"SigningAlgorithm": "ECDSA_SHA_256",
+	}
+	if err := c.call(ctx, "Sign", in, &out); err != nil {
+		return nil, err
+	}
+	return out.Signature, nil
+}
+
+// call sends one KMS action, signed with SigV4.
+func (c *awsKMS) call(ctx context.Context, action string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(c.endpoint)
+	if err != nil {
+		return fmt.Errorf("endpoint %s: %w", c.endpoint, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{
+		"content-type": "application/x-amz-json-1.1",
+		"host":         u.Host,
+		"x-amz-date":   time.Now().UTC().Format("20060102T150405Z"),
+		"x-amz-target": "TrentService." + action,
+	}
+	if c.creds.sessionToken != "" {
+		headers["x-amz-security-token"] = c.creds.sessionToken
+	}
+	for k, v := range headers {
+		if k != "host" {
+			req.Header.Set(k, v)
+		}
+	}
+	req.Header.Set("Authorization", c.creds.authorization(c.region, "kms", headers, body))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(raw, &e) == nil && e.Type != "" {
+			kind := e.Type[strings.LastIndex(e.Type, "#")+1:]
+			return fmt.Errorf("%s: %s", kind, e.Message)
+		}
+		return fmt.Errorf("HTTP %s: %s", resp.Status, bytes.TrimSpace(raw))
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// authorization is the SigV4 Authorization header of a POST to / with
+// headers, all of which are signed, and body.
+func (c awsCredentials) authorization(region, service string, headers map[string]string, body []byte) string {
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	canonical.WriteString("POST\n/\n\n")
+	for _, k := range names {
+		canonical.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signed := strings.Join(names, ";")
+	bodyHash := sha256.Sum256(body)
+	canonical.WriteString("\n" + signed + "\n" + hex.EncodeToString(bodyHash[:]))
+
+	amzDate := headers["x-amz-date"]
+	scope := amzDate[:8] + "/" + region + "/" + service + "/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonical.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	mac := func(key []byte, data string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	key := mac([]byte("AWS4"+c.secretKey), amzDate[:8])
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = mac(key, part)
+	}
+	return fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%x", c.accessKey, scope, signed, mac(key, toSign))
+}
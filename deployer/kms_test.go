@@ -0,0 +1,282 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// KMS answers for testKey: its public key as the DER SubjectPublicKeyInfo
+// GetPublicKey returns, and two DER signatures of kmsDigest, keccak256
+// of "kms", as Sign may return them: with s in the lower half of the
+// curve order and with n - s. Both must give kmsSig.
+const (
+	kmsPublicKey = "0x3056301006072a8648ce3d020106052b8104000a034200048318535b54105d4a7aae60c08fc45f9687181b4fdfc625bd1a753fa7397fed753547f11ca8696646f2f3acb08e31016afac23e630c5d11f59f61fef57b0d2aa5"
+	kmsDigest    = "0xc81e00d4766226306ec76a9b65d59c1f84581dfbdd9613af7d1890187fbd4fb7"
+	kmsLowS      = "0x3045022100902d9021084d3eefcd91ff173730f39f935300e974d572084767641255308f7a02204fdcf10137a6700ed8b219c4dedcbc31684ac7d56f312e2ca80e661e383df1b7"
+	kmsHighS     = "0x3046022100902d9021084d3eefcd91ff173730f39f935300e974d572084767641255308f7a022100b0230efec8598ff1274de63b212343cd526415114017720f17c3f86e97f84f8a"
+	kmsSig       = "0x902d9021084d3eefcd91ff173730f39f935300e974d572084767641255308f7a4fdcf10137a6700ed8b219c4dedcbc31684ac7d56f312e2ca80e661e383df1b701"
+)
+
+// fakeKMS serves a fixed public key and signs with sign.
+type fakeKMS struct {
+	pub     []byte
+	sign    func(digest []byte) ([]byte, error)
+	digests [][]byte
+}
+
+func (f *fakeKMS) GetPublicKey(ctx context.Context, keyID string) ([]byte, error) {
+	return f.pub, nil
+}
+
+func (f *fakeKMS) Sign(ctx context.Context, keyID string, digest []byte) ([]byte, error) {
+	f.digests = append(f.digests, digest)
+	return f.sign(digest)
+}
+
+func TestKMSSignDigest(t *testing.T) {
+	digest := hexutil.MustDecode(kmsDigest)
+	for _, tt := range []struct {
+		name string
+		der  string
+	}{
+		{"low s", kmsLowS},
+		{"high s", kmsHighS},
+	} {
+		fake := &fakeKMS{pub: hexutil.MustDecode(kmsPublicKey), sign: func([]byte) ([]byte, error) { return hexutil.MustDecode(tt.der), nil }}
+		s, err := newKMSSigner(fake, "alias/deployer")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Address != testAddr {
+			t.Fatalf("address %s, want %s", s.Address.Hex(), testAddr.Hex())
+		}
+		sig, err := s.kms.signDigest(digest)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := hexutil.Encode(sig); got != kmsSig {
+			t.Errorf("%s: signature %s, want %s", tt.name, got, kmsSig)
+		}
+	}
+}
+
+func TestKMSSignDigestErrors(t *testing.T) {
+	digest := hexutil.MustDecode(kmsDigest)
+	for _, tt := range []struct {
+		name string
+		sign func([]byte) ([]byte, error)
+		want string
+	}{
+		{"other digest", func([]byte) ([]byte, error) { return hexutil.MustDecode(kmsLowS), nil }, "does not recover"},
+		{"not DER", func([]byte) ([]byte, error) { return []byte{1, 2, 3}, nil }, "parse signature"},
+		{"KMS error", func([]byte) ([]byte, error) { return nil, errors.New("AccessDeniedException: no") }, "sign: AccessDeniedException"},
+	} {
+		fake := &fakeKMS{pub: hexutil.MustDecode(kmsPublicKey), sign: tt.sign}
+		s, err := newKMSSigner(fake, "alias/deployer")
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := digest
+		if tt.name == "other digest" {
+			d = crypto.Keccak256([]byte("other"))
+		}
+		if _, err := s.kms.signDigest(d); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// TestKMSTransactOpts signs a transaction through the KMS signer, with
+// a fake that signs with testKey and always returns the high-s form,
+// which KMS does for about half of all digests.
+func TestKMSTransactOpts(t *testing.T) {
+	key, err := crypto.HexToECDSA(testKey[2:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeKMS{pub: hexutil.MustDecode(kmsPublicKey), sign: func(digest []byte) ([]byte, error) {
+		sig, err := crypto.Sign(digest, key)
+		if err != nil {
+			return nil, err
+		}
+		return derSignature(new(big.Int).SetBytes(sig[:32]), new(big.Int).Sub(crypto.S256().Params().N, new(big.Int).SetBytes(sig[32:64])))
+	}}
+	s, err := newKMSSigner(fake, "alias/deployer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainID := big.NewInt(1337)
+	opts, err := s.TransactOpts(chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := opts.Signer(testAddr, types.NewTx(&types.DynamicFeeTx{ChainID: chainID, Nonce: 3, To: &testAddr, Gas: 21000, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(2)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := types.LatestSignerForChainID(chainID)
+	if from, err := types.Sender(signer, tx); err != nil || from != testAddr {
+		t.Fatalf("sender %s, %v; want %s", from.Hex(), err, testAddr.Hex())
+	}
+	if len(fake.digests) != 1 || !bytes.Equal(fake.digests[0], signer.Hash(tx).Bytes()) {
+		t.Fatalf("KMS signed %x, want the transaction hash %s", fake.digests, signer.Hash(tx).Hex())
+	}
+	if _, _, s := tx.RawSignatureValues(); s.Cmp(secp256k1HalfN) > 0 {
+		t.Fatalf("s = %s is in the upper half of the curve order", s)
+	}
+	if _, err := opts.Signer(otherAddr, tx); err == nil {
+		t.Fatal("signed for another address")
+	}
+}
+
+var otherAddr = crypto.PubkeyToAddress(ecdsa.PublicKey{Curve: crypto.S256(), X: big.NewInt(1), Y: big.NewInt(2)})
+
+func derSignature(r, s *big.Int) ([]byte, error) {
+	return asn1.Marshal(struct{ R, S *big.Int }{r, s})
+}
+
+func TestParseKMSPublicKeyRejectsP256(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseKMSPublicKey(der); err == nil || !strings.Contains(err.Error(), "ECC_SECG_P256K1") {
+		t.Fatalf("P-256 key: %v, want a key spec error", err)
+	}
+}
+
+// awsEnv clears the AWS settings and points the shared files at an
+// empty directory, returning it.
+func awsEnv(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, k := range []string{
+		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION",
+		"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI",
+		"AWS_ENDPOINT_URL", "AWS_ENDPOINT_URL_KMS",
+	} {
+		t.Setenv(k, "")
+	}
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	return dir
+}
+
+func TestAWSCredentials(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		env         map[string]string
+		config      string
+		credentials string
+		source      string // or the error it fails with
+	}{
+		{"environment", map[string]string{"AWS_ACCESS_KEY_ID": "AKID", "AWS_SECRET_ACCESS_KEY": "secret", "AWS_WEB_IDENTITY_TOKEN_FILE": "/token"}, "", "", "environment"},
+		{"credentials file", nil, "", "[default]\naws_access_key_id = AKID\naws_secret_access_key = secret\n", "profile default"},
+		{"named profile", map[string]string{"AWS_PROFILE": "deploy"}, "", "[default]\n[deploy]\naws_access_key_id=AKID\naws_secret_access_key=secret\n", "profile deploy"},
+		{"web identity", map[string]string{"AWS_WEB_IDENTITY_TOKEN_FILE": "/var/run/token", "AWS_ROLE_ARN": "arn:aws:iam::1:role/r"}, "", "", "web identity (AWS_WEB_IDENTITY_TOKEN_FILE) are not supported"},
+		{"ECS", map[string]string{"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI": "/v2/credentials/x"}, "", "", "the ECS container endpoint"},
+		{"SSO", map[string]string{"AWS_PROFILE": "sso"}, "[profile sso]\nsso_session = corp\nsso_account_id = 1\n", "", "SSO (sso_session in profile sso)"},
+		{"assumed role", nil, "[default]\nrole_arn = arn:aws:iam::1:role/r\nsource_profile = base\n", "[default]\naws_access_key_id = AKID\naws_secret_access_key = secret\n", "an assumed role (role_arn in profile default)"},
+		{"credential_process", nil, "[default]\ncredential_process = vault aws\n", "", "credential_process"},
+		{"IMDS", nil, "", "", "instance roles from IMDS are not supported"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := awsEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			for name, content := range map[string]string{"config": tt.config, "credentials": tt.credentials} {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			profile := os.Getenv("AWS_PROFILE")
+			if profile == "" {
+				profile = "default"
+			}
+			creds, err := awsCredentialsFor(profile)
+			switch {
+			case err != nil && !strings.Contains(err.Error(), tt.source):
+				t.Fatalf("error %v, want %q", err, tt.source)
+			case err != nil && !strings.Contains(err.Error(), "aws configure export-credentials"):
+				t.Fatalf("error %v does not say how to export the credentials", err)
+			case err == nil && (creds.source != tt.source || creds.accessKey != "AKID"):
+				t.Fatalf("credentials %q from %s, want AKID from %s", creds.accessKey, creds.source, tt.source)
+			}
+		})
+	}
+}
+
+// TestAWSKMSCall has the HTTP client talk to a fake KMS endpoint.
+func TestAWSKMSCall(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/eu-west-1/kms/aws4_request") {
+			t.Errorf("Authorization: %s", auth)
+		}
+		if r.Header.Get("X-Amz-Security-Token") != "token" {
+			t.Errorf("security token %q", r.Header.Get("X-Amz-Security-Token"))
+		}
+		var in map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&in)
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.GetPublicKey":
+			json.NewEncoder(w).Encode(map[string]interface{}{"KeyId": in["KeyId"], "KeySpec": "ECC_SECG_P256K1", "PublicKey": hexutil.MustDecode(kmsPublicKey)})
+		case "TrentService.Sign":
+			if in["MessageType"] != "DIGEST" || in["SigningAlgorithm"] != "ECDSA_SHA_256" {
+				t.Errorf("Sign request %v", in)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"Signature": hexutil.MustDecode(kmsHighS)})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"com.amazonaws.kms#UnsupportedOperationException","message":"no"}`))
+		}
+	}))
+	defer srv.Close()
+	awsEnv(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "token")
+	t.Setenv("AWS_ENDPOINT_URL_KMS", srv.URL)
+
+	s, err := dialKMS("arn:aws:kms:eu-west-1:111122223333:key/1234abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Address != testAddr || !strings.HasSuffix(s.Source, "credentials from environment") {
+		t.Fatalf("signer %s (%s)", s.Address.Hex(), s.Source)
+	}
+	sig, err := s.kms.signDigest(hexutil.MustDecode(kmsDigest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hexutil.Encode(sig) != kmsSig {
+		t.Fatalf("signature %x, want %s", sig, kmsSig)
+	}
+	var out struct{}
+	if err := s.kms.client.(*awsKMS).call(t.Context(), "Decrypt", map[string]string{}, &out); err == nil || err.Error() != "UnsupportedOperationException: no" {
+		t.Fatalf("KMS error: %v", err)
+	}
+}
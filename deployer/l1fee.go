@@ -0,0 +1,125 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// gasPriceOracle is the OP Stack predeploy that prices the L1 data fee:
+// what posting a transaction's bytes to L1 costs, charged on top of its
+// L2 gas.
+var gasPriceOracle = common.HexToAddress("0x420000000000000000000000000000000000000F")
+
+const gasPriceOracleABI = `[
+{"type":"function","name":"getL1Fee","stateMutability":"view","inputs":[{"name":"_data","type":"bytes"}],"outputs":[{"name":"","type":"uint256"}]}
+]`
+
+var parsedGasPriceOracle = func() abi.ABI {
+	a, err := abi.JSON(strings.NewReader(gasPriceOracleABI))
+	if err != nil {
+		panic(err)
+	}
+	return a
+}()
+
+// detectOPStack reports whether the chain charges an L1 data fee: it is
+// an OP Stack chain in the registry, or it has code at the GasPriceOracle
+// predeploy. A probe that fails counts as no.
+func detectOPStack(ctx context.Context, client *rpcClient, chainID *big.Int) bool {
+	if chains[chainID.Uint64()].opStack {
+		return true
+	}
+	code, err := client.CodeAt(ctx, gasPriceOracle, nil)
+	if err != nil {
+		client.ui.Verbosef("probe GasPriceOracle %s: %v; not pricing L1 data fees\n", gasPriceOracle.Hex(), err)
+		return false
+	}
+	return len(code) > 0
+}
+
+// unsignedTx is msg as opts would sign it at nonce, without a signature.
+func unsignedTx(chainID *big.Int, opts *bind.TransactOpts, msg ethereum.CallMsg, nonce uint64) *types.Transaction {
+	switch {
+	case opts.GasPrice == nil:
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:    chainID,
+			Nonce:      nonce,
+			GasTipCap:  opts.GasTipCap,
+			GasFeeCap:  opts.GasFeeCap,
+			Gas:        opts.GasLimit,
+			To:         msg.To,
+			Value:      opts.Value,
+			Data:       msg.Data,
+			AccessList: opts.AccessList,
+		})
+	case opts.AccessList != nil:
+		return types.NewTx(&types.AccessListTx{
+			ChainID:    chainID,
+			Nonce:      nonce,
+			GasPrice:   opts.GasPrice,
+			Gas:        opts.GasLimit,
+			To:         msg.To,
+			Value:      opts.Value,
+			Data:       msg.Data,
+			AccessList: opts.AccessList,
+		})
+	}
+	return types.NewTx(&types.LegacyTx{Nonce: nonce, GasPrice: opts.GasPrice, Gas: opts.GasLimit, To: msg.To, Value: opts.Value, Data: msg.Data})
+}
+
+// estimateL1Fee is the L1 data fee of msg sent with opts, from the
+// GasPriceOracle's getL1Fee of the serialized unsigned transaction. It is
+// nil off the OP Stack, and when the oracle cannot be read, which is
+// warned about rather than failing the send.
+func (s *session) estimateL1Fee(ctx context.Context, opts *bind.TransactOpts, msg ethereum.CallMsg) *big.Int {
+	if !s.opStack {
+		return nil
+	}
+	var nonce uint64
+	if opts.Nonce != nil {
+		nonce = opts.Nonce.Uint64()
+	} else if n, err := s.nonces.Peek(ctx, s.from); err == nil {
+		nonce = n
+	}
+	raw, err := unsignedTx(s.chainID, opts, msg, nonce).MarshalBinary()
+	if err != nil {
+		s.ui.Warnf("warning: L1 data fee: %v; costs leave it out\n", err)
+		return nil
+	}
+	bound := bind.NewBoundContract(gasPriceOracle, parsedGasPriceOracle, s.client, s.client, s.client)
+	var out []interface{}
+	if err := bound.Call(&bind.CallOpts{Context: ctx}, &out, "getL1Fee", raw); err != nil {
+		s.ui.Warnf("warning: L1 data fee: getL1Fee: %v; costs leave it out\n", err)
+		return nil
+	}
+	return out[0].(*big.Int)
+}
+
+// receiptL1Fee reads the l1Fee OP Stack nodes add to the receipt of hash;
+// go-ethereum's receipt type drops it.
+func (c *rpcClient) receiptL1Fee(ctx context.Context, hash common.Hash) (*big.Int, error) {
+	fee, err := pinned(ctx, c, "eth_getTransactionReceipt", func(ctx context.Context, cl *ethclient.Client) (*hexutil.Big, error) {
+		var r struct {
+			L1Fee *hexutil.Big `json:"l1Fee"`
+		}
+		err := cl.Client().CallContext(ctx, &r, "eth_getTransactionReceipt", hash)
+		return r.L1Fee, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if fee == nil {
+		return nil, errors.New("the receipt has no l1Fee")
+	}
+	return fee.ToInt(), nil
+}
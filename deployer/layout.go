@@ -0,0 +1,144 @@
+package deployer
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// storageLayout is solc's storageLayout output: the contract's state
+// variables in declaration order and the types they refer to.
+type storageLayout struct {
+	Storage []storageVar           `json:"storage"`
+	Types   map[string]storageType `json:"types"`
+}
+
+// storageVar is a state variable or struct member. Slot is a decimal
+// string, relative to the struct for members.
+type storageVar struct {
+	Label    string `json:"label"`
+	Contract string `json:"contract"`
+	Slot     string `json:"slot"`
+	Offset   int    `json:"offset"`
+	Type     string `json:"type"`
+}
+
+// storageType describes a type ID such as t_mapping(t_address,t_uint256).
+// IDs embed AST node IDs, which change between compilations, so types are
+// compared by their parts and labels.
+type storageType struct {
+	Encoding      string       `json:"encoding"`
+	Label         string       `json:"label"`
+	NumberOfBytes string       `json:"numberOfBytes"`
+	Key           string       `json:"key"`
+	Value         string       `json:"value"`
+	Base          string       `json:"base"`
+	Members       []storageVar `json:"members"`
+}
+
+// slots is how many slots v occupies.
+func (l *storageLayout) slots(v storageVar) *big.Int {
+	n, ok := new(big.Int).SetString(l.Types[v.Type].NumberOfBytes, 10)
+	if !ok || n.Sign() == 0 {
+		return big.NewInt(1)
+	}
+	n.Add(n, big.NewInt(int64(v.Offset)+31))
+	return n.Div(n, big.NewInt(32))
+}
+
+func slotOf(v storageVar) *big.Int {
+	n, ok := new(big.Int).SetString(v.Slot, 10)
+	if !ok {
+		return new(big.Int)
+	}
+	return n
+}
+
+// isGap reports whether v is an OpenZeppelin-style __gap reservation,
+// which later versions may shrink to make room for new variables.
+func isGap(v storageVar) bool {
+	return strings.HasPrefix(v.Label, "__gap")
+}
+
+// sameType reports whether type a of layout la and b of lb are stored
+// identically.
+func sameType(la, lb *storageLayout, a, b string) bool {
+	ta, tb := la.Types[a], lb.Types[b]
+	if ta.Label != tb.Label || ta.Encoding != tb.Encoding || ta.NumberOfBytes != tb.NumberOfBytes {
+		return false
+	}
+	for _, pair := range [][2]string{{ta.Key, tb.Key}, {ta.Value, tb.Value}, {ta.Base, tb.Base}} {
+		if (pair[0] == "") != (pair[1] == "") || (pair[0] != "" && !sameType(la, lb, pair[0], pair[1])) {
+			return false
+		}
+	}
+	if len(ta.Members) != len(tb.Members) {
+		return false
+	}
+	for i, m := range ta.Members {
+		n := tb.Members[i]
+		if m.Label != n.Label || m.Slot != n.Slot || m.Offset != n.Offset || !sameType(la, lb, m.Type, n.Type) {
+			return false
+		}
+	}
+	return true
+}
+
+// compareLayouts checks that next keeps every variable of prev where it
+// was, with the same type. It returns the incompatibilities, and notes on
+// changes that are safe but worth a look. New variables may follow the
+// old ones or take the place of a shrunk __gap.
+func compareLayouts(prev, next *storageLayout) (problems, notes []string) {
+	type position struct {
+		slot   string
+		offset int
+	}
+	at := make(map[position]storageVar)
+	byLabel := make(map[string]storageVar)
+	for _, v := range next.Storage {
+		at[position{slotOf(v).String(), v.Offset}] = v
+		byLabel[v.Label] = v
+	}
+	old := make(map[string]bool)
+	for _, v := range prev.Storage {
+		old[v.Label] = true
+	}
+
+	for _, v := range prev.Storage {
+		where := fmt.Sprintf("slot %s offset %d", slotOf(v), v.Offset)
+		oldType := prev.Types[v.Type].Label
+		if isGap(v) {
+			// Whatever now starts inside the gap must end inside it; old
+			// variables moved there are reported below.
+			start := slotOf(v)
+			end := new(big.Int).Add(start, prev.slots(v))
+			for _, n := range next.Storage {
+				s := slotOf(n)
+				if s.Cmp(start) < 0 || s.Cmp(end) >= 0 {
+					continue
+				}
+				switch {
+				case new(big.Int).Add(s, next.slots(n)).Cmp(end) > 0:
+					problems = append(problems, fmt.Sprintf("%s at slot %s overruns the %s it replaces (slots %s-%s)", n.Label, s, v.Label, start, new(big.Int).Sub(end, big.NewInt(1))))
+				case !old[n.Label] && !isGap(n):
+					notes = append(notes, fmt.Sprintf("%s (%s) added in %s at slot %s", n.Label, next.Types[n.Type].Label, v.Label, s))
+				}
+			}
+			continue
+		}
+		if m, ok := byLabel[v.Label]; ok && (slotOf(m).Cmp(slotOf(v)) != 0 || m.Offset != v.Offset) {
+			problems = append(problems, fmt.Sprintf("%s moved from %s to slot %s offset %d", v.Label, where, slotOf(m), m.Offset))
+			continue
+		}
+		n, ok := at[position{slotOf(v).String(), v.Offset}]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s (%s) at %s removed", v.Label, oldType, where))
+		case !sameType(prev, next, v.Type, n.Type):
+			problems = append(problems, fmt.Sprintf("%s at %s changed type from %s to %s", v.Label, where, oldType, next.Types[n.Type].Label))
+		case n.Label != v.Label:
+			notes = append(notes, fmt.Sprintf("%s at %s renamed to %s", v.Label, where, n.Label))
+		}
+	}
+	return problems, notes
+}
@@ -0,0 +1,133 @@
+package deployer
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// libraryRef is an external library creation code is linked against: its
+// name, the source file declaring it, and where its address goes.
+type libraryRef struct {
+	Name    string
+	Source  string
+	Offsets []byteRange
+	Address *common.Address // nil until linked
+}
+
+// libraries flattens the references, sorted by name.
+func (refs linkReferences) libraries() []libraryRef {
+	var libs []libraryRef
+	for source, byName := range refs {
+		for name, offsets := range byName {
+			libs = append(libs, libraryRef{Name: name, Source: source, Offsets: offsets})
+		}
+	}
+	sort.Slice(libs, func(i, j int) bool { return libs[i].Name < libs[j].Name })
+	return libs
+}
+
+// decodeCode hex-decodes an artifact's code object, zeroing the link
+// placeholders (__$...$__) at refs so that unlinked code still decodes.
+func decodeCode(object string, refs linkReferences) ([]byte, error) {
+	code := []byte(strings.TrimPrefix(object, "0x"))
+	for _, lib := range refs.libraries() {
+		for _, r := range lib.Offsets {
+			start, end := 2*r.Start, 2*(r.Start+r.Length)
+			if start < 0 || end > len(code) {
+				return nil, fmt.Errorf("link reference for %s at %d+%d is outside the code", lib.Name, r.Start, r.Length)
+			}
+			for i := start; i < end; i++ {
+				code[i] = '0'
+			}
+		}
+	}
+	return hex.DecodeString(string(code))
+}
+
+// linkOptions supply library addresses on the command line.
+type linkOptions struct {
+	libraries string
+}
+
+func (o *linkOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.libraries, "libraries", "", "library addresses to link, e.g. MathLib=0x...,src/Str.sol:StrLib=0x...")
+}
+
+// parseLibraries parses Name=0xaddr pairs; Name may be qualified with its
+// source file as path:Name.
+func parseLibraries(s string) (map[string]common.Address, error) {
+	libs := map[string]common.Address{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, addr, ok := strings.Cut(pair, "=")
+		if !ok || !common.IsHexAddress(addr) {
+			return nil, fmt.Errorf("--libraries: want Name=0xaddress, got %q", pair)
+		}
+		libs[strings.TrimSpace(name)] = common.HexToAddress(addr)
+	}
+	return libs, nil
+}
+
+// setLibrary writes addr into every placeholder of c's library lib.
+func (c *Artifact) setLibrary(lib int, addr common.Address) {
+	for _, r := range c.Libraries[lib].Offsets {
+		copy(c.Bytecode[r.Start:r.Start+r.Length], addr[:])
+	}
+	c.Libraries[lib].Address = &addr
+}
+
+// unlinked names the libraries that still have no address.
+func (c *Artifact) unlinked() []string {
+	var names []string
+	for _, lib := range c.Libraries {
+		if lib.Address == nil {
+			names = append(names, lib.Name)
+		}
+	}
+	return names
+}
+
+// checkLinked fails if c still has library placeholders.
+func (c *Artifact) checkLinked() error {
+	if missing := c.unlinked(); len(missing) > 0 {
+		return fmt.Errorf("%s needs unlinked libraries %s; pass --libraries Name=0x... or deploy them first", c.Name, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// linkLibraries links every library c needs, taking addresses from libs
+// (by name or source:name) and then from the latest deployment recorded
+// in the manifests. Libraries found in neither stay unlinked.
+func linkLibraries(c *Artifact, libs map[string]common.Address, dir string, chainID *big.Int) error {
+	for i, lib := range c.Libraries {
+		if lib.Address != nil {
+			continue
+		}
+		addr, ok := libs[lib.Source+":"+lib.Name]
+		if !ok {
+			addr, ok = libs[lib.Name]
+		}
+		if !ok {
+			m, err := readManifest(manifestPath(dir, chainID, lib.Name))
+			if err != nil {
+				return err
+			}
+			d := m.latest()
+			if d == nil {
+				continue
+			}
+			addr = d.Address
+		}
+		ui.Printf("Linking %s at %s\n", lib.Name, addr.Hex())
+		c.setLibrary(i, addr)
+	}
+	return nil
+}
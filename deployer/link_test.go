@@ -0,0 +1,59 @@
+package deployer
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// testdata/artifacts/linked.json is a Foundry artifact whose creation
+// code pushes two library addresses: MathLib's at byte 1 and StrLib's at
+// byte 23.
+func TestLinkLibraries(t *testing.T) {
+	const path = "testdata/artifacts/linked.json"
+	math := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	str := common.HexToAddress("0x2222222222222222222222222222222222222222")
+
+	c, err := LoadArtifact(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Libraries) != 2 || c.Libraries[0].Name != "MathLib" || c.Libraries[1].Source != "src/Str.sol" {
+		t.Fatalf("libraries = %+v, want MathLib and src/Str.sol:StrLib", c.Libraries)
+	}
+	if err := c.checkLinked(); err == nil || !strings.Contains(err.Error(), "needs unlinked libraries MathLib, StrLib") {
+		t.Fatalf("unlinked artifact: %v", err)
+	}
+
+	// One by name, one by source and name.
+	libs := map[string]common.Address{"MathLib": math, "src/Str.sol:StrLib": str}
+	if err := linkLibraries(c, libs, t.TempDir(), big.NewInt(1337)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.checkLinked(); err != nil {
+		t.Fatal(err)
+	}
+	want := append(append(append(append([]byte{0x73}, math[:]...), 0x50, 0x73), str[:]...), 0x50, 0x00)
+	if !bytes.Equal(c.Bytecode, want) {
+		t.Fatalf("linked bytecode = %x, want %x", c.Bytecode, want)
+	}
+
+	// A library in neither the flags nor the manifests stays unlinked,
+	// and the artifact cannot be deployed.
+	c, err = LoadArtifact(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := linkLibraries(c, map[string]common.Address{"MathLib": math}, t.TempDir(), big.NewInt(1337)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(c.Bytecode[1:21], math[:]) || !bytes.Equal(c.Bytecode[23:43], make([]byte, 20)) {
+		t.Fatalf("half-linked bytecode = %x", c.Bytecode)
+	}
+	if err := c.checkLinked(); err == nil || !strings.Contains(err.Error(), "needs unlinked libraries StrLib;") {
+		t.Fatalf("artifact missing StrLib: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package deployer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// lockOwner identifies the run holding a lock file. A lock file is
+// created exclusively and never rewritten: its holder touches it as a
+// heartbeat, and it changes hands only by being renamed aside (see
+// claimLock), which at most one run can do.
+type lockOwner struct {
+	PID      int       `json:"pid"`
+	Host     string    `json:"host"`
+	Acquired time.Time `json:"acquired"`
+	Token    string    `json:"token"`
+
+	heartbeat time.Time // the file's modification time
+}
+
+// newLockOwner returns an owner for this process, with a fresh token.
+func newLockOwner() lockOwner {
+	host, _ := os.Hostname()
+	token := make([]byte, 8)
+	rand.Read(token)
+	return lockOwner{PID: os.Getpid(), Host: host, Acquired: time.Now().UTC().Truncate(time.Second), Token: hex.EncodeToString(token)}
+}
+
+// stale says why o's lock may be taken over, or "" if it may not: its
+// process on this host is gone, or it has not touched the lock for
+// maxAge. Where processes cannot be checked only the age counts.
+func (o *lockOwner) stale(maxAge time.Duration) string {
+	host, _ := os.Hostname()
+	if canCheckProcess && o.Host == host && o.PID != os.Getpid() && !processAlive(o.PID) {
+		return fmt.Sprintf("process %d is not running", o.PID)
+	}
+	if age := time.Since(o.heartbeat); age > maxAge {
+		return fmt.Sprintf("no heartbeat for %s", age.Round(time.Second))
+	}
+	return ""
+}
+
+func (o *lockOwner) String() string {
+	return fmt.Sprintf("process %d on %s since %s (heartbeat %s ago)", o.PID, o.Host,
+		o.Acquired.Format(time.RFC3339), time.Since(o.heartbeat).Round(time.Second))
+}
+
+// readLockOwner reads the owner of the lock file at path. A lock being
+// written is empty for a moment; one that stays unreadable ages out by
+// its modification time like any other.
+func readLockOwner(path string) (*lockOwner, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	var o lockOwner
+	json.Unmarshal(raw, &o)
+	o.heartbeat = info.ModTime()
+	return &o, nil
+}
+
+// createLock writes v, which embeds its lockOwner, as the lock file path,
+// failing with os.ErrExist if it exists.
+func createLock(path string, v interface{}) error {
+	raw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(raw, '\n')); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// acquireLock creates the lock file path holding v, as createLock does.
+// While a live run holds it, wait is called with that run's owner, and
+// an error from wait ends the attempt as it is. A lock stale by maxAge
+// is claimed and removed with a warning through warnf; what names the
+// lock there and in errors.
+func acquireLock(path, what string, v interface{}, maxAge time.Duration, warnf func(string, ...interface{}), wait func(*lockOwner) error) error {
+	for {
+		err := createLock(path, v)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%s: %w", what, err)
+		}
+		other, err := readLockOwner(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", what, err)
+		}
+		if why := other.stale(maxAge); why != "" {
+			// Another waiter may have judged it stale too, and replaced
+			// it with its own since: claim only the lock judged.
+			took, err := claimLock(path, func(o *lockOwner) bool {
+				return o.Token == other.Token && o.stale(maxAge) != ""
+			})
+			if err != nil {
+				return fmt.Errorf("%s: %w", what, err)
+			}
+			if took {
+				warnf("warning: removed stale %s %s: %s\n", what, path, why)
+			}
+			continue
+		}
+		if err := wait(other); err != nil {
+			return err
+		}
+	}
+}
+
+// claimLock removes the lock file path if want accepts its owner, and
+// reports whether it did. The file is renamed aside first and its owner
+// read from there, so of several runs claiming the same lock only one
+// gets it; a lock want refuses is linked back in place.
+func claimLock(path string, want func(*lockOwner) bool) (bool, error) {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	aside := fmt.Sprintf("%s.%x", path, suffix)
+	if err := os.Rename(path, aside); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("claim %s: %w", path, err)
+	}
+	defer os.Remove(aside)
+	if o, err := readLockOwner(aside); err == nil && want(o) {
+		return true, nil
+	}
+	// Linking fails if a new lock was created meanwhile; that one stands.
+	if err := os.Link(aside, path); err != nil && !errors.Is(err, os.ErrExist) {
+		return false, fmt.Errorf("restore %s: %w", path, err)
+	}
+	return false, nil
+}
+
+// holdsLock reports whether the lock file path is still token's.
+func holdsLock(path, token string) bool {
+	o, err := readLockOwner(path)
+	return err == nil && o.Token == token
+}
+
+// releaseLock removes the lock file path if it is still token's.
+func releaseLock(path, token string) {
+	claimLock(path, func(o *lockOwner) bool { return o.Token == token })
+}
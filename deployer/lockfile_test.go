@@ -0,0 +1,47 @@
+package deployer
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestClaimLock plays out two runs judging one lock stale: the first
+// claims it and creates its own, and the second, claiming late, must not
+// remove the first's.
+func TestClaimLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "x.lock")
+	writeLock(t, path, lockOwner{PID: 1, Host: "ci-runner-7", Token: "stale"}, time.Now().Add(-time.Hour))
+	judged, err := readLockOwner(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := func(o *lockOwner) bool { return o.Token == judged.Token && o.stale(time.Minute) != "" }
+
+	if took, err := claimLock(path, stale); !took || err != nil {
+		t.Fatalf("first claim = %v, %v; want it taken", took, err)
+	}
+	first := newLockOwner()
+	if err := createLock(path, first); err != nil {
+		t.Fatal(err)
+	}
+	if took, err := claimLock(path, stale); took || err != nil {
+		t.Fatalf("late claim = %v, %v; want it refused", took, err)
+	}
+	if !holdsLock(path, first.Token) {
+		t.Fatal("the late claim removed the first run's lock")
+	}
+
+	// A fresh lock is not claimed either, even with a matching token.
+	if took, _ := claimLock(path, func(o *lockOwner) bool { return o.Token == first.Token && o.stale(time.Minute) != "" }); took || !holdsLock(path, first.Token) {
+		t.Fatal("claimed a live lock")
+	}
+	releaseLock(path, "someone else")
+	if !holdsLock(path, first.Token) {
+		t.Fatal("released a lock with another run's token")
+	}
+	releaseLock(path, first.Token)
+	if leftovers, _ := filepath.Glob(path + "*"); len(leftovers) != 0 {
+		t.Fatalf("files left after the release: %v", leftovers)
+	}
+}
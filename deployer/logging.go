@@ -0,0 +1,72 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// plainHandler writes each record's message as it is, the way the
+// progress output has always looked; attributes only show up with
+// --log-format json. Warnings and errors go to warn, the rest to w.
+type plainHandler struct {
+	w, warn io.Writer
+	level   slog.Leveler
+	mu      *sync.Mutex
+}
+
+func (h *plainHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *plainHandler) Handle(_ context.Context, r slog.Record) error {
+	w := h.w
+	if r.Level >= slog.LevelWarn {
+		w = h.warn
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(w, r.Message)
+	return err
+}
+
+func (h *plainHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *plainHandler) WithGroup(string) slog.Handler { return h }
+
+// fieldError attaches a structured field, such as the hash of the
+// transaction that failed, to an error so the final log record can
+// carry it.
+type fieldError struct {
+	err  error
+	attr slog.Attr
+}
+
+func (e *fieldError) Error() string { return e.err.Error() }
+
+func (e *fieldError) Unwrap() error { return e.err }
+
+// withField returns err with key set to value in its log record, or nil
+// when err is nil.
+func withField(err error, key string, value any) error {
+	if err == nil {
+		return nil
+	}
+	return &fieldError{err: err, attr: slog.Any(key, value)}
+}
+
+// errorAttrs collects the fields attached anywhere in err's chain, the
+// outermost first; a key already seen is not repeated.
+func errorAttrs(err error) []slog.Attr {
+	var attrs []slog.Attr
+	seen := map[string]bool{}
+	for ; err != nil; err = errors.Unwrap(err) {
+		if f, ok := err.(*fieldError); ok && !seen[f.attr.Key] {
+			seen[f.attr.Key] = true
+			attrs = append(attrs, f.attr)
+		}
+	}
+	return attrs
+}
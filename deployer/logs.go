@@ -0,0 +1,247 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// defaultLogChunk is the block range of each eth_getLogs call `logs`
+// starts with; it halves whenever the provider refuses a range.
+const defaultLogChunk = 10000
+
+// tooManyLogs reports whether err is a provider refusing a range as too
+// large or too full. There is no standard code, so match the messages of
+// the common providers.
+func tooManyLogs(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"too many", "more than", "limit exceeded", "range is too large", "block range", "response size"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// topicFilter parses a --topicN value: comma-separated hashes, any of
+// which matches.
+func topicFilter(s string) ([]common.Hash, error) {
+	var hashes []common.Hash
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		b := common.FromHex(v)
+		if !strings.HasPrefix(v, "0x") || len(b) > common.HashLength {
+			return nil, fmt.Errorf("invalid topic %q", v)
+		}
+		hashes = append(hashes, common.BytesToHash(b))
+	}
+	return hashes, nil
+}
+
+// argFilters builds topics 1-3 from name=value filters on e's indexed
+// parameters. Values are converted like call arguments.
+func argFilters(e *abi.Event, filters []string) ([][]common.Hash, error) {
+	var indexed abi.Arguments
+	for _, in := range e.Inputs {
+		if in.Indexed {
+			indexed = append(indexed, in)
+		}
+	}
+	topics := make([][]common.Hash, len(indexed))
+	for _, f := range filters {
+		name, value, ok := strings.Cut(f, "=")
+		if !ok {
+			return nil, fmt.Errorf("--filter: want name=value, got %q", f)
+		}
+		pos := -1
+		for i, in := range indexed {
+			if in.Name == name {
+				pos = i
+			}
+		}
+		if pos < 0 {
+			var names []string
+			for _, in := range indexed {
+				names = append(names, in.Name)
+			}
+			return nil, fmt.Errorf("--filter: %s has no indexed parameter %q; indexed: %s", e.Name, name, strings.Join(names, ", "))
+		}
+		v, err := convertValue(indexed[pos].Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("--filter %s: %w", name, err)
+		}
+		t, err := abi.MakeTopics([]interface{}{v.Interface()})
+		if err != nil {
+			return nil, fmt.Errorf("--filter %s: %w", name, err)
+		}
+		topics[pos] = append(topics[pos], t[0][0])
+	}
+	return topics, nil
+}
+
+// queryLogs walks [from, to] in chunks, handing each batch of logs to
+// emit as soon as it arrives. A refused chunk is retried at half the size.
+func queryLogs(ctx context.Context, client *rpcClient, q ethereum.FilterQuery, contractABI *abi.ABI, from, to, chunk uint64, emit func([]LogReport)) error {
+	for from <= to {
+		end := min(from+chunk-1, to)
+		q.FromBlock, q.ToBlock = new(big.Int).SetUint64(from), new(big.Int).SetUint64(end)
+		logs, err := client.FilterLogs(ctx, q)
+		if err != nil {
+			if tooManyLogs(err) && chunk > 1 {
+				chunk /= 2
+				client.ui.Verbosef("  blocks %d-%d refused (%v), retrying %d at a time\n", from, end, err, chunk)
+				continue
+			}
+			return fmt.Errorf("get logs %d-%d: %w", from, end, err)
+		}
+		batch := make([]LogReport, len(logs))
+		for i := range logs {
+			batch[i] = LogReport{Block: logs[i].BlockNumber, TxHash: logs[i].TxHash, decodedEvent: decodeLog(&logs[i], contractABI)}
+		}
+		emit(batch)
+		from = end + 1
+	}
+	return nil
+}
+
+// resolveEvent finds an event by name or by signature such as
+// Transfer(address,address,uint256).
+func resolveEvent(contractABI *abi.ABI, name string) (*abi.Event, error) {
+	sig := strings.ReplaceAll(name, " ", "")
+	for _, e := range contractABI.Events {
+		if e.Name == name || e.Sig == sig {
+			return &e, nil
+		}
+	}
+	var names []string
+	for _, e := range contractABI.Events {
+		names = append(names, e.Sig)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("no event %q; available: %s", name, strings.Join(names, ", "))
+}
+
+// runLogs implements `logs [flags] <address>`.
+func runLogs(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	var filters []string
+	o.register(fs)
+	ao.register(fs, "")
+	var abo abiOptions
+	abo.register(fs)
+	event := fs.String("event", "", "event name or signature (default every event)")
+	fromFlag := fs.String("from", "0", "first block to search")
+	toFlag := fs.String("to", "latest", "last block to search")
+	chunk := fs.Uint64("chunk", defaultLogChunk, "blocks per eth_getLogs request")
+	var topicFlags [3]*string
+	for i := range topicFlags {
+		topicFlags[i] = fs.String(fmt.Sprintf("topic%d", i+1), "", fmt.Sprintf("match topic %d (comma-separated hashes match any)", i+1))
+	}
+	fs.Func("filter", "match an indexed parameter, e.g. sender=0x...; repeatable", func(v string) error {
+		filters = append(filters, v)
+		return nil
+	})
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: logs [flags] <address>")
+	}
+	address, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *chunk == 0 {
+		return errors.New("--chunk must be positive")
+	}
+
+	client, chainID, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	c, err := abo.contractABI(ctx, ao, client, chainID, address)
+	if err != nil {
+		return err
+	}
+
+	q := ethereum.FilterQuery{Addresses: []common.Address{address}}
+	topics := make([][]common.Hash, 4)
+	if *event != "" {
+		e, err := resolveEvent(&c.ABI, *event)
+		if err != nil {
+			return err
+		}
+		topics[0] = []common.Hash{e.ID}
+		byArg, err := argFilters(e, filters)
+		if err != nil {
+			return err
+		}
+		copy(topics[1:], byArg)
+	} else if len(filters) > 0 {
+		return errors.New("--filter needs --event")
+	}
+	for i, t := range topicFlags {
+		if *t == "" {
+			continue
+		}
+		if topics[i+1] != nil {
+			return fmt.Errorf("--topic%d conflicts with a --filter on the same parameter", i+1)
+		}
+		if topics[i+1], err = topicFilter(*t); err != nil {
+			return fmt.Errorf("--topic%d: %w", i+1, err)
+		}
+	}
+	for len(topics) > 0 && topics[len(topics)-1] == nil {
+		topics = topics[:len(topics)-1]
+	}
+	q.Topics = topics
+
+	from, err := parseBlock(*fromFlag)
+	if err != nil {
+		return fmt.Errorf("--from: %w", err)
+	}
+	to, err := parseBlock(*toFlag)
+	if err != nil {
+		return fmt.Errorf("--to: %w", err)
+	}
+	head, err := client.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("block number: %w", err)
+	}
+	fromN, toN := head, head
+	if from != nil {
+		fromN = from.Uint64()
+	}
+	if to != nil {
+		toN = to.Uint64()
+	}
+	if fromN > toN {
+		return fmt.Errorf("--from %d is after --to %d", fromN, toN)
+	}
+
+	ui.Verbosef("Searching blocks %d-%d\n", fromN, toN)
+	found := 0
+	err = queryLogs(ctx, client, q, &c.ABI, fromN, toN, *chunk, func(batch []LogReport) {
+		for _, l := range batch {
+			ui.Resultf("block %d tx %s %s\n", l.Block, l.TxHash.Hex(), l.decodedEvent)
+		}
+		found += len(batch)
+		ui.report.Logs = append(ui.report.Logs, batch...)
+	})
+	if err != nil {
+		return err
+	}
+	ui.Printf("%d events\n", found)
+	return nil
+}
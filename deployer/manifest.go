@@ -0,0 +1,188 @@
+package deployer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Deployment is one recorded deployment of a contract.
+type Deployment struct {
+	Version         int            `json:"version"`
+	Address         common.Address `json:"address"`
+	Explorer        string         `json:"explorer,omitempty"`
+	Deployer        common.Address `json:"deployer"`
+	TxHash          common.Hash    `json:"txHash"`
+	BlockNumber     uint64         `json:"blockNumber"`
+	BlockHash       *common.Hash   `json:"blockHash,omitempty"`
+	Salt            *common.Hash   `json:"salt,omitempty"`
+	ConstructorArgs []interface{}  `json:"constructorArgs"`
+	ConstructorData string         `json:"constructorData"`
+	BytecodeHash    common.Hash    `json:"bytecodeHash"`
+	Artifact        string         `json:"artifact"`
+	Timestamp       time.Time      `json:"timestamp"`
+
+	// Proxy is set for a deployment behind a proxy: Address and TxHash
+	// are then the proxy's, and the constructor and bytecode fields
+	// describe the implementation.
+	Proxy *ProxyRecord `json:"proxy,omitempty"`
+}
+
+// ProxyRecord is the implementation half of a proxied deployment.
+// InitData is the initializer call, or for an upgrade the migration call,
+// run on the implementation (0x for none).
+type ProxyRecord struct {
+	Kind                   string          `json:"kind"`
+	Implementation         common.Address  `json:"implementation"`
+	ImplementationTxHash   common.Hash     `json:"implementationTxHash"`
+	Admin                  *common.Address `json:"admin,omitempty"`
+	InitData               string          `json:"initData"`
+	PreviousImplementation *common.Address `json:"previousImplementation,omitempty"`
+}
+
+// codeAddress is where the code the artifact describes lives: the
+// implementation for a proxied deployment.
+func (d *Deployment) codeAddress() common.Address {
+	if d.Proxy != nil {
+		return d.Proxy.Implementation
+	}
+	return d.Address
+}
+
+// manifest is the on-disk deployments/<chainid>/<contract>.json file. New
+// deployments are appended as new versions; the last entry is current.
+type manifest struct {
+	ChainID     uint64       `json:"chainId"`
+	Contract    string       `json:"contract"`
+	Deployments []Deployment `json:"deployments"`
+}
+
+func manifestPath(dir string, chainID *big.Int, contract string) string {
+	return filepath.Join(dir, chainID.String(), contract+".json")
+}
+
+// readManifest loads a manifest, returning an empty one if it does not exist.
+func readManifest(path string) (*manifest, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &manifest{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("parse manifest %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// latest returns the current deployment, or nil when none is recorded.
+func (m *manifest) latest() *Deployment {
+	if len(m.Deployments) == 0 {
+		return nil
+	}
+	return &m.Deployments[len(m.Deployments)-1]
+}
+
+// writeManifest replaces path atomically with m.
+func writeManifest(path string, m *manifest) error {
+	if err := writeJSON(path, m); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	return nil
+}
+
+// writeJSON replaces path atomically with v as indented JSON, creating
+// its directory if needed.
+func writeJSON(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(raw, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// newDeployment fills the on-chain facts of a deployment from its receipt.
+func newDeployment(from, address common.Address, rcpt *types.Receipt) Deployment {
+	return Deployment{
+		Address:     address,
+		Deployer:    from,
+		TxHash:      rcpt.TxHash,
+		BlockNumber: rcpt.BlockNumber.Uint64(),
+		BlockHash:   &rcpt.BlockHash,
+	}
+}
+
+// recordDeployment appends d as a new version of c's manifest, filling in
+// the artifact-derived fields.
+func recordDeployment(dir string, chainID *big.Int, c *Artifact, args []interface{}, d Deployment) (*Deployment, error) {
+	return recordDeploymentAs(dir, chainID, c.Name, c, args, d)
+}
+
+// recordDeploymentAs is recordDeployment into the manifest of contract
+// name, for an upgrade whose new implementation is named differently.
+func recordDeploymentAs(dir string, chainID *big.Int, name string, c *Artifact, args []interface{}, d Deployment) (*Deployment, error) {
+	path := manifestPath(dir, chainID, name)
+	m, err := readManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	ctorData, err := c.ABI.Pack("", args...)
+	if err != nil {
+		return nil, fmt.Errorf("encode constructor args: %w", err)
+	}
+	jsonArgs := make([]interface{}, len(args))
+	for i, a := range args {
+		jsonArgs[i] = jsonValue(a)
+	}
+
+	d.Version = len(m.Deployments) + 1
+	d.Explorer = ui.explorerURL("address", d.Address.Hex())
+	d.ConstructorArgs = jsonArgs
+	d.ConstructorData = formatValue(ctorData)
+	d.BytecodeHash = crypto.Keccak256Hash(c.Bytecode)
+	d.Artifact = c.Path
+	d.Timestamp = time.Now().UTC().Truncate(time.Second)
+
+	m.ChainID, m.Contract = chainID.Uint64(), name
+	m.Deployments = append(m.Deployments, d)
+	if err := writeManifest(path, m); err != nil {
+		return nil, err
+	}
+	return m.latest(), nil
+}
+
+// listManifests returns every manifest recorded for chainID, by contract name.
+func listManifests(dir string, chainID *big.Int) ([]*manifest, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, chainID.String(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var out []*manifest
+	for _, p := range paths {
+		m, err := readManifest(p)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
@@ -0,0 +1,243 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// healthyFor is how long a successful eth_blockNumber keeps /healthz
+// reporting the node reachable without asking it again.
+const healthyFor = 30 * time.Second
+
+var (
+	latencyBuckets  = []float64{1, 2, 5, 10, 15, 30, 60, 120, 300, 600}
+	durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+)
+
+// metrics are the counters, gauges and histograms of everything a
+// command or Client sends and reads; every name starts with nyc2025_.
+// They are a prometheus.Collector. Nothing is recorded until enable is
+// called, which --metrics-addr and registering a Client do.
+type metrics struct {
+	on atomic.Bool
+
+	sent, confirmed, failed prometheus.Counter
+	gasUsed, reorgs         prometheus.Counter
+	latency                 prometheus.Histogram
+	rpcDuration             *prometheus.HistogramVec
+	rpcErrors               *prometheus.CounterVec
+	nonceGap                prometheus.Gauge
+	events                  *prometheus.CounterVec
+
+	mu     sync.Mutex
+	extra  []prometheus.Collector // added by register
+	headOK time.Time              // last successful eth_blockNumber
+}
+
+func newMetrics() *metrics {
+	counter := func(name, help string) prometheus.Counter {
+		return prometheus.NewCounter(prometheus.CounterOpts{Namespace: "nyc2025", Name: name, Help: help})
+	}
+	return &metrics{
+		sent:      counter("transactions_sent_total", "Transactions sent."),
+		confirmed: counter("transactions_confirmed_total", "Transactions mined successfully to the confirmation depth."),
+		failed:    counter("transactions_failed_total", "Transactions that reverted or were not mined."),
+		gasUsed:   counter("gas_used_total", "Gas used by mined transactions."),
+		reorgs:    counter("reorgs_total", "Reorgs that dropped or moved a transaction being waited for."),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{Namespace: "nyc2025", Name: "confirmation_latency_seconds",
+			Help: "Time from sending a transaction until it reached the confirmation depth.", Buckets: latencyBuckets}),
+		rpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{Namespace: "nyc2025", Name: "rpc_request_duration_seconds",
+			Help: "JSON-RPC request duration by method.", Buckets: durationBuckets}, []string{"method"}),
+		rpcErrors: prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: "nyc2025", Name: "rpc_errors_total",
+			Help: "Failed JSON-RPC requests by endpoint."}, []string{"endpoint"}),
+		nonceGap: prometheus.NewGauge(prometheus.GaugeOpts{Namespace: "nyc2025", Name: "pending_nonce_gap",
+			Help: "The signer's pending nonce minus its mined nonce: transactions sent but not yet mined."}),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: "nyc2025", Name: "events_observed_total",
+			Help: "Events the watcher printed, by name."}, []string{"event"}),
+	}
+}
+
+// collectors are every metric in m.
+func (m *metrics) collectors() []prometheus.Collector {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]prometheus.Collector{m.sent, m.confirmed, m.failed, m.gasUsed, m.reorgs, m.latency,
+		m.rpcDuration, m.rpcErrors, m.nonceGap, m.events}, m.extra...)
+}
+
+func (m *metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+func (m *metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// enable starts recording.
+func (m *metrics) enable() {
+	m.on.Store(true)
+}
+
+// enabled reports whether enable was called.
+func (m *metrics) enabled() bool {
+	return m.on.Load()
+}
+
+// register adds c, a metric read whenever m is collected, for counters
+// kept elsewhere such as the keeper's. Register m afterwards.
+func (m *metrics) register(c prometheus.Collector) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.extra = append(m.extra, c)
+}
+
+// txSent counts a transaction sent.
+func (m *metrics) txSent() {
+	if m.enabled() {
+		m.sent.Inc()
+	}
+}
+
+// txFailed counts a transaction that was not mined.
+func (m *metrics) txFailed() {
+	if m.enabled() {
+		m.failed.Inc()
+	}
+}
+
+// reorg counts a reorg that dropped or moved a transaction.
+func (m *metrics) reorg() {
+	if m.enabled() {
+		m.reorgs.Inc()
+	}
+}
+
+// event counts an event the watcher printed.
+func (m *metrics) event(name string) {
+	if m.enabled() {
+		m.events.WithLabelValues(name).Inc()
+	}
+}
+
+// observeRPC records one request to endpoint url: its duration, whether
+// it failed and, for eth_blockNumber, that the node answered. A receipt
+// or transaction not found yet is an answer, not an error.
+func (m *metrics) observeRPC(method, url string, d time.Duration, err error) {
+	if !m.enabled() {
+		return
+	}
+	m.rpcDuration.WithLabelValues(method).Observe(d.Seconds())
+	if err != nil && !errors.Is(err, ethereum.NotFound) {
+		m.rpcErrors.WithLabelValues(redactURL(url)).Inc()
+		return
+	}
+	if err == nil && method == "eth_blockNumber" {
+		m.mu.Lock()
+		m.headOK = time.Now()
+		m.mu.Unlock()
+	}
+}
+
+// lastHead is when eth_blockNumber last succeeded.
+func (m *metrics) lastHead() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.headOK
+}
+
+// metricsOptions serve a command's metrics while it runs.
+type metricsOptions struct {
+	addr string
+}
+
+func (mo *metricsOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&mo.addr, "metrics-addr", "", "serve Prometheus metrics at http://<addr>/metrics and RPC health at /healthz, e.g. 127.0.0.1:9090")
+}
+
+// serve enables client's metrics and serves them until the returned stop
+// is called.
+// /healthz answers 200 while the node has answered eth_blockNumber within
+// healthyFor, asking it again when it has not, and 503 otherwise. Without
+// --metrics-addr it does nothing.
+func (mo metricsOptions) serve(client *rpcClient) (func(), error) {
+	if mo.addr == "" {
+		return func() {}, nil
+	}
+	ln, err := net.Listen("tcp", mo.addr)
+	if err != nil {
+		return nil, fmt.Errorf("--metrics-addr: %w", err)
+	}
+	m := client.metrics
+	m.enable()
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(m); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("--metrics-addr: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if time.Since(m.lastHead()) > healthyFor {
+			ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+			defer cancel()
+			if _, err := client.BlockNumber(ctx); err != nil {
+				http.Error(w, "rpc: "+err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		fmt.Fprintf(w, "ok: eth_blockNumber answered %s ago\n", time.Since(m.lastHead()).Round(time.Millisecond))
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	client.ui.Printf("Metrics at http://%s/metrics\n", ln.Addr())
+	return func() { srv.Close() }, nil
+}
+
+// noteMined records a mined transaction, waited for for latency.
+func (s *session) noteMined(ctx context.Context, rcpt *types.Receipt, latency time.Duration) {
+	m := s.metrics
+	if !m.enabled() {
+		return
+	}
+	if rcpt.Status == types.ReceiptStatusSuccessful {
+		m.confirmed.Inc()
+	} else {
+		m.failed.Inc()
+	}
+	m.gasUsed.Add(float64(rcpt.GasUsed))
+	m.latency.Observe(latency.Seconds())
+	s.noteNonceGap(ctx)
+}
+
+// noteNonceGap sets pending_nonce_gap from the node's pending and mined
+// nonces of the signer.
+func (s *session) noteNonceGap(ctx context.Context) {
+	if !s.metrics.enabled() {
+		return
+	}
+	pending, err := s.client.PendingNonceAt(ctx, s.from)
+	if err != nil {
+		return
+	}
+	mined, err := s.client.NonceAt(ctx, s.from, nil)
+	if err != nil || mined > pending {
+		return
+	}
+	s.metrics.nonceGap.Set(float64(pending - mined))
+}
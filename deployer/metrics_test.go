@@ -0,0 +1,63 @@
+package deployer
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TestClientMetrics checks that a registered Client records its own
+// transactions and RPC calls, and an unregistered one nothing.
+func TestClientMetrics(t *testing.T) {
+	chain := newSimChain(t)
+	chain.autoCommit(t)
+	c := chain.dial(t, Config{})
+	idle := chain.dial(t, Config{})
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	art := greeter(t)
+	d, err := c.Deploy(t.Context(), art, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Send(t.Context(), art, d.Address, "setGreeting", "again"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := idle.Deploy(t.Context(), art, "idle"); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			switch {
+			case m.GetCounter() != nil:
+				got[f.GetName()] += m.GetCounter().GetValue()
+			case m.GetHistogram() != nil:
+				got[f.GetName()] += float64(m.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	for name, want := range map[string]float64{
+		"nyc2025_transactions_sent_total":      2,
+		"nyc2025_transactions_confirmed_total": 2,
+		"nyc2025_transactions_failed_total":    0,
+		"nyc2025_confirmation_latency_seconds": 2,
+	} {
+		if got[name] != want {
+			t.Errorf("%s = %v, want %v", name, got[name], want)
+		}
+	}
+	if got["nyc2025_rpc_request_duration_seconds"] == 0 {
+		t.Error("no RPC requests recorded")
+	}
+	if idle.s.metrics.enabled() {
+		t.Error("an unregistered Client records metrics")
+	}
+}
@@ -0,0 +1,254 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// saltProgressEvery is how often mine-salt prints its attempt rate.
+const saltProgressEvery = 5 * time.Second
+
+// SaltReport is the salt mine-salt found and the address it gives.
+type SaltReport struct {
+	Salt         common.Hash    `json:"salt"`
+	Address      common.Address `json:"address"`
+	Deployer     common.Address `json:"deployer"`
+	InitCodeHash common.Hash    `json:"initCodeHash"`
+	Attempts     uint64         `json:"attempts"`
+	Seconds      float64        `json:"seconds"`
+}
+
+// saltCriteria is what a mined address must look like: lowercase hex
+// without 0x, starting with prefix, ending with suffix and matching re.
+type saltCriteria struct {
+	prefix, suffix []byte
+	re             *regexp.Regexp
+}
+
+func (sc *saltCriteria) match(hexAddr []byte) bool {
+	return bytes.HasPrefix(hexAddr, sc.prefix) && bytes.HasSuffix(hexAddr, sc.suffix) &&
+		(sc.re == nil || sc.re.Match(hexAddr))
+}
+
+// odds is the expected number of attempts, from the fixed characters;
+// a regular expression is not counted.
+func (sc *saltCriteria) odds() float64 {
+	return math.Pow(16, float64(len(sc.prefix)+len(sc.suffix)))
+}
+
+// runMineSalt implements `mine-salt [flags] [artifact] [constructor args...]`:
+// brute-force a CREATE2 salt for a vanity address. It needs no node; the
+// init code is hashed once and every core tries salts until one matches.
+func runMineSalt(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("mine-salt", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	var lo linkOptions
+	o.register(fs)
+	ao.register(fs, "")
+	lo.register(fs)
+	ctorJSON := fs.String("constructor-args", "", "constructor arguments as a JSON array")
+	prefix := fs.String("prefix", "", "hex the address must start with, e.g. 0000")
+	suffix := fs.String("suffix", "", "hex the address must end with")
+	pattern := fs.String("regex", "", "regular expression the lowercase hex address (without 0x) must match")
+	deployerFlag := fs.String("deployer", deterministicDeployer.Hex(), "CREATE2 factory the salt is mined for")
+	workers := fs.Int("workers", runtime.NumCPU(), "goroutines to mine with")
+	maxDuration := fs.Duration("max-duration", 10*time.Minute, "give up after this long (0 mines until interrupted)")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	positional := fs.Args()
+	if ao.path == "" && ao.contract == "" && len(positional) > 0 {
+		ao.path, positional = positional[0], positional[1:]
+	}
+
+	var sc saltCriteria
+	for _, h := range []struct {
+		name  string
+		value string
+		dst   *[]byte
+	}{{"--prefix", *prefix, &sc.prefix}, {"--suffix", *suffix, &sc.suffix}} {
+		v := strings.ToLower(strings.TrimPrefix(h.value, "0x"))
+		if strings.Trim(v, "0123456789abcdef") != "" {
+			return fmt.Errorf("%s: want hex digits, got %q", h.name, h.value)
+		}
+		*h.dst = []byte(v)
+	}
+	if len(sc.prefix)+len(sc.suffix) > 40 {
+		return errors.New("--prefix and --suffix: more than the 40 hex digits of an address")
+	}
+	if *pattern != "" {
+		re, err := regexp.Compile(*pattern)
+		if err != nil {
+			return fmt.Errorf("--regex: %w", err)
+		}
+		sc.re = re
+	}
+	if len(sc.prefix) == 0 && len(sc.suffix) == 0 && sc.re == nil {
+		return errors.New("usage: mine-salt [flags] [artifact] [constructor args...] with --prefix, --suffix or --regex")
+	}
+	deployer, err := parseAddress(*deployerFlag)
+	if err != nil {
+		return fmt.Errorf("--deployer: %w", err)
+	}
+	if *workers < 1 {
+		return errors.New("--workers: want at least 1")
+	}
+
+	path, contract, err := ao.resolve()
+	if err != nil {
+		return err
+	}
+	c, err := loadArtifact(path, contract)
+	if err != nil {
+		return err
+	}
+	ctorArgs, err := constructorArgs(c, positional, *ctorJSON)
+	if err != nil {
+		return err
+	}
+	libs, err := parseLibraries(lo.libraries)
+	if err != nil {
+		return err
+	}
+	for i, lib := range c.Libraries {
+		if addr, ok := libs[lib.Source+":"+lib.Name]; ok {
+			c.setLibrary(i, addr)
+		} else if addr, ok := libs[lib.Name]; ok {
+			c.setLibrary(i, addr)
+		}
+	}
+	if err := c.checkLinked(); err != nil {
+		return err
+	}
+	code, err := initCode(c, ctorArgs)
+	if err != nil {
+		return err
+	}
+	codeHash := crypto.Keccak256Hash(code)
+
+	ui.Printf("Mining a CREATE2 salt for %s (init code hash %s) from %s on %d workers\n", c.Name, codeHash.Hex(), deployer.Hex(), *workers)
+	if sc.odds() > 1 {
+		ui.Printf("  about %.0f attempts expected\n", sc.odds())
+	}
+	if deployer != deterministicDeployer {
+		ui.Warnf("warning: deploy --create2 only uses %s; deploy through %s yourself with this salt\n", deterministicDeployer.Hex(), deployer.Hex())
+	}
+	if *maxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *maxDuration)
+		defer cancel()
+	}
+
+	start := time.Now()
+	salt, address, attempts, found := mineSalt(ctx, deployer, codeHash, &sc, *workers, func(n uint64) {
+		elapsed := time.Since(start)
+		ui.Printf("  %d attempts, %.0f/s, %s\n", n, float64(n)/elapsed.Seconds(), elapsed.Round(time.Second))
+	})
+	elapsed := time.Since(start)
+	if !found {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("no matching salt after %d attempts in %s; raise --max-duration or loosen the pattern", attempts, *maxDuration)
+		}
+		return fmt.Errorf("mine-salt: %w after %d attempts", context.Cause(ctx), attempts)
+	}
+	ui.report.Salt = &SaltReport{Salt: salt, Address: address, Deployer: deployer, InitCodeHash: codeHash, Attempts: attempts, Seconds: elapsed.Seconds()}
+	ui.Printf("Found after %d attempts in %s (%.0f/s)\n", attempts, elapsed.Round(time.Millisecond), float64(attempts)/elapsed.Seconds())
+	ui.Resultln("Address:", address.Hex())
+	ui.Resultln("Salt:", salt.Hex())
+	if deployer == deterministicDeployer {
+		ui.Printf("Deploy with: --create2 --salt %s\n", salt.Hex())
+	}
+	return nil
+}
+
+// mineSalt tries salts for an address from deployer with init code hash
+// codeHash matching sc, on workers goroutines, until one does or ctx is
+// done. Each worker starts from its own random salt and counts up its
+// last 8 bytes. progress is called every saltProgressEvery with the
+// attempts so far. It returns the salt, its address, the attempts made
+// and whether one matched.
+func mineSalt(ctx context.Context, deployer common.Address, codeHash common.Hash, sc *saltCriteria, workers int, progress func(uint64)) (common.Hash, common.Address, uint64, bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		attempts atomic.Uint64
+		once     sync.Once
+		salt     common.Hash
+		address  common.Address
+		found    bool
+		wg       sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// 0xff ++ deployer ++ salt ++ keccak256(init code)
+			var buf [85]byte
+			buf[0] = 0xff
+			copy(buf[1:21], deployer[:])
+			rand.Read(buf[21:53])
+			copy(buf[53:], codeHash[:])
+			counter := binary.BigEndian.Uint64(buf[45:53])
+			h := crypto.NewKeccakState()
+			var sum [32]byte
+			var hexAddr [40]byte
+			for {
+				for i := 0; i < 4096; i++ {
+					binary.BigEndian.PutUint64(buf[45:53], counter)
+					counter++
+					h.Reset()
+					h.Write(buf[:])
+					h.Read(sum[:])
+					hex.Encode(hexAddr[:], sum[12:])
+					if sc.match(hexAddr[:]) {
+						attempts.Add(uint64(i + 1))
+						once.Do(func() {
+							copy(salt[:], buf[21:53])
+							copy(address[:], sum[12:])
+							found = true
+							cancel()
+						})
+						return
+					}
+				}
+				attempts.Add(4096)
+				if ctx.Err() != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	tick := time.NewTicker(saltProgressEvery)
+	defer tick.Stop()
+	for {
+		select {
+		case <-done:
+			return salt, address, attempts.Load(), found
+		case <-tick.C:
+			progress(attempts.Load())
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// deterministicDeployerRuntime is the code of Arachnid's deterministic
+// deployment proxy: it CREATE2s calldata[32:] with salt calldata[:32].
+const deterministicDeployerRuntime = "7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe03601600081602082378035828234f58015156039578182fd5b8082525050506014600cf3"
+
+func TestMineSalt(t *testing.T) {
+	art := greeter(t)
+	code, err := initCode(art, []interface{}{"gm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	codeHash := crypto.Keccak256Hash(code)
+
+	sc := &saltCriteria{prefix: []byte("c0de")}
+	salt, address, attempts, found := mineSalt(t.Context(), deterministicDeployer, codeHash, sc, 2, func(uint64) {})
+	if !found || attempts == 0 {
+		t.Fatalf("mineSalt(c0de) found %v after %d attempts", found, attempts)
+	}
+	if want := crypto.CreateAddress2(deterministicDeployer, salt, codeHash.Bytes()); address != want {
+		t.Fatalf("salt %s gives %s, mineSalt said %s", salt.Hex(), want.Hex(), address.Hex())
+	}
+	if !strings.HasPrefix(strings.ToLower(address.Hex()), "0xc0de") {
+		t.Fatalf("mined address %s lacks the prefix c0de", address.Hex())
+	}
+
+	// Deployed through the proxy with that salt, the contract lands there.
+	chain := newSimChainAlloc(t, types.GenesisAlloc{deterministicDeployer: {Code: common.FromHex(deterministicDeployerRuntime)}})
+	chain.autoCommit(t)
+	c := chain.dial(t, Config{})
+	got, rcpt, err := c.s.deployCreate2(t.Context(), art, salt, txOptions{nonce: -1}, "gm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != address || rcpt == nil {
+		t.Fatalf("create2 deploy at %s (receipt %v), want %s", got.Hex(), rcpt, address.Hex())
+	}
+	if deployed, err := chain.Client().CodeAt(t.Context(), address, nil); err != nil || common.Bytes2Hex(deployed) != greeterRuntime {
+		t.Fatalf("code at %s = %x, %v; want the greeter's", address.Hex(), deployed, err)
+	}
+}
+
+func TestMineSaltCriteria(t *testing.T) {
+	codeHash := crypto.Keccak256Hash([]byte{0})
+	sc := &saltCriteria{suffix: []byte("ee"), re: regexp.MustCompile("^[0-9]")}
+	salt, address, _, found := mineSalt(t.Context(), deterministicDeployer, codeHash, sc, 1, func(uint64) {})
+	hexAddr := strings.ToLower(address.Hex()[2:])
+	if !found || !strings.HasSuffix(hexAddr, "ee") || hexAddr[0] > '9' {
+		t.Fatalf("mineSalt(suffix ee, ^[0-9]) = %s, found %v", address.Hex(), found)
+	}
+	if address != crypto.CreateAddress2(deterministicDeployer, salt, codeHash.Bytes()) {
+		t.Fatalf("salt %s does not give %s", salt.Hex(), address.Hex())
+	}
+
+	// Forty fixed digits are never matched in time; a cancel stops it.
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	sc = &saltCriteria{prefix: []byte(strings.Repeat("0", 40))}
+	if _, _, _, found := mineSalt(ctx, deterministicDeployer, codeHash, sc, 2, func(uint64) {}); found {
+		t.Fatal("mineSalt with a cancelled context found a salt")
+	}
+}
+
+func TestMineSaltFlags(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--prefix", "xyz"}, `--prefix: want hex digits, got "xyz"`},
+		{[]string{"--suffix", "0x12g"}, `--suffix: want hex digits, got "0x12g"`},
+		{[]string{"--prefix", strings.Repeat("0", 21), "--suffix", strings.Repeat("0", 20)}, "more than the 40 hex digits"},
+		{[]string{"--regex", "("}, "--regex: "},
+		{nil, "usage: mine-salt"},
+		{[]string{"--prefix", "00", "--workers", "0"}, "--workers: want at least 1"},
+	} {
+		if err := runMineSalt(t.Context(), tt.args); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("mine-salt %v = %v, want %q", tt.args, err, tt.want)
+		}
+	}
+}
+
+// BenchmarkMineSalt mines a four-digit prefix, one in 65536 addresses, on
+// one worker and on one per CPU, and reports the hash rate.
+func BenchmarkMineSalt(b *testing.B) {
+	codeHash := crypto.Keccak256Hash([]byte{0})
+	sc := &saltCriteria{prefix: []byte("c0de")}
+	counts := []int{1}
+	if n := runtime.GOMAXPROCS(0); n > 1 {
+		counts = append(counts, n)
+	}
+	for _, workers := range counts {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			var total uint64
+			for b.Loop() {
+				_, _, attempts, found := mineSalt(b.Context(), deterministicDeployer, codeHash, sc, workers, func(uint64) {})
+				if !found {
+					b.Fatal("no salt found")
+				}
+				total += attempts
+			}
+			b.ReportMetric(float64(total)/b.Elapsed().Seconds(), "hashes/s")
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// multicall3 is the canonical Multicall3 deployment, at the same address
+// on nearly every chain.
+var multicall3 = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+// multicall3ABI is the one Multicall3 function used here.
+const multicall3ABI = `[{"type":"function","name":"aggregate3","stateMutability":"payable",
+"inputs":[{"name":"calls","type":"tuple[]","components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}]}],
+"outputs":[{"name":"returnData","type":"tuple[]","components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}]}]}]`
+
+// multicallWorkers bounds the concurrent eth_calls made when the chain
+// has no Multicall3.
+const multicallWorkers = 8
+
+var parsedMulticall3 = func() abi.ABI {
+	a, err := abi.JSON(strings.NewReader(multicall3ABI))
+	if err != nil {
+		panic(err)
+	}
+	return a
+}()
+
+// BatchCall is one read for Multicall: method, by name or signature, of
+// ABI called on Address with Args, which must have the Go types the ABI
+// expects.
+type BatchCall struct {
+	Address common.Address
+	ABI     *abi.ABI
+	Method  string
+	Args    []interface{}
+}
+
+// BatchResult is a BatchCall's decoded outputs, or Err if it reverted or
+// could not be encoded or decoded. One failed call does not fail the
+// others.
+type BatchResult struct {
+	Method *abi.Method
+	Values []interface{}
+	Err    error
+}
+
+// Multicall runs calls at block (nil = latest) on c's node.
+func (c *Client) Multicall(ctx context.Context, calls []BatchCall, block *big.Int) ([]BatchResult, error) {
+	return multicall(ctx, c.s.client, calls, block)
+}
+
+// multicall runs calls through one aggregate3 eth_call, each with
+// allowFailure set, or as parallel eth_calls when Multicall3 has no code
+// on the chain at block. The error is only for the batch as a whole.
+func multicall(ctx context.Context, client *rpcClient, calls []BatchCall, block *big.Int) ([]BatchResult, error) {
+	type call3 struct {
+		Target       common.Address
+		AllowFailure bool
+		CallData     []byte
+	}
+	results := make([]BatchResult, len(calls))
+	datas := make([][]byte, len(calls))
+	var packed []call3
+	var index []int // packed position -> calls position
+	for i, bc := range calls {
+		m, err := resolveMethod(bc.ABI, bc.Method)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i].Method = m
+		if datas[i], err = bc.ABI.Pack(m.Name, bc.Args...); err != nil {
+			results[i].Err = fmt.Errorf("encode %s: %w", m.Sig, err)
+			continue
+		}
+		packed = append(packed, call3{Target: bc.Address, AllowFailure: true, CallData: datas[i]})
+		index = append(index, i)
+	}
+	if len(packed) == 0 {
+		return results, nil
+	}
+
+	code, err := client.CodeAt(ctx, multicall3, block)
+	if err != nil {
+		return nil, fmt.Errorf("get code at %s: %w", multicall3.Hex(), err)
+	}
+	if len(code) == 0 {
+		client.ui.Verbosef("No Multicall3 at %s; making %d separate calls\n", multicall3.Hex(), len(packed))
+		parallelCalls(ctx, client, calls, datas, index, block, results)
+		return results, nil
+	}
+
+	input, err := parsedMulticall3.Pack("aggregate3", packed)
+	if err != nil {
+		return nil, fmt.Errorf("encode aggregate3: %w", err)
+	}
+	ret, err := client.CallContract(ctx, ethereum.CallMsg{To: &multicall3, Data: input}, block)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate3: %w", err)
+	}
+	out, err := parsedMulticall3.Unpack("aggregate3", ret)
+	if err != nil {
+		return nil, fmt.Errorf("decode aggregate3: %w", err)
+	}
+	type result3 struct {
+		Success    bool
+		ReturnData []byte
+	}
+	res := *abi.ConvertType(out[0], new([]result3)).(*[]result3)
+	if len(res) != len(packed) {
+		return nil, fmt.Errorf("decode aggregate3: got %d results for %d calls", len(res), len(packed))
+	}
+	for j, r := range res {
+		i := index[j]
+		if !r.Success {
+			results[i].Err = fmt.Errorf("call %s: reverted: %s", results[i].Method.Sig, decodeRevert(r.ReturnData, calls[i].ABI))
+			continue
+		}
+		results[i].decode(r.ReturnData)
+	}
+	return results, nil
+}
+
+// parallelCalls is multicall without Multicall3: one eth_call per encoded
+// call, at most multicallWorkers at a time.
+func parallelCalls(ctx context.Context, client *rpcClient, calls []BatchCall, datas [][]byte, index []int, block *big.Int, results []BatchResult) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, multicallWorkers)
+	for _, i := range index {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			ret, err := client.CallContract(ctx, ethereum.CallMsg{To: &calls[i].Address, Data: datas[i]}, block)
+			if err != nil {
+				results[i].Err = fmt.Errorf("call %s: %w", results[i].Method.Sig, explainError(err, calls[i].ABI))
+				return
+			}
+			results[i].decode(ret)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// decode unpacks a successful call's return data.
+func (r *BatchResult) decode(ret []byte) {
+	vals, err := r.Method.Outputs.Unpack(ret)
+	if err != nil {
+		r.Err = fmt.Errorf("decode %s: %w", r.Method.Sig, err)
+		return
+	}
+	r.Values = vals
+}
+
+// batchEntry is one line of a `call --batch` file. Contract or Artifact,
+// if set, replace the command's --contract or --artifact for this call.
+type batchEntry struct {
+	Address  string        `json:"address"`
+	Contract string        `json:"contract"`
+	Artifact string        `json:"artifact"`
+	Method   string        `json:"method"`
+	Args     []interface{} `json:"args"`
+}
+
+// readBatch reads a `call --batch` file: a JSON array of batchEntry,
+// with arguments converted like positional ones.
+func readBatch(path string, ao artifactOptions) ([]BatchCall, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("--batch: %w", err)
+	}
+	var entries []batchEntry
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("--batch %s: %w", path, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("--batch %s holds no calls", path)
+	}
+	abis := map[string]*abi.ABI{}
+	calls := make([]BatchCall, len(entries))
+	for i, e := range entries {
+		address, err := parseAddress(e.Address)
+		if err != nil {
+			return nil, fmt.Errorf("--batch call %d: %w", i, err)
+		}
+		o := ao
+		if e.Contract != "" || e.Artifact != "" {
+			o.contract, o.path = e.Contract, e.Artifact
+		}
+		path, contract, err := o.resolve()
+		if err != nil {
+			return nil, fmt.Errorf("--batch call %d: %w", i, err)
+		}
+		key := path + "\x00" + contract
+		if abis[key] == nil {
+			c, err := loadABI(path, contract)
+			if err != nil {
+				return nil, fmt.Errorf("--batch call %d: %w", i, err)
+			}
+			abis[key] = &c.ABI
+		}
+		m, err := resolveMethod(abis[key], e.Method)
+		if err != nil {
+			return nil, fmt.Errorf("--batch call %d: %w", i, err)
+		}
+		args, err := convertArgs(m.Inputs, e.Args)
+		if err != nil {
+			return nil, fmt.Errorf("--batch call %d: %s: %w", i, m.Sig, err)
+		}
+		calls[i] = BatchCall{Address: address, ABI: abis[key], Method: m.Sig, Args: args}
+	}
+	return calls, nil
+}
+
+// runBatch implements `call --batch`: every call in the file in one
+// round trip, printed in order.
+func runBatch(ctx context.Context, client *rpcClient, calls []BatchCall, block *big.Int) error {
+	results, err := multicall(ctx, client, calls, block)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for i, r := range results {
+		address := calls[i].Address
+		report := CallReport{Address: &address}
+		if r.Method != nil {
+			report.Method = r.Method.Sig
+		}
+		if r.Err != nil {
+			failed++
+			client.ui.Resultf("[%d] %s: error: %v\n", i, address.Hex(), r.Err)
+			report.Error = r.Err.Error()
+		} else {
+			client.ui.Resultf("[%d] %s %s\n", i, address.Hex(), r.Method.Sig)
+			report.Results = typedValues(r.Method.Outputs, r.Values)
+			for _, t := range report.Results {
+				client.ui.Resultf("  %s (%s): %s\n", t.Name, t.Type, formatValue(t.Value))
+			}
+		}
+		client.ui.report.Calls = append(client.ui.report.Calls, report)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d calls failed", failed, len(calls))
+	}
+	return nil
+}
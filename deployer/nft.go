@@ -0,0 +1,474 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// erc721ABI is the part of ERC-721 the erc721 commands use, with the
+// custom errors OpenZeppelin's implementation reverts with.
+const erc721ABI = `[
+{"type":"function","name":"name","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+{"type":"function","name":"symbol","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+{"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+{"type":"function","name":"ownerOf","stateMutability":"view","inputs":[{"name":"tokenId","type":"uint256"}],"outputs":[{"name":"","type":"address"}]},
+{"type":"function","name":"tokenURI","stateMutability":"view","inputs":[{"name":"tokenId","type":"uint256"}],"outputs":[{"name":"","type":"string"}]},
+{"type":"function","name":"safeTransferFrom","stateMutability":"nonpayable","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"tokenId","type":"uint256"}],"outputs":[]},
+{"type":"event","name":"Transfer","anonymous":false,"inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"tokenId","type":"uint256","indexed":true}]},
+{"type":"event","name":"Approval","anonymous":false,"inputs":[{"name":"owner","type":"address","indexed":true},{"name":"approved","type":"address","indexed":true},{"name":"tokenId","type":"uint256","indexed":true}]},
+{"type":"error","name":"ERC721NonexistentToken","inputs":[{"name":"tokenId","type":"uint256"}]},
+{"type":"error","name":"ERC721InvalidOwner","inputs":[{"name":"owner","type":"address"}]},
+{"type":"error","name":"ERC721IncorrectOwner","inputs":[{"name":"sender","type":"address"},{"name":"tokenId","type":"uint256"},{"name":"owner","type":"address"}]},
+{"type":"error","name":"ERC721InsufficientApproval","inputs":[{"name":"operator","type":"address"},{"name":"tokenId","type":"uint256"}]},
+{"type":"error","name":"ERC721InvalidReceiver","inputs":[{"name":"receiver","type":"address"}]}
+]`
+
+// erc1155ABI is the part of ERC-1155 the erc1155 commands use, with
+// OpenZeppelin's custom errors.
+const erc1155ABI = `[
+{"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"account","type":"address"},{"name":"id","type":"uint256"}],"outputs":[{"name":"","type":"uint256"}]},
+{"type":"function","name":"uri","stateMutability":"view","inputs":[{"name":"id","type":"uint256"}],"outputs":[{"name":"","type":"string"}]},
+{"type":"function","name":"safeTransferFrom","stateMutability":"nonpayable","inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"id","type":"uint256"},{"name":"value","type":"uint256"},{"name":"data","type":"bytes"}],"outputs":[]},
+{"type":"event","name":"TransferSingle","anonymous":false,"inputs":[{"name":"operator","type":"address","indexed":true},{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"id","type":"uint256","indexed":false},{"name":"value","type":"uint256","indexed":false}]},
+{"type":"event","name":"TransferBatch","anonymous":false,"inputs":[{"name":"operator","type":"address","indexed":true},{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"ids","type":"uint256[]","indexed":false},{"name":"values","type":"uint256[]","indexed":false}]},
+{"type":"event","name":"URI","anonymous":false,"inputs":[{"name":"value","type":"string","indexed":false},{"name":"id","type":"uint256","indexed":true}]},
+{"type":"error","name":"ERC1155InsufficientBalance","inputs":[{"name":"sender","type":"address"},{"name":"balance","type":"uint256"},{"name":"needed","type":"uint256"},{"name":"tokenId","type":"uint256"}]},
+{"type":"error","name":"ERC1155InvalidReceiver","inputs":[{"name":"receiver","type":"address"}]},
+{"type":"error","name":"ERC1155MissingApprovalForAll","inputs":[{"name":"operator","type":"address"},{"name":"owner","type":"address"}]}
+]`
+
+var parsedERC721, parsedERC1155 = func() (abi.ABI, abi.ABI) {
+	a, err := abi.JSON(strings.NewReader(erc721ABI))
+	if err != nil {
+		panic(err)
+	}
+	b, err := abi.JSON(strings.NewReader(erc1155ABI))
+	if err != nil {
+		panic(err)
+	}
+	return a, b
+}()
+
+// nftToken is an ERC-721 or ERC-1155 contract.
+type nftToken struct {
+	standard string // "erc721" or "erc1155"
+	address  common.Address
+	abi      *abi.ABI
+	bound    *bind.BoundContract
+	name     string
+	symbol   string
+}
+
+// loadNFT binds the standard's ABI to the contract at address and reads
+// its name and symbol, which ERC-1155 contracts usually lack. A contract
+// that denies the standard's ERC-165 ID gets a warning, not an error:
+// early NFTs predate it.
+func loadNFT(ctx context.Context, client *rpcClient, standard string, address common.Address) (*nftToken, error) {
+	code, err := client.CodeAt(ctx, address, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get code at %s: %w", address.Hex(), err)
+	}
+	if len(code) == 0 {
+		return nil, fmt.Errorf("no contract at %s", address.Hex())
+	}
+	t := &nftToken{standard: standard, address: address, abi: &parsedERC721}
+	id, what := [4]byte{0x80, 0xac, 0x58, 0xcd}, "ERC-721"
+	if standard == "erc1155" {
+		t.abi = &parsedERC1155
+		id, what = [4]byte{0xd9, 0xb6, 0x7a, 0x26}, "ERC-1155"
+	}
+	t.bound = bind.NewBoundContract(address, *t.abi, client, client, client)
+	if ok, err := supportsInterface(ctx, client, address, id); err == nil && !ok {
+		client.ui.Warnf("warning: %s does not claim %s through supportsInterface\n", address.Hex(), what)
+	}
+	if standard == "erc721" {
+		if out, err := t.call(ctx, "name"); err == nil {
+			t.name = out[0].(string)
+		}
+		if out, err := t.call(ctx, "symbol"); err == nil {
+			t.symbol = out[0].(string)
+		}
+	}
+	return t, nil
+}
+
+// call runs one of the token's view methods. Reverts, such as for a token
+// ID that does not exist, are decoded against the standard's errors.
+func (t *nftToken) call(ctx context.Context, method string, args ...interface{}) ([]interface{}, error) {
+	m := t.abi.Methods[method]
+	return callMethod(ctx, t.bound, t.abi, &m, nil, args)
+}
+
+func (t *nftToken) report() *NFTReport {
+	return &NFTReport{Address: t.address, Standard: t.standard, Name: t.name, Symbol: t.symbol}
+}
+
+// label is the token for output: its symbol, when it has one.
+func (t *nftToken) label() string {
+	if t.symbol == "" {
+		return t.address.Hex()
+	}
+	return fmt.Sprintf("%s (%s)", t.address.Hex(), t.symbol)
+}
+
+// send sends a safeTransferFrom through the generic send path and checks
+// that the receipt carries the standard's transfer event.
+func (t *nftToken) send(ctx context.Context, s *session, txo txOptions, args ...interface{}) error {
+	m := t.abi.Methods["safeTransferFrom"]
+	if txo.dryRun {
+		return s.dryRunSend(ctx, t.address, t.abi, &m, args, txo)
+	}
+	tx, err := s.transact(ctx, t.bound, t.abi, &m, args, txo)
+	if err != nil {
+		return err
+	}
+	if txo.noWait {
+		return nil
+	}
+	rcpt, err := s.waitReceipt(ctx, tx, t.abi)
+	if err != nil {
+		return err
+	}
+	s.ui.report.Transactions = append(s.ui.report.Transactions, *newTxReport(m.Sig, rcpt, printEvents(s.ui, rcpt, t.abi)))
+	event := t.abi.Events["Transfer"]
+	if t.standard == "erc1155" {
+		event = t.abi.Events["TransferSingle"]
+	}
+	for _, l := range rcpt.Logs {
+		if l.Address == t.address && len(l.Topics) > 0 && l.Topics[0] == event.ID {
+			return nil
+		}
+	}
+	s.ui.Warnf("warning: tx %s emitted no %s event\n", tx.Hash().Hex(), event.Name)
+	return nil
+}
+
+// parseTokenID parses a token ID: decimal or 0x hex.
+func parseTokenID(s string) (*big.Int, error) {
+	id, ok := new(big.Int).SetString(s, 0)
+	if !ok || id.Sign() < 0 || id.BitLen() > 256 {
+		return nil, fmt.Errorf("invalid token ID %q", s)
+	}
+	return id, nil
+}
+
+// expandURI substitutes id for {id} as ERC-1155 defines it: 64 lowercase
+// hex digits without 0x. Some ERC-721 contracts use the same template.
+func expandURI(uri string, id *big.Int) string {
+	return strings.ReplaceAll(uri, "{id}", fmt.Sprintf("%064x", id))
+}
+
+// metadataURL is where uri's metadata is fetched from: ipfs:// through
+// gateway, http(s) as is. data: URIs are read inline; other schemes
+// cannot be fetched.
+func metadataURL(uri, gateway string) (string, error) {
+	switch {
+	case strings.HasPrefix(uri, "ipfs://"):
+		path := strings.TrimPrefix(strings.TrimPrefix(uri, "ipfs://"), "ipfs/")
+		return strings.TrimRight(gateway, "/") + "/" + path, nil
+	case strings.HasPrefix(uri, "http://"), strings.HasPrefix(uri, "https://"), strings.HasPrefix(uri, "data:"):
+		return uri, nil
+	}
+	return "", fmt.Errorf("cannot fetch %q: only http(s), ipfs:// and data: URIs are supported", uri)
+}
+
+// fetchMetadata reads the document at u, a metadataURL, up to 1 MiB.
+func fetchMetadata(ctx context.Context, u string) ([]byte, error) {
+	if rest, ok := strings.CutPrefix(u, "data:"); ok {
+		meta, data, ok := strings.Cut(rest, ",")
+		if !ok {
+			return nil, errors.New("malformed data: URI")
+		}
+		if strings.HasSuffix(meta, ";base64") {
+			return base64.StdEncoding.DecodeString(data)
+		}
+		s, err := url.PathUnescape(data)
+		return []byte(s), err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// showURI prints the token URI read with method for id and, with fetch,
+// the metadata behind it, pretty-printed when it is JSON.
+func showURI(ctx context.Context, t *nftToken, method string, id *big.Int, fetch bool, gateway string) error {
+	out, err := t.call(ctx, method, id)
+	if err != nil {
+		return err
+	}
+	uri := expandURI(out[0].(string), id)
+	r := t.report()
+	r.TokenID, r.URI = id.String(), uri
+	ui.report.NFT = r
+	if len(uri) > 200 && strings.HasPrefix(uri, "data:") {
+		ui.Resultf("URI of %s #%s: %.80s... (%d bytes)\n", t.label(), id, uri, len(uri))
+	} else {
+		ui.Resultf("URI of %s #%s: %s\n", t.label(), id, uri)
+	}
+	if !fetch {
+		return nil
+	}
+	if uri == "" {
+		return fmt.Errorf("token %s has an empty URI; nothing to fetch", id)
+	}
+	u, err := metadataURL(uri, gateway)
+	if err != nil {
+		return err
+	}
+	body, err := fetchMetadata(ctx, u)
+	if err != nil {
+		return fmt.Errorf("fetch metadata: %w", err)
+	}
+	if !strings.HasPrefix(u, "data:") {
+		r.MetadataURL = u
+	}
+	var pretty bytes.Buffer
+	if json.Indent(&pretty, body, "", "  ") != nil {
+		ui.Warnf("warning: metadata of token %s is not JSON\n", id)
+		ui.Resultln(string(body))
+		return nil
+	}
+	r.Metadata = json.RawMessage(body)
+	ui.Resultln(strings.TrimSpace(pretty.String()))
+	var meta struct {
+		Image string `json:"image"`
+	}
+	if json.Unmarshal(body, &meta) == nil && strings.HasPrefix(meta.Image, "ipfs://") {
+		if img, err := metadataURL(meta.Image, gateway); err == nil {
+			ui.Resultf("Image: %s\n", img)
+		}
+	}
+	return nil
+}
+
+// nftCommand is an erc721 or erc1155 subcommand. Each gets the token, the
+// session for those that sign (nil otherwise), the transaction flags, the
+// URI flags and the positional arguments after the token address.
+type nftCommand struct {
+	usage string
+	nargs int
+	signs bool
+	uri   bool
+	run   func(ctx context.Context, t *nftToken, s *session, txo txOptions, u uriOptions, args []string) error
+}
+
+// uriOptions are the flags of the uri subcommands.
+type uriOptions struct {
+	fetch   bool
+	gateway string
+}
+
+var erc721Commands = map[string]nftCommand{
+	"owner": {"owner <token> <id>", 1, false, false, func(ctx context.Context, t *nftToken, s *session, txo txOptions, u uriOptions, args []string) error {
+		id, err := parseTokenID(args[0])
+		if err != nil {
+			return err
+		}
+		out, err := t.call(ctx, "ownerOf", id)
+		if err != nil {
+			return err
+		}
+		owner := out[0].(common.Address)
+		ui.Resultf("Owner of %s #%s: %s\n", t.label(), id, names.label(owner))
+		r := t.report()
+		r.TokenID, r.Owner = id.String(), &owner
+		ui.report.NFT = r
+		return nil
+	}},
+	"balance": {"balance <token> <holder>", 1, false, false, func(ctx context.Context, t *nftToken, s *session, txo txOptions, u uriOptions, args []string) error {
+		holder, err := parseAddress(args[0])
+		if err != nil {
+			return err
+		}
+		out, err := t.call(ctx, "balanceOf", holder)
+		if err != nil {
+			return err
+		}
+		balance := out[0].(*big.Int)
+		ui.Resultf("%s holds %s of %s\n", names.label(holder), balance, t.label())
+		r := t.report()
+		r.Holder, r.Balance = &holder, balance.String()
+		ui.report.NFT = r
+		return nil
+	}},
+	"uri": {"uri [--fetch] [--ipfs-gateway URL] <token> <id>", 1, false, true, func(ctx context.Context, t *nftToken, s *session, txo txOptions, u uriOptions, args []string) error {
+		id, err := parseTokenID(args[0])
+		if err != nil {
+			return err
+		}
+		return showURI(ctx, t, "tokenURI", id, u.fetch, u.gateway)
+	}},
+	"transfer": {"transfer [flags] <token> <to> <id>", 2, true, false, func(ctx context.Context, t *nftToken, s *session, txo txOptions, u uriOptions, args []string) error {
+		to, err := parseAddress(args[0])
+		if err != nil {
+			return err
+		}
+		id, err := parseTokenID(args[1])
+		if err != nil {
+			return err
+		}
+		out, err := t.call(ctx, "ownerOf", id)
+		if err != nil {
+			return err
+		}
+		if owner := out[0].(common.Address); owner != s.from {
+			return fmt.Errorf("token %s of %s is owned by %s, not the signer %s", id, t.address.Hex(), owner.Hex(), s.from.Hex())
+		}
+		ui.Printf("Transferring %s #%s to %s\n", t.label(), id, to.Hex())
+		return t.send(ctx, s, txo, s.from, to, id)
+	}},
+}
+
+var erc1155Commands = map[string]nftCommand{
+	"balance": {"balance <token> <holder> <id>", 2, false, false, func(ctx context.Context, t *nftToken, s *session, txo txOptions, u uriOptions, args []string) error {
+		holder, err := parseAddress(args[0])
+		if err != nil {
+			return err
+		}
+		id, err := parseTokenID(args[1])
+		if err != nil {
+			return err
+		}
+		out, err := t.call(ctx, "balanceOf", holder, id)
+		if err != nil {
+			return err
+		}
+		balance := out[0].(*big.Int)
+		ui.Resultf("%s holds %s of %s #%s\n", names.label(holder), balance, t.label(), id)
+		r := t.report()
+		r.Holder, r.TokenID, r.Balance = &holder, id.String(), balance.String()
+		ui.report.NFT = r
+		return nil
+	}},
+	"uri": {"uri [--fetch] [--ipfs-gateway URL] <token> <id>", 1, false, true, func(ctx context.Context, t *nftToken, s *session, txo txOptions, u uriOptions, args []string) error {
+		id, err := parseTokenID(args[0])
+		if err != nil {
+			return err
+		}
+		return showURI(ctx, t, "uri", id, u.fetch, u.gateway)
+	}},
+	"transfer": {"transfer [flags] <token> <to> <id> <amount>", 3, true, false, func(ctx context.Context, t *nftToken, s *session, txo txOptions, u uriOptions, args []string) error {
+		to, err := parseAddress(args[0])
+		if err != nil {
+			return err
+		}
+		id, err := parseTokenID(args[1])
+		if err != nil {
+			return err
+		}
+		amount, ok := new(big.Int).SetString(args[2], 10)
+		if !ok || amount.Sign() <= 0 {
+			return fmt.Errorf("invalid amount %q: want a positive whole number", args[2])
+		}
+		out, err := t.call(ctx, "balanceOf", s.from, id)
+		if err != nil {
+			return err
+		}
+		if balance := out[0].(*big.Int); balance.Cmp(amount) < 0 {
+			return classify(ErrInsufficientFunds, fmt.Errorf("signer %s holds %s of token %s, less than %s", s.from.Hex(), balance, id, amount))
+		}
+		ui.Printf("Transferring %s of %s #%s to %s\n", amount, t.label(), id, to.Hex())
+		return t.send(ctx, s, txo, s.from, to, id, amount, []byte{})
+	}},
+}
+
+func nftUsage(standard string, commands map[string]nftCommand) error {
+	var usages []string
+	for _, cmd := range commands {
+		usages = append(usages, standard+" "+cmd.usage)
+	}
+	sort.Strings(usages)
+	return errors.New("usage:\n  " + strings.Join(usages, "\n  "))
+}
+
+// runNFT runs `<standard> <subcommand> [flags] <token> [args...]`.
+func runNFT(ctx context.Context, standard string, commands map[string]nftCommand, args []string) error {
+	if len(args) == 0 {
+		return nftUsage(standard, commands)
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return nftUsage(standard, commands)
+	}
+	fs := flag.NewFlagSet(standard+" "+args[0], flag.ExitOnError)
+	var o options
+	var txo txOptions
+	var u uriOptions
+	o.register(fs)
+	if cmd.signs {
+		txo.register(fs)
+	}
+	if cmd.uri {
+		fs.BoolVar(&u.fetch, "fetch", false, "also fetch the metadata behind the URI and pretty-print it")
+		fs.StringVar(&u.gateway, "ipfs-gateway", "https://ipfs.io/ipfs/", "HTTP gateway ipfs:// URIs are fetched through")
+	}
+	if err := parseFlags(fs, args[1:], &o); err != nil {
+		return err
+	}
+	if fs.NArg() != cmd.nargs+1 {
+		return fmt.Errorf("usage: %s %s", standard, cmd.usage)
+	}
+	address, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var s *session
+	var client *rpcClient
+	if cmd.signs {
+		if s, err = openSession(ctx, &o); err != nil {
+			return err
+		}
+		defer s.Close()
+		client = s.client
+	} else {
+		if client, _, err = connect(ctx, &o); err != nil {
+			return err
+		}
+		defer client.Close()
+	}
+	t, err := loadNFT(ctx, client, standard, address)
+	if err != nil {
+		return err
+	}
+	return cmd.run(ctx, t, s, txo, u, fs.Args()[1:])
+}
+
+// runERC721 implements `erc721 <subcommand> [flags] <token> [args...]`:
+// NFT reads and transfers without an artifact.
+func runERC721(ctx context.Context, args []string) error {
+	return runNFT(ctx, "erc721", erc721Commands, args)
+}
+
+// runERC1155 implements `erc1155 <subcommand> [flags] <token> [args...]`:
+// multi-token balances and transfers, with whole-number amounts.
+func runERC1155(ctx context.Context, args []string) error {
+	return runNFT(ctx, "erc1155", erc1155Commands, args)
+}
@@ -0,0 +1,71 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// nonceSource is the part of the client a NonceManager needs.
+type nonceSource interface {
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+}
+
+// NonceManager hands out nonces per sender so transactions can be sent
+// back to back, or concurrently, without each one asking the node for
+// the pending nonce. The pending nonce is fetched once; after that nonces
+// increase by one per Next until Reset.
+type NonceManager struct {
+	client nonceSource
+
+	mu   sync.Mutex
+	next map[common.Address]uint64
+}
+
+// newNonceManager returns a NonceManager that reads pending nonces from
+// client, with none reserved yet.
+func newNonceManager(client nonceSource) *NonceManager {
+	return &NonceManager{client: client, next: map[common.Address]uint64{}}
+}
+
+// Next reserves the next nonce for from.
+func (m *NonceManager) Next(ctx context.Context, from common.Address) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.next[from]
+	if !ok {
+		var err error
+		if n, err = m.client.PendingNonceAt(ctx, from); err != nil {
+			return 0, fmt.Errorf("pending nonce: %w", err)
+		}
+	}
+	m.next[from] = n + 1
+	return n, nil
+}
+
+// Peek returns the nonce the next call to Next will reserve for from,
+// without reserving it.
+func (m *NonceManager) Peek(ctx context.Context, from common.Address) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.next[from]
+	if !ok {
+		var err error
+		if n, err = m.client.PendingNonceAt(ctx, from); err != nil {
+			return 0, fmt.Errorf("pending nonce: %w", err)
+		}
+		m.next[from] = n
+	}
+	return n, nil
+}
+
+// Reset forgets from's nonce so the next call resyncs from the chain. It
+// is called whenever a send fails, since a reserved nonce may then be
+// unused (leaving a gap) or already taken by another transaction.
+func (m *NonceManager) Reset(from common.Address) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.next, from)
+}
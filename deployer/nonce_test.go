@@ -0,0 +1,99 @@
+package deployer
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestNonceManagerConcurrentSends(t *testing.T) {
+	const senders = 20
+	chain := newSimChain(t)
+	ctx := t.Context()
+	m := newNonceManager(chain.Client())
+
+	var wg sync.WaitGroup
+	hashes := make(chan common.Hash, senders)
+	errs := make(chan error, senders)
+	for range senders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := m.Next(ctx, testAddr)
+			if err != nil {
+				errs <- err
+				return
+			}
+			tx, err := signTransfer(n)
+			if err == nil {
+				err = chain.Client().SendTransaction(ctx, tx)
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+			hashes <- tx.Hash()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	close(hashes)
+	for err := range errs {
+		t.Error(err)
+	}
+	if t.Failed() {
+		return
+	}
+	chain.Commit()
+
+	seen := map[uint64]bool{}
+	for h := range hashes {
+		rcpt, err := chain.Client().TransactionReceipt(ctx, h)
+		if err != nil {
+			t.Fatalf("receipt of %s: %v", h.Hex(), err)
+		}
+		if rcpt.BlockNumber.Uint64() != 1 {
+			t.Errorf("%s mined in block %d, want 1", h.Hex(), rcpt.BlockNumber)
+		}
+		tx, _, err := chain.Client().TransactionByHash(ctx, h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[tx.Nonce()] {
+			t.Errorf("nonce %d handed out twice", tx.Nonce())
+		}
+		seen[tx.Nonce()] = true
+	}
+	for n := range uint64(senders) {
+		if !seen[n] {
+			t.Errorf("nonce %d was never used", n)
+		}
+	}
+	if mined, _ := chain.Client().NonceAt(ctx, testAddr, nil); mined != senders {
+		t.Errorf("account nonce after the block = %d, want %d", mined, senders)
+	}
+	if next, _ := m.Peek(ctx, testAddr); next != senders {
+		t.Errorf("next nonce = %d, want %d", next, senders)
+	}
+}
+
+func TestNonceManagerReset(t *testing.T) {
+	chain := newSimChain(t)
+	ctx := t.Context()
+	m := newNonceManager(chain.Client())
+
+	// Another sender takes nonce 1 behind the manager's back.
+	if n, _ := m.Next(ctx, testAddr); n != 0 {
+		t.Fatalf("first nonce = %d, want 0", n)
+	}
+	sendTransfer(t, chain, 0)
+	sendTransfer(t, chain, 1)
+	if n, _ := m.Next(ctx, testAddr); n != 1 {
+		t.Fatalf("second nonce = %d, want 1 before a resync", n)
+	}
+	m.Reset(testAddr)
+	if n, _ := m.Next(ctx, testAddr); n != 2 {
+		t.Fatalf("nonce after Reset = %d, want the pending nonce 2", n)
+	}
+}
@@ -0,0 +1,278 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// notifyAttempts is how many times a notification is posted before it is
+// given up on; notifyBackoff is the wait before the first retry, doubled
+// after each.
+const (
+	notifyAttempts = 3
+	notifyBackoff  = time.Second
+)
+
+// Notification is what --notify-url is posted at the end of a run. Fee is
+// the total fee of the mined transactions in wei; Error, on a failure,
+// carries the decoded revert reason when there was one.
+type Notification struct {
+	Command  string `json:"command"`
+	Success  bool   `json:"success"`
+	Chain    string `json:"chain,omitempty"`
+	ChainID  string `json:"chainId,omitempty"`
+	Contract string `json:"contract,omitempty"`
+	Address  string `json:"address,omitempty"`
+	TxHash   string `json:"txHash,omitempty"`
+	GasUsed  uint64 `json:"gasUsed,omitempty"`
+	Fee      string `json:"fee,omitempty"`
+	Explorer string `json:"explorer,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// notifier posts a run's outcome to a webhook.
+type notifier struct {
+	ui     *logger
+	url    string
+	format string
+}
+
+// notify is the commands' notifier; options.register configures it and
+// Main sends through it once the command returns.
+var notify = cli.notify
+
+func (n *notifier) register(fs *flag.FlagSet) {
+	fs.Func("notify-url", "post the run's outcome as JSON to this https `endpoint` when it finishes, e.g. a Slack incoming webhook", func(v string) error {
+		u, err := url.Parse(v)
+		if err != nil || u.Host == "" {
+			return errors.New("want an https URL")
+		}
+		if u.Scheme != "https" && !(u.Scheme == "http" && isLoopback(u.Hostname())) {
+			return errors.New("want an https URL (http only to localhost)")
+		}
+		n.url = v
+		return nil
+	})
+	fs.Func("notify-format", "body --notify-url is sent: json (default) or slack, a message Slack incoming webhooks accept", func(v string) error {
+		if v != "json" && v != "slack" {
+			return errors.New("want json or slack")
+		}
+		n.format = v
+		return nil
+	})
+}
+
+// isLoopback reports whether host names this machine.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// send posts the outcome of the run that ended with err. It only ever
+// warns: a webhook that is down does not fail a deploy that went through.
+// It still runs after an interrupt, so a cancelled run is reported too.
+func (n *notifier) send(ctx context.Context, err error) {
+	if n.url == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+	msg := newNotification(n.ui, err)
+	var body interface{} = msg
+	if n.format == "slack" {
+		body = slackMessage(msg)
+	}
+	raw, jerr := json.Marshal(body)
+	if jerr != nil {
+		n.ui.Warnf("warning: notify: %v\n", jerr)
+		return
+	}
+	backoff := notifyBackoff
+	for attempt := 1; ; attempt++ {
+		retry, perr := n.post(ctx, raw)
+		if perr == nil {
+			n.ui.Verbosef("Notified %s\n", redactURL(n.url))
+			return
+		}
+		if !retry || attempt == notifyAttempts {
+			n.ui.Warnf("warning: notify %s: %v\n", redactURL(n.url), perr)
+			return
+		}
+		n.ui.Verbosef("notify %s: %v; retrying in %s\n", redactURL(n.url), perr, backoff)
+		select {
+		case <-ctx.Done():
+			n.ui.Warnf("warning: notify %s: %v\n", redactURL(n.url), perr)
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends raw once, and reports whether a failure is worth retrying:
+// network errors, rate limiting and server errors are, anything else the
+// endpoint rejected is not. Errors never include the URL, which for most
+// webhooks is itself the secret.
+func (n *notifier) post(ctx context.Context, raw []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(raw))
+	if err != nil {
+		return false, errors.New("bad URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := (&http.Client{Timeout: 15 * time.Second}).Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return true, err
+	}
+	defer resp.Body.Close()
+	reply, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	err = fmt.Errorf("%s", resp.Status)
+	if text := strings.TrimSpace(string(reply)); text != "" {
+		err = fmt.Errorf("%s: %s", resp.Status, text)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// redactURL is u as it can be logged: scheme and host only, since
+// webhook URLs carry their token in the path, query or user info. IPC
+// socket paths are shown whole.
+func redactURL(u string) string {
+	if isIPC(u) {
+		return u
+	}
+	p, err := url.Parse(u)
+	if err != nil {
+		return "<redacted URL>"
+	}
+	if p.Path == "" && p.RawQuery == "" && p.User == nil {
+		return p.Scheme + "://" + p.Host
+	}
+	return p.Scheme + "://" + p.Host + "/<redacted>"
+}
+
+// redactURLs is urls with redactURL applied to each.
+func redactURLs(urls []string) []string {
+	out := make([]string, len(urls))
+	for i, u := range urls {
+		out[i] = redactURL(u)
+	}
+	return out
+}
+
+// redactedError is an error whose text has a URL redacted; errors.Is and
+// errors.As still see the original.
+type redactedError struct {
+	err  error
+	text string
+}
+
+func (e *redactedError) Error() string { return e.text }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactErr hides u in err's text, as net/http and WebSocket errors quote
+// the URL they failed on. It returns err unchanged when u does not appear.
+func redactErr(err error, u string) error {
+	if err == nil || isIPC(u) {
+		return err
+	}
+	text := err.Error()
+	forms := []string{u}
+	if p, perr := url.Parse(u); perr == nil {
+		forms = append(forms, p.String(), p.Redacted())
+	}
+	redacted := text
+	for _, f := range forms {
+		redacted = strings.ReplaceAll(redacted, f, redactURL(u))
+	}
+	if redacted == text {
+		return err
+	}
+	return &redactedError{err: err, text: redacted}
+}
+
+// newNotification summarizes the run's report, as l holds it, and err,
+// how it ended. The transaction is the contract's deploy, else the last
+// one mined.
+func newNotification(l *logger, err error) *Notification {
+	r := &l.report
+	n := &Notification{Command: r.Command, Success: err == nil, ChainID: r.ChainID}
+	if id, ok := new(big.Int).SetString(r.ChainID, 10); ok {
+		n.Chain = chainName(id)
+	}
+	if c := r.Contract; c != nil {
+		n.Contract, n.Address = c.Name, c.Address.Hex()
+		n.Explorer = l.explorerURL("address", n.Address)
+		if c.Deploy != nil {
+			n.TxHash = c.Deploy.Hash.Hex()
+		}
+	}
+	if n.TxHash == "" && len(r.Transactions) > 0 {
+		n.TxHash = r.Transactions[len(r.Transactions)-1].Hash.Hex()
+	}
+	if n.Explorer == "" && n.TxHash != "" {
+		n.Explorer = l.explorerURL("tx", n.TxHash)
+	}
+	if g := r.Gas; g != nil {
+		n.GasUsed, n.Fee = g.TotalGas, g.TotalFee
+	}
+	if err != nil {
+		n.Error = err.Error()
+	}
+	return n
+}
+
+// slackMessage wraps n for a Slack incoming webhook: a headline, and the
+// details in an attachment colored by the outcome.
+func slackMessage(n *Notification) map[string]interface{} {
+	what := n.Command
+	if n.Contract != "" {
+		what += " " + n.Contract
+	}
+	where := n.Chain
+	if where == "" {
+		where = "unknown chain"
+	}
+	text, color := fmt.Sprintf("nyc2025 %s on %s succeeded", what, where), "good"
+	if !n.Success {
+		text, color = fmt.Sprintf("nyc2025 %s on %s failed", what, where), "danger"
+	}
+	var lines []string
+	add := func(label, v string) {
+		if v != "" {
+			lines = append(lines, label+": "+v)
+		}
+	}
+	add("Address", n.Address)
+	add("Tx", n.TxHash)
+	if fee, ok := new(big.Int).SetString(n.Fee, 10); ok {
+		add("Cost", fmt.Sprintf("%s ETH (%d gas)", formatEther(fee), n.GasUsed))
+	}
+	add("Explorer", n.Explorer)
+	add("Error", n.Error)
+	return map[string]interface{}{
+		"text": text,
+		"attachments": []map[string]interface{}{
+			{"color": color, "text": strings.Join(lines, "\n"), "fallback": text},
+		},
+	}
+}
@@ -0,0 +1,213 @@
+package deployer
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// webhook records what is posted to it, answering with the statuses in
+// replies in turn and then 200.
+type webhook struct {
+	url string
+
+	mu      sync.Mutex
+	bodies  [][]byte
+	types   []string
+	replies []int
+}
+
+func newWebhook(t *testing.T, replies ...int) *webhook {
+	t.Helper()
+	h := &webhook{replies: replies}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.bodies = append(h.bodies, body)
+		h.types = append(h.types, r.Header.Get("Content-Type"))
+		if len(h.replies) > 0 {
+			w.WriteHeader(h.replies[0])
+			io.WriteString(w, "no thanks")
+			h.replies = h.replies[1:]
+		}
+	}))
+	t.Cleanup(srv.Close)
+	h.url = srv.URL + "/hooks/T000/s3cr3t"
+	return h
+}
+
+func (h *webhook) posts() [][]byte {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.bodies
+}
+
+// deployed sets up the report of a Greeter deploy on Sepolia, and the
+// notifier to post to url as format, until the test ends.
+func deployed(t *testing.T, url, format string) {
+	t.Helper()
+	report, explorer, n := ui.report, ui.explorer, *notify
+	t.Cleanup(func() { ui.report, ui.explorer, *notify = report, explorer, n })
+	ui.report = Report{Command: "deploy"}
+	ui.setChain(big.NewInt(11155111), "")
+	ui.report.Contract = &ContractReport{
+		Name:    "Greeter",
+		Address: common.HexToAddress("0x5FbDB2315678afecb367f032d93F642f64180aa3"),
+		Deploy:  &TxReport{Hash: common.HexToHash("0x01"), Status: 1, GasUsed: 250_000},
+	}
+	ui.report.Gas = &GasReport{TotalGas: 250_000, TotalFee: "500000000000000"}
+	notify.url, notify.format = url, format
+}
+
+func TestNotifyJSON(t *testing.T) {
+	hook := newWebhook(t)
+	deployed(t, hook.url, "json")
+	notify.send(t.Context(), nil)
+
+	posts := hook.posts()
+	if len(posts) != 1 || hook.types[0] != "application/json" {
+		t.Fatalf("posted %d times (%v), want one JSON post", len(posts), hook.types)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(posts[0], &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"command":  "deploy",
+		"success":  true,
+		"chain":    "Sepolia",
+		"chainId":  "11155111",
+		"contract": "Greeter",
+		"address":  "0x5FbDB2315678afecb367f032d93F642f64180aa3",
+		"txHash":   "0x0000000000000000000000000000000000000000000000000000000000000001",
+		"gasUsed":  float64(250_000),
+		"fee":      "500000000000000",
+		"explorer": "https://sepolia.etherscan.io/address/0x5FbDB2315678afecb367f032d93F642f64180aa3",
+	}
+	if len(got) != len(want) {
+		t.Errorf("payload has fields %v, want %d", got, len(want))
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("payload %s = %v, want %v", k, got[k], v)
+		}
+	}
+
+	// A failure carries the error; the address is absent without one.
+	ui.report.Contract = nil
+	notify.send(t.Context(), errors.New("deployment failed: status 0: greeting must be 1-32 bytes"))
+	var failed Notification
+	if err := json.Unmarshal(hook.posts()[1], &failed); err != nil {
+		t.Fatal(err)
+	}
+	if failed.Success || failed.Error != "deployment failed: status 0: greeting must be 1-32 bytes" || failed.Address != "" || failed.TxHash != "" {
+		t.Fatalf("failure payload = %+v", failed)
+	}
+}
+
+func TestNotifySlack(t *testing.T) {
+	hook := newWebhook(t)
+	deployed(t, hook.url, "slack")
+	notify.send(t.Context(), nil)
+
+	var msg struct {
+		Text        string `json:"text"`
+		Attachments []struct {
+			Color, Text, Fallback string
+		} `json:"attachments"`
+	}
+	if err := json.Unmarshal(hook.posts()[0], &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Text != "nyc2025 deploy Greeter on Sepolia succeeded" || len(msg.Attachments) != 1 {
+		t.Fatalf("slack message = %+v", msg)
+	}
+	a := msg.Attachments[0]
+	for _, line := range []string{
+		"Address: 0x5FbDB2315678afecb367f032d93F642f64180aa3",
+		"Cost: 0.0005 ETH (250000 gas)",
+		"Explorer: https://sepolia.etherscan.io/address/",
+	} {
+		if !strings.Contains(a.Text, line) {
+			t.Errorf("attachment %q lacks %q", a.Text, line)
+		}
+	}
+	if a.Color != "good" || a.Fallback != msg.Text {
+		t.Errorf("attachment color %q, fallback %q", a.Color, a.Fallback)
+	}
+
+	notify.send(t.Context(), errors.New("boom"))
+	if err := json.Unmarshal(hook.posts()[1], &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Text != "nyc2025 deploy Greeter on Sepolia failed" || msg.Attachments[0].Color != "danger" || !strings.Contains(msg.Attachments[0].Text, "Error: boom") {
+		t.Fatalf("slack failure message = %+v", msg)
+	}
+}
+
+func TestNotifyRetry(t *testing.T) {
+	warned := warnings(t)
+
+	// A server error is retried after the backoff.
+	hook := newWebhook(t, http.StatusServiceUnavailable)
+	deployed(t, hook.url, "json")
+	start := time.Now()
+	notify.send(t.Context(), nil)
+	if n := len(hook.posts()); n != 2 || time.Since(start) < notifyBackoff {
+		t.Fatalf("posted %d times in %s after a 503, want a retry after %s", n, time.Since(start), notifyBackoff)
+	}
+	if warned.Len() != 0 {
+		t.Fatalf("warned %q after a successful retry", warned)
+	}
+
+	// A rejection is not, and the warning keeps the token out.
+	hook = newWebhook(t, http.StatusBadRequest)
+	notify.url = hook.url
+	notify.send(t.Context(), nil)
+	if n := len(hook.posts()); n != 1 {
+		t.Fatalf("posted %d times after a 400, want once", n)
+	}
+	w := warned.String()
+	if !strings.Contains(w, "/<redacted>: 400 Bad Request: no thanks") || strings.Contains(w, "s3cr3t") {
+		t.Fatalf("warning %q, want the 400 with the URL redacted", w)
+	}
+}
+
+func TestNotifyFlags(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--notify-url", "http://hooks.example.com/x"}, "http only to localhost"},
+		{[]string{"--notify-url", "ftp://hooks.example.com/x"}, "want an https URL"},
+		{[]string{"--notify-url", "/just/a/path"}, "want an https URL"},
+		{[]string{"--notify-format", "xml"}, "want json or slack"},
+	} {
+		var n notifier
+		fs := flag.NewFlagSet("deploy", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		n.register(fs)
+		if err := fs.Parse(tt.args); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%v = %v, want %q", tt.args, err, tt.want)
+		}
+	}
+	for _, u := range []string{"https://hooks.slack.com/services/T/B/x", "http://localhost:8080/hook", "http://127.0.0.1/hook", "http://[::1]/hook"} {
+		var n notifier
+		fs := flag.NewFlagSet("deploy", flag.ContinueOnError)
+		n.register(fs)
+		if err := fs.Parse([]string{"--notify-url", u}); err != nil || n.url != u {
+			t.Errorf("--notify-url %s = %v", u, err)
+		}
+	}
+}
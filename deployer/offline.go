@@ -0,0 +1,282 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// offlineOptions make deploy and send sign without a node and write the
+// raw transaction out instead of broadcasting it.
+type offlineOptions struct {
+	enabled bool
+	chainID uint64
+	out     string
+}
+
+func (o *offlineOptions) register(fs *flag.FlagSet) {
+	fs.BoolVar(&o.enabled, "offline", false, "sign without contacting a node and print the raw transaction (needs --chain-id, --nonce, --gas-limit, --max-fee)")
+	fs.Uint64Var(&o.chainID, "chain-id", 0, "chain ID to sign for with --offline")
+	fs.StringVar(&o.out, "raw-out", "", "with --offline, write the raw transaction to this file instead of stdout")
+}
+
+// signOffline builds a transaction to to (nil deploys) carrying data from
+// explicit flag values only, signs it and writes its hex encoding out.
+// Fees are EIP-1559 when --priority-fee is given, legacy otherwise.
+func signOffline(o *options, oo offlineOptions, txo txOptions, to *common.Address, data []byte) (*types.Transaction, error) {
+	var missing []string
+	if oo.chainID == 0 {
+		missing = append(missing, "--chain-id")
+	}
+	if txo.nonce < 0 {
+		missing = append(missing, "--nonce")
+	}
+	if txo.gasLimit == 0 {
+		missing = append(missing, "--gas-limit")
+	}
+	if o.maxFee == "" {
+		missing = append(missing, "--max-fee")
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("--offline cannot ask the node, so it needs %s", strings.Join(missing, ", "))
+	}
+	value, err := parseValue(txo.value)
+	if err != nil {
+		return nil, fmt.Errorf("--value: %w", err)
+	}
+	if value == nil {
+		value = new(big.Int)
+	}
+	maxFee, err := parseValue(o.maxFee)
+	if err != nil {
+		return nil, fmt.Errorf("--max-fee: %w", err)
+	}
+	tip, err := parseValue(o.priorityFee)
+	if err != nil {
+		return nil, fmt.Errorf("--priority-fee: %w", err)
+	}
+
+	if err := checkExplorer(o.explorer); err != nil {
+		return nil, fmt.Errorf("--explorer-url: %w", err)
+	}
+	chainID := new(big.Int).SetUint64(oo.chainID)
+	ui.setChain(chainID, o.explorer)
+	signer, err := LoadSigner(o.keys)
+	if err != nil {
+		return nil, err
+	}
+	ui.Printf("Signer: %s (%s)\n", signer.Address.Hex(), signer.Source)
+	ui.report.Deployer = &signer.Address
+	auth, err := signer.TransactOpts(chainID)
+	if err != nil {
+		return nil, fmt.Errorf("transactor: %w", err)
+	}
+
+	var inner types.TxData
+	if tip != nil {
+		if maxFee.Cmp(tip) < 0 {
+			return nil, fmt.Errorf("max fee %s is below priority fee %s", maxFee, tip)
+		}
+		inner = &types.DynamicFeeTx{ChainID: chainID, Nonce: uint64(txo.nonce), GasTipCap: tip, GasFeeCap: maxFee, Gas: txo.gasLimit, To: to, Value: value, Data: data}
+	} else {
+		inner = &types.LegacyTx{Nonce: uint64(txo.nonce), GasPrice: maxFee, Gas: txo.gasLimit, To: to, Value: value, Data: data}
+	}
+	tx, err := auth.Signer(signer.Address, types.NewTx(inner))
+	if err != nil {
+		return nil, fmt.Errorf("sign: %w", err)
+	}
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("encode: %w", err)
+	}
+
+	ui.Printf("Signed tx: %s (type %d, nonce %d, gas limit %d, %s)\n", tx.Hash().Hex(), tx.Type(), tx.Nonce(), tx.Gas(), describeTxFees(tx))
+	report := &SignedTxReport{Hash: tx.Hash(), Nonce: tx.Nonce(), Raw: formatValue(raw)}
+	if to == nil {
+		addr := crypto.CreateAddress(signer.Address, tx.Nonce())
+		ui.Println("Contract address (once broadcast):", addr.Hex())
+		report.Address = &addr
+	}
+	ui.report.Signed = report
+
+	switch {
+	case oo.out != "":
+		if err := os.WriteFile(oo.out, []byte(report.Raw+"\n"), 0o644); err != nil {
+			return nil, fmt.Errorf("--raw-out: %w", err)
+		}
+		ui.Printf("Raw transaction written to %s\n", oo.out)
+	default:
+		ui.Resultln(report.Raw)
+	}
+	return tx, nil
+}
+
+// offlineDeploy signs c's deployment (plain or CREATE2) for broadcasting
+// elsewhere. Libraries are linked from --libraries or the local manifests.
+func offlineDeploy(o *options, oo offlineOptions, c *Artifact, dopts deployOptions, args []interface{}) error {
+	libs, err := parseLibraries(dopts.link.libraries)
+	if err != nil {
+		return err
+	}
+	if err := linkLibraries(c, libs, o.deployments, new(big.Int).SetUint64(oo.chainID)); err != nil {
+		return err
+	}
+	if err := c.checkLinked(); err != nil {
+		return err
+	}
+	if err := checkPayable(c.Name+" constructor", &c.ABI.Constructor, dopts.tx); err != nil {
+		return err
+	}
+	code, err := initCode(c, args)
+	if err != nil {
+		return err
+	}
+	if !dopts.create2 {
+		_, err = signOffline(o, oo, dopts.tx, nil, code)
+		return err
+	}
+	salt, err := parseSalt(dopts.salt)
+	if err != nil {
+		return err
+	}
+	ui.Println("CREATE2 address (once broadcast):", create2Address(salt, code).Hex())
+	to := deterministicDeployer
+	_, err = signOffline(o, oo, dopts.tx, &to, append(salt[:], code...))
+	return err
+}
+
+// readRawTx reads a hex-encoded signed transaction from path, or stdin
+// when path is "-".
+func readRawTx(path string) (*types.Transaction, error) {
+	var raw []byte
+	var err error
+	if path == "-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read raw tx: %w", err)
+	}
+	s := string(bytes.TrimSpace(raw))
+	if !strings.HasPrefix(s, "0x") {
+		s = "0x" + s
+	}
+	b := common.FromHex(s)
+	if len(b) == 0 {
+		return nil, fmt.Errorf("%s holds no transaction", path)
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(b); err != nil {
+		return nil, fmt.Errorf("decode raw tx: %w", err)
+	}
+	return tx, nil
+}
+
+// runBroadcast implements `broadcast [flags] <rawtx.hex|->`: submit a
+// transaction signed with --offline and wait for it. With --contract or
+// --artifact, a deployment is recorded in the manifest.
+func runBroadcast(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("broadcast", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	o.register(fs)
+	ao.register(fs, "")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: broadcast [flags] <rawtx.hex|->")
+	}
+	tx, err := readRawTx(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	s, err := newSession(&o)
+	if err != nil {
+		return err
+	}
+	// Replacing needs the key, which stays on the offline machine.
+	s.bump = bumpPolicy{}
+	if s.client, s.chainID, err = connect(ctx, &o); err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if tx.Protected() && tx.ChainId().Cmp(s.chainID) != 0 {
+		return classify(ErrChainMismatch, fmt.Errorf("transaction is signed for chain %s, node is on chain %s", tx.ChainId(), s.chainID))
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return fmt.Errorf("recover sender: %w", err)
+	}
+	s.from = from
+	ui.report.Deployer = &from
+	ui.Printf("Broadcasting %s from %s (nonce %d)\n", tx.Hash().Hex(), from.Hex(), tx.Nonce())
+	ui.link("tx", tx.Hash().Hex())
+	if err := s.client.SendTransaction(ctx, tx); err != nil {
+		return fmt.Errorf("broadcast: %w", err)
+	}
+
+	rcpt, err := s.waitMined(ctx, tx)
+	if err != nil {
+		return err
+	}
+	ui.Printf("  status %d, block %s, gas used %d\n", rcpt.Status, rcpt.BlockNumber, rcpt.GasUsed)
+	if rcpt.Status != 1 {
+		reason := failureReason(ctx, s.client, tx, rcpt, nil)
+		return &RevertError{TxHash: tx.Hash(), Reason: reason, msg: fmt.Sprintf("tx %s failed: status %d: %s", tx.Hash().Hex(), rcpt.Status, reason)}
+	}
+	if tx.To() != nil {
+		ui.report.Transactions = append(ui.report.Transactions, *newTxReport("", rcpt, printEvents(ui, rcpt, nil)))
+		return nil
+	}
+
+	if err := s.checkCode(ctx, rcpt.ContractAddress, rcpt); err != nil {
+		return err
+	}
+	ui.Println("Contract deployed at:", rcpt.ContractAddress.Hex())
+	ui.link("address", rcpt.ContractAddress.Hex())
+	if ao.path == "" && ao.contract == "" {
+		ui.report.Contract = &ContractReport{Address: rcpt.ContractAddress, Deploy: newTxReport("constructor", rcpt, nil)}
+		ui.Println("Not recorded in a manifest; pass --contract to record it")
+		return nil
+	}
+	path, contract, err := ao.resolve()
+	if err != nil {
+		return err
+	}
+	c, err := loadArtifact(path, contract)
+	if err != nil {
+		return err
+	}
+	if err := linkLibraries(c, nil, o.deployments, s.chainID); err != nil {
+		return err
+	}
+	s.reportDeploy(c, rcpt.ContractAddress, rcpt)
+	if !bytes.HasPrefix(tx.Data(), c.Bytecode) {
+		ui.Warnf("deployed code does not start with %s's bytecode; not recorded\n", c.Name)
+		return nil
+	}
+	ctorArgs, err := c.ABI.Constructor.Inputs.Unpack(tx.Data()[len(c.Bytecode):])
+	if err != nil {
+		return fmt.Errorf("decode constructor args: %w", err)
+	}
+	d, err := recordDeployment(o.deployments, s.chainID, c, ctorArgs, newDeployment(from, rcpt.ContractAddress, rcpt))
+	if err != nil {
+		return err
+	}
+	ui.Printf("Recorded %s v%d in %s\n", c.Name, d.Version, manifestPath(o.deployments, s.chainID, c.Name))
+	return nil
+}
@@ -0,0 +1,694 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Report is the document `--output json` prints on stdout when a command
+// finishes. Fields are only ever added, never renamed or removed; empty
+// ones are omitted. Wei amounts are decimal strings.
+type Report struct {
+	Command      string            `json:"command"`
+	ChainID      string            `json:"chainId,omitempty"`
+	Deployer     *common.Address   `json:"deployer,omitempty"`
+	Contract     *ContractReport   `json:"contract,omitempty"`
+	Transactions []TxReport        `json:"transactions,omitempty"`
+	Calls        []CallReport      `json:"calls,omitempty"`
+	DryRun       *DryRunReport     `json:"dryRun,omitempty"`
+	Signed       *SignedTxReport   `json:"signed,omitempty"`
+	Snapshot     string            `json:"snapshot,omitempty"`
+	Token        *TokenReport      `json:"token,omitempty"`
+	NFT          *NFTReport        `json:"nft,omitempty"`
+	TypedData    *SignatureReport  `json:"typedData,omitempty"`
+	Permit       *PermitReport     `json:"permit,omitempty"`
+	Safe         *SafeReport       `json:"safe,omitempty"`
+	Decoded      *DecodedReport    `json:"decoded,omitempty"`
+	Storage      []StorageReport   `json:"storage,omitempty"`
+	Layout       []LayoutReport    `json:"layout,omitempty"`
+	Variable     *VariableReport   `json:"variable,omitempty"`
+	Proxy        *ProxyReport      `json:"proxy,omitempty"`
+	Ownership    *OwnershipReport  `json:"ownership,omitempty"`
+	Interfaces   *InterfacesReport `json:"interfaces,omitempty"`
+	Message      *SignatureReport  `json:"message,omitempty"`
+	Deployments  []*manifest       `json:"deployments,omitempty"`
+	Import       *ImportReport     `json:"import,omitempty"`
+	Journal      *JournalReport    `json:"journal,omitempty"`
+	Predicted    *PredictedReport  `json:"predicted,omitempty"`
+	Salt         *SaltReport       `json:"salt,omitempty"`
+	ABI          *ABIReport        `json:"abi,omitempty"`
+	Account      *AccountReport    `json:"account,omitempty"`
+	Balances     []BalanceReport   `json:"balances,omitempty"`
+	Funding      []FundingReport   `json:"funding,omitempty"`
+	Blocks       []BlockReport     `json:"blocks,omitempty"`
+	Bytecode     *BytecodeReport   `json:"bytecode,omitempty"`
+	BlocksSeen   *BlocksSummary    `json:"blocksSeen,omitempty"`
+	Bundle       *BundleReport     `json:"bundle,omitempty"`
+	Steps        []StepReport      `json:"steps,omitempty"`
+	Keeper       *KeeperReport     `json:"keeper,omitempty"`
+	Logs         []LogReport       `json:"logs,omitempty"`
+	Gas          *GasReport        `json:"gas,omitempty"`
+	Replay       *ReplayReport     `json:"replay,omitempty"`
+	Receipt      *ReceiptReport    `json:"receipt,omitempty"`
+	Trace        json.RawMessage   `json:"trace,omitempty"`
+	Config       *effectiveConfig  `json:"config,omitempty"`
+	Chains       []ChainReport     `json:"chains,omitempty"`
+	Error        *ErrorReport      `json:"error,omitempty"`
+}
+
+// ChainReport is one entry of the chain registry, as `chains list`
+// prints it. BlockTime is in milliseconds, 0 when unknown.
+type ChainReport struct {
+	ID          uint64   `json:"id"`
+	Alias       string   `json:"alias,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Symbol      string   `json:"symbol,omitempty"`
+	Decimals    uint8    `json:"decimals,omitempty"`
+	RPCs        []string `json:"rpcs,omitempty"`
+	Explorer    string   `json:"explorer,omitempty"`
+	ExplorerAPI string   `json:"explorerApi,omitempty"`
+	EIP1559     bool     `json:"eip1559"`
+	OPStack     bool     `json:"opStack,omitempty"`
+	BlockTime   int64    `json:"blockTime,omitempty"`
+	Production  bool     `json:"production,omitempty"`
+	SafeService string   `json:"safeService,omitempty"`
+}
+
+// ContractReport is the contract a deploy (or the demo) ended up using.
+type ContractReport struct {
+	Name    string         `json:"name"`
+	Address common.Address `json:"address"`
+	// Reused is set when an existing deployment was used instead of
+	// sending a new one; Deploy is then absent.
+	Reused bool      `json:"reused,omitempty"`
+	Deploy *TxReport `json:"deploy,omitempty"`
+}
+
+// TxReport is one mined transaction.
+type TxReport struct {
+	Method            string         `json:"method,omitempty"`
+	Hash              common.Hash    `json:"hash"`
+	Status            uint64         `json:"status"`
+	Block             uint64         `json:"block"`
+	GasUsed           uint64         `json:"gasUsed"`
+	EffectiveGasPrice string         `json:"effectiveGasPrice,omitempty"`
+	BlobGasUsed       uint64         `json:"blobGasUsed,omitempty"`
+	BlobGasPrice      string         `json:"blobGasPrice,omitempty"`
+	Events            []decodedEvent `json:"events,omitempty"`
+}
+
+// CallReport is one view call and its decoded results.
+type CallReport struct {
+	Method  string       `json:"method"`
+	Results []typedValue `json:"results"`
+	// Address and Error are set for the calls of `call --batch`.
+	Address *common.Address `json:"address,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// TokenReport is an ERC-20 token read by `erc20`. Amounts are in the
+// token's smallest unit.
+type TokenReport struct {
+	Address     common.Address `json:"address"`
+	Name        string         `json:"name,omitempty"`
+	Symbol      string         `json:"symbol,omitempty"`
+	Decimals    uint8          `json:"decimals"`
+	TotalSupply string         `json:"totalSupply,omitempty"`
+	Balance     string         `json:"balance,omitempty"`
+	Allowance   string         `json:"allowance,omitempty"`
+}
+
+// NFTReport is what an erc721 or erc1155 read found. Standard is
+// "erc721" or "erc1155"; URI has {id} substituted. Metadata is the
+// document fetched from MetadataURL (empty for data: URIs) with --fetch,
+// when it is JSON.
+type NFTReport struct {
+	Address     common.Address  `json:"address"`
+	Standard    string          `json:"standard"`
+	Name        string          `json:"name,omitempty"`
+	Symbol      string          `json:"symbol,omitempty"`
+	TokenID     string          `json:"tokenId,omitempty"`
+	Owner       *common.Address `json:"owner,omitempty"`
+	Holder      *common.Address `json:"holder,omitempty"`
+	Balance     string          `json:"balance,omitempty"`
+	URI         string          `json:"uri,omitempty"`
+	MetadataURL string          `json:"metadataUrl,omitempty"`
+	Metadata    json.RawMessage `json:"metadata,omitempty"`
+}
+
+// SignatureReport is a signature made or checked by sign-typed-data,
+// verify-typed-data, sign-message or verify-message. Digest is the hash
+// that was signed; V is 27 or 28.
+type SignatureReport struct {
+	Digest    string         `json:"digest"`
+	Signer    common.Address `json:"signer"`
+	Signature string         `json:"signature"`
+	R         string         `json:"r"`
+	S         string         `json:"s"`
+	V         byte           `json:"v"`
+}
+
+// PermitReport is the Permit signed by `erc20 permit`; its signature is
+// in TypedData. Value is set for EIP-2612 permits, Allowed for DAI's.
+type PermitReport struct {
+	Owner    common.Address `json:"owner"`
+	Spender  common.Address `json:"spender"`
+	Value    string         `json:"value,omitempty"`
+	Allowed  bool           `json:"allowed,omitempty"`
+	Nonce    string         `json:"nonce"`
+	Deadline string         `json:"deadline"`
+}
+
+// SafeReport is a Safe transaction made with --via-safe: proposed to
+// Service, signed by Sender for the owners to collect, or Executed.
+type SafeReport struct {
+	Safe       common.Address   `json:"safe"`
+	Version    string           `json:"version,omitempty"`
+	Threshold  uint64           `json:"threshold"`
+	Owners     []common.Address `json:"owners"`
+	To         common.Address   `json:"to"`
+	Value      string           `json:"value"`
+	Data       string           `json:"data"`
+	Nonce      string           `json:"nonce"`
+	SafeTxHash common.Hash      `json:"safeTxHash"`
+	Sender     *common.Address  `json:"sender,omitempty"`
+	Signature  string           `json:"signature,omitempty"`
+	Service    string           `json:"service,omitempty"`
+	Executed   bool             `json:"executed,omitempty"`
+}
+
+// DecodedReport is calldata decoded by `decode`. Function is the method
+// signature, or "constructor" for creation code. Hash, From, To, Value
+// and Nonce are set by `decode tx`, To only when it is not a creation.
+type DecodedReport struct {
+	Hash     *common.Hash    `json:"hash,omitempty"`
+	From     *common.Address `json:"from,omitempty"`
+	To       *common.Address `json:"to,omitempty"`
+	Value    string          `json:"value,omitempty"`
+	Nonce    *uint64         `json:"nonce,omitempty"`
+	Contract string          `json:"contract,omitempty"`
+	Function string          `json:"function,omitempty"`
+	Selector string          `json:"selector,omitempty"`
+	Args     []typedValue    `json:"args,omitempty"`
+
+	// Candidates are the signatures sharing the selector, when there were
+	// several and the one used came from the selector database.
+	Candidates []string `json:"candidates,omitempty"`
+}
+
+// StorageReport is one storage word read by `storage` or `proxy info`.
+// AsAddress is set when the word holds an address.
+type StorageReport struct {
+	Address   common.Address  `json:"address"`
+	Slot      common.Hash     `json:"slot"`
+	Value     common.Hash     `json:"value"`
+	AsAddress *common.Address `json:"asAddress,omitempty"`
+}
+
+// LayoutReport is one row of `storage-layout`: a state variable, or a
+// struct member named variable.member with its absolute slot.
+type LayoutReport struct {
+	Name     string `json:"name"`
+	Contract string `json:"contract,omitempty"`
+	Slot     string `json:"slot"`
+	Offset   int    `json:"offset"`
+	Bytes    int    `json:"bytes"`
+	Type     string `json:"type"`
+}
+
+// VariableReport is a state variable `read-var` decoded through the
+// storage layout. The words it was read from are under storage.
+type VariableReport struct {
+	Address common.Address `json:"address"`
+	Name    string         `json:"name"`
+	Keys    []string       `json:"keys,omitempty"`
+	Type    string         `json:"type"`
+	Slot    common.Hash    `json:"slot"`
+	Offset  int            `json:"offset"`
+	Value   interface{}    `json:"value"`
+}
+
+// ProxyReport is what `proxy info` found in a contract's EIP-1967 slots,
+// or the proxy deploy --proxy created or upgrade changed.
+// Kind is "transparent", "uups", "beacon", "eip1967" when only the
+// implementation slot is set and the contract is not UUPS, or "none".
+type ProxyReport struct {
+	Address                common.Address  `json:"address"`
+	Kind                   string          `json:"kind"`
+	Implementation         *common.Address `json:"implementation,omitempty"`
+	Admin                  *common.Address `json:"admin,omitempty"`
+	Beacon                 *common.Address `json:"beacon,omitempty"`
+	ImplementationCodeHash *common.Hash    `json:"implementationCodeHash,omitempty"`
+
+	// Deploy and AdminDeploy are set when deploy --proxy created the
+	// proxy and its ProxyAdmin, Upgrade and PreviousImplementation after
+	// an upgrade.
+	Deploy                 *TxReport       `json:"deploy,omitempty"`
+	AdminDeploy            *TxReport       `json:"adminDeploy,omitempty"`
+	Upgrade                *TxReport       `json:"upgrade,omitempty"`
+	PreviousImplementation *common.Address `json:"previousImplementation,omitempty"`
+}
+
+// OwnershipReport is who `owner` found controlling a contract. The first
+// controller is the one its pattern order puts first: owner(), getOwner(),
+// DEFAULT_ADMIN_ROLE members, then the EIP-1967 admin and its owner().
+// CatchAll is set when the contract answers any call, and only its admin
+// slot could be read.
+type OwnershipReport struct {
+	Address       common.Address     `json:"address"`
+	CatchAll      bool               `json:"catchAll,omitempty"`
+	Controllers   []ControllerReport `json:"controllers,omitempty"`
+	Ownable       bool               `json:"ownable"`
+	TwoStep       bool               `json:"twoStep"`
+	PendingOwner  *common.Address    `json:"pendingOwner,omitempty"`
+	AccessControl bool               `json:"accessControl"`
+	Enumerable    bool               `json:"enumerable"`
+}
+
+// ControllerReport is one address in control of a contract and the
+// pattern that found it. Kind is "eoa", "eoa (EIP-7702 delegated)",
+// "contract" or "zero" when ownership was renounced.
+type ControllerReport struct {
+	Pattern string         `json:"pattern"`
+	Address common.Address `json:"address"`
+	Kind    string         `json:"kind"`
+}
+
+// InterfacesReport is what `interfaces` found a contract to implement.
+// ERC165 says whether it passes ERC-165 detection; without it only the
+// interfaces recognised by the calls they answer are listed. CatchAll is
+// set, with nothing listed, when it answers any call.
+type InterfacesReport struct {
+	Address    common.Address    `json:"address"`
+	ERC165     bool              `json:"erc165"`
+	CatchAll   bool              `json:"catchAll,omitempty"`
+	Interfaces []InterfaceReport `json:"interfaces,omitempty"`
+}
+
+// InterfaceReport is one interface and whether the contract has it. Via
+// is "supportsInterface" for an ERC-165 ID, otherwise the calls it was
+// recognised by; ID is empty for those.
+type InterfaceReport struct {
+	Name      string `json:"name"`
+	ID        string `json:"id,omitempty"`
+	Supported bool   `json:"supported"`
+	Via       string `json:"via"`
+}
+
+// ReplayReport is the outcome of `replay` next to the original's. Mode
+// is "fork" or "trace-call"; Status is "success", "reverted" or, when the
+// fork turned the transaction down unmined, "rejected".
+type ReplayReport struct {
+	Hash            common.Hash     `json:"hash"`
+	From            common.Address  `json:"from"`
+	To              *common.Address `json:"to,omitempty"`
+	Block           uint64          `json:"block"`
+	Mode            string          `json:"mode"`
+	OverrideInput   string          `json:"overrideInput,omitempty"`
+	OverrideValue   string          `json:"overrideValue,omitempty"`
+	Status          string          `json:"status"`
+	Reason          string          `json:"reason,omitempty"`
+	GasUsed         uint64          `json:"gasUsed,omitempty"`
+	Events          []decodedEvent  `json:"events,omitempty"`
+	OriginalStatus  uint64          `json:"originalStatus"`
+	OriginalGasUsed uint64          `json:"originalGasUsed"`
+}
+
+// DryRunReport is what a simulated deploy or send would have cost.
+// MaxCostUSD is set when an ETH price is known, L1Fee on OP Stack chains,
+// where MaxCost includes it, and the code sizes for a deployment.
+type DryRunReport struct {
+	EstimatedGas        uint64           `json:"estimatedGas"`
+	Intrinsic           *IntrinsicGas    `json:"intrinsic,omitempty"`
+	ExecutionGas        uint64           `json:"executionGas"`
+	MaxCost             string           `json:"maxCost"`
+	MaxCostUSD          string           `json:"maxCostUsd,omitempty"`
+	L1Fee               string           `json:"l1Fee,omitempty"`
+	AccessList          types.AccessList `json:"accessList,omitempty"`
+	Address             string           `json:"address,omitempty"`
+	BytecodeSize        int              `json:"bytecodeSize,omitempty"`
+	ConstructorArgsSize int              `json:"constructorArgsSize,omitempty"`
+	Results             []typedValue     `json:"results,omitempty"`
+}
+
+// SignedTxReport is a transaction signed with --offline. Address is the
+// contract a deployment will create.
+type SignedTxReport struct {
+	Hash    common.Hash     `json:"hash"`
+	Nonce   uint64          `json:"nonce"`
+	Raw     string          `json:"raw"`
+	Address *common.Address `json:"address,omitempty"`
+}
+
+// AccountReport is what an `account` subcommand printed. Balances are
+// in wei; BalanceAt is the balance at block At, when --block was given.
+// PrivateKey is only set by `account new --insecure-print-key`.
+type AccountReport struct {
+	Address      common.Address `json:"address"`
+	Source       string         `json:"source,omitempty"`
+	Keystore     string         `json:"keystore,omitempty"`
+	PrivateKey   string         `json:"privateKey,omitempty"`
+	Balance      string         `json:"balance,omitempty"`
+	Block        uint64         `json:"block,omitempty"`
+	BalanceAt    string         `json:"balanceAt,omitempty"`
+	At           uint64         `json:"at,omitempty"`
+	Nonce        *uint64        `json:"nonce,omitempty"`
+	PendingNonce *uint64        `json:"pendingNonce,omitempty"`
+}
+
+// BalanceReport is one address's native balance in wei, as `balances`
+// prints it.
+type BalanceReport struct {
+	Address common.Address `json:"address"`
+	Balance string         `json:"balance"`
+}
+
+// BlockReport is one block as `blocks` prints it. Utilization is the
+// percentage of the gas limit used; BaseFee is absent before London.
+// Transactions are listed with --full.
+type BlockReport struct {
+	Number       uint64        `json:"number"`
+	Hash         common.Hash   `json:"hash"`
+	Time         uint64        `json:"timestamp"`
+	GasUsed      uint64        `json:"gasUsed"`
+	GasLimit     uint64        `json:"gasLimit"`
+	Utilization  float64       `json:"utilization"`
+	BaseFee      string        `json:"baseFee,omitempty"`
+	TxCount      int           `json:"txCount"`
+	Transactions []common.Hash `json:"transactions,omitempty"`
+
+	baseFee *big.Int
+}
+
+// BlocksSummary is what `blocks --follow` saw before it was stopped.
+type BlocksSummary struct {
+	Seen           int    `json:"seen"`
+	First          uint64 `json:"first,omitempty"`
+	Last           uint64 `json:"last,omitempty"`
+	AverageBaseFee string `json:"averageBaseFee,omitempty"`
+}
+
+// BytecodeReport is how the code at Address compared with the runtime
+// code of Artifact: "match", "mismatch" or "no code". Lengths leave out
+// the metadata hash. On a mismatch, Offset is the first differing byte
+// and OnChain and Expected are the hex around it, that byte bracketed.
+type BytecodeReport struct {
+	Address        common.Address `json:"address"`
+	Artifact       string         `json:"artifact"`
+	Status         string         `json:"status"`
+	OnChainLength  int            `json:"onChainLength,omitempty"`
+	ExpectedLength int            `json:"expectedLength,omitempty"`
+	Offset         *int           `json:"offset,omitempty"`
+	OnChain        string         `json:"onChain,omitempty"`
+	Expected       string         `json:"expected,omitempty"`
+}
+
+// FundingReport is one account seeded by `fund`. Before and After are
+// its balance in wei, or in the token's base units with --token; Via is
+// anvil_setBalance or transfer.
+type FundingReport struct {
+	Address common.Address `json:"address"`
+	Before  string         `json:"before"`
+	After   string         `json:"after,omitempty"`
+	Via     string         `json:"via,omitempty"`
+	TxHash  *common.Hash   `json:"txHash,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// StepReport is the outcome of one plan step: done, failed, skipped
+// because a step it needs failed, or recorded by an earlier run.
+type StepReport struct {
+	Name    string            `json:"name"`
+	Kind    string            `json:"kind"`
+	Status  string            `json:"status"`
+	Error   string            `json:"error,omitempty"`
+	Outputs map[string]string `json:"outputs,omitempty"`
+
+	// GasUsed and Events are set by `plan simulate`.
+	GasUsed uint64         `json:"gasUsed,omitempty"`
+	Events  []decodedEvent `json:"events,omitempty"`
+}
+
+// BundleReport is the fate of a `run --bundle`: the last bundle hash the
+// relay returned, how many times a bundle was submitted, and the block it
+// landed in.
+type BundleReport struct {
+	Hash        string `json:"hash,omitempty"`
+	Submissions int    `json:"submissions"`
+	Landed      bool   `json:"landed"`
+	Block       uint64 `json:"block,omitempty"`
+}
+
+// LogReport is one historical event found by `logs`.
+type LogReport struct {
+	Block  uint64      `json:"block"`
+	TxHash common.Hash `json:"txHash"`
+	decodedEvent
+}
+
+// ErrorReport describes why a command failed. Code is the failure class,
+// such as "reverted" or "rpc_unavailable" (see ExitCode), or "error".
+type ErrorReport struct {
+	Message string `json:"message"`
+	Code    string `json:"code"`
+}
+
+// newTxReport summarizes a mined transaction.
+func newTxReport(method string, rcpt *types.Receipt, events []decodedEvent) *TxReport {
+	r := &TxReport{Method: method, Hash: rcpt.TxHash, Status: rcpt.Status, GasUsed: rcpt.GasUsed, Events: events}
+	if rcpt.BlockNumber != nil {
+		r.Block = rcpt.BlockNumber.Uint64()
+	}
+	if rcpt.EffectiveGasPrice != nil {
+		r.EffectiveGasPrice = rcpt.EffectiveGasPrice.String()
+	}
+	if rcpt.BlobGasPrice != nil {
+		r.BlobGasUsed, r.BlobGasPrice = rcpt.BlobGasUsed, rcpt.BlobGasPrice.String()
+	}
+	return r
+}
+
+// Log levels for human output: --quiet raises the threshold to warnings,
+// --verbose lowers it to debug detail.
+const (
+	levelQuiet   = slog.LevelWarn
+	levelNormal  = slog.LevelInfo
+	levelVerbose = slog.LevelDebug
+)
+
+// logger carries all human-readable output. Primary results (addresses,
+// return values, signatures) go to out, which is stdout, so they can be
+// captured by scripts; progress and warnings go through log to stderr,
+// as plain lines or, with --log-format json, as one JSON object per
+// line. In JSON report mode neither progress nor results are printed
+// and the run's results are collected in report instead. Warnings are
+// always printed.
+type logger struct {
+	out     io.Writer
+	errw    io.Writer
+	warnw   io.Writer
+	level   slog.LevelVar
+	json    bool
+	logJSON bool
+	log     *slog.Logger
+	report  Report
+
+	explorer string // base URL of the connected chain's explorer
+
+	mu     sync.Mutex
+	fields []slog.Attr // context added to every structured record
+}
+
+// newLogger returns a logger printing results to out and progress and
+// warnings to errw.
+func newLogger(out, errw io.Writer) *logger {
+	l := &logger{out: out, errw: errw, warnw: errw}
+	l.setFormat(false)
+	return l
+}
+
+// ui is the commands' logger; the output flags configure it while flags
+// are parsed.
+var ui = cli.ui
+
+// setFormat switches log between plain lines and JSON records.
+func (l *logger) setFormat(json bool) {
+	l.logJSON = json
+	if json {
+		l.log = slog.New(slog.NewJSONHandler(l.errw, &slog.HandlerOptions{Level: &l.level}))
+		return
+	}
+	l.log = slog.New(&plainHandler{w: l.errw, warn: l.warnw, level: &l.level, mu: new(sync.Mutex)})
+}
+
+// register adds the output flags. They act on l directly so any command
+// that registers options gets them.
+func (l *logger) register(fs *flag.FlagSet) {
+	fs.Func("output", "output format: text (default) or json", func(v string) error {
+		switch v {
+		case "text":
+			l.json = false
+		case "json":
+			l.json = true
+		default:
+			return fmt.Errorf("want text or json")
+		}
+		return nil
+	})
+	fs.BoolFunc("json", "shorthand for --output json", func(string) error {
+		l.json = true
+		return nil
+	})
+	fs.Func("log-format", "format of the progress log on stderr: text (default) or json", func(v string) error {
+		switch v {
+		case "text":
+			l.setFormat(false)
+		case "json":
+			l.setFormat(true)
+		default:
+			return fmt.Errorf("want text or json")
+		}
+		return nil
+	})
+	fs.BoolFunc("quiet", "only print results, warnings and errors", func(string) error {
+		l.level.Set(levelQuiet)
+		return nil
+	})
+	fs.BoolFunc("verbose", "print extra detail such as nonces and gas prices", func(string) error {
+		l.level.Set(levelVerbose)
+		return nil
+	})
+}
+
+// emit logs msg at level with the context fields. Plain lines are
+// written as they are; JSON records lose the trailing newline.
+func (l *logger) emit(level slog.Level, msg string, attrs ...slog.Attr) {
+	ctx := context.Background()
+	if !l.log.Enabled(ctx, level) {
+		return
+	}
+	if l.logJSON {
+		msg = strings.TrimSpace(msg)
+		l.mu.Lock()
+		attrs = append(append([]slog.Attr(nil), l.fields...), attrs...)
+		l.mu.Unlock()
+	}
+	l.log.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// with adds key to the context of every later structured record,
+// replacing an earlier value.
+func (l *logger) with(key string, value any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, a := range l.fields {
+		if a.Key == key {
+			l.fields[i] = slog.Any(key, value)
+			return
+		}
+	}
+	l.fields = append(l.fields, slog.Any(key, value))
+}
+
+// Printf writes normal progress output.
+func (l *logger) Printf(format string, args ...interface{}) {
+	if !l.json {
+		l.emit(slog.LevelInfo, fmt.Sprintf(format, args...))
+	}
+}
+
+// Println writes normal progress output.
+func (l *logger) Println(args ...interface{}) {
+	if !l.json {
+		l.emit(slog.LevelInfo, fmt.Sprintln(args...))
+	}
+}
+
+// Verbosef writes detail shown only with --verbose.
+func (l *logger) Verbosef(format string, args ...interface{}) {
+	if !l.json {
+		l.emit(slog.LevelDebug, fmt.Sprintf(format, args...))
+	}
+}
+
+// Warnf writes a warning in every mode.
+func (l *logger) Warnf(format string, args ...interface{}) {
+	l.emit(slog.LevelWarn, fmt.Sprintf(format, args...))
+}
+
+// Resultf writes a primary result to stdout, whatever the log level.
+func (l *logger) Resultf(format string, args ...interface{}) {
+	if !l.json {
+		fmt.Fprintf(l.out, format, args...)
+	}
+}
+
+// Resultln writes a primary result to stdout, whatever the log level.
+func (l *logger) Resultln(args ...interface{}) {
+	if !l.json {
+		fmt.Fprintln(l.out, args...)
+	}
+}
+
+// logError logs err, the error a command failed with, as a structured
+// record with the fields attached to it, and reports whether it did; only
+// --log-format json outside JSON report mode does.
+func (l *logger) logError(err error) bool {
+	if err == nil || !l.logJSON || l.json {
+		return false
+	}
+	l.emit(slog.LevelError, err.Error(), append(errorAttrs(err), slog.String("code", errorCode(err)))...)
+	return true
+}
+
+// setChain records the connected chain and the explorer links point to:
+// explorer, from --explorer-url, or else the registry's, with its {chain}
+// filled in.
+func (l *logger) setChain(id *big.Int, explorer string) {
+	l.report.ChainID = id.String()
+	l.with("chainId", id.String())
+	if explorer == "" {
+		explorer = chains[id.Uint64()].explorer
+	}
+	l.explorer = strings.ReplaceAll(explorer, "{chain}", id.String())
+}
+
+// explorerURL is the link to kind ("tx" or "address") id on the
+// connected chain's explorer, or "" when it has none.
+func (l *logger) explorerURL(kind, id string) string {
+	return explorerURL(l.explorer, kind, id)
+}
+
+// link prints the explorer link to kind id under the line naming it.
+func (l *logger) link(kind, id string) {
+	if u := l.explorerURL(kind, id); u != "" {
+		l.Printf("  %s\n", u)
+	}
+}
+
+// finish prints the JSON report, with err as its error, and reports
+// whether it did.
+func (l *logger) finish(err error) bool {
+	if !l.json {
+		return false
+	}
+	if err != nil {
+		l.report.Error = &ErrorReport{Message: err.Error(), Code: errorCode(err)}
+	}
+	enc := json.NewEncoder(l.out)
+	enc.SetIndent("", "  ")
+	if encErr := enc.Encode(l.report); encErr != nil {
+		fmt.Fprintln(l.errw, "encode report:", encErr)
+	}
+	return true
+}
@@ -0,0 +1,228 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// invalidParams is the JSON-RPC error code for arguments a method does
+// not accept.
+const invalidParams = -32602
+
+// accountOverride is one account's entry in an eth_call state override
+// object. Slots go in stateDiff, so the rest of the account's storage is
+// kept.
+type accountOverride struct {
+	Balance   *hexutil.Big                `json:"balance,omitempty"`
+	Nonce     *hexutil.Uint64             `json:"nonce,omitempty"`
+	Code      *hexutil.Bytes              `json:"code,omitempty"`
+	StateDiff map[common.Hash]common.Hash `json:"stateDiff,omitempty"`
+}
+
+// stateOverrides is the repeatable --override flag, keyed by account.
+// Overrides of the same account merge, later values winning.
+type stateOverrides map[common.Address]*accountOverride
+
+func (o *stateOverrides) String() string {
+	addrs := make([]string, 0, len(*o))
+	for a := range *o {
+		addrs = append(addrs, a.Hex())
+	}
+	sort.Strings(addrs)
+	return strings.Join(addrs, ",")
+}
+
+// Set parses addr:balance=...,nonce=...,code=0x...,state[slot]=value.
+func (o *stateOverrides) Set(v string) error {
+	addr, fields, ok := strings.Cut(v, ":")
+	if !ok || fields == "" {
+		return errors.New("want addr:balance=...,nonce=...,code=0x...,state[slot]=value")
+	}
+	a, err := parseAddress(strings.TrimSpace(addr))
+	if err != nil {
+		return err
+	}
+	if *o == nil {
+		*o = make(stateOverrides)
+	}
+	acct := (*o)[a]
+	if acct == nil {
+		acct = &accountOverride{}
+		(*o)[a] = acct
+	}
+	for _, f := range strings.Split(fields, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(f), "=")
+		if !ok {
+			return fmt.Errorf("%q: want key=value", f)
+		}
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+		switch {
+		case key == "balance":
+			b, err := parseValue(val)
+			if err != nil || b == nil {
+				return fmt.Errorf("balance: invalid amount %q", val)
+			}
+			acct.Balance = (*hexutil.Big)(b)
+		case key == "nonce":
+			n, err := toBigInt(val)
+			if err != nil || !n.IsUint64() {
+				return fmt.Errorf("nonce: invalid value %q", val)
+			}
+			nonce := hexutil.Uint64(n.Uint64())
+			acct.Nonce = &nonce
+		case key == "code":
+			code, err := hexutil.Decode(val)
+			if err != nil {
+				return fmt.Errorf("code: %w", err)
+			}
+			acct.Code = (*hexutil.Bytes)(&code)
+		case strings.HasPrefix(key, "state[") && strings.HasSuffix(key, "]"):
+			slot, err := storageWord(key[len("state[") : len(key)-1])
+			if err != nil {
+				return fmt.Errorf("%s: slot: %w", key, err)
+			}
+			word, err := storageWord(val)
+			if err != nil {
+				return fmt.Errorf("%s: value: %w", key, err)
+			}
+			if acct.StateDiff == nil {
+				acct.StateDiff = make(map[common.Hash]common.Hash)
+			}
+			acct.StateDiff[slot] = word
+		default:
+			return fmt.Errorf("unknown override %q (want balance, nonce, code or state[slot])", key)
+		}
+	}
+	return nil
+}
+
+// storageWord parses a slot or a storage value: a decimal or 0x number,
+// or an address, left-padded to 32 bytes.
+func storageWord(s string) (common.Hash, error) {
+	n, err := toBigInt(s)
+	if err != nil || n.Sign() < 0 || n.BitLen() > 256 {
+		return common.Hash{}, fmt.Errorf("invalid word %q", s)
+	}
+	return common.BigToHash(n), nil
+}
+
+// print lists the overrides a simulation runs with.
+func (o stateOverrides) print() {
+	addrs := make([]common.Address, 0, len(o))
+	for a := range o {
+		addrs = append(addrs, a)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Cmp(addrs[j]) < 0 })
+	for _, a := range addrs {
+		acct := o[a]
+		var parts []string
+		if acct.Balance != nil {
+			parts = append(parts, "balance "+formatEther(acct.Balance.ToInt())+" ETH")
+		}
+		if acct.Nonce != nil {
+			parts = append(parts, fmt.Sprintf("nonce %d", *acct.Nonce))
+		}
+		if acct.Code != nil {
+			parts = append(parts, fmt.Sprintf("code %d bytes", len(*acct.Code)))
+		}
+		switch n := len(acct.StateDiff); {
+		case n == 1:
+			parts = append(parts, "1 storage slot")
+		case n > 1:
+			parts = append(parts, fmt.Sprintf("%d storage slots", n))
+		}
+		ui.Printf("  override %s: %s\n", a.Hex(), strings.Join(parts, ", "))
+	}
+}
+
+// toCallArg is msg in the form eth_call and eth_estimateGas take.
+func toCallArg(msg ethereum.CallMsg) map[string]interface{} {
+	arg := map[string]interface{}{"from": msg.From}
+	if msg.To != nil {
+		arg["to"] = msg.To
+	}
+	if len(msg.Data) > 0 {
+		arg["input"] = hexutil.Bytes(msg.Data)
+	}
+	if msg.Value != nil {
+		arg["value"] = (*hexutil.Big)(msg.Value)
+	}
+	if msg.Gas != 0 {
+		arg["gas"] = hexutil.Uint64(msg.Gas)
+	}
+	return arg
+}
+
+func blockArg(block *big.Int) string {
+	if block == nil {
+		return "latest"
+	}
+	return hexutil.EncodeBig(block)
+}
+
+// overrideError explains the error of a call made with state overrides
+// when the node turned the extra parameter down.
+func overrideError(method string, err error) error {
+	var rpcErr rpc.Error
+	msg := strings.ToLower(err.Error())
+	if (errors.As(err, &rpcErr) && (rpcErr.ErrorCode() == invalidParams || rpcErr.ErrorCode() == methodNotFound)) ||
+		strings.Contains(msg, "too many arguments") || strings.Contains(msg, "invalid params") {
+		return fmt.Errorf("the node does not support state overrides for %s: %w", method, err)
+	}
+	return err
+}
+
+// CallContractWithOverrides is CallContract with the state in ov replaced
+// for the duration of the call.
+func (c *rpcClient) CallContractWithOverrides(ctx context.Context, msg ethereum.CallMsg, block *big.Int, ov stateOverrides) ([]byte, error) {
+	out, err := read(ctx, c, "eth_call", func(ctx context.Context, cl *ethclient.Client) (hexutil.Bytes, error) {
+		var out hexutil.Bytes
+		err := cl.Client().CallContext(ctx, &out, "eth_call", toCallArg(msg), blockArg(block), ov)
+		return out, err
+	})
+	if err != nil {
+		return nil, overrideError("eth_call", err)
+	}
+	return out, nil
+}
+
+// EstimateGasWithOverrides is EstimateGas with the state in ov replaced.
+func (c *rpcClient) EstimateGasWithOverrides(ctx context.Context, msg ethereum.CallMsg, ov stateOverrides) (uint64, error) {
+	gas, err := read(ctx, c, "eth_estimateGas", func(ctx context.Context, cl *ethclient.Client) (hexutil.Uint64, error) {
+		var gas hexutil.Uint64
+		err := cl.Client().CallContext(ctx, &gas, "eth_estimateGas", toCallArg(msg), "latest", ov)
+		return gas, err
+	})
+	if err != nil {
+		return 0, overrideError("eth_estimateGas", err)
+	}
+	return uint64(gas), nil
+}
+
+// overrideCaller is a bind.ContractCaller whose calls run with ov, and
+// which reports overridden code as the account's.
+type overrideCaller struct {
+	client *rpcClient
+	ov     stateOverrides
+}
+
+func (c overrideCaller) CodeAt(ctx context.Context, account common.Address, block *big.Int) ([]byte, error) {
+	if acct := c.ov[account]; acct != nil && acct.Code != nil {
+		return *acct.Code, nil
+	}
+	return c.client.CodeAt(ctx, account, block)
+}
+
+func (c overrideCaller) CallContract(ctx context.Context, msg ethereum.CallMsg, block *big.Int) ([]byte, error) {
+	return c.client.CallContractWithOverrides(ctx, msg, block, c.ov)
+}
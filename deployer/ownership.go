@@ -0,0 +1,406 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ownershipABI is the common ownership and access-control surface: Ownable
+// and Ownable2Step, the getOwner() some contracts use instead, and
+// AccessControl with its Enumerable extension.
+const ownershipABI = `[
+{"type":"function","name":"owner","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"address"}]},
+{"type":"function","name":"getOwner","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"address"}]},
+{"type":"function","name":"pendingOwner","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"address"}]},
+{"type":"function","name":"transferOwnership","stateMutability":"nonpayable","inputs":[{"name":"newOwner","type":"address"}],"outputs":[]},
+{"type":"function","name":"acceptOwnership","stateMutability":"nonpayable","inputs":[],"outputs":[]},
+{"type":"function","name":"hasRole","stateMutability":"view","inputs":[{"name":"role","type":"bytes32"},{"name":"account","type":"address"}],"outputs":[{"name":"","type":"bool"}]},
+{"type":"function","name":"getRoleMemberCount","stateMutability":"view","inputs":[{"name":"role","type":"bytes32"}],"outputs":[{"name":"","type":"uint256"}]},
+{"type":"function","name":"getRoleMember","stateMutability":"view","inputs":[{"name":"role","type":"bytes32"},{"name":"index","type":"uint256"}],"outputs":[{"name":"","type":"address"}]},
+{"type":"event","name":"OwnershipTransferred","anonymous":false,"inputs":[{"name":"previousOwner","type":"address","indexed":true},{"name":"newOwner","type":"address","indexed":true}]},
+{"type":"event","name":"OwnershipTransferStarted","anonymous":false,"inputs":[{"name":"previousOwner","type":"address","indexed":true},{"name":"newOwner","type":"address","indexed":true}]}
+]`
+
+var parsedOwnership = func() abi.ABI {
+	a, err := abi.JSON(strings.NewReader(ownershipABI))
+	if err != nil {
+		panic(err)
+	}
+	return a
+}()
+
+// maxRoleMembers is the most DEFAULT_ADMIN_ROLE members listed.
+const maxRoleMembers = 50
+
+// ownable reads the ownership surface of the contract at address.
+type ownable struct {
+	address common.Address
+	client  *rpcClient
+	bound   *bind.BoundContract
+}
+
+func newOwnable(client *rpcClient, address common.Address) *ownable {
+	return &ownable{address: address, client: client, bound: bind.NewBoundContract(address, parsedOwnership, client, client, client)}
+}
+
+// call runs a view method and returns its single result, or an error
+// when the contract has no such method or answers something else. A
+// contract with a fallback may answer anything, so the answer must
+// decode exactly.
+func (w *ownable) call(ctx context.Context, method string, args ...interface{}) (interface{}, error) {
+	m := parsedOwnership.Methods[method]
+	data, err := parsedOwnership.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := w.client.CallContract(ctx, ethereum.CallMsg{To: &w.address, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) != 32 {
+		return nil, fmt.Errorf("%s returned %d bytes", m.Sig, len(ret))
+	}
+	out, err := m.Outputs.Unpack(ret)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := out[0].(common.Address); ok && common.BytesToHash(ret).Big().BitLen() > 160 {
+		return nil, fmt.Errorf("%s did not return an address", m.Sig)
+	}
+	return out[0], nil
+}
+
+// addressOf calls a view method returning an address.
+func (w *ownable) addressOf(ctx context.Context, method string, args ...interface{}) (common.Address, bool) {
+	v, err := w.call(ctx, method, args...)
+	if err != nil {
+		return common.Address{}, false
+	}
+	return v.(common.Address), true
+}
+
+// answersAnything reports whether the contract returns data for a
+// selector nobody defines, as contracts with a catch-all fallback do, so
+// that the view methods it seems to have cannot be told from its fallback.
+func answersAnything(ctx context.Context, client *rpcClient, address common.Address) bool {
+	ret, err := client.CallContract(ctx, ethereum.CallMsg{To: &address, Data: []byte{0xde, 0xad, 0xbe, 0xef}}, nil)
+	return err == nil && len(ret) > 0
+}
+
+// accountKind says what controls addr: nobody for the zero address, a
+// contract, or an EOA, delegated under EIP-7702 when its code says so.
+func accountKind(ctx context.Context, client *rpcClient, addr common.Address) (string, error) {
+	if addr == (common.Address{}) {
+		return "zero", nil
+	}
+	code, err := client.CodeAt(ctx, addr, nil)
+	if err != nil {
+		return "", fmt.Errorf("get code at %s: %w", addr.Hex(), err)
+	}
+	switch {
+	case len(code) == 0:
+		return "eoa", nil
+	case len(code) == 23 && code[0] == 0xef && code[1] == 0x01 && code[2] == 0x00:
+		return "eoa (EIP-7702 delegated)", nil
+	}
+	return "contract", nil
+}
+
+// describeController is how owner prints a controller of kind.
+func describeController(addr common.Address, kind string) string {
+	switch kind {
+	case "zero":
+		return addr.Hex() + " (zero address: renounced)"
+	case "eoa":
+		return names.label(addr) + " (EOA)"
+	}
+	return names.label(addr) + " (" + kind + ")"
+}
+
+// findControllers tries, in order, owner(), getOwner(), pendingOwner(),
+// DEFAULT_ADMIN_ROLE (listed through getRoleMember when the contract is
+// enumerable, otherwise checked for accounts) and the EIP-1967 admin
+// slot, whose admin is itself asked for its owner().
+func findControllers(ctx context.Context, client *rpcClient, address common.Address, accounts []common.Address) (*OwnershipReport, error) {
+	w := newOwnable(client, address)
+	r := &OwnershipReport{Address: address, CatchAll: answersAnything(ctx, client, address)}
+	add := func(pattern string, addr common.Address) error {
+		kind, err := accountKind(ctx, client, addr)
+		if err != nil {
+			return err
+		}
+		r.Controllers = append(r.Controllers, ControllerReport{Pattern: pattern, Address: addr, Kind: kind})
+		return nil
+	}
+
+	if r.CatchAll {
+		return r, readAdmin(ctx, client, address, add)
+	}
+	for _, m := range []string{"owner", "getOwner"} {
+		if addr, ok := w.addressOf(ctx, m); ok {
+			if err := add(m+"()", addr); err != nil {
+				return nil, err
+			}
+			r.Ownable = true
+			break
+		}
+	}
+	if pending, ok := w.addressOf(ctx, "pendingOwner"); ok {
+		r.TwoStep = true
+		if pending != (common.Address{}) {
+			r.PendingOwner = &pending
+		}
+	}
+
+	var adminRole [32]byte
+	if _, err := w.call(ctx, "hasRole", adminRole, common.Address{}); err == nil {
+		r.AccessControl = true
+		if n, err := w.call(ctx, "getRoleMemberCount", adminRole); err == nil {
+			count := n.(*big.Int)
+			r.Enumerable = true
+			for i := int64(0); i < count.Int64() && i < maxRoleMembers; i++ {
+				if addr, ok := w.addressOf(ctx, "getRoleMember", adminRole, big.NewInt(i)); ok {
+					if err := add("DEFAULT_ADMIN_ROLE member", addr); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if count.Cmp(big.NewInt(maxRoleMembers)) > 0 {
+				client.ui.Warnf("warning: DEFAULT_ADMIN_ROLE has %s members; listing the first %d\n", count, maxRoleMembers)
+			}
+		}
+		for _, a := range accounts {
+			if v, err := w.call(ctx, "hasRole", adminRole, a); err == nil && v.(bool) {
+				if err := add("hasRole(DEFAULT_ADMIN_ROLE)", a); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if err := readAdmin(ctx, client, address, add); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// readAdmin adds the EIP-1967 admin of address, and the owner() of that
+// admin when it is a ProxyAdmin.
+func readAdmin(ctx context.Context, client *rpcClient, address common.Address, add func(string, common.Address) error) error {
+	raw, err := client.StorageAt(ctx, address, adminSlot, nil)
+	if err != nil {
+		return fmt.Errorf("eth_getStorageAt %s %s: %w", address.Hex(), adminSlot.Hex(), err)
+	}
+	admin, ok := wordAddress(common.BytesToHash(raw))
+	if !ok {
+		return nil
+	}
+	if err := add("EIP-1967 admin slot", admin); err != nil {
+		return err
+	}
+	if !answersAnything(ctx, client, admin) {
+		if owner, ok := newOwnable(client, admin).addressOf(ctx, "owner"); ok {
+			return add("owner() of the proxy admin", owner)
+		}
+	}
+	return nil
+}
+
+// runOwner implements `owner [flags] <address>`: who controls a contract,
+// and through which pattern.
+func runOwner(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("owner", flag.ExitOnError)
+	var o options
+	var accounts []common.Address
+	o.register(fs)
+	fs.Func("account", "with AccessControl that cannot list its members, check whether this address holds DEFAULT_ADMIN_ROLE (repeatable)", func(v string) error {
+		a, err := parseAddress(v)
+		if err != nil {
+			return err
+		}
+		accounts = append(accounts, a)
+		return nil
+	})
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: owner [flags] <address>")
+	}
+	address, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	client, _, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	code, err := client.CodeAt(ctx, address, nil)
+	if err != nil {
+		return fmt.Errorf("get code at %s: %w", address.Hex(), err)
+	}
+	if len(code) == 0 {
+		return fmt.Errorf("no contract at %s", address.Hex())
+	}
+	r, err := findControllers(ctx, client, address, accounts)
+	if err != nil {
+		return err
+	}
+	ui.report.Ownership = r
+	if r.CatchAll {
+		ui.Warnf("warning: %s answers calls it does not define, so owner() and AccessControl cannot be checked; only the EIP-1967 admin slot was read\n", address.Hex())
+	}
+
+	if len(r.Controllers) == 0 && r.CatchAll {
+		ui.Resultf("%s has no EIP-1967 admin\n", address.Hex())
+		return nil
+	}
+	if len(r.Controllers) == 0 {
+		ui.Resultf("%s has no owner(), getOwner(), DEFAULT_ADMIN_ROLE member or EIP-1967 admin\n", address.Hex())
+		if r.AccessControl && !r.Enumerable {
+			ui.Resultln("It uses AccessControl but cannot list role members; check candidates with --account")
+		}
+		return nil
+	}
+	ui.Resultf("%s is controlled by %s via %s\n", address.Hex(), describeController(r.Controllers[0].Address, r.Controllers[0].Kind), r.Controllers[0].Pattern)
+	for _, c := range r.Controllers[1:] {
+		ui.Resultf("  also %s: %s\n", c.Pattern, describeController(c.Address, c.Kind))
+	}
+	if r.PendingOwner != nil {
+		ui.Resultf("  pending owner (Ownable2Step): %s, not yet accepted\n", names.label(*r.PendingOwner))
+	}
+	if r.AccessControl && !r.Enumerable {
+		ui.Resultln("  AccessControl without enumeration: other DEFAULT_ADMIN_ROLE holders may exist; check them with --account")
+	}
+	if c := r.Controllers[0]; c.Kind == "zero" {
+		ui.Warnf("warning: %s of %s is the zero address; ownership was renounced\n", c.Pattern, address.Hex())
+	}
+	return nil
+}
+
+// runTransferOwnership implements `transfer-ownership [flags] <address>
+// <newOwner>`, and with --accept `transfer-ownership --accept <address>`
+// for the second step of Ownable2Step.
+func runTransferOwnership(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("transfer-ownership", flag.ExitOnError)
+	var o options
+	var txo txOptions
+	o.register(fs)
+	txo.register(fs)
+	accept := fs.Bool("accept", false, "accept a pending Ownable2Step transfer as the new owner")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if (*accept && fs.NArg() != 1) || (!*accept && fs.NArg() != 2) {
+		return errors.New("usage: transfer-ownership [flags] <address> <newOwner>, or transfer-ownership --accept [flags] <address>")
+	}
+	address, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	s, err := openSession(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	w := newOwnable(s.client, address)
+	if answersAnything(ctx, s.client, address) {
+		return fmt.Errorf("%s answers calls it does not define, so its owner() cannot be trusted", address.Hex())
+	}
+	owner, ok := w.addressOf(ctx, "owner")
+	if !ok {
+		return fmt.Errorf("%s has no owner(); it is not Ownable", address.Hex())
+	}
+	pending, twoStep := w.addressOf(ctx, "pendingOwner")
+
+	method, newOwner := "transferOwnership", common.Address{}
+	if *accept {
+		if !twoStep {
+			return fmt.Errorf("%s has no pendingOwner(); it is not Ownable2Step, so there is nothing to accept", address.Hex())
+		}
+		if pending != s.from {
+			return fmt.Errorf("pending owner of %s is %s, not the signer %s", address.Hex(), pending.Hex(), s.from.Hex())
+		}
+		method, newOwner = "acceptOwnership", pending
+	} else {
+		if newOwner, err = parseAddress(fs.Arg(1)); err != nil {
+			return err
+		}
+		switch {
+		case newOwner == (common.Address{}):
+			return errors.New("new owner is the zero address; that renounces ownership, which transfer-ownership does not do")
+		case newOwner == owner:
+			return fmt.Errorf("%s already owns %s", newOwner.Hex(), address.Hex())
+		case owner != s.from:
+			return fmt.Errorf("owner of %s is %s, not the signer %s", address.Hex(), owner.Hex(), s.from.Hex())
+		}
+	}
+	oldKind, err := accountKind(ctx, s.client, owner)
+	if err != nil {
+		return err
+	}
+	newKind, err := accountKind(ctx, s.client, newOwner)
+	if err != nil {
+		return err
+	}
+
+	ui.Printf("Ownership of %s:\n", address.Hex())
+	ui.Printf("  current owner: %s\n", describeController(owner, oldKind))
+	ui.Printf("  new owner:     %s\n", describeController(newOwner, newKind))
+	if twoStep && !*accept {
+		ui.Println("  two-step (Ownable2Step): the new owner takes over once it calls acceptOwnership()")
+	}
+	// Off the dev chain the send itself asks. On it, where sends go
+	// unconfirmed, a change of owner is still asked about.
+	if s.chainID.Uint64() == localChainID && !s.yes && !txo.dryRun {
+		if err := askConfirm(os.Stdin, isTerminal(os.Stdin)); err != nil {
+			return err
+		}
+	}
+
+	m := parsedOwnership.Methods[method]
+	var callArgs []interface{}
+	if !*accept {
+		callArgs = []interface{}{newOwner}
+	}
+	if txo.dryRun {
+		return s.dryRunSend(ctx, address, &parsedOwnership, &m, callArgs, txo)
+	}
+	tx, err := s.transact(ctx, w.bound, &parsedOwnership, &m, callArgs, txo)
+	if err != nil {
+		return err
+	}
+	if txo.noWait {
+		return nil
+	}
+	rcpt, err := s.waitReceipt(ctx, tx, &parsedOwnership)
+	if err != nil {
+		return err
+	}
+	ui.report.Transactions = append(ui.report.Transactions, *newTxReport(m.Sig, rcpt, printEvents(ui, rcpt, &parsedOwnership)))
+
+	after, _ := w.addressOf(ctx, "owner")
+	if after == newOwner {
+		ui.Printf("%s now owns %s\n", names.label(newOwner), address.Hex())
+		return nil
+	}
+	if p, ok := w.addressOf(ctx, "pendingOwner"); ok && p == newOwner {
+		ui.Printf("Transfer started: %s is the pending owner and takes over once it accepts with\n", names.label(newOwner))
+		ui.Printf("  transfer-ownership --accept %s   (signed by %s)\n", address.Hex(), newOwner.Hex())
+		return nil
+	}
+	return fmt.Errorf("owner of %s is %s after the transaction, not %s", address.Hex(), after.Hex(), newOwner.Hex())
+}
@@ -0,0 +1,195 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// stepNode is a pending step in the dependency graph `run --parallel`
+// schedules: the earlier steps it needs and the later ones needing it.
+type stepNode struct {
+	st         *planStep
+	index      int // position in the plan, from 1
+	kind       string
+	deps       []*stepNode
+	dependents []*stepNode
+	waiting    int // deps not done yet
+	status     string
+	err        error
+	outputs    map[string]string
+}
+
+// stepGraph links each pending step to the earlier ones it needs: those
+// whose outputs its templates reference, those deploying a contract or
+// library it references through deployments.<Name>, and those acting on
+// the same contract or needing the same unlinked library, which keep their
+// plan order. index maps each step to its position in the plan.
+func (r *planRun) stepGraph(pending []*planStep, index map[*planStep]int) ([]*stepNode, error) {
+	var nodes []*stepNode
+	touches := map[*stepNode]map[string]bool{}
+	reads := map[*stepNode]map[string]bool{}
+	uses := map[*stepNode]map[string]bool{}
+	for _, st := range pending {
+		kind, ref, _ := st.kind()
+		n := &stepNode{st: st, index: index[st], kind: kind}
+		c, err := r.artifact(ref, kind == "deploy")
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %w", st.Name, err)
+		}
+		touches[n] = map[string]bool{c.Name: true}
+		if kind == "deploy" {
+			for _, lib := range c.Libraries {
+				_, bySource := st.Libraries[lib.Source+":"+lib.Name]
+				if _, byName := st.Libraries[lib.Name]; !bySource && !byName && lib.Address == nil {
+					touches[n][lib.Name] = true
+				}
+			}
+		}
+		refs, err := stepRefs(st)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %w", st.Name, err)
+		}
+		reads[n], uses[n] = map[string]bool{}, map[string]bool{}
+		if kind != "deploy" && st.Address == "" {
+			reads[n][c.Name] = true
+		}
+		for _, ref := range refs {
+			parts := strings.Split(ref, ".")
+			switch {
+			case len(parts) < 2:
+			case parts[0] == "deployments":
+				reads[n][parts[1]] = true
+			case parts[0] == "steps":
+				uses[n][strings.Join(parts[1:len(parts)-1], ".")] = true
+			}
+		}
+		for _, prev := range nodes {
+			if uses[n][prev.st.Name] || overlaps(touches[n], touches[prev]) || overlaps(reads[n], touches[prev]) {
+				n.deps = append(n.deps, prev)
+				prev.dependents = append(prev.dependents, n)
+			}
+		}
+		n.waiting = len(n.deps)
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+func overlaps(a, b map[string]bool) bool {
+	for k := range a {
+		if b[k] {
+			return true
+		}
+	}
+	return false
+}
+
+// stepRefs lists the template references in a step's address, arguments
+// and libraries.
+func stepRefs(st *planStep) ([]string, error) {
+	raw, err := json.Marshal([]interface{}{st.Address, st.Args, st.Libraries})
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	for _, m := range templateRef.FindAllStringSubmatch(string(raw), -1) {
+		refs = append(refs, m[1])
+	}
+	return refs, nil
+}
+
+// runParallel runs nodes as their dependencies complete, up to limit at a
+// time. Steps hold r.mu while they work, so they build, sign and send one
+// at a time with consecutive nonces, and release it while their
+// transactions are mined. A failed step skips everything depending on it;
+// unrelated steps still run. record is called, locked, for each step
+// done. It returns the steps that did not complete.
+func (r *planRun) runParallel(ctx context.Context, nodes []*stepNode, total, limit int, record func(n *stepNode) error) []*stepNode {
+	r.s.sendLock = &r.mu
+	defer func() { r.s.sendLock = nil }()
+
+	var ready []*stepNode
+	for _, n := range nodes {
+		if n.waiting == 0 {
+			ready = append(ready, n)
+		}
+	}
+	finished := make(chan *stepNode)
+	running := 0
+	for len(ready) > 0 || running > 0 {
+		for running < limit && len(ready) > 0 && ctx.Err() == nil {
+			n := ready[0]
+			ready = ready[1:]
+			n.status = "running"
+			running++
+			go func() {
+				r.mu.Lock()
+				defer func() {
+					r.mu.Unlock()
+					finished <- n
+				}()
+				r.s.ui.Printf("Step %d/%d %s: started\n", n.index, total, n.st.Name)
+				_, out, err := r.step(ctx, n.st)
+				if err == nil {
+					n.outputs = out
+					for k, v := range out {
+						r.outputs["steps."+n.st.Name+"."+k] = v
+					}
+					err = record(n)
+				}
+				if err != nil {
+					n.status, n.err = "failed", err
+					r.s.ui.Warnf("Step %d/%d %s failed: %v\n", n.index, total, n.st.Name, err)
+					return
+				}
+				n.status = "done"
+				r.s.ui.Printf("Step %d/%d %s: done\n", n.index, total, n.st.Name)
+			}()
+		}
+		if running == 0 {
+			break
+		}
+		n := <-finished
+		running--
+		if n.status != "done" {
+			r.mu.Lock()
+			skipDependents(n, total)
+			r.mu.Unlock()
+			continue
+		}
+		for _, d := range n.dependents {
+			if d.waiting--; d.waiting == 0 && d.status == "" {
+				ready = append(ready, d)
+			}
+		}
+		slices.SortFunc(ready, func(a, b *stepNode) int { return a.index - b.index })
+	}
+
+	var incomplete []*stepNode
+	for _, n := range nodes {
+		switch n.status {
+		case "done":
+			continue
+		case "":
+			n.status, n.err = "skipped", context.Cause(ctx)
+		}
+		incomplete = append(incomplete, n)
+	}
+	return incomplete
+}
+
+// skipDependents marks every step that needs failed, directly or not, as
+// skipped.
+func skipDependents(failed *stepNode, total int) {
+	for _, d := range failed.dependents {
+		if d.status != "" {
+			continue
+		}
+		d.status, d.err = "skipped", fmt.Errorf("needs %s, which did not complete", failed.st.Name)
+		ui.Warnf("Step %d/%d %s: skipped, needs %s\n", d.index, total, d.st.Name, failed.st.Name)
+		skipDependents(d, total)
+	}
+}
@@ -0,0 +1,234 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// permitTypes are the EIP-712 Permit structs of EIP-2612 and of DAI,
+// which predates it.
+var permitTypes = map[string][]apitypes.Type{
+	"eip2612": {
+		{Name: "owner", Type: "address"},
+		{Name: "spender", Type: "address"},
+		{Name: "value", Type: "uint256"},
+		{Name: "nonce", Type: "uint256"},
+		{Name: "deadline", Type: "uint256"},
+	},
+	"dai": {
+		{Name: "holder", Type: "address"},
+		{Name: "spender", Type: "address"},
+		{Name: "nonce", Type: "uint256"},
+		{Name: "expiry", Type: "uint256"},
+		{Name: "allowed", Type: "bool"},
+	},
+}
+
+// permitDomain is the EIP712Domain every permit token uses.
+var permitDomain = []apitypes.Type{
+	{Name: "name", Type: "string"},
+	{Name: "version", Type: "string"},
+	{Name: "chainId", Type: "uint256"},
+	{Name: "verifyingContract", Type: "address"},
+}
+
+// parseDeadline reads --deadline: a duration from now, such as 30m, or a
+// unix timestamp. now is the head block's time.
+func parseDeadline(s string, now uint64) (*big.Int, error) {
+	if ts, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return new(big.Int).SetUint64(ts), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("--deadline: want a duration such as 1h or a unix timestamp, got %q", s)
+	}
+	return new(big.Int).SetUint64(now + uint64(d/time.Second)), nil
+}
+
+// runERC20Permit implements `erc20 permit [flags] <token> <spender>
+// <amount|max>`: sign an off-chain approval for owner, the loaded key,
+// and print it, or with --execute send it from RELAYER_PRIVATE_KEY.
+func runERC20Permit(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("erc20 permit", flag.ExitOnError)
+	var o options
+	var txo txOptions
+	o.register(fs)
+	txo.register(fs)
+	deadlineFlag := fs.String("deadline", "1h", "when the permit expires: a duration from the head block's time, a unix timestamp, or 0 for never with --style dai")
+	style := fs.String("style", "eip2612", "permit layout: eip2612 (owner, value, deadline) or dai (holder, nonce, expiry, allowed)")
+	version := fs.String("version", "", "EIP-712 domain version (default the token's version(), or 1)")
+	execute := fs.Bool("execute", false, "send the permit from RELAYER_PRIVATE_KEY instead of printing it")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 3 {
+		return errors.New("usage: erc20 permit [flags] <token> <spender> <amount|max>")
+	}
+	if _, ok := permitTypes[*style]; !ok {
+		return fmt.Errorf("--style: want eip2612 or dai, got %q", *style)
+	}
+	token, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	spender, err := parseAddress(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	owner, err := LoadSigner(o.keys)
+	if err != nil {
+		return err
+	}
+	var relayer *Signer
+	if *execute {
+		raw := os.Getenv("RELAYER_PRIVATE_KEY")
+		if raw == "" {
+			return errors.New("--execute: set RELAYER_PRIVATE_KEY to the key that sends the permit")
+		}
+		key, err := crypto.HexToECDSA(strings.TrimPrefix(raw, "0x"))
+		if err != nil {
+			return fmt.Errorf("RELAYER_PRIVATE_KEY: %w", err)
+		}
+		relayer = newKeySigner(key, "RELAYER_PRIVATE_KEY")
+	}
+
+	var s *session
+	var client *rpcClient
+	var chainID *big.Int
+	if relayer != nil {
+		if s, err = openSessionAs(ctx, &o, relayer); err != nil {
+			return err
+		}
+		defer s.Close()
+		client, chainID = s.client, s.chainID
+	} else {
+		if client, chainID, err = connect(ctx, &o); err != nil {
+			return err
+		}
+		defer client.Close()
+	}
+	t, err := loadToken(ctx, client, token)
+	if err != nil {
+		return err
+	}
+	if *version == "" {
+		if *version = t.text(ctx, "version"); *version == "" {
+			*version = "1"
+		}
+	}
+	nonce, err := t.amount(ctx, "nonces", owner.Address)
+	if err != nil {
+		return fmt.Errorf("%s has no nonces(address), so it does not support permits: %w", token.Hex(), err)
+	}
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("head block: %w", err)
+	}
+	deadline, err := parseDeadline(*deadlineFlag, head.Time)
+	if err != nil {
+		return err
+	}
+	if deadline.Sign() == 0 && *style != "dai" {
+		return errors.New("--deadline 0 (never) only exists with --style dai")
+	}
+	if deadline.Sign() > 0 && deadline.Cmp(new(big.Int).SetUint64(head.Time)) <= 0 {
+		return fmt.Errorf("--deadline %s is already past (head block time %d)", deadline, head.Time)
+	}
+
+	td := apitypes.TypedData{
+		Types:       apitypes.Types{"EIP712Domain": permitDomain, "Permit": permitTypes[*style]},
+		PrimaryType: "Permit",
+		Domain: apitypes.TypedDataDomain{
+			Name:              t.name,
+			Version:           *version,
+			ChainId:           (*math.HexOrDecimal256)(chainID),
+			VerifyingContract: token.Hex(),
+		},
+	}
+	var value *big.Int
+	switch amount := fs.Arg(2); {
+	case *style == "dai":
+		// DAI permits are all or nothing.
+		if amount != "max" && amount != "0" {
+			return fmt.Errorf("--style dai permits grant max or revoke with 0, got %q", amount)
+		}
+		td.Message = apitypes.TypedDataMessage{
+			"holder": owner.Address.Hex(), "spender": spender.Hex(), "nonce": nonce.String(),
+			"expiry": deadline.String(), "allowed": amount == "max",
+		}
+	case amount == "max":
+		value = abi.MaxUint256
+	default:
+		if value, err = t.parseAmount(amount); err != nil {
+			return err
+		}
+	}
+	if value != nil {
+		td.Message = apitypes.TypedDataMessage{
+			"owner": owner.Address.Hex(), "spender": spender.Hex(), "value": value.String(),
+			"nonce": nonce.String(), "deadline": deadline.String(),
+		}
+	}
+	digest, _, err := apitypes.TypedDataAndHash(td)
+	if err != nil {
+		return fmt.Errorf("permit digest: %w", err)
+	}
+	// A wrong name or version still signs fine but fails on-chain; catch
+	// it here when the token exposes its separator.
+	if out, err := t.call(ctx, "DOMAIN_SEPARATOR"); err == nil {
+		want := out[0].([32]byte)
+		got, err := td.HashStruct("EIP712Domain", td.Domain.Map())
+		if err == nil && !bytes.Equal(got, want[:]) {
+			return fmt.Errorf("domain separator mismatch: %s has %x, name %q version %q give %x; try --version", token.Hex(), want, t.name, *version, []byte(got))
+		}
+	}
+
+	describeDomain(&td)
+	ui.Printf("Owner:    %s (%s)\n", owner.Address.Hex(), owner.Source)
+	sig, err := owner.SignHash(digest)
+	if err != nil {
+		return fmt.Errorf("sign: %w", err)
+	}
+	sig[64] += 27
+	report := newSignatureReport(digest, owner.Address, sig)
+	ui.report.Token = t.report()
+	ui.report.TypedData = report
+	ui.report.Permit = &PermitReport{Owner: owner.Address, Spender: spender, Nonce: nonce.String(), Deadline: deadline.String()}
+	ui.Resultf("Spender:  %s\n", spender.Hex())
+	if value != nil {
+		ui.Resultf("Value:    %s (%s)\n", t.format(value), value)
+		ui.report.Permit.Value = value.String()
+	} else {
+		ui.Resultf("Allowed:  %t\n", td.Message["allowed"])
+		ui.report.Permit.Allowed = td.Message["allowed"].(bool)
+	}
+	ui.Resultf("Nonce:    %s\n", nonce)
+	ui.Resultf("Deadline: %s\n", deadline)
+	ui.Resultf("v:        %d\n", report.V)
+	ui.Resultf("r:        %s\n", report.R)
+	ui.Resultf("s:        %s\n", report.S)
+	if s == nil {
+		return nil
+	}
+
+	var r, ss [32]byte
+	copy(r[:], sig[:32])
+	copy(ss[:], sig[32:64])
+	if *style == "dai" {
+		return t.send(ctx, s, txo, "permit0", owner.Address, spender, nonce, deadline, td.Message["allowed"].(bool), sig[64], r, ss)
+	}
+	return t.send(ctx, s, txo, "permit", owner.Address, spender, value, deadline, sig[64], r, ss)
+}
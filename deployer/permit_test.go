@@ -0,0 +1,88 @@
+package deployer
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// The permit token fixture is an EIP-2612 token named "Permit Token"
+// with no version(): permit checks the deadline and the owner's
+// signature through ecrecover, bumps nonces(owner), sets the allowance
+// and emits Approval. It has decimals, name, allowance, nonces and
+// DOMAIN_SEPARATOR besides, and no balances.
+const (
+	permitTokenRuntime  = "60003560e01c8063313ce5671461004d57806306fdde0314610058578063dd62ed3e1461008c5780637ecebe00146100a25780633644e515146100af578063d505accf1461013c575b600080fd5b601260005260206000f35b6020600052600c6020527f5065726d697420546f6b656e000000000000000000000000000000000000000060405260606000f35b6040600460003760406000205460005260206000f35b6004355460005260206000f35b6100b76100c0565b60005260206000f35b7f8b73c3c69bb8fe3d512ecc4cf759cc79239f7b179b0ffacaa9a75d522b39400f6000527fce9811de3d460752170ab4b750555e0fa501e9f1e07174a522573f3b35aa06be6020527fc89efdaa54c0f20c7adf612882df0950f5a951637e0307cdcb4c672f298b8bc6604052466060523060805260a060002090565b60643542116100485761014d6100c0565b7f6e71edae12b1b97f4d1f60370fef10105fa2faae0126114a169c64845d6126c961010052606060046101203760043554610180526064356101a05260c06101002061190161020052906102205261024052604261021e206103005260606084610320376000610400526020610400608061030060015afa506104005180156100485760043514156100485760043580546001019055604060046000376044356040600020556044356080526024356004357f8c5be1e5ebec7d5bd14f71427d1e84f3dd0314c0f7b2291e5b200ac8c7c3b92560206080a300"
+	permitTokenCreation = "61022780600c6000396000f3" + permitTokenRuntime
+)
+
+// relayerKey is the second Anvil dev account, which sends permits.
+const relayerKey = "0x59c6995e998f97a5a0044966f0945389dc9e86dae88c7a8412f4603b6b78690d"
+
+var relayerAddr = common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8")
+
+// TestPermit signs a permit as testKey for 1.5 tokens, printing it and
+// then sending it from the relayer: the token checks the signature and
+// sets the allowance.
+func TestPermit(t *testing.T) {
+	chain := newSimChain(t, relayerAddr)
+	chain.autoCommit(t)
+	c := chain.dial(t, Config{})
+	ctx := t.Context()
+	art, err := newArtifact("PermitToken", []byte(erc20ABI), codeObject{Object: permitTokenCreation}, codeObject{Object: permitTokenRuntime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := c.Deploy(ctx, art)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spender := common.HexToAddress("0x000000000000000000000000000000000000dEaD")
+	read := func(method string, args ...interface{}) *big.Int {
+		t.Helper()
+		out, err := c.Call(ctx, art, token.Address, method, args...)
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		return out[0].(*big.Int)
+	}
+	t.Setenv("PRIVATE_KEY", testKey)
+	args := []string{"--rpc", chain.rpc, "--poll-interval", "10ms", "--yes", token.Address.Hex(), spender.Hex(), "1.5"}
+
+	out, err := results(t, runERC20Permit, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Value:    1.5 (1500000000000000000)") || !strings.Contains(out, "Nonce:    0") || !strings.Contains(out, "v:        ") {
+		t.Fatalf("printed permit:\n%s", out)
+	}
+	if read("allowance", testAddr, spender).Sign() != 0 {
+		t.Fatal("printing a permit changed the allowance")
+	}
+
+	t.Setenv("RELAYER_PRIVATE_KEY", relayerKey)
+	if _, err := results(t, runERC20Permit, append([]string{"--execute"}, args...)...); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("allowance", testAddr, spender); got.Cmp(big.NewInt(15e17)) != 0 {
+		t.Fatalf("allowance after the permit = %s, want 1.5e18", got)
+	}
+	if n := read("nonces", testAddr); n.Int64() != 1 {
+		t.Fatalf("nonces(owner) = %s after one permit, want 1", n)
+	}
+	if n, err := chain.Client().NonceAt(ctx, relayerAddr, nil); err != nil || n != 1 {
+		t.Fatalf("relayer sent %d transactions (%v), want the permit", n, err)
+	}
+
+	// The token itself refuses a permit testKey did not sign.
+	if _, err := c.Call(ctx, art, token.Address, "permit", testAddr, spender, big.NewInt(1), big.NewInt(1<<40), uint8(27), [32]byte{1}, [32]byte{1}); err == nil {
+		t.Fatal("permit with a forged signature did not revert")
+	}
+
+	// A domain the token does not use is caught before signing.
+	if _, err := results(t, runERC20Permit, append([]string{"--version", "2"}, args...)...); err == nil || !strings.Contains(err.Error(), "domain separator mismatch") {
+		t.Fatalf("permit with --version 2 = %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// messageBytes reads a sign-message argument: @path for a file's
+// contents, 0x hex for raw bytes, anything else the text itself.
+func messageBytes(arg string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(arg, "@"):
+		b, err := os.ReadFile(arg[1:])
+		if err != nil {
+			return nil, fmt.Errorf("read message: %w", err)
+		}
+		return b, nil
+	case strings.HasPrefix(arg, "0x"):
+		b, err := hexutil.Decode(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex message %q: %w", arg, err)
+		}
+		return b, nil
+	}
+	return []byte(arg), nil
+}
+
+// runSignMessage implements `sign-message [flags] <text|@file|0xhex>`:
+// an EIP-191 personal_sign signature from the deployer's key.
+func runSignMessage(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("sign-message", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: sign-message [flags] <text|@file|0xhex>")
+	}
+	msg, err := messageBytes(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	signer, err := LoadSigner(o.keys)
+	if err != nil {
+		return err
+	}
+	ui.Printf("Signer: %s (%s)\n", signer.Address.Hex(), signer.Source)
+
+	digest := accounts.TextHash(msg)
+	sig, err := signer.SignHash(digest)
+	if err != nil {
+		return fmt.Errorf("sign: %w", err)
+	}
+	sig[64] += 27
+	report := newSignatureReport(digest, signer.Address, sig)
+	ui.Resultf("Message:   %d bytes\n", len(msg))
+	ui.Resultf("Hash:      %s\n", report.Digest)
+	ui.Resultf("Signature: %s\n", report.Signature)
+	ui.report.Message = report
+	return nil
+}
+
+// runVerifyMessage implements `verify-message <signature>
+// <text|@file|0xhex> [--expect address]`: recover who personal_signed a
+// message.
+func runVerifyMessage(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("verify-message", flag.ExitOnError)
+	ui.register(fs)
+	var expect string
+	fs.StringVar(&expect, "expect", "", "fail unless the signature is from this address")
+	pos := parseInterspersed(fs, args)
+	if len(pos) != 2 {
+		return errors.New("usage: verify-message <signature> <text|@file|0xhex> [--expect address]")
+	}
+	sig, err := parseSignature(pos[0])
+	if err != nil {
+		return err
+	}
+	var want common.Address
+	if expect != "" {
+		if want, err = parseAddress(expect); err != nil {
+			return fmt.Errorf("--expect: %w", err)
+		}
+	}
+	msg, err := messageBytes(pos[1])
+	if err != nil {
+		return err
+	}
+
+	digest := accounts.TextHash(msg)
+	signer, rsv, err := recoverSigner(digest, sig)
+	if err != nil {
+		return err
+	}
+	report := newSignatureReport(digest, signer, rsv)
+	ui.report.Message = report
+	ui.Resultf("Hash:   %s\n", report.Digest)
+	ui.Resultf("Signer: %s\n", signer.Hex())
+	if expect != "" && signer != want {
+		return fmt.Errorf("signature is from %s, not %s", signer.Hex(), want.Hex())
+	}
+	return nil
+}
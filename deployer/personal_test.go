@@ -0,0 +1,94 @@
+package deployer
+
+import (
+	"strings"
+	"testing"
+)
+
+// helloWorldSig is testKey's personal_sign signature of "hello world",
+// as `cast wallet sign` and viem's signMessage give it.
+const helloWorldSig = "0xa461f509887bd19e312c0c58467ce8ff8e300d3c1a90b608a760c5b80318eaf15fe57c96f9175d6cd4daad4663763baa7e78836e067d0163e9a2ccf2ff753f5b1b"
+
+func TestSignMessage(t *testing.T) {
+	isolate(t)
+	t.Setenv("PRIVATE_KEY", testKey)
+	out, err := results(t, runSignMessage, "hello world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "Signature: "+helloWorldSig+"\n") {
+		t.Fatalf("sign-message printed\n%s\nwant signature %s", out, helloWorldSig)
+	}
+	if !strings.Contains(out, "Hash:      0xd9eba16ed0ecae432b71fe008c98cc872bb4cc214d3220a36f365326cf807d68\n") {
+		t.Fatalf("sign-message printed\n%s\nwant the EIP-191 hash of hello world", out)
+	}
+}
+
+func TestVerifyMessage(t *testing.T) {
+	other := "0x70997970C51812dc3A010C7d01b50e0d17dc79C8"
+	for _, tt := range []struct {
+		name string
+		args []string
+		want string // error substring, or "" for success
+	}{
+		{"no expectation", []string{helloWorldSig, "hello world"}, ""},
+		{"expect after", []string{helloWorldSig, "hello world", "--expect", testAddr.Hex()}, ""},
+		{"expect before", []string{"--expect", testAddr.Hex(), helloWorldSig, "hello world"}, ""},
+		{"expect between", []string{helloWorldSig, "--expect=" + testAddr.Hex(), "hello world"}, ""},
+		{"v as 0/1", []string{helloWorldSig[:len(helloWorldSig)-2] + "00", "hello world", "--expect", testAddr.Hex()}, ""},
+		{"hex message", []string{helloWorldSig, "0x68656c6c6f20776f726c64", "--expect", testAddr.Hex()}, ""},
+		{"wrong signer", []string{helloWorldSig, "hello world", "--expect", other}, "not " + other},
+		{"other message", []string{helloWorldSig, "hello", "--expect", testAddr.Hex()}, "signature is from"},
+		{"dash message", []string{"--expect", testAddr.Hex(), "--", helloWorldSig, "-hello"}, "signature is from"},
+		{"bad address", []string{helloWorldSig, "hello world", "--expect", "0x1234"}, "--expect"},
+		{"missing message", []string{helloWorldSig, "--expect", testAddr.Hex()}, "usage: verify-message <signature> <text|@file|0xhex> [--expect address]"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := results(t, runVerifyMessage, tt.args...)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Fatal(err)
+			case tt.want == "" && !strings.Contains(out, "Signer: "+testAddr.Hex()):
+				t.Fatalf("printed %q, want signer %s", out, testAddr.Hex())
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignVerifyMessageRoundTrip(t *testing.T) {
+	isolate(t)
+	t.Setenv("PRIVATE_KEY", testKey)
+	for _, msg := range []string{"gm", "0xdeadbeef", "multi\nline ✓"} {
+		out, err := results(t, runSignMessage, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, sig, ok := strings.Cut(out, "Signature: ")
+		if !ok {
+			t.Fatalf("no signature in %q", out)
+		}
+		if _, err := results(t, runVerifyMessage, strings.TrimSpace(sig), msg, "--expect", testAddr.Hex()); err != nil {
+			t.Errorf("verify %q: %v", msg, err)
+		}
+	}
+}
+
+// TestVerifyTypedData checks the EIP-712 specification's example: Cow's
+// mail to Bob, signed with keccak256("cow").
+func TestVerifyTypedData(t *testing.T) {
+	mail := "testdata/typeddata/mail.json"
+	sig := "0x4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b915621c"
+	cow := "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"
+	out, err := results(t, runVerifyTypedData, mail, sig, "--signer", cow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Digest: 0xbe609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2\nSigner: " + cow + "\n"; out != want {
+		t.Fatalf("printed %q, want %q", out, want)
+	}
+	if _, err := results(t, runVerifyTypedData, "--signer", testAddr.Hex(), mail, sig); err == nil || !strings.Contains(err.Error(), "not "+testAddr.Hex()) {
+		t.Fatalf("wrong --signer: %v", err)
+	}
+}
@@ -0,0 +1,685 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"gopkg.in/yaml.v3"
+)
+
+// plan is a YAML file of steps run in order by `run`. predicts is set
+// when it references predicted addresses.
+type plan struct {
+	Steps    []planStep `yaml:"steps"`
+	predicts bool
+}
+
+// planStep is one deploy, send or call. Exactly one of Deploy, Send and
+// Call names the contract (by name under --out-dir, or an artifact path).
+// Strings anywhere in Address and Args may contain {{ ... }} references
+// to earlier results.
+type planStep struct {
+	Name     string        `yaml:"name"`
+	Deploy   string        `yaml:"deploy"`
+	Send     string        `yaml:"send"`
+	Call     string        `yaml:"call"`
+	Address  string        `yaml:"address"`
+	Function string        `yaml:"function"`
+	Args     []interface{} `yaml:"args"`
+
+	// Libraries maps library names to addresses for linking a deploy;
+	// libraries neither listed nor recorded are deployed first.
+	Libraries map[string]string `yaml:"libraries"`
+
+	Value       string `yaml:"value"`
+	ForceValue  bool   `yaml:"force_value"`
+	GasLimit    uint64 `yaml:"gas_limit"`
+	MaxFee      string `yaml:"max_fee"`
+	PriorityFee string `yaml:"priority_fee"`
+}
+
+// kind returns the step's action and the contract it acts on.
+func (st *planStep) kind() (string, string, error) {
+	var kinds []string
+	var contract string
+	for _, k := range []struct{ kind, contract string }{{"deploy", st.Deploy}, {"send", st.Send}, {"call", st.Call}} {
+		if k.contract != "" {
+			kinds, contract = append(kinds, k.kind), k.contract
+		}
+	}
+	if len(kinds) != 1 {
+		return "", "", errors.New("needs exactly one of deploy, send or call")
+	}
+	if kinds[0] != "deploy" && st.Function == "" {
+		return "", "", fmt.Errorf("%s needs a function", kinds[0])
+	}
+	return kinds[0], contract, nil
+}
+
+// loadPlan reads a plan and gives every step a unique name: deploys
+// default to the contract name, sends and calls to Contract.function.
+func loadPlan(path string) (*plan, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read plan: %w", err)
+	}
+	var p plan
+	if err := yaml.Unmarshal(raw, &p); err != nil {
+		return nil, fmt.Errorf("parse plan %s: %w", path, err)
+	}
+	if len(p.Steps) == 0 {
+		return nil, fmt.Errorf("plan %s has no steps", path)
+	}
+	seen := map[string]bool{}
+	for i := range p.Steps {
+		st := &p.Steps[i]
+		kind, contract, err := st.kind()
+		if err != nil {
+			return nil, fmt.Errorf("plan step %d: %w", i+1, err)
+		}
+		if st.Name == "" {
+			st.Name = contractName(contract)
+			if kind != "deploy" {
+				st.Name += "." + st.Function
+			}
+		}
+		if seen[st.Name] {
+			return nil, fmt.Errorf("plan step %d: duplicate step name %q; set name:", i+1, st.Name)
+		}
+		seen[st.Name] = true
+	}
+	// Outputs only exist once their step has run, so a step may only use
+	// those of earlier ones; this also rules out cycles.
+	index := map[string]int{}
+	for i := range p.Steps {
+		index[p.Steps[i].Name] = i
+	}
+	for i := range p.Steps {
+		st := &p.Steps[i]
+		refs, err := stepRefs(st)
+		if err != nil {
+			return nil, fmt.Errorf("plan step %d: %w", i+1, err)
+		}
+		for _, ref := range refs {
+			parts := strings.Split(ref, ".")
+			if len(parts) < 3 || parts[0] != "steps" {
+				continue
+			}
+			if j, ok := index[strings.Join(parts[1:len(parts)-1], ".")]; ok && j >= i {
+				return nil, fmt.Errorf("plan step %d (%s): {{ %s }} refers to a step that has not run yet; steps can only use the outputs of earlier ones", i+1, st.Name, ref)
+			}
+		}
+	}
+	for _, m := range templateRef.FindAllStringSubmatch(string(raw), -1) {
+		if strings.HasPrefix(m[1], "predicted.") {
+			p.predicts = true
+		}
+	}
+	return &p, nil
+}
+
+// contractName is the contract an artifact reference names: the file
+// name without .json for paths, the reference itself otherwise.
+func contractName(ref string) string {
+	if strings.HasSuffix(ref, ".json") {
+		return strings.TrimSuffix(filepath.Base(ref), ".json")
+	}
+	return ref
+}
+
+// runRecord is deployments/<chainid>/runs/<plan>.json: the steps of a plan
+// completed on that chain, in order, with their outputs.
+type runRecord struct {
+	Plan    string       `json:"plan"`
+	ChainID uint64       `json:"chainId"`
+	Steps   []stepRecord `json:"steps"`
+}
+
+type stepRecord struct {
+	Name      string            `json:"name"`
+	Kind      string            `json:"kind"`
+	Outputs   map[string]string `json:"outputs"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+func runRecordPath(dir string, chainID *big.Int, planPath string) string {
+	name := strings.TrimSuffix(filepath.Base(planPath), filepath.Ext(planPath))
+	return filepath.Join(dir, chainID.String(), "runs", name+".json")
+}
+
+func readRunRecord(path string) (*runRecord, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &runRecord{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read run record: %w", err)
+	}
+	var r runRecord
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return nil, fmt.Errorf("parse run record %s: %w", path, err)
+	}
+	return &r, nil
+}
+
+// templateRef matches {{ name.path }} references in plan strings.
+var templateRef = regexp.MustCompile(`\{\{\s*([\w.\-]+)\s*\}\}`)
+
+// planRun is the state of one `run`: the session, where artifacts and
+// manifests live, every output produced so far and the addresses its
+// deploys are predicted to get. With --parallel, mu is held by the step
+// using any of it.
+type planRun struct {
+	s         *session
+	ao        artifactOptions
+	dir       string
+	outputs   map[string]string // e.g. "steps.Token.address"
+	predicted map[string]common.Address
+	mu        sync.Mutex
+}
+
+// lookup resolves a template reference. deployments.<Name>.<field> falls
+// back to the manifest, so contracts deployed outside the plan can be
+// referenced too. predicted.<Name>.address is where a deploy of the plan
+// will land, so steps can reference contracts deployed after them.
+func (r *planRun) lookup(ref string) (string, error) {
+	if v, ok := r.outputs[ref]; ok {
+		return v, nil
+	}
+	parts := strings.Split(ref, ".")
+	if len(parts) == 3 && parts[0] == "predicted" && parts[2] == "address" {
+		if a, ok := r.predicted[parts[1]]; ok {
+			return a.Hex(), nil
+		}
+		return "", fmt.Errorf("{{ %s }}: %s is not deployed by a step still to run", ref, parts[1])
+	}
+	if len(parts) == 3 && parts[0] == "deployments" {
+		m, err := readManifest(manifestPath(r.dir, r.s.chainID, parts[1]))
+		if err != nil {
+			return "", err
+		}
+		if d := m.latest(); d != nil {
+			switch parts[2] {
+			case "address":
+				return d.Address.Hex(), nil
+			case "implementation":
+				return d.codeAddress().Hex(), nil
+			case "txHash":
+				return d.TxHash.Hex(), nil
+			case "block":
+				return strconv.FormatUint(d.BlockNumber, 10), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unknown reference {{ %s }}", ref)
+}
+
+// expand replaces every reference in the strings inside v.
+func (r *planRun) expand(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		var err error
+		out := templateRef.ReplaceAllStringFunc(v, func(m string) string {
+			val, lerr := r.lookup(templateRef.FindStringSubmatch(m)[1])
+			if lerr != nil && err == nil {
+				err = lerr
+			}
+			return val
+		})
+		return out, err
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			x, err := r.expand(e)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = x
+		}
+		return out, nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			x, err := r.expand(e)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = x
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// args expands st.Args and normalizes them to the JSON-decoded form
+// convertArgs expects.
+func (r *planRun) args(st *planStep) ([]interface{}, error) {
+	expanded, err := r.expand(st.Args)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("args: %w", err)
+	}
+	return rawArgs(nil, string(raw))
+}
+
+// artifact resolves a step's contract reference.
+func (r *planRun) artifact(ref string, needCode bool) (*Artifact, error) {
+	ao := r.ao
+	ao.path, ao.contract = "", ref
+	if strings.HasSuffix(ref, ".json") {
+		ao.path, ao.contract = ref, ""
+	}
+	path, contract, err := ao.resolve()
+	if err != nil {
+		return nil, err
+	}
+	if needCode {
+		return loadArtifact(path, contract)
+	}
+	return loadABI(path, contract)
+}
+
+// maxLinkDepth bounds how deeply libraries may link other libraries.
+const maxLinkDepth = 8
+
+// deployLibraries deploys every library c still lacks (linking each one's
+// own libraries first), records them, and links c against them. Library
+// artifacts are looked up as <out-dir>/<Source file>/<Name>.json.
+func (r *planRun) deployLibraries(ctx context.Context, c *Artifact, depth int) error {
+	if depth > maxLinkDepth {
+		return fmt.Errorf("libraries of %s nested more than %d deep", c.Name, maxLinkDepth)
+	}
+	for i, lib := range c.Libraries {
+		if lib.Address != nil {
+			continue
+		}
+		l, err := loadArtifact(filepath.Join(r.ao.outDir, filepath.Base(lib.Source), lib.Name+".json"), lib.Name)
+		if err != nil {
+			return fmt.Errorf("library %s: %w", lib.Name, err)
+		}
+		if err := linkLibraries(l, nil, r.dir, r.s.chainID); err != nil {
+			return err
+		}
+		if err := r.deployLibraries(ctx, l, depth+1); err != nil {
+			return err
+		}
+		r.s.ui.Printf("Deploying library %s for %s\n", l.Name, c.Name)
+		address, d, _, err := r.s.deployContract(ctx, l, deployOptions{tx: txOptions{nonce: -1}}, nil)
+		if d != nil {
+			if _, rerr := recordDeployment(r.dir, r.s.chainID, l, nil, *d); rerr != nil {
+				return rerr
+			}
+		}
+		if err != nil {
+			return err
+		}
+		r.outputs["deployments."+l.Name+".address"] = address.Hex()
+		c.setLibrary(i, address)
+	}
+	return nil
+}
+
+// txOptions builds the per-step overrides.
+func (st *planStep) txOptions() (txOptions, error) {
+	txo := txOptions{value: st.Value, forceValue: st.ForceValue, gasLimit: st.GasLimit, nonce: -1}
+	var err error
+	if txo.fees.MaxFee, err = parseValue(st.MaxFee); err != nil {
+		return txo, fmt.Errorf("max_fee: %w", err)
+	}
+	if txo.fees.PriorityFee, err = parseValue(st.PriorityFee); err != nil {
+		return txo, fmt.Errorf("priority_fee: %w", err)
+	}
+	return txo, nil
+}
+
+// deployTarget loads the contract a deploy step creates, with its
+// constructor arguments, linked against the step's libraries and those
+// already recorded.
+func (r *planRun) deployTarget(ref string, st *planStep, raw []interface{}) (*Artifact, []interface{}, error) {
+	c, err := r.artifact(ref, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	args, err := convertArgs(c.ABI.Constructor.Inputs, raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s constructor: %w", c.Name, err)
+	}
+	libs := map[string]common.Address{}
+	for name, ref := range st.Libraries {
+		v, err := r.expand(ref)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !common.IsHexAddress(v.(string)) {
+			return nil, nil, fmt.Errorf("library %s: invalid address %q", name, v)
+		}
+		libs[name] = common.HexToAddress(v.(string))
+	}
+	if err := linkLibraries(c, libs, r.dir, r.s.chainID); err != nil {
+		return nil, nil, err
+	}
+	return c, args, nil
+}
+
+// callTarget resolves the contract, address, method and arguments of a
+// send or call step. The address defaults to the contract's latest
+// deployment.
+func (r *planRun) callTarget(ref string, st *planStep, raw []interface{}) (*Artifact, common.Address, *abi.Method, []interface{}, error) {
+	c, err := r.artifact(ref, false)
+	if err != nil {
+		return nil, common.Address{}, nil, nil, err
+	}
+	addrRef := st.Address
+	if addrRef == "" {
+		addrRef = "{{ deployments." + c.Name + ".address }}"
+	}
+	expanded, err := r.expand(addrRef)
+	if err != nil {
+		return nil, common.Address{}, nil, nil, err
+	}
+	address, err := parseAddress(expanded.(string))
+	if err != nil {
+		return nil, common.Address{}, nil, nil, err
+	}
+	m, err := resolveMethod(&c.ABI, st.Function)
+	if err != nil {
+		return nil, common.Address{}, nil, nil, err
+	}
+	args, err := convertArgs(m.Inputs, raw)
+	if err != nil {
+		return nil, common.Address{}, nil, nil, fmt.Errorf("%s: %w", m.Sig, err)
+	}
+	return c, address, m, args, nil
+}
+
+// step executes st and returns its outputs.
+func (r *planRun) step(ctx context.Context, st *planStep) (string, map[string]string, error) {
+	kind, ref, _ := st.kind()
+	txo, err := st.txOptions()
+	if err != nil {
+		return kind, nil, err
+	}
+	raw, err := r.args(st)
+	if err != nil {
+		return kind, nil, err
+	}
+
+	if kind == "deploy" {
+		c, args, err := r.deployTarget(ref, st, raw)
+		if err != nil {
+			return kind, nil, err
+		}
+		if err := r.deployLibraries(ctx, c, 0); err != nil {
+			return kind, nil, err
+		}
+		address, d, rcpt, err := r.s.deployContract(ctx, c, deployOptions{tx: txo}, args)
+		if d != nil {
+			// A nonce conflict still deployed it, elsewhere: record where.
+			var rerr error
+			if d, rerr = recordDeployment(r.dir, r.s.chainID, c, args, *d); rerr != nil {
+				return kind, nil, rerr
+			}
+		}
+		if err != nil {
+			return kind, nil, err
+		}
+		r.s.ui.Printf("Recorded %s v%d in %s\n", c.Name, d.Version, manifestPath(r.dir, r.s.chainID, c.Name))
+		if err := r.checkPredicted(st, address); err != nil {
+			return kind, nil, err
+		}
+		out := map[string]string{
+			"address": address.Hex(),
+			"txHash":  rcpt.TxHash.Hex(),
+			"block":   rcpt.BlockNumber.String(),
+		}
+		for k, v := range out {
+			r.outputs["deployments."+c.Name+"."+k] = v
+		}
+		return kind, out, nil
+	}
+
+	c, address, m, args, err := r.callTarget(ref, st, raw)
+	if err != nil {
+		return kind, nil, err
+	}
+	bound := bind.NewBoundContract(address, c.ABI, r.s.client, r.s.client, r.s.client)
+
+	if kind == "call" {
+		vals, err := callMethod(ctx, bound, &c.ABI, m, nil, args)
+		if err != nil {
+			return kind, nil, err
+		}
+		typed := printValues(m.Outputs, vals)
+		r.s.ui.report.Calls = append(r.s.ui.report.Calls, CallReport{Method: m.Sig, Results: typed})
+		out := map[string]string{}
+		for i, t := range typed {
+			v := formatValue(t.Value)
+			out[strconv.Itoa(i)] = v
+			out[t.Name] = v
+		}
+		return kind, out, nil
+	}
+
+	tx, err := r.s.transact(ctx, bound, &c.ABI, m, args, txo)
+	if err != nil {
+		return kind, nil, err
+	}
+	rcpt, err := r.s.waitReceipt(ctx, tx, &c.ABI)
+	if err != nil {
+		return kind, nil, err
+	}
+	r.s.ui.report.Transactions = append(r.s.ui.report.Transactions, *newTxReport(m.Sig, rcpt, printEvents(r.s.ui, rcpt, &c.ABI)))
+	return kind, map[string]string{
+		"txHash":  rcpt.TxHash.Hex(),
+		"block":   rcpt.BlockNumber.String(),
+		"gasUsed": strconv.FormatUint(rcpt.GasUsed, 10),
+	}, nil
+}
+
+// runPlan implements `run [flags] <plan.yaml>`.
+func runPlan(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	o.register(fs)
+	ao.register(fs, "")
+	resume := fs.Bool("resume", false, "settle transactions a crashed run left in the journal, then skip steps already recorded for this chain")
+	bundle := fs.Bool("bundle", false, "send the plan's deploy and send steps as one eth_sendBundle to --relay-url, so they land in the same block or not at all")
+	bundleBlocks := fs.Uint64("bundle-blocks", 5, "with --bundle, blocks to resubmit for before re-signing with refreshed fees")
+	parallel := fs.Int("parallel", 1, "run up to this many independent steps at once, their transactions in flight together")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: run [flags] <plan.yaml>")
+	}
+	planPath := fs.Arg(0)
+	p, err := loadPlan(planPath)
+	if err != nil {
+		return err
+	}
+	switch {
+	case *parallel < 1:
+		return errors.New("--parallel: want at least 1")
+	case *parallel > 1 && *bundle:
+		return errors.New("--parallel does not apply to --bundle, which sends every step at once already")
+	case *parallel > 1 && p.predicts:
+		return errors.New("--parallel cannot keep the nonce order {{ predicted.* }} addresses assume; run this plan without it")
+	}
+
+	s, err := openSession(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	recPath := runRecordPath(o.deployments, s.chainID, planPath)
+	rec := &runRecord{}
+	if *resume && s.journal != nil {
+		// Settle what the crashed run sent first, so deployments that
+		// landed are in the manifests before steps referencing them run.
+		if err := s.journal.recover(ctx, s.client, &o, ""); err != nil {
+			return err
+		}
+	}
+	if *resume {
+		if rec, err = readRunRecord(recPath); err != nil {
+			return err
+		}
+	}
+	rec.Plan, rec.ChainID = planPath, s.chainID.Uint64()
+
+	r := &planRun{s: s, ao: ao, dir: o.deployments, outputs: map[string]string{}}
+	done := map[string]bool{}
+	for _, sr := range rec.Steps {
+		done[sr.Name] = true
+		for k, v := range sr.Outputs {
+			r.outputs["steps."+sr.Name+"."+k] = v
+		}
+	}
+	var steps []*planStep
+	for i := range p.Steps {
+		if st := &p.Steps[i]; !done[st.Name] {
+			steps = append(steps, st)
+		}
+	}
+	if p.predicts {
+		if err := r.predict(ctx, steps); err != nil {
+			return fmt.Errorf("predict addresses: %w", err)
+		}
+	}
+
+	if *bundle {
+		for i := range p.Steps {
+			if st := &p.Steps[i]; done[st.Name] {
+				ui.Printf("Step %d/%d %s: already recorded, skipping\n", i+1, len(p.Steps), st.Name)
+			}
+		}
+		if len(steps) == 0 {
+			ui.Printf("Plan complete; steps recorded in %s\n", recPath)
+			return nil
+		}
+		rl, err := o.relay.dial(s.chainID)
+		if err != nil {
+			return err
+		}
+		ui.Printf("Bundle relay: %s (as %s)\n", redactURL(rl.url), rl.address().Hex())
+		outputs, err := r.bundle(ctx, rl, steps, *bundleBlocks)
+		if err != nil {
+			return err
+		}
+		for i, st := range steps {
+			kind, _, _ := st.kind()
+			rec.Steps = append(rec.Steps, stepRecord{Name: st.Name, Kind: kind, Outputs: outputs[i], Timestamp: time.Now().UTC().Truncate(time.Second)})
+		}
+		if err := writeJSON(recPath, rec); err != nil {
+			return fmt.Errorf("write run record: %w", err)
+		}
+		ui.Printf("Plan complete; steps recorded in %s\n", recPath)
+		return nil
+	}
+
+	if *parallel > 1 {
+		return r.runPlanParallel(ctx, p, steps, rec, recPath, *parallel)
+	}
+	for i := range p.Steps {
+		st := &p.Steps[i]
+		kind, _, _ := st.kind()
+		if done[st.Name] {
+			ui.Printf("Step %d/%d %s: already recorded, skipping\n", i+1, len(p.Steps), st.Name)
+			ui.report.Steps = append(ui.report.Steps, StepReport{Name: st.Name, Kind: kind, Status: "recorded"})
+			continue
+		}
+		ui.Printf("Step %d/%d %s\n", i+1, len(p.Steps), st.Name)
+		kind, out, err := r.step(ctx, st)
+		if err != nil {
+			ui.report.Steps = append(ui.report.Steps, StepReport{Name: st.Name, Kind: kind, Status: "failed", Error: err.Error()})
+			return fmt.Errorf("step %s: %w", st.Name, err)
+		}
+		for k, v := range out {
+			r.outputs["steps."+st.Name+"."+k] = v
+		}
+		ui.report.Steps = append(ui.report.Steps, StepReport{Name: st.Name, Kind: kind, Status: "done", Outputs: out})
+		rec.Steps = append(rec.Steps, stepRecord{Name: st.Name, Kind: kind, Outputs: out, Timestamp: time.Now().UTC().Truncate(time.Second)})
+		if err := writeJSON(recPath, rec); err != nil {
+			return fmt.Errorf("write run record: %w", err)
+		}
+	}
+	ui.Printf("Plan complete; steps recorded in %s\n", recPath)
+	return nil
+}
+
+// runPlanParallel runs the pending steps of p through runParallel,
+// recording each as it completes, and prints how every step ended.
+func (r *planRun) runPlanParallel(ctx context.Context, p *plan, pending []*planStep, rec *runRecord, recPath string, limit int) error {
+	index := map[*planStep]int{}
+	for i := range p.Steps {
+		index[&p.Steps[i]] = i + 1
+	}
+	nodes, err := r.stepGraph(pending, index)
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		var deps []string
+		for _, d := range n.deps {
+			deps = append(deps, d.st.Name)
+		}
+		if len(deps) > 0 {
+			r.s.ui.Verbosef("  %s needs %s\n", n.st.Name, strings.Join(deps, ", "))
+		}
+	}
+	r.s.ui.Printf("Running %d steps, up to %d at a time\n", len(nodes), limit)
+	incomplete := r.runParallel(ctx, nodes, len(p.Steps), limit, func(n *stepNode) error {
+		rec.Steps = append(rec.Steps, stepRecord{Name: n.st.Name, Kind: n.kind, Outputs: n.outputs, Timestamp: time.Now().UTC().Truncate(time.Second)})
+		if err := writeJSON(recPath, rec); err != nil {
+			return fmt.Errorf("write run record: %w", err)
+		}
+		return nil
+	})
+
+	byStep := map[*planStep]*stepNode{}
+	for _, n := range nodes {
+		byStep[n.st] = n
+	}
+	r.s.ui.Println("Steps:")
+	for i := range p.Steps {
+		st := &p.Steps[i]
+		kind, _, _ := st.kind()
+		sr := StepReport{Name: st.Name, Kind: kind, Status: "recorded"}
+		if n := byStep[st]; n != nil {
+			sr.Status, sr.Outputs = n.status, n.outputs
+			if n.err != nil {
+				sr.Error = n.err.Error()
+			}
+		}
+		r.s.ui.report.Steps = append(r.s.ui.report.Steps, sr)
+		line := fmt.Sprintf("  %-30s %s", st.Name, sr.Status)
+		if sr.Error != "" {
+			line += ": " + sr.Error
+		}
+		r.s.ui.Println(line)
+	}
+	if len(incomplete) > 0 {
+		return fmt.Errorf("%d of %d steps did not complete; rerun with --resume to retry them", len(incomplete), len(nodes))
+	}
+	r.s.ui.Printf("Plan complete; steps recorded in %s\n", recPath)
+	return nil
+}
@@ -0,0 +1,185 @@
+package deployer
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// The pointer fixture stores the last word of its constructor arguments,
+// an address, and returns it from any call.
+const (
+	pointerABI      = `[{"type":"constructor","inputs":[{"name":"target","type":"address"}]},{"type":"function","name":"target","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"address"}]}]`
+	pointerRuntime  = "60005460005260206000f3"
+	pointerCreation = "602060203803600039600051600055600b80601a6000396000f3" + pointerRuntime
+)
+
+// writeArtifact writes the pointer fixture as the Foundry artifact
+// dir/<name>.json, with abi as its ABI, and returns its path.
+func writeArtifact(t *testing.T, dir, name, abi string) string {
+	t.Helper()
+	raw, err := json.Marshal(map[string]interface{}{
+		"abi":              json.RawMessage(abi),
+		"bytecode":         map[string]string{"object": "0x" + pointerCreation},
+		"deployedBytecode": map[string]string{"object": "0x" + pointerRuntime},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name+".json")
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// planTest runs plans on the chain as testKey, recording into
+// dir.
+type planTest struct {
+	chain *simChain
+	dir   string
+}
+
+func newPlanTest(t *testing.T) *planTest {
+	t.Helper()
+	chain := newSimChain(t)
+	chain.autoCommit(t)
+	isolate(t)
+	t.Setenv("PRIVATE_KEY", testKey)
+	return &planTest{chain: chain, dir: filepath.Join(t.TempDir(), "deployments")}
+}
+
+// run writes plan to a file and runs it with flags.
+func (p *planTest) run(t *testing.T, plan string, flags ...string) (string, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "plan.yaml")
+	if err := os.WriteFile(path, []byte(plan), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	args := append([]string{"--rpc", p.chain.rpc, "--deployments-dir", p.dir, "--poll-interval", "10ms", "--yes"}, flags...)
+	return path, runPlan(t.Context(), append(args, path))
+}
+
+// deployed is the latest deployment of name the manifests record, and
+// the nonce it was sent at.
+func (p *planTest) deployed(t *testing.T, name string) (*Deployment, uint64) {
+	t.Helper()
+	m, err := readManifest(manifestPath(p.dir, big.NewInt(1337), name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := m.latest()
+	if d == nil {
+		t.Fatalf("no deployment of %s recorded", name)
+	}
+	tx, _, err := p.chain.Client().TransactionByHash(t.Context(), d.TxHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, tx.Nonce()
+}
+
+// target is the address the pointer at a stores.
+func (p *planTest) target(t *testing.T, a common.Address) common.Address {
+	t.Helper()
+	word, err := p.chain.Client().StorageAt(t.Context(), a, common.Hash{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return common.BytesToAddress(word)
+}
+
+// TestRunPlanReference runs a two-step plan whose second deploy takes the
+// first's address, read back from the manifest.
+func TestRunPlanReference(t *testing.T) {
+	p := newPlanTest(t)
+	artifacts := t.TempDir()
+	first := writeArtifact(t, artifacts, "First", pointerABI)
+	second := writeArtifact(t, artifacts, "Second", pointerABI)
+
+	planPath, err := p.run(t, "steps:\n"+
+		"  - deploy: "+first+"\n    args: [\"0x0000000000000000000000000000000000000001\"]\n"+
+		"  - deploy: "+second+"\n    args: [\"{{ deployments.First.address }}\"]\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, aNonce := p.deployed(t, "First")
+	b, bNonce := p.deployed(t, "Second")
+	if aNonce != 0 || bNonce != 1 {
+		t.Fatalf("First sent at nonce %d and Second at %d, want 0 then 1", aNonce, bNonce)
+	}
+	if got := p.target(t, b.Address); got != a.Address {
+		t.Fatalf("Second was given %s, want First's address %s", got.Hex(), a.Address.Hex())
+	}
+	rec, err := readRunRecord(runRecordPath(p.dir, big.NewInt(1337), planPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Steps) != 2 || rec.Steps[0].Name != "First" || rec.Steps[1].Name != "Second" || rec.Steps[1].Outputs["address"] != b.Address.Hex() {
+		t.Fatalf("run record steps = %+v, want First then Second", rec.Steps)
+	}
+}
+
+// TestRunPlanDiamond runs A, B and C needing A, and D needing B and C,
+// in parallel: D is sent only once both B and C are mined, with their
+// addresses.
+func TestRunPlanDiamond(t *testing.T) {
+	p := newPlanTest(t)
+	artifacts := t.TempDir()
+	path := map[string]string{}
+	for _, name := range []string{"A", "B", "C"} {
+		path[name] = writeArtifact(t, artifacts, name, pointerABI)
+	}
+	// D stores the second of its two addresses.
+	path["D"] = writeArtifact(t, artifacts, "D", `[{"type":"constructor","inputs":[{"name":"left","type":"address"},{"name":"right","type":"address"}]}]`)
+
+	_, err := p.run(t, "steps:\n"+
+		"  - deploy: "+path["A"]+"\n    args: [\"0x0000000000000000000000000000000000000001\"]\n"+
+		"  - deploy: "+path["B"]+"\n    args: [\"{{ steps.A.address }}\"]\n"+
+		"  - deploy: "+path["C"]+"\n    args: [\"{{ steps.A.address }}\"]\n"+
+		"  - deploy: "+path["D"]+"\n    args: [\"{{ steps.B.address }}\", \"{{ steps.C.address }}\"]\n",
+		"--parallel", "3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, aNonce := p.deployed(t, "A")
+	b, bNonce := p.deployed(t, "B")
+	c, cNonce := p.deployed(t, "C")
+	d, dNonce := p.deployed(t, "D")
+	if aNonce != 0 || dNonce != 3 || min(bNonce, cNonce) != 1 || max(bNonce, cNonce) != 2 {
+		t.Fatalf("nonces A %d, B %d, C %d, D %d; want A first and D last", aNonce, bNonce, cNonce, dNonce)
+	}
+	if d.BlockNumber <= max(b.BlockNumber, c.BlockNumber) {
+		t.Fatalf("D mined in block %d, not after B (%d) and C (%d)", d.BlockNumber, b.BlockNumber, c.BlockNumber)
+	}
+	if p.target(t, b.Address) != a.Address || p.target(t, c.Address) != a.Address || p.target(t, d.Address) != c.Address {
+		t.Fatal("a step was not given the address it references")
+	}
+}
+
+// TestRunPlanCycle checks a plan whose steps reference each other is
+// rejected before anything is sent.
+func TestRunPlanCycle(t *testing.T) {
+	p := newPlanTest(t)
+	artifacts := t.TempDir()
+	a, b := writeArtifact(t, artifacts, "A", pointerABI), writeArtifact(t, artifacts, "B", pointerABI)
+	plan := "steps:\n" +
+		"  - deploy: " + a + "\n    args: [\"{{ steps.B.address }}\"]\n" +
+		"  - deploy: " + b + "\n    args: [\"{{ steps.A.address }}\"]\n"
+	for _, flags := range [][]string{nil, {"--parallel", "2"}} {
+		_, err := p.run(t, plan, flags...)
+		if err == nil || !strings.Contains(err.Error(), "plan step 1 (A): {{ steps.B.address }} refers to a step that has not run yet") {
+			t.Fatalf("cyclic plan with %v = %v", flags, err)
+		}
+	}
+	if n, err := p.chain.Client().NonceAt(t.Context(), testAddr, nil); err != nil || n != 0 {
+		t.Fatalf("cyclic plan sent %d transactions (%v)", n, err)
+	}
+}
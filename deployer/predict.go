@@ -0,0 +1,152 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// PredictedReport is the address a CREATE from Deployer at Nonce gets.
+type PredictedReport struct {
+	Deployer common.Address `json:"deployer"`
+	Nonce    uint64         `json:"nonce"`
+	Address  common.Address `json:"address"`
+}
+
+// runPredictAddress implements `predict-address [flags] [deployer]`: the
+// address the deployer's next contract, or the one at --nonce, will have.
+// With --nonce it needs no node.
+func runPredictAddress(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("predict-address", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	nonce := fs.Int64("nonce", -1, "nonce the contract is deployed at (default: the deployer's pending nonce)")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	var deployer common.Address
+	switch fs.NArg() {
+	case 0:
+		signer, err := LoadSigner(o.keys)
+		if err != nil {
+			return fmt.Errorf("%w (or pass the deployer's address)", err)
+		}
+		deployer = signer.Address
+	case 1:
+		var err error
+		if deployer, err = parseAddress(fs.Arg(0)); err != nil {
+			return err
+		}
+	default:
+		return errors.New("usage: predict-address [--nonce N] [deployer]")
+	}
+
+	n := uint64(*nonce)
+	if *nonce < 0 {
+		client, _, err := connect(ctx, &o)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		if n, err = client.PendingNonceAt(ctx, deployer); err != nil {
+			return fmt.Errorf("pending nonce of %s: %w", deployer.Hex(), err)
+		}
+	}
+	address := crypto.CreateAddress(deployer, n)
+	ui.report.Predicted = &PredictedReport{Deployer: deployer, Nonce: n, Address: address}
+	ui.Resultf("Predicted address: %s (CREATE from %s at nonce %d)\n", address.Hex(), deployer.Hex(), n)
+	return nil
+}
+
+// predict fills in r.predicted, the addresses the deploys among steps will
+// get, keyed by step and contract name, for {{ predicted.<Name>.address }}.
+// Starting at the signer's next nonce, every deploy and send takes one, as
+// does each library a deploy has to deploy first; calls take none.
+func (r *planRun) predict(ctx context.Context, steps []*planStep) error {
+	n, err := r.s.nonces.Peek(ctx, r.s.from)
+	if err != nil {
+		return err
+	}
+	r.predicted = map[string]common.Address{}
+	planned := map[string]bool{}
+	for _, st := range steps {
+		kind, ref, _ := st.kind()
+		switch kind {
+		case "call":
+			continue
+		case "send":
+			n++
+			continue
+		}
+		c, err := r.artifact(ref, true)
+		if err != nil {
+			return fmt.Errorf("step %s: %w", st.Name, err)
+		}
+		if err := r.predictLibraries(c, st.Libraries, planned, &n, 0); err != nil {
+			return fmt.Errorf("step %s: %w", st.Name, err)
+		}
+		address := crypto.CreateAddress(r.s.from, n)
+		n++
+		r.predicted[st.Name] = address
+		if _, ok := r.predicted[c.Name]; !ok {
+			r.predicted[c.Name] = address
+		}
+		r.s.ui.Verbosef("  %s predicted at %s (nonce %d)\n", st.Name, address.Hex(), n-1)
+	}
+	return nil
+}
+
+// predictLibraries counts the libraries deployLibraries will deploy for
+// c, at consecutive nonces from *n: those neither given in libs nor
+// recorded nor already planned for an earlier step.
+func (r *planRun) predictLibraries(c *Artifact, libs map[string]string, planned map[string]bool, n *uint64, depth int) error {
+	if depth > maxLinkDepth {
+		return fmt.Errorf("libraries of %s nested more than %d deep", c.Name, maxLinkDepth)
+	}
+	for _, lib := range c.Libraries {
+		if lib.Address != nil || planned[lib.Name] {
+			continue
+		}
+		if _, ok := libs[lib.Source+":"+lib.Name]; ok {
+			continue
+		}
+		if _, ok := libs[lib.Name]; ok {
+			continue
+		}
+		m, err := readManifest(manifestPath(r.dir, r.s.chainID, lib.Name))
+		if err != nil {
+			return err
+		}
+		if m.latest() != nil {
+			continue
+		}
+		l, err := loadArtifact(filepath.Join(r.ao.outDir, filepath.Base(lib.Source), lib.Name+".json"), lib.Name)
+		if err != nil {
+			return fmt.Errorf("library %s: %w", lib.Name, err)
+		}
+		if err := r.predictLibraries(l, nil, planned, n, depth+1); err != nil {
+			return err
+		}
+		planned[lib.Name] = true
+		if _, ok := r.predicted[lib.Name]; !ok {
+			r.predicted[lib.Name] = crypto.CreateAddress(r.s.from, *n)
+		}
+		*n++
+	}
+	return nil
+}
+
+// checkPredicted fails a deploy step that did not land where predict said
+// it would, since references to the prediction now point elsewhere.
+func (r *planRun) checkPredicted(st *planStep, address common.Address) error {
+	want, ok := r.predicted[st.Name]
+	if !ok || want == address {
+		return nil
+	}
+	return fmt.Errorf("%s is at %s, not at its predicted address %s: another transaction from %s took a nonce during the run, so every {{ predicted.%s.address }} points at the wrong address", st.Name, address.Hex(), want.Hex(), r.s.from.Hex(), st.Name)
+}
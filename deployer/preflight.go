@@ -0,0 +1,141 @@
+package deployer
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/console/prompt"
+)
+
+// preflightOptions select the checks run before a deployment is signed.
+type preflightOptions struct {
+	skipBalance bool
+	skipSize    bool
+	skipCode    bool
+	skipChain   bool
+	confirmed   bool
+}
+
+func (o *preflightOptions) register(fs *flag.FlagSet) {
+	fs.BoolVar(&o.skipBalance, "skip-balance-check", false, "do not check that the deployer can pay for the deployment")
+	fs.BoolVar(&o.skipSize, "skip-size-check", false, "do not check init and runtime code against the EIP-3860 and EIP-170 limits")
+	fs.BoolVar(&o.skipCode, "skip-code-check", false, "do not check that the deployment address is empty")
+	fs.BoolVar(&o.skipChain, "skip-chain-check", false, "do not stop when deploying to a mainnet with a key from the environment")
+	fs.BoolVar(&o.confirmed, "i-know-what-im-doing", false, "deploy to a mainnet with a key from the environment without asking")
+}
+
+// preflight checks a deployment of code, sent as msg, before anything is
+// signed: the chain, the code sizes, that nothing lives at address yet
+// (nil skips this), the gas limit (see setGasLimit) and that the deployer
+// can pay for it plus the value. Every failed check is reported in one
+// error.
+func (s *session) preflight(ctx context.Context, opts *bind.TransactOpts, msg ethereum.CallMsg, contractABI *abi.ABI, code, runtime []byte, address *common.Address) error {
+	p := s.preflightChecks
+	var problems []string
+	var class error // of the first problem that has one
+	failed := func(err error) {
+		problems = append(problems, err.Error())
+		if class == nil {
+			class = failureClass(err)
+		}
+	}
+	gasErr := s.setGasLimit(ctx, opts, msg, contractABI)
+	if gasErr != nil {
+		failed(gasErr)
+	}
+	if !p.skipChain {
+		if err := s.confirmChain(p.confirmed); err != nil {
+			failed(err)
+		}
+	}
+	if !p.skipSize {
+		if len(code) > maxInitCodeSize {
+			problems = append(problems, fmt.Sprintf("init code is %d bytes, over the EIP-3860 limit of %d", len(code), maxInitCodeSize))
+		}
+		if len(runtime) > maxCodeSize {
+			problems = append(problems, fmt.Sprintf("runtime code is %d bytes, over the EIP-170 limit of %d", len(runtime), maxCodeSize))
+		}
+	}
+	if !p.skipCode && address != nil {
+		existing, err := s.client.CodeAt(ctx, *address, nil)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("get code at %s: %v", address.Hex(), err))
+		case len(existing) > 0:
+			problems = append(problems, fmt.Sprintf("%s already has %d bytes of code", address.Hex(), len(existing)))
+		}
+	}
+	if !p.skipBalance && gasErr == nil {
+		if err := s.checkBalance(ctx, opts); err != nil {
+			failed(err)
+		}
+	}
+	if len(problems) > 0 {
+		err := fmt.Errorf("pre-flight checks failed:\n  - %s", strings.Join(problems, "\n  - "))
+		if class != nil {
+			err = classify(class, err)
+		}
+		return err
+	}
+	s.ui.Verbosef("Pre-flight checks passed\n")
+	return nil
+}
+
+// checkBalance fails when the deployer's balance is below the most the
+// transaction can cost: its gas limit at the maximum fee, plus its value
+// and L1 data fee.
+func (s *session) checkBalance(ctx context.Context, opts *bind.TransactOpts) error {
+	price := maxGasPrice(opts)
+	if price == nil {
+		return nil
+	}
+	need := new(big.Int).Mul(new(big.Int).SetUint64(opts.GasLimit), price)
+	if opts.Value != nil {
+		need.Add(need, opts.Value)
+	}
+	if s.pendingL1Fee != nil {
+		need.Add(need, s.pendingL1Fee)
+	}
+	bal, err := s.client.BalanceAt(ctx, s.from, nil)
+	if err != nil {
+		return fmt.Errorf("balance of %s: %w", s.from.Hex(), err)
+	}
+	if bal.Cmp(need) >= 0 {
+		return nil
+	}
+	return classify(ErrInsufficientFunds, fmt.Errorf("%s has %s ETH but the deployment can cost up to %s ETH; %s ETH short",
+		s.from.Hex(), formatEther(bal), formatEther(need), formatEther(new(big.Int).Sub(need, bal))))
+}
+
+// confirmChain stops a deployment to a mainnet signed with a key taken
+// straight from the environment, unless confirmed or the user agrees at a
+// prompt.
+func (s *session) confirmChain(confirmed bool) error {
+	if !chains[s.chainID.Uint64()].production || s.signer == nil || !s.signer.RawEnv {
+		return nil
+	}
+	name := chainName(s.chainID)
+	s.ui.Warnf("WARNING: deploying to %s (chain %s) with a raw key from %s\n", name, s.chainID, s.signer.Source)
+	if confirmed {
+		return nil
+	}
+	if !isTerminal(os.Stdin) {
+		return fmt.Errorf("refusing to deploy to %s with a key from %s; pass --i-know-what-im-doing, or use a keystore", name, s.signer.Source)
+	}
+	ok, err := prompt.Stdin.PromptConfirm(fmt.Sprintf("Really deploy to %s?", name))
+	if err != nil {
+		return fmt.Errorf("confirm: %w", err)
+	}
+	if !ok {
+		return classify(ErrUserAborted, fmt.Errorf("deployment to %s not confirmed", name))
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ethUSDFeeds are Chainlink's ETH/USD aggregators, by chain ID.
+var ethUSDFeeds = map[uint64]common.Address{
+	1:        common.HexToAddress("0x5f4eC3Df9cbd43714FE2740f5E3616155c5b8419"),
+	10:       common.HexToAddress("0x13e3Ee699D1909E989722E753853AE30b17e08c5"),
+	137:      common.HexToAddress("0xF9680D99D6C9589e2a93a78A04A279e509205945"),
+	8453:     common.HexToAddress("0x71041dddad3595F9CEd3DcCFBe3D1F4b0a16Bb70"),
+	42161:    common.HexToAddress("0x639Fe6ab55C921f74e7fac1ee960C0B6293ba612"),
+	11155111: common.HexToAddress("0x694AA1769357215DE4FAC081bf1f309aDC325306"),
+}
+
+// maxFeedAge is how old a feed's answer may be before it is flagged.
+const maxFeedAge = time.Hour
+
+const aggregatorABI = `[
+{"type":"function","name":"decimals","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint8"}]},
+{"type":"function","name":"latestRoundData","stateMutability":"view","inputs":[],"outputs":[{"name":"roundId","type":"uint80"},{"name":"answer","type":"int256"},{"name":"startedAt","type":"uint256"},{"name":"updatedAt","type":"uint256"},{"name":"answeredInRound","type":"uint80"}]}
+]`
+
+var parsedAggregator = func() abi.ABI {
+	a, err := abi.JSON(strings.NewReader(aggregatorABI))
+	if err != nil {
+		panic(err)
+	}
+	return a
+}()
+
+// priceOptions choose where the ETH price for USD costs comes from.
+type priceOptions struct {
+	feed   string
+	manual string
+}
+
+func (p *priceOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&p.feed, "price-feed", "", "Chainlink ETH/USD aggregator used to show costs in USD (default: the chain's known feed)")
+	fs.StringVar(&p.manual, "eth-price", "", "ETH price in USD for cost estimates, e.g. 3500, instead of reading a price feed")
+}
+
+// ethPrice is the ETH price, in USD, costs are converted with.
+type ethPrice struct {
+	read   bool
+	manual *big.Rat
+	feed   *common.Address
+	usd    *big.Rat
+}
+
+// newEthPrice checks the price flags.
+func newEthPrice(p priceOptions) (*ethPrice, error) {
+	e := &ethPrice{}
+	if p.manual != "" {
+		r, ok := new(big.Rat).SetString(p.manual)
+		if !ok || r.Sign() <= 0 {
+			return nil, fmt.Errorf("--eth-price: want a positive number, got %q", p.manual)
+		}
+		e.manual = r
+	}
+	if p.feed != "" {
+		a, err := parseAddress(p.feed)
+		if err != nil {
+			return nil, fmt.Errorf("--price-feed: %w", err)
+		}
+		e.feed = &a
+	}
+	return e, nil
+}
+
+// readPriceFeed reads the latest answer of the Chainlink aggregator at
+// feed, scaled by the aggregator's decimals, and warns if it is stale.
+func readPriceFeed(ctx context.Context, client *rpcClient, feed common.Address) (*big.Rat, error) {
+	bound := bind.NewBoundContract(feed, parsedAggregator, client, client, client)
+	var out []interface{}
+	if err := bound.Call(&bind.CallOpts{Context: ctx}, &out, "decimals"); err != nil {
+		return nil, fmt.Errorf("decimals: %w", err)
+	}
+	decimals := out[0].(uint8)
+	out = nil
+	if err := bound.Call(&bind.CallOpts{Context: ctx}, &out, "latestRoundData"); err != nil {
+		return nil, fmt.Errorf("latestRoundData: %w", err)
+	}
+	answer, updatedAt := out[1].(*big.Int), out[3].(*big.Int)
+	if answer.Sign() <= 0 {
+		return nil, errors.New("no positive answer")
+	}
+	if age := time.Since(time.Unix(updatedAt.Int64(), 0)); age > maxFeedAge {
+		client.ui.Warnf("warning: ETH/USD feed %s was last updated %s ago; USD costs may be off\n", feed.Hex(), age.Round(time.Minute))
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	return new(big.Rat).SetFrac(answer, scale), nil
+}
+
+// ethUSD returns the ETH price in USD: --eth-price, or else the answer
+// of --price-feed or the chain's known feed. It is nil, and USD costs are
+// left out, when there is no price; a feed that cannot be read is warned
+// about once.
+func (s *session) ethUSD(ctx context.Context) *big.Rat {
+	e := s.price
+	if e.read {
+		return e.usd
+	}
+	e.read = true
+	if e.manual != nil {
+		e.usd = e.manual
+		return e.usd
+	}
+	feed := e.feed
+	if feed == nil {
+		a, ok := ethUSDFeeds[s.chainID.Uint64()]
+		if !ok {
+			return nil
+		}
+		feed = &a
+	}
+	usd, err := readPriceFeed(ctx, s.client, *feed)
+	if err != nil {
+		s.ui.Warnf("warning: ETH/USD feed %s: %v; costs are shown without USD\n", feed.Hex(), err)
+		return nil
+	}
+	s.ui.Verbosef("ETH/USD: %s (feed %s)\n", usd.FloatString(2), feed.Hex())
+	e.usd = usd
+	return usd
+}
+
+// formatUSD converts wei to dollars at price, to the cent.
+func formatUSD(wei *big.Int, price *big.Rat) string {
+	r := new(big.Rat).SetFrac(wei, new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil))
+	return r.Mul(r, price).FloatString(2)
+}
@@ -0,0 +1,146 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// The EIP-1967 slots: keccak256 of the label, minus one.
+var (
+	implementationSlot = common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+	adminSlot          = common.HexToHash("0xb53127684a568b3173ae13b9f8a6016e243e63b6e8ee1178d6a717850b5d6103")
+	beaconSlot         = common.HexToHash("0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50")
+)
+
+// Selectors of implementation() on beacons and of the ERC-1822
+// proxiableUUID() UUPS implementations have.
+var (
+	implementationSelector = crypto.Keccak256([]byte("implementation()"))[:4]
+	proxiableUUIDSelector  = crypto.Keccak256([]byte("proxiableUUID()"))[:4]
+)
+
+// readProxy reads address's EIP-1967 slots at block (nil = latest) and
+// works out what kind of proxy it is. A beacon proxy's implementation is
+// the beacon's.
+func readProxy(ctx context.Context, client *rpcClient, address common.Address, block *big.Int) (*ProxyReport, error) {
+	r := &ProxyReport{Address: address, Kind: "none"}
+	for _, s := range []struct {
+		slot common.Hash
+		dst  **common.Address
+	}{{implementationSlot, &r.Implementation}, {adminSlot, &r.Admin}, {beaconSlot, &r.Beacon}} {
+		word, err := readSlot(ctx, client, address, s.slot, block)
+		if err != nil {
+			return nil, err
+		}
+		if addr, ok := wordAddress(word); ok {
+			*s.dst = &addr
+		}
+	}
+
+	switch {
+	case r.Beacon != nil:
+		r.Kind = "beacon"
+		ret, err := client.CallContract(ctx, ethereum.CallMsg{To: r.Beacon, Data: implementationSelector}, block)
+		if err != nil {
+			return nil, fmt.Errorf("beacon %s implementation(): %w", r.Beacon.Hex(), err)
+		}
+		if len(ret) < 32 {
+			return nil, fmt.Errorf("beacon %s implementation() returned %d bytes", r.Beacon.Hex(), len(ret))
+		}
+		impl := common.BytesToAddress(ret[12:32])
+		r.Implementation = &impl
+	case r.Implementation == nil:
+		return r, nil
+	case r.Admin != nil:
+		r.Kind = "transparent"
+	default:
+		r.Kind = "eip1967"
+		ret, err := client.CallContract(ctx, ethereum.CallMsg{To: r.Implementation, Data: proxiableUUIDSelector}, block)
+		if err == nil && common.BytesToHash(ret) == implementationSlot {
+			r.Kind = "uups"
+		}
+	}
+
+	code, err := client.CodeAt(ctx, *r.Implementation, block)
+	if err != nil {
+		return nil, fmt.Errorf("get code at %s: %w", r.Implementation.Hex(), err)
+	}
+	if len(code) > 0 {
+		hash := crypto.Keccak256Hash(code)
+		r.ImplementationCodeHash = &hash
+	}
+	return r, nil
+}
+
+// proxyKinds describes ProxyReport.Kind for humans.
+var proxyKinds = map[string]string{
+	"transparent": "transparent proxy (EIP-1967 implementation and admin slots set)",
+	"uups":        "UUPS proxy (implementation is ERC-1822 proxiable)",
+	"beacon":      "beacon proxy (EIP-1967 beacon slot set)",
+	"eip1967":     "EIP-1967 proxy (implementation slot set, no admin, not UUPS)",
+	"none":        "not an EIP-1967 proxy (all three slots empty)",
+}
+
+// runProxy implements `proxy info [flags] <address>`.
+func runProxy(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "info" {
+		return errors.New("usage: proxy info [flags] <address>")
+	}
+	fs := flag.NewFlagSet("proxy info", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	blockFlag := fs.String("block", "", "block number to read at (default latest)")
+	if err := parseFlags(fs, args[1:], &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: proxy info [flags] <address>")
+	}
+	address, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	block, err := parseBlock(*blockFlag)
+	if err != nil {
+		return err
+	}
+
+	client, _, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	r, err := readProxy(ctx, client, address, block)
+	if err != nil {
+		return err
+	}
+	ui.report.Proxy = r
+
+	ui.Resultf("%s: %s\n", address.Hex(), proxyKinds[r.Kind])
+	for _, s := range ui.report.Storage {
+		label := map[common.Hash]string{implementationSlot: "Implementation slot", adminSlot: "Admin slot", beaconSlot: "Beacon slot"}[s.Slot]
+		ui.Resultf("  %-20s %s\n", label+":", s.Value.Hex())
+	}
+	if r.Implementation != nil {
+		ui.Resultf("Implementation: %s\n", r.Implementation.Hex())
+		if r.ImplementationCodeHash != nil {
+			ui.Resultf("  code hash %s\n", r.ImplementationCodeHash.Hex())
+		} else {
+			ui.Warnf("warning: implementation %s has no code\n", r.Implementation.Hex())
+		}
+	}
+	if r.Admin != nil {
+		ui.Resultf("Admin:          %s\n", r.Admin.Hex())
+	}
+	if r.Beacon != nil {
+		ui.Resultf("Beacon:         %s\n", r.Beacon.Hex())
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// The proxies deploy --proxy puts in front of an implementation. They are
+// small hand-assembled contracts with the ABI, storage slots and events of
+// OpenZeppelin's ERC1967Proxy, TransparentUpgradeableProxy (v4 layout:
+// admin in the EIP-1967 admin slot) and ProxyAdmin, not their bytecode,
+// so explorers will not match them to OpenZeppelin's sources.
+//
+// ERC1967Proxy(implementation, data): requires code at implementation,
+// stores it in the implementation slot, emits Upgraded and delegatecalls
+// data unless it is empty. Every call is delegated.
+const erc1967ProxyCode = "" +
+	"6100de38036100de600039600051803b1561008457807f360894a13ba1a3210667c828492db98dca3e2076cc3735a920" +
+	"a3ca505d382bbc55807fbc7cd75a20ee27fd9adebab32041f755214dbc6bffa90cc0225b39da2e5c2d3b60006000a260" +
+	"20518051801561008a57600060008284602001865af461008a573d600060003e3d6000fd5b60006000fd5b6100446100" +
+	"9a6000396100446000f3366000600037600060003660007f360894a13ba1a3210667c828492db98dca3e2076cc3735a9" +
+	"20a3ca505d382bbc545af43d600060003e61003f573d6000fd5b3d6000f3"
+
+// TransparentUpgradeableProxy(logic, admin, data): as ERC1967Proxy, with
+// admin stored in the admin slot. The admin may only call
+// upgradeToAndCall(address,bytes); everyone else is delegated.
+const transparentProxyCode = "" +
+	"6101c738036101c76000396020517fb53127684a568b3173ae13b9f8a6016e243e63b6e8ee1178d6a717850b5d610355" +
+	"600051803b156100a957807f360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc55807fbc" +
+	"7cd75a20ee27fd9adebab32041f755214dbc6bffa90cc0225b39da2e5c2d3b60006000a2604051805180156100af5760" +
+	"0060008284602001865af46100af573d600060003e3d6000fd5b60006000fd5b6101086100bf6000396101086000f37f" +
+	"b53127684a568b3173ae13b9f8a6016e243e63b6e8ee1178d6a717850b5d610354331461006c57366000600037600060" +
+	"003660007f360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc545af43d600060003e6100" +
+	"67573d6000fd5b3d6000f35b60003560e01c634f1ef28614610083575b60006000fd5b600435803b1561007d57807f36" +
+	"0894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc55807fbc7cd75a20ee27fd9adebab32041" +
+	"f755214dbc6bffa90cc0225b39da2e5c2d3b60006000a260243560040180358015610106578082602001600037600060" +
+	"00826000865af4610106573d600060003e3d6000fd5b00"
+
+// ProxyAdmin(owner): owner in slot 0. owner() is public; the owner may
+// call upgradeAndCall(proxy, implementation, data), forwarded to the
+// proxy's upgradeToAndCall with the call's value, and transferOwnership.
+const proxyAdminCode = "" +
+	"6100b238036100b2600039600051600055610015565b61008d61002560003961008d6000f360003560e01c80638da5cb" +
+	"5b14610037576000543314156100315780639623609d1461004b578063f2fde38b14610043575b60006000fd5b600054" +
+	"60005260206000f35b600435600055005b634f1ef28660e01b6000526024360380602460043760206044350360245260" +
+	"006000826004016000346004355af13d600060003e610088573d6000fd5b3d6000f3"
+
+const upgradedEvent = `{"type":"event","name":"Upgraded","anonymous":false,"inputs":[{"name":"implementation","type":"address","indexed":true}]}`
+
+const erc1967ProxyABI = `[
+{"type":"constructor","stateMutability":"payable","inputs":[{"name":"implementation","type":"address"},{"name":"_data","type":"bytes"}]},
+` + upgradedEvent + `
+]`
+
+const transparentProxyABI = `[
+{"type":"constructor","stateMutability":"payable","inputs":[{"name":"_logic","type":"address"},{"name":"admin_","type":"address"},{"name":"_data","type":"bytes"}]},
+{"type":"function","name":"upgradeToAndCall","stateMutability":"payable","inputs":[{"name":"newImplementation","type":"address"},{"name":"data","type":"bytes"}],"outputs":[]},
+` + upgradedEvent + `
+]`
+
+const proxyAdminABI = `[
+{"type":"constructor","stateMutability":"nonpayable","inputs":[{"name":"initialOwner","type":"address"}]},
+{"type":"function","name":"owner","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"address"}]},
+{"type":"function","name":"transferOwnership","stateMutability":"nonpayable","inputs":[{"name":"newOwner","type":"address"}],"outputs":[]},
+{"type":"function","name":"upgradeAndCall","stateMutability":"payable","inputs":[{"name":"proxy","type":"address"},{"name":"implementation","type":"address"},{"name":"data","type":"bytes"}],"outputs":[]}
+]`
+
+// embeddedArtifact builds an Artifact for one of the contracts above.
+// Events and errors of impl, when given, are merged into its ABI so that
+// an initializer's events and reverts decode.
+func embeddedArtifact(name, abiJSON, code string, impl *Artifact) *Artifact {
+	a, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		panic(err)
+	}
+	if impl != nil {
+		mergeEvents(&a, &impl.ABI)
+	}
+	return &Artifact{Name: name, Path: "embedded:" + name, ABI: a, Bytecode: common.FromHex(code)}
+}
+
+// mergeEvents adds the events and errors of src that dst lacks, so that
+// logs and reverts coming from behind a proxy decode.
+func mergeEvents(dst, src *abi.ABI) {
+	for k, e := range src.Events {
+		if _, ok := dst.Events[k]; !ok {
+			dst.Events[k] = e
+		}
+	}
+	for k, e := range src.Errors {
+		if _, ok := dst.Errors[k]; !ok {
+			dst.Errors[k] = e
+		}
+	}
+}
+
+// proxyOptions are the deploy flags that put the contract behind a proxy.
+type proxyOptions struct {
+	kind        string
+	initializer string
+	initArgs    string
+	admin       string
+	ctorArgs    bool
+}
+
+func (o *proxyOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.kind, "proxy", "", "deploy behind a proxy: uups (ERC1967Proxy) or transparent (TransparentUpgradeableProxy with a ProxyAdmin)")
+	fs.StringVar(&o.initializer, "initializer", "", "function the proxy calls when deployed (default initialize if the contract has one; none to skip)")
+	fs.StringVar(&o.initArgs, "init-args", "", "initializer arguments as a JSON array")
+	fs.StringVar(&o.admin, "proxy-admin", "", "existing ProxyAdmin for --proxy transparent (default deploy one owned by the deployer)")
+	fs.BoolVar(&o.ctorArgs, "allow-constructor-args", false, "pass constructor arguments to a proxied implementation anyway, e.g. for immutables")
+}
+
+// initData checks the proxy flags against c and its constructor
+// arguments and encodes the initializer call, nil for none.
+func (o *proxyOptions) initData(c *Artifact, ctorArgs []interface{}) ([]byte, error) {
+	switch {
+	case o.kind != "uups" && o.kind != "transparent":
+		return nil, fmt.Errorf("--proxy: want uups or transparent, got %q", o.kind)
+	case o.admin != "" && o.kind != "transparent":
+		return nil, errors.New("--proxy-admin requires --proxy transparent")
+	case len(ctorArgs) > 0 && !o.ctorArgs:
+		return nil, fmt.Errorf("%s: constructor arguments given with --proxy, but the proxy never sees the constructor's state; pass them to the initializer with --init-args, or use --allow-constructor-args for immutables", c.Name)
+	}
+	if o.kind == "uups" {
+		if _, err := resolveMethod(&c.ABI, "upgradeToAndCall"); err != nil {
+			return nil, fmt.Errorf("--proxy uups: %s has no upgradeToAndCall(address,bytes), so the proxy could never be upgraded; inherit UUPSUpgradeable or use --proxy transparent", c.Name)
+		}
+	}
+
+	name := o.initializer
+	switch name {
+	case "none":
+		if o.initArgs != "" {
+			return nil, errors.New("--init-args given with --initializer none")
+		}
+		return nil, nil
+	case "":
+		name = "initialize"
+		if !hasMethod(&c.ABI, name) && o.initArgs == "" {
+			ui.Warnf("Warning: %s has no initialize function; the proxy is deployed uninitialized\n", c.Name)
+			return nil, nil
+		}
+	}
+	return encodeCall(&c.ABI, name, o.initArgs, "Initializer")
+}
+
+// encodeCall encodes a call of the function name with arguments from a
+// JSON array and prints it after label.
+func encodeCall(contractABI *abi.ABI, name, jsonArgs, label string) ([]byte, error) {
+	m, err := resolveMethod(contractABI, name)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := rawArgs(nil, jsonArgs)
+	if err != nil {
+		return nil, fmt.Errorf("%s arguments: %w", m.Sig, err)
+	}
+	args, err := convertArgs(m.Inputs, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", m.Sig, err)
+	}
+	packed, err := m.Inputs.Pack(args...)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s: %w", m.Sig, err)
+	}
+	ui.Printf("%s: %s(%s)\n", label, m.RawName, formatArgs(m.Inputs, args))
+	return append(m.ID, packed...), nil
+}
+
+// hasMethod reports whether contractABI has a function called name,
+// overloaded or not.
+func hasMethod(contractABI *abi.ABI, name string) bool {
+	for _, m := range contractABI.Methods {
+		if m.RawName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// deployProxy puts the implementation d just deployed from c behind a
+// new proxy that runs initData, and turns d into the proxied deployment:
+// its address and transaction become the proxy's and the implementation
+// moves to d.Proxy.
+func (s *session) deployProxy(ctx context.Context, c *Artifact, po proxyOptions, txo txOptions, initData []byte, d *Deployment) error {
+	impl := d.Address
+	rec := &ProxyRecord{Kind: po.kind, Implementation: impl, ImplementationTxHash: d.TxHash, InitData: formatValue(initData)}
+	report := &ProxyReport{Kind: po.kind, Implementation: &impl}
+
+	proxy := embeddedArtifact("ERC1967Proxy", erc1967ProxyABI, erc1967ProxyCode, c)
+	args := []interface{}{impl}
+	if po.kind == "transparent" {
+		admin, err := s.proxyAdmin(ctx, po, txo, report)
+		if err != nil {
+			return err
+		}
+		rec.Admin, report.Admin = &admin, &admin
+		proxy = embeddedArtifact("TransparentUpgradeableProxy", transparentProxyABI, transparentProxyCode, c)
+		args = append(args, admin)
+	}
+	args = append(args, initData)
+
+	address, rcpt, err := s.deploy(ctx, proxy, txo, args...)
+	if err != nil {
+		return fmt.Errorf("%s implementation deployed at %s, but its proxy failed: %w", c.Name, impl.Hex(), err)
+	}
+	report.Address = address
+	report.Deploy = newTxReport("constructor", rcpt, printEvents(s.ui, rcpt, &proxy.ABI))
+	s.ui.report.Proxy = report
+	s.ui.Printf("%s (%s proxy) at %s, implementation %s\n", c.Name, po.kind, address.Hex(), impl.Hex())
+	s.ui.link("address", address.Hex())
+
+	d.Address, d.TxHash, d.BlockNumber, d.Proxy = address, rcpt.TxHash, rcpt.BlockNumber.Uint64(), rec
+	return nil
+}
+
+// proxyAdmin returns --proxy-admin or deploys a ProxyAdmin owned by the
+// deployer.
+func (s *session) proxyAdmin(ctx context.Context, po proxyOptions, txo txOptions, report *ProxyReport) (common.Address, error) {
+	if po.admin != "" {
+		admin, err := parseAddress(po.admin)
+		if err != nil {
+			return common.Address{}, fmt.Errorf("--proxy-admin: %w", err)
+		}
+		code, err := s.client.CodeAt(ctx, admin, nil)
+		if err != nil {
+			return common.Address{}, fmt.Errorf("get code at %s: %w", admin.Hex(), err)
+		}
+		if len(code) == 0 {
+			s.ui.Warnf("Warning: --proxy-admin %s has no code; as admin it can upgrade the proxy but never call the contract through it\n", admin.Hex())
+		}
+		return admin, nil
+	}
+	pa := embeddedArtifact("ProxyAdmin", proxyAdminABI, proxyAdminCode, nil)
+	admin, rcpt, err := s.deploy(ctx, pa, txo, s.from)
+	if err != nil {
+		return common.Address{}, err
+	}
+	report.AdminDeploy = newTxReport("constructor", rcpt, nil)
+	s.ui.Printf("ProxyAdmin owned by %s\n", s.from.Hex())
+	return admin, nil
+}
@@ -0,0 +1,347 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ReceiptReport is a receipt as `receipt` shows it. Amounts are in wei;
+// L1 holds the l1* fields OP Stack nodes add, as decimal strings. Logs
+// are the raw logs and Events the same logs decoded, where an ABI knew
+// them.
+type ReceiptReport struct {
+	Hash              common.Hash       `json:"hash"`
+	Status            uint64            `json:"status"`
+	Reason            string            `json:"reason,omitempty"`
+	Block             uint64            `json:"block"`
+	BlockHash         common.Hash       `json:"blockHash"`
+	Timestamp         uint64            `json:"timestamp,omitempty"`
+	Index             uint              `json:"index"`
+	From              common.Address    `json:"from"`
+	To                *common.Address   `json:"to,omitempty"`
+	ContractAddress   *common.Address   `json:"contractAddress,omitempty"`
+	Value             string            `json:"value"`
+	Type              uint8             `json:"type"`
+	GasLimit          uint64            `json:"gasLimit"`
+	GasUsed           uint64            `json:"gasUsed"`
+	CumulativeGasUsed uint64            `json:"cumulativeGasUsed"`
+	EffectiveGasPrice string            `json:"effectiveGasPrice,omitempty"`
+	BlobGasUsed       uint64            `json:"blobGasUsed,omitempty"`
+	BlobGasPrice      string            `json:"blobGasPrice,omitempty"`
+	L1                map[string]string `json:"l1,omitempty"`
+	Fee               string            `json:"fee"`
+	Logs              []*types.Log      `json:"logs"`
+	Events            []decodedEvent    `json:"events"`
+}
+
+// l1ReceiptFields reads the l1* fields of a receipt's raw JSON (l1Fee,
+// l1GasUsed, l1GasPrice, l1BlobBaseFee and the scalars, depending on the
+// hardfork), which go-ethereum's receipt type drops.
+func l1ReceiptFields(raw json.RawMessage) map[string]string {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(raw, &fields) != nil {
+		return nil
+	}
+	out := map[string]string{}
+	for k, v := range fields {
+		if !strings.HasPrefix(k, "l1") {
+			continue
+		}
+		var q hexutil.Big
+		if json.Unmarshal(v, &q) == nil {
+			out[k] = q.ToInt().String()
+		} else if s := strings.Trim(string(v), `"`); s != "null" {
+			// Pre-Ecotone nodes give l1FeeScalar as a decimal string.
+			out[k] = s
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// receiptABIs are the ABIs `receipt` decodes with: primary (--abi, --sig,
+// --artifact or --contract) first, then ABIs fetched from the explorer
+// for each address, the artifacts under the out directory, and the
+// built-in ERC-20, ERC-721 and ERC-1155 ABIs.
+type receiptABIs struct {
+	primary  *abi.ABI
+	explorer map[common.Address]*abi.ABI
+	arts     []*Artifact
+}
+
+func (r *receiptABIs) candidates(address common.Address) []*abi.ABI {
+	var out []*abi.ABI
+	if r.primary != nil {
+		out = append(out, r.primary)
+	}
+	if a := r.explorer[address]; a != nil {
+		out = append(out, a)
+	}
+	for _, a := range r.arts {
+		out = append(out, &a.ABI)
+	}
+	return append(out, &parsedERC20, &parsedERC721, &parsedERC1155)
+}
+
+// decode matches l against each candidate ABI in turn, keeping it raw if
+// none knows it.
+func (r *receiptABIs) decode(l *types.Log) decodedEvent {
+	ev := decodeLog(l, nil)
+	for _, a := range r.candidates(l.Address) {
+		if d := decodeLog(l, a); d.Name != "" {
+			return d
+		}
+	}
+	return ev
+}
+
+// revertABI merges the custom errors of every candidate for address, so a
+// revert is decoded whichever contract in the call raised it.
+func (r *receiptABIs) revertABI(address *common.Address) *abi.ABI {
+	merged := &abi.ABI{Errors: map[string]abi.Error{}}
+	var to common.Address
+	if address != nil {
+		to = *address
+	}
+	for _, a := range r.candidates(to) {
+		for _, e := range a.Errors {
+			if _, ok := merged.Errors[e.Sig]; !ok {
+				merged.Errors[e.Sig] = e
+			}
+		}
+	}
+	return merged
+}
+
+// runReceipt implements `receipt [flags] <txhash>`: a transaction's
+// receipt with its revert reason, gas and fees, and decoded logs.
+func runReceipt(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("receipt", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	var abo abiOptions
+	o.register(fs)
+	ao.register(fs, "")
+	abo.register(fs)
+	wait := fs.Bool("wait", false, "poll until the transaction is mined instead of failing when it has no receipt yet")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: receipt [flags] <txhash>")
+	}
+	raw, err := hexutil.Decode(fs.Arg(0))
+	if err != nil || len(raw) != common.HashLength {
+		return fmt.Errorf("invalid transaction hash %q", fs.Arg(0))
+	}
+	hash := common.BytesToHash(raw)
+
+	abis := &receiptABIs{explorer: map[common.Address]*abi.ABI{}}
+	switch {
+	case abo.file != "" && len(abo.sigs) > 0:
+		return errors.New("pass --abi or --sig, not both")
+	case abo.file != "":
+		a, err := loadABI(abo.file, "")
+		if err != nil {
+			return err
+		}
+		abis.primary = &a.ABI
+	case len(abo.sigs) > 0:
+		a, err := fragmentArtifact("fragments", abo.sigs)
+		if err != nil {
+			return err
+		}
+		abis.primary = &a.ABI
+	case ao.path != "" || ao.contract != "":
+		path, contract, err := ao.resolve()
+		if err != nil {
+			return err
+		}
+		a, err := loadABI(path, contract)
+		if err != nil {
+			return err
+		}
+		abis.primary = &a.ABI
+	}
+	abis.arts = scanArtifacts(ao.outDir)
+	ui.Verbosef("Loaded %d artifacts from %s\n", len(abis.arts), ao.outDir)
+
+	client, chainID, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var rawReceipt json.RawMessage
+	if err := client.pins.do(ctx, &rawReceipt, "eth_getTransactionReceipt", hash); err != nil {
+		return fmt.Errorf("get receipt %s: %w", hash.Hex(), err)
+	}
+	if string(rawReceipt) == "null" || len(rawReceipt) == 0 {
+		if !*wait {
+			return fmt.Errorf("no receipt for %s yet: it is pending or unknown to the node (pass --wait to poll until it is mined)", hash.Hex())
+		}
+		ui.Printf("Waiting for %s to be mined\n", hash.Hex())
+		if _, err := WaitForReceipt(ctx, client, hash, WaitOptions{Interval: o.pollInterval, Timeout: o.waitTimeout}); err != nil {
+			return fmt.Errorf("wait for %s: %w", hash.Hex(), err)
+		}
+		if err := client.pins.do(ctx, &rawReceipt, "eth_getTransactionReceipt", hash); err != nil {
+			return fmt.Errorf("get receipt %s: %w", hash.Hex(), err)
+		}
+	}
+	var rcpt types.Receipt
+	if err := json.Unmarshal(rawReceipt, &rcpt); err != nil {
+		return fmt.Errorf("parse receipt %s: %w", hash.Hex(), err)
+	}
+	tx, _, err := client.TransactionByHash(ctx, hash)
+	if err != nil {
+		return fmt.Errorf("get transaction %s: %w", hash.Hex(), err)
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return fmt.Errorf("recover sender: %w", err)
+	}
+
+	r := &ReceiptReport{
+		Hash:              hash,
+		Status:            rcpt.Status,
+		Block:             rcpt.BlockNumber.Uint64(),
+		BlockHash:         rcpt.BlockHash,
+		Index:             rcpt.TransactionIndex,
+		From:              from,
+		To:                tx.To(),
+		Value:             tx.Value().String(),
+		Type:              tx.Type(),
+		GasLimit:          tx.Gas(),
+		GasUsed:           rcpt.GasUsed,
+		CumulativeGasUsed: rcpt.CumulativeGasUsed,
+		L1:                l1ReceiptFields(rawReceipt),
+		Logs:              rcpt.Logs,
+	}
+	if r.Logs == nil {
+		r.Logs = []*types.Log{}
+	}
+	if tx.To() == nil {
+		r.ContractAddress = &rcpt.ContractAddress
+	}
+	ui.report.Receipt = r
+	if h, err := client.HeaderByNumber(ctx, rcpt.BlockNumber); err == nil {
+		r.Timestamp = h.Time
+	}
+
+	if abo.fromExplorer {
+		addresses := map[common.Address]bool{}
+		if tx.To() != nil {
+			addresses[*tx.To()] = true
+		}
+		for _, l := range rcpt.Logs {
+			addresses[l.Address] = true
+		}
+		for address := range addresses {
+			a, err := explorerContract(ctx, abo, client, chainID, address)
+			if err != nil {
+				ui.Verbosef("  no explorer ABI for %s: %v\n", address.Hex(), err)
+				continue
+			}
+			abis.explorer[address] = &a.ABI
+		}
+	}
+
+	fee := new(big.Int)
+	if rcpt.EffectiveGasPrice != nil {
+		r.EffectiveGasPrice = rcpt.EffectiveGasPrice.String()
+		fee.Mul(rcpt.EffectiveGasPrice, new(big.Int).SetUint64(rcpt.GasUsed))
+	}
+	if rcpt.BlobGasPrice != nil {
+		r.BlobGasUsed, r.BlobGasPrice = rcpt.BlobGasUsed, rcpt.BlobGasPrice.String()
+		fee.Add(fee, new(big.Int).Mul(rcpt.BlobGasPrice, new(big.Int).SetUint64(rcpt.BlobGasUsed)))
+	}
+	var l1Fee *big.Int
+	if s, ok := r.L1["l1Fee"]; ok {
+		if l1Fee, ok = new(big.Int).SetString(s, 10); ok {
+			fee.Add(fee, l1Fee)
+		}
+	}
+	r.Fee = fee.String()
+	if rcpt.Status != types.ReceiptStatusSuccessful {
+		r.Reason = failureReason(ctx, client, tx, &rcpt, abis.revertABI(tx.To()))
+	}
+
+	status := "success"
+	if rcpt.Status != types.ReceiptStatusSuccessful {
+		status = "reverted: " + r.Reason
+	}
+	ui.Resultf("Tx:           %s\n", hash.Hex())
+	ui.Resultf("Status:       %s\n", status)
+	block := fmt.Sprintf("%d (index %d)", r.Block, r.Index)
+	if r.Timestamp > 0 {
+		block = fmt.Sprintf("%d, %s (index %d)", r.Block, time.Unix(int64(r.Timestamp), 0).UTC().Format(time.RFC3339), r.Index)
+	}
+	ui.Resultf("Block:        %s\n", block)
+	ui.Resultf("From:         %s\n", names.label(from))
+	switch {
+	case tx.To() != nil:
+		ui.Resultf("To:           %s\n", names.label(*tx.To()))
+	case rcpt.Status == types.ReceiptStatusSuccessful:
+		ui.Resultf("Created:      %s\n", rcpt.ContractAddress.Hex())
+	default:
+		ui.Resultf("Created:      none (the creation reverted; it would have been %s)\n", rcpt.ContractAddress.Hex())
+	}
+	if tx.Value().Sign() > 0 {
+		ui.Resultf("Value:        %s ETH\n", formatEther(tx.Value()))
+	}
+	ui.Resultf("Gas used:     %d of %d (%.1f%%), cumulative %d in the block\n", r.GasUsed, r.GasLimit, 100*float64(r.GasUsed)/float64(max(r.GasLimit, 1)), r.CumulativeGasUsed)
+	if rcpt.EffectiveGasPrice != nil {
+		ui.Resultf("Gas price:    %s gwei effective (type %d tx)\n", formatUnits(rcpt.EffectiveGasPrice, 9), r.Type)
+	}
+	if rcpt.BlobGasPrice != nil {
+		ui.Resultf("Blob gas:     %d at %s gwei\n", rcpt.BlobGasUsed, formatUnits(rcpt.BlobGasPrice, 9))
+	}
+	if len(r.L1) > 0 {
+		keys := make([]string, 0, len(r.L1))
+		for k := range r.L1 {
+			if k != "l1Fee" {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		var parts []string
+		for _, k := range keys {
+			parts = append(parts, k+" "+r.L1[k])
+		}
+		line := "unknown"
+		if l1Fee != nil {
+			line = formatEther(l1Fee) + " ETH"
+		}
+		if len(parts) > 0 {
+			line += " (" + strings.Join(parts, ", ") + ")"
+		}
+		ui.Resultf("L1 fee:       %s\n", line)
+	}
+	ui.Resultf("Fee:          %s ETH\n", formatEther(fee))
+
+	r.Events = make([]decodedEvent, len(rcpt.Logs))
+	if len(rcpt.Logs) == 0 {
+		ui.Resultln("Logs:         none")
+		return nil
+	}
+	ui.Resultf("Logs:         %d\n", len(rcpt.Logs))
+	for i, l := range rcpt.Logs {
+		r.Events[i] = abis.decode(l)
+		ui.Resultf("  [%d] %s %s\n", l.Index, names.label(l.Address), r.Events[i])
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// flashbotsRelays are Flashbots Protect's relays, which take private
+// transactions and bundles, by chain ID.
+var flashbotsRelays = map[uint64]string{
+	1:        "https://relay.flashbots.net",
+	11155111: "https://relay-sepolia.flashbots.net",
+	17000:    "https://relay-holesky.flashbots.net",
+}
+
+// privateTxBlocks is how many blocks a relay keeps trying to include a
+// private transaction before dropping it.
+const privateTxBlocks = 25
+
+// relayOptions select private submission through a relay instead of the
+// node's public mempool.
+type relayOptions struct {
+	private bool
+	url     string
+	key     string
+}
+
+func (ro *relayOptions) register(fs *flag.FlagSet) {
+	fs.BoolVar(&ro.private, "private-tx", false, "send transactions privately through --relay-url with eth_sendPrivateTransaction instead of the node's mempool; receipts are still read from --rpc")
+	fs.StringVar(&ro.url, "relay-url", "", "private transaction and bundle relay (default Flashbots Protect on mainnet, Sepolia and Holesky)")
+	fs.StringVar(&ro.key, "flashbots-key", "", "hex private key that signs relay requests (X-Flashbots-Signature) and builds reputation; never the signing key (default FLASHBOTS_KEY, else a fresh key per run)")
+}
+
+// dial resolves the relay for chainID and its request-signing key.
+func (ro relayOptions) dial(chainID *big.Int) (*relay, error) {
+	url := ro.url
+	if url == "" {
+		url = flashbotsRelays[chainID.Uint64()]
+	}
+	if url == "" {
+		return nil, fmt.Errorf("no default relay for %s; set --relay-url", chainName(chainID))
+	}
+	hexKey := ro.key
+	if hexKey == "" {
+		hexKey = os.Getenv("FLASHBOTS_KEY")
+	}
+	var key *ecdsa.PrivateKey
+	var err error
+	if hexKey == "" {
+		key, err = crypto.GenerateKey()
+		ui.Verbosef("no --flashbots-key or FLASHBOTS_KEY; signing relay requests with a fresh key\n")
+	} else {
+		key, err = parseHexKey([]byte(hexKey))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("--flashbots-key: %w", err)
+	}
+	return &relay{url: strings.TrimRight(url, "/"), key: key, http: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+// relay is a Flashbots-style JSON-RPC endpoint. Every request is signed
+// with key, which identifies the searcher but moves no funds.
+type relay struct {
+	url  string
+	key  *ecdsa.PrivateKey
+	http *http.Client
+}
+
+// address is the identity requests are signed as.
+func (r *relay) address() common.Address {
+	return crypto.PubkeyToAddress(r.key.PublicKey)
+}
+
+// signature is the X-Flashbots-Signature header for body: the address and
+// its personal_sign of the hex Keccak-256 of the body.
+func (r *relay) signature(body []byte) (string, error) {
+	digest := accounts.TextHash([]byte(crypto.Keccak256Hash(body).Hex()))
+	sig, err := crypto.Sign(digest, r.key)
+	if err != nil {
+		return "", err
+	}
+	return r.address().Hex() + ":" + hexutil.Encode(sig), nil
+}
+
+// call sends one signed JSON-RPC request and decodes its result into out.
+func (r *relay) call(ctx context.Context, out interface{}, method string, params ...interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	if err != nil {
+		return err
+	}
+	sig, err := r.signature(body)
+	if err != nil {
+		return fmt.Errorf("sign relay request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Flashbots-Signature", sig)
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("relay %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("relay %s: %w", method, err)
+	}
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &reply); err != nil {
+		return fmt.Errorf("relay %s: %s: %s", method, resp.Status, strings.TrimSpace(string(raw)))
+	}
+	if reply.Error != nil {
+		return fmt.Errorf("relay %s: %s", method, reply.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("relay %s: %s", method, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(reply.Result, out)
+}
+
+// sendPrivate submits tx with eth_sendPrivateTransaction, for inclusion
+// within privateTxBlocks of head.
+func (r *relay) sendPrivate(ctx context.Context, tx *types.Transaction, head uint64) error {
+	if tx.Type() == types.BlobTxType {
+		return errors.New("blob transactions cannot be sent privately; drop --private-tx")
+	}
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	req := map[string]interface{}{
+		"tx":             hexutil.Encode(raw),
+		"maxBlockNumber": hexutil.Uint64(head + privateTxBlocks),
+		"preferences":    map[string]bool{"fast": true},
+	}
+	return r.call(ctx, nil, "eth_sendPrivateTransaction", req)
+}
+
+// sendBundle submits txs, in order, with eth_sendBundle for block only,
+// and returns the bundle hash.
+func (r *relay) sendBundle(ctx context.Context, txs []*types.Transaction, block uint64) (string, error) {
+	raws := make([]string, len(txs))
+	for i, tx := range txs {
+		raw, err := tx.MarshalBinary()
+		if err != nil {
+			return "", err
+		}
+		raws[i] = hexutil.Encode(raw)
+	}
+	var out struct {
+		BundleHash string `json:"bundleHash"`
+	}
+	req := map[string]interface{}{"txs": raws, "blockNumber": hexutil.Uint64(block)}
+	if err := r.call(ctx, &out, "eth_sendBundle", req); err != nil {
+		return "", err
+	}
+	return out.BundleHash, nil
+}
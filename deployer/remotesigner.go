@@ -0,0 +1,194 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// remoteSignTimeout bounds one signing request. Clef waits for someone to
+// approve the transaction in its UI, so it is generous.
+const remoteSignTimeout = 5 * time.Minute
+
+// remoteSigner signs through an external signer's JSON-RPC API: Clef's
+// account_* methods, or the eth_* ones Web3Signer serves. The key never
+// enters this process.
+type remoteSigner struct {
+	url    string
+	client *rpc.Client
+	clef   bool // Clef's API rather than Web3Signer's
+}
+
+// dialRemoteSigner connects to the signer at url and picks the account to
+// sign as: from, which the signer must hold, or its only account.
+func dialRemoteSigner(url, from string) (*Signer, error) {
+	if url == "" {
+		return nil, errors.New("--signer remote needs --signer-url")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("remote signer %s: %w", url, err)
+	}
+	r := &remoteSigner{url: url, client: client, clef: true}
+	var accounts []common.Address
+	err = client.CallContext(ctx, &accounts, "account_list")
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == methodNotFound {
+		r.clef = false
+		err = client.CallContext(ctx, &accounts, "eth_accounts")
+	}
+	if err != nil {
+		client.Close()
+		return nil, r.error("list accounts", err)
+	}
+
+	var address common.Address
+	switch {
+	case from != "":
+		if address, err = parseAddress(from); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("--signer-from: %w", err)
+		}
+		found := false
+		for _, a := range accounts {
+			found = found || a == address
+		}
+		if !found {
+			client.Close()
+			return nil, fmt.Errorf("remote signer %s holds no key for %s", url, address.Hex())
+		}
+	case len(accounts) == 1:
+		address = accounts[0]
+	case len(accounts) == 0:
+		client.Close()
+		return nil, fmt.Errorf("remote signer %s has no accounts", url)
+	default:
+		client.Close()
+		return nil, fmt.Errorf("remote signer %s holds %d accounts; pick one with --signer-from", url, len(accounts))
+	}
+	kind := "web3signer"
+	if r.clef {
+		kind = "clef"
+	}
+	return &Signer{Address: address, Source: fmt.Sprintf("remote signer %s (%s)", url, kind), remote: r}, nil
+}
+
+// error classifies err from the signer: an unreachable signer, one that
+// said no (a Clef user denying the request, say), or any other failure.
+func (r *remoteSigner) error(what string, err error) error {
+	var rpcErr rpc.Error
+	var httpErr rpc.HTTPError
+	switch {
+	case errors.As(err, &rpcErr):
+		msg := err.Error()
+		if strings.Contains(strings.ToLower(msg), "denied") || strings.Contains(strings.ToLower(msg), "rejected") {
+			return fmt.Errorf("remote signer %s denied the request to %s: %s", r.url, what, msg)
+		}
+		return fmt.Errorf("remote signer %s refused to %s: %s", r.url, what, msg)
+	case errors.As(err, &httpErr):
+		return fmt.Errorf("remote signer %s: %s: HTTP %d %s", r.url, what, httpErr.StatusCode, httpErr.Status)
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("remote signer %s: %s: no answer within %s", r.url, what, remoteSignTimeout)
+	}
+	return fmt.Errorf("cannot reach remote signer %s to %s: %w", r.url, what, err)
+}
+
+// txArgs is tx in the form account_signTransaction and
+// eth_signTransaction take.
+func txArgs(from common.Address, tx *types.Transaction, chainID *big.Int) map[string]interface{} {
+	args := map[string]interface{}{
+		"from":    from,
+		"gas":     hexutil.Uint64(tx.Gas()),
+		"value":   (*hexutil.Big)(tx.Value()),
+		"nonce":   hexutil.Uint64(tx.Nonce()),
+		"data":    hexutil.Bytes(tx.Data()),
+		"chainId": (*hexutil.Big)(chainID),
+	}
+	if tx.To() != nil {
+		args["to"] = tx.To()
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		args["maxFeePerGas"] = (*hexutil.Big)(tx.GasFeeCap())
+		args["maxPriorityFeePerGas"] = (*hexutil.Big)(tx.GasTipCap())
+	} else {
+		args["gasPrice"] = (*hexutil.Big)(tx.GasPrice())
+	}
+	if tx.Type() != types.LegacyTxType {
+		args["accessList"] = tx.AccessList()
+	}
+	return args
+}
+
+// signTx has the signer sign tx as from for chainID and checks what comes
+// back is that transaction, signed by from for chainID: its signing hash
+// covers every field, so a signer that changed any of them is caught.
+func (r *remoteSigner) signTx(from common.Address, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), remoteSignTimeout)
+	defer cancel()
+	method := "eth_signTransaction"
+	if r.clef {
+		method = "account_signTransaction"
+	}
+	var res json.RawMessage
+	if err := r.client.CallContext(ctx, &res, method, txArgs(from, tx, chainID)); err != nil {
+		return nil, r.error("sign the transaction", err)
+	}
+	// Clef and geth answer {raw, tx}; Web3Signer the raw transaction.
+	var raw hexutil.Bytes
+	if err := json.Unmarshal(res, &raw); err != nil {
+		var wrapped struct {
+			Raw hexutil.Bytes `json:"raw"`
+		}
+		if err := json.Unmarshal(res, &wrapped); err != nil || len(wrapped.Raw) == 0 {
+			return nil, fmt.Errorf("remote signer %s: unexpected %s result %s", r.url, method, res)
+		}
+		raw = wrapped.Raw
+	}
+	signed := new(types.Transaction)
+	if err := signed.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("remote signer %s: decode signed transaction: %w", r.url, err)
+	}
+	if id := signed.ChainId(); signed.Protected() && id.Cmp(chainID) != 0 {
+		return nil, classify(ErrChainMismatch, fmt.Errorf("remote signer %s signed for chain %s, but the node is on chain %s; check the signer's --chainid", r.url, id, chainID))
+	}
+	signer := types.LatestSignerForChainID(chainID)
+	sender, err := types.Sender(signer, signed)
+	if err != nil {
+		return nil, fmt.Errorf("remote signer %s: signed transaction: %w", r.url, err)
+	}
+	if sender != from {
+		return nil, fmt.Errorf("remote signer %s signed as %s, not %s", r.url, sender.Hex(), from.Hex())
+	}
+	if signer.Hash(signed) != signer.Hash(tx) {
+		return nil, fmt.Errorf("remote signer %s changed the transaction before signing it", r.url)
+	}
+	return signed, nil
+}
+
+// transactOpts are transact opts for from whose Signer is a round trip to
+// the remote signer, so the deploy and send paths work as with a local
+// key.
+func (r *remoteSigner) transactOpts(from common.Address, chainID *big.Int) *bind.TransactOpts {
+	return &bind.TransactOpts{
+		From: from,
+		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if address != from {
+				return nil, bind.ErrNotAuthorized
+			}
+			return r.signTx(from, tx, chainID)
+		},
+		Context: context.Background(),
+	}
+}
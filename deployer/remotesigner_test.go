@@ -0,0 +1,160 @@
+package deployer
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// remoteTx is the transaction the stub signers are asked to sign, and
+// remoteTxArgs the request body both APIs must receive for it.
+var remoteTx = types.NewTx(&types.DynamicFeeTx{
+	ChainID: big.NewInt(1337), Nonce: 3, To: &relayerAddr, Value: big.NewInt(1), Gas: 21000,
+	GasTipCap: big.NewInt(1e9), GasFeeCap: big.NewInt(2e9), Data: []byte{0x12, 0x34},
+})
+
+const remoteTxArgs = `{
+	"from": "0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266",
+	"to": "0x70997970c51812dc3a010c7d01b50e0d17dc79c8",
+	"gas": "0x5208", "value": "0x1", "nonce": "0x3", "data": "0x1234", "chainId": "0x539",
+	"maxFeePerGas": "0x77359400", "maxPriorityFeePerGas": "0x3b9aca00", "accessList": []
+}`
+
+// signedBy is remoteTx, changed by edits, signed with key for chainID, as
+// the stub signers return it.
+func signedBy(t *testing.T, key string, chainID int64, edits ...func(*types.DynamicFeeTx)) hexutil.Bytes {
+	t.Helper()
+	k, err := crypto.HexToECDSA(key[2:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := &types.DynamicFeeTx{
+		ChainID: big.NewInt(chainID), Nonce: remoteTx.Nonce(), To: remoteTx.To(), Value: remoteTx.Value(), Gas: remoteTx.Gas(),
+		GasTipCap: remoteTx.GasTipCap(), GasFeeCap: remoteTx.GasFeeCap(), Data: remoteTx.Data(),
+	}
+	for _, edit := range edits {
+		edit(inner)
+	}
+	tx, err := types.SignNewTx(k, types.LatestSignerForChainID(big.NewInt(chainID)), inner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// stubSigner serves testAddr's account the way Clef does, or Web3Signer,
+// answering every signing request with raw, or with err, and recording
+// the request.
+func stubSigner(t *testing.T, clef bool, raw hexutil.Bytes, err error) (*fakeNode, *json.RawMessage) {
+	t.Helper()
+	var req json.RawMessage
+	list, sign := "eth_accounts", "eth_signTransaction"
+	if clef {
+		list, sign = "account_list", "account_signTransaction"
+	}
+	node := newFakeNode(t, map[string]func([]json.RawMessage) (interface{}, error){
+		list: func([]json.RawMessage) (interface{}, error) { return []common.Address{testAddr}, nil },
+		sign: func(params []json.RawMessage) (interface{}, error) {
+			req = params[0]
+			if err != nil {
+				return nil, err
+			}
+			if clef {
+				return map[string]interface{}{"raw": raw, "tx": map[string]string{}}, nil
+			}
+			return raw, nil
+		},
+	})
+	return node, &req
+}
+
+// TestRemoteSigner signs remoteTx through stub Clef and Web3Signer
+// endpoints that return a fixed signature by testKey.
+func TestRemoteSigner(t *testing.T) {
+	var want interface{}
+	if err := json.Unmarshal([]byte(remoteTxArgs), &want); err != nil {
+		t.Fatal(err)
+	}
+	fixed := signedBy(t, testKey, 1337)
+	for _, clef := range []bool{true, false} {
+		node, req := stubSigner(t, clef, fixed, nil)
+		s, err := dialRemoteSigner(node.url, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Address != testAddr || (clef != strings.HasSuffix(s.Source, "(clef)")) {
+			t.Fatalf("clef %v: signer %s from %s", clef, s.Address.Hex(), s.Source)
+		}
+		opts, err := s.TransactOpts(big.NewInt(1337))
+		if err != nil {
+			t.Fatal(err)
+		}
+		signed, err := opts.Signer(testAddr, remoteTx)
+		if err != nil {
+			t.Fatalf("clef %v: %v", clef, err)
+		}
+
+		var got interface{}
+		if err := json.Unmarshal(*req, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("clef %v: request %s, want %s", clef, *req, remoteTxArgs)
+		}
+		sender, err := types.Sender(types.LatestSignerForChainID(big.NewInt(1337)), signed)
+		if err != nil || sender != testAddr {
+			t.Fatalf("clef %v: recovered sender %s, %v; want %s", clef, sender.Hex(), err, testAddr.Hex())
+		}
+		if raw, _ := signed.MarshalBinary(); !reflect.DeepEqual(hexutil.Bytes(raw), fixed) {
+			t.Fatalf("clef %v: signed %x, want the signer's %x", clef, raw, fixed)
+		}
+	}
+}
+
+func TestRemoteSignerErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		raw  hexutil.Bytes
+		err  error
+		want string
+	}{
+		{"denied", nil, errors.New("Request denied"), "denied the request to sign the transaction: Request denied"},
+		{"refused", nil, errors.New("insufficient funds"), "refused to sign the transaction: insufficient funds"},
+		{"other chain", signedBy(t, testKey, 1), nil, "signed for chain 1, but the node is on chain 1337"},
+		{"other key", signedBy(t, relayerKey, 1337), nil, "signed as " + relayerAddr.Hex() + ", not " + testAddr.Hex()},
+		{"other recipient", signedBy(t, testKey, 1337, func(tx *types.DynamicFeeTx) { tx.To = &testAddr }), nil, "changed the transaction before signing it"},
+		{"other data", signedBy(t, testKey, 1337, func(tx *types.DynamicFeeTx) { tx.Data = []byte{0xde, 0xad} }), nil, "changed the transaction before signing it"},
+		{"other fee cap", signedBy(t, testKey, 1337, func(tx *types.DynamicFeeTx) { tx.GasFeeCap = big.NewInt(200e9) }), nil, "changed the transaction before signing it"},
+		{"access list added", signedBy(t, testKey, 1337, func(tx *types.DynamicFeeTx) {
+			tx.AccessList = types.AccessList{{Address: testAddr}}
+		}), nil, "changed the transaction before signing it"},
+	} {
+		node, _ := stubSigner(t, true, tt.raw, tt.err)
+		s, err := dialRemoteSigner(node.url, testAddr.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts, err := s.TransactOpts(big.NewInt(1337))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := opts.Signer(testAddr, remoteTx); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	if _, err := dialRemoteSigner(downURL, ""); err == nil || !strings.Contains(err.Error(), "cannot reach remote signer") {
+		t.Errorf("unreachable signer: %v", err)
+	}
+}
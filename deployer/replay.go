@@ -0,0 +1,343 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os/exec"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// replayTracer is callTracer with the logs each frame emitted, so a
+// debug_traceCall replay can show events too.
+var replayTracer = map[string]interface{}{"tracer": "callTracer", "tracerConfig": map[string]interface{}{"withLog": true}}
+
+// replayTarget is the transaction being replayed, with any overrides
+// applied: from sends data and value to to (nil for a creation) on the
+// state after block. gas is the original limit, or 0 for the node to
+// estimate when the calldata is overridden.
+type replayTarget struct {
+	from  common.Address
+	to    *common.Address
+	data  []byte
+	value *big.Int
+	gas   uint64
+	block uint64
+}
+
+// request is the target as eth_sendTransaction and debug_traceCall take it.
+func (t *replayTarget) request() map[string]interface{} {
+	req := map[string]interface{}{
+		"from":  t.from,
+		"input": hexutil.Bytes(t.data),
+		"value": (*hexutil.Big)(t.value),
+	}
+	if t.gas > 0 {
+		req["gas"] = hexutil.Uint64(t.gas)
+	}
+	if t.to != nil {
+		req["to"] = t.to
+	}
+	return req
+}
+
+func (t *replayTarget) callMsg() ethereum.CallMsg {
+	return ethereum.CallMsg{From: t.from, To: t.to, Data: t.data, Value: t.value, Gas: t.gas}
+}
+
+// replayEvents decodes logs with contractABI, trying every artifact for a
+// log it does not know.
+func replayEvents(logs []*types.Log, contractABI *abi.ABI, arts []*Artifact) []decodedEvent {
+	events := make([]decodedEvent, len(logs))
+	for i, l := range logs {
+		events[i] = decodeLog(l, contractABI)
+		for _, a := range arts {
+			if events[i].Name != "" {
+				break
+			}
+			events[i] = decodeLog(l, &a.ABI)
+		}
+	}
+	return events
+}
+
+// replayOnFork forks the chain at t.block with Anvil, sends t as the
+// impersonated sender and fills in r from the receipt. With trace it also
+// returns the replay's callTracer output. The fork is stopped when done.
+func replayOnFork(ctx context.Context, o *options, ao anvilOptions, t *replayTarget, r *ReplayReport, contractABI *abi.ABI, arts []*Artifact, trace bool) (json.RawMessage, error) {
+	node, err := startAnvil(ctx, ao)
+	if err != nil {
+		return nil, err
+	}
+	fork, err := dial(ctx, o.env, []string{node.url}, o.retry, o.rpcTimeout, o.batch, nil)
+	if err != nil {
+		node.stop()
+		return nil, err
+	}
+	fork.cleanup = node.stop
+	defer fork.Close()
+	if fork.chainID, err = fork.ChainID(ctx); err != nil {
+		return nil, fmt.Errorf("fork chain id: %w", err)
+	}
+
+	if err := anvilCall(ctx, fork, nil, "anvil_impersonateAccount", t.from); err != nil {
+		return nil, err
+	}
+	var hash common.Hash
+	if err := anvilCall(ctx, fork, &hash, "eth_sendTransaction", t.request()); err != nil {
+		// Turned down before mining, e.g. for funds or by the estimate:
+		// there is no receipt, only the reason.
+		r.Status, r.Reason = "rejected", explainError(err, contractABI).Error()
+		return nil, nil
+	}
+	rcpt, err := WaitForReceipt(ctx, fork, hash, WaitOptions{Interval: o.pollInterval, Timeout: o.waitTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("replay %s: %w", hash.Hex(), err)
+	}
+	r.GasUsed = rcpt.GasUsed
+	r.Status = "success"
+	if rcpt.Status != types.ReceiptStatusSuccessful {
+		// The failed replay left the fork's state as it was, so the same
+		// call on top of it shows why.
+		r.Status = "reverted"
+		r.Reason, _ = callReason(ctx, fork, t.callMsg(), rcpt.BlockNumber, contractABI)
+	}
+	r.Events = replayEvents(rcpt.Logs, contractABI, arts)
+	if !trace {
+		return nil, nil
+	}
+	return traceRPC(ctx, fork, "debug_traceTransaction", hash, callTracer)
+}
+
+// replayTraceCall runs t with debug_traceCall on client at t.block instead:
+// no fork is needed, only a node with the debug API and the block's state.
+// It returns the tracer's output.
+func replayTraceCall(ctx context.Context, client *rpcClient, t *replayTarget, r *ReplayReport, contractABI *abi.ABI, arts []*Artifact) (json.RawMessage, error) {
+	raw, err := traceRPC(ctx, client, "debug_traceCall", t.request(), hexutil.EncodeUint64(t.block), replayTracer)
+	if err != nil {
+		return nil, err
+	}
+	var root callFrame
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return nil, fmt.Errorf("trace: not callTracer output: %w", err)
+	}
+	r.GasUsed = uint64(root.GasUsed)
+	r.Status = "success"
+	if root.Error != "" {
+		r.Status, r.Reason = "reverted", root.RevertReason
+		if r.Reason == "" && len(root.Output) > 0 {
+			r.Reason = decodeRevert(root.Output, contractABI)
+		}
+		if r.Reason == "" {
+			r.Reason = root.Error
+		}
+	}
+	logs := root.logs()
+	for i, l := range logs {
+		l.Index = uint(i)
+	}
+	r.Events = replayEvents(logs, contractABI, arts)
+	return raw, nil
+}
+
+// runReplay implements `replay [flags] <txhash>`: run a mined transaction
+// again on the state before its block, optionally with other calldata or
+// value, and compare the outcome with the original.
+func runReplay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	var to traceOptions
+	var do decodeOptions
+	o.register(fs)
+	ao.register(fs, "")
+	to.register(fs)
+	do.register(fs)
+	showTrace := fs.Bool("trace", false, "also print the replay's call trace")
+	traceCall := fs.Bool("trace-call", false, "replay with debug_traceCall on --fork-url (or --rpc) instead of on an Anvil fork")
+	inputFlag := fs.String("override-input", "", "replay with this calldata (0x...) instead of the original")
+	valueFlag := fs.String("override-value", "", "replay sending this much ether instead of the original value, e.g. 0.1ether")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: replay [flags] <txhash>")
+	}
+	if o.anvil.auto {
+		return errors.New("replay starts its own fork; point --rpc at the chain the transaction is on")
+	}
+	rawHash, err := hexutil.Decode(fs.Arg(0))
+	if err != nil || len(rawHash) != common.HashLength {
+		return fmt.Errorf("invalid transaction hash %q", fs.Arg(0))
+	}
+	hash := common.BytesToHash(rawHash)
+	var input []byte
+	if *inputFlag != "" {
+		if input, err = hexutil.Decode(*inputFlag); err != nil {
+			return fmt.Errorf("--override-input: %w", err)
+		}
+	}
+	value, err := parseValue(*valueFlag)
+	if err != nil {
+		return fmt.Errorf("--override-value: %w", err)
+	}
+
+	var arts []*Artifact
+	var c *Artifact
+	if ao.path != "" || ao.contract != "" {
+		path, contract, err := ao.resolve()
+		if err != nil {
+			return err
+		}
+		if c, err = loadABI(path, contract); err != nil {
+			return err
+		}
+		arts = append(arts, c)
+	}
+	arts = append(arts, scanArtifacts(ao.outDir)...)
+	sigs, err := do.open()
+	if err != nil {
+		return err
+	}
+	defer sigs.save()
+
+	client, chainID, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	tx, pending, err := client.TransactionByHash(ctx, hash)
+	if err != nil {
+		return fmt.Errorf("get tx %s: %w", hash.Hex(), err)
+	}
+	if pending {
+		return fmt.Errorf("tx %s is not mined yet", hash.Hex())
+	}
+	rcpt, err := client.TransactionReceipt(ctx, hash)
+	if err != nil {
+		return fmt.Errorf("get receipt of %s: %w", hash.Hex(), err)
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(chainID), tx)
+	if err != nil {
+		return fmt.Errorf("sender of %s: %w", hash.Hex(), err)
+	}
+	block := rcpt.BlockNumber.Uint64()
+	if block == 0 {
+		return errors.New("cannot replay a genesis transaction")
+	}
+	t := &replayTarget{from: from, to: tx.To(), data: tx.Data(), value: tx.Value(), gas: tx.Gas(), block: block - 1}
+	r := &ReplayReport{
+		Hash: hash, From: from, To: tx.To(), Block: block,
+		OriginalStatus: rcpt.Status, OriginalGasUsed: rcpt.GasUsed,
+	}
+	if input != nil {
+		t.data, t.gas, r.OverrideInput = input, 0, hexutil.Encode(input)
+	}
+	if value != nil {
+		t.value, r.OverrideValue = value, value.String()
+	}
+
+	// The ABI the transaction's target was called through decodes its
+	// revert first.
+	var contractABI *abi.ABI
+	d := decodeLocal(arts, t.data)
+	for _, a := range arts {
+		if d != nil && a.Name == d.contract {
+			contractABI = &a.ABI
+			break
+		}
+	}
+	if contractABI == nil && c != nil {
+		contractABI = &c.ABI
+	}
+	target := "contract creation"
+	if t.to != nil {
+		target = t.to.Hex()
+	}
+	ui.Resultf("Transaction %s: %s -> %s, block %d\n", hash.Hex(), from.Hex(), target, block)
+	switch {
+	case d != nil && d.ctor:
+		ui.Resultf("  call:     new %s(%s)\n", d.contract, formatArgs(d.method.Inputs, d.args))
+	case d != nil:
+		ui.Resultf("  call:     %s.%s(%s)\n", d.contract, d.method.RawName, formatArgs(d.method.Inputs, d.args))
+	}
+	if input != nil {
+		ui.Resultf("  input:    overridden (%d bytes)\n", len(input))
+	}
+	if value != nil {
+		ui.Resultf("  value:    %s ETH (overridden; originally %s ETH)\n", formatEther(value), formatEther(tx.Value()))
+	}
+	original := "success"
+	if rcpt.Status != types.ReceiptStatusSuccessful {
+		original = "reverted"
+	}
+	ui.Resultf("  original: %s, gas used %d\n", original, rcpt.GasUsed)
+
+	var trace json.RawMessage
+	forkURL := o.anvil.forkURL
+	if forkURL == "" {
+		e, err := client.pin(ctx)
+		if err != nil {
+			return err
+		}
+		forkURL = e.url
+	}
+	if !*traceCall {
+		if _, err := exec.LookPath("anvil"); err != nil {
+			ui.Warnf("anvil not found on PATH; replaying with debug_traceCall instead\n")
+			*traceCall = true
+		}
+	}
+	if !*traceCall {
+		r.Mode = "fork"
+		ui.Printf("Forking %s at block %d\n", redactURL(forkURL), t.block)
+		trace, err = replayOnFork(ctx, &o, anvilOptions{auto: true, forkURL: forkURL, logFile: o.anvil.logFile, forkBlock: t.block}, t, r, contractABI, arts, *showTrace)
+	} else {
+		r.Mode = "trace-call"
+		node := client
+		if o.anvil.forkURL != "" {
+			if node, err = dial(ctx, o.env, []string{o.anvil.forkURL}, o.retry, o.rpcTimeout, o.batch, o.headers()); err != nil {
+				return err
+			}
+			defer node.Close()
+			if node.chainID, err = node.ChainID(ctx); err != nil {
+				return fmt.Errorf("--fork-url chain id: %w", err)
+			}
+			if node.chainID.Cmp(chainID) != 0 {
+				return classify(ErrChainMismatch, fmt.Errorf("--fork-url is on chain %s, the transaction on %s", node.chainID, chainID))
+			}
+		}
+		ui.Printf("Tracing the call on block %d state\n", t.block)
+		trace, err = replayTraceCall(ctx, node, t, r, contractABI, arts)
+	}
+	if err != nil {
+		return err
+	}
+	ui.report.Replay = r
+
+	outcome := r.Status
+	if r.Reason != "" {
+		outcome += ": " + r.Reason
+	}
+	ui.Resultf("Replay:   %s\n", outcome)
+	if r.Status != "rejected" {
+		diff := int64(r.GasUsed) - int64(rcpt.GasUsed)
+		ui.Resultf("Gas used: %d (original %d, %+d)\n", r.GasUsed, rcpt.GasUsed, diff)
+	}
+	for _, e := range r.Events {
+		ui.Resultln("  event", e)
+	}
+	if *showTrace {
+		ui.Resultln("Trace:")
+		return printTrace(ctx, trace, to, arts, sigs)
+	}
+	return nil
+}
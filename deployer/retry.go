@@ -0,0 +1,94 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// maxRetryDelay caps the exponential backoff between attempts.
+const maxRetryDelay = 30 * time.Second
+
+// retryPolicy controls how transient RPC failures are retried.
+type retryPolicy struct {
+	attempts int
+	delay    time.Duration
+}
+
+func (p *retryPolicy) register(fs *flag.FlagSet) {
+	fs.IntVar(&p.attempts, "retries", 5, "attempts per read-only RPC call on transient errors (1 disables retrying)")
+	fs.DurationVar(&p.delay, "retry-delay", 500*time.Millisecond, "initial backoff between retries; doubles each attempt")
+}
+
+// backoff is the wait before retry number n (1-based): delay doubled n-1
+// times, capped, plus up to 50% jitter.
+func (p retryPolicy) backoff(n int) time.Duration {
+	d := p.delay
+	for i := 1; i < n && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	d = min(d, maxRetryDelay)
+	if d > 0 {
+		d += rand.N(d/2 + 1)
+	}
+	return d
+}
+
+// errStalled marks a request that hit the per-request --rpc-timeout.
+var errStalled = errors.New("no answer in time")
+
+// transient reports whether err looks like a temporary node or network
+// problem rather than an answer.
+func transient(err error) bool {
+	if errors.Is(err, errStalled) {
+		return true
+	}
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == 429 || httpErr.StatusCode >= 500
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		// -32005 is the de facto "limit exceeded" code used by hosted providers
+		return rpcErr.ErrorCode() == -32005 || rpcErr.ErrorCode() == 429
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// retry calls f until it succeeds, fails permanently, ctx ends or the
+// attempts are used up, warning through l before each retry.
+func retry[T any](ctx context.Context, l *logger, p retryPolicy, what string, f func() (T, error)) (T, error) {
+	for n := 1; ; n++ {
+		v, err := f()
+		if err == nil || !transient(err) {
+			return v, err
+		}
+		if n >= p.attempts {
+			return v, classify(ErrRPCUnavailable, err)
+		}
+		d := p.backoff(n)
+		l.Warnf("%s: %v (retry %d/%d in %s)\n", what, err, n, p.attempts-1, d.Round(time.Millisecond))
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return v, err
+		case <-t.C:
+		}
+	}
+}
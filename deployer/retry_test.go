@@ -0,0 +1,139 @@
+package deployer
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func blockNumberNode(t *testing.T) *fakeNode {
+	return newFakeNode(t, map[string]func([]json.RawMessage) (interface{}, error){
+		"eth_blockNumber": func([]json.RawMessage) (interface{}, error) { return hexutil.Uint64(42), nil },
+		"eth_call":        func([]json.RawMessage) (interface{}, error) { return nil, errors.New("execution reverted") },
+	})
+}
+
+// TestRetryTransient replays captures of a node rate limiting, and of
+// one behind a failing gateway: three failures and then the answer, then
+// four failures.
+func TestRetryTransient(t *testing.T) {
+	for capture, status := range map[string]int{"rate-limited": http.StatusTooManyRequests, "bad-gateway": http.StatusBadGateway} {
+		node := replayNodes(t, "testdata/rpc/"+capture+".ndjson")[0]
+		c, err := testDial(t, node.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		warned := warnings(t)
+		c.policy = retryPolicy{attempts: 4, delay: time.Millisecond}
+
+		if n, err := c.BlockNumber(t.Context()); err != nil || n != 42 {
+			t.Fatalf("%s: block number = %d, %v; want 42 on the fourth attempt", capture, n, err)
+		}
+		if n := node.count("eth_blockNumber"); n != 4 {
+			t.Fatalf("%s: eth_blockNumber sent %d times, want 4", capture, n)
+		}
+		if got := strings.Count(warned.String(), "eth_blockNumber: "); got != 3 || !strings.Contains(warned.String(), "(retry 3/3 in ") {
+			t.Fatalf("%s: warnings %q, want one per retry", capture, warned.String())
+		}
+
+		_, err = c.BlockNumber(t.Context())
+		var httpErr rpc.HTTPError
+		if !errors.Is(err, ErrRPCUnavailable) || !errors.As(err, &httpErr) || httpErr.StatusCode != status {
+			t.Fatalf("%s: block number with every attempt failing = %v, want ErrRPCUnavailable", capture, err)
+		}
+	}
+}
+
+func TestRetryPermanent(t *testing.T) {
+	node := blockNumberNode(t)
+	c, err := testDial(t, node.url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.policy = retryPolicy{attempts: 5, delay: time.Millisecond}
+
+	// An answer, even an error one, is not retried.
+	if _, err := c.CallContract(t.Context(), ethereum.CallMsg{To: &testAddr, Data: []byte{1}}, nil); err == nil || !strings.Contains(err.Error(), "execution reverted") {
+		t.Fatalf("eth_call = %v, want the revert", err)
+	}
+	if n := node.count("eth_call"); n != 1 {
+		t.Fatalf("eth_call sent %d times, want once", n)
+	}
+	node.failNext(1, http.StatusBadRequest)
+	if _, err := c.BlockNumber(t.Context()); err == nil || errors.Is(err, ErrRPCUnavailable) {
+		t.Fatalf("block number answered 400 = %v, want the error unretried", err)
+	}
+	if n := node.count("eth_blockNumber"); n != 1 {
+		t.Fatalf("eth_blockNumber sent %d times after a 400, want once", n)
+	}
+}
+
+func TestRetrySendNotRepeated(t *testing.T) {
+	tx, err := signTransfer(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var known bool
+	node := newFakeNode(t, map[string]func([]json.RawMessage) (interface{}, error){
+		"eth_sendRawTransaction": func([]json.RawMessage) (interface{}, error) { return tx.Hash(), nil },
+		"eth_getTransactionByHash": func([]json.RawMessage) (interface{}, error) {
+			if !known {
+				return nil, nil
+			}
+			return tx, nil
+		},
+	})
+	c, err := testDial(t, node.url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	warned := warnings(t)
+	c.policy = retryPolicy{attempts: 5, delay: time.Millisecond}
+
+	// The send failed, and the node does not have it: the error is
+	// returned, not retried.
+	node.failNext(1, http.StatusBadGateway)
+	if err := c.SendTransaction(t.Context(), tx); err == nil {
+		t.Fatal("send answered 502 with the tx unknown succeeded")
+	}
+	if n := node.count("eth_sendRawTransaction"); n != 1 {
+		t.Fatalf("eth_sendRawTransaction sent %d times, want once", n)
+	}
+	if n := node.count("eth_getTransactionByHash"); n != 1 {
+		t.Fatalf("eth_getTransactionByHash sent %d times, want one lookup", n)
+	}
+
+	// The send failed on the way back, but the node has it.
+	known = true
+	node.failNext(1, http.StatusBadGateway)
+	if err := c.SendTransaction(t.Context(), tx); err != nil {
+		t.Fatalf("send answered 502 with the tx known = %v, want success", err)
+	}
+	if n := node.count("eth_sendRawTransaction"); n != 2 {
+		t.Fatalf("eth_sendRawTransaction sent %d times, want twice", n)
+	}
+	if !strings.Contains(warned.String(), "but the node already has it") {
+		t.Fatalf("warnings %q do not say the node has the tx", warned.String())
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := retryPolicy{attempts: 10, delay: 100 * time.Millisecond}
+	for n, base := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 20: maxRetryDelay} {
+		for range 20 {
+			if d := p.backoff(n); d < base || d > base+base/2 {
+				t.Fatalf("backoff(%d) = %s, want %s plus up to 50%% jitter", n, d, base)
+			}
+		}
+	}
+	if d := (retryPolicy{}).backoff(3); d != 0 {
+		t.Fatalf("backoff with no delay = %s", d)
+	}
+}
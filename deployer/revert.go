@@ -0,0 +1,149 @@
+package deployer
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	errorSelector = [4]byte{0x08, 0xc3, 0x79, 0xa0} // Error(string)
+	panicSelector = [4]byte{0x4e, 0x48, 0x7b, 0x71} // Panic(uint256)
+)
+
+// panicReasons names the compiler-inserted Panic(uint256) codes.
+var panicReasons = map[uint64]string{
+	0x00: "generic compiler panic",
+	0x01: "assertion failed",
+	0x11: "arithmetic overflow or underflow",
+	0x12: "division or modulo by zero",
+	0x21: "invalid enum value",
+	0x22: "corrupted storage byte array",
+	0x31: "pop on empty array",
+	0x32: "array index out of bounds",
+	0x41: "out of memory",
+	0x51: "call to uninitialized function pointer",
+}
+
+// revertData extracts the return data carried by a JSON-RPC execution
+// error, if any.
+func revertData(err error) ([]byte, bool) {
+	var de rpc.DataError
+	if !errors.As(err, &de) {
+		return nil, false
+	}
+	s, ok := de.ErrorData().(string)
+	if !ok {
+		return nil, false
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(b) == 0 {
+		return nil, false
+	}
+	return b, true
+}
+
+// decodeRevert renders revert data as Error(string), a named Panic code, or
+// a custom error from contractABI, always including the selector.
+func decodeRevert(data []byte, contractABI *abi.ABI) string {
+	if len(data) < 4 {
+		return fmt.Sprintf("revert without reason (0x%x)", data)
+	}
+	var sel [4]byte
+	copy(sel[:], data[:4])
+
+	switch sel {
+	case errorSelector:
+		if msg, err := abi.UnpackRevert(data); err == nil {
+			return fmt.Sprintf("Error(%q) [0x%x]", msg, sel)
+		}
+	case panicSelector:
+		if len(data) >= 36 {
+			code := new(big.Int).SetBytes(data[4:36])
+			reason := "unknown panic code"
+			if code.IsUint64() {
+				if r, ok := panicReasons[code.Uint64()]; ok {
+					reason = r
+				}
+			}
+			return fmt.Sprintf("Panic(0x%x): %s [0x%x]", code, reason, sel)
+		}
+	}
+
+	if contractABI != nil {
+		if e, err := contractABI.ErrorByID(sel); err == nil {
+			if vals, err := e.Inputs.Unpack(data[4:]); err == nil {
+				return fmt.Sprintf("%s(%s) [0x%x]", e.Name, formatArgs(e.Inputs, vals), sel)
+			}
+		}
+	}
+	return fmt.Sprintf("unknown custom error [0x%x] data=0x%x", sel, data[4:])
+}
+
+// explainError appends the decoded revert reason to errors from eth_call
+// and gas estimation, making them a RevertError, and classifies the
+// node's other rejections.
+func explainError(err error, contractABI *abi.ABI) error {
+	if err == nil {
+		return nil
+	}
+	var rev *RevertError
+	if errors.As(err, &rev) {
+		return err
+	}
+	if data, ok := revertData(err); ok {
+		reason := decodeRevert(data, contractABI)
+		return &RevertError{Reason: reason, msg: err.Error() + ": " + reason, err: err}
+	}
+	if strings.Contains(strings.ToLower(err.Error()), "execution reverted") {
+		return &RevertError{msg: err.Error(), err: err}
+	}
+	return classifyNodeError(err)
+}
+
+// failureReason replays a failed transaction as an eth_call at the block it
+// was mined in and decodes the revert it produces.
+func failureReason(ctx context.Context, client *rpcClient, tx *types.Transaction, rcpt *types.Receipt, contractABI *abi.ABI) string {
+	from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return fmt.Sprintf("unknown (sender: %v)", err)
+	}
+	msg := ethereum.CallMsg{
+		From:       from,
+		To:         tx.To(),
+		Gas:        tx.Gas(),
+		Value:      tx.Value(),
+		Data:       tx.Data(),
+		AccessList: tx.AccessList(),
+	}
+	if tx.Type() == types.LegacyTxType || tx.Type() == types.AccessListTxType {
+		msg.GasPrice = tx.GasPrice()
+	} else {
+		msg.GasFeeCap, msg.GasTipCap = tx.GasFeeCap(), tx.GasTipCap()
+	}
+	if reason, failed := callReason(ctx, client, msg, rcpt.BlockNumber, contractABI); failed {
+		return reason
+	}
+	return "unknown (replay succeeded; likely out of gas or state-dependent)"
+}
+
+// callReason makes msg as an eth_call at block and decodes the revert it
+// produces. failed is false when the call succeeds.
+func callReason(ctx context.Context, client *rpcClient, msg ethereum.CallMsg, block *big.Int, contractABI *abi.ABI) (reason string, failed bool) {
+	_, err := client.CallContract(ctx, msg, block)
+	if err == nil {
+		return "", false
+	}
+	if data, ok := revertData(err); ok {
+		return decodeRevert(data, contractABI), true
+	}
+	return err.Error(), true
+}
@@ -0,0 +1,171 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// defaultRPC is the endpoint a stock `anvil` listens on.
+const defaultRPC = "http://127.0.0.1:8545"
+
+// urlList is a repeatable flag; each value may also be comma-separated.
+type urlList []string
+
+func (l *urlList) String() string { return strings.Join(*l, ",") }
+
+func (l *urlList) Set(v string) error {
+	*l = append(*l, splitURLs(v)...)
+	return nil
+}
+
+func splitURLs(v string) []string {
+	var urls []string
+	for _, u := range strings.Split(v, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// resolveRPC picks the endpoints to dial, in priority order: --rpc flags
+// win over RPC_URLS, which wins over RPC_URL, which wins over the Anvil
+// default.
+func resolveRPC(flagURLs []string) ([]string, error) {
+	urls := []string{defaultRPC}
+	if v := splitURLs(os.Getenv("RPC_URL")); len(v) > 0 {
+		urls = v
+	}
+	if v := splitURLs(os.Getenv("RPC_URLS")); len(v) > 0 {
+		urls = v
+	}
+	if len(flagURLs) > 0 {
+		urls = flagURLs
+	}
+	for _, rpc := range urls {
+		if isIPC(rpc) {
+			continue
+		}
+		u, err := url.Parse(rpc)
+		if err != nil {
+			// url.Error quotes the whole URL, key and all.
+			var uerr *url.Error
+			if errors.As(err, &uerr) {
+				err = uerr.Err
+			}
+			return nil, fmt.Errorf("rpc url %s: %w", redactURL(rpc), err)
+		}
+		switch u.Scheme {
+		case "http", "https", "ws", "wss":
+		default:
+			return nil, fmt.Errorf("rpc url %s: unsupported scheme %q (want http, https, ws, wss or the path of an IPC socket)", redactURL(rpc), u.Scheme)
+		}
+	}
+	return urls, nil
+}
+
+// isIPC reports whether rpc is the path of a node's IPC socket, such as
+// /data/geth.ipc or ./geth.ipc, rather than a URL.
+func isIPC(rpc string) bool {
+	return !strings.Contains(rpc, "://") && (strings.HasSuffix(rpc, ".ipc") || strings.HasPrefix(rpc, "/") || strings.HasPrefix(rpc, "."))
+}
+
+// isWebSocket reports whether rpc is a ws:// or wss:// URL.
+func isWebSocket(rpc string) bool {
+	return strings.HasPrefix(rpc, "ws://") || strings.HasPrefix(rpc, "wss://")
+}
+
+// canSubscribe reports whether the node at rpc can push notifications:
+// WebSocket and IPC endpoints can, HTTP ones cannot.
+func canSubscribe(rpc string) bool {
+	return isWebSocket(rpc) || isIPC(rpc)
+}
+
+// dialNode connects to one endpoint, sending headers with every HTTP
+// request and WebSocket handshake, through l when it is on. It returns
+// what closes the connection and anything l put in front of it.
+func dialNode(ctx context.Context, l *rpcLogger, url string, headers http.Header) (*ethclient.Client, func(), error) {
+	node, err := rpc.DialOptions(ctx, url, rpc.WithHeaders(headers))
+	if err != nil {
+		return nil, nil, err
+	}
+	c, stop, err := l.wrap(node, url, headers)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ethclient.NewClient(c), stop, nil
+}
+
+// dial connects to every endpoint and checks they agree on the chain ID.
+// With a single endpoint any failure is fatal; with several, endpoints
+// that are down are marked unhealthy and probed again later. Reads through
+// the returned client are retried according to p, each request is
+// bounded by timeout, and receipt, nonce and balance reads are batched
+// according to b. Every endpoint is sent headers. The client logs to e.
+func dial(ctx context.Context, e env, urls []string, p retryPolicy, timeout time.Duration, b batchPolicy, headers http.Header) (*rpcClient, error) {
+	c := &rpcClient{env: e, policy: p, timeout: timeout, headers: headers}
+	c.reads, c.pins = newBatcher(c, b, false), newBatcher(c, b, true)
+	for _, rpc := range urls {
+		name := redactURL(rpc)
+		client, stop, err := dialNode(ctx, e.rpcLog, rpc, headers)
+		if err != nil {
+			err = redactErr(err, rpc)
+			if len(urls) == 1 {
+				return nil, classify(ErrRPCUnavailable, fmt.Errorf("dial %s: %w", name, err))
+			}
+			c.ui.Warnf("rpc %s: unhealthy: dial: %v\n", name, err)
+			c.endpoints = append(c.endpoints, &endpoint{url: rpc, name: name})
+			continue
+		}
+		c.endpoints = append(c.endpoints, &endpoint{url: rpc, name: name, client: client, stop: stop, healthy: true})
+	}
+
+	var first *endpoint
+	for _, e := range c.endpoints {
+		if !e.healthy {
+			continue
+		}
+		id, err := retry(ctx, c.ui, p, "eth_chainId", func() (*big.Int, error) { return c.probeChainID(ctx, e) })
+		if err != nil {
+			if len(urls) == 1 {
+				c.Close()
+				return nil, classify(ErrRPCUnavailable, fmt.Errorf("chain id: %w", err))
+			}
+			c.setHealth(e, false, err)
+			continue
+		}
+		if first == nil {
+			first, c.chainID = e, id
+		} else if id.Cmp(c.chainID) != 0 {
+			c.Close()
+			return nil, classify(ErrChainMismatch, fmt.Errorf("chain id mismatch: %s reports %s, %s reports %s", first.name, c.chainID, e.name, id))
+		}
+	}
+	if first == nil {
+		c.Close()
+		return nil, classify(ErrRPCUnavailable, fmt.Errorf("no reachable rpc endpoint among %s", strings.Join(redactURLs(urls), ", ")))
+	}
+	c.Client = first.client
+	return c, nil
+}
+
+// checkChainID fails when want is set and differs from the node's chain ID.
+func checkChainID(got *big.Int, want uint64) error {
+	if want == 0 {
+		return nil
+	}
+	if !got.IsUint64() || got.Uint64() != want {
+		return classify(ErrChainMismatch, fmt.Errorf("chain id mismatch: node reports %s, expected %d", got, want))
+	}
+	return nil
+}
@@ -0,0 +1,383 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gorilla/websocket"
+)
+
+// downURL refuses connections and carries an API key in its path, as
+// hosted providers' URLs do.
+const downURL = "http://127.0.0.1:1/v2/SECRETKEY"
+
+// warnings collects what ui.Warnf prints until the test ends.
+func warnings(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	ui.warnw = &buf
+	ui.setFormat(false)
+	t.Cleanup(func() {
+		ui.warnw = io.Discard
+		ui.setFormat(false)
+	})
+	return &buf
+}
+
+func testDial(t *testing.T, urls ...string) (*rpcClient, error) {
+	t.Helper()
+	c, err := dial(t.Context(), cli, urls, retryPolicy{attempts: 2, delay: time.Millisecond}, 0, batchPolicy{}, http.Header{})
+	if err == nil {
+		t.Cleanup(c.Close)
+	}
+	return c, err
+}
+
+// pinnedTo is the endpoint c pins transactions to.
+func pinnedTo(t *testing.T, c *rpcClient) *endpoint {
+	t.Helper()
+	e, err := c.pin(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestFailoverEndpointDown(t *testing.T) {
+	chain := newSimChain(t)
+	chain.Commit()
+	warned := warnings(t)
+
+	c, err := testDial(t, downURL, chain.rpc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := c.BlockNumber(t.Context()); err != nil || n != 1 {
+		t.Fatalf("block number = %d, %v; want 1 from the live endpoint", n, err)
+	}
+	if e := pinnedTo(t, c); e.url != chain.rpc {
+		t.Fatalf("transactions pinned to %s, want the live endpoint", e.name)
+	}
+	out := warned.String()
+	if !strings.Contains(out, "rpc http://127.0.0.1:1/<redacted>: unhealthy") {
+		t.Errorf("warnings %q do not report the endpoint down", out)
+	}
+	if strings.Contains(out, "SECRETKEY") {
+		t.Errorf("warnings leak the API key: %q", out)
+	}
+
+	_, err = testDial(t, downURL)
+	if err == nil || !errors.Is(err, ErrRPCUnavailable) {
+		t.Fatalf("dial of a down endpoint = %v, want ErrRPCUnavailable", err)
+	}
+	if strings.Contains(err.Error(), "SECRETKEY") || !strings.Contains(err.Error(), "127.0.0.1:1/<redacted>") {
+		t.Fatalf("error %q should name the endpoint without its key", err)
+	}
+}
+
+func TestFailoverStaleEndpoint(t *testing.T) {
+	stale, fresh := newSimChain(t), newSimChain(t)
+	for range 5 {
+		fresh.Commit()
+	}
+	c, err := testDial(t, stale.rpc, fresh.rpc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := c.BlockNumber(t.Context()); err != nil || n != 5 {
+		t.Fatalf("block number = %d, %v; want 5 from the endpoint ahead", n, err)
+	}
+	if e := pinnedTo(t, c); e.url != fresh.rpc {
+		t.Fatalf("transactions pinned to %s, want the endpoint ahead", e.name)
+	}
+
+	// The best endpoint dies: reads move to the one left, and so do
+	// transactions.
+	warned := warnings(t)
+	fresh.Close()
+	if n, err := c.BlockNumber(t.Context()); err != nil || n != 0 {
+		t.Fatalf("block number after failover = %d, %v; want 0 from the stale endpoint", n, err)
+	}
+	if e := pinnedTo(t, c); e.url != stale.rpc {
+		t.Fatalf("transactions still pinned to %s after it went down", e.name)
+	}
+	if !strings.Contains(warned.String(), "moving transactions from "+fresh.rpc+" to "+stale.rpc) {
+		t.Errorf("warnings %q do not report the move", warned.String())
+	}
+}
+
+// TestFailoverOutage replays a capture of two endpoints where the one
+// ahead starts answering 503: reads move to the other, and so do
+// transactions.
+func TestFailoverOutage(t *testing.T) {
+	nodes := replayNodes(t, "testdata/rpc/outage.ndjson")
+	ahead, behind := nodes[0], nodes[1]
+	c, err := testDial(t, ahead.url, behind.url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := c.BlockNumber(t.Context()); err != nil || n != 100 {
+		t.Fatalf("block number = %d, %v; want 100 from the endpoint ahead", n, err)
+	}
+	if e := pinnedTo(t, c); e.url != ahead.url {
+		t.Fatalf("transactions pinned to %s, want the endpoint ahead", e.name)
+	}
+
+	warned := warnings(t)
+	if n, err := c.BlockNumber(t.Context()); err != nil || n != 42 {
+		t.Fatalf("block number in the outage = %d, %v; want 42 from the endpoint left", n, err)
+	}
+	if e := pinnedTo(t, c); e.url != behind.url {
+		t.Fatalf("transactions still pinned to %s in its outage", e.name)
+	}
+	if !strings.Contains(warned.String(), "moving transactions from "+ahead.url+" to "+behind.url) {
+		t.Errorf("warnings %q do not report the move", warned.String())
+	}
+}
+
+// TestFailoverThreeEndpoints dials one endpoint answering 503, one
+// slower than the request timeout and one healthy: reads and transactions
+// go to the healthy one, and transactions stay there once the others are
+// back, even ahead of it.
+func TestFailoverThreeEndpoints(t *testing.T) {
+	head := func(n uint64) func([]json.RawMessage) (interface{}, error) {
+		return func([]json.RawMessage) (interface{}, error) { return hexutil.Uint64(n), nil }
+	}
+	down := newFakeNode(t, map[string]func([]json.RawMessage) (interface{}, error){"eth_blockNumber": head(100)})
+	down.failNext(1000, http.StatusServiceUnavailable)
+	slow := newFakeNode(t, map[string]func([]json.RawMessage) (interface{}, error){
+		"eth_blockNumber": func([]json.RawMessage) (interface{}, error) {
+			time.Sleep(300 * time.Millisecond)
+			return hexutil.Uint64(90), nil
+		},
+	})
+	healthy := newFakeNode(t, map[string]func([]json.RawMessage) (interface{}, error){"eth_blockNumber": head(80)})
+	warnings(t)
+
+	c, err := dial(t.Context(), cli, []string{down.url, slow.url, healthy.url}, retryPolicy{attempts: 2, delay: time.Millisecond}, 100*time.Millisecond, batchPolicy{}, http.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	if n, err := c.BlockNumber(t.Context()); err != nil || n != 80 {
+		t.Fatalf("block number = %d, %v; want 80 from the healthy endpoint", n, err)
+	}
+	if e := pinnedTo(t, c); e.url != healthy.url {
+		t.Fatalf("transactions pinned to %s, want the healthy endpoint", e.name)
+	}
+
+	down.failNext(0, 0)
+	c.mu.Lock()
+	c.refreshed = time.Time{}
+	c.mu.Unlock()
+	if n, err := c.BlockNumber(t.Context()); err != nil || n != 100 {
+		t.Fatalf("block number once back = %d, %v; want 100 from the endpoint ahead", n, err)
+	}
+	if e := pinnedTo(t, c); e.url != healthy.url {
+		t.Fatalf("transactions moved to %s while the pinned endpoint was healthy", e.name)
+	}
+	before := healthy.count("eth_blockNumber")
+	if _, err := pinned(t.Context(), c, "eth_blockNumber", func(ctx context.Context, cl *ethclient.Client) (uint64, error) { return cl.BlockNumber(ctx) }); err != nil {
+		t.Fatal(err)
+	}
+	if healthy.count("eth_blockNumber") != before+1 {
+		t.Fatal("a pinned call did not go to the pinned endpoint")
+	}
+
+	// With no endpoint connected there is nothing to pin.
+	idle := &rpcClient{env: cli, endpoints: []*endpoint{{url: down.url}, {url: slow.url}}, refreshed: time.Now()}
+	if _, err := idle.pin(t.Context()); !errors.Is(err, errNoEndpoint) {
+		t.Fatalf("pin with no endpoint connected = %v, want errNoEndpoint", err)
+	}
+	if _, err := idle.BlockNumber(t.Context()); !errors.Is(err, errNoEndpoint) {
+		t.Fatalf("read with no endpoint connected = %v, want errNoEndpoint", err)
+	}
+}
+
+func TestRedactErr(t *testing.T) {
+	base := errors.New(`Post "https://eth.example/v2/SECRETKEY": dial tcp: connection refused`)
+	err := redactErr(base, "https://eth.example/v2/SECRETKEY")
+	if err.Error() != `Post "https://eth.example/<redacted>": dial tcp: connection refused` {
+		t.Fatalf("redacted to %q", err)
+	}
+	if !errors.Is(err, base) {
+		t.Fatal("the redacted error does not wrap the original")
+	}
+	if redactErr(base, "https://other.example") != base {
+		t.Fatal("an error not quoting the URL was wrapped")
+	}
+	if _, err := resolveRPC([]string{"https://eth.example/v2/SECRET%zz"}); err == nil || strings.Contains(err.Error(), "SECRET") {
+		t.Fatalf("bad URL error %v names the key", err)
+	}
+}
+
+// gateway serves h only to requests carrying the tenant header and bearer
+// token, answering the rest 401.
+func gateway(t *testing.T, h http.Handler) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0ken" || r.Header.Get("X-Tenant") != "acme" {
+			http.Error(w, "missing credentials", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// chainIDService answers eth_chainId over a go-ethereum RPC server.
+type chainIDService struct{}
+
+func (chainIDService) ChainId() hexutil.Uint64 { return 1337 }
+
+func TestRPCHeaders(t *testing.T) {
+	isolate(t)
+	node := blockNumberNode(t)
+	url := gateway(t, http.HandlerFunc(node.serve))
+
+	if _, err := testDial(t, url); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("dial without the headers = %v, want a 401", err)
+	}
+
+	// The flag beats the variable, which beats the profile.
+	config := filepath.Join(t.TempDir(), "nyc2025.toml")
+	profile := "[profiles.gw.rpc_headers]\nAuthorization = \"Bearer stale\"\nX-Tenant = \"other\"\nX-Region = \"eu\"\n"
+	if err := os.WriteFile(config, []byte(profile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("RPC_BEARER_TOKEN", "t0ken")
+	var o options
+	fs := flag.NewFlagSet("call", flag.ContinueOnError)
+	o.register(fs)
+	if err := parseFlags(fs, []string{"--config", config, "--profile", "gw", "--rpc-header", "X-Tenant: acme"}, &o); err != nil {
+		t.Fatal(err)
+	}
+	h := o.headers()
+	if h.Get("Authorization") != "Bearer t0ken" || h.Get("X-Tenant") != "acme" || h.Get("X-Region") != "eu" {
+		t.Fatalf("headers = %v", h)
+	}
+	c, err := dial(t.Context(), cli, []string{url}, retryPolicy{attempts: 1}, 0, batchPolicy{}, h)
+	if err != nil {
+		t.Fatalf("dial with the headers: %v", err)
+	}
+	defer c.Close()
+	if n, err := c.BlockNumber(t.Context()); err != nil || n != 42 {
+		t.Fatalf("block number through the gateway = %d, %v", n, err)
+	}
+
+	// WebSocket handshakes carry them too.
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("eth", chainIDService{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Stop)
+	ws := "ws" + strings.TrimPrefix(gateway(t, srv.WebsocketHandler(nil)), "http")
+	if _, err := testDial(t, ws); err == nil {
+		t.Fatal("WebSocket dial without the headers succeeded")
+	}
+	wc, err := dial(t.Context(), cli, []string{ws}, retryPolicy{attempts: 1}, 0, batchPolicy{}, h)
+	if err != nil {
+		t.Fatalf("WebSocket dial with the headers: %v", err)
+	}
+	wc.Close()
+}
+
+func TestRPCHeaderFlag(t *testing.T) {
+	var o options
+	fs := flag.NewFlagSet("call", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	o.register(fs)
+	if err := fs.Parse([]string{"--rpc-header", "no colon"}); err == nil || !strings.Contains(err.Error(), `want "Name: value"`) {
+		t.Fatalf("--rpc-header without a colon = %v", err)
+	}
+	for name, want := range map[string]string{
+		"Authorization": "[redacted 12 chars]",
+		"X-Api-Key":     "[redacted 12 chars]",
+		"Cookie":        "[redacted 12 chars]",
+		"X-Tenant":      "Bearer t0ken",
+	} {
+		if got := redactHeader(name, "Bearer t0ken"); got != want {
+			t.Errorf("redactHeader(%s) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// wsNode serves n over WebSocket, one request per frame, and drops each
+// connection without a close frame after answering frames requests, as
+// providers recycling their sockets do. It returns the ws:// URL and the
+// number of connections accepted so far.
+func wsNode(t *testing.T, n *fakeNode, frames int) (string, *atomic.Int32) {
+	t.Helper()
+	var conns atomic.Int32
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conns.Add(1)
+		for range frames {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			rec := httptest.NewRecorder()
+			n.serve(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(msg)))
+			if err := conn.WriteMessage(websocket.TextMessage, rec.Body.Bytes()); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http"), &conns
+}
+
+// TestWebSocketReconnect reads through a WebSocket that drops after every
+// third frame: each read still succeeds, over a new connection.
+func TestWebSocketReconnect(t *testing.T) {
+	node := blockNumberNode(t)
+	url, conns := wsNode(t, node, 3)
+	c, err := testDial(t, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.policy = retryPolicy{attempts: 3, delay: time.Millisecond}
+
+	// eth_chainId took the first connection's first frame.
+	for i := range 8 {
+		if n, err := c.BlockNumber(t.Context()); err != nil || n != 42 {
+			t.Fatalf("read %d: block number = %d, %v; want 42", i, n, err)
+		}
+	}
+	if n := conns.Load(); n != 3 {
+		t.Fatalf("%d connections for 9 requests, want 3", n)
+	}
+
+	// The watch loop redials explicitly, and checks the chain again.
+	if err := c.reconnect(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if n := conns.Load(); n != 4 || node.count("eth_chainId") != 2 {
+		t.Fatalf("after reconnect: %d connections, eth_chainId sent %d times; want 4 and 2", n, node.count("eth_chainId"))
+	}
+	if n, err := c.BlockNumber(t.Context()); err != nil || n != 42 {
+		t.Fatalf("block number after reconnect = %d, %v", n, err)
+	}
+}
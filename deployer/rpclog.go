@@ -0,0 +1,716 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// --rpc-log levels.
+const (
+	rpcLogOff = iota
+	rpcLogInfo
+	rpcLogDebug
+)
+
+// rpcExchange is one line of an --rpc-capture file: a JSON-RPC call and
+// what came back, redacted as --rpc-log debug prints them. A call that
+// failed before a JSON-RPC answer has Status, for an HTTP error, or Error,
+// for a transport one, so a capture replays rate limits and outages as
+// well as answers. Calls sent as a batch share a Batch size.
+type rpcExchange struct {
+	Time       time.Time       `json:"time"`
+	Endpoint   string          `json:"endpoint"`
+	Method     string          `json:"method"`
+	Request    json.RawMessage `json:"request"`
+	Response   json.RawMessage `json:"response,omitempty"`
+	Status     int             `json:"status,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	DurationMs float64         `json:"durationMs"`
+	Batch      int             `json:"batch,omitempty"`
+}
+
+// rpcLogger logs and captures the JSON-RPC traffic to the node endpoints.
+// It is middleware on each endpoint's calls: while it is on, the
+// endpoint's ethclient talks to an rpcBridge, which passes every call,
+// batch and subscription through a loggedCaller to the node. So it sees
+// everything ethclient sends, receipt polling and batches included, over
+// HTTP, WebSocket or IPC alike. Lines go through ui, so --quiet and
+// --log-format apply to them.
+type rpcLogger struct {
+	ui      *logger
+	level   int
+	capture string
+	ids     atomic.Uint64 // numbers the logged requests
+
+	mu     sync.Mutex
+	file   *os.File
+	failed bool
+	errs   map[string]error // failures passed on by the bridges, by token
+	passed uint64
+}
+
+// rpcLog is the commands' RPC logger; options.register configures it and
+// Main closes its capture once the command returns.
+var rpcLog = cli.rpcLog
+
+func (l *rpcLogger) register(fs *flag.FlagSet) {
+	fs.Func("rpc-log", "log JSON-RPC calls to stderr: info (method, duration and error) or debug (also the bodies, with keys and signed transactions redacted)", func(v string) error {
+		switch v {
+		case "off":
+			l.level = rpcLogOff
+		case "info":
+			l.level = rpcLogInfo
+		case "debug":
+			l.level = rpcLogDebug
+		default:
+			return errors.New("want off, info or debug")
+		}
+		return nil
+	})
+	fs.StringVar(&l.capture, "rpc-capture", "", "write every JSON-RPC call and its answer, redacted, to this NDJSON `file`")
+}
+
+// on reports whether --rpc-log or --rpc-capture is set.
+func (l *rpcLogger) on() bool {
+	return l.level > rpcLogOff || l.capture != ""
+}
+
+// wrap returns the client the endpoint at url is used through, and what
+// closes it: node itself while l is off, or else a client of a bridge
+// that logs every call on its way to node. At debug level the headers
+// sent to url are printed once, with secrets redacted.
+func (l *rpcLogger) wrap(node *rpc.Client, url string, headers http.Header) (*rpc.Client, func(), error) {
+	if !l.on() {
+		return node, node.Close, nil
+	}
+	name := redactURL(url)
+	if l.level >= rpcLogDebug && len(headers) > 0 {
+		var shown []string
+		for name, values := range headers {
+			for _, v := range values {
+				shown = append(shown, name+": "+redactHeader(name, v))
+			}
+		}
+		sort.Strings(shown)
+		l.ui.emit(slog.LevelInfo, fmt.Sprintf("rpc %s headers: %s\n", name, strings.Join(shown, ", ")),
+			slog.String("endpoint", name), slog.Any("headers", shown))
+	}
+	return newRPCBridge(l, loggedCaller{l: l, url: name, next: node}, node)
+}
+
+// redactHeader is value as --rpc-log prints it: hidden for credentials,
+// which is any header whose name mentions auth, a token, a key, a secret
+// or a password, or carries cookies.
+func redactHeader(name, value string) string {
+	n := strings.ToLower(name)
+	for _, s := range []string{"auth", "token", "key", "secret", "password", "cookie"} {
+		if strings.Contains(n, s) {
+			return redacted(value)
+		}
+	}
+	return value
+}
+
+// close finishes the capture file.
+func (l *rpcLogger) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		if err := l.file.Close(); err != nil {
+			l.ui.Warnf("warning: --rpc-capture: %v\n", err)
+		}
+		l.file = nil
+	}
+}
+
+// rpcCaller is the part of an rpc.Client that middleware wraps.
+type rpcCaller interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+	BatchCallContext(ctx context.Context, b []rpc.BatchElem) error
+	Subscribe(ctx context.Context, namespace string, channel interface{}, args ...interface{}) (*rpc.ClientSubscription, error)
+}
+
+// loggedCaller passes calls on to next and logs each one, with what came
+// back, as sent to the endpoint at url.
+type loggedCaller struct {
+	l    *rpcLogger
+	url  string
+	next rpcCaller
+}
+
+func (c loggedCaller) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	start := time.Now()
+	err := c.next.CallContext(ctx, result, method, args...)
+	c.l.exchange(c.url, start, time.Since(start), 0, method, args, result, err)
+	return err
+}
+
+func (c loggedCaller) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	start := time.Now()
+	err := c.next.BatchCallContext(ctx, b)
+	took := time.Since(start)
+	for _, e := range b {
+		failed := err
+		if failed == nil {
+			failed = e.Error
+		}
+		c.l.exchange(c.url, start, took, len(b), e.Method, e.Args, e.Result, failed)
+	}
+	return err
+}
+
+// Subscribe logs the subscription being made; the notifications it
+// brings are not logged.
+func (c loggedCaller) Subscribe(ctx context.Context, namespace string, channel interface{}, args ...interface{}) (*rpc.ClientSubscription, error) {
+	start := time.Now()
+	sub, err := c.next.Subscribe(ctx, namespace, channel, args...)
+	c.l.exchange(c.url, start, time.Since(start), 0, namespace+"_subscribe", args, nil, err)
+	return sub, err
+}
+
+// rpcMessage is a JSON-RPC request, response or notification, as far as
+// the logger reads it.
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcFailure     `json:"error,omitempty"`
+}
+
+// rpcFailure is the error of a JSON-RPC response.
+type rpcFailure struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// rpcFailureOf is err as the node answered it, or nil when err is not a
+// JSON-RPC error but, say, an HTTP status or a dropped connection.
+func rpcFailureOf(err error) *rpcFailure {
+	var re rpc.Error
+	if !errors.As(err, &re) {
+		return nil
+	}
+	f := &rpcFailure{Code: re.ErrorCode(), Message: re.Error()}
+	var de rpc.DataError
+	if errors.As(err, &de) {
+		f.Data = de.ErrorData()
+	}
+	return f
+}
+
+// exchange logs and captures one call, method with args, that took took
+// from start and got result or failed with err. A call with neither, a
+// subscription, is logged without a response.
+func (l *rpcLogger) exchange(url string, start time.Time, took time.Duration, batch int, method string, args []interface{}, result interface{}, err error) {
+	id := json.RawMessage(strconv.FormatUint(l.ids.Add(1), 10))
+	if args == nil {
+		args = []interface{}{}
+	}
+	params, perr := json.Marshal(args)
+	if perr != nil {
+		params = json.RawMessage(`"[unencodable]"`)
+	}
+	m := rpcMessage{JSONRPC: "2.0", ID: id, Method: method, Params: params}
+	raw, _ := json.Marshal(m)
+	x := rpcExchange{
+		Time:       start.UTC(),
+		Endpoint:   url,
+		Method:     method,
+		Request:    redactRequest(rawMessage{raw: raw, msg: m}),
+		DurationMs: float64(took.Microseconds()) / 1000,
+		Batch:      batch,
+	}
+
+	answer := rpcMessage{JSONRPC: "2.0", ID: id}
+	what := ""
+	var httpErr rpc.HTTPError
+	switch {
+	case err == nil && result != nil:
+		answer.Result, _ = json.Marshal(result)
+	case err == nil:
+	case errors.As(err, &httpErr):
+		x.Status = httpErr.StatusCode
+		what = fmt.Sprintf("HTTP %d: %.200s", httpErr.StatusCode, strings.TrimSpace(string(httpErr.Body)))
+	default:
+		if answer.Error = rpcFailureOf(err); answer.Error != nil {
+			what = fmt.Sprintf("%s (%d)", answer.Error.Message, answer.Error.Code)
+		} else {
+			x.Error, what = err.Error(), err.Error()
+		}
+	}
+	if answer.Result != nil || answer.Error != nil {
+		raw, _ := json.Marshal(answer)
+		x.Response = redactResponse(method, raw)
+	}
+
+	if l.level >= rpcLogInfo {
+		line := fmt.Sprintf("rpc %s %s %s", url, method, took.Round(10*time.Microsecond))
+		attrs := []slog.Attr{slog.String("endpoint", url), slog.String("method", method), slog.Float64("durationMs", x.DurationMs)}
+		if what != "" {
+			line += ": " + what
+			attrs = append(attrs, slog.String("error", what))
+		}
+		if l.level >= rpcLogDebug {
+			if l.ui.logJSON {
+				attrs = append(attrs, slog.Any("request", x.Request))
+				if x.Response != nil {
+					attrs = append(attrs, slog.Any("response", x.Response))
+				}
+			} else {
+				line += "\n  -> " + string(x.Request)
+				if x.Response != nil {
+					line += "\n  <- " + string(x.Response)
+				}
+			}
+		}
+		l.ui.emit(slog.LevelInfo, line+"\n", attrs...)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.write(x)
+}
+
+// Prefixes of the tokens a bridge answers a failure with that has no
+// JSON-RPC form: one call's, or a whole batch's, which every call in it
+// carries.
+const (
+	passedCall  = "rpclog-call:"
+	passedBatch = "rpclog-batch:"
+)
+
+// passOn is err as a bridge answers it. A JSON-RPC error is passed on as
+// it came. Anything else, such as an HTTP status or a dropped connection,
+// is kept under a token the answer carries, for original to swap back in
+// once the answer is through the bridge, so retries and failover see the
+// very error the node failed with.
+func (l *rpcLogger) passOn(err error, prefix string) *rpcFailure {
+	if f := rpcFailureOf(err); f != nil {
+		return f
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.passed++
+	token := prefix + strconv.FormatUint(l.passed, 10)
+	if l.errs == nil {
+		l.errs = map[string]error{}
+	}
+	l.errs[token] = err
+	return &rpcFailure{Code: -32603, Message: err.Error(), Data: token}
+}
+
+// passedToken is the token err carries if a bridge passed it on.
+func passedToken(err error) string {
+	var de rpc.DataError
+	if err == nil || !errors.As(err, &de) {
+		return ""
+	}
+	token, _ := de.ErrorData().(string)
+	if !strings.HasPrefix(token, passedCall) && !strings.HasPrefix(token, passedBatch) {
+		return ""
+	}
+	return token
+}
+
+// original is the error a bridge passed on as err, or err itself.
+func (l *rpcLogger) original(err error) error {
+	token := passedToken(err)
+	if token == "" {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	orig, ok := l.errs[token]
+	if !ok {
+		return err
+	}
+	delete(l.errs, token)
+	return orig
+}
+
+// batchError is the error a batch failed with as a whole, which a bridge
+// can only pass on as the answer to each call in it, or nil.
+func (l *rpcLogger) batchError(elems []rpc.BatchElem) error {
+	if len(elems) == 0 {
+		return nil
+	}
+	token := passedToken(elems[0].Error)
+	if !strings.HasPrefix(token, passedBatch) {
+		return nil
+	}
+	for _, e := range elems[1:] {
+		if passedToken(e.Error) != token {
+			return nil
+		}
+	}
+	return l.original(elems[0].Error)
+}
+
+// rpcBridge serves an rpc.Client over in-memory pipes and hands each
+// request it reads to next, which ends at node. ethclient only talks to
+// an *rpc.Client, so this is how middleware gets between it and the
+// node, whatever the transport.
+type rpcBridge struct {
+	l        *rpcLogger
+	next     rpcCaller
+	node     *rpc.Client
+	requests *io.PipeReader // what the client sends
+	answers  *io.PipeWriter // what it reads
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	wmu sync.Mutex // one message to the client at a time
+
+	mu   sync.Mutex
+	subs map[string]*rpc.ClientSubscription
+	last uint64
+}
+
+// newRPCBridge starts a bridge to next and returns the client that talks
+// to it, and what closes the client, the bridge and node.
+func newRPCBridge(l *rpcLogger, next rpcCaller, node *rpc.Client) (*rpc.Client, func(), error) {
+	requests, sent := io.Pipe()
+	read, answers := io.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &rpcBridge{l: l, next: next, node: node, requests: requests, answers: answers, ctx: ctx, cancel: cancel,
+		subs: map[string]*rpc.ClientSubscription{}}
+	client, err := rpc.DialIO(ctx, read, sent)
+	if err != nil {
+		b.close()
+		return nil, nil, err
+	}
+	go b.serve()
+	return client, func() { b.close(); client.Close() }, nil
+}
+
+// close ends the calls in flight and cuts the client off, so closing it
+// does not wait on the pipes.
+func (b *rpcBridge) close() {
+	b.cancel()
+	b.answers.Close()
+	b.requests.Close()
+	b.node.Close()
+}
+
+// serve reads requests until the client is closed, answering each one
+// as soon as the node has, in whatever order that is.
+func (b *rpcBridge) serve() {
+	d := json.NewDecoder(b.requests)
+	for {
+		var raw json.RawMessage
+		if d.Decode(&raw) != nil {
+			return
+		}
+		go b.handle(raw)
+	}
+}
+
+func (b *rpcBridge) handle(raw json.RawMessage) {
+	msgs, batch := rpcMessages(raw)
+	if !batch {
+		for _, m := range msgs {
+			b.one(m.msg)
+		}
+		return
+	}
+	results := make([]json.RawMessage, len(msgs))
+	elems := make([]rpc.BatchElem, len(msgs))
+	for i, m := range msgs {
+		elems[i] = rpc.BatchElem{Method: m.msg.Method, Args: rpcArgs(m.msg.Params), Result: &results[i]}
+	}
+	var whole *rpcFailure
+	if err := b.next.BatchCallContext(b.ctx, elems); err != nil {
+		whole = b.l.passOn(err, passedBatch)
+	}
+	answers := make([]rpcMessage, len(msgs))
+	for i, m := range msgs {
+		answers[i] = rpcMessage{JSONRPC: "2.0", ID: m.msg.ID}
+		switch {
+		case whole != nil:
+			answers[i].Error = whole
+		case elems[i].Error != nil:
+			answers[i].Error = b.l.passOn(elems[i].Error, passedCall)
+		default:
+			answers[i].Result = orNull(results[i])
+		}
+	}
+	b.write(answers)
+}
+
+// one answers a single request.
+func (b *rpcBridge) one(m rpcMessage) {
+	switch m.Method {
+	case "eth_subscribe":
+		b.subscribe(m)
+		return
+	case "eth_unsubscribe":
+		b.unsubscribe(m)
+		return
+	}
+	var result json.RawMessage
+	err := b.next.CallContext(b.ctx, &result, m.Method, rpcArgs(m.Params)...)
+	b.answer(m.ID, result, err)
+}
+
+func (b *rpcBridge) answer(id, result json.RawMessage, err error) {
+	a := rpcMessage{JSONRPC: "2.0", ID: id}
+	if err != nil {
+		a.Error = b.l.passOn(err, passedCall)
+	} else {
+		a.Result = orNull(result)
+	}
+	b.write(a)
+}
+
+// subscribe makes the subscription m asks for through next and forwards
+// its notifications under an ID of the bridge's own. A subscription
+// fails when the node's connection does, so the client is then cut off
+// with the error and reconnects.
+func (b *rpcBridge) subscribe(m rpcMessage) {
+	ch := make(chan json.RawMessage)
+	sub, err := b.next.Subscribe(b.ctx, "eth", ch, rpcArgs(m.Params)...)
+	if err != nil {
+		b.answer(m.ID, nil, err)
+		return
+	}
+	b.mu.Lock()
+	b.last++
+	id := hexutil.EncodeUint64(b.last)
+	b.subs[id] = sub
+	b.mu.Unlock()
+	b.answer(m.ID, json.RawMessage(strconv.Quote(id)), nil)
+	go func() {
+		for {
+			select {
+			case n := <-ch:
+				params, _ := json.Marshal(struct {
+					Subscription string          `json:"subscription"`
+					Result       json.RawMessage `json:"result"`
+				}{id, n})
+				b.write(rpcMessage{JSONRPC: "2.0", Method: "eth_subscription", Params: params})
+			case err := <-sub.Err():
+				b.mu.Lock()
+				delete(b.subs, id)
+				b.mu.Unlock()
+				if err != nil {
+					b.answers.CloseWithError(err)
+				}
+				return
+			}
+		}
+	}()
+}
+
+func (b *rpcBridge) unsubscribe(m rpcMessage) {
+	var ids []string
+	json.Unmarshal(m.Params, &ids)
+	var sub *rpc.ClientSubscription
+	if len(ids) > 0 {
+		b.mu.Lock()
+		sub = b.subs[ids[0]]
+		delete(b.subs, ids[0])
+		b.mu.Unlock()
+	}
+	if sub != nil {
+		sub.Unsubscribe()
+	}
+	b.answer(m.ID, json.RawMessage(strconv.FormatBool(sub != nil)), nil)
+}
+
+// write sends v, one or more messages, to the client.
+func (b *rpcBridge) write(v interface{}) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	b.wmu.Lock()
+	defer b.wmu.Unlock()
+	b.answers.Write(append(raw, '\n'))
+}
+
+// rpcArgs splits JSON-RPC params into arguments passed on as they are.
+func rpcArgs(params json.RawMessage) []interface{} {
+	var raws []json.RawMessage
+	if len(params) == 0 || json.Unmarshal(params, &raws) != nil {
+		return nil
+	}
+	args := make([]interface{}, len(raws))
+	for i, raw := range raws {
+		args[i] = raw
+	}
+	return args
+}
+
+// orNull is result, or JSON null when there is none.
+func orNull(result json.RawMessage) json.RawMessage {
+	if len(result) == 0 {
+		return json.RawMessage("null")
+	}
+	return result
+}
+
+// write appends x to the capture file, opening it on first use. Caller
+// holds l.mu.
+func (l *rpcLogger) write(x rpcExchange) {
+	if l.capture == "" || l.failed {
+		return
+	}
+	if l.file == nil {
+		f, err := os.Create(l.capture)
+		if err != nil {
+			l.ui.Warnf("warning: --rpc-capture: %v\n", err)
+			l.failed = true
+			return
+		}
+		l.file = f
+	}
+	line, err := json.Marshal(x)
+	if err == nil {
+		_, err = l.file.Write(append(line, '\n'))
+	}
+	if err != nil {
+		l.ui.Warnf("warning: --rpc-capture: %v\n", err)
+		l.failed = true
+	}
+}
+
+type rawMessage struct {
+	raw json.RawMessage
+	msg rpcMessage
+}
+
+// rpcMessages splits a JSON-RPC body into its messages, reporting whether
+// it was a batch.
+func rpcMessages(body []byte) ([]rawMessage, bool) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, false
+	}
+	var raws []json.RawMessage
+	batch := body[0] == '['
+	if !batch {
+		raws = []json.RawMessage{body}
+	} else if json.Unmarshal(body, &raws) != nil {
+		return nil, true
+	}
+	var out []rawMessage
+	for _, raw := range raws {
+		m := rawMessage{raw: raw}
+		d := json.NewDecoder(bytes.NewReader(raw))
+		d.UseNumber()
+		if d.Decode(&m.msg) == nil {
+			out = append(out, m)
+		}
+	}
+	return out, batch
+}
+
+// redacted stands in for a secret: its length, and nothing of it.
+func redacted(v interface{}) string {
+	s, _ := v.(string)
+	return fmt.Sprintf("[redacted %d chars]", len(s))
+}
+
+// redactRequest is a request with the secrets its params carry replaced:
+// signed transactions, which are bearer instruments until mined, and
+// private keys and passphrases.
+func redactRequest(r rawMessage) json.RawMessage {
+	var p []interface{}
+	d := json.NewDecoder(bytes.NewReader(r.msg.Params))
+	d.UseNumber()
+	if d.Decode(&p) != nil {
+		return r.raw
+	}
+	hide := func(i int) {
+		if i < len(p) {
+			p[i] = redacted(p[i])
+		}
+	}
+	hideFields := func(fields ...string) {
+		if len(p) == 0 {
+			return
+		}
+		m, ok := p[0].(map[string]interface{})
+		if !ok {
+			hide(0)
+			return
+		}
+		for _, f := range fields {
+			if v, ok := m[f]; ok {
+				m[f] = redacted(v)
+			}
+		}
+	}
+	switch r.msg.Method {
+	case "eth_sendRawTransaction", "eth_sendRawTransactionSync", "personal_newAccount":
+		hide(0)
+	case "personal_importRawKey":
+		hide(0)
+		hide(1)
+	case "eth_sendPrivateTransaction", "eth_sendPrivateRawTransaction":
+		hideFields("tx")
+	case "eth_sendBundle", "mev_sendBundle":
+		hideFields("txs", "body")
+	case "personal_unlockAccount", "personal_sendTransaction", "personal_signTransaction":
+		hide(1)
+	case "personal_sign":
+		hide(2)
+	default:
+		return r.raw
+	}
+	params, err := json.Marshal(p)
+	if err != nil {
+		return json.RawMessage(`"[redacted]"`)
+	}
+	r.msg.Params = params
+	raw, err := json.Marshal(r.msg)
+	if err != nil {
+		return json.RawMessage(`"[redacted]"`)
+	}
+	return raw
+}
+
+// redactResponse hides the signed transaction a signing method returns.
+func redactResponse(method string, raw json.RawMessage) json.RawMessage {
+	switch method {
+	case "eth_signTransaction", "account_signTransaction", "personal_signTransaction":
+	default:
+		return raw
+	}
+	var m map[string]interface{}
+	if json.Unmarshal(raw, &m) != nil {
+		return raw
+	}
+	switch result := m["result"].(type) {
+	case string:
+		m["result"] = redacted(result)
+	case map[string]interface{}:
+		if v, ok := result["raw"]; ok {
+			result["raw"] = redacted(v)
+		}
+	}
+	out, err := json.Marshal(m)
+	if err != nil {
+		return json.RawMessage(`"[redacted]"`)
+	}
+	return out
+}
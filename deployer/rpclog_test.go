@@ -0,0 +1,187 @@
+package deployer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// logDial connects to urls with the RPC log at level, capturing to the
+// returned file and printing through a logger writing to errw.
+func logDial(t *testing.T, level int, errw io.Writer, urls ...string) (*rpcClient, env, string) {
+	t.Helper()
+	e := newEnv(io.Discard, errw)
+	e.rpcLog.level = level
+	e.rpcLog.capture = filepath.Join(t.TempDir(), "calls.ndjson")
+	c, err := dial(t.Context(), e, urls, retryPolicy{attempts: 2, delay: time.Millisecond}, 0, batchPolicy{}, http.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c, e, e.rpcLog.capture
+}
+
+// captured reads a capture file.
+func captured(t *testing.T, path string) []rpcExchange {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var xs []rpcExchange
+	for _, line := range bytes.Split(bytes.TrimSpace(raw), []byte("\n")) {
+		var x rpcExchange
+		if err := json.Unmarshal(line, &x); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		xs = append(xs, x)
+	}
+	return xs
+}
+
+// TestRPCLogIPC checks that calls, batches and subscriptions over IPC
+// are logged and captured, and reach the node unchanged.
+func TestRPCLogIPC(t *testing.T) {
+	chain := newSimChain(t)
+	chain.Commit()
+	var log syncBuffer
+	c, e, capture := logDial(t, rpcLogDebug, &log, chain.rpc)
+
+	if n, err := c.BlockNumber(t.Context()); err != nil || n != 1 {
+		t.Fatalf("block number = %d, %v; want 1", n, err)
+	}
+	if _, err := c.TransactionReceipt(t.Context(), common.Hash{1}); !errors.Is(err, ethereum.NotFound) {
+		t.Fatalf("receipt of an unknown tx = %v, want NotFound", err)
+	}
+	balances := make([]hexutil.Big, 2)
+	batch := []rpc.BatchElem{
+		{Method: "eth_getBalance", Args: []interface{}{testAddr, "latest"}, Result: &balances[0]},
+		{Method: "eth_getBalance", Args: []interface{}{common.Address{}, "latest"}, Result: &balances[1]},
+	}
+	if err := c.Client.Client().BatchCallContext(t.Context(), batch); err != nil || batch[0].Error != nil {
+		t.Fatalf("batch = %v, %v", err, batch[0].Error)
+	}
+	if b := balances[0].ToInt(); b.Sign() == 0 {
+		t.Fatal("batch answered a zero balance for the funded account")
+	}
+
+	heads := make(chan *types.Header, 1)
+	sub, err := c.SubscribeNewHead(t.Context(), heads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.Commit()
+	select {
+	case h := <-heads:
+		if h.Number.Uint64() != 2 {
+			t.Fatalf("head %d, want 2", h.Number)
+		}
+	case err := <-sub.Err():
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no head through the logged subscription")
+	}
+	sub.Unsubscribe()
+	c.Close()
+	e.rpcLog.close()
+
+	out := log.String()
+	for _, want := range []string{" eth_blockNumber ", " eth_getTransactionReceipt ", " eth_getBalance ", " eth_subscribe ", "\n  -> {", "\n  <- {"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log lacks %q:\n%s", want, out)
+		}
+	}
+	methods := map[string]rpcExchange{}
+	for _, x := range captured(t, capture) {
+		methods[x.Method] = x
+	}
+	if x := methods["eth_getTransactionReceipt"]; string(x.Response) != `{"jsonrpc":"2.0","id":`+string(requestID(t, x))+`,"result":null}` {
+		t.Errorf("receipt captured as %s", x.Response)
+	}
+	if x := methods["eth_getBalance"]; x.Batch != 2 || x.Response == nil {
+		t.Errorf("balance captured as %+v, want a response in a batch of 2", x)
+	}
+	if _, ok := methods["eth_subscribe"]; !ok {
+		t.Errorf("subscription not captured: %v", methods)
+	}
+}
+
+// requestID is the ID of x's request.
+func requestID(t *testing.T, x rpcExchange) json.RawMessage {
+	var m rpcMessage
+	if err := json.Unmarshal(x.Request, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m.ID
+}
+
+// TestRPCLogOutput checks that the RPC log goes through the logger: as
+// JSON records with --log-format json, and not at all with --quiet,
+// while the capture still gets every call.
+func TestRPCLogOutput(t *testing.T) {
+	node := blockNumberNode(t)
+	var log bytes.Buffer
+	c, e, capture := logDial(t, rpcLogInfo, &log, node.url)
+	e.ui.setFormat(true)
+	log.Reset()
+	if _, err := c.BlockNumber(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	var rec struct {
+		Msg, Endpoint, Method string
+	}
+	if err := json.Unmarshal(log.Bytes(), &rec); err != nil || rec.Method != "eth_blockNumber" || rec.Endpoint != node.url {
+		t.Fatalf("log %q = %+v, %v; want one eth_blockNumber record", log.String(), rec, err)
+	}
+
+	log.Reset()
+	e.ui.level.Set(levelQuiet)
+	if _, err := c.BlockNumber(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if log.Len() != 0 {
+		t.Fatalf("--quiet printed %q", log.String())
+	}
+	e.rpcLog.close()
+	if xs := captured(t, capture); len(xs) != 3 || xs[2].Method != "eth_blockNumber" {
+		t.Fatalf("captured %+v, want eth_chainId and two eth_blockNumber", xs)
+	}
+}
+
+// TestRPCCaptureReplay replays a capture and captures the replay: the
+// same calls get the same answers, rate limits included.
+func TestRPCCaptureReplay(t *testing.T) {
+	const fixture = "testdata/rpc/rate-limited.ndjson"
+	node := replayNodes(t, fixture)[0]
+	c, e, capture := logDial(t, rpcLogOff, io.Discard, node.url)
+	c.policy = retryPolicy{attempts: 4, delay: time.Millisecond}
+	if _, err := c.BlockNumber(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.BlockNumber(t.Context()); !errors.Is(err, ErrRPCUnavailable) {
+		t.Fatalf("second block number = %v, want the rate limit", err)
+	}
+	e.rpcLog.close()
+	want, got := captured(t, fixture), captured(t, capture)
+	if len(got) != len(want) {
+		t.Fatalf("replay captured %d calls, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Method != want[i].Method || got[i].Status != want[i].Status || !bytes.Equal(got[i].Response, want[i].Response) {
+			t.Errorf("call %d captured as %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,510 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// safeABI is the part of the Safe (Gnosis Safe) multisig, v1.0.0 on,
+// that proposing and executing a transaction needs.
+const safeABI = `[
+{"type":"function","name":"nonce","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+{"type":"function","name":"getThreshold","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+{"type":"function","name":"getOwners","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"address[]"}]},
+{"type":"function","name":"VERSION","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+{"type":"function","name":"approvedHashes","stateMutability":"view","inputs":[{"name":"owner","type":"address"},{"name":"hash","type":"bytes32"}],"outputs":[{"name":"","type":"uint256"}]},
+{"type":"function","name":"getTransactionHash","stateMutability":"view","inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"},{"name":"data","type":"bytes"},{"name":"operation","type":"uint8"},{"name":"safeTxGas","type":"uint256"},{"name":"baseGas","type":"uint256"},{"name":"gasPrice","type":"uint256"},{"name":"gasToken","type":"address"},{"name":"refundReceiver","type":"address"},{"name":"_nonce","type":"uint256"}],"outputs":[{"name":"","type":"bytes32"}]},
+{"type":"function","name":"execTransaction","stateMutability":"payable","inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"},{"name":"data","type":"bytes"},{"name":"operation","type":"uint8"},{"name":"safeTxGas","type":"uint256"},{"name":"baseGas","type":"uint256"},{"name":"gasPrice","type":"uint256"},{"name":"gasToken","type":"address"},{"name":"refundReceiver","type":"address"},{"name":"signatures","type":"bytes"}],"outputs":[{"name":"success","type":"bool"}]},
+{"type":"event","name":"ExecutionSuccess","anonymous":false,"inputs":[{"name":"txHash","type":"bytes32","indexed":false},{"name":"payment","type":"uint256","indexed":false}]},
+{"type":"event","name":"ExecutionFailure","anonymous":false,"inputs":[{"name":"txHash","type":"bytes32","indexed":false},{"name":"payment","type":"uint256","indexed":false}]}
+]`
+
+var parsedSafe = func() abi.ABI {
+	a, err := abi.JSON(strings.NewReader(safeABI))
+	if err != nil {
+		panic(err)
+	}
+	return a
+}()
+
+// safeErrors explains the Safe's GSxxx revert codes a proposal or its
+// execution most often hits.
+var safeErrors = map[string]string{
+	"GS013": "the Safe transaction itself failed",
+	"GS020": "signatures data too short for the threshold",
+	"GS025": "an owner's approved-hash signature was never approved on chain",
+	"GS026": "a signature is not by an owner, or the signatures are not sorted by owner",
+}
+
+// safeTxType is the SafeTx struct the Safe's EIP-712 hash is over.
+var safeTxType = []apitypes.Type{
+	{Name: "to", Type: "address"},
+	{Name: "value", Type: "uint256"},
+	{Name: "data", Type: "bytes"},
+	{Name: "operation", Type: "uint8"},
+	{Name: "safeTxGas", Type: "uint256"},
+	{Name: "baseGas", Type: "uint256"},
+	{Name: "gasPrice", Type: "uint256"},
+	{Name: "gasToken", Type: "address"},
+	{Name: "refundReceiver", Type: "address"},
+	{Name: "nonce", Type: "uint256"},
+}
+
+// safeOptions turn a send into a Safe transaction: proposed to the Safe
+// Transaction Service, signed and printed, or executed with signatures
+// the owners collected.
+type safeOptions struct {
+	safe       string
+	service    string
+	nonce      int64
+	signOnly   bool
+	execute    bool
+	signatures string
+}
+
+func (o *safeOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.safe, "via-safe", "", "make the call a transaction of this Safe `address` and propose it instead of sending it")
+	fs.StringVar(&o.service, "safe-service", "", "Safe Transaction Service URL to propose to (default by chain ID)")
+	fs.Int64Var(&o.nonce, "safe-nonce", -1, "Safe nonce of the transaction, e.g. to queue it behind pending ones (default the Safe's nonce())")
+	fs.BoolVar(&o.signOnly, "safe-sign-only", false, "with --via-safe, print the Safe transaction hash and this key's signature instead of proposing")
+	fs.BoolVar(&o.execute, "execute", false, "with --via-safe, call execTransaction with --signatures instead of proposing")
+	fs.StringVar(&o.signatures, "signatures", "", "owners' signatures of the Safe transaction for --execute, comma-separated 0x hex")
+}
+
+// check rejects Safe flags that do not go together.
+func (o *safeOptions) check() error {
+	if o.safe == "" {
+		for name, set := range map[string]bool{"--safe-service": o.service != "", "--safe-nonce": o.nonce >= 0, "--safe-sign-only": o.signOnly, "--execute": o.execute, "--signatures": o.signatures != ""} {
+			if set {
+				return fmt.Errorf("%s requires --via-safe", name)
+			}
+		}
+		return nil
+	}
+	switch {
+	case o.execute && o.signOnly:
+		return errors.New("--execute and --safe-sign-only are exclusive")
+	case o.signatures != "" && !o.execute:
+		return errors.New("--signatures only applies to --execute")
+	case o.service != "" && (o.execute || o.signOnly):
+		return errors.New("--safe-service only applies to proposals, not --execute or --safe-sign-only")
+	}
+	return nil
+}
+
+// serviceFor returns the Safe Transaction Service for chainID.
+func (o *safeOptions) serviceFor(chainID *big.Int) (string, error) {
+	if o.service != "" {
+		return strings.TrimRight(o.service, "/"), nil
+	}
+	if u := chains[chainID.Uint64()].safeService; u != "" {
+		return u, nil
+	}
+	return "", fmt.Errorf("no known Safe Transaction Service for chain %s; pass --safe-service or set safe_service under [chains.%s], or --safe-sign-only to print the hash and signature for the owners to collect", chainID, chainID)
+}
+
+// safeAccount is a Safe as read from the chain.
+type safeAccount struct {
+	address   common.Address
+	version   string
+	owners    []common.Address
+	threshold uint64
+	nonce     *big.Int
+	service   string // where proposals go; "" when not proposing
+	bound     *bind.BoundContract
+}
+
+// call runs a view method of the Safe.
+func (sa *safeAccount) call(ctx context.Context, method string, args ...interface{}) ([]interface{}, error) {
+	var out []interface{}
+	if err := sa.bound.Call(&bind.CallOpts{Context: ctx}, &out, method, args...); err != nil {
+		return nil, fmt.Errorf("%s() on %s: %w", method, sa.address.Hex(), err)
+	}
+	return out, nil
+}
+
+// isOwner reports whether a is one of the Safe's owners.
+func (sa *safeAccount) isOwner(a common.Address) bool {
+	for _, o := range sa.owners {
+		if o == a {
+			return true
+		}
+	}
+	return false
+}
+
+// legacyDomain reports whether the Safe predates v1.3.0, whose EIP-712
+// domain has no chainId. An unreadable version is taken as current; the
+// hash is checked against getTransactionHash either way.
+func (sa *safeAccount) legacyDomain() bool {
+	parts := strings.SplitN(sa.version, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	major, err1 := strconv.Atoi(parts[0])
+	minor, err2 := strconv.Atoi(parts[1])
+	return err1 == nil && err2 == nil && (major == 0 || major == 1 && minor < 3)
+}
+
+// loadSafe reads the Safe --via-safe names: its owners, threshold,
+// version and the nonce the transaction gets. Proposals need a service,
+// which is looked up first so nothing is signed or deployed in vain.
+func (s *session) loadSafe(ctx context.Context, so safeOptions) (*safeAccount, error) {
+	address, err := parseAddress(so.safe)
+	if err != nil {
+		return nil, fmt.Errorf("--via-safe: %w", err)
+	}
+	sa := &safeAccount{address: address, bound: bind.NewBoundContract(address, parsedSafe, s.client, s.client, s.client)}
+	if !so.execute && !so.signOnly {
+		if sa.service, err = so.serviceFor(s.chainID); err != nil {
+			return nil, err
+		}
+	}
+	code, err := s.client.CodeAt(ctx, address, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get code at %s: %w", address.Hex(), err)
+	}
+	if len(code) == 0 {
+		return nil, fmt.Errorf("--via-safe: no contract at %s", address.Hex())
+	}
+	out, err := sa.call(ctx, "getOwners")
+	if err != nil {
+		return nil, fmt.Errorf("%s does not look like a Safe: %w", address.Hex(), err)
+	}
+	sa.owners = out[0].([]common.Address)
+	if out, err = sa.call(ctx, "getThreshold"); err != nil {
+		return nil, err
+	}
+	sa.threshold = out[0].(*big.Int).Uint64()
+	if sa.threshold == 0 || len(sa.owners) == 0 {
+		return nil, fmt.Errorf("%s has no owners or threshold; is it a Safe that was never set up?", address.Hex())
+	}
+	if out, err := sa.call(ctx, "VERSION"); err == nil {
+		sa.version = out[0].(string)
+	}
+	if out, err = sa.call(ctx, "nonce"); err != nil {
+		return nil, err
+	}
+	sa.nonce = out[0].(*big.Int)
+	if so.nonce >= 0 {
+		want := big.NewInt(so.nonce)
+		if want.Cmp(sa.nonce) < 0 {
+			return nil, fmt.Errorf("--safe-nonce %d is already used: the Safe is at nonce %s", so.nonce, sa.nonce)
+		}
+		if so.execute && want.Cmp(sa.nonce) != 0 {
+			return nil, fmt.Errorf("--safe-nonce %d cannot be executed yet: the Safe is at nonce %s", so.nonce, sa.nonce)
+		}
+		sa.nonce = want
+	}
+	version := sa.version
+	if version == "" {
+		version = "unknown version"
+	}
+	s.ui.Printf("Safe %s (%s, %d of %d owners)\n", s.names.label(address), version, sa.threshold, len(sa.owners))
+	return sa, nil
+}
+
+// safeTx is a Safe transaction: a plain call, with no gas refund.
+type safeTx struct {
+	to    common.Address
+	value *big.Int
+	data  []byte
+	nonce *big.Int
+}
+
+// hash returns tx's SafeTx hash, the digest the owners sign, and checks
+// it against the Safe's own getTransactionHash.
+func (sa *safeAccount) hash(ctx context.Context, chainID *big.Int, tx safeTx) (common.Hash, error) {
+	domain := []apitypes.Type{{Name: "chainId", Type: "uint256"}, {Name: "verifyingContract", Type: "address"}}
+	td := apitypes.TypedData{
+		PrimaryType: "SafeTx",
+		Domain:      apitypes.TypedDataDomain{ChainId: (*math.HexOrDecimal256)(chainID), VerifyingContract: sa.address.Hex()},
+		Message: apitypes.TypedDataMessage{
+			"to": tx.to.Hex(), "value": tx.value.String(), "data": hexutil.Encode(tx.data), "operation": "0",
+			"safeTxGas": "0", "baseGas": "0", "gasPrice": "0",
+			"gasToken": common.Address{}.Hex(), "refundReceiver": common.Address{}.Hex(), "nonce": tx.nonce.String(),
+		},
+	}
+	if sa.legacyDomain() {
+		domain, td.Domain.ChainId = domain[1:], nil
+	}
+	td.Types = apitypes.Types{"EIP712Domain": domain, "SafeTx": safeTxType}
+	digest, _, err := apitypes.TypedDataAndHash(td)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("Safe transaction hash: %w", err)
+	}
+	hash := common.BytesToHash(digest)
+	out, err := sa.call(ctx, "getTransactionHash", tx.to, tx.value, tx.data, uint8(0), common.Big0, common.Big0, common.Big0, common.Address{}, common.Address{}, tx.nonce)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if onchain := common.Hash(out[0].([32]byte)); onchain != hash {
+		return common.Hash{}, fmt.Errorf("Safe transaction hash mismatch: computed %s, %s says %s; its version %q may use another layout", hash.Hex(), sa.address.Hex(), onchain.Hex(), sa.version)
+	}
+	return hash, nil
+}
+
+// viaSafe makes m with args, sent to to with value, a transaction of sa:
+// proposed to the service, printed with this key's signature, or with
+// --execute executed. The receipt and its events are only returned when
+// it was executed and mined.
+func (s *session) viaSafe(ctx context.Context, sa *safeAccount, so safeOptions, txo txOptions, to common.Address, value *big.Int, m *abi.Method, args []interface{}, contractABI *abi.ABI) (*types.Receipt, []decodedEvent, error) {
+	data, err := contractABI.Pack(m.Name, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encode %s: %w", m.Sig, err)
+	}
+	if value == nil {
+		value = new(big.Int)
+	}
+	// The Safe makes the call, so it is simulated from the Safe: a
+	// proposal that reverts would only waste the owners' signatures.
+	if _, err := s.client.CallContract(ctx, ethereum.CallMsg{From: sa.address, To: &to, Value: value, Data: data}, nil); err != nil {
+		return nil, nil, fmt.Errorf("%s from the Safe would revert: %w", m.Sig, explainError(err, contractABI))
+	}
+	tx := safeTx{to: to, value: value, data: data, nonce: sa.nonce}
+	hash, err := sa.hash(ctx, s.chainID, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.ui.Printf("  to:           %s\n", s.names.label(to))
+	s.ui.Printf("  call:         %s\n", methodSummary(to, m, args).call)
+	s.ui.Printf("  value:        %s ETH\n", formatEther(value))
+	s.ui.Printf("  Safe nonce:   %s\n", tx.nonce)
+	s.ui.Printf("  Safe tx hash: %s\n", hash.Hex())
+	report := &SafeReport{
+		Safe: sa.address, Version: sa.version, Threshold: sa.threshold, Owners: sa.owners,
+		To: to, Value: value.String(), Data: hexutil.Encode(data), Nonce: tx.nonce.String(), SafeTxHash: hash,
+	}
+	s.ui.report.Safe = report
+
+	if so.execute {
+		return s.execSafe(ctx, sa, so, txo, tx, hash, contractABI)
+	}
+
+	if !sa.isOwner(s.from) {
+		return nil, nil, fmt.Errorf("the signer %s is not an owner of the Safe %s, so its signature would not count", s.from.Hex(), sa.address.Hex())
+	}
+	if s.chainID.Uint64() != localChainID && !s.yes {
+		if err := askConfirm(os.Stdin, isTerminal(os.Stdin)); err != nil {
+			return nil, nil, err
+		}
+	}
+	sig, err := s.signer.SignHash(hash[:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("sign Safe transaction: %w", err)
+	}
+	sig[64] += 27
+	report.Sender, report.Signature = &s.from, hexutil.Encode(sig)
+	s.ui.Printf("  signed by:    %s\n", s.from.Hex())
+	s.ui.Printf("  signature:    %s\n", report.Signature)
+	if so.signOnly {
+		s.ui.Printf("Collect %d owner signatures of %s, then execute with --execute --signatures <sig,...>\n", sa.threshold, hash.Hex())
+		return nil, nil, nil
+	}
+	if err := proposeSafeTx(ctx, sa, tx, hash, s.from, sig); err != nil {
+		return nil, nil, err
+	}
+	report.Service = sa.service
+	s.ui.Printf("Proposed to %s with 1 of the %d signatures needed; the other owners confirm it in the Safe app\n", sa.service, sa.threshold)
+	return nil, nil, nil
+}
+
+// proposeSafeTx posts tx, signed by sender, to sa's Transaction Service
+// so the other owners see it in the Safe app. SAFE_API_KEY, when set, is
+// sent for services that require one.
+func proposeSafeTx(ctx context.Context, sa *safeAccount, tx safeTx, hash common.Hash, sender common.Address, sig []byte) error {
+	var data interface{}
+	if len(tx.data) > 0 {
+		data = hexutil.Encode(tx.data)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"to": tx.to.Hex(), "value": tx.value.String(), "data": data, "operation": 0,
+		"safeTxGas": "0", "baseGas": "0", "gasPrice": "0",
+		"gasToken": common.Address{}.Hex(), "refundReceiver": common.Address{}.Hex(),
+		"nonce": tx.nonce, "contractTransactionHash": hash.Hex(),
+		"sender": sender.Hex(), "signature": hexutil.Encode(sig), "origin": "nyc2025",
+	})
+	if err != nil {
+		return err
+	}
+	url := sa.service + "/api/v1/safes/" + sa.address.Hex() + "/multisig-transactions/"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key := os.Getenv("SAFE_API_KEY"); key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return fmt.Errorf("propose to %s: %w", sa.service, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		return fmt.Errorf("propose to %s: %s: %s", sa.service, resp.Status, strings.TrimSpace(string(raw)))
+	}
+	return nil
+}
+
+// safeSignature is one owner's signature in execTransaction's format.
+type safeSignature struct {
+	owner common.Address
+	sig   []byte
+}
+
+// parseSafeSignatures splits --signatures into 65-byte signatures. Each
+// entry may hold several, concatenated as the Safe app exports them.
+func parseSafeSignatures(list string) ([][]byte, error) {
+	var sigs [][]byte
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		b, err := hexutil.Decode(entry)
+		if err != nil || len(b) == 0 || len(b)%crypto.SignatureLength != 0 {
+			return nil, fmt.Errorf("--signatures: %q is not 0x hex of 65-byte signatures", entry)
+		}
+		for ; len(b) > 0; b = b[crypto.SignatureLength:] {
+			sigs = append(sigs, b[:crypto.SignatureLength])
+		}
+	}
+	return sigs, nil
+}
+
+// ownerSignature works out which owner signed hash with sig: an ECDSA
+// signature (v 27/28), an eth_sign one (v 31/32), or an approved-hash
+// one (v 1) whose owner must have called approveHash or be the sender.
+func (s *session) ownerSignature(ctx context.Context, sa *safeAccount, hash common.Hash, sig []byte) (safeSignature, error) {
+	switch v := sig[64]; {
+	case v == 0:
+		return safeSignature{}, errors.New("contract (EIP-1271) signatures are not supported")
+	case v == 1:
+		owner := common.BytesToAddress(sig[:32])
+		if owner != s.from {
+			out, err := sa.call(ctx, "approvedHashes", owner, hash)
+			if err != nil {
+				return safeSignature{}, err
+			}
+			if out[0].(*big.Int).Sign() == 0 {
+				return safeSignature{}, fmt.Errorf("%s has not approved %s on chain", owner.Hex(), hash.Hex())
+			}
+		}
+		return safeSignature{owner, sig}, nil
+	case v > 30:
+		rsv := common.CopyBytes(sig)
+		rsv[64] -= 4
+		owner, _, err := recoverSigner(accounts.TextHash(hash[:]), rsv)
+		return safeSignature{owner, sig}, err
+	default:
+		owner, rsv, err := recoverSigner(hash[:], sig)
+		return safeSignature{owner, rsv}, err
+	}
+}
+
+// execSafe executes tx with the --signatures and, when the sender is an
+// owner, its approval, which execTransaction counts without a signature.
+func (s *session) execSafe(ctx context.Context, sa *safeAccount, so safeOptions, txo txOptions, tx safeTx, hash common.Hash, contractABI *abi.ABI) (*types.Receipt, []decodedEvent, error) {
+	raw, err := parseSafeSignatures(so.signatures)
+	if err != nil {
+		return nil, nil, err
+	}
+	var sigs []safeSignature
+	seen := map[common.Address]bool{}
+	for i, sig := range raw {
+		ss, err := s.ownerSignature(ctx, sa, hash, sig)
+		if err != nil {
+			return nil, nil, fmt.Errorf("--signatures: signature %d: %w", i+1, err)
+		}
+		if !sa.isOwner(ss.owner) {
+			return nil, nil, fmt.Errorf("--signatures: signature %d is by %s, not an owner of the Safe; was it made for another transaction or nonce?", i+1, ss.owner.Hex())
+		}
+		if seen[ss.owner] {
+			s.ui.Warnf("warning: --signatures: ignoring a second signature by %s\n", ss.owner.Hex())
+			continue
+		}
+		seen[ss.owner] = true
+		sigs = append(sigs, ss)
+		s.ui.Printf("  signature by %s\n", ss.owner.Hex())
+	}
+	if uint64(len(sigs)) < sa.threshold && sa.isOwner(s.from) && !seen[s.from] {
+		approval := append(common.LeftPadBytes(s.from.Bytes(), 32), make([]byte, 33)...)
+		approval[64] = 1
+		sigs = append(sigs, safeSignature{s.from, approval})
+		s.ui.Printf("  approved by the sender %s\n", s.from.Hex())
+	}
+	if uint64(len(sigs)) < sa.threshold {
+		return nil, nil, fmt.Errorf("%d of the %d owner signatures the Safe requires; collect more with --safe-sign-only", len(sigs), sa.threshold)
+	}
+	// The Safe wants the signatures in ascending owner order.
+	sort.Slice(sigs, func(i, j int) bool { return bytes.Compare(sigs[i].owner[:], sigs[j].owner[:]) < 0 })
+	var packed []byte
+	for _, ss := range sigs {
+		packed = append(packed, ss.sig...)
+	}
+
+	execABI := parsedSafe
+	execABI.Events = map[string]abi.Event{}
+	execABI.Errors = map[string]abi.Error{}
+	mergeEvents(&execABI, &parsedSafe)
+	mergeEvents(&execABI, contractABI)
+	m := execABI.Methods["execTransaction"]
+	bound := bind.NewBoundContract(sa.address, execABI, s.client, s.client, s.client)
+	args := []interface{}{tx.to, tx.value, tx.data, uint8(0), common.Big0, common.Big0, common.Big0, common.Address{}, common.Address{}, packed}
+	txo.value, txo.forceValue = "", false
+	sent, err := s.transact(ctx, bound, &execABI, &m, args, txo)
+	if err != nil {
+		return nil, nil, safeReason(err)
+	}
+	if txo.noWait {
+		return nil, nil, nil
+	}
+	rcpt, err := s.waitReceipt(ctx, sent, &execABI)
+	if err != nil {
+		return nil, nil, safeReason(err)
+	}
+	events := printEvents(s.ui, rcpt, &execABI)
+	for _, l := range rcpt.Logs {
+		if l.Address == sa.address && len(l.Topics) > 0 && l.Topics[0] == parsedSafe.Events["ExecutionFailure"].ID {
+			return rcpt, events, fmt.Errorf("tx %s mined, but the Safe transaction %s failed (ExecutionFailure)", rcpt.TxHash.Hex(), hash.Hex())
+		}
+	}
+	s.ui.report.Safe.Executed = true
+	s.ui.Printf("Executed Safe transaction %s\n", hash.Hex())
+	return rcpt, events, nil
+}
+
+// safeReason adds what a GSxxx revert code in err means.
+func safeReason(err error) error {
+	for code, meaning := range safeErrors {
+		if strings.Contains(err.Error(), code) {
+			return fmt.Errorf("%w (%s: %s)", err, code, meaning)
+		}
+	}
+	return err
+}
@@ -0,0 +1,251 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// txOptions are per-transaction overrides for state-changing calls.
+type txOptions struct {
+	value      string
+	forceValue bool
+	gasLimit   uint64
+	nonce      int64
+	noWait     bool
+	dryRun     bool
+
+	// overrides replace account state for a dry run's simulation.
+	overrides stateOverrides
+
+	// fees, when set, replace the session's fee overrides for this
+	// transaction only.
+	fees feeOverrides
+}
+
+func (o *txOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.value, "value", "", "ether to send to a payable function, e.g. 1000wei, 2gwei, 0.1ether")
+	fs.BoolVar(&o.forceValue, "force-value", false, "send --value even to a function the ABI marks non-payable, e.g. through a proxy's fallback")
+	fs.Uint64Var(&o.gasLimit, "gas-limit", 0, "exact gas limit (default padded estimate)")
+	fs.Int64Var(&o.nonce, "nonce", -1, "nonce override (default pending nonce)")
+	fs.BoolVar(&o.noWait, "no-wait", false, "print the transaction hash and exit without waiting")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "simulate the call and print its result and cost without sending")
+	fs.Var(&o.overrides, "override", "with --dry-run, simulate with an account's state replaced: addr:balance=...,nonce=...,code=0x...,state[slot]=value (repeatable)")
+}
+
+// checkPayable refuses a --value for m, which what names, unless the ABI
+// marks it payable: anything else reverts when sent ether. --force-value
+// allows it for calls that a proxy or fallback handles instead.
+func checkPayable(what string, m *abi.Method, txo txOptions) error {
+	if txo.forceValue || m.IsPayable() {
+		return nil
+	}
+	value, err := parseValue(txo.value)
+	if err != nil || value == nil || value.Sign() == 0 {
+		return nil // a bad --value is reported where it is parsed
+	}
+	return fmt.Errorf("--value %s: %s is not payable in the ABI, so sending ether reverts; pass --force-value if it does accept ether (e.g. through a proxy's fallback)", txo.value, what)
+}
+
+// opts returns a copy of the session's transact opts with fees refreshed
+// and the overrides in txo applied.
+func (s *session) opts(ctx context.Context, txo txOptions) (*bind.TransactOpts, error) {
+	if len(txo.overrides) > 0 && !txo.dryRun {
+		return nil, errors.New("--override only applies to --dry-run")
+	}
+	// Fees go on the copy only: s.auth is shared by every transaction
+	// the session sends.
+	opts := *s.auth
+	fo := s.fees
+	if txo.fees.MaxFee != nil {
+		fo.MaxFee = txo.fees.MaxFee
+	}
+	if txo.fees.PriorityFee != nil {
+		fo.PriorityFee = txo.fees.PriorityFee
+	}
+	if err := applyFees(ctx, s.client, &opts, fo); err != nil {
+		return nil, fmt.Errorf("fees: %w", err)
+	}
+	value, err := parseValue(txo.value)
+	if err != nil {
+		return nil, fmt.Errorf("--value: %w", err)
+	}
+	opts.Value = value
+	opts.GasLimit = txo.gasLimit
+	if txo.nonce >= 0 {
+		opts.Nonce = big.NewInt(txo.nonce)
+	}
+	return &opts, nil
+}
+
+// transact sends m with args to bound's contract.
+func (s *session) transact(ctx context.Context, bound *bind.BoundContract, contractABI *abi.ABI, m *abi.Method, args []interface{}, txo txOptions) (*types.Transaction, error) {
+	if err := checkPayable(m.Sig, m, txo); err != nil {
+		return nil, err
+	}
+	opts, err := s.opts(ctx, txo)
+	if err != nil {
+		return nil, err
+	}
+	data, err := contractABI.Pack(m.Name, args...)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s: %w", m.Sig, err)
+	}
+	to := bound.Address()
+	if err := s.setGasLimit(ctx, opts, ethereum.CallMsg{To: &to, Data: data}, contractABI); err != nil {
+		return nil, fmt.Errorf("%s tx: %w", m.Sig, err)
+	}
+	sum := methodSummary(to, m, args)
+	tx, err := s.submit(ctx, opts, sum, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return bound.Transact(opts, m.Name, args...)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s tx: %w", m.Sig, explainError(err, contractABI))
+	}
+	s.ui.Printf("%s tx: %s (type %d)\n", m.RawName, tx.Hash().Hex(), tx.Type())
+	s.ui.link("tx", tx.Hash().Hex())
+	s.ui.Verbosef("  nonce %d, gas limit %d\n", tx.Nonce(), tx.Gas())
+	return tx, nil
+}
+
+// waitReceipt waits for tx, prints its outcome and fails with the decoded
+// revert reason when it reverted.
+func (s *session) waitReceipt(ctx context.Context, tx *types.Transaction, contractABI *abi.ABI) (*types.Receipt, error) {
+	rcpt, err := s.waitMined(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	s.ui.Printf("  status %d, block %s, gas used %d\n", rcpt.Status, rcpt.BlockNumber, rcpt.GasUsed)
+	if rcpt.EffectiveGasPrice != nil {
+		s.ui.Verbosef("  effective gas price %s wei\n", rcpt.EffectiveGasPrice)
+	}
+	if rcpt.Status != 1 {
+		reason := failureReason(ctx, s.client, tx, rcpt, contractABI)
+		err := &RevertError{TxHash: tx.Hash(), Reason: reason, msg: fmt.Sprintf("tx %s reverted: %s", tx.Hash().Hex(), reason)}
+		return rcpt, withField(err, "tx", tx.Hash().Hex())
+	}
+	return rcpt, nil
+}
+
+// runSend implements `send [flags] <address> <function> [args...]`.
+func runSend(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	var txo txOptions
+	var oo offlineOptions
+	o.register(fs)
+	ao.register(fs, "")
+	txo.register(fs)
+	oo.register(fs)
+	var abo abiOptions
+	abo.register(fs)
+	var so safeOptions
+	so.register(fs)
+	argsJSON := fs.String("args", "", "function arguments as a JSON array")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		return errors.New("usage: send [flags] <address> <function> [args...]")
+	}
+	if err := so.check(); err != nil {
+		return err
+	}
+	if so.safe != "" && (oo.enabled || txo.dryRun) {
+		return errors.New("--via-safe does not combine with --offline or --dry-run; the Safe's call is simulated before it is signed")
+	}
+	address, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	// Offline signing has no node: no explorer ABI, and no session.
+	var s *session
+	var client *rpcClient
+	var chainID *big.Int
+	if oo.enabled {
+		if abo.fromExplorer {
+			return errors.New("--abi-from-explorer does not apply to --offline; pass --abi <file>")
+		}
+	} else {
+		if s, err = openSession(ctx, &o); err != nil {
+			return err
+		}
+		defer s.Close()
+		client, chainID = s.client, s.chainID
+	}
+	c, err := abo.contractABI(ctx, ao, client, chainID, address)
+	if err != nil {
+		return err
+	}
+	m, err := resolveMethod(&c.ABI, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	raw, err := rawArgs(fs.Args()[2:], *argsJSON)
+	if err != nil {
+		return err
+	}
+	sendArgs, err := convertArgs(m.Inputs, raw)
+	if err != nil {
+		return fmt.Errorf("%s: %w", m.Sig, err)
+	}
+	if oo.enabled {
+		if err := checkPayable(m.Sig, m, txo); err != nil {
+			return err
+		}
+		data, err := c.ABI.Pack(m.Name, sendArgs...)
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", m.Sig, err)
+		}
+		_, err = signOffline(&o, oo, txo, &address, data)
+		return err
+	}
+
+	if so.safe != "" {
+		if err := checkPayable(m.Sig, m, txo); err != nil {
+			return err
+		}
+		value, err := parseValue(txo.value)
+		if err != nil {
+			return fmt.Errorf("--value: %w", err)
+		}
+		sa, err := s.loadSafe(ctx, so)
+		if err != nil {
+			return err
+		}
+		rcpt, events, err := s.viaSafe(ctx, sa, so, txo, address, value, m, sendArgs, &c.ABI)
+		if err != nil || rcpt == nil {
+			return err
+		}
+		ui.report.Transactions = append(ui.report.Transactions, *newTxReport("execTransaction", rcpt, events))
+		return nil
+	}
+
+	if txo.dryRun {
+		return s.dryRunSend(ctx, address, &c.ABI, m, sendArgs, txo)
+	}
+
+	bound := bind.NewBoundContract(address, c.ABI, s.client, s.client, s.client)
+	tx, err := s.transact(ctx, bound, &c.ABI, m, sendArgs, txo)
+	if err != nil {
+		return err
+	}
+	if txo.noWait {
+		return nil
+	}
+	rcpt, err := s.waitReceipt(ctx, tx, &c.ABI)
+	if err != nil {
+		return err
+	}
+	ui.report.Transactions = append(ui.report.Transactions, *newTxReport(m.Sig, rcpt, printEvents(ui, rcpt, &c.ABI)))
+	return nil
+}
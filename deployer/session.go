@@ -0,0 +1,629 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// env is what a run prints through and reports to: the logger, the ENS
+// names addresses are labelled with, the webhook notifier, the RPC traffic
+// log and the metrics. The CLI's commands share cli; each library Client
+// has its own, so Clients do not print through or record into each other.
+type env struct {
+	ui      *logger
+	names   *nameResolver
+	notify  *notifier
+	rpcLog  *rpcLogger
+	metrics *metrics
+}
+
+// newEnv returns an env printing results to out and progress and
+// warnings to errw.
+func newEnv(out, errw io.Writer) env {
+	l := newLogger(out, errw)
+	return env{
+		ui:      l,
+		names:   &nameResolver{ui: l},
+		notify:  &notifier{ui: l, format: "json"},
+		rpcLog:  &rpcLogger{ui: l},
+		metrics: newMetrics(),
+	}
+}
+
+// cli is the process-wide env of the commands.
+var cli = newEnv(os.Stdout, os.Stderr)
+
+// options are the connection and fee flags shared by every command.
+type options struct {
+	env
+	config         string
+	profile        string
+	chain          string
+	rpc            urlList
+	rpcTimeout     time.Duration
+	rpcHeaders     http.Header       // --rpc-header
+	profileHeaders map[string]string // rpc_headers of the profile
+	expectChainID  uint64
+	maxFee         string
+	priorityFee    string
+	keys           KeyOptions
+	deployments    string
+	confirmations  uint64
+	rebroadcasts   int
+	pollInterval   time.Duration
+	pollSet        bool // --poll-interval was given, so block times do not tune it
+	waitTimeout    time.Duration
+	progressEvery  time.Duration
+	retry          retryPolicy
+	batch          batchPolicy
+	bump           bumpPolicy
+	gas            gasPolicy
+	preflight      preflightOptions
+	yes            bool
+	anvil          anvilOptions
+	gasReportOut   string
+	broadcastDir   string
+	journalDir     string
+	price          priceOptions
+	accessLists    accessListPolicy
+	feeHistory     feeHistoryOptions
+	explorer       string
+	relay          relayOptions
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.config, "config", "", "config file with named profiles (default "+defaultConfigPath+")")
+	fs.StringVar(&o.profile, "profile", "", "config profile to use, e.g. sepolia")
+	fs.StringVar(&o.chain, "chain", "", "chain to use by `name` or ID, e.g. base-sepolia: its public RPCs unless --rpc is given, and its chain ID as --expect-chain-id (see chains list)")
+	fs.Var(&o.rpc, "rpc", "JSON-RPC endpoint: an http(s):// or ws(s):// URL, or the path of an IPC socket; repeat or comma-separate for failover (overrides RPC_URLS/RPC_URL; default "+defaultRPC+")")
+	fs.Func("rpc-header", "send this `\"Name: value\"` header to every RPC endpoint, WebSocket handshakes included; repeatable", func(v string) error {
+		name, value, ok := strings.Cut(v, ":")
+		if name = strings.TrimSpace(name); !ok || name == "" {
+			return errors.New(`want "Name: value"`)
+		}
+		if o.rpcHeaders == nil {
+			o.rpcHeaders = http.Header{}
+		}
+		o.rpcHeaders.Add(name, strings.TrimSpace(value))
+		return nil
+	})
+	fs.DurationVar(&o.rpcTimeout, "rpc-timeout", 30*time.Second, "give up on a single RPC request after this long (0 disables)")
+	fs.Uint64Var(&o.expectChainID, "expect-chain-id", 0, "abort unless the node reports this chain ID")
+	fs.StringVar(&o.explorer, "explorer-url", "", "block explorer to print transaction and contract links for, e.g. https://explorer.example.org, or a template such as https://scan.example.org/{chain}/{kind}/{id} (default by chain ID)")
+	fs.StringVar(&o.maxFee, "max-fee", "", "max fee per gas, e.g. 30gwei (gas price on legacy chains)")
+	fs.StringVar(&o.priorityFee, "priority-fee", "", "max priority fee per gas, e.g. 2gwei")
+	o.feeHistory.register(fs)
+	o.keys.register(fs)
+	if o.ui == nil {
+		o.env = cli
+	}
+	o.ui.register(fs)
+	o.names.register(fs, o)
+	o.notify.register(fs)
+	o.rpcLog.register(fs)
+	fs.StringVar(&o.deployments, "deployments-dir", "deployments", "directory holding deployment manifests")
+	fs.Uint64Var(&o.confirmations, "confirmations", 1, "blocks a transaction must be buried under before it counts as final")
+	fs.IntVar(&o.rebroadcasts, "reorg-rebroadcasts", 3, "times to send a transaction again after reorgs drop it (0 only waits)")
+	fs.DurationVar(&o.pollInterval, "poll-interval", defaultPollInterval, "how often to poll for receipts and new blocks, e.g. 100ms on Anvil")
+	fs.DurationVar(&o.waitTimeout, "wait-timeout", 0, "give up waiting for a receipt after this long (0 waits until interrupted)")
+	fs.DurationVar(&o.progressEvery, "progress-every", defaultProgressEvery, "while waiting for a receipt, report progress this often (0 disables)")
+	o.retry.register(fs)
+	o.batch.register(fs)
+	o.bump.register(fs)
+	o.gas.register(fs)
+	o.preflight.register(fs)
+	fs.BoolVar(&o.yes, "yes", false, "sign without showing the transaction summary prompt (it is never shown on chain 31337)")
+	o.anvil.register(fs)
+	fs.StringVar(&o.gasReportOut, "gas-report-out", "", "also write the run's gas report as JSON to this file")
+	fs.StringVar(&o.broadcastDir, "broadcast-dir", "broadcast", "directory to write each run's transactions and receipts to in forge script's broadcast format (empty disables)")
+	fs.StringVar(&o.journalDir, "journal-dir", ".nyc2025", "directory of the per-chain journal every transaction is written to before it is sent, for `journal resume` after a crash (empty disables)")
+	o.price.register(fs)
+	o.accessLists.register(fs)
+	o.relay.register(fs)
+}
+
+// session is a connected client plus the signer and fee policy used for
+// every transaction in a run.
+type session struct {
+	env
+	client          *rpcClient
+	chainID         *big.Int
+	signer          *Signer
+	from            common.Address
+	auth            *bind.TransactOpts
+	fees            feeOverrides
+	nonces          *NonceManager
+	bump            bumpPolicy
+	gas             gasPolicy
+	preflightChecks preflightOptions
+	yes             bool
+	stdin           io.Reader // answers confirmSend; nil asks the terminal on os.Stdin
+	gasLog          *gasLog
+	broadcast       *broadcastLog
+	price           *ethPrice
+	accessLists     accessListPolicy
+
+	// opStack is set on chains that charge an L1 data fee; pendingL1Fee
+	// is that fee for the transaction being prepared, from setGasLimit
+	// until it is confirmed.
+	opStack      bool
+	pendingL1Fee *big.Int
+
+	confirmations uint64
+	rebroadcasts  int
+	pollInterval  time.Duration
+	waitTimeout   time.Duration
+	progressEvery time.Duration
+
+	journal *journal
+
+	// sendLock, if set, is held by whoever is using the session and
+	// released while a transaction is waited for, so `run --parallel`
+	// steps send one at a time but wait together.
+	sendLock sync.Locker
+}
+
+// headers are the headers sent to the RPC endpoints. Precedence is the
+// usual flags > env > profile: --rpc-header beats RPC_BEARER_TOKEN, which
+// beats the profile's rpc_headers.
+func (o *options) headers() http.Header {
+	h := http.Header{}
+	for name, value := range o.profileHeaders {
+		h.Set(name, value)
+	}
+	if token := strings.TrimSpace(os.Getenv("RPC_BEARER_TOKEN")); token != "" {
+		h.Set("Authorization", "Bearer "+token)
+	}
+	for name, values := range o.rpcHeaders {
+		h[name] = values
+	}
+	return h
+}
+
+// connect dials the node and verifies its chain ID; commands that never
+// sign use it directly.
+func connect(ctx context.Context, o *options) (*rpcClient, *big.Int, error) {
+	var node *anvilProcess
+	var urls []string
+	var err error
+	if o.anvil.auto {
+		if node, err = startAnvil(ctx, o.anvil); err != nil {
+			return nil, nil, err
+		}
+		urls = []string{node.url}
+	} else if urls, err = resolveRPC(o.rpc); err != nil {
+		return nil, nil, err
+	}
+	if err := checkExplorer(o.explorer); err != nil {
+		return nil, nil, fmt.Errorf("--explorer-url: %w", err)
+	}
+	o.ui.with("endpoint", redactURL(urls[0]))
+	client, err := dial(ctx, o.env, urls, o.retry, o.rpcTimeout, o.batch, o.headers())
+	if err != nil {
+		if node != nil {
+			node.stop()
+		}
+		return nil, nil, err
+	}
+	if node != nil {
+		client.cleanup = node.stop
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("chain id: %w", err)
+	}
+	o.ui.Println("Connected. ChainID:", describeChain(chainID))
+	o.ui.Verbosef("  endpoints: %s\n", strings.Join(redactURLs(urls), ", "))
+	o.ui.setChain(chainID, o.explorer)
+	o.names.use(client, chainID)
+	if err := checkChainID(chainID, o.expectChainID); err != nil {
+		client.Close()
+		if o.chain != "" {
+			return nil, nil, fmt.Errorf("--chain %s: %w; is the RPC endpoint on another network?", o.chain, err)
+		}
+		if o.profile != "" {
+			return nil, nil, fmt.Errorf("profile %s: %w", o.profile, err)
+		}
+		return nil, nil, err
+	}
+	return client, chainID, nil
+}
+
+// newSession takes the fee, gas and wait settings from o; the session is
+// not connected yet.
+func newSession(o *options) (*session, error) {
+	s := &session{
+		env:             o.env,
+		confirmations:   o.confirmations,
+		rebroadcasts:    o.rebroadcasts,
+		pollInterval:    o.pollInterval,
+		waitTimeout:     o.waitTimeout,
+		progressEvery:   o.progressEvery,
+		bump:            o.bump,
+		gas:             o.gas,
+		preflightChecks: o.preflight,
+		yes:             o.yes,
+		gasLog:          newGasLog(o.gasReportOut),
+		broadcast:       &broadcastLog{dir: o.broadcastDir},
+		accessLists:     o.accessLists,
+	}
+	if err := o.bump.check(); err != nil {
+		return nil, err
+	}
+	if err := o.gas.check(); err != nil {
+		return nil, err
+	}
+	if err := s.accessLists.load(); err != nil {
+		return nil, err
+	}
+	var err error
+	if s.price, err = newEthPrice(o.price); err != nil {
+		return nil, err
+	}
+	if s.fees.History, err = o.feeHistory.oracle(); err != nil {
+		return nil, err
+	}
+	if s.fees.MaxFee, err = parseValue(o.maxFee); err != nil {
+		return nil, fmt.Errorf("--max-fee: %w", err)
+	}
+	if s.fees.PriorityFee, err = parseValue(o.priorityFee); err != nil {
+		return nil, fmt.Errorf("--priority-fee: %w", err)
+	}
+	return s, nil
+}
+
+// openSession dials the node, loads the key and checks the chain ID.
+func openSession(ctx context.Context, o *options) (*session, error) {
+	return openSessionAs(ctx, o, nil)
+}
+
+// openSessionAs is openSession signing with signer instead of the key
+// the options select, unless signer is nil.
+func openSessionAs(ctx context.Context, o *options, signer *Signer) (*session, error) {
+	s, err := newSession(o)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1-2) Connect to the node (Anvil by default) and check the chain ID
+	if s.client, s.chainID, err = connect(ctx, o); err != nil {
+		return nil, err
+	}
+	if bt := chains[s.chainID.Uint64()].blockTime; bt > 0 && !o.pollSet {
+		s.pollInterval = pollIntervalFor(bt)
+		s.ui.Verbosef("  blocks every %s; polling every %s\n", bt, s.pollInterval)
+	}
+	if s.opStack = detectOPStack(ctx, s.client, s.chainID); s.opStack {
+		s.ui.Verbosef("  OP Stack chain: L1 data fees priced by the GasPriceOracle at %s\n", gasPriceOracle.Hex())
+	}
+	s.journal = openJournal(s.ui, o.journalDir, s.chainID, o.deployments)
+	s.journal.warnIncomplete()
+
+	// 3) Load signing key
+	switch {
+	case signer != nil:
+		s.signer = signer
+	case o.anvil.auto:
+		s.signer, err = anvilSigner(o.keys)
+	default:
+		s.signer, err = LoadSigner(o.keys)
+	}
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.from = s.signer.Address
+	s.ui.Printf("Signer: %s (%s)\n", s.names.label(s.from), s.signer.Source)
+	s.ui.report.Deployer = &s.from
+
+	// 4) Transact opts
+	if s.auth, err = s.signer.TransactOpts(s.chainID); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("transactor: %w", err)
+	}
+	s.nonces = newNonceManager(s.client)
+
+	// 5) Private submission
+	if o.relay.private {
+		if s.client.relay, err = o.relay.dial(s.chainID); err != nil {
+			s.Close()
+			return nil, err
+		}
+		if s.client.relay.address() == s.from {
+			s.ui.Warnf("warning: --flashbots-key is the signing key; use a separate key so relay reputation is not tied to funds\n")
+		}
+		s.ui.Printf("Private transactions: %s (as %s)\n", redactURL(s.client.relay.url), s.client.relay.address().Hex())
+	}
+	return s, nil
+}
+
+// Close prints the gas report of whatever the session mined, writes the
+// broadcast file of what it sent, closes its journal entries and
+// disconnects.
+func (s *session) Close() {
+	s.finishGasReport()
+	s.writeBroadcast()
+	s.journal.finish()
+	s.client.Close()
+}
+
+// deploy sends the creation transaction for c and waits until it is mined.
+// If another transaction from the signer takes the reserved nonce first,
+// the send fails with ErrNonceConflict. A contract the receipt still puts
+// away from its predicted address comes back with its address and
+// receipt, along with an ErrNonceConflict error.
+func (s *session) deploy(ctx context.Context, c *Artifact, txo txOptions, args ...interface{}) (common.Address, *types.Receipt, error) {
+	auth, err := s.opts(ctx, txo)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	s.ui.Println("Fees:", describeFees(auth))
+	code, err := initCode(c, args)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	// The nonce is reserved now, and the transaction sent at it, so the
+	// predicted address is the one it is sent to.
+	manual := auth.Nonce != nil
+	if !manual {
+		if auth.Nonce, err = s.nextNonce(ctx); err != nil {
+			return common.Address{}, nil, err
+		}
+	}
+	next := auth.Nonce
+	predicted := crypto.CreateAddress(s.from, next.Uint64())
+	s.ui.Printf("Predicted address: %s (CREATE from %s at nonce %d)\n", predicted.Hex(), s.from.Hex(), next.Uint64())
+	printInitCode(s.ui, c, code)
+	if err := s.preflight(ctx, auth, ethereum.CallMsg{Data: code}, &c.ABI, code, c.DeployedBytecode, &predicted); err != nil {
+		s.nonces.Reset(s.from)
+		return common.Address{}, nil, fmt.Errorf("deploy %s: %w", c.Name, err)
+	}
+
+	// submitAt bounds the send with a per-tx deadline
+	var address common.Address
+	sum := constructorSummary(c, args)
+	tx, err := s.submitAt(ctx, auth, manual, sum, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		a, tx, _, err := bind.DeployContract(opts, c.ABI, c.Bytecode, s.client, args...)
+		address = a
+		return tx, err
+	})
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("deploy %s: %w", c.Name, explainError(err, &c.ABI))
+	}
+	s.ui.Printf("Deploy tx: %s (type %d)\n", tx.Hash().Hex(), tx.Type())
+	s.ui.link("tx", tx.Hash().Hex())
+	s.ui.Verbosef("  nonce %d, gas limit %d\n", tx.Nonce(), tx.Gas())
+
+	rcpt, err := s.waitMined(ctx, tx)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	if rcpt.Status != 1 {
+		reason := failureReason(ctx, s.client, tx, rcpt, &c.ABI)
+		return common.Address{}, rcpt, &RevertError{TxHash: tx.Hash(), Reason: reason, msg: fmt.Sprintf("deployment failed: status %d: %s", rcpt.Status, reason)}
+	}
+	address = rcpt.ContractAddress
+	if err := s.checkCode(ctx, address, rcpt); err != nil {
+		return common.Address{}, rcpt, fmt.Errorf("deploy %s: %w", c.Name, err)
+	}
+	s.ui.Printf("%s deployed at: %s\n", c.Name, address.Hex())
+	s.ui.link("address", address.Hex())
+	if address != predicted {
+		return address, rcpt, classify(ErrNonceConflict, fmt.Errorf("%s was deployed at %s, not at its predicted address %s: another transaction from %s used nonce %d first, so anything given the predicted address points at the wrong contract", c.Name, address.Hex(), predicted.Hex(), s.from.Hex(), next.Uint64()))
+	}
+	return address, rcpt, nil
+}
+
+// checkCode fails unless address has code as of the confirmed block rcpt
+// was mined in, so a deployment a reorg undid is not recorded.
+func (s *session) checkCode(ctx context.Context, address common.Address, rcpt *types.Receipt) error {
+	code, err := s.client.CodeAt(ctx, address, rcpt.BlockNumber)
+	if err != nil {
+		return fmt.Errorf("get code at %s: %w", address.Hex(), err)
+	}
+	if len(code) == 0 {
+		return fmt.Errorf("no code at %s in block %s after tx %s", address.Hex(), rcpt.BlockNumber, rcpt.TxHash.Hex())
+	}
+	return nil
+}
+
+// rebroadcastHook returns the callback WaitForReceipt uses to send a
+// transaction a reorg dropped again, the identical signed bytes at the
+// same nonce, at most s.rebroadcasts times. A node that already has it
+// back in its pool takes it quietly; one that says the nonce is used
+// means another transaction took its place.
+func (s *session) rebroadcastHook(ctx context.Context, sent map[common.Hash]*types.Transaction) func(common.Hash) error {
+	n := 0
+	return func(dropped common.Hash) error {
+		tx := sent[dropped]
+		if tx == nil || s.rebroadcasts <= 0 {
+			return nil
+		}
+		if n >= s.rebroadcasts {
+			return fmt.Errorf("tx %s dropped by reorgs %d times; giving up (see --reorg-rebroadcasts)", dropped.Hex(), n+1)
+		}
+		n++
+		err := s.client.SendTransaction(ctx, tx)
+		switch {
+		case err == nil:
+			s.ui.Warnf("warning: reorg: sent tx %s again at nonce %d (rebroadcast %d/%d)\n", dropped.Hex(), tx.Nonce(), n, s.rebroadcasts)
+		case strings.Contains(strings.ToLower(err.Error()), "nonce too low"):
+			return classify(ErrNonceConflict, fmt.Errorf("tx %s dropped by a reorg and nonce %d is now used by another transaction: %w", dropped.Hex(), tx.Nonce(), err))
+		default:
+			s.ui.Warnf("warning: reorg: rebroadcast of tx %s failed: %v\n", dropped.Hex(), err)
+		}
+		return nil
+	}
+}
+
+// txTimeout bounds building and submitting one transaction: gas
+// estimation, nonce lookup and the send itself.
+const txTimeout = 60 * time.Second
+
+// submit runs send with a copy of opts whose context times out after
+// txTimeout, or earlier if ctx is canceled. Unless opts already carries a
+// nonce (--nonce), one is reserved from s.nonces. The transaction, as sum
+// describes it, is confirmed first (see confirmSend); the prompt does not
+// count towards the timeout. A failed or declined send resyncs the
+// sender's nonce from the chain, as does a manual one.
+func (s *session) submit(ctx context.Context, opts *bind.TransactOpts, sum txSummary, send func(*bind.TransactOpts) (*types.Transaction, error)) (*types.Transaction, error) {
+	o := *opts
+	manual := o.Nonce != nil
+	if !manual {
+		n, err := s.nextNonce(ctx)
+		if err != nil {
+			return nil, err
+		}
+		o.Nonce = n
+	}
+	return s.submitAt(ctx, &o, manual, sum, send)
+}
+
+// nextNonce reserves the signer's next nonce.
+func (s *session) nextNonce(ctx context.Context) (*big.Int, error) {
+	nctx, cancel := context.WithTimeout(ctx, txTimeout)
+	defer cancel()
+	n, err := s.nonces.Next(nctx, s.from)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetUint64(n), nil
+}
+
+// submitAt is submit for opts that carry their nonce: one the caller
+// reserved with nextNonce or, if manual, one given with --nonce.
+func (s *session) submitAt(ctx context.Context, opts *bind.TransactOpts, manual bool, sum txSummary, send func(*bind.TransactOpts) (*types.Transaction, error)) (*types.Transaction, error) {
+	o := *opts
+	if err := s.confirmSend(sum, &o); err != nil {
+		s.nonces.Reset(o.From)
+		return nil, err
+	}
+	tctx, cancel := context.WithTimeout(ctx, txTimeout)
+	defer cancel()
+	o.Context = tctx
+	legacyAccessList(&o, s.chainID)
+	s.noteBalance(tctx)
+	var journaled *types.Transaction
+	if j := s.journal; j != nil {
+		// Signing is the last step before the send: journal it there.
+		sign := o.Signer
+		o.Signer = func(from common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			signed, err := sign(from, tx)
+			if err != nil {
+				return nil, err
+			}
+			if err := j.begin(signed, from, sum); err != nil {
+				return nil, err
+			}
+			journaled = signed
+			return signed, nil
+		}
+	}
+	tx, err := send(&o)
+	err = classifyNodeError(err)
+	if err != nil && journaled != nil {
+		s.journal.failed(journaled, err)
+	}
+	if err != nil || manual {
+		s.nonces.Reset(o.From)
+	}
+	if err == nil {
+		s.noteSent(tx, sum)
+		s.metrics.txSent()
+		s.noteNonceGap(ctx)
+	}
+	return tx, err
+}
+
+// waitMined waits for tx, or a fee-bumped replacement of it, to reach the
+// configured confirmation depth, sending whichever a reorg drops again. If
+// ctx is canceled first (e.g. by Ctrl-C) the error wraps ctx.Err() and
+// names the hash still in flight.
+func (s *session) waitMined(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+	start := time.Now()
+	sent := map[common.Hash]*types.Transaction{tx.Hash(): tx}
+	stalled := s.stalledHook(ctx, tx)
+	if stalled != nil {
+		bump := stalled
+		stalled = func() (*types.Transaction, error) {
+			next, err := bump()
+			if next != nil {
+				sent[next.Hash()] = next
+			}
+			return next, err
+		}
+	}
+	wait := WaitOptions{
+		env:           s.env,
+		Interval:      s.pollInterval,
+		Timeout:       s.waitTimeout,
+		Confirmations: s.confirmations,
+		ProgressEvery: s.progressEvery,
+		Progress: func(elapsed time.Duration, blocks uint64) {
+			s.ui.Printf("  waiting for %s: %s, %d new blocks\n", tx.Hash().Hex(), elapsed, blocks)
+		},
+		stalled: stalled,
+		reorged: s.rebroadcastHook(ctx, sent),
+	}
+	var rcpt *types.Receipt
+	var err error
+	if l := s.sendLock; l != nil {
+		// Others may send while this waits; the hooks send too, so they
+		// take the lock back, as does the bookkeeping after the wait.
+		if bump := wait.stalled; bump != nil {
+			wait.stalled = func() (*types.Transaction, error) {
+				l.Lock()
+				defer l.Unlock()
+				return bump()
+			}
+		}
+		resend := wait.reorged
+		wait.reorged = func(dropped common.Hash) error {
+			l.Lock()
+			defer l.Unlock()
+			return resend(dropped)
+		}
+		l1Fee := s.pendingL1Fee
+		l.Unlock()
+		rcpt, err = WaitForReceipt(ctx, s.client, tx.Hash(), wait)
+		l.Lock()
+		s.pendingL1Fee = l1Fee
+	} else {
+		rcpt, err = WaitForReceipt(ctx, s.client, tx.Hash(), wait)
+	}
+	if err != nil && ctx.Err() != nil {
+		return nil, withField(fmt.Errorf("stopped waiting for tx %s, which may still be mined: %w", tx.Hash().Hex(), ctx.Err()), "tx", tx.Hash().Hex())
+	}
+	if err != nil {
+		s.metrics.txFailed()
+		return nil, withField(fmt.Errorf("wait mined %s: %w", tx.Hash().Hex(), err), "tx", tx.Hash().Hex())
+	}
+	// A fee bump may have been mined in tx's place.
+	mined, ok := sent[rcpt.TxHash]
+	if !ok {
+		mined = tx
+	}
+	if s.journal != nil {
+		s.journal.mined(mined, rcpt)
+	}
+	s.recordGas(ctx, mined, rcpt)
+	s.recordBroadcast(ctx, mined, rcpt)
+	s.noteMined(ctx, rcpt, time.Since(start))
+	return rcpt, nil
+}
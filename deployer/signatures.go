@@ -0,0 +1,244 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// selectorDB resolves 4-byte selectors to text signatures: from the
+// cache file first, then, with --online, from the openchain signature
+// database and 4byte.directory. What the network finds is cached, so a
+// selector is looked up once; what it does not is not asked again in the
+// same run.
+type selectorDB struct {
+	o      decodeOptions
+	known  map[string][]string // "0xa9059cbb" -> ["transfer(address,uint256)"]
+	missed map[string]bool
+	dirty  bool
+}
+
+// defaultSelectorCache is ~/.cache/nyc2025/selectors.json, or its
+// equivalent under the platform's cache directory.
+func defaultSelectorCache() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "nyc2025", "selectors.json")
+}
+
+// open loads the cache and merges the --signatures file into it.
+func (o decodeOptions) open() (*selectorDB, error) {
+	db := &selectorDB{o: o, known: map[string][]string{}, missed: map[string]bool{}}
+	if o.cache != "" {
+		raw, err := os.ReadFile(o.cache)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, fmt.Errorf("read selector cache: %w", err)
+		default:
+			if err := json.Unmarshal(raw, &db.known); err != nil {
+				return nil, fmt.Errorf("parse selector cache %s: %w", o.cache, err)
+			}
+		}
+	}
+	if o.seed != "" {
+		n, err := db.seed(o.seed)
+		if err != nil {
+			return nil, err
+		}
+		ui.Verbosef("Seeded %d signatures from %s\n", n, o.seed)
+	}
+	return db, nil
+}
+
+// seed adds the signatures in the file at path: either an object of
+// selectors to lists of signatures, as the cache is written, or a plain
+// list of signatures, whose selectors are computed.
+func (db *selectorDB) seed(path string) (int, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("--signatures: %w", err)
+	}
+	var sigs []string
+	var bySelector map[string][]string
+	if json.Unmarshal(raw, &sigs) != nil {
+		if err := json.Unmarshal(raw, &bySelector); err != nil {
+			return 0, fmt.Errorf("--signatures %s: want a JSON list of signatures or an object of selectors to signatures", path)
+		}
+		for _, list := range bySelector {
+			sigs = append(sigs, list...)
+		}
+	}
+	n := 0
+	for _, sig := range sigs {
+		m, err := methodFromSignature(sig)
+		if err != nil {
+			ui.Warnf("warning: --signatures %s: %v\n", path, err)
+			continue
+		}
+		if db.add(hexutil.Encode(m.ID), m.Sig) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// add records sig for sel, reporting whether it was new.
+func (db *selectorDB) add(sel, sig string) bool {
+	if slices.Contains(db.known[sel], sig) {
+		return false
+	}
+	db.known[sel] = append(db.known[sel], sig)
+	db.dirty = true
+	return true
+}
+
+// save writes the cache back if anything was added.
+func (db *selectorDB) save() {
+	if db == nil || !db.dirty || db.o.cache == "" {
+		return
+	}
+	if err := writeJSON(db.o.cache, db.known); err != nil {
+		ui.Warnf("warning: write selector cache: %v\n", err)
+	}
+}
+
+// signatures returns the known text signatures of sel, looking it up
+// online when the cache has none.
+func (db *selectorDB) signatures(ctx context.Context, sel string) ([]string, error) {
+	if sigs := db.known[sel]; len(sigs) > 0 || !db.o.online || db.missed[sel] {
+		return sigs, nil
+	}
+	db.missed[sel] = true
+	sigs, err := openchainLookup(ctx, db.o.signatureDB, sel)
+	if err != nil || len(sigs) == 0 {
+		if db.o.fourByteDB == "" {
+			return nil, err
+		}
+		if err != nil {
+			ui.Verbosef("%v; trying %s\n", err, db.o.fourByteDB)
+		}
+		if sigs, err = fourByteLookup(ctx, db.o.fourByteDB, sel); err != nil {
+			return nil, err
+		}
+	}
+	for _, sig := range sigs {
+		if m, err := methodFromSignature(sig); err == nil && hexutil.Encode(m.ID) == sel {
+			db.add(sel, m.Sig)
+		}
+	}
+	return db.known[sel], nil
+}
+
+// decode decodes data with the signatures of its selector, trying each
+// until one decodes it cleanly: without error, and re-encoding to exactly
+// data, so a signature that only decodes a prefix loses to one that
+// accounts for every byte. It returns nil when none decodes at all.
+func (db *selectorDB) decode(ctx context.Context, data []byte) (*decoded, error) {
+	sigs, err := db.signatures(ctx, hexutil.Encode(data[:4]))
+	if err != nil {
+		return nil, err
+	}
+	var loose *decoded
+	for _, sig := range sigs {
+		m, err := methodFromSignature(sig)
+		if err != nil {
+			continue
+		}
+		args, err := m.Inputs.Unpack(data[4:])
+		if err != nil {
+			continue
+		}
+		d := &decoded{method: m, args: args, candidates: sigs}
+		if packed, err := m.Inputs.Pack(args...); err == nil && bytes.Equal(packed, data[4:]) {
+			return d, nil
+		}
+		if loose == nil {
+			loose = d
+		}
+	}
+	return loose, nil
+}
+
+// getJSON fetches u into v with a 15-second timeout.
+func getJSON(ctx context.Context, u string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(raw)))
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// openchainLookup asks an openchain-compatible signature database for the
+// signatures of sel.
+func openchainLookup(ctx context.Context, base, sel string) ([]string, error) {
+	var answer struct {
+		OK     bool `json:"ok"`
+		Result struct {
+			Function map[string][]struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		} `json:"result"`
+	}
+	if err := getJSON(ctx, base+"/lookup?filter=true&function="+url.QueryEscape(sel), &answer); err != nil {
+		return nil, fmt.Errorf("signature lookup: %w", err)
+	}
+	if !answer.OK {
+		return nil, errors.New("signature lookup: not ok")
+	}
+	var sigs []string
+	for _, c := range answer.Result.Function[sel] {
+		sigs = append(sigs, c.Name)
+	}
+	return sigs, nil
+}
+
+type fourByteResult struct {
+	ID            int    `json:"id"`
+	TextSignature string `json:"text_signature"`
+}
+
+// fourByteLookup asks 4byte.directory for the signatures of sel, oldest
+// first, since later submissions are the likelier collisions.
+func fourByteLookup(ctx context.Context, base, sel string) ([]string, error) {
+	var answer struct {
+		Results []fourByteResult `json:"results"`
+	}
+	if err := getJSON(ctx, base+"/signatures/?hex_signature="+url.QueryEscape(sel), &answer); err != nil {
+		return nil, fmt.Errorf("4byte lookup: %w", err)
+	}
+	slices.SortFunc(answer.Results, func(a, b fourByteResult) int { return a.ID - b.ID })
+	var sigs []string
+	for _, r := range answer.Results {
+		sigs = append(sigs, r.TextSignature)
+	}
+	return sigs, nil
+}
@@ -0,0 +1,224 @@
+package deployer
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/console/prompt"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Signer is the account transactions are sent from, independent of where
+// its key came from.
+type Signer struct {
+	Address common.Address
+	Source  string // human-readable key source, e.g. "PRIVATE_KEY"
+	// RawEnv is set when the key itself, not a keystore, came from the
+	// environment.
+	RawEnv bool
+
+	key    *ecdsa.PrivateKey
+	remote *remoteSigner // set instead of key with --signer remote
+	kms    *kmsSigner    // set instead of key with --signer kms
+}
+
+// KeyOptions are the flags that influence key selection, plus key
+// sources from the selected config profile, used when the environment
+// sets none. Signer "remote" signs through the external signer at
+// SignerURL instead of with a key, and "kms" with AWS KMS key KMSKeyID.
+type KeyOptions struct {
+	DerivationPath string
+	AccountIndex   int // overrides the last path component when >= 0
+
+	Signer     string
+	SignerURL  string
+	SignerFrom string
+	KMSKeyID   string
+
+	KeyStdin         bool
+	KeyFile          string
+	RequireSecureKey bool // refuse raw keys from the environment or profile
+
+	Keystore   string
+	Mnemonic   string
+	PrivateKey string
+}
+
+func (o *KeyOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.DerivationPath, "derivation-path", defaultDerivationPath, "BIP-32 path used with MNEMONIC")
+	fs.IntVar(&o.AccountIndex, "account-index", -1, "use m/44'/60'/0'/0/<index> with MNEMONIC")
+	fs.BoolVar(&o.KeyStdin, "key-stdin", false, "read the hex private key from stdin, e.g. piped from a secrets manager")
+	fs.StringVar(&o.KeyFile, "key-file", "", "read the private key from this file: hex, or sealed with `age -p` and unlocked with a passphrase prompt")
+	fs.BoolVar(&o.RequireSecureKey, "require-secure-key", false, "refuse PRIVATE_KEY and MNEMONIC from the environment or profile")
+	fs.StringVar(&o.Signer, "signer", "local", "where transactions are signed: local (a key from the environment or profile), remote (Clef or Web3Signer at --signer-url) or kms (AWS KMS key --kms-key-id)")
+	fs.StringVar(&o.SignerURL, "signer-url", "", "with --signer remote, the signer's JSON-RPC endpoint, e.g. http://clef:8550")
+	fs.StringVar(&o.KMSKeyID, "kms-key-id", "", "with --signer kms, the ID or ARN of an ECC_SECG_P256K1 signing key")
+	fs.StringVar(&o.SignerFrom, "signer-from", "", "with --signer remote, the account to sign as (default the signer's only account)")
+}
+
+// keyMaterial picks the key source: --key-stdin or --key-file, else
+// KEYSTORE_PATH, MNEMONIC or PRIVATE_KEY from the environment, else the
+// profile's keystore, mnemonic or private_key. origin is "flag", "env" or
+// "profile"; kind is empty when nothing is configured. At most one source
+// may be set at each level.
+func keyMaterial(ko KeyOptions) (kind, value, origin string, err error) {
+	switch {
+	case ko.KeyStdin && ko.KeyFile != "":
+		return "", "", "", errors.New("use one of --key-stdin and --key-file")
+	case ko.KeyStdin:
+		return "KEY_STDIN", "", "flag", nil
+	case ko.KeyFile != "":
+		return "KEY_FILE", ko.KeyFile, "flag", nil
+	}
+	sources := map[string]string{
+		"KEYSTORE_PATH": strings.TrimSpace(os.Getenv("KEYSTORE_PATH")),
+		"MNEMONIC":      strings.TrimSpace(os.Getenv("MNEMONIC")),
+		"PRIVATE_KEY":   strings.TrimSpace(os.Getenv("PRIVATE_KEY")),
+	}
+	origin = "env"
+	if sources["KEYSTORE_PATH"] == "" && sources["MNEMONIC"] == "" && sources["PRIVATE_KEY"] == "" {
+		sources = map[string]string{
+			"KEYSTORE_PATH": strings.TrimSpace(ko.Keystore),
+			"MNEMONIC":      strings.TrimSpace(ko.Mnemonic),
+			"PRIVATE_KEY":   strings.TrimSpace(ko.PrivateKey),
+		}
+		origin = "profile"
+	}
+	var set []string
+	for name, v := range sources {
+		if v != "" {
+			kind, value = name, v
+			set = append(set, name)
+		}
+	}
+	if len(set) > 1 {
+		sort.Strings(set)
+		return "", "", "", fmt.Errorf("multiple key sources set in %s (%s); pick one", origin, strings.Join(set, ", "))
+	}
+	if ko.RequireSecureKey && (kind == "PRIVATE_KEY" || kind == "MNEMONIC") {
+		return "", "", "", fmt.Errorf("--require-secure-key: refusing %s from the %s; use --key-stdin, --key-file, a keystore or an external signer", kind, map[string]string{"env": "environment", "profile": "profile"}[origin])
+	}
+	return kind, value, origin, nil
+}
+
+// LoadSigner resolves the signing key: --key-stdin or --key-file, else a
+// keystore file via KEYSTORE_PATH, a BIP-39 phrase via MNEMONIC, or a raw
+// hex key via PRIVATE_KEY, falling back to the profile's key source when
+// the environment sets none. With
+// --signer remote it connects to the external signer instead, and with
+// --signer kms it loads the KMS key's public key.
+func LoadSigner(ko KeyOptions) (*Signer, error) {
+	switch ko.Signer {
+	case "", "local":
+	case "remote":
+		return dialRemoteSigner(ko.SignerURL, ko.SignerFrom)
+	case "kms":
+		return dialKMS(ko.KMSKeyID)
+	default:
+		return nil, fmt.Errorf("--signer: want local, remote or kms, got %q", ko.Signer)
+	}
+	kind, value, origin, err := keyMaterial(ko)
+	if err != nil {
+		return nil, err
+	}
+	prefix := ""
+	if origin == "profile" {
+		prefix = "profile "
+	}
+	switch kind {
+	case "KEY_STDIN":
+		return readKeyStdin()
+	case "KEY_FILE":
+		return loadKeyFile(value)
+	case "KEYSTORE_PATH":
+		return loadKeystore(value)
+	case "MNEMONIC":
+		path, err := derivationPath(ko.DerivationPath, ko.AccountIndex)
+		if err != nil {
+			return nil, err
+		}
+		key, err := deriveKey(value, "", path)
+		if err != nil {
+			return nil, err
+		}
+		signer := newKeySigner(key, prefix+"MNEMONIC "+path.String())
+		signer.RawEnv = origin == "env"
+		return signer, nil
+	case "PRIVATE_KEY":
+		key, err := crypto.HexToECDSA(strings.TrimPrefix(value, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("private key parse: %w", err)
+		}
+		signer := newKeySigner(key, prefix+"PRIVATE_KEY")
+		signer.RawEnv = origin == "env"
+		return signer, nil
+	}
+	return nil, errors.New("no signing key: pass --key-stdin or --key-file, or set KEYSTORE_PATH, MNEMONIC or PRIVATE_KEY")
+}
+
+func newKeySigner(key *ecdsa.PrivateKey, source string) *Signer {
+	return &Signer{Address: crypto.PubkeyToAddress(key.PublicKey), Source: source, key: key}
+}
+
+// loadKeystore decrypts a go-ethereum UTC JSON keystore file. The
+// passphrase comes from KEYSTORE_PASSWORD or an interactive prompt.
+func loadKeystore(path string) (*Signer, error) {
+	keyJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read keystore: %w", err)
+	}
+	pass, ok := os.LookupEnv("KEYSTORE_PASSWORD")
+	if !ok {
+		if !isTerminal(os.Stdin) {
+			return nil, errors.New("KEYSTORE_PASSWORD is not set and stdin is not a terminal")
+		}
+		if pass, err = prompt.Stdin.PromptPassword("Keystore passphrase: "); err != nil {
+			return nil, fmt.Errorf("read passphrase: %w", err)
+		}
+	}
+	key, err := keystore.DecryptKey(keyJSON, pass)
+	if errors.Is(err, keystore.ErrDecrypt) {
+		return nil, fmt.Errorf("keystore %s: wrong passphrase", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("keystore %s: %w", path, err)
+	}
+	return newKeySigner(key.PrivateKey, "keystore "+path), nil
+}
+
+// TransactOpts builds fresh transact opts for chainID.
+func (s *Signer) TransactOpts(chainID *big.Int) (*bind.TransactOpts, error) {
+	switch {
+	case s.remote != nil:
+		return s.remote.transactOpts(s.Address, chainID), nil
+	case s.kms != nil:
+		return s.kms.transactOpts(s.Address, chainID), nil
+	}
+	return bind.NewKeyedTransactorWithChainID(s.key, chainID)
+}
+
+// SignHash signs a 32-byte digest, returning the 65-byte [R || S || V]
+// signature with V as 0 or 1. Remote signers only sign transactions.
+func (s *Signer) SignHash(hash []byte) ([]byte, error) {
+	switch {
+	case s.remote != nil:
+		return nil, fmt.Errorf("%s only signs transactions; sign messages with a local key", s.Source)
+	case s.kms != nil:
+		return s.kms.signDigest(hash)
+	}
+	return crypto.Sign(hash, s.key)
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,304 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// forkSender sends a session's transactions on an Anvil fork from an
+// impersonated account: the node signs them with eth_sendTransaction, so
+// no key is used and the real account's nonce is never spent. hashes maps
+// the hash of each unsigned transaction to the one the node gave it.
+type forkSender struct {
+	from   common.Address
+	mu     sync.Mutex
+	hashes map[common.Hash]common.Hash
+}
+
+func (f *forkSender) send(ctx context.Context, c *rpcClient, tx *types.Transaction) error {
+	req := map[string]interface{}{
+		"from":  f.from,
+		"data":  hexutil.Bytes(tx.Data()),
+		"value": (*hexutil.Big)(tx.Value()),
+		"gas":   hexutil.Uint64(tx.Gas()),
+		"nonce": hexutil.Uint64(tx.Nonce()),
+	}
+	if to := tx.To(); to != nil {
+		req["to"] = to
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		req["maxFeePerGas"], req["maxPriorityFeePerGas"] = (*hexutil.Big)(tx.GasFeeCap()), (*hexutil.Big)(tx.GasTipCap())
+	} else {
+		req["gasPrice"] = (*hexutil.Big)(tx.GasPrice())
+	}
+	if al := tx.AccessList(); len(al) > 0 {
+		req["accessList"] = al
+	}
+	var hash common.Hash
+	if err := anvilCall(ctx, c, &hash, "eth_sendTransaction", req); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.hashes[tx.Hash()] = hash
+	f.mu.Unlock()
+	return nil
+}
+
+// resolve is the node's hash for a transaction sent through f, and hash
+// itself for any other (or when f is nil).
+func (f *forkSender) resolve(hash common.Hash) common.Hash {
+	if f == nil {
+		return hash
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if h, ok := f.hashes[hash]; ok {
+		return h
+	}
+	return hash
+}
+
+// copyManifests copies the chain's deployment manifests (and run records)
+// from dir into a fresh temporary directory, so a simulated run references
+// the real deployments but records its own nowhere that lasts.
+func copyManifests(dir string, chainID fmt.Stringer) (string, error) {
+	tmp, err := os.MkdirTemp("", "nyc2025-simulate-")
+	if err != nil {
+		return "", err
+	}
+	src := filepath.Join(dir, chainID.String())
+	if _, err := os.Stat(src); errors.Is(err, os.ErrNotExist) {
+		return tmp, nil
+	}
+	if err := os.CopyFS(filepath.Join(tmp, chainID.String()), os.DirFS(src)); err != nil {
+		os.RemoveAll(tmp)
+		return "", fmt.Errorf("copy manifests: %w", err)
+	}
+	return tmp, nil
+}
+
+// runPlanCommand implements `plan <subcommand>`; `simulate` is the only
+// one.
+func runPlanCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "simulate" {
+		return errors.New("usage: plan simulate [flags] <plan.yaml>")
+	}
+	return runPlanSimulate(ctx, args[1:])
+}
+
+// runPlanSimulate implements `plan simulate [flags] <plan.yaml>`: run every
+// step of a plan for real on an Anvil fork, as the impersonated deployer,
+// then revert the fork. With --fork-url a throwaway Anvil forks that chain;
+// otherwise --rpc must already be an Anvil fork.
+func runPlanSimulate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("plan simulate", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	o.register(fs)
+	ao.register(fs, "")
+	fromFlag := fs.String("from", "", "deployer to impersonate (default the configured key's address)")
+	fund := fs.String("fund", "100ether", "top the deployer's balance on the fork up to this `amount`")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: plan simulate [flags] <plan.yaml>")
+	}
+	planPath := fs.Arg(0)
+	p, err := loadPlan(planPath)
+	if err != nil {
+		return err
+	}
+	funding, err := parseValue(*fund)
+	if err != nil {
+		return fmt.Errorf("--fund: %w", err)
+	}
+	var from common.Address
+	if *fromFlag != "" {
+		if from, err = parseAddress(*fromFlag); err != nil {
+			return err
+		}
+	} else {
+		load := LoadSigner
+		if o.anvil.auto || o.anvil.forkURL != "" {
+			load = anvilSigner
+		}
+		signer, err := load(o.keys)
+		if err != nil {
+			return fmt.Errorf("%w; or set --from to simulate as that account", err)
+		}
+		from = signer.Address
+	}
+	if o.anvil.forkURL != "" {
+		o.anvil.auto = true
+	}
+
+	s, err := newSession(&o)
+	if err != nil {
+		return err
+	}
+	// Nothing simulated is signed, confirmed, retried or written out.
+	s.yes, s.bump, s.broadcast = true, bumpPolicy{}, &broadcastLog{}
+	if s.client, s.chainID, err = connect(ctx, &o); err != nil {
+		return err
+	}
+	defer s.Close()
+
+	// The snapshot comes first: a node that cannot take one is not a
+	// fork, and nothing is sent to it.
+	var snapshot string
+	if err := anvilCall(ctx, s.client, &snapshot, "evm_snapshot"); err != nil {
+		return fmt.Errorf("plan simulate needs an Anvil fork (pass --fork-url <rpc>): %w", err)
+	}
+	defer func() {
+		// Report gas while the fork still holds the run's balances, then
+		// throw the run away.
+		s.finishGasReport()
+		s.gasLog = nil
+		ctx := context.Background()
+		if err := anvilCall(ctx, s.client, nil, "anvil_stopImpersonatingAccount", from); err != nil {
+			ui.Verbosef("  %v\n", err)
+		}
+		var ok bool
+		if err := anvilCall(ctx, s.client, &ok, "evm_revert", snapshot); err != nil {
+			ui.Warnf("warning: revert the fork: %v\n", err)
+		} else if !ok {
+			ui.Warnf("warning: revert the fork: no snapshot %s\n", snapshot)
+		} else {
+			ui.Printf("Reverted the fork to snapshot %s\n", snapshot)
+		}
+	}()
+	ui.report.Snapshot = snapshot
+
+	if err := anvilCall(ctx, s.client, nil, "anvil_impersonateAccount", from); err != nil {
+		return err
+	}
+	balance, err := s.client.BalanceAt(ctx, from, nil)
+	if err != nil {
+		return fmt.Errorf("balance of %s: %w", from.Hex(), err)
+	}
+	if funding != nil && balance.Cmp(funding) < 0 {
+		if err := anvilCall(ctx, s.client, nil, "anvil_setBalance", from, (*hexutil.Big)(funding)); err != nil {
+			return err
+		}
+		ui.Printf("Funded %s with %s ETH on the fork\n", from.Hex(), formatEther(funding))
+	}
+	s.from = from
+	s.opStack = detectOPStack(ctx, s.client, s.chainID)
+	s.client.fork = &forkSender{from: from, hashes: map[common.Hash]common.Hash{}}
+	s.auth = &bind.TransactOpts{From: from, Signer: func(_ common.Address, tx *types.Transaction) (*types.Transaction, error) {
+		return tx, nil
+	}}
+	s.nonces = newNonceManager(s.client)
+	ui.Printf("Simulating %s as %s (impersonated, snapshot %s)\n", planPath, names.label(from), snapshot)
+	ui.report.Deployer = &from
+
+	dir, err := copyManifests(o.deployments, s.chainID)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	r := &planRun{s: s, ao: ao, dir: dir, outputs: map[string]string{}}
+	if p.predicts {
+		var steps []*planStep
+		for i := range p.Steps {
+			steps = append(steps, &p.Steps[i])
+		}
+		if err := r.predict(ctx, steps); err != nil {
+			return fmt.Errorf("predict addresses: %w", err)
+		}
+	}
+
+	var failed error
+	for i := range p.Steps {
+		st := &p.Steps[i]
+		if failed != nil {
+			kind, _, _ := st.kind()
+			ui.report.Steps = append(ui.report.Steps, StepReport{Name: st.Name, Kind: kind, Status: "skipped"})
+			continue
+		}
+		ui.Printf("Step %d/%d %s\n", i+1, len(p.Steps), st.Name)
+		mined, sent := len(s.gasLog.entries), len(ui.report.Transactions)
+		ui.report.Contract = nil
+		kind, out, err := r.step(ctx, st)
+		sr := StepReport{Name: st.Name, Kind: kind, Status: "done", Outputs: out}
+		for _, e := range s.gasLog.entries[mined:] {
+			sr.GasUsed += e.GasUsed
+		}
+		for _, t := range ui.report.Transactions[sent:] {
+			sr.Events = append(sr.Events, t.Events...)
+		}
+		if c := ui.report.Contract; kind == "deploy" && c != nil && c.Deploy != nil {
+			sr.Events = append(sr.Events, c.Deploy.Events...)
+		}
+		if err != nil {
+			sr.Status, sr.Error = "failed", err.Error()
+			failed = fmt.Errorf("step %d/%d %s: %w", i+1, len(p.Steps), st.Name, err)
+		} else {
+			for k, v := range out {
+				r.outputs["steps."+st.Name+"."+k] = v
+			}
+		}
+		ui.report.Steps = append(ui.report.Steps, sr)
+	}
+	ui.report.Contract = nil
+
+	printSimulation(ui.report.Steps)
+	if failed != nil {
+		return failed
+	}
+	ui.Printf("Simulation complete: %d steps ran on the fork\n", len(p.Steps))
+	return nil
+}
+
+// printSimulation prints one row per step of a simulated plan.
+func printSimulation(steps []StepReport) {
+	rows := [][]string{{"step", "kind", "status", "gas used", "events"}}
+	for _, sr := range steps {
+		gas, events := "-", "-"
+		if sr.GasUsed > 0 {
+			gas = strconv.FormatUint(sr.GasUsed, 10)
+		}
+		if len(sr.Events) > 0 {
+			kinds := make([]string, len(sr.Events))
+			for i, e := range sr.Events {
+				if kinds[i] = e.Name; e.Name == "" {
+					kinds[i] = "log"
+				}
+			}
+			events = strings.Join(kinds, ", ")
+		}
+		rows = append(rows, []string{sr.Name, sr.Kind, sr.Status, gas, events})
+	}
+	width := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			width[i] = max(width[i], len(cell))
+		}
+	}
+	ui.Println("Simulated steps:")
+	for _, row := range rows {
+		line := ""
+		for i, cell := range row {
+			line += fmt.Sprintf("  %-*s", width[i], cell)
+		}
+		ui.Println(strings.TrimRight(line, " "))
+	}
+	for _, sr := range steps {
+		if sr.Error != "" {
+			ui.Printf("  %s failed: %s\n", sr.Name, sr.Error)
+		}
+	}
+}
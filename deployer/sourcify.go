@@ -0,0 +1,157 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const defaultSourcifyURL = "https://sourcify.dev/server"
+
+// sourcifyMatch is one address's entry in a /check-by-addresses or
+// /verify answer. Older servers report status at the top level, newer
+// ones per chain.
+type sourcifyMatch struct {
+	Address  string `json:"address"`
+	ChainID  string `json:"chainId"`
+	Status   string `json:"status"`
+	Message  string `json:"message"`
+	ChainIDs []struct {
+		ChainID string `json:"chainId"`
+		Status  string `json:"status"`
+	} `json:"chainIds"`
+}
+
+// statusOn returns the match status ("perfect", "partial") on chainID,
+// or "" when the address is not verified there.
+func (m sourcifyMatch) statusOn(chainID string) string {
+	for _, c := range m.ChainIDs {
+		if c.ChainID == chainID {
+			return c.Status
+		}
+	}
+	if m.Status == "perfect" || m.Status == "partial" {
+		if m.ChainID == "" || m.ChainID == chainID {
+			return m.Status
+		}
+	}
+	return ""
+}
+
+// sourcify is a client for a Sourcify server.
+type sourcify struct {
+	base string
+	http *http.Client
+}
+
+// do sends a request and decodes a 2xx JSON answer into out. Any other
+// answer is returned as an error carrying the server's message verbatim.
+func (sc *sourcify) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, sc.base+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := sc.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(raw, &e) == nil && (e.Error != "" || e.Message != "") {
+			return fmt.Errorf("sourcify: %s", strings.TrimSpace(e.Error+" "+e.Message))
+		}
+		return fmt.Errorf("sourcify: %s: %s", resp.Status, strings.TrimSpace(string(raw)))
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("sourcify: unexpected response: %s", strings.TrimSpace(string(raw)))
+	}
+	return nil
+}
+
+// verifySourcify uploads c's metadata and sources to Sourcify unless the
+// address is already verified there, and reports the match it got.
+func verifySourcify(ctx context.Context, c *Artifact, address common.Address, chainID *big.Int, vo verifyOptions) error {
+	md, err := parseMetadata(c)
+	if err != nil {
+		return fmt.Errorf("verify %s: %w", c.Name, err)
+	}
+	sc := &sourcify{base: strings.TrimRight(vo.sourcifyURL, "/"), http: &http.Client{Timeout: 2 * time.Minute}}
+	chain := chainID.String()
+	ui.Printf("Verifying %s at %s on Sourcify (%s)\n", c.Name, address.Hex(), sc.base)
+
+	var checked []sourcifyMatch
+	query := url.Values{"addresses": {address.Hex()}, "chainIds": {chain}}
+	if err := sc.do(ctx, http.MethodGet, "/check-by-addresses?"+query.Encode(), nil, &checked); err != nil {
+		return fmt.Errorf("verify %s: %w", c.Name, err)
+	}
+	for _, m := range checked {
+		if status := m.statusOn(chain); status != "" {
+			ui.Printf("  already verified (%s match)\n", status)
+			return nil
+		}
+	}
+
+	files, missing := readSources(md, vo.sourceRoot)
+	for _, path := range missing {
+		ui.Warnf("  source %s not found under %s\n", path, vo.sourceRoot)
+	}
+	for _, path := range strings.Split(vo.sources, ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("--sources: %w", err)
+		}
+		files[filepath.ToSlash(path)] = string(raw)
+	}
+	files["metadata.json"] = string(c.Metadata)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"address": address.Hex(),
+		"chain":   chain,
+		"files":   files,
+	})
+	if err != nil {
+		return err
+	}
+	var verified struct {
+		Result []sourcifyMatch `json:"result"`
+	}
+	if err := sc.do(ctx, http.MethodPost, "/verify", body, &verified); err != nil {
+		return fmt.Errorf("verify %s: %w", c.Name, err)
+	}
+	for _, m := range verified.Result {
+		switch m.Status {
+		case "perfect", "partial":
+			ui.Printf("  verified (%s match)\n", m.Status)
+			return nil
+		}
+		if m.Message != "" {
+			return fmt.Errorf("verify %s: sourcify: %s", c.Name, m.Message)
+		}
+	}
+	return fmt.Errorf("verify %s: sourcify found no match for %s", c.Name, address.Hex())
+}
@@ -0,0 +1,146 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// parseSlot evaluates a storage slot: a decimal or 0x number, or
+// mapping(<slot>, <key>) for the entry at key of the mapping declared at
+// slot, nested for mappings of mappings.
+func parseSlot(expr string) (common.Hash, error) {
+	expr = strings.TrimSpace(expr)
+	if inner, ok := strings.CutPrefix(expr, "mapping("); ok && strings.HasSuffix(inner, ")") {
+		inner = inner[:len(inner)-1]
+		depth, comma := 0, -1
+		for i, c := range inner {
+			switch c {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			case ',':
+				if depth == 0 {
+					comma = i
+				}
+			}
+		}
+		if comma < 0 {
+			return common.Hash{}, fmt.Errorf("invalid slot %q: want mapping(<slot>, <key>)", expr)
+		}
+		slot, err := parseSlot(inner[:comma])
+		if err != nil {
+			return common.Hash{}, err
+		}
+		key, err := mappingKey(strings.TrimSpace(inner[comma+1:]))
+		if err != nil {
+			return common.Hash{}, err
+		}
+		return crypto.Keccak256Hash(key, slot[:]), nil
+	}
+	n, err := toBigInt(expr)
+	if err != nil || n.Sign() < 0 || n.BitLen() > 256 {
+		return common.Hash{}, fmt.Errorf("invalid slot %q", expr)
+	}
+	return common.BigToHash(n), nil
+}
+
+// mappingKey encodes a mapping key as Solidity hashes it: addresses,
+// integers and bytes32 padded to 32 bytes, "quoted" strings as their raw
+// bytes.
+func mappingKey(s string) ([]byte, error) {
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		return []byte(unquoted), nil
+	}
+	if common.IsHexAddress(s) && len(strings.TrimPrefix(s, "0x")) == 2*common.AddressLength {
+		return common.LeftPadBytes(common.HexToAddress(s).Bytes(), 32), nil
+	}
+	n, err := toBigInt(s)
+	if err != nil || n.BitLen() > 256 {
+		return nil, fmt.Errorf("invalid mapping key %q: want an address, integer, 0x bytes32 or \"string\"", s)
+	}
+	if n.Sign() < 0 {
+		// Two's complement, as int keys are stored.
+		n = new(big.Int).Add(n, new(big.Int).Lsh(big.NewInt(1), 256))
+	}
+	return common.BigToHash(n).Bytes(), nil
+}
+
+// wordAddress returns the address in word if it is one: twelve zero
+// bytes followed by a nonzero address.
+func wordAddress(word common.Hash) (common.Address, bool) {
+	for _, b := range word[:12] {
+		if b != 0 {
+			return common.Address{}, false
+		}
+	}
+	addr := common.BytesToAddress(word[12:])
+	return addr, addr != (common.Address{})
+}
+
+// readSlot reads one storage word at block (nil = latest) and records it
+// in the report.
+func readSlot(ctx context.Context, client *rpcClient, address common.Address, slot common.Hash, block *big.Int) (common.Hash, error) {
+	raw, err := client.StorageAt(ctx, address, slot, block)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("eth_getStorageAt %s %s: %w", address.Hex(), slot.Hex(), err)
+	}
+	word := common.BytesToHash(raw)
+	report := StorageReport{Address: address, Slot: slot, Value: word}
+	if addr, ok := wordAddress(word); ok {
+		report.AsAddress = &addr
+	}
+	client.ui.report.Storage = append(client.ui.report.Storage, report)
+	return word, nil
+}
+
+// runStorage implements `storage [flags] <address> <slot>`.
+func runStorage(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("storage", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	blockFlag := fs.String("block", "", "block number to read at (default latest)")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("usage: storage [flags] <address> <slot|mapping(slot, key)>")
+	}
+	address, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	slot, err := parseSlot(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	block, err := parseBlock(*blockFlag)
+	if err != nil {
+		return err
+	}
+
+	client, _, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	word, err := readSlot(ctx, client, address, slot, block)
+	if err != nil {
+		return err
+	}
+	ui.Resultf("Slot:    %s\n", slot.Hex())
+	ui.Resultf("Value:   %s\n", word.Hex())
+	ui.Resultf("Uint:    %s\n", word.Big())
+	if addr, ok := wordAddress(word); ok {
+		ui.Resultf("Address: %s\n", addr.Hex())
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package deployer
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseSlot checks slots against where solc puts mapping entries:
+// keccak256(key . slot), the key padded to 32 bytes unless it is a string
+// or bytes.
+func TestParseSlot(t *testing.T) {
+	spender := "0x70997970C51812dc3A010C7d01b50e0d17dc79C8"
+	for _, tt := range []struct{ expr, want string }{
+		{"0", "0x0000000000000000000000000000000000000000000000000000000000000000"},
+		{"0x0a", "0x000000000000000000000000000000000000000000000000000000000000000a"},
+		{"  12 ", "0x000000000000000000000000000000000000000000000000000000000000000c"},
+		// mapping(uint256 => ...) at slot 0, keys 0 and 1, and at slot 1, key 0
+		{"mapping(0, 0)", "0xad3228b676f7d3cd4284a5443f17f1962b36e491b30a40b2405849e597ba5fb5"},
+		{"mapping(0, 1)", "0xada5013122d395ba3c54772283fb069b10426056ef8ca54750cb9bb552a59e7d"},
+		{"mapping(1, 0)", "0xa6eef7e35abe7026729641147f7915573c7e97b47efa546f5f6e3230263bcb49"},
+		// mapping(address => uint256) balanceOf at slot 0
+		{"mapping(0, " + testAddr.Hex() + ")", "0x723077b8a1b173adc35e5f0e7e3662fd1208212cb629f9c128551ea7168da722"},
+		// mapping(string => ...) at slot 1, key "hello"
+		{`mapping(1, "hello")`, "0x8404bb4d805e9ca2bd5dd5c43a107e935c8ec393caa7851b353b3192cd5379ae"},
+		// mapping(int256 => ...) at slot 2, key -1, stored as 2**256-1
+		{"mapping(2, -1)", "0x38b5b2ceac7637132d27514ffcf440b705287635075af7b8bd5adcaa6a4cc5bb"},
+		// mapping(address => mapping(address => uint256)) allowance at slot 1
+		{"mapping(mapping(1, " + testAddr.Hex() + "), " + spender + ")", "0x7bb4c14a4642c37aac43229fec930a0666790858dbac8fc0f7b91e6a34742718"},
+	} {
+		got, err := parseSlot(tt.expr)
+		if err != nil {
+			t.Errorf("parseSlot(%s): %v", tt.expr, err)
+		} else if got.Hex() != tt.want {
+			t.Errorf("parseSlot(%s) = %s, want %s", tt.expr, got.Hex(), tt.want)
+		}
+	}
+
+	for _, tt := range []struct{ expr, want string }{
+		{"-1", `invalid slot "-1"`},
+		{"0x1" + strings.Repeat("0", 64), "invalid slot"},
+		{"mapping(0)", "want mapping(<slot>, <key>)"},
+		{"mapping(x, 1)", `invalid slot "x"`},
+		{"mapping(0, nope)", `invalid mapping key "nope"`},
+	} {
+		if _, err := parseSlot(tt.expr); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseSlot(%s) = %v, want %q", tt.expr, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,543 @@
+package deployer
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// maxStoredElements is the most elements read-var reads of an array
+// read whole; larger ones have to be indexed.
+const maxStoredElements = 256
+
+// fixedBytesType matches the type IDs of bytes1 to bytes32.
+var fixedBytesType = regexp.MustCompile(`^t_bytes(\d+)$`)
+
+// layoutOf is c's storage layout, or an error saying how to get one.
+func layoutOf(c *Artifact) (*storageLayout, error) {
+	if c.StorageLayout == nil {
+		return nil, fmt.Errorf("%s has no storageLayout; add extra_output = [\"storageLayout\"] to foundry.toml and rebuild", c.Path)
+	}
+	return c.StorageLayout, nil
+}
+
+// layoutRows flattens vars, at slot base, into the rows storage-layout
+// prints: each variable, and each struct member under it as name.member.
+func layoutRows(l *storageLayout, vars []storageVar, base *big.Int, prefix string) []LayoutReport {
+	var rows []LayoutReport
+	for _, v := range vars {
+		slot := new(big.Int).Add(base, slotOf(v))
+		t := l.Types[v.Type]
+		size, _ := strconv.Atoi(t.NumberOfBytes)
+		rows = append(rows, LayoutReport{Name: prefix + v.Label, Contract: v.Contract, Slot: slot.String(), Offset: v.Offset, Bytes: size, Type: t.Label})
+		if len(t.Members) > 0 {
+			rows = append(rows, layoutRows(l, t.Members, slot, prefix+v.Label+".")...)
+		}
+	}
+	return rows
+}
+
+// runStorageLayout implements `storage-layout [flags] [artifact]`.
+func runStorageLayout(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("storage-layout", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	o.register(fs)
+	ao.register(fs, "")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if ao.path == "" && ao.contract == "" && fs.NArg() == 1 {
+		ao.path = fs.Arg(0)
+	} else if fs.NArg() != 0 {
+		return errors.New("usage: storage-layout [flags] [artifact]")
+	}
+	path, contract, err := ao.resolve()
+	if err != nil {
+		return err
+	}
+	c, err := loadABI(path, contract)
+	if err != nil {
+		return err
+	}
+	l, err := layoutOf(c)
+	if err != nil {
+		return err
+	}
+	rows := layoutRows(l, l.Storage, new(big.Int), "")
+	ui.report.Layout = rows
+
+	table := [][]string{{"slot", "offset", "bytes", "type", "name", "contract"}}
+	for _, r := range rows {
+		table = append(table, []string{r.Slot, fmt.Sprint(r.Offset), fmt.Sprint(r.Bytes), r.Type, r.Name, r.Contract})
+	}
+	width := make([]int, len(table[0]))
+	for _, row := range table {
+		for i, cell := range row {
+			width[i] = max(width[i], len(cell))
+		}
+	}
+	ui.Resultf("Storage layout of %s (%s):\n", c.Name, c.Path)
+	for _, row := range table {
+		line := fmt.Sprintf("  %*s  %*s  %*s", width[0], row[0], width[1], row[1], width[2], row[2])
+		for i, cell := range row[3:] {
+			line += fmt.Sprintf("  %-*s", width[i+3], cell)
+		}
+		ui.Resultln(strings.TrimRight(line, " "))
+	}
+	return nil
+}
+
+// storageLoc is where a value lives: its first slot, its byte offset in
+// that slot counted from the right, and its type ID.
+type storageLoc struct {
+	slot   *big.Int
+	offset int
+	typ    string
+}
+
+// varReader reads variables of one contract through its storage layout.
+// Words are read once each, so packed neighbours share a read.
+type varReader struct {
+	client  *rpcClient
+	address common.Address
+	block   *big.Int
+	layout  *storageLayout
+	words   map[string]common.Hash
+}
+
+func (r *varReader) word(ctx context.Context, slot *big.Int) (common.Hash, error) {
+	key := slot.String()
+	if w, ok := r.words[key]; ok {
+		return w, nil
+	}
+	w, err := readSlot(ctx, r.client, r.address, common.BigToHash(slot), r.block)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	r.words[key] = w
+	return w, nil
+}
+
+// locate follows path, a variable name with .member and [index] steps,
+// from the layout's variables to the value it names, and spells out the
+// path with the keys. Each mapping on the way takes the next of keys.
+func (r *varReader) locate(ctx context.Context, path string, keys []string) (storageLoc, string, error) {
+	name, steps, err := splitVarPath(path)
+	if err != nil {
+		return storageLoc{}, "", err
+	}
+	var loc storageLoc
+	found := false
+	for _, v := range r.layout.Storage {
+		if v.Label == name {
+			loc, found = storageLoc{slot: slotOf(v), offset: v.Offset, typ: v.Type}, true
+			break
+		}
+	}
+	if !found {
+		return storageLoc{}, "", fmt.Errorf("no state variable %q in the storage layout", name)
+	}
+	where := name
+	for {
+		t := r.layout.Types[loc.typ]
+		if t.Encoding == "mapping" && (len(steps) == 0 || steps[0][0] != '.') {
+			if len(keys) == 0 {
+				if len(steps) > 0 {
+					return storageLoc{}, "", fmt.Errorf("%s is a %s; pass its key with --key, not %s", where, t.Label, steps[0])
+				}
+				return loc, where, nil
+			}
+			key, err := storageKey(r.layout.Types[t.Key], t.Key, keys[0])
+			if err != nil {
+				return storageLoc{}, "", fmt.Errorf("%s: %w", where, err)
+			}
+			loc = storageLoc{slot: crypto.Keccak256Hash(key, common.BigToHash(loc.slot).Bytes()).Big(), typ: t.Value}
+			where += "[" + keys[0] + "]"
+			keys = keys[1:]
+			continue
+		}
+		if len(steps) == 0 {
+			break
+		}
+		step := steps[0]
+		steps = steps[1:]
+		switch {
+		case step[0] == '.':
+			member := step[1:]
+			var m *storageVar
+			for i := range t.Members {
+				if t.Members[i].Label == member {
+					m = &t.Members[i]
+				}
+			}
+			if m == nil {
+				return storageLoc{}, "", fmt.Errorf("%s (%s) has no member %s", where, t.Label, member)
+			}
+			loc = storageLoc{slot: new(big.Int).Add(loc.slot, slotOf(*m)), offset: m.Offset, typ: m.Type}
+		case t.Base != "":
+			i, err := strconv.ParseUint(step[1:len(step)-1], 10, 64)
+			if err != nil {
+				return storageLoc{}, "", fmt.Errorf("%s: invalid index %s", where, step)
+			}
+			n, data, err := r.array(ctx, loc)
+			if err != nil {
+				return storageLoc{}, "", err
+			}
+			if i >= n {
+				return storageLoc{}, "", fmt.Errorf("%s%s is out of range: it has %d elements", where, step, n)
+			}
+			loc = r.element(data, t.Base, i)
+		default:
+			return storageLoc{}, "", fmt.Errorf("%s is a %s, which %s does not apply to", where, t.Label, step)
+		}
+		where += step
+	}
+	if len(keys) > 0 {
+		return storageLoc{}, "", fmt.Errorf("%s is not a mapping; %d --key left over", where, len(keys))
+	}
+	return loc, where, nil
+}
+
+// splitVarPath splits name.member[2] into name and its steps, each
+// starting with . or [.
+func splitVarPath(path string) (string, []string, error) {
+	end := strings.IndexAny(path, ".[")
+	if end < 0 {
+		end = len(path)
+	}
+	name, rest := path[:end], path[end:]
+	if name == "" {
+		return "", nil, fmt.Errorf("invalid variable %q", path)
+	}
+	var steps []string
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			n := strings.IndexAny(rest[1:], ".[")
+			if n < 0 {
+				n = len(rest) - 1
+			}
+			if n == 0 {
+				return "", nil, fmt.Errorf("invalid variable %q", path)
+			}
+			steps, rest = append(steps, rest[:n+1]), rest[n+1:]
+		case '[':
+			n := strings.IndexByte(rest, ']')
+			if n < 2 {
+				return "", nil, fmt.Errorf("invalid variable %q", path)
+			}
+			steps, rest = append(steps, rest[:n+1]), rest[n+1:]
+		default:
+			return "", nil, fmt.Errorf("invalid variable %q", path)
+		}
+	}
+	return name, steps, nil
+}
+
+// array is the length of the array at loc and the slot its elements
+// start at: in place for fixed-size arrays, at keccak256(slot) after a
+// length word for dynamic ones.
+func (r *varReader) array(ctx context.Context, loc storageLoc) (uint64, *big.Int, error) {
+	t := r.layout.Types[loc.typ]
+	if t.Encoding != "dynamic_array" {
+		from, to := strings.LastIndexByte(t.Label, '['), strings.LastIndexByte(t.Label, ']')
+		if from < 0 || to < from {
+			return 0, nil, fmt.Errorf("cannot tell the length of %s", t.Label)
+		}
+		n, err := strconv.ParseUint(t.Label[from+1:to], 10, 64)
+		if err != nil {
+			return 0, nil, fmt.Errorf("cannot tell the length of %s", t.Label)
+		}
+		return n, loc.slot, nil
+	}
+	w, err := r.word(ctx, loc.slot)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !w.Big().IsUint64() {
+		return 0, nil, fmt.Errorf("array length %s is not plausible", w.Big())
+	}
+	return w.Big().Uint64(), crypto.Keccak256Hash(common.BigToHash(loc.slot).Bytes()).Big(), nil
+}
+
+// element is where element i of an array of base starting at data lives.
+// Elements under 32 bytes share slots, as many as fit; larger ones each
+// start a slot of their own.
+func (r *varReader) element(data *big.Int, base string, i uint64) storageLoc {
+	size, _ := strconv.Atoi(r.layout.Types[base].NumberOfBytes)
+	index := new(big.Int).SetUint64(i)
+	if size > 0 && size < 32 {
+		per := big.NewInt(int64(32 / size))
+		slot, rem := new(big.Int).QuoRem(index, per, new(big.Int))
+		return storageLoc{slot: slot.Add(slot, data), offset: int(rem.Int64()) * size, typ: base}
+	}
+	slots := big.NewInt(int64(max((size+31)/32, 1)))
+	return storageLoc{slot: index.Mul(index, slots).Add(index, data), typ: base}
+}
+
+// storageKey is key, given on the command line, encoded the way Solidity
+// hashes a mapping key of type t, ID id: strings and bytes as their raw
+// bytes, fixed bytes padded on the right, every other value type padded
+// on the left to 32 bytes.
+func storageKey(t storageType, id, key string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(id, "t_string"):
+		if s, err := strconv.Unquote(key); err == nil {
+			return []byte(s), nil
+		}
+		return []byte(key), nil
+	case strings.HasPrefix(id, "t_bytes_"):
+		b, err := hex.DecodeString(strings.TrimPrefix(key, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bytes key %q", key)
+		}
+		return b, nil
+	case fixedBytesType.MatchString(id):
+		n, _ := strconv.Atoi(fixedBytesType.FindStringSubmatch(id)[1])
+		b, err := hex.DecodeString(strings.TrimPrefix(key, "0x"))
+		if err != nil || len(b) > n {
+			return nil, fmt.Errorf("invalid %s key %q", t.Label, key)
+		}
+		return common.RightPadBytes(b, 32), nil
+	case strings.HasPrefix(id, "t_address"), strings.HasPrefix(id, "t_contract"):
+		if !common.IsHexAddress(key) {
+			return nil, fmt.Errorf("invalid address key %q", key)
+		}
+		return common.LeftPadBytes(common.HexToAddress(key).Bytes(), 32), nil
+	case strings.HasPrefix(id, "t_bool"):
+		switch key {
+		case "true":
+			return common.LeftPadBytes([]byte{1}, 32), nil
+		case "false":
+			return make([]byte, 32), nil
+		}
+		return nil, fmt.Errorf("invalid bool key %q", key)
+	}
+	return mappingKey(key)
+}
+
+// storedStruct is a struct read from storage, its members in declaration
+// order.
+type storedStruct []storedMember
+
+type storedMember struct {
+	Name  string
+	Value interface{}
+}
+
+// read decodes the value at loc as its declared type: value types from
+// their bytes of the word, strings and bytes from the word or, when
+// long, the slots after keccak256(slot), and arrays and structs member by
+// member.
+func (r *varReader) read(ctx context.Context, loc storageLoc) (interface{}, error) {
+	t := r.layout.Types[loc.typ]
+	switch {
+	case t.Encoding == "mapping":
+		return nil, fmt.Errorf("a %s has no value of its own; pass a key with --key", t.Label)
+	case t.Encoding == "bytes":
+		return r.readBytes(ctx, loc)
+	case t.Base != "":
+		n, data, err := r.array(ctx, loc)
+		if err != nil {
+			return nil, err
+		}
+		if n > maxStoredElements {
+			return nil, fmt.Errorf("%s has %d elements; read one with [index]", t.Label, n)
+		}
+		out := make([]interface{}, n)
+		for i := range out {
+			if out[i], err = r.read(ctx, r.element(data, t.Base, uint64(i))); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case len(t.Members) > 0:
+		var out storedStruct
+		for _, m := range t.Members {
+			v, err := r.read(ctx, storageLoc{slot: new(big.Int).Add(loc.slot, slotOf(m)), offset: m.Offset, typ: m.Type})
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, storedMember{m.Label, v})
+		}
+		return out, nil
+	}
+	w, err := r.word(ctx, loc.slot)
+	if err != nil {
+		return nil, err
+	}
+	size, _ := strconv.Atoi(t.NumberOfBytes)
+	if size <= 0 || size+loc.offset > 32 {
+		return nil, fmt.Errorf("%s of %s bytes does not fit at offset %d", t.Label, t.NumberOfBytes, loc.offset)
+	}
+	b := w[32-loc.offset-size : 32-loc.offset]
+	switch id := loc.typ; {
+	case strings.HasPrefix(id, "t_bool"):
+		return b[size-1] != 0, nil
+	case strings.HasPrefix(id, "t_address"), strings.HasPrefix(id, "t_contract"):
+		return common.BytesToAddress(b), nil
+	case fixedBytesType.MatchString(id):
+		return append([]byte{}, b...), nil
+	case strings.HasPrefix(id, "t_int"):
+		v := new(big.Int).SetBytes(b)
+		if b[0]&0x80 != 0 {
+			v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(8*size)))
+		}
+		return v, nil
+	case strings.HasPrefix(id, "t_function"):
+		return append([]byte{}, b...), nil
+	}
+	// Unsigned integers, enums and user-defined value types.
+	return new(big.Int).SetBytes(b), nil
+}
+
+// readBytes decodes a string or bytes value. Up to 31 bytes are kept in
+// the slot itself, with twice the length in the lowest byte; longer ones
+// store twice the length plus one there and the data from
+// keccak256(slot) on.
+func (r *varReader) readBytes(ctx context.Context, loc storageLoc) (interface{}, error) {
+	w, err := r.word(ctx, loc.slot)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	if w[31]&1 == 0 {
+		n := int(w[31]) / 2
+		if n > 31 {
+			return nil, fmt.Errorf("short string length %d is not plausible", n)
+		}
+		data = append(data, w[:n]...)
+	} else {
+		length := new(big.Int).Rsh(w.Big(), 1)
+		if !length.IsInt64() || length.Int64() > 1<<20 {
+			return nil, fmt.Errorf("string length %s is not plausible", length)
+		}
+		n := int(length.Int64())
+		slot := crypto.Keccak256Hash(common.BigToHash(loc.slot).Bytes()).Big()
+		for len(data) < n {
+			part, err := r.word(ctx, slot)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, part[:min(32, n-len(data))]...)
+			slot = new(big.Int).Add(slot, big.NewInt(1))
+		}
+	}
+	if strings.HasPrefix(loc.typ, "t_string") {
+		return string(data), nil
+	}
+	return data, nil
+}
+
+// formatStored renders a value read-var decoded: strings quoted, arrays and
+// structs spelled out, everything else as formatValue does.
+func formatStored(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return strconv.Quote(x)
+	case []interface{}:
+		parts := make([]string, len(x))
+		for i, e := range x {
+			parts[i] = formatStored(e)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case storedStruct:
+		parts := make([]string, len(x))
+		for i, m := range x {
+			parts[i] = m.Name + ": " + formatStored(m.Value)
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	}
+	return formatValue(v)
+}
+
+// storedJSON is v for the JSON report, structs as objects.
+func storedJSON(v interface{}) interface{} {
+	switch x := v.(type) {
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, e := range x {
+			out[i] = storedJSON(e)
+		}
+		return out
+	case storedStruct:
+		out := make(map[string]interface{}, len(x))
+		for _, m := range x {
+			out[m.Name] = storedJSON(m.Value)
+		}
+		return out
+	}
+	return jsonValue(v)
+}
+
+// runReadVar implements `read-var [flags] <address> <variable>`.
+func runReadVar(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("read-var", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	var keys []string
+	o.register(fs)
+	ao.register(fs, "")
+	blockFlag := fs.String("block", "", "block number to read at (default latest)")
+	fs.Func("key", "mapping key, e.g. 0x... or \"name\"; repeat for mappings of mappings, outermost first", func(v string) error {
+		keys = append(keys, v)
+		return nil
+	})
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("usage: read-var [flags] <address> <variable[.member][[index]]>")
+	}
+	address, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	block, err := parseBlock(*blockFlag)
+	if err != nil {
+		return err
+	}
+	path, contract, err := ao.resolve()
+	if err != nil {
+		return err
+	}
+	c, err := loadABI(path, contract)
+	if err != nil {
+		return err
+	}
+	l, err := layoutOf(c)
+	if err != nil {
+		return err
+	}
+
+	client, _, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	r := &varReader{client: client, address: address, block: block, layout: l, words: map[string]common.Hash{}}
+	loc, name, err := r.locate(ctx, fs.Arg(1), keys)
+	if err != nil {
+		return err
+	}
+	value, err := r.read(ctx, loc)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	label := l.Types[loc.typ].Label
+	ui.report.Variable = &VariableReport{Address: address, Name: name, Keys: keys, Type: label, Slot: common.BigToHash(loc.slot), Offset: loc.offset, Value: storedJSON(value)}
+	ui.Resultf("Variable: %s (%s)\n", name, label)
+	ui.Resultf("Slot:     %s offset %d\n", common.BigToHash(loc.slot).Hex(), loc.offset)
+	ui.Resultf("Value:    %s\n", formatStored(value))
+	return nil
+}
@@ -0,0 +1,59 @@
+package deployer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// TestStorageKey checks the keys read-var hashes for each mapping key
+// type of a storage layout.
+func TestStorageKey(t *testing.T) {
+	slot := common.LeftPadBytes([]byte{3}, 32)
+	for _, tt := range []struct {
+		id, label, key string
+		want           string // the key as hashed, hex
+	}{
+		{"t_address", "address", testAddr.Hex(), "000000000000000000000000" + strings.ToLower(testAddr.Hex()[2:])},
+		{"t_contract(IERC20)12", "contract IERC20", testAddr.Hex(), "000000000000000000000000" + strings.ToLower(testAddr.Hex()[2:])},
+		{"t_uint256", "uint256", "255", strings.Repeat("0", 62) + "ff"},
+		{"t_int8", "int8", "-2", strings.Repeat("f", 63) + "e"},
+		{"t_bool", "bool", "true", strings.Repeat("0", 63) + "1"},
+		{"t_bool", "bool", "false", strings.Repeat("0", 64)},
+		{"t_bytes4", "bytes4", "0xdeadbeef", "deadbeef" + strings.Repeat("0", 56)},
+		{"t_bytes_memory_ptr", "bytes", "0xdeadbeef", "deadbeef"},
+		{"t_string_memory_ptr", "string", "hello", "68656c6c6f"},
+		{"t_string_memory_ptr", "string", `"a b"`, "612062"},
+	} {
+		got, err := storageKey(storageType{Label: tt.label}, tt.id, tt.key)
+		if err != nil {
+			t.Errorf("%s key %s: %v", tt.label, tt.key, err)
+			continue
+		}
+		if common.Bytes2Hex(got) != tt.want {
+			t.Errorf("%s key %s = %x, want %s", tt.label, tt.key, got, tt.want)
+		}
+	}
+	// With an address key, read-var and storage agree on the slot.
+	key, err := storageKey(storageType{Label: "address"}, "t_address", testAddr.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := parseSlot("mapping(3, " + testAddr.Hex() + ")")
+	if err != nil || crypto.Keccak256Hash(key, slot) != want {
+		t.Errorf("read-var slot %s, storage slot %s (%v)", crypto.Keccak256Hash(key, slot).Hex(), want.Hex(), err)
+	}
+
+	for _, tt := range []struct{ id, label, key, want string }{
+		{"t_bool", "bool", "1", `invalid bool key "1"`},
+		{"t_bytes4", "bytes4", "0xdeadbeef00", `invalid bytes4 key "0xdeadbeef00"`},
+		{"t_address", "address", "0x1234", `invalid address key "0x1234"`},
+		{"t_bytes_memory_ptr", "bytes", "0xzz", `invalid bytes key "0xzz"`},
+	} {
+		if _, err := storageKey(storageType{Label: tt.label}, tt.id, tt.key); err == nil || err.Error() != tt.want {
+			t.Errorf("%s key %s = %v, want %q", tt.label, tt.key, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package deployer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// txSummary is what a transaction does, for the summary shown before it
+// is signed or when it is dry-run. Fees, gas and nonce come from the
+// transact opts.
+type txSummary struct {
+	to   *common.Address // nil for a contract creation
+	call string          // function or constructor with decoded arguments
+
+	// For the broadcast file: the contract deployed, the function called
+	// ("" for a constructor or plain transfer) and its arguments, and
+	// the address a CREATE2 deployment creates.
+	contract string
+	fn       string
+	args     []string
+	created  *common.Address
+
+	// artifact is the file the deployed contract came from, for the
+	// journal to record it from should the run die first.
+	artifact string
+}
+
+// constructorSummary describes deploying c with args.
+func constructorSummary(c *Artifact, args []interface{}) txSummary {
+	return txSummary{
+		call:     fmt.Sprintf("%s constructor(%s)", c.Name, formatArgs(c.ABI.Constructor.Inputs, args)),
+		contract: c.Name,
+		args:     plainArgs(args),
+		artifact: c.Path,
+	}
+}
+
+// methodSummary describes calling m on to with args.
+func methodSummary(to common.Address, m *abi.Method, args []interface{}) txSummary {
+	return txSummary{
+		to:   &to,
+		call: fmt.Sprintf("%s(%s)", m.RawName, formatArgs(m.Inputs, args)),
+		fn:   m.Sig,
+		args: plainArgs(args),
+	}
+}
+
+// plainArgs formats vals one by one as formatValue does, but with bare
+// addresses rather than ENS names.
+func plainArgs(vals []interface{}) []string {
+	out := make([]string, len(vals))
+	for i, v := range vals {
+		if a, ok := v.(common.Address); ok {
+			out[i] = a.Hex()
+		} else {
+			out[i] = formatValue(v)
+		}
+	}
+	return out
+}
+
+// printSummary prints sum as opts would sign it, and returns the most it
+// can cost: the gas limit at the maximum fee, plus the value and, on the
+// OP Stack, the L1 data fee.
+func (s *session) printSummary(sum txSummary, opts *bind.TransactOpts) *big.Int {
+	to := "CONTRACT CREATION"
+	if sum.to != nil {
+		to = s.names.label(*sum.to)
+	}
+	cost := new(big.Int)
+	if price := maxGasPrice(opts); price != nil {
+		cost.Mul(new(big.Int).SetUint64(opts.GasLimit), price)
+	}
+	if opts.Value != nil {
+		cost.Add(cost, opts.Value)
+	}
+	if s.pendingL1Fee != nil {
+		cost.Add(cost, s.pendingL1Fee)
+	}
+	nonce := "next pending"
+	if opts.Nonce != nil {
+		nonce = opts.Nonce.String()
+	}
+	s.ui.Printf("Transaction on %s (chain %s):\n", chainName(s.chainID), s.chainID)
+	s.ui.Printf("  to:        %s\n", to)
+	s.ui.Printf("  call:      %s\n", sum.call)
+	s.ui.Printf("  value:     %s ETH\n", formatEther(opts.Value))
+	s.ui.Printf("  gas limit: %d\n", opts.GasLimit)
+	s.ui.Printf("  fees:      %s\n", describeFees(opts))
+	if h := s.fees.History; h != nil && h.basis != "" {
+		s.ui.Printf("  fee basis: %s\n", h.basis)
+	}
+	if opts.AccessList != nil {
+		s.ui.Printf("  access:    %s\n", describeAccessList(opts.AccessList))
+	}
+	if s.pendingL1Fee != nil {
+		s.ui.Printf("  L1 fee:    %s ETH (data posted to L1, on top of gas)\n", formatEther(s.pendingL1Fee))
+	}
+	s.ui.Printf("  max cost:  %s ETH\n", formatEther(cost))
+	s.ui.Printf("  nonce:     %s\n", nonce)
+	return cost
+}
+
+// confirmSend shows sum and, off the local dev chain, asks before the
+// transaction is signed. --yes answers for the user.
+func (s *session) confirmSend(sum txSummary, opts *bind.TransactOpts) error {
+	defer func() { s.pendingL1Fee = nil }()
+	if s.chainID.Uint64() == localChainID {
+		return nil
+	}
+	s.printSummary(sum, opts)
+	if s.yes {
+		return nil
+	}
+	if s.stdin != nil {
+		return askConfirm(s.stdin, true)
+	}
+	return askConfirm(os.Stdin, isTerminal(os.Stdin))
+}
+
+// askConfirm reads an answer from in and fails unless it is "y". Without
+// a terminal nobody can answer, so it fails at once instead of blocking.
+func askConfirm(in io.Reader, interactive bool) error {
+	if !interactive {
+		return errors.New("not signing without confirmation: stdin is not a terminal; pass --yes to sign without asking")
+	}
+	ui.Printf("Sign and send? [y/N] ")
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && answer == "" {
+		return fmt.Errorf("confirm: %w", err)
+	}
+	if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+		return classify(ErrUserAborted, errors.New("not confirmed; nothing was signed"))
+	}
+	return nil
+}
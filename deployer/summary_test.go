@@ -0,0 +1,41 @@
+package deployer
+
+import (
+	"errors"
+	"io"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+)
+
+func TestConfirmSend(t *testing.T) {
+	sum := txSummary{call: "Greeter constructor(\"hi\")"}
+	for _, tt := range []struct {
+		name, answer string
+		want         error // nil to sign
+	}{
+		{"accept", "y\n", nil},
+		{"accept in full", " YES \n", nil},
+		{"reject", "n\n", ErrUserAborted},
+		{"empty answer", "\n", ErrUserAborted},
+		{"EOF", "", io.EOF},
+	} {
+		s := &session{env: cli, chainID: big.NewInt(1), stdin: strings.NewReader(tt.answer)}
+		err := s.confirmSend(sum, &bind.TransactOpts{GasLimit: 21000})
+		if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// The local dev chain and --yes never read an answer.
+	for _, s := range []*session{
+		{env: cli, chainID: big.NewInt(localChainID), stdin: strings.NewReader("")},
+		{env: cli, chainID: big.NewInt(1), yes: true, stdin: strings.NewReader("")},
+	} {
+		if err := s.confirmSend(sum, &bind.TransactOpts{GasLimit: 21000}); err != nil {
+			t.Errorf("chain %s, --yes %v: %v", s.chainID, s.yes, err)
+		}
+	}
+}
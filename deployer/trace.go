@@ -0,0 +1,370 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// callTracer is the tracer configuration every trace is made with.
+var callTracer = map[string]interface{}{"tracer": "callTracer"}
+
+// callFrame is one call in callTracer output; Calls are the calls it made.
+type callFrame struct {
+	Type         string          `json:"type"`
+	From         common.Address  `json:"from"`
+	To           *common.Address `json:"to"`
+	Value        *hexutil.Big    `json:"value"`
+	GasUsed      hexutil.Uint64  `json:"gasUsed"`
+	Input        hexutil.Bytes   `json:"input"`
+	Output       hexutil.Bytes   `json:"output"`
+	Error        string          `json:"error"`
+	RevertReason string          `json:"revertReason"`
+	Calls        []*callFrame    `json:"calls"`
+	Logs         []callLog       `json:"logs"`
+}
+
+// callLog is a log in callTracer output made with withLog; Position is how
+// many of the frame's calls came before it.
+type callLog struct {
+	Address  common.Address `json:"address"`
+	Topics   []common.Hash  `json:"topics"`
+	Data     hexutil.Bytes  `json:"data"`
+	Position hexutil.Uint   `json:"position"`
+}
+
+// size counts f and every call under it.
+func (f *callFrame) size() int {
+	n := 1
+	for _, c := range f.Calls {
+		n += c.size()
+	}
+	return n
+}
+
+// logs returns the logs emitted by f and the calls under it, in the order
+// they were emitted. A failed frame's logs were reverted with it.
+func (f *callFrame) logs() []*types.Log {
+	if f.Error != "" {
+		return nil
+	}
+	var out []*types.Log
+	emit := func(pos int) {
+		for _, l := range f.Logs {
+			if int(l.Position) == pos {
+				out = append(out, &types.Log{Address: l.Address, Topics: l.Topics, Data: l.Data})
+			}
+		}
+	}
+	for i, c := range f.Calls {
+		emit(i)
+		out = append(out, c.logs()...)
+	}
+	emit(len(f.Calls))
+	return out
+}
+
+// traceOptions are the flags of `trace`.
+type traceOptions struct {
+	raw       bool
+	depth     int
+	maxFrames int
+	maxData   int
+}
+
+func (o *traceOptions) register(fs *flag.FlagSet) {
+	fs.BoolVar(&o.raw, "raw", false, "print the tracer's JSON instead of the call tree")
+	fs.IntVar(&o.depth, "depth", 0, "print nested calls only this many levels deep (0 prints all)")
+	fs.IntVar(&o.maxFrames, "max-frames", 200, "stop after printing this many calls (0 prints all)")
+	fs.IntVar(&o.maxData, "max-data", 64, "shorten undecoded calldata and return data to this many bytes (0 prints all)")
+}
+
+// traceRPC calls a debug_trace* method on the pinned endpoint, so a
+// transaction is traced by the node it was sent to.
+func traceRPC(ctx context.Context, c *rpcClient, method string, args ...interface{}) (json.RawMessage, error) {
+	var raw json.RawMessage
+	e, err := c.pin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, err = call(ctx, c, e, method, func(ctx context.Context, cl *ethclient.Client) (struct{}, error) {
+		return struct{}{}, cl.Client().CallContext(ctx, &raw, method, args...)
+	})
+	if err == nil {
+		return raw, nil
+	}
+	var rpcErr rpc.Error
+	msg := strings.ToLower(err.Error())
+	if (errors.As(err, &rpcErr) && rpcErr.ErrorCode() == methodNotFound) || strings.Contains(msg, "method not found") || strings.Contains(msg, "does not exist") || strings.Contains(msg, "not available") {
+		return nil, fmt.Errorf("tracing not supported by this endpoint (%s)", method)
+	}
+	return nil, fmt.Errorf("%s: %w", method, err)
+}
+
+// tracePrinter prints a call tree, decoding frames with arts and, for
+// selectors none of them knows, sigs.
+type tracePrinter struct {
+	ctx     context.Context
+	o       traceOptions
+	arts    []*Artifact
+	sigs    *selectorDB
+	printed int
+	omitted int
+}
+
+// frameCall decodes f's input, returning nil for calldata nothing knows,
+// and the ABI of the artifact that matched, if one did.
+func (p *tracePrinter) frameCall(f *callFrame) (*decoded, *abi.ABI) {
+	d := decodeLocal(p.arts, f.Input)
+	if d == nil && len(f.Input) >= 4 && !strings.HasPrefix(f.Type, "CREATE") {
+		var err error
+		if d, err = p.sigs.decode(p.ctx, f.Input); err != nil {
+			ui.Warnf("warning: %v\n", err)
+		}
+	}
+	if d == nil {
+		return nil, nil
+	}
+	for _, a := range p.arts {
+		if a.Name == d.contract {
+			return d, &a.ABI
+		}
+	}
+	return d, nil
+}
+
+// data renders b as hex, shortened to --max-data bytes.
+func (p *tracePrinter) data(b []byte) string {
+	if p.o.maxData > 0 && len(b) > p.o.maxData {
+		return fmt.Sprintf("0x%x... (%d bytes)", b[:p.o.maxData], len(b))
+	}
+	return hexutil.Encode(b)
+}
+
+func (p *tracePrinter) print(f *callFrame, depth int) {
+	if p.o.maxFrames > 0 && p.printed >= p.o.maxFrames {
+		p.omitted += f.size()
+		return
+	}
+	p.printed++
+	indent := strings.Repeat("  ", depth)
+	d, contractABI := p.frameCall(f)
+
+	to := "?"
+	if f.To != nil {
+		to = f.To.Hex()
+	}
+	var what string
+	switch {
+	case d != nil && d.ctor:
+		what = fmt.Sprintf("new %s(%s)", d.contract, formatArgs(d.method.Inputs, d.args))
+	case d != nil && d.contract == "":
+		what = fmt.Sprintf("%s(%s)", d.method.RawName, formatArgs(d.method.Inputs, d.args))
+		if len(d.candidates) > 1 {
+			what += fmt.Sprintf(" [%d signatures share 0x%x: %s]", len(d.candidates), []byte(f.Input[:4]), strings.Join(d.candidates, ", "))
+		}
+	case d != nil:
+		what = fmt.Sprintf("%s.%s(%s)", d.contract, d.method.RawName, formatArgs(d.method.Inputs, d.args))
+	case strings.HasPrefix(f.Type, "CREATE"):
+		what = fmt.Sprintf("creation code (%d bytes)", len(f.Input))
+	case len(f.Input) == 0:
+		what = "(no calldata)"
+	case len(f.Input) >= 4:
+		what = fmt.Sprintf("0x%x(%s)", []byte(f.Input[:4]), p.data(f.Input[4:]))
+	default:
+		what = p.data(f.Input)
+	}
+	line := fmt.Sprintf("%s[%d] %s %s %s", indent, uint64(f.GasUsed), f.Type, to, what)
+	if v := f.Value.ToInt(); v != nil && v.Sign() > 0 {
+		line += fmt.Sprintf(" value %s ETH", formatEther(v))
+	}
+	ui.Resultln(line)
+
+	switch {
+	case f.Error != "":
+		reason := f.RevertReason
+		if reason == "" && len(f.Output) > 0 {
+			reason = decodeRevert(f.Output, contractABI)
+		}
+		if reason != "" {
+			ui.Resultf("%s  ! %s: %s\n", indent, f.Error, reason)
+		} else {
+			ui.Resultf("%s  ! %s\n", indent, f.Error)
+		}
+	case len(f.Output) > 0 && d != nil && !d.ctor && d.contract != "":
+		if vals, err := d.method.Outputs.Unpack(f.Output); err == nil {
+			ui.Resultf("%s  returns %s\n", indent, formatArgs(d.method.Outputs, vals))
+		} else {
+			ui.Resultf("%s  returns %s\n", indent, p.data(f.Output))
+		}
+	case len(f.Output) > 0 && !strings.HasPrefix(f.Type, "CREATE"):
+		ui.Resultf("%s  returns %s\n", indent, p.data(f.Output))
+	}
+
+	if p.o.depth > 0 && depth >= p.o.depth && len(f.Calls) > 0 {
+		hidden := f.size() - 1
+		ui.Resultf("%s  ... %d nested calls (see --depth)\n", indent, hidden)
+		return
+	}
+	for _, c := range f.Calls {
+		p.print(c, depth+1)
+	}
+}
+
+// printTrace prints raw, the callTracer result, as a call tree or, with
+// --raw, as indented JSON. The JSON report carries it as is.
+func printTrace(ctx context.Context, raw json.RawMessage, o traceOptions, arts []*Artifact, sigs *selectorDB) error {
+	ui.report.Trace = raw
+	if o.raw {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, raw, "", "  "); err != nil {
+			return fmt.Errorf("trace: %w", err)
+		}
+		ui.Resultln(buf.String())
+		return nil
+	}
+	var root callFrame
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return fmt.Errorf("trace: not callTracer output: %w", err)
+	}
+	p := &tracePrinter{ctx: ctx, o: o, arts: arts, sigs: sigs}
+	p.print(&root, 0)
+	if p.omitted > 0 {
+		ui.Resultf("... %d more calls (see --max-frames, or --raw)\n", p.omitted)
+	}
+	return nil
+}
+
+// runTrace implements `trace [flags] <txhash>` and `trace --call [flags]
+// <address> <function> [args...]`.
+func runTrace(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("trace", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	var to traceOptions
+	var do decodeOptions
+	o.register(fs)
+	ao.register(fs, "")
+	to.register(fs)
+	do.register(fs)
+	hypothetical := fs.Bool("call", false, "trace a call that is not sent, via debug_traceCall, instead of a mined transaction")
+	argsJSON := fs.String("args", "", "with --call, function arguments as a JSON array")
+	blockFlag := fs.String("block", "", "with --call, block to trace the call on (default latest)")
+	fromFlag := fs.String("from", "", "with --call, the caller (default the zero address)")
+	valueFlag := fs.String("value", "", "with --call, ether sent with the call, e.g. 0.1ether")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	usage := errors.New("usage: trace [flags] <txhash> | trace --call [flags] <address> <function> [args...]")
+
+	var arts []*Artifact
+	var c *Artifact
+	if ao.path != "" || ao.contract != "" {
+		path, contract, err := ao.resolve()
+		if err != nil {
+			return err
+		}
+		if c, err = loadABI(path, contract); err != nil {
+			return err
+		}
+		arts = append(arts, c)
+	}
+	arts = append(arts, scanArtifacts(ao.outDir)...)
+	ui.Verbosef("Loaded %d artifacts from %s\n", len(arts), ao.outDir)
+	sigs, err := do.open()
+	if err != nil {
+		return err
+	}
+	defer sigs.save()
+
+	if !*hypothetical {
+		if fs.NArg() != 1 {
+			return usage
+		}
+		raw, err := hexutil.Decode(fs.Arg(0))
+		if err != nil || len(raw) != common.HashLength {
+			return fmt.Errorf("invalid transaction hash %q", fs.Arg(0))
+		}
+		client, _, err := connect(ctx, &o)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		hash := common.BytesToHash(raw)
+		trace, err := traceRPC(ctx, client, "debug_traceTransaction", hash, callTracer)
+		if err != nil {
+			return err
+		}
+		ui.Resultf("Trace of %s:\n", hash.Hex())
+		return printTrace(ctx, trace, to, arts, sigs)
+	}
+
+	if fs.NArg() < 2 {
+		return usage
+	}
+	if c == nil {
+		return errors.New("trace --call needs --contract or --artifact to encode the call")
+	}
+	address, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	m, err := resolveMethod(&c.ABI, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	raw, err := rawArgs(fs.Args()[2:], *argsJSON)
+	if err != nil {
+		return err
+	}
+	callArgs, err := convertArgs(m.Inputs, raw)
+	if err != nil {
+		return fmt.Errorf("%s: %w", m.Sig, err)
+	}
+	data, err := c.ABI.Pack(m.Name, callArgs...)
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", m.Sig, err)
+	}
+	block, err := parseBlock(*blockFlag)
+	if err != nil {
+		return err
+	}
+	msg := map[string]interface{}{"to": address, "input": hexutil.Bytes(data)}
+	if *fromFlag != "" {
+		from, err := parseAddress(*fromFlag)
+		if err != nil {
+			return fmt.Errorf("--from: %w", err)
+		}
+		msg["from"] = from
+	}
+	value, err := parseValue(*valueFlag)
+	if err != nil {
+		return fmt.Errorf("--value: %w", err)
+	}
+	if value != nil {
+		msg["value"] = (*hexutil.Big)(value)
+	}
+
+	client, _, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	trace, err := traceRPC(ctx, client, "debug_traceCall", msg, blockArg(block), callTracer)
+	if err != nil {
+		return err
+	}
+	ui.Resultf("Trace of %s on %s:\n", m.Sig, address.Hex())
+	return printTrace(ctx, trace, to, arts, sigs)
+}
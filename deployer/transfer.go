@@ -0,0 +1,99 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// runTransfer implements `transfer [flags] <to> <amount>`: send ether,
+// optionally with raw calldata, and wait for it.
+func runTransfer(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("transfer", flag.ExitOnError)
+	var o options
+	var txo txOptions
+	o.register(fs)
+	dataFlag := fs.String("data", "", "raw calldata to send along, hex")
+	fs.Uint64Var(&txo.gasLimit, "gas-limit", 0, "exact gas limit (default 21000 to an account, padded estimate otherwise)")
+	fs.Int64Var(&txo.nonce, "nonce", -1, "nonce override (default pending nonce)")
+	fs.BoolVar(&txo.noWait, "no-wait", false, "print the transaction hash and exit without waiting")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("usage: transfer [flags] <to> <amount>, e.g. transfer 0x... 0.5ether")
+	}
+	to, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	amount, err := parseValue(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if amount == nil {
+		return errors.New("transfer: no amount given")
+	}
+	txo.value = fs.Arg(1)
+	var data []byte
+	if *dataFlag != "" {
+		if !strings.HasPrefix(*dataFlag, "0x") || len(*dataFlag)%2 != 0 {
+			return fmt.Errorf("--data: want 0x-prefixed hex, got %q", *dataFlag)
+		}
+		data = common.FromHex(*dataFlag)
+	}
+
+	s, err := openSession(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	opts, err := s.opts(ctx, txo)
+	if err != nil {
+		return err
+	}
+	code, err := s.client.CodeAt(ctx, to, nil)
+	if err != nil {
+		return fmt.Errorf("get code at %s: %w", to.Hex(), err)
+	}
+	if len(code) == 0 && len(data) == 0 && opts.GasLimit == 0 {
+		opts.GasLimit = params.TxGas
+		s.pendingL1Fee = s.estimateL1Fee(ctx, opts, ethereum.CallMsg{To: &to})
+	} else if err := s.setGasLimit(ctx, opts, ethereum.CallMsg{To: &to, Data: data}, nil); err != nil {
+		return fmt.Errorf("transfer: %w", err)
+	}
+
+	call := fmt.Sprintf("transfer %s ETH", formatEther(amount))
+	if len(data) > 0 {
+		call += fmt.Sprintf(" with calldata %s", formatValue(data))
+	}
+	bound := bind.NewBoundContract(to, abi.ABI{}, s.client, s.client, s.client)
+	tx, err := s.submit(ctx, opts, txSummary{to: &to, call: call}, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return bound.RawTransact(opts, data)
+	})
+	if err != nil {
+		return fmt.Errorf("transfer: %w", explainError(err, nil))
+	}
+	ui.Printf("Transfer tx: %s (%s ETH to %s)\n", tx.Hash().Hex(), formatEther(amount), to.Hex())
+	ui.link("tx", tx.Hash().Hex())
+	ui.Verbosef("  nonce %d, gas limit %d\n", tx.Nonce(), tx.Gas())
+	if txo.noWait {
+		return nil
+	}
+	rcpt, err := s.waitReceipt(ctx, tx, nil)
+	if err != nil {
+		return err
+	}
+	ui.report.Transactions = append(ui.report.Transactions, *newTxReport("transfer", rcpt, printEvents(ui, rcpt, nil)))
+	return nil
+}
@@ -0,0 +1,203 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// readTypedData reads an eth_signTypedData_v4 payload and returns it with
+// its EIP-712 digest. Integers in the message may be JSON numbers of any
+// size or decimal or 0x strings; bytes and bytesN are 0x strings.
+func readTypedData(path string) (*apitypes.TypedData, []byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read typed data: %w", err)
+	}
+	var td apitypes.TypedData
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&td); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if td.PrimaryType == "" || len(td.Types) == 0 {
+		return nil, nil, fmt.Errorf("%s: want an eth_signTypedData_v4 object with types, domain, primaryType and message", path)
+	}
+	if _, ok := td.Types["EIP712Domain"]; !ok {
+		return nil, nil, fmt.Errorf("%s: types has no EIP712Domain", path)
+	}
+	// apitypes reads plain JSON numbers as float64; strings keep large
+	// integers exact.
+	td.Message = exactNumbers(td.Message).(map[string]interface{})
+	digest, _, err := apitypes.TypedDataAndHash(td)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &td, digest, nil
+}
+
+// exactNumbers replaces the json.Numbers in a decoded JSON value with
+// their decimal strings.
+func exactNumbers(v interface{}) interface{} {
+	switch x := v.(type) {
+	case json.Number:
+		return x.String()
+	case map[string]interface{}:
+		for k, e := range x {
+			x[k] = exactNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range x {
+			x[i] = exactNumbers(e)
+		}
+	}
+	return v
+}
+
+// describeDomain prints what a typed data payload is scoped to, so the
+// signer sees it before signing.
+func describeDomain(td *apitypes.TypedData) {
+	ui.Printf("Typed data: %s", td.PrimaryType)
+	if td.Domain.Name != "" {
+		ui.Printf(" for %s", td.Domain.Name)
+		if td.Domain.Version != "" {
+			ui.Printf(" v%s", td.Domain.Version)
+		}
+	}
+	ui.Println()
+	if td.Domain.ChainId != nil {
+		id := (*big.Int)(td.Domain.ChainId)
+		ui.Printf("  chain %s (%s)\n", id, chainName(id))
+	}
+	if td.Domain.VerifyingContract != "" {
+		ui.Printf("  verifying contract %s\n", td.Domain.VerifyingContract)
+	}
+}
+
+// recoverSigner recovers who signed digest. sig's V may be 27/28, as
+// wallets produce it, or 0/1; it is returned with V as 27 or 28.
+func recoverSigner(digest, sig []byte) (common.Address, []byte, error) {
+	rsv := common.CopyBytes(sig)
+	if rsv[64] >= 27 {
+		rsv[64] -= 27
+	}
+	if !crypto.ValidateSignatureValues(rsv[64], new(big.Int).SetBytes(rsv[:32]), new(big.Int).SetBytes(rsv[32:64]), true) {
+		return common.Address{}, nil, errors.New("invalid signature: bad v, or r or s out of range (including a malleable high s)")
+	}
+	pub, err := crypto.SigToPub(digest, rsv)
+	if err != nil {
+		return common.Address{}, nil, fmt.Errorf("recover signer: %w", err)
+	}
+	rsv[64] += 27
+	return crypto.PubkeyToAddress(*pub), rsv, nil
+}
+
+// parseSignature parses a 65-byte [R || S || V] signature in 0x hex.
+func parseSignature(s string) ([]byte, error) {
+	sig, err := hexutil.Decode(s)
+	if err != nil || len(sig) != crypto.SignatureLength {
+		return nil, fmt.Errorf("invalid signature %q: want 65 bytes of 0x hex", s)
+	}
+	return sig, nil
+}
+
+// newSignatureReport splits a 65-byte signature with V as 27 or 28.
+func newSignatureReport(digest []byte, signer common.Address, sig []byte) *SignatureReport {
+	return &SignatureReport{
+		Digest:    hexutil.Encode(digest),
+		Signer:    signer,
+		Signature: hexutil.Encode(sig),
+		R:         hexutil.Encode(sig[:32]),
+		S:         hexutil.Encode(sig[32:64]),
+		V:         sig[64],
+	}
+}
+
+// runSignTypedData implements `sign-typed-data [flags] <file.json>`:
+// sign an EIP-712 payload with the deployer's key, as eth_signTypedData_v4
+// would.
+func runSignTypedData(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("sign-typed-data", flag.ExitOnError)
+	var o options
+	o.register(fs)
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: sign-typed-data [flags] <file.json>")
+	}
+	td, digest, err := readTypedData(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	signer, err := LoadSigner(o.keys)
+	if err != nil {
+		return err
+	}
+	ui.Printf("Signer: %s (%s)\n", signer.Address.Hex(), signer.Source)
+	describeDomain(td)
+
+	sig, err := signer.SignHash(digest)
+	if err != nil {
+		return fmt.Errorf("sign: %w", err)
+	}
+	sig[64] += 27
+	report := newSignatureReport(digest, signer.Address, sig)
+	ui.Resultf("Digest:    %s\n", report.Digest)
+	ui.Resultf("r:         %s\n", report.R)
+	ui.Resultf("s:         %s\n", report.S)
+	ui.Resultf("v:         %d\n", report.V)
+	ui.Resultf("Signature: %s\n", report.Signature)
+	ui.report.TypedData = report
+	return nil
+}
+
+// runVerifyTypedData implements `verify-typed-data [--signer address]
+// <file.json> <signature>`: recover who signed an EIP-712 payload.
+func runVerifyTypedData(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("verify-typed-data", flag.ExitOnError)
+	ui.register(fs)
+	expect := fs.String("signer", "", "fail unless the signature is from this address")
+	pos := parseInterspersed(fs, args)
+	if len(pos) != 2 {
+		return errors.New("usage: verify-typed-data <file.json> <signature> [--signer address]")
+	}
+	sig, err := parseSignature(pos[1])
+	if err != nil {
+		return err
+	}
+	var want common.Address
+	if *expect != "" {
+		if want, err = parseAddress(*expect); err != nil {
+			return fmt.Errorf("--signer: %w", err)
+		}
+	}
+	td, digest, err := readTypedData(pos[0])
+	if err != nil {
+		return err
+	}
+	describeDomain(td)
+
+	signer, rsv, err := recoverSigner(digest, sig)
+	if err != nil {
+		return err
+	}
+	report := newSignatureReport(digest, signer, rsv)
+	ui.report.TypedData = report
+	ui.Resultf("Digest: %s\n", report.Digest)
+	ui.Resultf("Signer: %s\n", signer.Hex())
+	if *expect != "" && signer != want {
+		return fmt.Errorf("signature is from %s, not %s", signer.Hex(), want.Hex())
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package deployer
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// units maps amount suffixes to their power of ten in wei.
+var units = []struct {
+	suffix string
+	exp    int64
+}{
+	// Longest suffixes first so "gwei" is not read as "wei".
+	{"ether", 18},
+	{"gwei", 9},
+	{"wei", 0},
+}
+
+// parseValue parses an amount such as "1000", "21000gwei" or "0.5ether"
+// into wei. Decimals are exact; amounts that don't resolve to a whole
+// number of wei are rejected. An empty string yields nil.
+func parseValue(s string) (*big.Int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	num, exp := s, int64(0)
+	for _, u := range units {
+		if strings.HasSuffix(strings.ToLower(s), u.suffix) {
+			num, exp = strings.TrimSpace(s[:len(s)-len(u.suffix)]), u.exp
+			break
+		}
+	}
+	r, ok := scaleDecimal(num, exp)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+	if !r.IsInt() {
+		return nil, fmt.Errorf("amount %q is not a whole number of wei", s)
+	}
+	return new(big.Int).Set(r.Num()), nil
+}
+
+// scaleDecimal parses a plain decimal such as "1.5" exactly and
+// multiplies it by 10^exp.
+func scaleDecimal(num string, exp int64) (*big.Rat, bool) {
+	// Plain decimals only: big.Rat would also accept fractions, exponents
+	// and base prefixes.
+	if strings.Trim(num, "0123456789.") != "" || strings.Count(num, ".") > 1 || strings.Trim(num, ".") == "" {
+		return nil, false
+	}
+	r, ok := new(big.Rat).SetString(num)
+	if !ok {
+		return nil, false
+	}
+	return r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(exp), nil))), true
+}
+
+// formatEther renders wei as a decimal ether amount without rounding.
+func formatEther(wei *big.Int) string {
+	return formatUnits(wei, 18)
+}
+
+// formatUnits renders v, an integer in units of 10^-decimals, as a
+// decimal without rounding.
+func formatUnits(v *big.Int, decimals uint8) string {
+	if v == nil {
+		return "0"
+	}
+	r := new(big.Rat).SetFrac(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	s := r.FloatString(int(decimals))
+	if decimals > 0 {
+		s = strings.TrimRight(s, "0")
+	}
+	return strings.TrimSuffix(s, ".")
+}
@@ -0,0 +1,96 @@
+package deployer
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestParseValue(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"1000", "1000"},
+		{"1000wei", "1000"},
+		{"21000gwei", "21000000000000"},
+		{"1.5gwei", "1500000000"},
+		{"0.000000001gwei", "1"},
+		{"0.5ether", "500000000000000000"},
+		{"1 ETHER", "1000000000000000000"},
+		{" 2 Gwei ", "2000000000"},
+		{".25ether", "250000000000000000"},
+		{"3.ether", "3000000000000000000"},
+		{"0.000000000000000001ether", "1"},
+		{"115792089237316195423570985008687907853269984665640564039457.584007913129639935ether", "115792089237316195423570985008687907853269984665640564039457584007913129639935"},
+	} {
+		got, err := parseValue(tt.in)
+		if err != nil || got.String() != tt.want {
+			t.Errorf("parseValue(%q) = %v, %v; want %s", tt.in, got, err, tt.want)
+		}
+	}
+	if v, err := parseValue(""); v != nil || err != nil {
+		t.Errorf("parseValue(\"\") = %v, %v; want nil", v, err)
+	}
+
+	for _, tt := range []struct{ in, want string }{
+		// More decimals than the unit has wei
+		{"1.5wei", `amount "1.5wei" is not a whole number of wei`},
+		{"0.1", `amount "0.1" is not a whole number of wei`},
+		{"1.0000000001gwei", `amount "1.0000000001gwei" is not a whole number of wei`},
+		{"0.0000000000000000001ether", `amount "0.0000000000000000001ether" is not a whole number of wei`},
+		// Not plain decimals
+		{"ether", `invalid amount "ether"`},
+		{"-1ether", `invalid amount "-1ether"`},
+		{"1e18", `invalid amount "1e18"`},
+		{"1/2ether", `invalid amount "1/2ether"`},
+		{"0x10", `invalid amount "0x10"`},
+		{"1.2.3gwei", `invalid amount "1.2.3gwei"`},
+		{".gwei", `invalid amount ".gwei"`},
+		{"10 finney", `invalid amount "10 finney"`},
+	} {
+		if _, err := parseValue(tt.in); err == nil || err.Error() != tt.want {
+			t.Errorf("parseValue(%q) = %v, want %q", tt.in, err, tt.want)
+		}
+	}
+}
+
+func TestFormatUnits(t *testing.T) {
+	for _, tt := range []struct {
+		wei      string
+		decimals uint8
+		want     string
+	}{
+		{"0", 18, "0"},
+		{"1", 18, "0.000000000000000001"},
+		{"1000000000000000000", 18, "1"},
+		{"1500000000000000000", 18, "1.5"},
+		{"123456789", 9, "0.123456789"},
+		{"21000000000000", 9, "21000"},
+		{"100", 0, "100"},
+		{"-2500000000", 9, "-2.5"},
+	} {
+		v, _ := new(big.Int).SetString(tt.wei, 10)
+		if got := formatUnits(v, tt.decimals); got != tt.want {
+			t.Errorf("formatUnits(%s, %d) = %s, want %s", tt.wei, tt.decimals, got, tt.want)
+		}
+	}
+	if got := formatUnits(nil, 18); got != "0" {
+		t.Errorf("formatUnits(nil) = %s", got)
+	}
+	if got := formatEther(big.NewInt(1)); got != "0.000000000000000001" {
+		t.Errorf("formatEther(1) = %s", got)
+	}
+}
+
+// TestUnitsRoundTrip formats amounts in each unit and parses them back.
+func TestUnitsRoundTrip(t *testing.T) {
+	amounts := []string{"0", "1", "999", "1000000000", "1234567890123456789", "21000000000000", strings.Repeat("9", 30)}
+	for _, u := range units {
+		for _, a := range amounts {
+			wei, _ := new(big.Int).SetString(a, 10)
+			s := formatUnits(wei, uint8(u.exp)) + u.suffix
+			got, err := parseValue(s)
+			if err != nil || got.Cmp(wei) != 0 {
+				t.Errorf("%s wei as %q parsed back as %v, %v", a, s, got, err)
+			}
+		}
+	}
+}
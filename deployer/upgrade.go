@@ -0,0 +1,375 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// upgradeABI holds the upgrade entry points of UUPS implementations and
+// transparent proxies (upgradeTo, upgradeToAndCall) and of ProxyAdmin
+// (upgrade, upgradeAndCall), across OpenZeppelin v4 and v5.
+const upgradeABI = `[
+{"type":"function","name":"upgradeTo","stateMutability":"nonpayable","inputs":[{"name":"newImplementation","type":"address"}],"outputs":[]},
+{"type":"function","name":"upgradeToAndCall","stateMutability":"payable","inputs":[{"name":"newImplementation","type":"address"},{"name":"data","type":"bytes"}],"outputs":[]},
+{"type":"function","name":"upgrade","stateMutability":"nonpayable","inputs":[{"name":"proxy","type":"address"},{"name":"implementation","type":"address"}],"outputs":[]},
+{"type":"function","name":"upgradeAndCall","stateMutability":"payable","inputs":[{"name":"proxy","type":"address"},{"name":"implementation","type":"address"},{"name":"data","type":"bytes"}],"outputs":[]},
+{"type":"function","name":"owner","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"address"}]},
+` + upgradedEvent + `
+]`
+
+// upgradeRoute is one call that points a proxy at a new implementation.
+type upgradeRoute struct {
+	to     common.Address
+	method string
+	args   []interface{}
+}
+
+// upgradeRoutes lists the calls that could upgrade proxy to impl, best
+// first: through admin when it is a ProxyAdmin the sender does not act
+// as, otherwise on the proxy itself. v5 contracts only have the AndCall
+// forms, which v4 ones force-call even with empty data, so without data
+// the plain forms follow as fallbacks.
+func upgradeRoutes(proxy common.Address, admin *common.Address, impl common.Address, data []byte) []upgradeRoute {
+	if data == nil {
+		data = []byte{}
+	}
+	if admin != nil {
+		routes := []upgradeRoute{{*admin, "upgradeAndCall", []interface{}{proxy, impl, data}}}
+		if len(data) == 0 {
+			routes = append(routes, upgradeRoute{*admin, "upgrade", []interface{}{proxy, impl}})
+		}
+		return routes
+	}
+	routes := []upgradeRoute{{proxy, "upgradeToAndCall", []interface{}{impl, data}}}
+	if len(data) == 0 {
+		routes = append(routes, upgradeRoute{proxy, "upgradeTo", []interface{}{impl}})
+	}
+	return routes
+}
+
+// findProxied returns the manifest name and latest record of the
+// deployment whose address is proxy, or a nil record.
+func findProxied(dir string, chainID *big.Int, proxy common.Address) (string, *Deployment, error) {
+	manifests, err := listManifests(dir, chainID)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, m := range manifests {
+		for i := len(m.Deployments) - 1; i >= 0; i-- {
+			if m.Deployments[i].Address == proxy {
+				return m.Contract, &m.Deployments[i], nil
+			}
+		}
+	}
+	return "", nil, nil
+}
+
+// previousArtifact finds the artifact of the implementation d records:
+// the file it names if its bytecode still hashes to d.BytecodeHash,
+// otherwise any artifact under outDir that does.
+func previousArtifact(outDir string, d *Deployment) (*Artifact, error) {
+	if a, err := LoadArtifact(d.Artifact, ""); err == nil && crypto.Keccak256Hash(a.Bytecode) == d.BytecodeHash {
+		return a, nil
+	}
+	for _, a := range scanArtifacts(outDir) {
+		if crypto.Keccak256Hash(a.Bytecode) == d.BytecodeHash {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("no artifact of the current implementation found: %s was recompiled or removed and nothing under %s has bytecode hash %s; pass --previous-artifact", d.Artifact, outDir, d.BytecodeHash.Hex())
+}
+
+// checkStorageLayout aborts unless next's storage layout is compatible
+// with prev's.
+func checkStorageLayout(prev, next *Artifact) error {
+	for _, a := range []*Artifact{prev, next} {
+		if a.StorageLayout == nil {
+			return fmt.Errorf("%s has no storageLayout; add extra_output = [\"storageLayout\"] to foundry.toml and rebuild, or pass --unsafe-skip-storage-check", a.Path)
+		}
+	}
+	problems, notes := compareLayouts(prev.StorageLayout, next.StorageLayout)
+	for _, n := range notes {
+		ui.Printf("  storage: %s\n", n)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("storage layout of %s is incompatible with %s:\n  - %s\n(--unsafe-skip-storage-check upgrades anyway)", next.Path, prev.Path, strings.Join(problems, "\n  - "))
+	}
+	ui.Printf("Storage layout compatible with %s (%d variables)\n", prev.Path, len(prev.StorageLayout.Storage))
+	return nil
+}
+
+// runUpgrade implements `upgrade [flags] <proxy>`: deploy the artifact as
+// the proxy's new implementation and point the proxy at it.
+func runUpgrade(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("upgrade", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	var lo linkOptions
+	txo := txOptions{nonce: -1}
+	o.register(fs)
+	ao.register(fs, "")
+	lo.register(fs)
+	fs.StringVar(&txo.value, "value", "", "ether to send with the upgrade call, for a payable --call")
+	fs.Uint64Var(&txo.gasLimit, "gas-limit", 0, "exact gas limit for the upgrade call (default padded estimate)")
+	previous := fs.String("previous-artifact", "", "artifact of the current implementation (default found through the manifest)")
+	skipCheck := fs.Bool("unsafe-skip-storage-check", false, "upgrade even if the storage layouts are incompatible or unknown")
+	call := fs.String("call", "", "function of the new implementation to run in the upgrade transaction, e.g. a migration")
+	callArgs := fs.String("call-args", "", "--call arguments as a JSON array")
+	ctorJSON := fs.String("constructor-args", "", "constructor arguments of the new implementation as a JSON array (needs --allow-constructor-args)")
+	allowCtor := fs.Bool("allow-constructor-args", false, "pass constructor arguments to the implementation, e.g. for immutables")
+	implFlag := fs.String("implementation", "", "use the new implementation already deployed at this address, e.g. one a Safe proposal points at, instead of deploying the artifact")
+	var so safeOptions
+	so.register(fs)
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: upgrade [flags] --artifact <NewImpl.json> <proxy>")
+	}
+	proxy, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := so.check(); err != nil {
+		return err
+	}
+	path, contract, err := ao.resolve()
+	if err != nil {
+		return err
+	}
+	c, err := loadArtifact(path, contract)
+	if err != nil {
+		return err
+	}
+	ctorArgs, err := constructorArgs(c, nil, *ctorJSON)
+	if err != nil {
+		return err
+	}
+	if len(ctorArgs) > 0 && !*allowCtor {
+		return fmt.Errorf("%s: constructor state is invisible through the proxy; use --call for migrations, or --allow-constructor-args for immutables", c.Name)
+	}
+	var data []byte
+	if *call != "" {
+		if data, err = encodeCall(&c.ABI, *call, *callArgs, "Migration"); err != nil {
+			return fmt.Errorf("--call: %w", err)
+		}
+	} else if *callArgs != "" {
+		return errors.New("--call-args given without --call")
+	}
+
+	s, err := openSession(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	// Through a Safe, the Safe is the one upgrading: it is what must own
+	// the proxy or its admin.
+	sender := s.from
+	var sa *safeAccount
+	if so.safe != "" {
+		if sa, err = s.loadSafe(ctx, so); err != nil {
+			return err
+		}
+		sender = sa.address
+	}
+	r, err := readProxy(ctx, s.client, proxy, nil)
+	if err != nil {
+		return err
+	}
+	switch r.Kind {
+	case "none":
+		return fmt.Errorf("%s is not an EIP-1967 proxy: its implementation slot is empty", proxy.Hex())
+	case "beacon":
+		return fmt.Errorf("%s is a beacon proxy; upgrade its beacon %s instead", proxy.Hex(), r.Beacon.Hex())
+	}
+	ui.Printf("Proxy:          %s (%s)\n", proxy.Hex(), proxyKinds[r.Kind])
+	ui.Printf("Implementation: %s\n", r.Implementation.Hex())
+
+	name, rec, err := findProxied(o.deployments, s.chainID, proxy)
+	if err != nil {
+		return err
+	}
+	if rec != nil && rec.Proxy != nil && rec.Proxy.Implementation != *r.Implementation {
+		ui.Warnf("Warning: %s records implementation %s, but the proxy points at %s; it was upgraded outside this tool\n", manifestPath(o.deployments, s.chainID, name), rec.Proxy.Implementation.Hex(), r.Implementation.Hex())
+	}
+	if !*skipCheck {
+		var prev *Artifact
+		switch {
+		case *previous != "":
+			prev, err = loadABI(*previous, "")
+		case rec != nil:
+			prev, err = previousArtifact(ao.outDir, rec)
+		default:
+			err = fmt.Errorf("%s is not recorded in %s; pass --previous-artifact to check the storage layout", proxy.Hex(), o.deployments)
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkStorageLayout(prev, c); err != nil {
+			return err
+		}
+	} else {
+		ui.Warnf("Warning: --unsafe-skip-storage-check: storage layout not checked\n")
+	}
+
+	// A transparent proxy is upgraded by its admin: the sender itself, or
+	// a ProxyAdmin the sender owns.
+	var via *common.Address
+	if r.Kind == "transparent" && *r.Admin != sender {
+		via = r.Admin
+		var out []interface{}
+		admin := bind.NewBoundContract(*r.Admin, newUpgradeABI(), s.client, s.client, s.client)
+		if err := admin.Call(&bind.CallOpts{Context: ctx}, &out, "owner"); err != nil {
+			ui.Warnf("Warning: admin %s has no owner(): %v\n", r.Admin.Hex(), err)
+		} else if owner := out[0].(common.Address); owner != sender {
+			return fmt.Errorf("proxy admin %s is owned by %s, not the sender %s", r.Admin.Hex(), owner.Hex(), sender.Hex())
+		}
+	}
+
+	libs, err := parseLibraries(lo.libraries)
+	if err != nil {
+		return err
+	}
+	if err := linkLibraries(c, libs, o.deployments, s.chainID); err != nil {
+		return err
+	}
+	var impl common.Address
+	var d *Deployment
+	if *implFlag != "" {
+		if impl, err = s.existingImplementation(ctx, *implFlag, c); err != nil {
+			return err
+		}
+		d = &Deployment{Deployer: s.from}
+	} else if impl, d, _, err = s.deployContract(ctx, c, deployOptions{tx: txOptions{nonce: -1}}, ctorArgs); err != nil {
+		return err
+	}
+
+	uABI := newUpgradeABI()
+	mergeEvents(&uABI, &c.ABI)
+	value, err := parseValue(txo.value)
+	if err != nil {
+		return err
+	}
+	var route *upgradeRoute
+	var firstErr error
+	for _, rt := range upgradeRoutes(proxy, via, impl, data) {
+		input, err := uABI.Pack(rt.method, rt.args...)
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", rt.method, err)
+		}
+		_, err = s.client.CallContract(ctx, ethereum.CallMsg{From: sender, To: &rt.to, Value: value, Data: input}, nil)
+		if err == nil {
+			route = &rt
+			break
+		}
+		if firstErr == nil {
+			firstErr = fmt.Errorf("%s on %s: %w", rt.method, rt.to.Hex(), explainError(err, &uABI))
+		}
+	}
+	if route == nil {
+		return fmt.Errorf("new implementation deployed at %s, but the upgrade would revert: %w", impl.Hex(), firstErr)
+	}
+
+	m := uABI.Methods[route.method]
+	var rcpt *types.Receipt
+	var events []decodedEvent
+	if sa != nil {
+		if rcpt, events, err = s.viaSafe(ctx, sa, so, txo, route.to, value, &m, route.args, &uABI); err != nil {
+			return err
+		}
+		if rcpt == nil {
+			ui.Printf("%s is upgraded once the Safe executes this; to execute and record it here, run upgrade --implementation %s --via-safe %s --execute --signatures <sig,...>\n", proxy.Hex(), impl.Hex(), sa.address.Hex())
+			return nil
+		}
+	} else {
+		bound := bind.NewBoundContract(route.to, uABI, s.client, s.client, s.client)
+		tx, err := s.transact(ctx, bound, &uABI, &m, route.args, txo)
+		if err != nil {
+			return err
+		}
+		if rcpt, err = s.waitReceipt(ctx, tx, &uABI); err != nil {
+			return err
+		}
+		events = printEvents(ui, rcpt, &uABI)
+	}
+	word, err := readSlot(ctx, s.client, proxy, implementationSlot, nil)
+	if err != nil {
+		return err
+	}
+	if got, _ := wordAddress(word); got != impl {
+		return fmt.Errorf("upgrade mined, but the implementation slot holds %s, not %s", got.Hex(), impl.Hex())
+	}
+	previousImpl := *r.Implementation
+	r.Implementation, r.PreviousImplementation, r.ImplementationCodeHash = &impl, &previousImpl, nil
+	r.Upgrade = newTxReport(route.method, rcpt, events)
+	ui.report.Proxy = r
+	ui.Printf("Upgraded %s: %s -> %s\n", proxy.Hex(), previousImpl.Hex(), impl.Hex())
+	ui.link("tx", rcpt.TxHash.Hex())
+
+	if name == "" {
+		name = c.Name
+	}
+	// Keep the recorded kind: a UUPS proxy reads as plain EIP-1967 when
+	// the implementation lacks proxiableUUID().
+	kind := r.Kind
+	if rec != nil && rec.Proxy != nil {
+		kind = rec.Proxy.Kind
+	}
+	d.Proxy = &ProxyRecord{
+		Kind:                   kind,
+		Implementation:         impl,
+		ImplementationTxHash:   d.TxHash,
+		Admin:                  r.Admin,
+		InitData:               formatValue(data),
+		PreviousImplementation: &previousImpl,
+	}
+	d.Address, d.TxHash, d.BlockNumber = proxy, rcpt.TxHash, rcpt.BlockNumber.Uint64()
+	if d, err = recordDeploymentAs(o.deployments, s.chainID, name, c, ctorArgs, *d); err != nil {
+		return err
+	}
+	ui.Printf("Recorded %s v%d in %s\n", name, d.Version, manifestPath(o.deployments, s.chainID, name))
+	return nil
+}
+
+// existingImplementation checks that the code at the --implementation
+// address is c's before an upgrade points a proxy at it.
+func (s *session) existingImplementation(ctx context.Context, flagValue string, c *Artifact) (common.Address, error) {
+	impl, err := parseAddress(flagValue)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("--implementation: %w", err)
+	}
+	code, err := s.client.CodeAt(ctx, impl, nil)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("get code at %s: %w", impl.Hex(), err)
+	}
+	if len(code) == 0 {
+		return common.Address{}, fmt.Errorf("--implementation %s: no code at that address", impl.Hex())
+	}
+	s.ui.Printf("Using %s at %s as the new implementation\n", c.Name, impl.Hex())
+	if c.DeployedBytecode == nil {
+		s.ui.Warnf("Warning: artifact has no deployedBytecode; cannot check the code at %s is %s\n", impl.Hex(), c.Name)
+	} else if br := checkBytecode(impl, code, c); br.Status != "match" {
+		return common.Address{}, fmt.Errorf("--implementation %s: its code differs from %s at byte %d", impl.Hex(), c.Path, *br.Offset)
+	}
+	return impl, nil
+}
+
+// newUpgradeABI parses upgradeABI afresh, since callers merge into it.
+func newUpgradeABI() abi.ABI {
+	a, err := abi.JSON(strings.NewReader(upgradeABI))
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
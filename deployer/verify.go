@@ -0,0 +1,414 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// verifyPollInterval is how often verification status is checked;
+// explorers queue submissions for several seconds at least.
+const verifyPollInterval = 5 * time.Second
+
+// verifyOptions select the verification provider and the sources to
+// submit.
+type verifyOptions struct {
+	provider    string
+	apiURL      string
+	sourcifyURL string
+	metadata    string
+	sources     string
+	sourceRoot  string
+	timeout     time.Duration
+}
+
+func (o *verifyOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.provider, "provider", "etherscan", "verification service: etherscan or sourcify")
+	fs.StringVar(&o.apiURL, "etherscan-url", "", "Etherscan-compatible API URL (default by chain ID)")
+	fs.StringVar(&o.sourcifyURL, "sourcify-url", defaultSourcifyURL, "Sourcify server URL")
+	fs.StringVar(&o.metadata, "metadata", "", "compiler metadata JSON file (default from the artifact)")
+	fs.StringVar(&o.sources, "sources", "", "comma-separated extra source files to upload to Sourcify")
+	fs.StringVar(&o.sourceRoot, "source-root", ".", "project root the artifact's source paths are relative to")
+	fs.DurationVar(&o.timeout, "verify-timeout", 5*time.Minute, "give up waiting for the explorer after this long")
+}
+
+// apiFor returns the explorer API for chainID.
+func (o *verifyOptions) apiFor(chainID *big.Int) (string, error) {
+	if o.apiURL != "" {
+		return o.apiURL, nil
+	}
+	if u := chains[chainID.Uint64()].explorerAPI; u != "" {
+		return u, nil
+	}
+	return "", fmt.Errorf("no known explorer API for chain %s; pass --etherscan-url or set explorer_api under [chains.%s]", chainID, chainID)
+}
+
+// solcMetadata is the subset of compiler metadata verification needs.
+type solcMetadata struct {
+	Language string `json:"language"`
+	Compiler struct {
+		Version string `json:"version"`
+	} `json:"compiler"`
+	Settings map[string]json.RawMessage `json:"settings"`
+	Sources  map[string]struct {
+		Content string `json:"content"`
+	} `json:"sources"`
+}
+
+// parseMetadata decodes c's compiler metadata.
+func parseMetadata(c *Artifact) (*solcMetadata, error) {
+	if len(c.Metadata) == 0 {
+		return nil, fmt.Errorf("artifact %s has no metadata; build with metadata output (forge does by default) or pass --metadata", c.Path)
+	}
+	var md solcMetadata
+	if err := json.Unmarshal(c.Metadata, &md); err != nil {
+		return nil, fmt.Errorf("parse metadata: %w", err)
+	}
+	return &md, nil
+}
+
+// readSources returns the content of every source the metadata lists,
+// inlined or read from root, and the paths that could not be read.
+func readSources(md *solcMetadata, root string) (map[string]string, []string) {
+	contents := map[string]string{}
+	var missing []string
+	for path, src := range md.Sources {
+		if src.Content != "" {
+			contents[path] = src.Content
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(root, path))
+		if err != nil {
+			missing = append(missing, path)
+			continue
+		}
+		contents[path] = string(raw)
+	}
+	sort.Strings(missing)
+	return contents, missing
+}
+
+// standardInput rebuilds the solc standard-json input c was compiled
+// from, reading sources the metadata does not inline from root. It
+// returns the input, the source:Name identifier and the compiler version.
+func standardInput(c *Artifact, root string) ([]byte, string, string, error) {
+	md, err := parseMetadata(c)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if md.Compiler.Version == "" {
+		return nil, "", "", errors.New("metadata has no compiler version")
+	}
+
+	var target map[string]string
+	if raw := md.Settings["compilationTarget"]; raw != nil {
+		if err := json.Unmarshal(raw, &target); err != nil {
+			return nil, "", "", fmt.Errorf("parse compilationTarget: %w", err)
+		}
+	}
+	var contractName string
+	for source, name := range target {
+		contractName = source + ":" + name
+	}
+	if contractName == "" {
+		return nil, "", "", errors.New("metadata has no compilation target")
+	}
+
+	settings := map[string]interface{}{}
+	for k, v := range md.Settings {
+		if k != "compilationTarget" && k != "libraries" {
+			settings[k] = v
+		}
+	}
+	libraries := map[string]map[string]string{}
+	for _, lib := range c.Libraries {
+		if lib.Address == nil {
+			return nil, "", "", fmt.Errorf("library %s is not linked", lib.Name)
+		}
+		if libraries[lib.Source] == nil {
+			libraries[lib.Source] = map[string]string{}
+		}
+		libraries[lib.Source][lib.Name] = lib.Address.Hex()
+	}
+	if len(libraries) > 0 {
+		settings["libraries"] = libraries
+	}
+
+	contents, missing := readSources(md, root)
+	if len(missing) > 0 {
+		return nil, "", "", fmt.Errorf("sources not found under %s: %s", root, strings.Join(missing, ", "))
+	}
+	sources := map[string]map[string]string{}
+	for path, content := range contents {
+		sources[path] = map[string]string{"content": content}
+	}
+	language := md.Language
+	if language == "" {
+		language = "Solidity"
+	}
+	input, err := json.Marshal(map[string]interface{}{
+		"language": language,
+		"sources":  sources,
+		"settings": settings,
+	})
+	if err != nil {
+		return nil, "", "", err
+	}
+	return input, contractName, "v" + strings.TrimPrefix(md.Compiler.Version, "v"), nil
+}
+
+// etherscanResponse is the envelope of every Etherscan API answer.
+type etherscanResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Result  string `json:"result"`
+}
+
+// etherscan is a client for the contract verification API.
+type etherscan struct {
+	api    string
+	apiKey string
+	http   *http.Client
+}
+
+// do sends one API request; a POST when form is set.
+func (e *etherscan) do(ctx context.Context, query, form url.Values) (*etherscanResponse, error) {
+	query.Set("apikey", e.apiKey)
+	var req *http.Request
+	var err error
+	if form != nil {
+		form.Set("apikey", e.apiKey)
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, e.api, strings.NewReader(form.Encode()))
+		if req != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, e.api+"?"+query.Encode(), nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp, err := e.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var r etherscanResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("unexpected response: %s", strings.TrimSpace(string(body)))
+	}
+	return &r, nil
+}
+
+func alreadyVerified(result string) bool {
+	return strings.Contains(strings.ToLower(result), "already verified")
+}
+
+// verifyContract submits c at address to the chosen provider and waits
+// for the verdict. ctorData is the ABI-encoded constructor arguments;
+// Sourcify does not need them.
+func verifyContract(ctx context.Context, c *Artifact, address common.Address, ctorData []byte, chainID *big.Int, vo verifyOptions) error {
+	if vo.metadata != "" {
+		raw, err := os.ReadFile(vo.metadata)
+		if err != nil {
+			return fmt.Errorf("--metadata: %w", err)
+		}
+		c.Metadata = raw
+	}
+	if vo.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, vo.timeout)
+		defer cancel()
+	}
+	switch vo.provider {
+	case "etherscan":
+		return verifyEtherscan(ctx, c, address, ctorData, chainID, vo)
+	case "sourcify":
+		return verifySourcify(ctx, c, address, chainID, vo)
+	}
+	return fmt.Errorf("unknown --provider %q; want etherscan or sourcify", vo.provider)
+}
+
+// verifyEtherscan submits standard-json input and polls the GUID it gets
+// back until the explorer reports success or failure.
+func verifyEtherscan(ctx context.Context, c *Artifact, address common.Address, ctorData []byte, chainID *big.Int, vo verifyOptions) error {
+	apiKey := os.Getenv("ETHERSCAN_API_KEY")
+	if apiKey == "" {
+		return errors.New("ETHERSCAN_API_KEY is not set")
+	}
+	api, err := vo.apiFor(chainID)
+	if err != nil {
+		return err
+	}
+	input, contractName, version, err := standardInput(c, vo.sourceRoot)
+	if err != nil {
+		return fmt.Errorf("verify %s: %w", c.Name, err)
+	}
+	e := &etherscan{api: api, apiKey: apiKey, http: &http.Client{Timeout: 30 * time.Second}}
+	ui.Printf("Verifying %s at %s (%s, %s)\n", contractName, address.Hex(), version, api)
+
+	form := url.Values{
+		"module":          {"contract"},
+		"action":          {"verifysourcecode"},
+		"chainid":         {chainID.String()},
+		"contractaddress": {address.Hex()},
+		"sourceCode":      {string(input)},
+		"codeformat":      {"solidity-standard-json-input"},
+		"contractname":    {contractName},
+		"compilerversion": {version},
+		// sic: the API's parameter name is misspelled
+		"constructorArguements": {strings.TrimPrefix(formatValue(ctorData), "0x")},
+	}
+	var guid string
+	for {
+		r, err := e.do(ctx, url.Values{}, form)
+		if err != nil {
+			return fmt.Errorf("verify %s: %w", c.Name, err)
+		}
+		if r.Status == "1" {
+			guid = r.Result
+			break
+		}
+		if alreadyVerified(r.Result) {
+			ui.Println("  already verified")
+			return nil
+		}
+		// A fresh deployment takes a few blocks to be indexed.
+		if !strings.Contains(r.Result, "Unable to locate ContractCode") {
+			return fmt.Errorf("verify %s: %s: %s", c.Name, r.Message, r.Result)
+		}
+		ui.Verbosef("  explorer has not indexed %s yet, retrying\n", address.Hex())
+		if err := sleep(ctx, verifyPollInterval); err != nil {
+			return fmt.Errorf("verify %s: %w", c.Name, err)
+		}
+	}
+
+	ui.Verbosef("  submitted, guid %s\n", guid)
+	query := url.Values{"module": {"contract"}, "action": {"checkverifystatus"}, "chainid": {chainID.String()}, "guid": {guid}}
+	for {
+		if err := sleep(ctx, verifyPollInterval); err != nil {
+			return fmt.Errorf("verify %s: %w", c.Name, err)
+		}
+		r, err := e.do(ctx, query, nil)
+		if err != nil {
+			return fmt.Errorf("verify %s: %w", c.Name, err)
+		}
+		switch {
+		case r.Status == "1" || alreadyVerified(r.Result):
+			ui.Printf("  verified: %s\n", r.Result)
+			return nil
+		case strings.Contains(strings.ToLower(r.Result), "pending"):
+			ui.Verbosef("  %s\n", r.Result)
+		default:
+			return fmt.Errorf("verify %s: %s", c.Name, r.Result)
+		}
+	}
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// ctorDataFor finds the constructor arguments recorded for address in
+// c's manifest.
+func ctorDataFor(dir string, chainID *big.Int, c *Artifact, address common.Address) ([]byte, error) {
+	m, err := readManifest(manifestPath(dir, chainID, c.Name))
+	if err != nil {
+		return nil, err
+	}
+	for i := len(m.Deployments) - 1; i >= 0; i-- {
+		if d := m.Deployments[i]; d.codeAddress() == address {
+			return common.FromHex(d.ConstructorData), nil
+		}
+	}
+	return nil, fmt.Errorf("no deployment of %s at %s recorded in %s; pass --constructor-data", c.Name, address.Hex(), manifestPath(dir, chainID, c.Name))
+}
+
+// runVerify implements `verify [flags] [address]`. The address defaults
+// to the latest recorded deployment of --contract.
+func runVerify(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	var vo verifyOptions
+	o.register(fs)
+	ao.register(fs, "")
+	vo.register(fs)
+	ctorData := fs.String("constructor-data", "", "ABI-encoded constructor arguments (default from the manifest)")
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+
+	path, contract, err := ao.resolve()
+	if err != nil {
+		return err
+	}
+	c, err := loadArtifact(path, contract)
+	if err != nil {
+		return err
+	}
+	client, chainID, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	client.Close()
+
+	var address common.Address
+	switch {
+	case fs.NArg() > 0:
+		if address, err = parseAddress(fs.Arg(0)); err != nil {
+			return err
+		}
+	default:
+		m, err := readManifest(manifestPath(o.deployments, chainID, c.Name))
+		if err != nil {
+			return err
+		}
+		d := m.latest()
+		if d == nil {
+			return fmt.Errorf("no deployment of %s recorded on chain %s; pass an address", c.Name, chainID)
+		}
+		address = d.codeAddress()
+	}
+	if err := linkLibraries(c, nil, o.deployments, chainID); err != nil {
+		return err
+	}
+
+	var data []byte
+	if *ctorData != "" {
+		data = common.FromHex(*ctorData)
+	} else if vo.provider != "sourcify" {
+		if data, err = ctorDataFor(o.deployments, chainID, c, address); err != nil {
+			return err
+		}
+	}
+	return verifyContract(ctx, c, address, data, chainID, vo)
+}
@@ -0,0 +1,264 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// logChunk is the widest block range asked of eth_getLogs at once; most
+// providers reject larger ranges.
+const logChunk = 2000
+
+// logPos orders logs by block and index within the block.
+type logPos struct {
+	block uint64
+	index uint
+}
+
+func (p logPos) after(q logPos) bool {
+	return p.block > q.block || (p.block == q.block && p.index > q.index)
+}
+
+// watcher streams the logs matching query and remembers how far it got,
+// so a new subscription can backfill exactly what it missed.
+type watcher struct {
+	client *rpcClient
+	query  ethereum.FilterQuery
+	abi    *abi.ABI
+
+	next    *big.Int // first block not yet fetched; nil before the first connect
+	printed *logPos  // last log printed
+}
+
+// print shows l unless it was already shown.
+func (w *watcher) print(l types.Log) {
+	pos := logPos{l.BlockNumber, l.Index}
+	if l.Removed {
+		w.client.ui.Resultf("block %d tx %s removed by a reorg: %s\n", l.BlockNumber, l.TxHash.Hex(), decodeLog(&l, w.abi))
+		return
+	}
+	if w.printed != nil && !pos.after(*w.printed) {
+		return
+	}
+	w.printed = &pos
+	ev := decodeLog(&l, w.abi)
+	name := ev.Name
+	if name == "" {
+		name = "unknown"
+	}
+	w.client.metrics.event(name)
+	w.client.ui.Resultf("block %d tx %s %s\n", l.BlockNumber, l.TxHash.Hex(), ev)
+}
+
+// backfill fetches and prints the logs from w.next up to head in chunks.
+func (w *watcher) backfill(ctx context.Context, head uint64) error {
+	for w.next != nil && w.next.Uint64() <= head {
+		from := w.next.Uint64()
+		to := min(from+logChunk-1, head)
+		q := w.query
+		q.FromBlock, q.ToBlock = new(big.Int).SetUint64(from), new(big.Int).SetUint64(to)
+		logs, err := w.client.FilterLogs(ctx, q)
+		if err != nil {
+			return fmt.Errorf("get logs %d-%d: %w", from, to, err)
+		}
+		for _, l := range logs {
+			w.print(l)
+		}
+		w.next = new(big.Int).SetUint64(to + 1)
+	}
+	return nil
+}
+
+// stream subscribes, backfills anything since w.next and then prints
+// live logs until the subscription fails or ctx is done. Subscribing
+// before backfilling means no block falls between the two; logs seen by
+// both are printed once.
+func (w *watcher) stream(ctx context.Context) error {
+	logs := make(chan types.Log, 128)
+	sub, err := w.client.SubscribeFilterLogs(ctx, w.query, logs)
+	if err != nil {
+		return fmt.Errorf("subscribe: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	head, err := w.client.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("block number: %w", err)
+	}
+	if w.next == nil {
+		w.next = new(big.Int).SetUint64(head + 1)
+	}
+	if err := w.backfill(ctx, head); err != nil {
+		return err
+	}
+	w.client.ui.Printf("Watching from block %d\n", head+1)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.Err():
+			return fmt.Errorf("subscription: %w", err)
+		case l := <-logs:
+			w.print(l)
+			// Refetch from this block on reconnect; printed skips repeats.
+			if !l.Removed && l.BlockNumber > 0 && l.BlockNumber >= w.next.Uint64() {
+				w.next = new(big.Int).SetUint64(l.BlockNumber)
+			}
+		}
+	}
+}
+
+// poll stands in for stream on endpoints that cannot push logs, such as
+// HTTP ones: it fetches the logs of new blocks every interval. Logs a
+// reorg removes are not reported.
+func (w *watcher) poll(ctx context.Context, interval time.Duration) error {
+	head, err := w.client.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("block number: %w", err)
+	}
+	if w.next == nil {
+		w.next = new(big.Int).SetUint64(head + 1)
+	}
+	w.client.ui.Printf("Watching from block %s, polling every %s\n", w.next, interval)
+	for {
+		if err := w.backfill(ctx, head); err != nil {
+			return err
+		}
+		if err := sleep(ctx, interval); err != nil {
+			return err
+		}
+		if head, err = w.client.BlockNumber(ctx); err != nil {
+			return fmt.Errorf("block number: %w", err)
+		}
+	}
+}
+
+// pushEndpoints narrows o to the endpoints that can push notifications,
+// WebSocket and IPC ones, and reports whether there are any. Without one,
+// it says that what is polled for with method instead.
+func pushEndpoints(o *options, what, method string) (bool, error) {
+	urls, err := resolveRPC(o.rpc)
+	if err != nil {
+		return false, err
+	}
+	var push []string
+	for _, u := range urls {
+		if canSubscribe(u) {
+			push = append(push, u)
+		}
+	}
+	if len(push) == 0 {
+		ui.Printf("%s cannot push %s; polling with %s every %s (a ws://, wss:// or IPC endpoint streams them instead)\n", strings.Join(redactURLs(urls), ", "), what, method, o.pollInterval)
+		return false, nil
+	}
+	o.rpc = push
+	return true, nil
+}
+
+// runWatch implements `watch [flags] <address> [event]`: print matching
+// events as they are emitted until interrupted.
+func runWatch(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	var o options
+	var ao artifactOptions
+	o.register(fs)
+	ao.register(fs, "")
+	fromBlock := fs.String("from-block", "", "print historical events from this block before streaming (default live only)")
+	var mo metricsOptions
+	mo.register(fs)
+	if err := parseFlags(fs, args, &o); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return errors.New("usage: watch [flags] <address> [event]")
+	}
+	address, err := parseAddress(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	path, contract, err := ao.resolve()
+	if err != nil {
+		return err
+	}
+	c, err := loadABI(path, contract)
+	if err != nil {
+		return err
+	}
+	query := ethereum.FilterQuery{Addresses: []common.Address{address}}
+	if name := fs.Arg(1); name != "" {
+		e, err := resolveEvent(&c.ABI, name)
+		if err != nil {
+			return err
+		}
+		query.Topics = [][]common.Hash{{e.ID}}
+	}
+	from, err := parseBlock(*fromBlock)
+	if err != nil {
+		return fmt.Errorf("--from-block: %w", err)
+	}
+
+	push, err := pushEndpoints(&o, "logs", "eth_getLogs")
+	if err != nil {
+		return err
+	}
+	client, _, err := connect(ctx, &o)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	stop, err := mo.serve(client)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	// A dropped connection is redialed, its chain ID checked again, and the
+	// subscription made anew from the last block fetched, with backoff
+	// while the node stays away.
+	w := &watcher{client: client, query: query, abi: &c.ABI, next: from}
+	for attempt := 1; ; attempt++ {
+		printed := w.printed
+		if push {
+			err = w.stream(ctx)
+		} else {
+			err = w.poll(ctx, o.pollInterval)
+		}
+		if ctx.Err() != nil {
+			ui.Println("Stopped watching")
+			return nil
+		}
+		if w.printed != printed {
+			attempt = 1
+		}
+		delay := o.retry.backoff(attempt)
+		resume := "the head"
+		if w.next != nil {
+			resume = "block " + w.next.String()
+		}
+		again := "polling again"
+		if push {
+			again = "resubscribing"
+		}
+		ui.Warnf("watch: %v; %s from %s in %s\n", err, again, resume, delay)
+		if err := sleep(ctx, delay); err != nil {
+			ui.Println("Stopped watching")
+			return nil
+		}
+		if push {
+			if err := client.reconnect(ctx); err != nil {
+				ui.Warnf("watch: reconnect: %v\n", err)
+			}
+		}
+	}
+}